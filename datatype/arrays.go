@@ -0,0 +1,170 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/antonholmquist/jason"
+)
+
+// The policies of the arrays of numbers. The arrays without a policy are
+// converted to a GCListType if they are in the GCTypes, or to a FloatListType
+// otherwise.
+const (
+	KeepAll   = "keep_all"   // a FloatListType of all values.
+	LastValue = "last"       // a FloatType of the last value.
+	Sum       = "sum"        // a FloatType of the sum of the values.
+	Mean      = "mean"       // a FloatType of the mean of the non-zero values.
+	DropZeros = "drop_zeros" // a FloatListType of the non-zero values.
+	Explode   = "explode"    // a FloatType for each value, keyed by its index.
+)
+
+var arrayPolicies = []string{KeepAll, LastValue, Sum, Mean, DropZeros, Explode}
+
+// UnknownArrayPolicyError is returned when an array policy is not one of the
+// known policies.
+type UnknownArrayPolicyError struct {
+	Name   string
+	Policy string
+}
+
+func (u UnknownArrayPolicyError) Error() string {
+	return fmt.Sprintf("unknown array policy %q for %s, should be one of %s",
+		u.Policy, u.Name, strings.Join(arrayPolicies, ", "))
+}
+
+// CheckArrayPolicies returns an UnknownArrayPolicyError if any of the policies
+// is not known.
+func CheckArrayPolicies(policies map[string]string) error {
+	for name, policy := range policies {
+		known := false
+		for _, p := range arrayPolicies {
+			if strings.ToLower(policy) == p {
+				known = true
+			}
+		}
+		if !known {
+			return UnknownArrayPolicyError{Name: name, Policy: policy}
+		}
+	}
+	return nil
+}
+
+// arrayPolicy returns the policy of the array at the prefix and the name. The
+// policy of the full key, without the KeyPrefix, takes precedence over the
+// policy of the name.
+func (m *MapConvert) arrayPolicy(prefix, name string) (string, bool) {
+	key := strings.TrimPrefix(prefix+name, m.KeyPrefix)
+	if policy, ok := m.ArrayPolicies[strings.ToLower(key)]; ok {
+		return policy, true
+	}
+	policy, ok := m.ArrayPolicies[strings.ToLower(name)]
+	return policy, ok
+}
+
+// policyValues returns the DataTypes of the numbers of the array with the
+// policy. The values that are not numbers are ignored.
+func (m *MapConvert) policyValues(policy, key string, arr []*jason.Value) []DataType {
+	var values []float64
+	for _, v := range arr {
+		if f, err := v.Float64(); err == nil {
+			values = append(values, f)
+		}
+	}
+	switch policy {
+	case LastValue:
+		if len(values) == 0 {
+			return nil
+		}
+		return []DataType{NewFloatType(key, values[len(values)-1])}
+	case Sum, Mean:
+		var sum, count float64
+		for _, v := range values {
+			if v != 0 {
+				sum += v
+				count++
+			}
+		}
+		if policy == Sum {
+			return []DataType{NewFloatType(key, sum)}
+		}
+		if count == 0 {
+			return []DataType{NewFloatType(key, 0)}
+		}
+		return []DataType{NewFloatType(key, sum/count)}
+	case DropZeros:
+		list := make([]float64, 0, len(values))
+		for _, v := range values {
+			if v != 0 {
+				list = append(list, v)
+			}
+		}
+		return []DataType{NewFloatListType(key, list)}
+	case Explode:
+		results := make([]DataType, len(values))
+		for i, v := range values {
+			results[i] = NewFloatType(key+m.Flatten.Separator()+strconv.Itoa(i), v)
+		}
+		return results
+	}
+	if values == nil {
+		values = []float64{}
+	}
+	return []DataType{NewFloatListType(key, values)}
+}
+
+// isNumber returns true if the value is a json number.
+func isNumber(v *jason.Value) bool {
+	_, err := v.Float64()
+	return err == nil
+}
+
+// numbers returns true if all values of the arr are json numbers.
+func numbers(arr []*jason.Value) bool {
+	for _, v := range arr {
+		if !isNumber(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// nestedArrayValues returns the DataTypes of the array that is not an array of
+// numbers, which the expvar.Func values usually produce. The mixed arrays are
+// flattened, otherwise the values that are not numbers would be zeros. The arrays of strings,
+// booleans and nulls are recorded as RawTypes, as elasticsearch can index them
+// as they are. The elements of the other arrays are flattened like the values
+// of an object, with their indices as their keys, unless the Flatten of m
+// keeps the nested objects at this depth.
+func (m *MapConvert) nestedArrayValues(key string, depth int, value *jason.Value, arr []*jason.Value) ([]DataType, error) {
+	scalar := true
+	for _, v := range arr {
+		if _, err := v.Object(); err == nil {
+			scalar = false
+		} else if _, err := v.Array(); err == nil {
+			scalar = false
+		} else if isNumber(v) {
+			scalar = false
+		}
+	}
+	if scalar || m.Flatten.keep(depth) {
+		raw, err := value.Marshal()
+		if err != nil {
+			dataTypeErrs.Add(1)
+			return nil, nil
+		}
+		dataTypeObjs.Add(1)
+		return []DataType{NewRawType(key, raw)}, nil
+	}
+	elements := make(map[string]*jason.Value, len(arr))
+	for i, v := range arr {
+		elements[strconv.Itoa(i)] = v
+	}
+	nestedTypeCount.Add(1)
+	return m.values(key+m.Flatten.Separator(), depth+1, elements)
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+func TestArrayPolicies(t *testing.T) {
+	t.Parallel()
+	input := []byte(`{"app": {"Latencies": [0, 10, 20, 0, 30]}}`)
+	tcs := []struct {
+		policy string
+		want   []datatype.DataType
+	}{
+		{datatype.KeepAll, []datatype.DataType{datatype.NewFloatListType("app.Latencies", []float64{0, 10, 20, 0, 30})}},
+		{datatype.LastValue, []datatype.DataType{datatype.NewFloatType("app.Latencies", 30)}},
+		{datatype.Sum, []datatype.DataType{datatype.NewFloatType("app.Latencies", 60)}},
+		{datatype.Mean, []datatype.DataType{datatype.NewFloatType("app.Latencies", 20)}},
+		{datatype.DropZeros, []datatype.DataType{datatype.NewFloatListType("app.Latencies", []float64{10, 20, 30})}},
+		{datatype.Explode, []datatype.DataType{
+			datatype.NewFloatType("app.Latencies.0", 0),
+			datatype.NewFloatType("app.Latencies.1", 10),
+			datatype.NewFloatType("app.Latencies.2", 20),
+			datatype.NewFloatType("app.Latencies.3", 0),
+			datatype.NewFloatType("app.Latencies.4", 30),
+		}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.policy, func(t *testing.T) {
+			obj, err := jason.NewObjectFromBytes(input)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			mapper := datatype.DefaultMapper().WithArrayPolicies(map[string]string{"latencies": tc.policy})
+			results := mapper.Values("", obj.Map())
+			if len(results) != len(tc.want) {
+				t.Fatalf("len(results) = (%d); want (%d)", len(results), len(tc.want))
+			}
+			for i, want := range tc.want {
+				if !results[i].Equal(want) {
+					t.Errorf("results[%d] = (%v); want (%v)", i, results[i], want)
+				}
+			}
+		})
+	}
+	if len(datatype.DefaultMapper().ArrayPolicies) != 0 {
+		t.Error("the default mapper has changed")
+	}
+}
+
+func TestArrayPoliciesFullKey(t *testing.T) {
+	t.Parallel()
+	obj, err := jason.NewObjectFromBytes([]byte(`{"a": {"list": [1, 2]}, "b": {"list": [1, 2]}}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mapper := datatype.DefaultMapper().WithArrayPolicies(map[string]string{
+		"list":   datatype.Sum,
+		"b.List": datatype.LastValue,
+	})
+	results := mapper.Values("", obj.Map())
+	for _, want := range []datatype.DataType{datatype.NewFloatType("a.list", 3), datatype.NewFloatType("b.list", 2)} {
+		found := false
+		for _, r := range results {
+			if r.Equal(want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("results = (%v); want (%v) in them", results, want)
+		}
+	}
+}
+
+func TestCheckArrayPolicies(t *testing.T) {
+	t.Parallel()
+	if err := datatype.CheckArrayPolicies(map[string]string{"a": "Mean", "b": "explode"}); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	err := datatype.CheckArrayPolicies(map[string]string{"a": "median"})
+	if e, ok := err.(datatype.UnknownArrayPolicyError); !ok || e.Name != "a" || e.Policy != "median" {
+		t.Errorf("err = (%#v); want (UnknownArrayPolicyError)", err)
+	}
+}
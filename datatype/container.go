@@ -6,6 +6,7 @@ package datatype
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"sync"
@@ -18,15 +19,85 @@ import (
 // TimeStampFormat specifies the format that all timestamps are formatted with.
 var TimeStampFormat = "2006-01-02T15:04:05.999999-07:00"
 
-// Container holds a list of DataTypes. It satisfies the DataContainer.
+// DefaultTimestampField is the field of the timestamp in the documents, which
+// is expected by the kibana index patterns.
+const DefaultTimestampField = "@timestamp"
+
+// Timestamp describes how the time of a document is written. Field defaults to
+// DefaultTimestampField and Format to TimeStampFormat. Format can also be
+// "unix" or "unix_ms" for seconds or milliseconds since epoch as numbers. The
+// time is converted to the Location if it is not nil.
+type Timestamp struct {
+	Field    string
+	Format   string
+	Location *time.Location
+}
+
+// Generate prepends the timestamp pair to the list of c, and generates a json
+// object suitable for recording into a document store. The labels of c, if it
+// has any, are written in the labels field.
+func (t Timestamp) Generate(p io.Writer, c DataContainer, timestamp time.Time) (int, error) {
+	field := t.Field
+	if field == "" {
+		field = DefaultTimestampField
+	}
+	if t.Location != nil {
+		timestamp = timestamp.In(t.Location)
+	}
+	var value string
+	switch t.Format {
+	case "unix":
+		value = fmt.Sprintf("%d", timestamp.Unix())
+	case "unix_ms":
+		value = fmt.Sprintf("%d", timestamp.UnixNano()/int64(time.Millisecond))
+	default:
+		format := t.Format
+		if format == "" {
+			format = TimeStampFormat
+		}
+		value = fmt.Sprintf("%q", timestamp.Format(format))
+	}
+	key, err := json.Marshal(field)
+	if err != nil {
+		return 0, errors.Wrap(err, "timestamp field")
+	}
+	l := new(bytes.Buffer)
+	if lc, ok := c.(labelledContainer); ok && len(lc.Labels()) > 0 {
+		labels, _ := lc.Labels().MarshalJSON()
+		fmt.Fprintf(l, `,"labels":%s`, labels)
+	}
+	for _, v := range c.List() {
+		l.Write([]byte(","))
+		_, err := l.ReadFrom(v)
+		if err != nil {
+			return 0, errors.Wrap(err, "writing item")
+		}
+	}
+	return p.Write([]byte(fmt.Sprintf("{%s:%s%s}", key, value, l.Bytes())))
+}
+
+type labelledContainer interface {
+	Labels() Labels
+}
+
+type valuesParser interface {
+	ParseValues(prefix string, values map[string]*jason.Value) ([]DataType, error)
+}
+
+// Container holds a list of DataTypes. It satisfies the DataContainer. The
+// labels apply to all the DataTypes of the list.
 type Container struct {
 	sync.RWMutex
-	list []DataType
+	list   []DataType
+	labels Labels
 }
 
-// New returns a new container and populates it with the given list.
+// New returns a new container and populates it with the given list. The
+// container is taken from a pool, see Release.
 func New(list []DataType) *Container {
-	return &Container{list: list}
+	c := containerPool.Get().(*Container)
+	c.list = list
+	return c
 }
 
 // List returns the data.
@@ -43,6 +114,20 @@ func (c *Container) Len() int {
 	return len(c.list)
 }
 
+// Labels returns the labels of the container.
+func (c *Container) Labels() Labels {
+	c.RLock()
+	defer c.RUnlock()
+	return c.labels
+}
+
+// SetLabels sets the labels of the container.
+func (c *Container) SetLabels(labels Labels) {
+	c.Lock()
+	c.labels = labels
+	c.Unlock()
+}
+
 // Add adds d to the list. You can pass it as many items you need to.
 func (c *Container) Add(d ...DataType) {
 	c.Lock()
@@ -53,27 +138,33 @@ func (c *Container) Add(d ...DataType) {
 // Generate prepends a timestamp pair and value to the list, and generates
 // a json object suitable for recording into a document store.
 func (c *Container) Generate(p io.Writer, timestamp time.Time) (int, error) {
-	ts := fmt.Sprintf(`"@timestamp":"%s"`, timestamp.Format(TimeStampFormat))
-	l := new(bytes.Buffer)
-	for _, v := range c.List() {
-		l.Write([]byte(","))
-		_, err := l.ReadFrom(v)
-		if err != nil {
-			return 0, errors.Wrap(err, "writing item")
-		}
-	}
-	return p.Write([]byte(fmt.Sprintf("{%s%s}", ts, l.Bytes())))
+	return Timestamp{}.Generate(p, c, timestamp)
 }
 
 // JobResultDataTypes generates a list of DataType and puts them inside the
 // DataContainer. It returns errors if unmarshaling is unsuccessful or
-// ErrUnidentifiedJason when the container ends up empty.
+// ErrUnidentifiedJason when the container ends up empty. If the mapper can
+// return errors of the values, like the MapConvert, they are returned. The b
+// slice is decoded in place with a json.Decoder and is not modified,
+// therefore it can be shared between the mappers of the recorders without
+// copying it.
 func JobResultDataTypes(b []byte, mapper Mapper) (DataContainer, error) {
-	obj, err := jason.NewObjectFromBytes(b)
+	r := readerPool.Get().(*bytes.Reader)
+	r.Reset(b)
+	obj, err := jason.NewObjectFromReader(r)
+	r.Reset(nil)
+	readerPool.Put(r)
 	if err != nil {
 		return nil, err
 	}
-	payload := mapper.Values("", obj.Map())
+	var payload []DataType
+	if p, ok := mapper.(valuesParser); ok {
+		if payload, err = p.ParseValues("", obj.Map()); err != nil {
+			return nil, err
+		}
+	} else {
+		payload = mapper.Values("", obj.Map())
+	}
 
 	if len(payload) == 0 {
 		unidentifiedJSON.Add(1)
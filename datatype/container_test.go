@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/alext234/expipe/datatype"
 	"github.com/pkg/errors"
@@ -139,6 +140,36 @@ func TestJobResultDataTypesErrors(t *testing.T) {
 	}
 }
 
+func TestTimestampGenerate(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2017, 3, 4, 5, 6, 7, 8000000, time.UTC)
+	tokyo := time.FixedZone("Tokyo", 9*60*60)
+	tcs := []struct {
+		name string
+		ts   datatype.Timestamp
+		want string
+	}{
+		{"default", datatype.Timestamp{}, `{"@timestamp":"2017-03-04T05:06:07.008+00:00","a":1.000000}`},
+		{"field", datatype.Timestamp{Field: "timestamp"}, `{"timestamp":"2017-03-04T05:06:07.008+00:00","a":1.000000}`},
+		{"location", datatype.Timestamp{Location: tokyo}, `{"@timestamp":"2017-03-04T14:06:07.008+09:00","a":1.000000}`},
+		{"layout", datatype.Timestamp{Format: time.RFC1123Z}, `{"@timestamp":"Sat, 04 Mar 2017 05:06:07 +0000","a":1.000000}`},
+		{"unix", datatype.Timestamp{Format: "unix"}, `{"@timestamp":1488603967,"a":1.000000}`},
+		{"unix_ms", datatype.Timestamp{Format: "unix_ms"}, `{"@timestamp":1488603967008,"a":1.000000}`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := datatype.New([]datatype.DataType{datatype.NewFloatType("a", 1)})
+			w := new(bytes.Buffer)
+			if _, err := tc.ts.Generate(w, c, now); err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if w.String() != tc.want {
+				t.Errorf("w.String() = (%s); want (%s)", w.String(), tc.want)
+			}
+		})
+	}
+}
+
 func inArray(a datatype.DataType, b []datatype.DataType) bool {
 	ap := new(bytes.Buffer)
 	ap.ReadFrom(a)
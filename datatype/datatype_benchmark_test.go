@@ -106,37 +106,51 @@ func BenchmarkJobResultDataTypes(b *testing.B) {
 	mapper := datatype.DefaultMapper()
 	for _, bc := range bcs {
 		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
 			benchmarkJobResultDataTypes(b, mapper, bc.containerCount, bc.itemCount)
 		})
 	}
 }
 
+// benchmarkJobResultDataTypes decodes containerCount payloads of itemCount
+// groups of values concurrently on each iteration. The payloads are generated
+// before the timer starts.
 func benchmarkJobResultDataTypes(b *testing.B, mapper datatype.Mapper, containerCount, itemCount int) {
-	var wg sync.WaitGroup
 	now := time.Now()
-	for i := 0; i <= containerCount; i++ {
-		wg.Add(1)
-		go func() {
-			b.StopTimer()
-			p := new(bytes.Buffer)
-			container := datatype.Container{}
-			for j := 0; j < itemCount; j++ {
-				container.Add(
-					newFloatType(),
-					newStringType(),
-					newByteType(),
-					newKiloByteType(),
-					newMegaByteType(),
-				)
-			}
-			container.Generate(p, now)
-			b.StartTimer()
-			res, _ := datatype.JobResultDataTypes(p.Bytes()[:], mapper)
-			res.Generate(ioutil.Discard, now)
-			wg.Done()
-		}()
+	payloads := make([][]byte, containerCount)
+	for i := range payloads {
+		p := new(bytes.Buffer)
+		container := datatype.Container{}
+		for j := 0; j < itemCount; j++ {
+			container.Add(
+				newFloatType(),
+				newStringType(),
+				newByteType(),
+				newKiloByteType(),
+				newMegaByteType(),
+			)
+		}
+		container.Generate(p, now)
+		payloads[i] = p.Bytes()
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var wg sync.WaitGroup
+		for _, p := range payloads {
+			wg.Add(1)
+			go func(p []byte) {
+				defer wg.Done()
+				res, err := datatype.JobResultDataTypes(p, mapper)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				res.Generate(ioutil.Discard, now)
+				datatype.Release(res)
+			}(p)
+		}
+		wg.Wait()
 	}
-	wg.Wait()
 }
 
 func randomString(count int) string {
@@ -262,3 +276,53 @@ func BenchmarkStringType(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkRelease shows the allocations that are saved when the payloads are
+// put back in the pools after they are recorded.
+func BenchmarkRelease(b *testing.B) {
+	now := time.Now()
+	p := new(bytes.Buffer)
+	container := datatype.Container{}
+	for j := 0; j < 100; j++ {
+		container.Add(newFloatType(), newStringType(), newByteType())
+	}
+	container.Generate(p, now)
+	mapper := datatype.DefaultMapper()
+
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			res, _ := datatype.JobResultDataTypes(p.Bytes(), mapper)
+			res.Generate(ioutil.Discard, now)
+		}
+	})
+
+	b.Run("Decode and Release", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			res, _ := datatype.JobResultDataTypes(p.Bytes(), mapper)
+			res.Generate(ioutil.Discard, now)
+			datatype.Release(res)
+		}
+	})
+
+	b.Run("New", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			datatype.New([]datatype.DataType{
+				datatype.NewFloatType("Alloc", 1024),
+				datatype.NewByteType("HeapAlloc", 2048),
+			})
+		}
+	})
+
+	b.Run("New and Release", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			datatype.Release(datatype.New([]datatype.DataType{
+				datatype.NewFloatType("Alloc", 1024),
+				datatype.NewByteType("HeapAlloc", 2048),
+			}))
+		}
+	})
+}
@@ -0,0 +1,337 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/antonholmquist/jason"
+)
+
+// Expression is an arithmetic expression of numbers and the keys of the
+// payloads, for example:
+//
+//	memstats.HeapInuse / memstats.HeapSys * 100
+//
+// It supports the +, -, * and / operators, the unary minus and parentheses.
+// The keys are the flattened keys of the payloads. The keys that have other
+// characters than letters, digits, dots and underscores are quoted with
+// backticks, for example `Read Duration`.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// ExpressionError is returned when an expression can not be parsed or
+// evaluated.
+type ExpressionError struct {
+	Expression string
+	Pos        int
+	Reason     string
+}
+
+func (e ExpressionError) Error() string {
+	return fmt.Sprintf("expression %q at %d: %s", e.Expression, e.Pos, e.Reason)
+}
+
+// ParseExpression returns an Expression from the source. It returns an
+// ExpressionError if the source is not a valid expression.
+func ParseExpression(source string) (*Expression, error) {
+	p := &exprParser{source: source}
+	p.next()
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string { return e.source }
+
+// Eval evaluates the expression with the values that the lookup returns for
+// the keys. It returns an ExpressionError if a key is not found or if there is
+// a division by zero.
+func (e *Expression) Eval(lookup func(key string) (float64, bool)) (float64, error) {
+	return e.root.eval(e.source, lookup)
+}
+
+// WithComputedFields returns a copy of m with the fields added to its
+// ComputedFields. The fields are the names of the computed values and their
+// expressions. It returns an ExpressionError if any of the expressions is not
+// valid.
+func (m *MapConvert) WithComputedFields(fields map[string]string) (*MapConvert, error) {
+	newMapper := m.Copy().(*MapConvert)
+	if len(fields) > 0 && newMapper.ComputedFields == nil {
+		newMapper.ComputedFields = make(map[string]*Expression, len(fields))
+	}
+	for name, source := range fields {
+		expr, err := ParseExpression(source)
+		if err != nil {
+			return nil, err
+		}
+		newMapper.ComputedFields[name] = expr
+	}
+	return newMapper, nil
+}
+
+// computedValues returns a FloatType for each of the ComputedFields that can
+// be evaluated with the values. The keys of the expressions do not have the
+// prefix, but the names of the fields do. The fields that refer to missing
+// keys are ignored.
+func (m *MapConvert) computedValues(prefix string, values map[string]*jason.Value) []DataType {
+	if len(m.ComputedFields) == 0 {
+		return nil
+	}
+	numbers := make(map[string]float64)
+	m.flatNumbers(numbers, "", values)
+	lookup := func(key string) (float64, bool) {
+		f, ok := numbers[key]
+		return f, ok
+	}
+	names := make([]string, 0, len(m.ComputedFields))
+	for name := range m.ComputedFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var results []DataType
+	for _, name := range names {
+		f, err := m.ComputedFields[name].Eval(lookup)
+		if err != nil {
+			dataTypeErrs.Add(1)
+			continue
+		}
+		computedTypeCount.Add(1)
+		results = append(results, NewFloatType(prefix+name, f))
+	}
+	return results
+}
+
+func (m *MapConvert) flatNumbers(numbers map[string]float64, prefix string, values map[string]*jason.Value) {
+	for name, value := range values {
+		if f, err := value.Float64(); err == nil {
+			numbers[prefix+name] = f
+		} else if obj, err := value.Object(); err == nil {
+			m.flatNumbers(numbers, prefix+name+m.Flatten.Separator(), obj.Map())
+		}
+	}
+}
+
+type exprNode interface {
+	eval(source string, lookup func(string) (float64, bool)) (float64, error)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(string, func(string) (float64, bool)) (float64, error) {
+	return float64(n), nil
+}
+
+type keyNode struct {
+	key string
+	pos int
+}
+
+func (k keyNode) eval(source string, lookup func(string) (float64, bool)) (float64, error) {
+	f, ok := lookup(k.key)
+	if !ok {
+		return 0, ExpressionError{Expression: source, Pos: k.pos, Reason: fmt.Sprintf("key %s not found", k.key)}
+	}
+	return f, nil
+}
+
+type negNode struct{ operand exprNode }
+
+func (n negNode) eval(source string, lookup func(string) (float64, bool)) (float64, error) {
+	f, err := n.operand.eval(source, lookup)
+	return -f, err
+}
+
+type binaryNode struct {
+	op          byte
+	pos         int
+	left, right exprNode
+}
+
+func (b binaryNode) eval(source string, lookup func(string) (float64, bool)) (float64, error) {
+	l, err := b.left.eval(source, lookup)
+	if err != nil {
+		return 0, err
+	}
+	r, err := b.right.eval(source, lookup)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	}
+	if r == 0 {
+		return 0, ExpressionError{Expression: source, Pos: b.pos, Reason: "division by zero"}
+	}
+	return l / r, nil
+}
+
+const (
+	tokEOF = iota
+	tokNumber
+	tokKey
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	source string
+	pos    int
+	tok    exprToken
+	err    error
+}
+
+func (p *exprParser) errorf(format string, a ...interface{}) error {
+	return ExpressionError{Expression: p.source, Pos: p.tok.pos, Reason: fmt.Sprintf(format, a...)}
+}
+
+func isKeyChar(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// next reads the next token into p.tok. The errors of the tokens are kept in
+// p.err and returned by the parser.
+func (p *exprParser) next() {
+	for p.pos < len(p.source) && p.source[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.source) {
+		p.tok = exprToken{kind: tokEOF, text: "end of expression", pos: start}
+		return
+	}
+	c := p.source[p.pos]
+	switch {
+	case strings.IndexByte("+-*/()", c) >= 0:
+		p.pos++
+		p.tok = exprToken{kind: tokOp, text: string(c), pos: start}
+	case c == '`':
+		end := strings.IndexByte(p.source[start+1:], '`')
+		if end < 0 {
+			p.pos = len(p.source)
+			p.tok = exprToken{kind: tokEOF, text: "end of expression", pos: start}
+			p.err = ExpressionError{Expression: p.source, Pos: start, Reason: "unterminated quoted key"}
+			return
+		}
+		p.pos = start + end + 2
+		p.tok = exprToken{kind: tokKey, text: p.source[start+1 : start+end+1], pos: start}
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.source) && (p.source[p.pos] >= '0' && p.source[p.pos] <= '9' || p.source[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = exprToken{kind: tokNumber, text: p.source[start:p.pos], pos: start}
+	case isKeyChar(c):
+		for p.pos < len(p.source) && isKeyChar(p.source[p.pos]) {
+			p.pos++
+		}
+		p.tok = exprToken{kind: tokKey, text: p.source[start:p.pos], pos: start}
+	default:
+		p.pos++
+		p.tok = exprToken{kind: tokOp, text: string(c), pos: start}
+	}
+}
+
+// parseSum parses the terms joined with + and -.
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-") {
+		op := binaryNode{op: p.tok.text[0], pos: p.tok.pos, left: left}
+		p.next()
+		if op.right, err = p.parseProduct(); err != nil {
+			return nil, err
+		}
+		left = op
+	}
+	return left, nil
+}
+
+// parseProduct parses the factors joined with * and /.
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/") {
+		op := binaryNode{op: p.tok.text[0], pos: p.tok.pos, left: left}
+		p.next()
+		if op.right, err = p.parseFactor(); err != nil {
+			return nil, err
+		}
+		left = op
+	}
+	return left, nil
+}
+
+// parseFactor parses the numbers, keys, negations and parentheses.
+func (p *exprParser) parseFactor() (exprNode, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch {
+	case tok.kind == tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("bad number %q", tok.text)
+		}
+		p.next()
+		return numberNode(f), nil
+	case tok.kind == tokKey:
+		if tok.text == "" {
+			return nil, p.errorf("empty key")
+		}
+		p.next()
+		return keyNode{key: tok.text, pos: tok.pos}, nil
+	case tok.kind == tokOp && tok.text == "-":
+		p.next()
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{operand}, nil
+	case tok.kind == tokOp && tok.text == "(":
+		p.next()
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		if p.tok.kind != tokOp || p.tok.text != ")" {
+			return nil, p.errorf("missing )")
+		}
+		p.next()
+		return node, nil
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+func TestExpressionEval(t *testing.T) {
+	t.Parallel()
+	values := map[string]float64{"a": 6, "b.c": 3, "Read Duration": 2, "zero": 0}
+	lookup := func(key string) (float64, bool) {
+		f, ok := values[key]
+		return f, ok
+	}
+	tcs := []struct {
+		source string
+		want   float64
+	}{
+		{"1", 1},
+		{"a / b.c", 2},
+		{"a + b.c * 2", 12},
+		{"(a + b.c) * 2", 18},
+		{"-a + 1.5", -4.5},
+		{"a - -b.c", 9},
+		{"`Read Duration` * 10", 20},
+		{"a / b.c / 2", 1},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.source, func(t *testing.T) {
+			e, err := datatype.ParseExpression(tc.source)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			got, err := e.Eval(lookup)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if got != tc.want {
+				t.Errorf("Eval() = (%f); want (%f)", got, tc.want)
+			}
+		})
+	}
+	for _, source := range []string{"a / zero", "a + missing"} {
+		e, err := datatype.ParseExpression(source)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if _, err = e.Eval(lookup); err == nil {
+			t.Errorf("%s: err = (nil); want (error)", source)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	t.Parallel()
+	for _, source := range []string{"", "a +", "(a", "a b", "a % b", "`a", "1.2.3", "a )"} {
+		if _, err := datatype.ParseExpression(source); err == nil {
+			t.Errorf("%q: err = (nil); want (error)", source)
+		} else if _, ok := err.(datatype.ExpressionError); !ok {
+			t.Errorf("%q: err = (%#v); want (ExpressionError)", source, err)
+		}
+	}
+}
+
+func TestValuesComputedFields(t *testing.T) {
+	t.Parallel()
+	obj, err := jason.NewObjectFromBytes([]byte(`{
+		"memstats": {"HeapInuse": 25, "HeapSys": 100},
+		"requests": {"value": 4, "labels": {"code": "200"}}
+	}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mapper, err := datatype.DefaultMapper().WithComputedFields(map[string]string{
+		"heap_used_ratio": "memstats.HeapInuse / memstats.HeapSys",
+		"missing":         "memstats.Nothing + 1",
+	})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	results := mapper.Values("", obj.Map())
+	count := 0
+	for _, r := range results {
+		if r.Equal(datatype.NewFloatType("heap_used_ratio", 0.25)) {
+			count++
+		}
+		if r.Equal(datatype.NewFloatType("missing", 1)) {
+			t.Error("the field with a missing key is computed")
+		}
+	}
+	if count != 1 {
+		t.Errorf("results = (%v); want one heap_used_ratio of 0.25", results)
+	}
+	if len(datatype.DefaultMapper().ComputedFields) != 0 {
+		t.Error("the default mapper has changed")
+	}
+	if _, err = datatype.DefaultMapper().WithComputedFields(map[string]string{"bad": "a +"}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
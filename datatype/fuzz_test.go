@@ -0,0 +1,87 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+)
+
+var fuzzPayloads = []string{
+	`{}`,
+	`{"a":1}`,
+	`{"memstats":{"Alloc":1048576,"PauseNs":[100,200],"PauseEnd":[1,2]}}`,
+	`{"a":{"b":{"c":{"d":"e"}}},"f":[1,"2",null,{"g":3}]}`,
+	`{"latency":{"count":3,"sum":6,"buckets":{"1":1,"5":2,"+Inf":3}}}`,
+	`{"latency":{"count":3,"sum":6,"quantiles":{"0.5":1,"0.99":3}}}`,
+	`{"requests":{"value":1,"labels":{"code":"200"}}}`,
+	`{"Alloc":"1MB","Sys":null,"HeapAlloc":{"value":"x","labels":[]}}`,
+	`{"a":1e400,"b":-0,"c":"\u0000"}`,
+	`{"memstats":{"PauseNs":[1e308,1e308],"PauseEnd":[1e308,1e308]},"a\"b\\":"\"c\""}`,
+	`[1,2,3]`,
+	`null`,
+}
+
+// generate reads all the values of the payload, as the recorders would, and
+// fails if the document is not valid json.
+func generate(t *testing.T, payload datatype.DataContainer) {
+	buf := new(bytes.Buffer)
+	if _, err := payload.Generate(buf, time.Now()); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		t.Fatalf("invalid document: %s", buf)
+	}
+	for _, d := range payload.List() {
+		d.Reset()
+		if _, err := ioutil.ReadAll(d); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+}
+
+func FuzzJobResultDataTypes(f *testing.F) {
+	for _, p := range fuzzPayloads {
+		f.Add([]byte(p))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		payload, err := datatype.JobResultDataTypes(b, datatype.DefaultMapper())
+		if err != nil {
+			return
+		}
+		generate(t, payload)
+	})
+}
+
+func FuzzFlatten(f *testing.F) {
+	for _, p := range fuzzPayloads {
+		f.Add([]byte(p), "", 0, false)
+		f.Add([]byte(p), "_", 2, false)
+		f.Add([]byte(p), "/", 1, true)
+	}
+	f.Fuzz(func(t *testing.T, b []byte, delimiter string, maxDepth int, keepNested bool) {
+		if maxDepth < 0 {
+			maxDepth = -maxDepth
+		}
+		mapper := datatype.DefaultMapper().Copy().(*datatype.MapConvert)
+		mapper.Flatten = datatype.Flatten{
+			Delimiter:  delimiter,
+			MaxDepth:   maxDepth,
+			KeepNested: keepNested,
+		}
+		mapper.SummaryTypes = []string{"PauseEnd"}
+		mapper.ArrayPolicies = map[string]string{"f": datatype.Explode, "memstats.pausens": datatype.Mean}
+		payload, err := datatype.JobResultDataTypes(b, mapper)
+		if err != nil {
+			return
+		}
+		generate(t, payload)
+	})
+}
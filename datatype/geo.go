@@ -0,0 +1,110 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/geoip"
+	"github.com/pkg/errors"
+)
+
+// GeoPointSuffix is appended to the keys of the IP addresses for the keys of
+// their locations.
+const GeoPointSuffix = "_geo"
+
+// Locator returns the latitude and longitude of the IP addresses. It returns
+// false if the ip can not be located.
+type Locator interface {
+	Locate(ip net.IP) (lat, lon float64, ok bool)
+}
+
+// GeoIP describes the fields that have IP addresses, and the MaxMind database
+// that locates them.
+type GeoIP struct {
+	Database string   `mapstructure:"database"`
+	Fields   []string `mapstructure:"fields"`
+}
+
+// GeoPointType represents a pair of key values in which the value is a
+// location, which elasticsearch can map as a geo_point:
+//
+//	"client_ip_geo":{"lat":51.500000,"lon":-0.120000}
+type GeoPointType struct {
+	readType
+	Key      string
+	Lat, Lon float64
+}
+
+// NewGeoPointType returns a new GeoPointType object.
+func NewGeoPointType(key string, lat, lon float64) *GeoPointType {
+	g := &GeoPointType{Key: key, Lat: lat, Lon: lon}
+	g.content = fmt.Sprintf(`%s:{"lat":%f,"lon":%f}`, quote(key), lat, lon)
+	return g
+}
+
+// Equal compares both keys and locations and returns true if they are equal.
+func (g GeoPointType) Equal(other DataType) bool {
+	switch o := other.(type) {
+	case *GeoPointType:
+		return g.Key == o.Key && g.Lat == o.Lat && g.Lon == o.Lon
+	}
+	return false
+}
+
+// WithGeoIP returns a copy of m that locates the IP addresses of the fields of
+// the g with its database. It returns an error if the database can not be
+// read, or there are no fields.
+func (m *MapConvert) WithGeoIP(g GeoIP) (*MapConvert, error) {
+	if g.Database == "" {
+		return nil, errors.New("empty geoip database")
+	}
+	if len(g.Fields) == 0 {
+		return nil, errors.New("no geoip fields")
+	}
+	db, err := geoip.Open(g.Database)
+	if err != nil {
+		return nil, err
+	}
+	return m.WithLocator(db, g.Fields), nil
+}
+
+// WithLocator returns a copy of m that records the locations of the IP
+// addresses of the fields as GeoPointTypes, keyed by the fields and the
+// GeoPointSuffix. The fields are the full keys without the KeyPrefix, and
+// they are case insensitive.
+func (m *MapConvert) WithLocator(l Locator, fields []string) *MapConvert {
+	newMapper := m.Copy().(*MapConvert)
+	newMapper.Locator = l
+	newMapper.GeoIPFields = make([]string, len(fields))
+	for i, f := range fields {
+		newMapper.GeoIPFields[i] = strings.ToLower(f)
+	}
+	return newMapper
+}
+
+// geoPoint returns the location of the IP address of the key if it is one of
+// the GeoIPFields.
+func (m *MapConvert) geoPoint(key, value string) (DataType, bool) {
+	if m.Locator == nil {
+		return nil, false
+	}
+	if !tools.StringInSlice(strings.ToLower(strings.TrimPrefix(key, m.KeyPrefix)), m.GeoIPFields) {
+		return nil, false
+	}
+	ip := net.ParseIP(strings.TrimSpace(value))
+	if ip == nil {
+		return nil, false
+	}
+	lat, lon, ok := m.Locator.Locate(ip)
+	if !ok {
+		return nil, false
+	}
+	geoPointTypeCount.Add(1)
+	return NewGeoPointType(key+GeoPointSuffix, lat, lon), true
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+type locator map[string][2]float64
+
+func (l locator) Locate(ip net.IP) (float64, float64, bool) {
+	loc, ok := l[ip.String()]
+	return loc[0], loc[1], ok
+}
+
+func TestNewGeoPointType(t *testing.T) {
+	t.Parallel()
+	g := datatype.NewGeoPointType("ip_geo", 51.5, -0.12)
+	want := `"ip_geo":{"lat":51.500000,"lon":-0.120000}`
+	if got := readContent(g); got != want {
+		t.Errorf("content = (%s); want (%s)", got, want)
+	}
+	if !g.Equal(datatype.NewGeoPointType("ip_geo", 51.5, -0.12)) {
+		t.Error("g.Equal(same) = (false); want (true)")
+	}
+	if g.Equal(datatype.NewGeoPointType("ip_geo", 51.5, 0)) {
+		t.Error("g.Equal(other) = (true); want (false)")
+	}
+}
+
+func TestValuesGeoIP(t *testing.T) {
+	t.Parallel()
+	obj, err := jason.NewObjectFromBytes([]byte(`{
+		"probe": {"Client_IP": "1.2.3.4", "peer": "81.2.3.4"},
+		"server_ip": "10.0.0.1",
+		"bad_ip": "not an ip"
+	}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	l := locator{"1.2.3.4": {51.5, -0.12}, "81.2.3.4": {52.37, 4.89}}
+	mapper := datatype.DefaultMapper().WithLocator(l, []string{"probe.client_ip", "server_ip", "bad_ip"})
+	mapper.KeyPrefix = "edge."
+	results := mapper.Values("", obj.Map())
+	want := []datatype.DataType{
+		datatype.NewStringType("edge.probe.Client_IP", "1.2.3.4"),
+		datatype.NewGeoPointType("edge.probe.Client_IP_geo", 51.5, -0.12),
+		datatype.NewStringType("edge.probe.peer", "81.2.3.4"),
+		datatype.NewStringType("edge.server_ip", "10.0.0.1"),
+		datatype.NewStringType("edge.bad_ip", "not an ip"),
+	}
+	if len(results) != len(want) {
+		t.Errorf("len(results) = (%d); want (%d): %v", len(results), len(want), results)
+	}
+	for _, w := range want {
+		found := false
+		for _, r := range results {
+			if r.Equal(w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("results = (%v); want (%v) in them", results, w)
+		}
+	}
+	if datatype.DefaultMapper().Locator != nil {
+		t.Error("the default mapper has changed")
+	}
+}
+
+func TestWithGeoIPErrors(t *testing.T) {
+	t.Parallel()
+	for _, g := range []datatype.GeoIP{
+		{Fields: []string{"ip"}},
+		{Database: "testdata/missing.mmdb"},
+		{Database: "testdata/missing.mmdb", Fields: []string{"ip"}},
+	} {
+		if _, err := datatype.DefaultMapper().WithGeoIP(g); err == nil {
+			t.Errorf("%v: err = (nil); want (error)", g)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"expvar"
+	"sync"
+)
+
+var (
+	// distinctKeys is the number of the distinct keys of each reader.
+	distinctKeys = expvar.NewMap("Distinct Keys")
+	// droppedKeys is the number of the values that are dropped because
+	// their keys are over the limit of the reader.
+	droppedKeys = expvar.NewMap("Dropped Keys")
+)
+
+// KeyGuard limits the number of the distinct keys of a reader, which protects
+// the mappings of elasticsearch from the applications that have ids in their
+// keys. Once there are MaxKeys keys, the values of the new keys are dropped
+// and counted in the "Dropped Keys" expvar map under the Name. It is shared
+// between the copies of the mapper and is safe for concurrent use.
+type KeyGuard struct {
+	Name    string
+	MaxKeys int
+	mu      sync.Mutex
+	keys    map[string]struct{}
+	count   *expvar.Int
+}
+
+// NewKeyGuard returns a KeyGuard for the reader with the name.
+func NewKeyGuard(name string, maxKeys int) *KeyGuard {
+	count := new(expvar.Int)
+	distinctKeys.Set(name, count)
+	return &KeyGuard{
+		Name:    name,
+		MaxKeys: maxKeys,
+		keys:    make(map[string]struct{}),
+		count:   count,
+	}
+}
+
+// Allow returns true if the key has been seen before, or if there is room for
+// a new key.
+func (g *KeyGuard) Allow(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.keys[key]; ok {
+		return true
+	}
+	if len(g.keys) >= g.MaxKeys {
+		droppedKeys.Add(g.Name, 1)
+		return false
+	}
+	g.keys[key] = struct{}{}
+	g.count.Set(int64(len(g.keys)))
+	return true
+}
+
+// Len returns the number of the distinct keys.
+func (g *KeyGuard) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.keys)
+}
+
+// guard returns the DataTypes of which the keys are allowed by the KeyGuard
+// of m. The DataTypes of unknown types are not guarded.
+func (m *MapConvert) guard(results []DataType) []DataType {
+	if m.KeyGuard == nil {
+		return results
+	}
+	allowed := results[:0]
+	for _, d := range results {
+		if key, ok := KeyOf(d); ok && !m.KeyGuard.Allow(key) {
+			continue
+		}
+		allowed = append(allowed, d)
+	}
+	return allowed
+}
+
+// KeyOf returns the key of the DataTypes of this package. It returns false for
+// the other DataTypes.
+func KeyOf(d DataType) (string, bool) {
+	switch t := d.(type) {
+	case *FloatType:
+		return t.Key, true
+	case *StringType:
+		return t.Key, true
+	case *FloatListType:
+		return t.Key, true
+	case *GCListType:
+		return t.Key, true
+	case *ByteType:
+		return t.Key, true
+	case *KiloByteType:
+		return t.Key, true
+	case *MegaByteType:
+		return t.Key, true
+	case *RawType:
+		return t.Key, true
+	case *HistogramType:
+		return t.Key, true
+	case *SummaryType:
+		return t.Key, true
+	case *LabelledType:
+		return t.Key, true
+	case *GeoPointType:
+		return t.Key, true
+	}
+	return "", false
+}
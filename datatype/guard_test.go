@@ -0,0 +1,65 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+func TestKeyGuard(t *testing.T) {
+	t.Parallel()
+	mapper := datatype.DefaultMapper().WithFields(map[string]string{"env": "prod"})
+	mapper.KeyGuard = datatype.NewKeyGuard("TestKeyGuard", 3)
+	values := func(input string) []datatype.DataType {
+		obj, err := jason.NewObjectFromBytes([]byte(input))
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		return mapper.Copy().(*datatype.MapConvert).Values("", obj.Map())
+	}
+	if got := values(`{"a": 1, "b": 2}`); len(got) != 3 {
+		t.Errorf("len(results) = (%d); want (3): %v", len(got), got)
+	}
+	got := values(`{"session": {"c": 3, "d": 4, "e": 5}, "a": 6}`)
+	if len(got) != 3 {
+		t.Errorf("len(results) = (%d); want a, one of the sessions and env: %v", len(got), got)
+	}
+	if mapper.KeyGuard.Len() != 3 {
+		t.Errorf("Len() = (%d); want (3)", mapper.KeyGuard.Len())
+	}
+	dropped := expvar.Get("Dropped Keys").(*expvar.Map).Get("TestKeyGuard")
+	if dropped == nil || dropped.String() != "2" {
+		t.Errorf("Dropped Keys = (%v); want (2)", dropped)
+	}
+	distinct := expvar.Get("Distinct Keys").(*expvar.Map).Get("TestKeyGuard")
+	if distinct == nil || distinct.String() != "3" {
+		t.Errorf("Distinct Keys = (%v); want (3)", distinct)
+	}
+}
+
+func TestKeyGuardConcurrent(t *testing.T) {
+	t.Parallel()
+	g := datatype.NewKeyGuard("TestKeyGuardConcurrent", 50)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				g.Allow(fmt.Sprintf("key%d.%d", i, j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if g.Len() != 50 {
+		t.Errorf("Len() = (%d); want (50)", g.Len())
+	}
+}
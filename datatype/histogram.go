@@ -0,0 +1,237 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/antonholmquist/jason"
+)
+
+// SummaryQuantiles are the quantiles of the summaries that are produced from
+// the lists of values.
+var SummaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Bucket is a bucket of a histogram. Count is the cumulative count of the
+// observations that are less than or equal to the UpperBound.
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+type byUpperBound []Bucket
+
+func (b byUpperBound) Len() int           { return len(b) }
+func (b byUpperBound) Less(i, j int) bool { return b[i].UpperBound < b[j].UpperBound }
+func (b byUpperBound) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// HistogramType represents a pair of key values in which the value is a
+// histogram. It is recorded as a sub-document with the count, sum and buckets
+// of the histogram.
+type HistogramType struct {
+	readType
+	Key     string
+	Count   uint64
+	Sum     float64
+	Buckets []Bucket
+}
+
+// NewHistogramType returns a new HistogramType object. The buckets are sorted
+// by their upper bounds.
+func NewHistogramType(key string, count uint64, sum float64, buckets []Bucket) *HistogramType {
+	h := &HistogramType{Key: key, Count: count, Sum: sum, Buckets: buckets}
+	sort.Sort(byUpperBound(h.Buckets))
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `%s:{"count":%d,"sum":%s,"buckets":[`, quote(h.Key), h.Count, formatFloat(h.Sum, 6))
+	for i, b := range h.Buckets {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(buf, `{"le":%s,"count":%d}`, formatFloat(b.UpperBound, 6), b.Count)
+	}
+	buf.WriteString("]}")
+	h.content = buf.String()
+	return h
+}
+
+// Equal compares the keys, counts, sums and buckets and returns true if they
+// are equal.
+func (h HistogramType) Equal(other DataType) bool {
+	switch o := other.(type) {
+	case *HistogramType:
+		if h.Key != o.Key || h.Count != o.Count || h.Sum != o.Sum || len(h.Buckets) != len(o.Buckets) {
+			return false
+		}
+		for i := range h.Buckets {
+			if h.Buckets[i] != o.Buckets[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Quantile is a quantile of a summary, for example the 0.9 quantile.
+type Quantile struct {
+	Quantile float64
+	Value    float64
+}
+
+type byQuantile []Quantile
+
+func (q byQuantile) Len() int           { return len(q) }
+func (q byQuantile) Less(i, j int) bool { return q[i].Quantile < q[j].Quantile }
+func (q byQuantile) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+// SummaryType represents a pair of key values in which the value is a summary.
+// It is recorded as a sub-document with the count, sum and quantiles of the
+// summary.
+type SummaryType struct {
+	readType
+	Key       string
+	Count     uint64
+	Sum       float64
+	Quantiles []Quantile
+}
+
+// NewSummaryType returns a new SummaryType object. The quantiles are sorted.
+func NewSummaryType(key string, count uint64, sum float64, quantiles []Quantile) *SummaryType {
+	s := &SummaryType{Key: key, Count: count, Sum: sum, Quantiles: quantiles}
+	sort.Sort(byQuantile(s.Quantiles))
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `%s:{"count":%d,"sum":%s,"quantiles":[`, quote(s.Key), s.Count, formatFloat(s.Sum, 6))
+	for i, q := range s.Quantiles {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(buf, `{"quantile":%s,"value":%s}`, formatFloat(q.Quantile, 6), formatFloat(q.Value, 6))
+	}
+	buf.WriteString("]}")
+	s.content = buf.String()
+	return s
+}
+
+// NewSummaryFromValues returns a SummaryType of the values for the
+// SummaryQuantiles. The zero values are ignored, as they are the unused slots
+// of lists like PauseNs.
+func NewSummaryFromValues(key string, values []float64) *SummaryType {
+	var (
+		list []float64
+		sum  float64
+	)
+	for _, v := range values {
+		if v != 0 {
+			list = append(list, v)
+			sum += v
+		}
+	}
+	sort.Float64s(list)
+	var quantiles []Quantile
+	if len(list) > 0 {
+		quantiles = make([]Quantile, len(SummaryQuantiles))
+		for i, q := range SummaryQuantiles {
+			// nearest rank.
+			rank := int(math.Ceil(q*float64(len(list)))) - 1
+			if rank < 0 {
+				rank = 0
+			}
+			quantiles[i] = Quantile{Quantile: q, Value: list[rank]}
+		}
+	}
+	return NewSummaryType(key, uint64(len(list)), sum, quantiles)
+}
+
+// Equal compares the keys, counts, sums and quantiles and returns true if they
+// are equal.
+func (s SummaryType) Equal(other DataType) bool {
+	switch o := other.(type) {
+	case *SummaryType:
+		if s.Key != o.Key || s.Count != o.Count || s.Sum != o.Sum || len(s.Quantiles) != len(o.Quantiles) {
+			return false
+		}
+		for i := range s.Quantiles {
+			if s.Quantiles[i] != o.Quantiles[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// distributionValue returns a HistogramType if the obj has only the count, sum
+// and buckets keys, or a SummaryType if it has only the count, sum and
+// quantiles keys. The buckets and quantiles are objects of the bounds to the
+// values, as the metrics of expipe are published:
+//
+//	{"count": 3, "sum": 0.6, "buckets": {"0.1": 1, "0.5": 3}}
+//	{"count": 3, "sum": 0.6, "quantiles": {"0.5": 0.2, "0.9": 0.3}}
+func distributionValue(key string, obj *jason.Object) (DataType, bool) {
+	m := obj.Map()
+	if len(m) != 3 {
+		return nil, false
+	}
+	count, err := obj.GetInt64("count")
+	if err != nil || count < 0 {
+		return nil, false
+	}
+	sum, err := obj.GetFloat64("sum")
+	if err != nil {
+		return nil, false
+	}
+	if buckets, err := obj.GetObject("buckets"); err == nil {
+		values, ok := boundValues(buckets)
+		if !ok {
+			return nil, false
+		}
+		list := make([]Bucket, 0, len(values))
+		for bound, v := range values {
+			list = append(list, Bucket{UpperBound: bound, Count: uint64(v)})
+		}
+		histogramTypeCount.Add(1)
+		return NewHistogramType(key, uint64(count), sum, list), true
+	}
+	if quantiles, err := obj.GetObject("quantiles"); err == nil {
+		values, ok := boundValues(quantiles)
+		if !ok {
+			return nil, false
+		}
+		list := make([]Quantile, 0, len(values))
+		for q, v := range values {
+			list = append(list, Quantile{Quantile: q, Value: v})
+		}
+		summaryTypeCount.Add(1)
+		return NewSummaryType(key, uint64(count), sum, list), true
+	}
+	return nil, false
+}
+
+// boundValues returns the values of the obj keyed by their keys parsed as
+// floats. It returns false if any of the keys or values are not numbers. The
+// keys that are not finite, like the "+Inf" bucket whose count is the count of
+// the histogram, are dropped as they can not be written in json.
+func boundValues(obj *jason.Object) (map[float64]float64, bool) {
+	result := make(map[float64]float64, len(obj.Map()))
+	for k, v := range obj.Map() {
+		bound, err := strconv.ParseFloat(k, 64)
+		if err != nil {
+			return nil, false
+		}
+		if math.IsInf(bound, 0) || math.IsNaN(bound) {
+			continue
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, false
+		}
+		result[bound] = f
+	}
+	return result, true
+}
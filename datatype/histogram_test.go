@@ -0,0 +1,167 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+func readContent(d datatype.DataType) string {
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(d)
+	return buf.String()
+}
+
+func TestNewHistogramType(t *testing.T) {
+	t.Parallel()
+	h := datatype.NewHistogramType("latency", 3, 0.6, []datatype.Bucket{
+		{UpperBound: 0.5, Count: 3},
+		{UpperBound: 0.1, Count: 1},
+	})
+	want := `"latency":{"count":3,"sum":0.600000,"buckets":[{"le":0.100000,"count":1},{"le":0.500000,"count":3}]}`
+	if got := readContent(h); got != want {
+		t.Errorf("content = (%s); want (%s)", got, want)
+	}
+	same := datatype.NewHistogramType("latency", 3, 0.6, []datatype.Bucket{
+		{UpperBound: 0.1, Count: 1},
+		{UpperBound: 0.5, Count: 3},
+	})
+	if !h.Equal(same) {
+		t.Errorf("h.Equal(%v) = (false); want (true)", same)
+	}
+	other := datatype.NewHistogramType("latency", 3, 0.6, []datatype.Bucket{{UpperBound: 0.1, Count: 1}})
+	if h.Equal(other) {
+		t.Errorf("h.Equal(%v) = (true); want (false)", other)
+	}
+	if h.Equal(datatype.NewFloatType("latency", 3)) {
+		t.Error("h.Equal(FloatType) = (true); want (false)")
+	}
+}
+
+func TestNewSummaryFromValues(t *testing.T) {
+	t.Parallel()
+	values := []float64{0, 40, 10, 0, 30, 20, 50, 60, 70, 80, 90, 100}
+	s := datatype.NewSummaryFromValues("PauseNs", values)
+	if s.Count != 10 {
+		t.Errorf("s.Count = (%d); want (10)", s.Count)
+	}
+	if s.Sum != 550 {
+		t.Errorf("s.Sum = (%f); want (550)", s.Sum)
+	}
+	want := []datatype.Quantile{{0.5, 50}, {0.9, 90}, {0.99, 100}}
+	if len(s.Quantiles) != len(want) {
+		t.Fatalf("s.Quantiles = (%v); want (%v)", s.Quantiles, want)
+	}
+	for i, q := range want {
+		if s.Quantiles[i] != q {
+			t.Errorf("s.Quantiles[%d] = (%v); want (%v)", i, s.Quantiles[i], q)
+		}
+	}
+	wantContent := `"PauseNs":{"count":10,"sum":550.000000,"quantiles":[{"quantile":0.500000,"value":50.000000},{"quantile":0.900000,"value":90.000000},{"quantile":0.990000,"value":100.000000}]}`
+	if got := readContent(s); got != wantContent {
+		t.Errorf("content = (%s); want (%s)", got, wantContent)
+	}
+
+	empty := datatype.NewSummaryFromValues("PauseNs", []float64{0, 0})
+	if got := readContent(empty); got != `"PauseNs":{"count":0,"sum":0.000000,"quantiles":[]}` {
+		t.Errorf("content = (%s); want an empty summary", got)
+	}
+	if s.Equal(empty) {
+		t.Errorf("s.Equal(%v) = (true); want (false)", empty)
+	}
+	if !s.Equal(datatype.NewSummaryFromValues("PauseNs", values)) {
+		t.Error("s.Equal(same) = (false); want (true)")
+	}
+}
+
+func TestValuesDistributions(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name  string
+		input string
+		want  datatype.DataType
+	}{
+		{
+			"histogram",
+			`{"Read Duration Seconds": {"count": 3, "sum": 0.6, "buckets": {"0.1": 1, "0.5": 3}}}`,
+			datatype.NewHistogramType("Read Duration Seconds", 3, 0.6, []datatype.Bucket{{0.1, 1}, {0.5, 3}}),
+		},
+		{
+			"summary",
+			`{"latency": {"count": 3, "sum": 0.6, "quantiles": {"0.5": 0.2, "0.9": 0.3}}}`,
+			datatype.NewSummaryType("latency", 3, 0.6, []datatype.Quantile{{0.5, 0.2}, {0.9, 0.3}}),
+		},
+		{
+			"nested",
+			`{"app": {"latency": {"count": 3, "sum": 0.6, "quantiles": {"0.5": 0.2}}}}`,
+			datatype.NewSummaryType("app.latency", 3, 0.6, []datatype.Quantile{{0.5, 0.2}}),
+		},
+		{
+			"inf bucket",
+			`{"Read Duration Seconds": {"count": 3, "sum": 0.6, "buckets": {"0.1": 1, "+Inf": 3}}}`,
+			datatype.NewHistogramType("Read Duration Seconds", 3, 0.6, []datatype.Bucket{{0.1, 1}}),
+		},
+		{
+			"not a bound",
+			`{"app": {"count": 3, "sum": 0.6, "buckets": {"low": 1}}}`,
+			datatype.NewFloatType("app.count", 3),
+		},
+		{
+			"extra key",
+			`{"app": {"count": 3, "sum": 0.6, "buckets": {"0.1": 1}, "max": 1}}`,
+			datatype.NewFloatType("app.count", 3),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			obj, err := jason.NewObjectFromBytes([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			results := datatype.DefaultMapper().Values("", obj.Map())
+			for _, r := range results {
+				if r.Equal(tc.want) {
+					return
+				}
+			}
+			t.Errorf("results = (%v); want (%v) in them", results, tc.want)
+		})
+	}
+}
+
+func TestValuesSummaryTypes(t *testing.T) {
+	t.Parallel()
+	mapper := datatype.DefaultMapper().Extend(nil, nil)
+	mapper.SummaryTypes = []string{"PauseNs"}
+	obj, err := jason.NewObjectFromBytes([]byte(`{"memstats": {"PauseNs": [0, 2000, 1000]}, "PauseEnd": [1, 2]}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	results := mapper.Values("", obj.Map())
+	want := map[string]bool{"*datatype.SummaryType": false, "*datatype.GCListType": false}
+	for _, r := range results {
+		switch d := r.(type) {
+		case *datatype.SummaryType:
+			want["*datatype.SummaryType"] = true
+			if d.Key != "memstats.PauseNs" || d.Count != 2 || d.Sum != 3000 {
+				t.Errorf("summary = (%v); want the non-zero values of memstats.PauseNs", d)
+			}
+		case *datatype.GCListType:
+			want["*datatype.GCListType"] = true
+		}
+	}
+	for typ, ok := range want {
+		if !ok {
+			t.Errorf("%s not found in (%v)", typ, results)
+		}
+	}
+	if len(datatype.DefaultMapper().SummaryTypes) != 0 {
+		t.Error("the default mapper has changed")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/antonholmquist/jason"
+)
+
+// Labels are the key/value pairs that describe the dimensions of the metrics,
+// for example the instance or the container they are read from.
+type Labels map[string]string
+
+// MarshalJSON returns the labels as a json object sorted by the names, so the
+// same labels are always written the same.
+func (l Labels) MarshalJSON() ([]byte, error) {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := new(bytes.Buffer)
+	buf.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		k, _ := json.Marshal(name)
+		v, _ := json.Marshal(l[name])
+		fmt.Fprintf(buf, "%s:%s", k, v)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// Equal returns true if both labels have the same pairs.
+func (l Labels) Equal(other Labels) bool {
+	if len(l) != len(other) {
+		return false
+	}
+	for k, v := range l {
+		if o, ok := other[k]; !ok || o != v {
+			return false
+		}
+	}
+	return true
+}
+
+// LabelledType represents a DataType with labels. It is recorded as a
+// sub-document with the value of the DataType and its labels:
+//
+//	"http.requests":{"value":42.000000,"labels":{"code":"200"}}
+type LabelledType struct {
+	readType
+	Key    string
+	Value  DataType
+	Labels Labels
+}
+
+// NewLabelledType returns a new LabelledType object. The value should be
+// written as a "key":value pair, as all the DataTypes of this package are. It
+// returns an error if it can not read the value.
+func NewLabelledType(value DataType, labels Labels) (*LabelledType, error) {
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(value); err != nil {
+		return nil, err
+	}
+	value.Reset()
+	var pair map[string]json.RawMessage
+	if err := json.Unmarshal([]byte("{"+buf.String()+"}"), &pair); err != nil {
+		return nil, err
+	}
+	if len(pair) != 1 {
+		return nil, fmt.Errorf("want one pair, got %d", len(pair))
+	}
+	l := &LabelledType{Value: value, Labels: labels}
+	for k, raw := range pair {
+		l.Key = k
+		key, _ := json.Marshal(k)
+		encoded, _ := labels.MarshalJSON()
+		l.content = fmt.Sprintf(`%s:{"value":%s,"labels":%s}`, key, raw, encoded)
+	}
+	return l, nil
+}
+
+// Equal compares the keys, values and labels and returns true if they are
+// equal.
+func (l LabelledType) Equal(other DataType) bool {
+	switch o := other.(type) {
+	case *LabelledType:
+		return l.Key == o.Key && l.Value.Equal(o.Value) && l.Labels.Equal(o.Labels)
+	}
+	return false
+}
+
+// labelledValue returns a LabelledType if the obj has only the value and
+// labels keys, and the labels are strings:
+//
+//	{"value": 42, "labels": {"code": "200"}}
+func (m *MapConvert) labelledValue(prefix, name string, obj *jason.Object) (DataType, bool) {
+	if len(obj.Map()) != 2 {
+		return nil, false
+	}
+	value, err := obj.GetValue("value")
+	if err != nil {
+		return nil, false
+	}
+	labelsObj, err := obj.GetObject("labels")
+	if err != nil {
+		return nil, false
+	}
+	labels := make(Labels, len(labelsObj.Map()))
+	for k, v := range labelsObj.Map() {
+		s, err := v.String()
+		if err != nil {
+			return nil, false
+		}
+		labels[k] = s
+	}
+	values, err := m.values(prefix, 0, map[string]*jason.Value{name: value})
+	if err != nil || len(values) != 1 {
+		return nil, false
+	}
+	l, err := NewLabelledType(values[0], labels)
+	if err != nil {
+		return nil, false
+	}
+	labelledTypeCount.Add(1)
+	return l, true
+}
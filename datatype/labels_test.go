@@ -0,0 +1,99 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+func TestLabelsMarshalJSON(t *testing.T) {
+	t.Parallel()
+	l := datatype.Labels{"instance": "b", "env": "prod", "quote": `"`}
+	b, err := l.MarshalJSON()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := `{"env":"prod","instance":"b","quote":"\""}`
+	if string(b) != want {
+		t.Errorf("MarshalJSON() = (%s); want (%s)", b, want)
+	}
+	if !l.Equal(datatype.Labels{"instance": "b", "env": "prod", "quote": `"`}) {
+		t.Error("l.Equal(same) = (false); want (true)")
+	}
+	if l.Equal(datatype.Labels{"instance": "b", "env": "dev", "quote": `"`}) {
+		t.Error("l.Equal(other) = (true); want (false)")
+	}
+}
+
+func TestNewLabelledType(t *testing.T) {
+	t.Parallel()
+	l, err := datatype.NewLabelledType(datatype.NewFloatType("requests", 42), datatype.Labels{"code": "200"})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if l.Key != "requests" {
+		t.Errorf("l.Key = (%s); want (requests)", l.Key)
+	}
+	want := `"requests":{"value":42.000000,"labels":{"code":"200"}}`
+	if got := readContent(l); got != want {
+		t.Errorf("content = (%s); want (%s)", got, want)
+	}
+	same, _ := datatype.NewLabelledType(datatype.NewFloatType("requests", 42), datatype.Labels{"code": "200"})
+	if !l.Equal(same) {
+		t.Error("l.Equal(same) = (false); want (true)")
+	}
+	other, _ := datatype.NewLabelledType(datatype.NewFloatType("requests", 42), datatype.Labels{"code": "500"})
+	if l.Equal(other) {
+		t.Error("l.Equal(other) = (true); want (false)")
+	}
+	if _, err = datatype.NewLabelledType(badDataType{}, nil); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestValuesLabelled(t *testing.T) {
+	t.Parallel()
+	obj, err := jason.NewObjectFromBytes([]byte(`{
+		"http": {"requests": {"value": 42, "labels": {"code": "200"}}},
+		"Alloc": {"value": 1048576, "labels": {"pool": "heap"}},
+		"other": {"value": 1, "labels": {"code": 200}}
+	}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	results := datatype.DefaultMapper().Values("", obj.Map())
+	requests, _ := datatype.NewLabelledType(datatype.NewFloatType("http.requests", 42), datatype.Labels{"code": "200"})
+	alloc, _ := datatype.NewLabelledType(datatype.NewMegaByteType("Alloc", 1048576), datatype.Labels{"pool": "heap"})
+	for _, want := range []datatype.DataType{requests, alloc, datatype.NewFloatType("other.value", 1)} {
+		found := false
+		for _, r := range results {
+			if r.Equal(want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("results = (%v); want (%v) in them", results, want)
+		}
+	}
+}
+
+func TestContainerLabels(t *testing.T) {
+	t.Parallel()
+	c := datatype.New([]datatype.DataType{datatype.NewFloatType("a", 1)})
+	c.SetLabels(datatype.Labels{"instance": "app1"})
+	w := new(bytes.Buffer)
+	if _, err := c.Generate(w, time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := `{"@timestamp":"2017-03-04T05:06:07+00:00","labels":{"instance":"app1"},"a":1.000000}`
+	if w.String() != want {
+		t.Errorf("w.String() = (%s); want (%s)", w.String(), want)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/antonholmquist/jason"
+)
+
+// The policies of the values that should be numbers, for example the values
+// of memory_bytes, but can not be parsed as numbers. The strings of numbers
+// are always coerced to numbers.
+const (
+	MalformedSkip   = "skip"   // the key is ignored.
+	MalformedString = "string" // the value is recorded as a StringType.
+	MalformedFail   = "fail"   // the document is not recorded.
+)
+
+var malformedPolicies = []string{MalformedSkip, MalformedString, MalformedFail}
+
+// MalformedValueError is returned when a value is not a number with the
+// MalformedFail policy.
+type MalformedValueError struct {
+	Key   string
+	Value string
+}
+
+func (m MalformedValueError) Error() string {
+	return fmt.Sprintf("malformed value of %s: %s", m.Key, m.Value)
+}
+
+// CheckMalformedPolicy returns an error if the policy is not one of the
+// MalformedSkip, MalformedString and MalformedFail, or empty.
+func CheckMalformedPolicy(policy string) error {
+	if policy == "" {
+		return nil
+	}
+	for _, p := range malformedPolicies {
+		if strings.ToLower(policy) == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown malformed values policy %q, should be one of %s",
+		policy, strings.Join(malformedPolicies, ", "))
+}
+
+// number returns the value of j as a number. The strings of numbers are
+// coerced to numbers.
+func number(j *jason.Value) (float64, bool) {
+	if f, err := j.Float64(); err == nil {
+		return f, true
+	}
+	s, err := j.String()
+	if err != nil {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, false
+	}
+	coercedValues.Add(1)
+	return f, true
+}
+
+// malformedValue returns the DataType of the value of the key that is not a
+// number, with the Malformed policy of m. It returns nil if the value should
+// be skipped, and a MalformedValueError if the document should fail.
+func (m *MapConvert) malformedValue(key string, j *jason.Value) (DataType, error) {
+	policy := strings.ToLower(m.Malformed)
+	if policy != MalformedString && policy != MalformedFail {
+		droppedValues.Add(1)
+		return nil, nil
+	}
+	value, err := j.String()
+	if err != nil {
+		b, err := j.Marshal()
+		if err != nil {
+			dataTypeErrs.Add(1)
+			return nil, nil
+		}
+		value = string(b)
+	}
+	if policy == MalformedFail {
+		droppedValues.Add(1)
+		return nil, MalformedValueError{Key: key, Value: value}
+	}
+	stringTypeCount.Add(1)
+	return NewStringType(key, value), nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+func TestMalformedValues(t *testing.T) {
+	t.Parallel()
+	input := []byte(`{"Alloc": "12 MB", "Sys": "2048", "HeapAlloc": 1024, "name": "app"}`)
+	tcs := []struct {
+		policy string
+		want   []datatype.DataType
+		err    bool
+	}{
+		{"", []datatype.DataType{
+			datatype.NewMegaByteType("Sys", 2048),
+			datatype.NewMegaByteType("HeapAlloc", 1024),
+			datatype.NewStringType("name", "app"),
+		}, false},
+		{datatype.MalformedSkip, []datatype.DataType{
+			datatype.NewMegaByteType("Sys", 2048),
+			datatype.NewMegaByteType("HeapAlloc", 1024),
+			datatype.NewStringType("name", "app"),
+		}, false},
+		{datatype.MalformedString, []datatype.DataType{
+			datatype.NewStringType("Alloc", "12 MB"),
+			datatype.NewMegaByteType("Sys", 2048),
+			datatype.NewMegaByteType("HeapAlloc", 1024),
+			datatype.NewStringType("name", "app"),
+		}, false},
+		{datatype.MalformedFail, nil, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.policy, func(t *testing.T) {
+			obj, err := jason.NewObjectFromBytes(input)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			mapper := datatype.DefaultMapper().Copy().(*datatype.MapConvert)
+			mapper.Malformed = tc.policy
+			results, err := mapper.ParseValues("", obj.Map())
+			if tc.err {
+				if e, ok := err.(datatype.MalformedValueError); !ok || e.Key != "Alloc" || e.Value != "12 MB" {
+					t.Errorf("err = (%#v); want (MalformedValueError)", err)
+				}
+				if values := mapper.Values("", obj.Map()); values != nil {
+					t.Errorf("Values() = (%v); want (nil)", values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if len(results) != len(tc.want) {
+				t.Errorf("len(results) = (%d); want (%d)", len(results), len(tc.want))
+			}
+			for _, want := range tc.want {
+				found := false
+				for _, r := range results {
+					if r.Equal(want) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("results = (%v); want (%v) in them", results, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJobResultDataTypesMalformed(t *testing.T) {
+	t.Parallel()
+	mapper := datatype.DefaultMapper().Copy().(*datatype.MapConvert)
+	mapper.Malformed = datatype.MalformedFail
+	_, err := datatype.JobResultDataTypes([]byte(`{"Alloc": "bad", "Sys": 1}`), mapper)
+	if _, ok := err.(datatype.MalformedValueError); !ok {
+		t.Errorf("err = (%#v); want (MalformedValueError)", err)
+	}
+	mapper.Malformed = datatype.MalformedSkip
+	c, err := datatype.JobResultDataTypes([]byte(`{"Alloc": "bad", "Sys": 1}`), mapper)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("c.Len() = (%d); want (1)", c.Len())
+	}
+}
+
+func TestCheckMalformedPolicy(t *testing.T) {
+	t.Parallel()
+	for _, policy := range []string{"", "skip", "String", "FAIL"} {
+		if err := datatype.CheckMalformedPolicy(policy); err != nil {
+			t.Errorf("%s: err = (%v); want (nil)", policy, err)
+		}
+	}
+	if err := datatype.CheckMalformedPolicy("zero"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -5,11 +5,14 @@
 package datatype
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
-	"github.com/antonholmquist/jason"
 	"github.com/alext234/expipe/tools"
+	"github.com/antonholmquist/jason"
 	"github.com/spf13/viper"
 )
 
@@ -19,9 +22,60 @@ var (
 )
 
 // MapConvert can produce output from GC string list and memory type input.
+// The lists of values named in SummaryTypes are converted to SummaryTypes, and
+// the arrays named in ArrayPolicies are converted with their policies. The
+// values of the keys that match any of the KeyRules are converted with the
+// rule instead. The ComputedFields are evaluated with the numbers of each
+// payload. The nested objects are flattened as the Flatten describes. The
+// values that should be numbers but are not are treated with the Malformed
+// policy, which skips them if it is empty. The numbers are written with the
+// Precision decimal places if it is set. All keys start with the KeyPrefix,
+// but the rules, policies and computed fields match the keys without it. The
+// Fields are constant values that are added to all the documents as they are.
+// The locations of the IP addresses of the GeoIPFields are added with the
+// Locator. The values of the keys that match the Redactions are removed or
+// hashed. The KeyGuard, if set, limits the number of the distinct keys.
 type MapConvert struct {
-	GCTypes     []string
-	MemoryTypes map[string]string
+	GCTypes        []string
+	MemoryTypes    map[string]string
+	SummaryTypes   []string
+	ArrayPolicies  map[string]string
+	KeyRules       []KeyRule
+	ComputedFields map[string]*Expression
+	Flatten        Flatten
+	Malformed      string
+	Precision      *int
+	KeyPrefix      string
+	Fields         map[string]string
+	Locator        Locator
+	GeoIPFields    []string
+	Redactions     []Redaction
+	KeyGuard       *KeyGuard
+}
+
+// Flatten describes how the nested objects are flattened into the keys of the
+// documents. The keys are joined with the Delimiter, which is a dot if it is
+// empty. The objects that would produce keys of more than MaxDepth levels are
+// recorded as they are, and all nested objects are recorded as they are if
+// KeepNested is true. There is no limit if MaxDepth is zero.
+type Flatten struct {
+	Delimiter  string `mapstructure:"delimiter"`
+	MaxDepth   int    `mapstructure:"max_depth"`
+	KeepNested bool   `mapstructure:"keep_nested"`
+}
+
+// Separator returns the Delimiter, or a dot if it is empty.
+func (f Flatten) Separator() string {
+	if f.Delimiter == "" {
+		return "."
+	}
+	return f.Delimiter
+}
+
+// keep returns true if the objects at the depth should not be flattened. The
+// top level keys are at the depth of zero.
+func (f Flatten) keep(depth int) bool {
+	return f.KeepNested || f.MaxDepth > 0 && depth+1 >= f.MaxDepth
 }
 
 type treeReader interface {
@@ -42,9 +96,107 @@ func MapsFromViper(v treeReader) *MapConvert {
 	if v.IsSet("memory_bytes") {
 		m.MemoryTypes = memoryTypes(v, def.MemoryTypes)
 	}
+	if v.IsSet("summary_types") {
+		m.SummaryTypes = v.GetStringSlice("summary_types")
+	}
 	return m
 }
 
+// Extend returns a copy of m with the gcTypes added to its GCTypes and the
+// memoryTypes overriding its MemoryTypes. The names of the memoryTypes are
+// case insensitive. Use WithArrayPolicies for adding the array policies.
+func (m *MapConvert) Extend(gcTypes []string, memoryTypes map[string]string) *MapConvert {
+	newMapper := m.Copy().(*MapConvert)
+	newMapper.GCTypes = make([]string, len(m.GCTypes), len(m.GCTypes)+len(gcTypes))
+	copy(newMapper.GCTypes, m.GCTypes)
+	for _, gcType := range gcTypes {
+		if !tools.StringInSlice(gcType, newMapper.GCTypes) {
+			newMapper.GCTypes = append(newMapper.GCTypes, gcType)
+		}
+	}
+	for name, memoryType := range memoryTypes {
+		newMapper.MemoryTypes[strings.ToLower(name)] = strings.ToLower(memoryType)
+	}
+	return newMapper
+}
+
+// WithFields returns a copy of m with the fields overriding its Fields.
+func (m *MapConvert) WithFields(fields map[string]string) *MapConvert {
+	newMapper := m.Copy().(*MapConvert)
+	if len(fields) > 0 && newMapper.Fields == nil {
+		newMapper.Fields = make(map[string]string, len(fields))
+	}
+	for name, value := range fields {
+		newMapper.Fields[name] = value
+	}
+	return newMapper
+}
+
+// fieldValues returns a StringType for each of the Fields, sorted by their
+// names. The KeyPrefix is not applied to the Fields.
+func (m *MapConvert) fieldValues() []DataType {
+	if len(m.Fields) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(m.Fields))
+	for name := range m.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	results := make([]DataType, len(names))
+	for i, name := range names {
+		stringTypeCount.Add(1)
+		results[i] = NewStringType(name, m.Fields[name])
+	}
+	return results
+}
+
+// WithArrayPolicies returns a copy of m with the policies overriding its
+// ArrayPolicies. The names and the policies are case insensitive.
+func (m *MapConvert) WithArrayPolicies(policies map[string]string) *MapConvert {
+	newMapper := m.Copy().(*MapConvert)
+	if newMapper.ArrayPolicies == nil {
+		newMapper.ArrayPolicies = make(map[string]string, len(policies))
+	}
+	for name, policy := range policies {
+		newMapper.ArrayPolicies[strings.ToLower(name)] = strings.ToLower(policy)
+	}
+	return newMapper
+}
+
+// FlatMemoryTypes returns the memory_bytes names and their types. The names
+// with dots, for example memstats.Alloc, are nested in the configuration files
+// and are joined back with dots.
+func FlatMemoryTypes(memoryTypes map[string]interface{}) map[string]string {
+	return FlatNames(memoryTypes)
+}
+
+// FlatNames returns the names and the values of a block of names in the
+// configuration files, for example the array_policies, with the nested names
+// joined back with dots.
+func FlatNames(names map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(names))
+	flattenMemoryTypes(result, "", names)
+	return result
+}
+
+func flattenMemoryTypes(result map[string]string, prefix string, memoryTypes map[string]interface{}) {
+	for name, value := range memoryTypes {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenMemoryTypes(result, prefix+name+".", v)
+		case map[interface{}]interface{}:
+			m := make(map[string]interface{}, len(v))
+			for k, val := range v {
+				m[fmt.Sprint(k)] = val
+			}
+			flattenMemoryTypes(result, prefix+name+".", m)
+		default:
+			result[prefix+name] = fmt.Sprint(v)
+		}
+	}
+}
+
 // DefaultMapper returns a MapConvert object that is populated by the default
 // mappings. The data is hard coded in the program, but you can provide your
 // mapping file in your configuration file.
@@ -60,37 +212,45 @@ func DefaultMapper() *MapConvert {
 		if v.IsSet("memory_bytes") {
 			defaultMap.MemoryTypes = memoryTypes(v, make(map[string]string))
 		}
+		if v.IsSet("summary_types") {
+			defaultMap.SummaryTypes = v.GetStringSlice("summary_types")
+		}
 	})
 	return defaultMap
 }
 
-func (m *MapConvert) getMemoryTypes(prefix, name string, j *jason.Value) (DataType, bool) {
-	var (
-		data DataType
-		ok   bool
-	)
-	v, err := j.Float64()
-	if err != nil {
-		dataTypeErrs.Add(1)
-		return nil, false
+// getMemoryTypes returns nil if the memory type of the name is not known, or
+// if the value is not a number and the Malformed policy skips it.
+func (m *MapConvert) getMemoryTypes(prefix, name string, j *jason.Value) (DataType, error) {
+	return m.memoryValue(m.MemoryTypes[strings.ToLower(name)], prefix+name, j)
+}
+
+func (m *MapConvert) memoryValue(memoryType, key string, j *jason.Value) (DataType, error) {
+	if !IsByte(memoryType) && !IsKiloByte(memoryType) && !IsMegaByte(memoryType) {
+		return nil, nil
 	}
-	b := m.MemoryTypes[strings.ToLower(name)]
-	if IsByte(b) {
-		data, ok = NewByteType(prefix+name, v), true
-	} else if IsKiloByte(b) {
-		data, ok = NewKiloByteType(prefix+name, v), true
-	} else if IsMegaByte(b) {
-		data, ok = NewMegaByteType(prefix+name, v), true
-	} else {
-		data, ok = nil, false
+	v, ok := number(j)
+	if !ok {
+		return m.malformedValue(key, j)
 	}
-	return data, ok
+	byteTypeCount.Add(1)
+	switch {
+	case IsByte(memoryType):
+		return NewByteType(key, v), nil
+	case IsKiloByte(memoryType):
+		return NewKiloByteType(key, v), nil
+	}
+	return NewMegaByteType(key, v), nil
 }
 
 func (m *MapConvert) arrayValue(prefix, name string, a []*jason.Value) DataType {
 	if len(a) == 0 {
 		return NewFloatListType(prefix+name, []float64{})
 	} else if _, err := a[0].Float64(); err == nil {
+		if tools.StringInSlice(name, m.SummaryTypes) {
+			summaryTypeCount.Add(1)
+			return NewSummaryFromValues(prefix+name, getFloatValues(a))
+		}
 		if tools.StringInSlice(name, m.GCTypes) {
 			return getGCList(prefix+name, a)
 		}
@@ -102,9 +262,42 @@ func (m *MapConvert) arrayValue(prefix, name string, a []*jason.Value) DataType
 // Values returns a slice of DataTypes based on the given name/value inputs. It
 // flattens the float list values, therefore you will get multiple values per
 // input. If the name is found in memory_bytes map, it will return one of those,
-// otherwise it will return a FloatType or StringType if can convert. It will
-// return nil if the value is not one of above.
+// otherwise it will return a FloatType or StringType if can convert. The
+// objects with count, sum and buckets or quantiles are converted to
+// HistogramType or SummaryType, and the objects with value and labels are
+// converted to LabelledType. The other objects are flattened, or recorded as
+// RawTypes, as the Flatten of m describes. The arrays of objects and arrays
+// are flattened the same way with the indices of their elements as keys, and
+// the arrays of strings and the booleans are recorded as RawTypes. The
+// ComputedFields are appended as FloatTypes. It will return nil if the value
+// is not one of above.
 func (m *MapConvert) Values(prefix string, values map[string]*jason.Value) []DataType {
+	results, err := m.ParseValues(prefix, values)
+	if err != nil {
+		return nil
+	}
+	return results
+}
+
+// ParseValues returns the same DataTypes as the Values, but it returns a
+// MalformedValueError if the Malformed policy of m is MalformedFail and any of
+// the values should be a number but it is not.
+func (m *MapConvert) ParseValues(prefix string, values map[string]*jason.Value) ([]DataType, error) {
+	results, err := m.values(m.KeyPrefix+prefix, 0, values)
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, m.computedValues(m.KeyPrefix+prefix, values)...)
+	results = append(m.guard(m.redact(results)), m.fieldValues()...)
+	if m.Precision != nil {
+		for i, d := range results {
+			results[i] = Round(d, *m.Precision)
+		}
+	}
+	return results, nil
+}
+
+func (m *MapConvert) values(prefix string, depth int, values map[string]*jason.Value) ([]DataType, error) {
 	var results []DataType
 	input := make(map[string]jason.Value, len(values))
 	for k, v := range values {
@@ -113,26 +306,92 @@ func (m *MapConvert) Values(prefix string, values map[string]*jason.Value) []Dat
 
 	for name, value := range input {
 		var result DataType
-		if _, ok := m.MemoryTypes[strings.ToLower(name)]; ok {
-			result, ok = m.getMemoryTypes(prefix, name, &value)
-			if !ok {
+		if _, err := value.Object(); err != nil {
+			if rule := m.keyRule(strings.TrimPrefix(prefix+name, m.KeyPrefix)); rule != nil {
+				d, err := m.ruleValues(rule, prefix+name, &value)
+				if err != nil {
+					return nil, err
+				}
+				dataTypeObjs.Add(1)
+				results = append(results, d...)
 				continue
 			}
-			byteTypeCount.Add(1)
+		}
+		if _, ok := m.MemoryTypes[strings.ToLower(name)]; ok {
+			if obj, err := value.Object(); err == nil {
+				// the labelled values are converted with their memory types.
+				if result, ok = m.labelledValue(prefix, name, obj); !ok {
+					continue
+				}
+			} else {
+				d, err := m.getMemoryTypes(prefix, name, &value)
+				if err != nil {
+					return nil, err
+				}
+				if d == nil {
+					continue
+				}
+				result = d
+			}
 		} else if obj, err := value.Object(); err == nil {
+			if d, ok := distributionValue(prefix+name, obj); ok {
+				dataTypeObjs.Add(1)
+				results = append(results, d)
+				continue
+			}
+			if d, ok := m.labelledValue(prefix, name, obj); ok {
+				dataTypeObjs.Add(1)
+				results = append(results, d)
+				continue
+			}
+			if m.Flatten.keep(depth) {
+				raw, err := value.Marshal()
+				if err != nil {
+					dataTypeErrs.Add(1)
+					continue
+				}
+				dataTypeObjs.Add(1)
+				results = append(results, NewRawType(prefix+name, raw))
+				continue
+			}
 			// we are dealing with nested objects
-			results = append(results, m.Values(prefix+name+".", obj.Map())...)
+			nested, err := m.values(prefix+name+m.Flatten.Separator(), depth+1, obj.Map())
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, nested...)
 			nestedTypeCount.Add(1)
 			continue
 		} else if s, err := value.String(); err == nil {
 			stringTypeCount.Add(1)
 			result = NewStringType(prefix+name, s)
+			if p, ok := m.geoPoint(prefix+name, s); ok {
+				results = append(results, p)
+			}
 		} else if f, err := value.Float64(); err == nil {
 			floatTypeCount.Add(1)
 			result = NewFloatType(prefix+name, f)
 		} else if arr, err := value.Array(); err == nil {
 			// we are dealing with an array object
+			if policy, ok := m.arrayPolicy(prefix, name); ok {
+				dataTypeObjs.Add(1)
+				results = append(results, m.policyValues(policy, prefix+name, arr)...)
+				continue
+			}
+			// the GC and summary lists are numbers, otherwise they are
+			// malformed and are not recorded.
+			numeric := tools.StringInSlice(name, m.GCTypes) || tools.StringInSlice(name, m.SummaryTypes)
+			if !numeric && !numbers(arr) {
+				nested, err := m.nestedArrayValues(prefix+name, depth, &value, arr)
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, nested...)
+				continue
+			}
 			result = m.arrayValue(prefix, name, arr)
+		} else if b, err := value.Boolean(); err == nil {
+			result = NewRawType(prefix+name, []byte(strconv.FormatBool(b)))
 		} else {
 			dataTypeErrs.Add(1)
 			continue
@@ -142,7 +401,7 @@ func (m *MapConvert) Values(prefix string, values map[string]*jason.Value) []Dat
 			results = append(results, result)
 		}
 	}
-	return results
+	return results, nil
 }
 
 // Copy returns a new copy of the Mapper.
@@ -153,6 +412,45 @@ func (m *MapConvert) Copy() Mapper {
 	for k, v := range m.MemoryTypes {
 		newMapper.MemoryTypes[k] = v
 	}
+	if len(m.SummaryTypes) > 0 {
+		newMapper.SummaryTypes = append([]string(nil), m.SummaryTypes...)
+	}
+	if len(m.ArrayPolicies) > 0 {
+		newMapper.ArrayPolicies = make(map[string]string, len(m.ArrayPolicies))
+		for k, v := range m.ArrayPolicies {
+			newMapper.ArrayPolicies[k] = v
+		}
+	}
+	if len(m.KeyRules) > 0 {
+		newMapper.KeyRules = append([]KeyRule(nil), m.KeyRules...)
+	}
+	if len(m.ComputedFields) > 0 {
+		newMapper.ComputedFields = make(map[string]*Expression, len(m.ComputedFields))
+		for k, v := range m.ComputedFields {
+			newMapper.ComputedFields[k] = v
+		}
+	}
+	newMapper.Flatten = m.Flatten
+	newMapper.Malformed = m.Malformed
+	newMapper.KeyPrefix = m.KeyPrefix
+	newMapper.Locator = m.Locator
+	newMapper.KeyGuard = m.KeyGuard
+	if len(m.GeoIPFields) > 0 {
+		newMapper.GeoIPFields = append([]string(nil), m.GeoIPFields...)
+	}
+	if len(m.Redactions) > 0 {
+		newMapper.Redactions = append([]Redaction(nil), m.Redactions...)
+	}
+	if len(m.Fields) > 0 {
+		newMapper.Fields = make(map[string]string, len(m.Fields))
+		for k, v := range m.Fields {
+			newMapper.Fields[k] = v
+		}
+	}
+	if m.Precision != nil {
+		precision := *m.Precision
+		newMapper.Precision = &precision
+	}
 	return newMapper
 }
 
@@ -168,14 +466,18 @@ func getGCList(name string, arr []*jason.Value) *GCListType {
 }
 
 func getFloatListValues(name string, arr []*jason.Value) *FloatListType {
+	floatListTypeCount.Add(1)
+	return NewFloatListType(name, getFloatValues(arr))
+}
+
+func getFloatValues(arr []*jason.Value) []float64 {
 	res := make([]float64, len(arr))
 	for i, val := range arr {
 		if r, err := val.Float64(); err == nil {
 			res[i] = r
 		}
 	}
-	floatListTypeCount.Add(1)
-	return NewFloatListType(name, res)
+	return res
 }
 
 // IsByte checks the string string to determine if it is a Byte value.
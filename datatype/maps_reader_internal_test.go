@@ -65,11 +65,14 @@ func TestGetMemoryTypes(t *testing.T) {
 	}
 	for _, tc := range tcs {
 		t.Run(tc.tcName, func(t *testing.T) {
-			dt, ok := m.getMemoryTypes("", tc.name, tc.j)
+			dt, err := m.getMemoryTypes("", tc.name, tc.j)
+			if err != nil {
+				t.Fatalf("MapConvert.getMemoryTypes() err = (%v), want (nil)", err)
+			}
 			if reflect.TypeOf(dt) != reflect.TypeOf(tc.dt) {
 				t.Errorf("MapConvert.getMemoryTypes() dt is (%v), want (%v)", dt, tc.dt)
 			}
-			if ok != tc.ok {
+			if ok := dt != nil; ok != tc.ok {
 				t.Errorf("MapConvert.getMemoryTypes() ok = (%v), want (%v)", ok, tc.ok)
 			}
 		})
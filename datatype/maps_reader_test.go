@@ -274,6 +274,43 @@ func TestMapCopy(t *testing.T) {
 	}
 }
 
+func TestMapConvertExtend(t *testing.T) {
+	t.Parallel()
+	m := &datatype.MapConvert{
+		GCTypes:     []string{"PauseNs"},
+		MemoryTypes: map[string]string{"alloc": "mb", "sys": "mb"},
+	}
+	e := m.Extend([]string{"PauseNs", "Latencies"}, map[string]string{"Sys": "GB", "HeapInuse": "kb"})
+	if e == m {
+		t.Fatal("m.Extend(): wasn't copied")
+	}
+	if want := []string{"PauseNs", "Latencies"}; !reflect.DeepEqual(e.GCTypes, want) {
+		t.Errorf("e.GCTypes = (%v); want (%v)", e.GCTypes, want)
+	}
+	want := map[string]string{"alloc": "mb", "sys": "gb", "heapinuse": "kb"}
+	if !reflect.DeepEqual(e.MemoryTypes, want) {
+		t.Errorf("e.MemoryTypes = (%v); want (%v)", e.MemoryTypes, want)
+	}
+	if len(m.GCTypes) != 1 || m.MemoryTypes["sys"] != "mb" || len(m.MemoryTypes) != 2 {
+		t.Errorf("m = (%v); want it unchanged", m)
+	}
+}
+
+func TestFlatMemoryTypes(t *testing.T) {
+	t.Parallel()
+	got := datatype.FlatMemoryTypes(map[string]interface{}{
+		"alloc": "mb",
+		"memstats": map[string]interface{}{
+			"sys":   "gb",
+			"stack": map[interface{}]interface{}{"inuse": "kb"},
+		},
+	})
+	want := map[string]string{"alloc": "mb", "memstats.sys": "gb", "memstats.stack.inuse": "kb"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FlatMemoryTypes() = (%v); want (%v)", got, want)
+	}
+}
+
 func TestValues(t *testing.T) {
 	t.Parallel()
 	maps := datatype.DefaultMapper()
@@ -292,3 +329,203 @@ func TestValues(t *testing.T) {
 		t.Errorf("len(results) = (%d); want (0)", len(results))
 	}
 }
+
+func TestValuesFlatten(t *testing.T) {
+	t.Parallel()
+	input := []byte(`{"app": {"cache": {"hits": 1, "size": {"items": 2}}}, "up": 1}`)
+	tcs := []struct {
+		name    string
+		flatten datatype.Flatten
+		want    []datatype.DataType
+	}{
+		{"default", datatype.Flatten{}, []datatype.DataType{
+			datatype.NewFloatType("app.cache.hits", 1),
+			datatype.NewFloatType("app.cache.size.items", 2),
+			datatype.NewFloatType("up", 1),
+		}},
+		{"delimiter", datatype.Flatten{Delimiter: "_"}, []datatype.DataType{
+			datatype.NewFloatType("app_cache_hits", 1),
+			datatype.NewFloatType("app_cache_size_items", 2),
+			datatype.NewFloatType("up", 1),
+		}},
+		{"max depth", datatype.Flatten{MaxDepth: 3}, []datatype.DataType{
+			datatype.NewFloatType("app.cache.hits", 1),
+			datatype.NewRawType("app.cache.size", []byte(`{"items":2}`)),
+			datatype.NewFloatType("up", 1),
+		}},
+		{"keep nested", datatype.Flatten{KeepNested: true}, []datatype.DataType{
+			datatype.NewRawType("app", []byte(`{"cache":{"hits":1,"size":{"items":2}}}`)),
+			datatype.NewFloatType("up", 1),
+		}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			obj, err := jason.NewObjectFromBytes(input)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			mapper := datatype.DefaultMapper().Copy().(*datatype.MapConvert)
+			mapper.Flatten = tc.flatten
+			results := mapper.Values("", obj.Map())
+			if len(results) != len(tc.want) {
+				t.Fatalf("len(results) = (%d); want (%d)", len(results), len(tc.want))
+			}
+			for _, want := range tc.want {
+				found := false
+				for _, r := range results {
+					if r.Equal(want) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("results = (%v); want (%v) in them", results, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValuesNestedArrays(t *testing.T) {
+	t.Parallel()
+	input := []byte(`{
+		"routes": [{"method": "GET", "hits": 3}, {"method": "POST", "hits": 1}],
+		"matrix": [[1, 2], [3]],
+		"socket": [4, "10.0.0.7:50051"],
+		"peers": ["10.0.0.1", "10.0.0.2"],
+		"debug": false
+	}`)
+	tcs := []struct {
+		name    string
+		flatten datatype.Flatten
+		want    []datatype.DataType
+	}{
+		{"default", datatype.Flatten{}, []datatype.DataType{
+			datatype.NewStringType("routes.0.method", "GET"),
+			datatype.NewFloatType("routes.0.hits", 3),
+			datatype.NewStringType("routes.1.method", "POST"),
+			datatype.NewFloatType("routes.1.hits", 1),
+			datatype.NewFloatListType("matrix.0", []float64{1, 2}),
+			datatype.NewFloatListType("matrix.1", []float64{3}),
+			datatype.NewFloatType("socket.0", 4),
+			datatype.NewStringType("socket.1", "10.0.0.7:50051"),
+			datatype.NewRawType("peers", []byte(`["10.0.0.1","10.0.0.2"]`)),
+			datatype.NewRawType("debug", []byte("false")),
+		}},
+		{"max depth", datatype.Flatten{MaxDepth: 2}, []datatype.DataType{
+			datatype.NewRawType("routes.0", []byte(`{"hits":3,"method":"GET"}`)),
+			datatype.NewRawType("routes.1", []byte(`{"hits":1,"method":"POST"}`)),
+			datatype.NewFloatListType("matrix.0", []float64{1, 2}),
+			datatype.NewFloatListType("matrix.1", []float64{3}),
+			datatype.NewFloatType("socket.0", 4),
+			datatype.NewStringType("socket.1", "10.0.0.7:50051"),
+			datatype.NewRawType("peers", []byte(`["10.0.0.1","10.0.0.2"]`)),
+			datatype.NewRawType("debug", []byte("false")),
+		}},
+		{"keep nested", datatype.Flatten{KeepNested: true}, []datatype.DataType{
+			datatype.NewRawType("routes", []byte(`[{"hits":3,"method":"GET"},{"hits":1,"method":"POST"}]`)),
+			datatype.NewRawType("matrix", []byte(`[[1,2],[3]]`)),
+			datatype.NewRawType("socket", []byte(`[4,"10.0.0.7:50051"]`)),
+			datatype.NewRawType("peers", []byte(`["10.0.0.1","10.0.0.2"]`)),
+			datatype.NewRawType("debug", []byte("false")),
+		}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			obj, err := jason.NewObjectFromBytes(input)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			mapper := datatype.DefaultMapper().Copy().(*datatype.MapConvert)
+			mapper.Flatten = tc.flatten
+			results := mapper.Values("", obj.Map())
+			if len(results) != len(tc.want) {
+				t.Fatalf("len(results) = (%d); want (%d): %v", len(results), len(tc.want), results)
+			}
+			for _, want := range tc.want {
+				found := false
+				for _, r := range results {
+					if r.Equal(want) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("results = (%v); want (%v) in them", results, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValuesKeyPrefix(t *testing.T) {
+	t.Parallel()
+	obj, err := jason.NewObjectFromBytes([]byte(`{
+		"memstats": {"Alloc": 1048576, "PauseNs": [1, 2], "HeapInuse": 1, "HeapSys": 4},
+		"Latencies": [10, 20],
+		"name": "app"
+	}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mapper, err := datatype.DefaultMapper().WithKeyRules([]datatype.KeyRule{
+		{Match: `^memstats\.Pause(.*)$`, Rename: "gc.pause_${1}", ArrayPolicy: datatype.Sum},
+	})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mapper, err = mapper.WithArrayPolicies(map[string]string{"latencies": datatype.LastValue}).
+		WithComputedFields(map[string]string{"heap_ratio": "memstats.HeapInuse / memstats.HeapSys"})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mapper.KeyPrefix = "payments."
+	results := mapper.Values("", obj.Map())
+	want := []datatype.DataType{
+		datatype.NewMegaByteType("payments.memstats.Alloc", 1048576),
+		datatype.NewFloatType("payments.gc.pause_Ns", 3),
+		datatype.NewFloatType("payments.Latencies", 20),
+		datatype.NewFloatType("payments.heap_ratio", 0.25),
+		datatype.NewStringType("payments.name", "app"),
+	}
+	for _, w := range want {
+		found := false
+		for _, r := range results {
+			if r.Equal(w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("results = (%v); want (%v) in them", results, w)
+		}
+	}
+	if datatype.DefaultMapper().KeyPrefix != "" {
+		t.Error("the default mapper has changed")
+	}
+}
+
+func TestValuesFields(t *testing.T) {
+	t.Parallel()
+	obj, err := jason.NewObjectFromBytes([]byte(`{"requests": 42}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mapper := datatype.DefaultMapper().WithFields(map[string]string{"env": "prod", "team": "core"})
+	mapper.KeyPrefix = "app."
+	mapper = mapper.WithFields(map[string]string{"team": "platform"})
+	results := mapper.Values("", obj.Map())
+	want := []datatype.DataType{
+		datatype.NewFloatType("app.requests", 42),
+		datatype.NewStringType("env", "prod"),
+		datatype.NewStringType("team", "platform"),
+	}
+	if len(results) != len(want) {
+		t.Fatalf("len(results) = (%d); want (%d)", len(results), len(want))
+	}
+	for i, w := range want {
+		if !results[i].Equal(w) {
+			t.Errorf("results[%d] = (%v); want (%v)", i, results[i], w)
+		}
+	}
+	if len(datatype.DefaultMapper().Fields) != 0 {
+		t.Error("the default mapper has changed")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// The pools of the types that are created the most while decoding the
+// payloads. The other types are left for the garbage collector.
+var (
+	floatPool     = sync.Pool{New: func() interface{} { return new(FloatType) }}
+	stringPool    = sync.Pool{New: func() interface{} { return new(StringType) }}
+	bytePool      = sync.Pool{New: func() interface{} { return new(ByteType) }}
+	kiloBytePool  = sync.Pool{New: func() interface{} { return new(KiloByteType) }}
+	megaBytePool  = sync.Pool{New: func() interface{} { return new(MegaByteType) }}
+	containerPool = sync.Pool{New: func() interface{} { return new(Container) }}
+	contentPool   = sync.Pool{New: func() interface{} { return new([]byte) }}
+	readerPool    = sync.Pool{New: func() interface{} { return new(bytes.Reader) }}
+)
+
+// Release puts the container and its DataTypes back in the pools, therefore
+// they are reused by the next payloads. Only the containers that are returned
+// by New and JobResultDataTypes are released, any other DataContainer is left
+// as it is. You should not use c, its list or any of its items afterwards.
+func Release(c DataContainer) {
+	cont, ok := c.(*Container)
+	if !ok || cont == nil {
+		return
+	}
+	cont.Lock()
+	list := cont.list
+	cont.list = nil
+	cont.labels = nil
+	cont.Unlock()
+	for _, d := range list {
+		switch v := d.(type) {
+		case *FloatType:
+			*v = FloatType{}
+			floatPool.Put(v)
+		case *StringType:
+			*v = StringType{}
+			stringPool.Put(v)
+		case *ByteType:
+			*v = ByteType{}
+			bytePool.Put(v)
+		case *KiloByteType:
+			*v = KiloByteType{}
+			kiloBytePool.Put(v)
+		case *MegaByteType:
+			*v = MegaByteType{}
+			megaBytePool.Put(v)
+		}
+	}
+	containerPool.Put(cont)
+}
+
+// numberContent returns the `"key":value` pair of a number formatted as %f.
+// It saves the allocations of fmt.Sprintf by appending to a pooled slice.
+func numberContent(key string, value float64) string {
+	p := contentPool.Get().(*[]byte)
+	b := appendQuoted((*p)[:0], key)
+	b = append(b, ':')
+	b = appendFloat(b, value, 6)
+	content := string(b)
+	*p = b
+	contentPool.Put(p)
+	return content
+}
+
+// appendQuoted appends the s to the b as a json string. The keys and values of
+// the payloads rarely need escaping, therefore they are appended as they are
+// unless they have quotes, backslashes or control characters.
+func appendQuoted(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == '"' || c == '\\' {
+			q, _ := json.Marshal(s)
+			return append(b, q...)
+		}
+	}
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"')
+}
+
+// quote returns the s as a json string.
+func quote(s string) string { return string(appendQuoted(nil, s)) }
@@ -0,0 +1,44 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+)
+
+func TestRelease(t *testing.T) {
+	c := datatype.New([]datatype.DataType{
+		datatype.NewFloatType("a", 1.1),
+		datatype.NewStringType("b", "c"),
+	})
+	c.SetLabels(datatype.Labels{"pool": "a"})
+	datatype.Release(c)
+	if c.Len() != 0 {
+		t.Errorf("c.Len() = (%d); want (0)", c.Len())
+	}
+	if len(c.Labels()) != 0 {
+		t.Errorf("c.Labels() = (%v); want (empty)", c.Labels())
+	}
+	datatype.Release(nil)
+}
+
+func TestReleaseReuse(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		f := datatype.NewFloatType("key", float64(i))
+		b := datatype.NewByteType("bytes", float64(i)*datatype.MegaByte)
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(f)
+		buf.ReadFrom(b)
+		want := fmt.Sprintf(`"key":%f"bytes":%f`, float64(i), float64(i))
+		if buf.String() != want {
+			t.Errorf("content = (%s); want (%s)", buf.String(), want)
+		}
+		datatype.Release(datatype.New([]datatype.DataType{f, b}))
+	}
+}
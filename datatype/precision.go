@@ -0,0 +1,68 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Round returns a copy of the d with its numbers written with the decimals
+// places, for example 3 places for 12.345 MB instead of 12.345000. The values
+// are rounded only when they are written, therefore the Equal methods compare
+// the same values. The FloatType, FloatListType, ByteType, KiloByteType,
+// MegaByteType and the values of the LabelledType are rounded, and the other
+// DataTypes are returned as they are.
+func Round(d DataType, decimals int) DataType {
+	switch t := d.(type) {
+	case *FloatType:
+		r := &FloatType{Key: t.Key, Value: t.Value}
+		r.content = fmt.Sprintf(`%s:%s`, quote(t.Key), formatFloat(t.Value, decimals))
+		return r
+	case *FloatListType:
+		r := &FloatListType{Key: t.Key, Value: t.Value}
+		list := make([]string, len(t.Value))
+		for i, v := range t.Value {
+			list[i] = formatFloat(v, decimals)
+		}
+		r.content = fmt.Sprintf(`%s:[%s]`, quote(t.Key), strings.Join(list, ","))
+		return r
+	case *ByteType:
+		r := &ByteType{Key: t.Key, Value: t.Value}
+		r.content = fmt.Sprintf(`%s:%s`, quote(t.Key), formatFloat(t.Value/MegaByte, decimals))
+		return r
+	case *KiloByteType:
+		r := &KiloByteType{Key: t.Key, Value: t.Value}
+		r.content = fmt.Sprintf(`%s:%s`, quote(t.Key), formatFloat(t.Value/KiloByte, decimals))
+		return r
+	case *MegaByteType:
+		r := &MegaByteType{Key: t.Key, Value: t.Value}
+		r.content = fmt.Sprintf(`%s:%s`, quote(t.Key), formatFloat(t.Value/MegaByte, decimals))
+		return r
+	case *LabelledType:
+		l, err := NewLabelledType(Round(t.Value, decimals), t.Labels)
+		if err != nil {
+			return d
+		}
+		return l
+	}
+	return d
+}
+
+func formatFloat(v float64, decimals int) string {
+	return string(appendFloat(nil, v, decimals))
+}
+
+// appendFloat appends the v with the decimals places to the b. The infinities
+// and NaNs, for example of the sums that overflow, are written as null as they
+// can not be written in json.
+func appendFloat(b []byte, v float64, decimals int) []byte {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return append(b, "null"...)
+	}
+	return strconv.AppendFloat(b, v, 'f', decimals, 64)
+}
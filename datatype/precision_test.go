@@ -0,0 +1,70 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+func TestRound(t *testing.T) {
+	t.Parallel()
+	labelled, err := datatype.NewLabelledType(datatype.NewFloatType("l", 1.23456), datatype.Labels{"a": "b"})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		name     string
+		d        datatype.DataType
+		decimals int
+		want     string
+	}{
+		{"float", datatype.NewFloatType("f", 1.23456), 3, `"f":1.235`},
+		{"zero", datatype.NewFloatType("f", 1.5), 0, `"f":2`},
+		{"list", datatype.NewFloatListType("l", []float64{1.23456, 2}), 2, `"l":[1.23,2.00]`},
+		{"byte", datatype.NewByteType("b", 1234567), 3, `"b":1.177`},
+		{"kilobyte", datatype.NewKiloByteType("kb", 1234567), 1, `"kb":1205.6`},
+		{"megabyte", datatype.NewMegaByteType("mb", 1234567), 3, `"mb":1.177`},
+		{"labelled", labelled, 2, `"l":{"value":1.23,"labels":{"a":"b"}}`},
+		{"string", datatype.NewStringType("s", "1.23456"), 2, `"s":"1.23456"`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := datatype.Round(tc.d, tc.decimals)
+			if got := readContent(r); got != tc.want {
+				t.Errorf("content = (%s); want (%s)", got, tc.want)
+			}
+			if !r.Equal(tc.d) {
+				t.Errorf("Round(d).Equal(d) = (false); want (true)")
+			}
+		})
+	}
+}
+
+func TestValuesPrecision(t *testing.T) {
+	t.Parallel()
+	obj, err := jason.NewObjectFromBytes([]byte(`{"Alloc": 1234567, "ratio": 0.123456}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mapper := datatype.DefaultMapper().Copy().(*datatype.MapConvert)
+	precision := 3
+	mapper.Precision = &precision
+	results := mapper.Values("", obj.Map())
+	want := map[string]bool{`"Alloc":1.177`: true, `"ratio":0.123`: true}
+	if len(results) != len(want) {
+		t.Fatalf("len(results) = (%d); want (%d)", len(results), len(want))
+	}
+	for _, r := range results {
+		if got := readContent(r); !want[got] {
+			t.Errorf("content = (%s); want one of (%v)", got, want)
+		}
+	}
+	if datatype.DefaultMapper().Precision != nil {
+		t.Error("the default mapper has changed")
+	}
+}
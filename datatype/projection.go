@@ -0,0 +1,67 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"errors"
+	"strings"
+)
+
+// Projection is an allow-list of the fields of the documents. The values of
+// the other fields are dropped from the containers it is applied to. A field
+// allows its own key and the keys that are nested under it, for example
+// memstats allows memstats.Alloc.
+type Projection struct {
+	fields []string
+}
+
+// NewProjection returns a Projection of the fields. It returns an error if
+// there are no fields or any of them is empty.
+func NewProjection(fields []string) (*Projection, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("no fields")
+	}
+	for _, f := range fields {
+		if f == "" {
+			return nil, errors.New("empty field")
+		}
+	}
+	return &Projection{fields: append([]string(nil), fields...)}, nil
+}
+
+// Fields returns the allowed fields.
+func (p *Projection) Fields() []string { return p.fields }
+
+// Allowed returns true if the key is one of the fields or is nested under one.
+func (p *Projection) Allowed(key string) bool {
+	for _, f := range p.fields {
+		if key == f || strings.HasPrefix(key, f+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply drops the values of the container that are not allowed. The values
+// that do not have a key are dropped too. The labels of the container are kept.
+// Only the containers that are returned by New and JobResultDataTypes are
+// projected, any other DataContainer is left as it is.
+func (p *Projection) Apply(c DataContainer) {
+	cont, ok := c.(*Container)
+	if !ok || cont == nil {
+		return
+	}
+	cont.Lock()
+	defer cont.Unlock()
+	kept := cont.list[:0]
+	for _, d := range cont.list {
+		if key, ok := KeyOf(d); ok && p.Allowed(key) {
+			kept = append(kept, d)
+			continue
+		}
+		projectedValues.Add(1)
+	}
+	cont.list = kept
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+)
+
+func TestNewProjection(t *testing.T) {
+	if _, err := datatype.NewProjection(nil); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if _, err := datatype.NewProjection([]string{"a", ""}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	p, err := datatype.NewProjection([]string{"requests", "memstats"})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		key  string
+		want bool
+	}{
+		{"requests", true},
+		{"memstats", true},
+		{"memstats.Alloc", true},
+		{"requests_total", false},
+		{"memstatsAlloc", false},
+		{"user", false},
+	}
+	for _, tc := range tcs {
+		if got := p.Allowed(tc.key); got != tc.want {
+			t.Errorf("Allowed(%s) = (%t); want (%t)", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestProjectionApply(t *testing.T) {
+	p, err := datatype.NewProjection([]string{"requests", "memstats.Alloc"})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c := datatype.New([]datatype.DataType{
+		datatype.NewFloatType("requests", 10),
+		datatype.NewStringType("user", "arsham"),
+		datatype.NewFloatType("memstats.Alloc", 1),
+		datatype.NewFloatType("memstats.Sys", 2),
+	})
+	c.SetLabels(datatype.Labels{"env": "prod"})
+	p.Apply(c)
+	if c.Len() != 2 {
+		t.Fatalf("Len() = (%d); want (2)", c.Len())
+	}
+	for i, key := range []string{"requests", "memstats.Alloc"} {
+		if got, _ := datatype.KeyOf(c.List()[i]); got != key {
+			t.Errorf("key %d = (%s); want (%s)", i, got, key)
+		}
+	}
+	if c.Labels()["env"] != "prod" {
+		t.Errorf("Labels() = (%v); want the labels kept", c.Labels())
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// The actions of the Redactions.
+const (
+	RedactRemove = "remove" // the value is not recorded.
+	RedactHash   = "hash"   // the value is recorded as its sha256 hash.
+)
+
+// Redaction keeps the values of the keys that match the Match regular
+// expression out of the recorded documents. The Action is one of RedactRemove
+// and RedactHash, and it is RedactRemove if empty. The hashes are recorded as
+// StringTypes, therefore the equal values can still be correlated.
+//
+//	match: (?i)(token|secret|password)
+//	action: hash
+type Redaction struct {
+	Match  string `mapstructure:"match"`
+	Action string `mapstructure:"action"`
+	re     *regexp.Regexp
+}
+
+// RedactionError is returned when a Redaction is not valid.
+type RedactionError struct {
+	Match  string
+	Reason string
+	Err    error
+}
+
+func (r RedactionError) Error() string {
+	if r.Err != nil {
+		return fmt.Sprintf("redaction %s: %s: %v", r.Match, r.Reason, r.Err)
+	}
+	return fmt.Sprintf("redaction %s: %s", r.Match, r.Reason)
+}
+
+// WithRedactions returns a copy of m with the redactions added after its
+// Redactions. The first redaction that matches a key is applied. It returns a
+// RedactionError if any of the redactions are not valid.
+func (m *MapConvert) WithRedactions(redactions []Redaction) (*MapConvert, error) {
+	newMapper := m.Copy().(*MapConvert)
+	for _, r := range redactions {
+		if r.Match == "" {
+			return nil, RedactionError{Reason: "empty match"}
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, RedactionError{Match: r.Match, Reason: "bad match", Err: err}
+		}
+		r.re = re
+		r.Action = strings.ToLower(r.Action)
+		if r.Action == "" {
+			r.Action = RedactRemove
+		}
+		if r.Action != RedactRemove && r.Action != RedactHash {
+			return nil, RedactionError{Match: r.Match, Reason: fmt.Sprintf("action should be one of %s and %s", RedactRemove, RedactHash)}
+		}
+		newMapper.Redactions = append(newMapper.Redactions, r)
+	}
+	return newMapper, nil
+}
+
+// redact returns the results with the values of the keys that match the
+// Redactions removed or hashed. The keys are matched without the KeyPrefix.
+func (m *MapConvert) redact(results []DataType) []DataType {
+	if len(m.Redactions) == 0 {
+		return results
+	}
+	kept := results[:0]
+	for _, d := range results {
+		key, ok := KeyOf(d)
+		if !ok {
+			kept = append(kept, d)
+			continue
+		}
+		r := m.redaction(strings.TrimPrefix(key, m.KeyPrefix))
+		if r == nil {
+			kept = append(kept, d)
+			continue
+		}
+		redactedValues.Add(1)
+		if r.Action == RedactHash {
+			kept = append(kept, NewStringType(key, hashValue(key, d)))
+		}
+	}
+	return kept
+}
+
+// redaction returns the first redaction that matches the key, or nil if there
+// is none.
+func (m *MapConvert) redaction(key string) *Redaction {
+	for i := range m.Redactions {
+		if m.Redactions[i].re != nil && m.Redactions[i].re.MatchString(key) {
+			return &m.Redactions[i]
+		}
+	}
+	return nil
+}
+
+// hashValue returns the hex encoded sha256 hash of the json value of the d.
+func hashValue(key string, d DataType) string {
+	b, _ := ioutil.ReadAll(d)
+	d.Reset()
+	value := strings.TrimPrefix(string(b), quote(key)+":")
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
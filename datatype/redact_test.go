@@ -0,0 +1,67 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+func TestWithRedactions(t *testing.T) {
+	t.Parallel()
+	mapper, err := datatype.DefaultMapper().WithRedactions([]datatype.Redaction{
+		{Match: `(?i)token`, Action: "HASH"},
+		{Match: `^auth\.`},
+	})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mapper.KeyPrefix = "app."
+	obj, err := jason.NewObjectFromBytes([]byte(`{"AccessToken": "s3cr3t", "count": 1, "auth": {"password": "p", "user": "u"}}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	results := mapper.Values("", obj.Map())
+	sum := sha256.Sum256([]byte(`"s3cr3t"`))
+	want := []datatype.DataType{
+		datatype.NewStringType("app.AccessToken", hex.EncodeToString(sum[:])),
+		datatype.NewFloatType("app.count", 1),
+	}
+	if len(results) != len(want) {
+		t.Fatalf("len(results) = (%d); want (%d): %v", len(results), len(want), results)
+	}
+	for _, w := range want {
+		if !inArray(w, results) {
+			t.Errorf("%v not found in (%v)", w, results)
+		}
+	}
+	if len(datatype.DefaultMapper().Redactions) != 0 {
+		t.Error("the default mapper is changed")
+	}
+}
+
+func TestWithRedactionsErrors(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name      string
+		redaction datatype.Redaction
+	}{
+		{"empty match", datatype.Redaction{}},
+		{"bad match", datatype.Redaction{Match: "("}},
+		{"bad action", datatype.Redaction{Match: "token", Action: "mask"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := datatype.DefaultMapper().WithRedactions([]datatype.Redaction{tc.redaction})
+			if _, ok := err.(datatype.RedactionError); !ok {
+				t.Errorf("err = (%v); want (RedactionError)", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/antonholmquist/jason"
+)
+
+// KeyRule maps the values of the keys that match the Match regular expression,
+// therefore one rule can cover a family of metrics. The matched part of the
+// key is replaced with the Rename, in which ${1} is the first capture group.
+// The numbers are converted with the MemoryType, which is one of b, kb and mb,
+// and the arrays with the ArrayPolicy if they are set.
+//
+//	match: ^memstats\.Pause(.*)$
+//	rename: gc.pause_${1}
+type KeyRule struct {
+	Match       string `mapstructure:"match"`
+	Rename      string `mapstructure:"rename"`
+	MemoryType  string `mapstructure:"memory_bytes"`
+	ArrayPolicy string `mapstructure:"array_policy"`
+	re          *regexp.Regexp
+}
+
+// KeyRuleError is returned when a KeyRule is not valid.
+type KeyRuleError struct {
+	Match  string
+	Reason string
+	Err    error
+}
+
+func (k KeyRuleError) Error() string {
+	if k.Err != nil {
+		return fmt.Sprintf("key rule %s: %s: %v", k.Match, k.Reason, k.Err)
+	}
+	return fmt.Sprintf("key rule %s: %s", k.Match, k.Reason)
+}
+
+// WithKeyRules returns a copy of m with the rules added after its KeyRules.
+// The first rule that matches a key is applied. It returns a KeyRuleError if
+// any of the rules are not valid.
+func (m *MapConvert) WithKeyRules(rules []KeyRule) (*MapConvert, error) {
+	newMapper := m.Copy().(*MapConvert)
+	for _, rule := range rules {
+		if rule.Match == "" {
+			return nil, KeyRuleError{Reason: "empty match"}
+		}
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, KeyRuleError{Match: rule.Match, Reason: "bad match", Err: err}
+		}
+		rule.re = re
+		rule.MemoryType = strings.ToLower(rule.MemoryType)
+		if rule.MemoryType != "" && !IsByte(rule.MemoryType) && !IsKiloByte(rule.MemoryType) && !IsMegaByte(rule.MemoryType) {
+			return nil, KeyRuleError{Match: rule.Match, Reason: "memory_bytes should be one of b, kb and mb"}
+		}
+		rule.ArrayPolicy = strings.ToLower(rule.ArrayPolicy)
+		if rule.ArrayPolicy != "" {
+			if err := CheckArrayPolicies(map[string]string{rule.Match: rule.ArrayPolicy}); err != nil {
+				return nil, KeyRuleError{Match: rule.Match, Reason: "bad array_policy", Err: err}
+			}
+		}
+		newMapper.KeyRules = append(newMapper.KeyRules, rule)
+	}
+	return newMapper, nil
+}
+
+// keyRule returns the first rule that matches the key, or nil if there is
+// none.
+func (m *MapConvert) keyRule(key string) *KeyRule {
+	for i := range m.KeyRules {
+		if m.KeyRules[i].re != nil && m.KeyRules[i].re.MatchString(key) {
+			return &m.KeyRules[i]
+		}
+	}
+	return nil
+}
+
+// ruleValues returns the DataTypes of the value of the key with the rule. It
+// returns nil if the value can not be converted, and an error if the value is
+// not a number of the MemoryType and the Malformed policy of m fails.
+func (m *MapConvert) ruleValues(rule *KeyRule, key string, value *jason.Value) ([]DataType, error) {
+	if rule.Rename != "" {
+		key = m.KeyPrefix + rule.re.ReplaceAllString(strings.TrimPrefix(key, m.KeyPrefix), rule.Rename)
+	}
+	if arr, err := value.Array(); err == nil {
+		if rule.ArrayPolicy != "" {
+			return m.policyValues(rule.ArrayPolicy, key, arr), nil
+		}
+		if d := m.arrayValue("", key, arr); d != nil {
+			return []DataType{d}, nil
+		}
+		return nil, nil
+	}
+	if rule.MemoryType != "" {
+		d, err := m.memoryValue(rule.MemoryType, key, value)
+		if err != nil || d == nil {
+			return nil, err
+		}
+		return []DataType{d}, nil
+	}
+	if s, err := value.String(); err == nil {
+		stringTypeCount.Add(1)
+		return []DataType{NewStringType(key, s)}, nil
+	}
+	f, err := value.Float64()
+	if err != nil {
+		dataTypeErrs.Add(1)
+		return nil, nil
+	}
+	floatTypeCount.Add(1)
+	return []DataType{NewFloatType(key, f)}, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/antonholmquist/jason"
+)
+
+func TestKeyRules(t *testing.T) {
+	t.Parallel()
+	obj, err := jason.NewObjectFromBytes([]byte(`{
+		"memstats": {"PauseNs": [0, 10, 20], "PauseTotalNs": 30, "HeapAlloc": 2048},
+		"cache": {"size": 1048576, "name": "lru"},
+		"other": 1
+	}`))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mapper, err := datatype.DefaultMapper().WithKeyRules([]datatype.KeyRule{
+		{Match: `^memstats\.Pause(.*)$`, Rename: "gc.pause_${1}", ArrayPolicy: "Sum"},
+		{Match: `^memstats\.(Heap.*)$`, Rename: "heap.${1}", MemoryType: "KB"},
+		{Match: `^cache\.size$`, MemoryType: "mb"},
+		{Match: `^cache\.`, Rename: "lru."},
+	})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	results := mapper.Values("", obj.Map())
+	want := []datatype.DataType{
+		datatype.NewFloatType("gc.pause_Ns", 30),
+		datatype.NewFloatType("gc.pause_TotalNs", 30),
+		datatype.NewKiloByteType("heap.HeapAlloc", 2048),
+		datatype.NewMegaByteType("cache.size", 1048576),
+		datatype.NewStringType("lru.name", "lru"),
+		datatype.NewFloatType("other", 1),
+	}
+	if len(results) != len(want) {
+		t.Errorf("len(results) = (%d); want (%d)", len(results), len(want))
+	}
+	for _, w := range want {
+		found := false
+		for _, r := range results {
+			if r.Equal(w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("results = (%v); want (%v) in them", results, w)
+		}
+	}
+	if len(datatype.DefaultMapper().KeyRules) != 0 {
+		t.Error("the default mapper has changed")
+	}
+}
+
+func TestWithKeyRulesErrors(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name string
+		rule datatype.KeyRule
+	}{
+		{"empty match", datatype.KeyRule{Rename: "a"}},
+		{"bad match", datatype.KeyRule{Match: "a("}},
+		{"bad memory", datatype.KeyRule{Match: "a", MemoryType: "gigabyte"}},
+		{"bad policy", datatype.KeyRule{Match: "a", ArrayPolicy: "median"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := datatype.DefaultMapper().WithKeyRules([]datatype.KeyRule{tc.rule})
+			if _, ok := err.(datatype.KeyRuleError); !ok {
+				t.Errorf("err = (%#v); want (KeyRuleError)", err)
+			}
+		})
+	}
+}
@@ -9,16 +9,25 @@
 //
 // This list will grow in time:
 //
-//   +------------------+-------------------------+
-//   | Expipe var name  |  ElasticSearch Var Name |
-//   +------------------+-------------------------+
-//   | dataTypeObjs     | DataType Objects        |
-//   | unidentifiedJSON | Unidentified JSON Count |
-//   | stringTypeCount  | StringType Count        |
-//   | floatTypeCount   | FloatType Count         |
-//   | gcListTypeCount  | GCListType Count        |
-//   | byteTypeCount    | ByteType Count          |
-//   +------------------+-------------------------+
+//   +--------------------+-------------------------+
+//   | Expipe var name    |  ElasticSearch Var Name |
+//   +--------------------+-------------------------+
+//   | dataTypeObjs       | DataType Objects        |
+//   | unidentifiedJSON   | Unidentified JSON Count |
+//   | stringTypeCount    | StringType Count        |
+//   | floatTypeCount     | FloatType Count         |
+//   | gcListTypeCount    | GCListType Count        |
+//   | byteTypeCount      | ByteType Count          |
+//   | histogramTypeCount | HistogramType Count     |
+//   | summaryTypeCount   | SummaryType Count       |
+//   | labelledTypeCount  | LabelledType Count      |
+//   | computedTypeCount  | Computed Field Count    |
+//   | coercedValues      | Coerced Values Count    |
+//   | droppedValues      | Dropped Values Count    |
+//   | geoPointTypeCount  | GeoPointType Count      |
+//   | redactedValues     | Redacted Values Count   |
+//   | projectedValues    | Projected Values Count  |
+//   +--------------------+-------------------------+
 package datatype
 
 import (
@@ -50,6 +59,15 @@ var (
 	floatListTypeCount = expvar.NewInt("FloatListType Count")
 	gCListTypeCount    = expvar.NewInt("GCListType Count")
 	byteTypeCount      = expvar.NewInt("ByteType Count")
+	histogramTypeCount = expvar.NewInt("HistogramType Count")
+	summaryTypeCount   = expvar.NewInt("SummaryType Count")
+	labelledTypeCount  = expvar.NewInt("LabelledType Count")
+	computedTypeCount  = expvar.NewInt("Computed Field Count")
+	coercedValues      = expvar.NewInt("Coerced Values Count")
+	droppedValues      = expvar.NewInt("Dropped Values Count")
+	geoPointTypeCount  = expvar.NewInt("GeoPointType Count")
+	redactedValues     = expvar.NewInt("Redacted Values Count")
+	projectedValues    = expvar.NewInt("Projected Values Count")
 	nestedTypeCount    = expvar.NewInt("Nested Type Count")
 	dataTypeObjs       = expvar.NewInt("DataType Objects")
 	dataTypeErrs       = expvar.NewInt("DataType Objects Errors")
@@ -87,13 +105,10 @@ type FloatType struct {
 
 // NewFloatType returns a new FloadType object.
 func NewFloatType(key string, value float64) *FloatType {
-	return &FloatType{
-		Key:   key,
-		Value: value,
-		readType: readType{
-			content: fmt.Sprintf(`"%s":%f`, key, value),
-		},
-	}
+	f := floatPool.Get().(*FloatType)
+	f.Key, f.Value = key, value
+	f.content = numberContent(key, value)
+	return f
 }
 
 // Equal compares both keys and values and returns true if they are equal.
@@ -114,13 +129,10 @@ type StringType struct {
 
 // NewStringType returns a new StringType object.
 func NewStringType(key, value string) *StringType {
-	return &StringType{
-		Key:   key,
-		Value: value,
-		readType: readType{
-			content: fmt.Sprintf(`"%s":"%s"`, key, value),
-		},
-	}
+	s := stringPool.Get().(*StringType)
+	s.Key, s.Value = key, value
+	s.content = quote(key) + ":" + quote(value)
+	return s
 }
 
 // Equal compares both keys and values and returns true if they are equal.
@@ -144,9 +156,9 @@ func NewFloatListType(key string, value []float64) *FloatListType {
 	f := &FloatListType{Key: key, Value: value}
 	list := make([]string, len(f.Value))
 	for i, v := range f.Value {
-		list[i] = fmt.Sprintf("%f", v)
+		list[i] = formatFloat(v, 6)
 	}
-	f.content = fmt.Sprintf(`"%s":[%s]`, f.Key, strings.Join(list, ","))
+	f.content = fmt.Sprintf(`%s:[%s]`, quote(f.Key), strings.Join(list, ","))
 
 	return f
 }
@@ -186,7 +198,7 @@ func NewGCListType(key string, value []uint64) *GCListType {
 			list = append(list, fmt.Sprintf("%d", v/1000))
 		}
 	}
-	g.content = fmt.Sprintf(`"%s":[%s]`, g.Key, strings.Join(list, ","))
+	g.content = fmt.Sprintf(`%s:[%s]`, quote(g.Key), strings.Join(list, ","))
 	return g
 }
 
@@ -218,8 +230,9 @@ type ByteType struct {
 
 // NewByteType returns a new ByteType object.
 func NewByteType(key string, value float64) *ByteType {
-	b := &ByteType{Key: key, Value: value}
-	b.content = fmt.Sprintf(`"%s":%f`, b.Key, b.Value/MegaByte)
+	b := bytePool.Get().(*ByteType)
+	b.Key, b.Value = key, value
+	b.content = numberContent(key, value/MegaByte)
 	return b
 }
 
@@ -242,8 +255,9 @@ type KiloByteType struct {
 
 // NewKiloByteType returns a new KiloByteType object.
 func NewKiloByteType(key string, value float64) *KiloByteType {
-	b := &KiloByteType{Key: key, Value: value}
-	b.content = fmt.Sprintf(`"%s":%f`, b.Key, b.Value/KiloByte)
+	b := kiloBytePool.Get().(*KiloByteType)
+	b.Key, b.Value = key, value
+	b.content = numberContent(key, value/KiloByte)
 	return b
 }
 
@@ -266,8 +280,9 @@ type MegaByteType struct {
 
 // NewMegaByteType returns a new MegaByteType object.
 func NewMegaByteType(key string, value float64) *MegaByteType {
-	m := &MegaByteType{Key: key, Value: value}
-	m.content = fmt.Sprintf(`"%s":%f`, m.Key, m.Value/MegaByte)
+	m := megaBytePool.Get().(*MegaByteType)
+	m.Key, m.Value = key, value
+	m.content = numberContent(key, value/MegaByte)
 	return m
 }
 
@@ -279,3 +294,28 @@ func (m MegaByteType) Equal(other DataType) bool {
 	}
 	return false
 }
+
+// RawType represents a pair of key values in which the value is an already
+// encoded json value. It is used for recording documents that have been
+// generated before, therefore the value is written as is.
+type RawType struct {
+	readType
+	Key   string
+	Value []byte
+}
+
+// NewRawType returns a new RawType object.
+func NewRawType(key string, value []byte) *RawType {
+	r := &RawType{Key: key, Value: value}
+	r.content = fmt.Sprintf(`%s:%s`, quote(r.Key), r.Value)
+	return r
+}
+
+// Equal compares both keys and values and returns true if they are equal.
+func (r RawType) Equal(other DataType) bool {
+	switch o := other.(type) {
+	case *RawType:
+		return r.Key == o.Key && string(r.Value) == string(o.Value)
+	}
+	return false
+}
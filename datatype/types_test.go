@@ -6,8 +6,10 @@ package datatype_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"testing"
 	"time"
@@ -190,6 +192,10 @@ func TestDataTypeEquality(t *testing.T) {
 		{number: 49, input: inputType{a: datatype.NewFloatListType("a", []float64{1.1}), b: datatype.NewGCListType("a", []uint64{1})}, expected: false},
 		{number: 50, input: inputType{a: datatype.NewGCListType("a", []uint64{1}), b: datatype.NewFloatListType("a", []float64{1.1})}, expected: false},
 		{number: 51, input: inputType{a: datatype.NewGCListType("a", []uint64{1}), b: nil}, expected: false},
+		{number: 52, input: inputType{a: datatype.NewRawType("a", []byte(`{"b":1}`)), b: datatype.NewRawType("a", []byte(`{"b":1}`))}, expected: true},
+		{number: 53, input: inputType{a: datatype.NewRawType("a", []byte(`{"b":1}`)), b: datatype.NewRawType("a", []byte(`{"b":2}`))}, expected: false},
+		{number: 54, input: inputType{a: datatype.NewRawType("a", []byte(`1`)), b: datatype.NewRawType("b", []byte(`1`))}, expected: false},
+		{number: 55, input: inputType{a: datatype.NewRawType("a", []byte(`1`)), b: datatype.NewFloatType("a", 1)}, expected: false},
 	}
 
 	for _, tc := range testCase {
@@ -445,3 +451,33 @@ func TestReset(t *testing.T) {
 		}
 	}
 }
+
+func TestContentIsJSON(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name string
+		d    datatype.DataType
+		want string
+	}{
+		{"quoted key", datatype.NewFloatType(`a"b\c`, 1), `"a\"b\\c":1.000000`},
+		{"control characters", datatype.NewStringType("key", "a\x00b\n"), `"key":"a\u0000b\n"`},
+		{"quoted value", datatype.NewStringType("key", `"quoted"`), `"key":"\"quoted\""`},
+		{"infinity", datatype.NewFloatType("key", math.Inf(1)), `"key":null`},
+		{"nan list", datatype.NewFloatListType("key", []float64{1, math.NaN()}), `"key":[1.000000,null]`},
+		{"overflow", datatype.NewSummaryType("key", 2, math.Inf(1), nil), `"key":{"count":2,"sum":null,"quantiles":[]}`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			if _, err := buf.ReadFrom(tc.d); err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if buf.String() != tc.want {
+				t.Errorf("content = (%s); want (%s)", buf, tc.want)
+			}
+			if !json.Valid([]byte("{" + buf.String() + "}")) {
+				t.Errorf("content is not valid json: %s", buf)
+			}
+		})
+	}
+}
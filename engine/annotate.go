@@ -0,0 +1,64 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+)
+
+// The fields of the read annotations, see WithReadAnnotations.
+const (
+	// ScrapeDurationField is the time the read took, in milliseconds.
+	ScrapeDurationField = "scrape_duration_ms"
+
+	// StalenessField is the time between when the read was due and when it
+	// started, in milliseconds.
+	StalenessField = "staleness_ms"
+)
+
+// readAnnotations holds the timings of a read job.
+type readAnnotations struct {
+	took      time.Duration
+	staleness time.Duration
+}
+
+// WithReadAnnotations adds the ScrapeDurationField and StalenessField to all
+// the documents, therefore the slowness of the targets and of the Scheduler
+// is visible on each data point. The staleness grows when there are not enough
+// read workers for the Engines, or when the Scheduler is busy. The fields are
+// kept when the recorders have allow_fields.
+func WithReadAnnotations(on bool) func(*Scheduler) {
+	return func(s *Scheduler) {
+		s.annotate = on
+	}
+}
+
+// newReadAnnotations returns the annotations of a read that was due at the due
+// time, and started at start.
+func newReadAnnotations(due, start time.Time, took time.Duration) *readAnnotations {
+	staleness := start.Sub(due)
+	if staleness < 0 {
+		staleness = 0
+	}
+	return &readAnnotations{took: took, staleness: staleness}
+}
+
+// apply adds the annotations to the payload if it is a datatype.Container.
+func (a *readAnnotations) apply(payload datatype.DataContainer) {
+	c, ok := payload.(*datatype.Container)
+	if a == nil || !ok {
+		return
+	}
+	c.Add(
+		datatype.NewFloatType(ScrapeDurationField, milliseconds(a.took)),
+		datatype.NewFloatType(StalenessField, milliseconds(a.staleness)),
+	)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
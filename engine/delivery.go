@@ -0,0 +1,81 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"expvar"
+
+	"github.com/alext234/expipe/tools/config"
+)
+
+// DefaultMaxUnackedJobs is the number of the results each recorder holds with
+// the at least once delivery when the limit is not set.
+const DefaultMaxUnackedJobs = 10000
+
+var throttledReads = expvar.NewMap("Throttled Read Jobs")
+
+// WithDelivery sets the delivery mode of the results, which is one of the
+// config.DeliveryAtMostOnce and config.DeliveryAtLeastOnce modes.
+//
+// With the at least once delivery, a result is held from the moment it is
+// queued for a recorder until the recorder acknowledges it by returning a nil
+// error. The results of the failed jobs are kept in memory regardless of the
+// WithRecorderFailure policy, and they are recorded again after their recorder
+// records a job successfully. They are not dropped when MaxBufferedJobs is
+// reached. Instead, the Engines of a recorder that holds the limit of results,
+// see WithMaxUnacked, are not read until the recorder catches up. The held
+// results are lost when the process stops.
+func WithDelivery(mode string) func(*Scheduler) {
+	return func(s *Scheduler) {
+		s.atLeast = mode == config.DeliveryAtLeastOnce
+	}
+}
+
+// WithMaxUnacked sets the number of the results each recorder can hold with
+// the at least once delivery. The Engines that record into a recorder at the
+// limit skip their reads, which are counted in the Throttled Read Jobs metric.
+// DefaultMaxUnackedJobs is used if n is not positive.
+func WithMaxUnacked(n int) func(*Scheduler) {
+	return func(s *Scheduler) {
+		if n > 0 {
+			s.maxUnacked = n
+		}
+	}
+}
+
+// hold counts n jobs of the recorder as not acknowledged, if the delivery is
+// at least once.
+func (s *Scheduler) hold(name string, n int) {
+	if !s.atLeast || n == 0 {
+		return
+	}
+	unackedJobs.Add(int64(n))
+	recorderUnacked.Add(name, int64(n))
+	s.ackMu.Lock()
+	s.unacked[name] += n
+	s.ackMu.Unlock()
+}
+
+// ack releases n jobs of the recorder that are either recorded or will never
+// be recorded, for example because their Engine is stopped.
+func (s *Scheduler) ack(name string, n int) {
+	s.hold(name, -n)
+}
+
+// throttled returns true if any of the recorders of the Engine holds the
+// maximum number of the unacknowledged results.
+func (s *Scheduler) throttled(e Engine) bool {
+	if !s.atLeast {
+		return false
+	}
+	s.ackMu.Lock()
+	defer s.ackMu.Unlock()
+	for name := range e.Recorders() {
+		if s.unacked[name] >= s.maxUnacked {
+			return true
+		}
+	}
+	return false
+}
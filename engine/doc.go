@@ -136,15 +136,18 @@
 //     elastic_2 records data from app_0, app_5
 //     elastic_3 records data from app_0, app_5
 //
-// You can change the numbers to your liking:
+// You can change the numbers to your liking in each reader, or in a route for
+// the data shipped to its recorders:
 //
-//     gc_types:              # These inputs will be collected into one list and zero values will be removed
-//         memstats.PauseEnd
-//         memstats.PauseNs
-//
-//     memory_bytes:           # These values will be transformed from bytes
-//         StackInuse: mb      # To MB
-//         memstats.Alloc: gb  # To GB
+//     readers:
+//         app_0:
+//             type: expvar
+//             gc_types:              # These inputs will be collected into one list and zero values will be removed
+//                 - memstats.PauseEnd
+//                 - memstats.PauseNs
+//             memory_bytes:          # These values will be transformed from bytes
+//                 StackInuse: mb     # To MB
+//                 memstats.Alloc: gb # To GB
 //
 // To run the tests for the codes, in the root of the application run:
 //   go test $(glide nv)
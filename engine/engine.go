@@ -9,10 +9,18 @@ import (
 	"expvar"
 	"fmt"
 	"strings"
+	"sync"
 
+	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/recorder"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/condition"
+	"github.com/alext234/expipe/tools/drift"
+	"github.com/alext234/expipe/tools/metrics"
+	"github.com/alext234/expipe/tools/mute"
+	"github.com/alext234/expipe/tools/sample"
+	"github.com/alext234/expipe/tools/tenant"
 	"github.com/pkg/errors"
 )
 
@@ -24,6 +32,35 @@ var (
 	recordJobs        = expvar.NewInt("Record Jobs")
 	waitingRecordJobs = expvar.NewInt("Waiting Record Jobs")
 	erroredJobs       = expvar.NewInt("Error Jobs")
+	readerErrors      = expvar.NewMap("Reader Errors")
+	recorderErrors    = expvar.NewMap("Recorder Errors")
+	recordQueue       = expvar.NewInt("Record Queue")
+	pendingBatchJobs  = expvar.NewInt("Pending Batch Jobs")
+	bufferedJobs      = expvar.NewInt("Buffered Record Jobs")
+	droppedJobs       = expvar.NewInt("Dropped Buffered Jobs")
+	unackedJobs       = expvar.NewInt("Unacked Record Jobs")
+	flushDuration     = metrics.NewSummary("Flush Duration Seconds")
+	tenantDropped     = expvar.NewMap("Tenant Dropped Jobs")
+	sampledOutJobs    = expvar.NewMap("Sampled Out Jobs")
+	unchangedJobs     = expvar.NewMap("Unchanged Jobs")
+	shedJobs          = expvar.NewMap("Shed Jobs")
+	mutedReads        = expvar.NewMap("Muted Read Jobs")
+	mutedRecords      = expvar.NewMap("Muted Record Jobs")
+	schemaDrifts      = expvar.NewMap("Schema Drifts")
+	failoverJobs      = expvar.NewMap("Failover Jobs")
+
+	// Per reader and recorder metrics, labelled by their names.
+	readerJobs        = expvar.NewMap("Reader Jobs")
+	readDuration      = metrics.NewHistogramVec("Read Duration Seconds", metrics.DurationBuckets)
+	payloadSize       = metrics.NewHistogramVec("Payload Size Bytes", metrics.SizeBuckets)
+	lastReadSuccess   = metrics.NewGaugeVec("Last Read Success Timestamp")
+	recorderJobs      = expvar.NewMap("Recorder Jobs")
+	recordDuration    = metrics.NewHistogramVec("Record Duration Seconds", metrics.DurationBuckets)
+	flushDocuments    = metrics.NewHistogramVec("Flush Documents", metrics.CountBuckets)
+	flushLatency      = metrics.NewPercentileVec("Recorder Flush Duration Seconds", metrics.DurationBuckets)
+	lastRecordSuccess = metrics.NewGaugeVec("Last Record Success Timestamp")
+	recorderClockSkew = metrics.NewGaugeVec("Recorder Clock Skew Seconds")
+	recorderUnacked   = expvar.NewMap("Recorder Unacked Jobs")
 )
 
 // Engine is an interface to Operator's behaviour.
@@ -43,26 +80,154 @@ type Engine interface {
 // Operator represents an Engine that receives information from a reader and
 // ships them to multiple recorders.
 type Operator struct {
-	log       tools.FieldLogger
-	ctx       context.Context // Will call stop() when this context is cancelled/timed-out.
-	name      string          // Name identifier for this Engine.
-	reader    reader.DataReader
-	recorders map[string]recorder.DataRecorder // Map of active recorders name to their objects.
+	log         tools.FieldLogger
+	ctx         context.Context // Will call stop() when this context is cancelled/timed-out.
+	name        string          // Name identifier for this Engine.
+	reader      reader.DataReader
+	mu          sync.RWMutex
+	recorders   map[string]recorder.DataRecorder // Map of active recorders name to their objects, guarded by mu.
+	mappers     map[string]datatype.Mapper       // Mappers of the routes, keyed by the recorder names.
+	tenants     map[string]*tenant.Tenant        // Tenants of the routes, keyed by the recorder names.
+	samples     map[string]*sample.Sampler       // Samplers of the routes, keyed by the recorder names.
+	conditions  map[string]*condition.Condition  // Conditions of the routes, keyed by the recorder names.
+	projections map[string]*datatype.Projection  // Allowed fields of the recorders, keyed by their names.
+	mutes       map[string]mute.Schedule         // Maintenance windows of the routes, keyed by the recorder names.
+	readerMute  mute.Schedule                    // Maintenance windows of the reader.
+	drift       *drift.Detector                  // Schema drift detector of the reader.
+	fallbacks   map[string]string                // Fallback recorders, keyed by their primary recorder names.
+	scrapeStart bool                             // Read as soon as the Engine starts.
+}
+
+// routeMapper is implemented by the Engines that can map the results with a
+// different mapper for each recorder.
+type routeMapper interface {
+	SetMappers(map[string]datatype.Mapper)
+	Mappers() map[string]datatype.Mapper
+}
+
+// routeTenant is implemented by the Engines that can record the results of
+// each recorder for a tenant.
+type routeTenant interface {
+	SetTenants(map[string]*tenant.Tenant)
+	Tenants() map[string]*tenant.Tenant
+}
+
+// routeSampler is implemented by the Engines that can record a sample of the
+// results for each recorder.
+type routeSampler interface {
+	SetSamples(map[string]*sample.Sampler)
+	Samples() map[string]*sample.Sampler
+}
+
+// routeCondition is implemented by the Engines that can record only the
+// results that match a condition for each recorder.
+type routeCondition interface {
+	SetConditions(map[string]*condition.Condition)
+	Conditions() map[string]*condition.Condition
+}
+
+// routeMute is implemented by the Engines that can skip recording the results
+// into each recorder during its maintenance windows.
+type routeMute interface {
+	SetMutes(map[string]mute.Schedule)
+	Mutes() map[string]mute.Schedule
+}
+
+// readerMuter is implemented by the Engines that can skip reading their
+// readers during their maintenance windows.
+type readerMuter interface {
+	SetReaderMute(mute.Schedule)
+	ReaderMute() mute.Schedule
+}
+
+// readerDrifter is implemented by the Engines that can warn about the keys
+// that appear in or disappear from the results of their readers.
+type readerDrifter interface {
+	SetDrift(*drift.Detector)
+	Drift() *drift.Detector
+}
+
+// routeFallback is implemented by the Engines that can record into the
+// fallbacks of their recorders while the recorders are down.
+type routeFallback interface {
+	SetFallbacks(map[string]string)
+	Fallbacks() map[string]string
+}
+
+// readerStarter is implemented by the Engines that can read their readers as
+// soon as they start, instead of after the first interval.
+type readerStarter interface {
+	SetScrapeOnStart(bool)
+	ScrapeOnStart() bool
+}
+
+// recorderJoiner is implemented by the Engines that can take the recorders
+// that could not be reached when they were created, after they have started.
+type recorderJoiner interface {
+	AddRecorder(recorder.DataRecorder)
+}
+
+// recorderProjection is implemented by the Engines that can record only the
+// allowed fields of the results for each recorder.
+type recorderProjection interface {
+	SetProjections(map[string]*datatype.Projection)
+	Projections() map[string]*datatype.Projection
 }
 
 func (o *Operator) String() string { return o.name }
 
 // Ctx returns the context assigned to this Engine.
-func (o Operator) Ctx() context.Context { return o.ctx }
+func (o *Operator) Ctx() context.Context { return o.ctx }
 
 // Log returns the logger assigned to this Engine.
-func (o Operator) Log() tools.FieldLogger { return o.log }
+func (o *Operator) Log() tools.FieldLogger { return o.log }
 
-// Recorders returns the recorder map.
-func (o Operator) Recorders() map[string]recorder.DataRecorder { return o.recorders }
+// Recorders returns the recorder map. The map should not be modified.
+func (o *Operator) Recorders() map[string]recorder.DataRecorder {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.recorders
+}
 
 // Reader returns the reader.
-func (o Operator) Reader() reader.DataReader { return o.reader }
+func (o *Operator) Reader() reader.DataReader { return o.reader }
+
+// Mappers returns the mappers of the recorders that do not use the mapper of
+// the reader.
+func (o *Operator) Mappers() map[string]datatype.Mapper { return o.mappers }
+
+// Tenants returns the tenants of the recorders that record for a tenant.
+func (o *Operator) Tenants() map[string]*tenant.Tenant { return o.tenants }
+
+// Samples returns the samplers of the recorders that record a sample of the
+// results.
+func (o *Operator) Samples() map[string]*sample.Sampler { return o.samples }
+
+// Conditions returns the conditions of the recorders that record only the
+// results that match them.
+func (o *Operator) Conditions() map[string]*condition.Condition { return o.conditions }
+
+// Projections returns the allowed fields of the recorders that record only
+// some of the fields.
+func (o *Operator) Projections() map[string]*datatype.Projection { return o.projections }
+
+// Mutes returns the maintenance windows of the routes, keyed by the recorder
+// names.
+func (o *Operator) Mutes() map[string]mute.Schedule { return o.mutes }
+
+// ReaderMute returns the maintenance windows of the reader.
+func (o *Operator) ReaderMute() mute.Schedule { return o.readerMute }
+
+// Drift returns the schema drift detector of the reader.
+func (o *Operator) Drift() *drift.Detector { return o.drift }
+
+// Fallbacks returns the fallback recorders, keyed by their primary recorder
+// names.
+func (o *Operator) Fallbacks() map[string]string { return o.fallbacks }
+
+// ScrapeOnStart returns true if the reader is read as soon as the Engine
+// starts.
+func (o *Operator) ScrapeOnStart() bool { return o.scrapeStart }
 
 // SetCtx sets the context of this Engine.
 func (o *Operator) SetCtx(ctx context.Context) { o.ctx = ctx }
@@ -72,12 +237,63 @@ func (o *Operator) SetLog(log tools.FieldLogger) { o.log = log }
 
 // SetRecorders sets the recorder map.
 func (o *Operator) SetRecorders(recorders map[string]recorder.DataRecorder) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.recorders = recorders
+}
+
+// AddRecorder adds the rec to the recorders while the Engine is running. The
+// map returned by Recorders is replaced, therefore it is safe to range over the
+// maps that were returned before.
+func (o *Operator) AddRecorder(rec recorder.DataRecorder) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	recorders := make(map[string]recorder.DataRecorder, len(o.recorders)+1)
+	for name, r := range o.recorders {
+		recorders[name] = r
+	}
+	recorders[rec.Name()] = rec
 	o.recorders = recorders
 }
 
 // SetReader sets the reader.
 func (o *Operator) SetReader(reader reader.DataReader) { o.reader = reader }
 
+// SetMappers sets the mappers of the recorders.
+func (o *Operator) SetMappers(mappers map[string]datatype.Mapper) { o.mappers = mappers }
+
+// SetTenants sets the tenants of the recorders.
+func (o *Operator) SetTenants(tenants map[string]*tenant.Tenant) { o.tenants = tenants }
+
+// SetSamples sets the samplers of the recorders.
+func (o *Operator) SetSamples(samples map[string]*sample.Sampler) { o.samples = samples }
+
+// SetConditions sets the conditions of the recorders.
+func (o *Operator) SetConditions(conditions map[string]*condition.Condition) {
+	o.conditions = conditions
+}
+
+// SetProjections sets the allowed fields of the recorders.
+func (o *Operator) SetProjections(projections map[string]*datatype.Projection) {
+	o.projections = projections
+}
+
+// SetMutes sets the maintenance windows of the routes.
+func (o *Operator) SetMutes(mutes map[string]mute.Schedule) { o.mutes = mutes }
+
+// SetReaderMute sets the maintenance windows of the reader.
+func (o *Operator) SetReaderMute(schedule mute.Schedule) { o.readerMute = schedule }
+
+// SetDrift sets the schema drift detector of the reader.
+func (o *Operator) SetDrift(d *drift.Detector) { o.drift = d }
+
+// SetFallbacks sets the fallback recorders.
+func (o *Operator) SetFallbacks(fallbacks map[string]string) { o.fallbacks = fallbacks }
+
+// SetScrapeOnStart sets whether the reader is read as soon as the Engine
+// starts.
+func (o *Operator) SetScrapeOnStart(on bool) { o.scrapeStart = on }
+
 // New generates the Engine based on the provided options.
 func New(options ...func(Engine) error) (Engine, error) {
 	e := &Operator{}
@@ -170,3 +386,143 @@ func WithReader(red reader.DataReader) func(Engine) error {
 		return nil
 	}
 }
+
+// WithMappers sets the mappers of the recorders that map the results
+// differently than the reader, keyed by the recorder names. It returns an error
+// if the Engine does not support them.
+func WithMappers(mappers map[string]datatype.Mapper) func(Engine) error {
+	return func(e Engine) error {
+		m, ok := e.(routeMapper)
+		if !ok {
+			return errors.Errorf("%T does not support mappers", e)
+		}
+		m.SetMappers(mappers)
+		return nil
+	}
+}
+
+// WithTenants sets the tenants of the recorders, keyed by the recorder names.
+// It returns an error if the Engine does not support them.
+func WithTenants(tenants map[string]*tenant.Tenant) func(Engine) error {
+	return func(e Engine) error {
+		t, ok := e.(routeTenant)
+		if !ok {
+			return errors.Errorf("%T does not support tenants", e)
+		}
+		t.SetTenants(tenants)
+		return nil
+	}
+}
+
+// WithSamples sets the samplers of the recorders that record only a sample of
+// the results, keyed by the recorder names. It returns an error if the Engine
+// does not support them.
+func WithSamples(samples map[string]*sample.Sampler) func(Engine) error {
+	return func(e Engine) error {
+		t, ok := e.(routeSampler)
+		if !ok {
+			return errors.Errorf("%T does not support samples", e)
+		}
+		t.SetSamples(samples)
+		return nil
+	}
+}
+
+// WithConditions sets the conditions of the recorders that record only the
+// results that match them, keyed by the recorder names. It returns an error if
+// the Engine does not support them.
+func WithConditions(conditions map[string]*condition.Condition) func(Engine) error {
+	return func(e Engine) error {
+		c, ok := e.(routeCondition)
+		if !ok {
+			return errors.Errorf("%T does not support conditions", e)
+		}
+		c.SetConditions(conditions)
+		return nil
+	}
+}
+
+// WithProjections sets the allowed fields of the recorders that record only
+// some of the fields of the results, keyed by the recorder names. It returns an
+// error if the Engine does not support them.
+func WithProjections(projections map[string]*datatype.Projection) func(Engine) error {
+	return func(e Engine) error {
+		p, ok := e.(recorderProjection)
+		if !ok {
+			return errors.Errorf("%T does not support projections", e)
+		}
+		p.SetProjections(projections)
+		return nil
+	}
+}
+
+// WithMutes sets the maintenance windows of the routes, keyed by the recorder
+// names. The results are not recorded into a recorder during its windows. It
+// returns an error if the Engine does not support them.
+func WithMutes(mutes map[string]mute.Schedule) func(Engine) error {
+	return func(e Engine) error {
+		m, ok := e.(routeMute)
+		if !ok {
+			return errors.Errorf("%T does not support maintenance windows", e)
+		}
+		m.SetMutes(mutes)
+		return nil
+	}
+}
+
+// WithReaderMute sets the maintenance windows of the reader, during which it
+// is not read. It returns an error if the Engine does not support them.
+func WithReaderMute(schedule mute.Schedule) func(Engine) error {
+	return func(e Engine) error {
+		m, ok := e.(readerMuter)
+		if !ok {
+			return errors.Errorf("%T does not support maintenance windows", e)
+		}
+		m.SetReaderMute(schedule)
+		return nil
+	}
+}
+
+// WithDrift sets the schema drift detector of the reader, which warns when the
+// keys of its results change beyond its threshold between the reads. It
+// returns an error if the Engine does not support it.
+func WithDrift(d *drift.Detector) func(Engine) error {
+	return func(e Engine) error {
+		dr, ok := e.(readerDrifter)
+		if !ok {
+			return errors.Errorf("%T does not support schema drift detection", e)
+		}
+		dr.SetDrift(d)
+		return nil
+	}
+}
+
+// WithFallbacks sets the fallback recorders, keyed by the names of their
+// primary recorders. The fallbacks should be in the recorders of the Engine as
+// well. A fallback is only recorded into while its primary is down, or if its
+// primary could not join the Engine. It returns an error if the Engine does
+// not support them.
+func WithFallbacks(fallbacks map[string]string) func(Engine) error {
+	return func(e Engine) error {
+		f, ok := e.(routeFallback)
+		if !ok {
+			return errors.Errorf("%T does not support fallbacks", e)
+		}
+		f.SetFallbacks(fallbacks)
+		return nil
+	}
+}
+
+// WithScrapeOnStart makes the Engine read its reader as soon as it starts,
+// instead of waiting for the first interval of the reader. It returns an
+// error if the Engine does not support it.
+func WithScrapeOnStart() func(Engine) error {
+	return func(e Engine) error {
+		r, ok := e.(readerStarter)
+		if !ok {
+			return errors.Errorf("%T does not support scraping on start", e)
+		}
+		r.SetScrapeOnStart(true)
+		return nil
+	}
+}
@@ -17,6 +17,14 @@ var (
 	ErrNoRecorder = fmt.Errorf("no recorder provided")
 	ErrNoLogger   = fmt.Errorf("no logger provided")
 	ErrNoCtx      = fmt.Errorf("no ctx provided")
+
+	// errEmptyResult is recorded on the status board when a reader returns no
+	// content.
+	errEmptyResult = fmt.Errorf("empty result")
+
+	// errRecorderUnreachable is sent with the alerts of the recorders that
+	// didn't join their Engines.
+	errRecorderUnreachable = fmt.Errorf("recorder is unreachable")
 )
 
 // PingError is the error when one of readers/recorder has a ping error.
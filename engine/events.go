@@ -0,0 +1,155 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// DefaultEventLogSize is the number of events that are kept when the Size of
+// the Events setting is not set.
+const DefaultEventLogSize = 256
+
+// Kinds of the lifecycle events.
+const (
+	EventServiceStarted      = "service_started"
+	EventServiceShutdown     = "service_shutdown"
+	EventReaderAdded         = "reader_added"
+	EventReaderRemoved       = "reader_removed"
+	EventReaderQuarantined   = "reader_quarantined"
+	EventReaderRecovered     = "reader_recovered"
+	EventRecorderRemoved     = "recorder_removed"
+	EventRecorderQuarantined = "recorder_quarantined"
+	EventRecorderRecovered   = "recorder_recovered"
+	EventPaused              = "paused"
+	EventResumed             = "resumed"
+)
+
+var (
+	eventLog    = newEventRing(DefaultEventLogSize)
+	eventCounts = expvar.NewMap("Engine Events")
+	shipOnce    sync.Once
+)
+
+// Event is a change in the topology of the Service. The Seq of the events
+// increases monotonically.
+type Event struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Reader    string    `json:"reader,omitempty"`
+	Recorders []string  `json:"recorders,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// Events returns the events that are still in the event log with a Seq greater
+// than since, oldest first.
+func Events(since uint64) []Event {
+	return eventLog.since(since)
+}
+
+// recordEvent adds the event to the event log.
+func recordEvent(e Event) {
+	eventCounts.Add(e.Kind, 1)
+	eventLog.add(e)
+}
+
+// shipEvents publishes the last event as an expvar variable, therefore it is
+// recorded by the self readers. It can be called multiple times.
+func shipEvents() {
+	shipOnce.Do(func() {
+		expvar.Publish("Last Engine Event", expvar.Func(func() interface{} {
+			if e, ok := eventLog.last(); ok {
+				return e
+			}
+			return struct{}{}
+		}))
+	})
+}
+
+// eventRing is a fixed size buffer of the latest events.
+type eventRing struct {
+	mu     sync.RWMutex
+	events []Event
+	next   int // index of the next write.
+	full   bool
+	seq    uint64
+}
+
+func newEventRing(size int) *eventRing {
+	return &eventRing{events: make([]Event, size)}
+}
+
+// resize changes the size of the ring and keeps the latest events that fit.
+func (r *eventRing) resize(size int) {
+	if size <= 0 {
+		size = DefaultEventLogSize
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size == len(r.events) {
+		return
+	}
+	old := r.ordered()
+	if len(old) > size {
+		old = old[len(old)-size:]
+	}
+	r.events = make([]Event, size)
+	copy(r.events, old)
+	r.next = len(old) % size
+	r.full = len(old) == size
+}
+
+func (r *eventRing) add(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	e.Seq = r.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *eventRing) since(seq uint64) []Event {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var list []Event
+	for _, e := range r.ordered() {
+		if e.Seq > seq {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+func (r *eventRing) last() (Event, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.seq == 0 {
+		return Event{}, false
+	}
+	i := r.next - 1
+	if i < 0 {
+		i = len(r.events) - 1
+	}
+	return r.events[i], true
+}
+
+// ordered returns the events oldest first. The caller should hold the lock.
+func (r *eventRing) ordered() []Event {
+	if !r.full {
+		return append([]Event(nil), r.events[:r.next]...)
+	}
+	list := make([]Event, 0, len(r.events))
+	list = append(list, r.events[r.next:]...)
+	return append(list, r.events[:r.next]...)
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import "testing"
+
+func seqs(events []Event) []uint64 {
+	list := make([]uint64, len(events))
+	for i, e := range events {
+		list[i] = e.Seq
+	}
+	return list
+}
+
+func TestEventRing(t *testing.T) {
+	r := newEventRing(3)
+	if _, ok := r.last(); ok {
+		t.Error("last(): ok = (true); want (false)")
+	}
+	for i := 0; i < 5; i++ {
+		r.add(Event{Kind: EventReaderAdded})
+	}
+	if got := seqs(r.since(0)); len(got) != 3 || got[0] != 3 || got[2] != 5 {
+		t.Errorf("since(0) = (%v); want ([3 4 5])", got)
+	}
+	if got := seqs(r.since(4)); len(got) != 1 || got[0] != 5 {
+		t.Errorf("since(4) = (%v); want ([5])", got)
+	}
+	if e, _ := r.last(); e.Seq != 5 || e.Time.IsZero() {
+		t.Errorf("last() = (%v); want the 5th event with a time", e)
+	}
+
+	r.resize(2)
+	if got := seqs(r.since(0)); len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Errorf("since(0) = (%v); want ([4 5])", got)
+	}
+	r.resize(4)
+	r.add(Event{Kind: EventReaderRemoved})
+	if got := seqs(r.since(0)); len(got) != 3 || got[0] != 4 || got[2] != 6 {
+		t.Errorf("since(0) = (%v); want ([4 5 6])", got)
+	}
+	if e, _ := r.last(); e.Kind != EventReaderRemoved {
+		t.Errorf("last().Kind = (%s); want (%s)", e.Kind, EventReaderRemoved)
+	}
+}
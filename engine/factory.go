@@ -6,68 +6,403 @@ package engine
 
 import (
 	"context"
+	"expvar"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/recorder"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/alert"
+	"github.com/alext234/expipe/tools/cluster"
 	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/limits"
 	"github.com/pkg/errors"
 )
 
+var (
+	quarantinedReaders   = expvar.NewInt("Quarantined Readers")
+	quarantinedRecorders = expvar.NewInt("Quarantined Recorders")
+)
+
+// defaultRetryInterval is used when the RetryInterval of the Service is not set.
+const defaultRetryInterval = 10 * time.Second
+
 // Service initialises Engines.
 // Configure injects the input values into the Operator by calling each function
-// on it.
+// on it. Readers that can't be reached when their Engine is being created are
+// put into a quarantine list and are re-pinged every RetryInterval. They join
+// the Service as soon as their endpoints come back. The same goes for the
+// recorders that can't be reached while the rest of their routes can; they are
+// added to their Engines when they come back. If the LazyPing setting is
+// set, the Service starts even if none of the endpoints are available. If the
+// Cluster setting has any peers, the Service only runs the readers that are
+// owned by this instance on the cluster's hash ring.
+// All Engines run on one Scheduler with Workers readers and recorders; the
+// Scheduler uses defaultWorkers if Workers is not set. The results are shipped
+// in batches if the FlushInterval setting is set. If the Alerts setting has
+// any endpoints, they are notified when a reader or recorder keeps failing or
+// is removed from its Engine. The OnRecorderFailure setting decides what
+// happens to the results of the recorders that keep failing; with the
+// config.RecorderFailureExit policy the Service stops when all recorders are
+// down, and its Err returns ErrRecordersDown. The Service can be paused and
+// resumed while it runs, see Pause.
 type Service struct {
-	Log       tools.FieldLogger
-	Ctx       context.Context
-	Conf      *config.ConfMap
-	Configure func(...func(Engine) error) (Engine, error)
+	Log           tools.FieldLogger
+	Ctx           context.Context
+	Conf          *config.ConfMap
+	Configure     func(...func(Engine) error) (Engine, error)
+	RetryInterval time.Duration
+	Workers       int
+	sched         *Scheduler
+	alerts        *alert.Dispatcher
+	cancel        context.CancelFunc
+	mu            sync.Mutex
+	err           error // guarded by mu.
+	paused        bool  // guarded by mu.
 }
 
 // Start creates some Engines and returns a channel that closes it when it's
 // done its work. For each routes, we need one engine that has multiple readers
 // and writes to one recorder. When all recorders of one reader go out of scope,
 // the Engine stops that reader because there is no destination. Each Engine
-// rans in its own goroutine.
+// is scheduled on the Service's Scheduler.
 func (s *Service) Start() (chan struct{}, error) {
 	// TODO: return a slice of error
 	var (
-		wg       sync.WaitGroup
-		leastOne bool
-		err      error
+		wg          sync.WaitGroup
+		leastOne    bool
+		owned       int
+		err         error
+		quarantined = make(map[string][]string)
+		lost        = make(map[string][]Engine)
 	)
 	if s.Configure == nil {
 		s.Configure = New
 	}
+	if s.RetryInterval == 0 {
+		s.RetryInterval = defaultRetryInterval
+	}
 	done := make(chan struct{})
 	if s.Conf == nil {
 		return nil, errors.New("confMap cannot be nil")
 	}
+	ring, err := s.ring()
+	if err != nil {
+		return nil, err
+	}
+	s.Ctx, s.cancel = context.WithCancel(s.Ctx)
+	s.alerts = alert.New(s.Log, s.Conf.Settings.Alerts)
+	options := []func(*Scheduler){
+		WithFlushInterval(s.Conf.Settings.FlushInterval),
+		WithGracePeriod(s.Conf.Settings.JobGracePeriod),
+		WithClockSkewThreshold(s.Conf.Settings.ClockSkewThreshold),
+		WithReadAnnotations(s.Conf.Settings.AnnotateReads),
+		WithAlerts(s.alerts),
+		WithRecorderFailure(s.Conf.Settings.OnRecorderFailure, s.Conf.Settings.Alerts.ErrorThreshold, s.recordersDown),
+		WithDelivery(s.Conf.Settings.DeliveryMode),
+		WithMaxUnacked(s.Conf.Settings.MaxUnackedJobs),
+	}
+	if s.Conf.Settings.Runtime.MemoryLimit > 0 {
+		options = append(options, WithShedding(limits.Overloaded))
+	}
+	s.mu.Lock()
+	s.sched = NewScheduler(s.Ctx, s.Workers, options...)
+	if s.paused {
+		s.sched.Pause()
+	}
+	s.mu.Unlock()
+	board.setRoutes(s.Conf.Routes)
+	eventLog.resize(s.Conf.Settings.Events.Size)
+	if s.Conf.Settings.Events.Ship {
+		shipEvents()
+	}
+	recordEvent(Event{Kind: EventServiceStarted})
 	for reader, recorders := range s.Conf.Routes {
 		var en Engine
+		if ring != nil && !ring.Owns(s.Conf.Settings.Cluster.Self, reader) {
+			s.Log.Debugf("reader (%s) is owned by (%s)", reader, ring.Owner(reader))
+			continue
+		}
+		owned++
 
 		en, err = s.engine(reader, recorders)
+		s.reportRemoved(reader, recorders, en, err)
 		if err != nil {
 			s.Log.Warn(err)
+			if _, ok := errors.Cause(err).(PingError); ok {
+				quarantined[reader] = recorders
+			}
 			continue
 		}
+		recordEvent(Event{Kind: EventReaderAdded, Reader: reader, Recorders: names(en.Recorders())})
+		for _, name := range s.unjoined(recorders, en) {
+			lost[name] = append(lost[name], en)
+		}
 		wg.Add(1)
 		leastOne = true
-		go func(en Engine) {
-			done := Start(en)
-			<-done
-			s.Log.Infof("Engine's work (%s) has finished", en)
-			wg.Done()
-		}(en)
+		go s.run(en, &wg)
+	}
+	if ring != nil && owned == 0 {
+		s.Log.Infof("no readers are owned by (%s)", s.Conf.Settings.Cluster.Self)
+		go func() {
+			<-s.Ctx.Done()
+			recordEvent(Event{Kind: EventServiceShutdown})
+			close(done)
+		}()
+		return done, nil
 	}
-	if !leastOne {
+	if !leastOne && !(s.Conf.Settings.LazyPing && len(quarantined) > 0) {
 		return nil, err
 	}
+	for reader, recorders := range quarantined {
+		recordEvent(Event{Kind: EventReaderQuarantined, Reader: reader, Recorders: recorders})
+		wg.Add(1)
+		quarantinedReaders.Add(1)
+		go s.quarantine(reader, recorders, &wg)
+	}
+	for name, engines := range lost {
+		s.quarantineRecorder(name, engines...)
+	}
 	go func() {
 		wg.Wait()
+		if s.Ctx.Err() != nil {
+			recordEvent(Event{Kind: EventServiceShutdown})
+		}
 		close(done)
 	}()
-	return done, err
+	return done, nil
+}
+
+// Err returns ErrRecordersDown if the Service was stopped because all of its
+// recorders were down, otherwise it returns nil.
+func (s *Service) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// recordersDown stops the Service with the ErrRecordersDown error.
+func (s *Service) recordersDown() {
+	s.Log.Error(ErrRecordersDown)
+	s.mu.Lock()
+	s.err = ErrRecordersDown
+	s.mu.Unlock()
+	s.cancel()
+}
+
+// Once reads each of the readers of the routes once and records the results
+// into their recorders, then returns. Unlike Start, the readers that can't be
+// pinged are not quarantined. The readers that are owned by other instances of
+// the cluster are skipped. It returns an error with the number of the routes
+// that failed if any of the readers or recorders fail, or are unreachable.
+func (s *Service) Once() error {
+	if s.Configure == nil {
+		s.Configure = New
+	}
+	if s.Conf == nil {
+		return errors.New("confMap cannot be nil")
+	}
+	ring, err := s.ring()
+	if err != nil {
+		return err
+	}
+	readers := make([]string, 0, len(s.Conf.Routes))
+	for reader := range s.Conf.Routes {
+		readers = append(readers, reader)
+	}
+	sort.Strings(readers)
+	var failed, owned int
+	for _, reader := range readers {
+		if ring != nil && !ring.Owns(s.Conf.Settings.Cluster.Self, reader) {
+			s.Log.Debugf("reader (%s) is owned by (%s)", reader, ring.Owner(reader))
+			continue
+		}
+		owned++
+		recorders := s.Conf.Routes[reader]
+		en, err := s.engine(reader, recorders)
+		if err != nil {
+			s.Log.Errorf("%s: %v", reader, err)
+			failed++
+			continue
+		}
+		ok := true
+		for _, name := range recorders {
+			if _, exists := s.Conf.Recorders[name]; !exists {
+				continue
+			}
+			if _, joined := en.Recorders()[name]; !joined {
+				s.Log.Errorf("%s: %s: %v", reader, name, errRecorderUnreachable)
+				ok = false
+			}
+		}
+		if err = Once(en); err != nil {
+			s.Log.Errorf("%s: %v", reader, err)
+			ok = false
+		}
+		if !ok {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d route(s) failed", failed, owned)
+	}
+	return nil
+}
+
+// run starts the Engine and blocks until its work is finished.
+func (s *Service) run(en Engine, wg *sync.WaitGroup) {
+	defer wg.Done()
+	done := s.sched.Start(en)
+	<-done
+	s.Log.Infof("Engine's work (%s) has finished", en)
+	if s.Ctx.Err() == nil {
+		name := en.Reader().Name()
+		recordEvent(Event{Kind: EventReaderRemoved, Reader: name, Recorders: names(en.Recorders())})
+		s.alerts.Removed("reader", name, en.Ctx().Err())
+	}
+}
+
+// reportRemoved records an event and sends a Removed alert for each of the
+// reader and recorders of the route that could not join the Engine.
+func (s *Service) reportRemoved(reader string, recorders []string, en Engine, err error) {
+	if pe, ok := errors.Cause(err).(PingError); ok {
+		for name, err := range pe {
+			if name == reader {
+				s.alerts.Removed("reader", name, err)
+				continue
+			}
+			recordEvent(Event{Kind: EventRecorderRemoved, Reader: reader, Recorders: []string{name}, Message: err.Error()})
+			s.alerts.Removed("recorder", name, err)
+		}
+		return
+	}
+	if en == nil {
+		return
+	}
+	for _, name := range s.unjoined(recorders, en) {
+		recordEvent(Event{Kind: EventRecorderRemoved, Reader: reader, Recorders: []string{name}, Message: errRecorderUnreachable.Error()})
+		s.alerts.Removed("recorder", name, errRecorderUnreachable)
+	}
+}
+
+// unjoined returns the recorders of the route that could not join the Engine.
+func (s *Service) unjoined(recorders []string, en Engine) []string {
+	var list []string
+	for _, name := range recorders {
+		if _, ok := s.Conf.Recorders[name]; !ok {
+			continue
+		}
+		if _, ok := en.Recorders()[name]; !ok {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// names returns the sorted names of the recorders.
+func names(recorders map[string]recorder.DataRecorder) []string {
+	list := make([]string, 0, len(recorders))
+	for name := range recorders {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// quarantine tries to create an Engine for the reader on every RetryInterval
+// until it succeeds or the context is cancelled. The Engine will be started as
+// soon as the reader and at least one of its recorders are reachable.
+func (s *Service) quarantine(reader string, recorders []string, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(s.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			en, err := s.engine(reader, recorders)
+			if err != nil {
+				s.Log.Debugf("reader (%s) is still quarantined: %v", reader, err)
+				continue
+			}
+			quarantinedReaders.Add(-1)
+			s.Log.Infof("reader (%s) has recovered", reader)
+			recordEvent(Event{Kind: EventReaderRecovered, Reader: reader, Recorders: names(en.Recorders())})
+			s.alerts.Notify(alert.Event{Kind: alert.Recovered, Component: "reader", Name: reader})
+			for _, name := range s.unjoined(recorders, en) {
+				s.quarantineRecorder(name, en)
+			}
+			s.run(en, wg)
+			return
+		case <-s.Ctx.Done():
+			quarantinedReaders.Add(-1)
+			wg.Done()
+			return
+		}
+	}
+}
+
+// quarantineRecorder pings the recorder on every RetryInterval in the
+// background until it succeeds or the context is cancelled, then adds it to
+// the Engines it could not join. The Engines that can't take the recorders
+// after they have started are left out.
+func (s *Service) quarantineRecorder(name string, engines ...Engine) {
+	var joiners []Engine
+	for _, en := range engines {
+		if _, ok := en.(recorderJoiner); ok {
+			joiners = append(joiners, en)
+			recordEvent(Event{Kind: EventRecorderQuarantined, Reader: en.Reader().Name(), Recorders: []string{name}})
+		}
+	}
+	rec := s.Conf.Recorders[name]
+	if len(joiners) == 0 || rec == nil {
+		return
+	}
+	quarantinedRecorders.Add(1)
+	go func() {
+		defer quarantinedRecorders.Add(-1)
+		ticker := time.NewTicker(s.RetryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := rec.Ping(); err != nil {
+					s.Log.Debugf("recorder (%s) is still quarantined: %v", name, err)
+					continue
+				}
+				s.Log.Infof("recorder (%s) has recovered", name)
+				s.alerts.Notify(alert.Event{Kind: alert.Recovered, Component: "recorder", Name: name})
+				for _, en := range joiners {
+					if en.Ctx().Err() != nil {
+						continue
+					}
+					recordEvent(Event{Kind: EventRecorderRecovered, Reader: en.Reader().Name(), Recorders: []string{name}})
+					s.sched.failure.watch(map[string]recorder.DataRecorder{name: rec})
+					en.(recorderJoiner).AddRecorder(rec)
+					expRecorders.Add(1)
+				}
+				return
+			case <-s.Ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ring returns nil if the Service is not running in a cluster.
+func (s *Service) ring() (*cluster.Ring, error) {
+	c := s.Conf.Settings.Cluster
+	if len(c.Peers) == 0 {
+		return nil, nil
+	}
+	ring, err := cluster.NewRing(0, c.Peers...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cluster")
+	}
+	if !ring.HasPeer(c.Self) {
+		return nil, errors.Errorf("cluster: %s is not a peer", c.Self)
+	}
+	return ring, nil
 }
 
 func (s *Service) engine(reader string, recorders []string) (Engine, error) {
@@ -84,10 +419,47 @@ func (s *Service) engine(reader string, recorders []string) (Engine, error) {
 	if len(recs) == 0 {
 		return nil, ErrNoRecorder
 	}
-	return s.Configure(
+	options := []func(Engine) error{
 		WithCtx(s.Ctx),
 		WithReader(red),
 		WithRecorders(recs...),
 		WithLogger(s.Log),
-	)
+	}
+	if mappers := s.Conf.Mappers[reader]; len(mappers) > 0 {
+		options = append(options, WithMappers(mappers))
+	}
+	if tenants := s.Conf.Tenants[reader]; len(tenants) > 0 {
+		options = append(options, WithTenants(tenants))
+	}
+	if samples := s.Conf.Samples[reader]; len(samples) > 0 {
+		options = append(options, WithSamples(samples))
+	}
+	if conditions := s.Conf.Conditions[reader]; len(conditions) > 0 {
+		options = append(options, WithConditions(conditions))
+	}
+	if mutes := s.Conf.Mutes[reader]; len(mutes) > 0 {
+		options = append(options, WithMutes(mutes))
+	}
+	if schedule := s.Conf.ReaderMutes[reader]; len(schedule) > 0 {
+		options = append(options, WithReaderMute(schedule))
+	}
+	if d := s.Conf.Drifts[reader]; d != nil {
+		options = append(options, WithDrift(d))
+	}
+	if fallbacks := s.Conf.Fallbacks[reader]; len(fallbacks) > 0 {
+		options = append(options, WithFallbacks(fallbacks))
+	}
+	if s.Conf.ScrapeOnStart[reader] {
+		options = append(options, WithScrapeOnStart())
+	}
+	projections := make(map[string]*datatype.Projection)
+	for _, rec := range recorders {
+		if p, ok := s.Conf.Projections[rec]; ok {
+			projections[rec] = p
+		}
+	}
+	if len(projections) > 0 {
+		options = append(options, WithProjections(projections))
+	}
+	return s.Configure(options...)
 }
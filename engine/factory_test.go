@@ -6,9 +6,13 @@ package engine_test
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/tools"
 
 	"github.com/alext234/expipe/engine"
@@ -16,6 +20,7 @@ import (
 	rdt "github.com/alext234/expipe/reader/testing"
 	"github.com/alext234/expipe/recorder"
 	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/tools/cluster"
 	"github.com/alext234/expipe/tools/config"
 	"github.com/alext234/expipe/tools/token"
 	"github.com/pkg/errors"
@@ -267,6 +272,64 @@ func TestStartSendsReadRequestToReader(t *testing.T) {
 	}
 }
 
+func TestServicePause(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	called := make(chan struct{}, 10)
+	log := newFakeLogger()
+	log.ErrorfFunc = func(string, ...interface{}) {}
+
+	red := &rdt.Reader{
+		MockName: "name",
+		ReadFunc: func(*token.Context) (*reader.Result, error) {
+			select {
+			case called <- struct{}{}:
+			default:
+			}
+			return nil, nil
+		},
+		MockInterval: 10 * time.Millisecond,
+	}
+	rec := &rct.Recorder{MockName: "name"}
+	confMap := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"red": red},
+		Recorders: map[string]recorder.DataRecorder{"rec": rec},
+		Routes:    map[string][]string{"red": {"rec"}},
+	}
+	o := &operator{
+		ctx: ctx, log: log, red: red,
+		recs: map[string]recorder.DataRecorder{
+			rec.MockName: rec,
+		},
+	}
+	s := &engine.Service{
+		Ctx: ctx, Log: log, Conf: confMap,
+		Configure: func(...func(engine.Engine) error) (engine.Engine, error) {
+			return o, nil
+		},
+	}
+	if !s.Pause() || !s.Paused() {
+		t.Fatal("Paused() = (false); want (true)")
+	}
+	if _, err := s.Start(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	select {
+	case <-called:
+		t.Fatal("the reader was read while the service was paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !s.Resume() || s.Paused() {
+		t.Fatal("Paused() = (true); want (false)")
+	}
+	select {
+	case <-called:
+	case <-time.After(2 * time.Second):
+		t.Error("the reader was not read after resuming")
+	}
+}
+
 func TestStartFinishesWhenContextIsCanceled(t *testing.T) {
 	t.Parallel()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -304,3 +367,522 @@ func TestStartFinishesWhenContextIsCanceled(t *testing.T) {
 		t.Error("Service didn't quit")
 	}
 }
+
+func TestStartQuarantinesUnavailableReaders(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := newFakeLogger()
+	var available int32
+	called := make(chan struct{})
+	red1 := &rdt.Reader{
+		MockName:     "red1",
+		MockInterval: time.Hour,
+		PingFunc:     func() error { return nil },
+	}
+	red2 := &rdt.Reader{
+		MockName:     "red2",
+		MockInterval: 10 * time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+		PingFunc: func() error {
+			if atomic.LoadInt32(&available) == 0 {
+				return errExample
+			}
+			return nil
+		},
+		ReadFunc: func(*token.Context) (*reader.Result, error) {
+			select {
+			case called <- struct{}{}:
+			default:
+			}
+			return nil, nil
+		},
+	}
+	rec := &rct.Recorder{MockName: "rec", PingFunc: func() error { return nil }}
+	confMap := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"red1": red1, "red2": red2},
+		Recorders: map[string]recorder.DataRecorder{"rec": rec},
+		Routes:    map[string][]string{"red1": {"rec"}, "red2": {"rec"}},
+	}
+	s := &engine.Service{
+		Log: log, Ctx: ctx, Conf: confMap,
+		RetryInterval: 10 * time.Millisecond,
+	}
+	done, err := s.Start()
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%#v); want (nil)", err)
+	}
+	select {
+	case <-called:
+		t.Fatal("quarantined reader was read")
+	case <-time.After(50 * time.Millisecond):
+	}
+	atomic.StoreInt32(&available, 1)
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Error("reader didn't rejoin after recovery")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Service didn't quit")
+	}
+}
+
+func TestStartQuarantineStopsOnCancelledContext(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	log := newFakeLogger()
+	red1 := &rdt.Reader{
+		MockName:     "red1",
+		MockInterval: time.Hour,
+		PingFunc:     func() error { return nil },
+	}
+	red2 := &rdt.Reader{
+		MockName: "red2",
+		PingFunc: func() error { return errExample },
+	}
+	rec := &rct.Recorder{MockName: "rec", PingFunc: func() error { return nil }}
+	confMap := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"red1": red1, "red2": red2},
+		Recorders: map[string]recorder.DataRecorder{"rec": rec},
+		Routes:    map[string][]string{"red1": {"rec"}, "red2": {"rec"}},
+	}
+	s := &engine.Service{
+		Log: log, Ctx: ctx, Conf: confMap,
+		RetryInterval: time.Hour,
+	}
+	done, err := s.Start()
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%#v); want (nil)", err)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Service didn't quit")
+	}
+}
+
+func TestStartQuarantinesUnavailableRecorders(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var available int32
+	recorded := make(chan struct{}, 1)
+	red := &rdt.Reader{
+		MockName:     "qr_red",
+		MockInterval: 10 * time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+		Pinged:       true,
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{ID: job.ID(), Content: []byte(`{"devil":666}`), Mapper: red.Mapper()}, nil
+	}
+	rec1 := &rct.Recorder{MockName: "qr_rec1", Pinged: true}
+	rec2 := &rct.Recorder{
+		MockName: "qr_rec2",
+		PingFunc: func() error {
+			if atomic.LoadInt32(&available) == 0 {
+				return errExample
+			}
+			return nil
+		},
+		RecordFunc: func(context.Context, recorder.Job) error {
+			select {
+			case recorded <- struct{}{}:
+			default:
+			}
+			return nil
+		},
+	}
+	confMap := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"qr_red": red},
+		Recorders: map[string]recorder.DataRecorder{"qr_rec1": rec1, "qr_rec2": rec2},
+		Routes:    map[string][]string{"qr_red": {"qr_rec1", "qr_rec2"}},
+	}
+	s := &engine.Service{
+		Log: newFakeLogger(), Ctx: ctx, Conf: confMap,
+		RetryInterval: 10 * time.Millisecond,
+	}
+	done, err := s.Start()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	select {
+	case <-recorded:
+		t.Fatal("quarantined recorder was recorded into")
+	case <-time.After(50 * time.Millisecond):
+	}
+	atomic.StoreInt32(&available, 1)
+	select {
+	case <-recorded:
+	case <-time.After(time.Second):
+		t.Error("recorder didn't rejoin after recovery")
+	}
+
+	got := make(map[string]bool)
+	for _, e := range engine.Events(0) {
+		if e.Reader == "qr_red" && fmt.Sprint(e.Recorders) == "[qr_rec2]" {
+			got[e.Kind] = true
+		}
+	}
+	for _, kind := range []string{engine.EventRecorderRemoved, engine.EventRecorderQuarantined, engine.EventRecorderRecovered} {
+		if !got[kind] {
+			t.Errorf("event (%s) was not recorded", kind)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Service didn't quit")
+	}
+}
+
+func TestStartLazyPing(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := newFakeLogger()
+	red := &rdt.Reader{
+		MockName: "red",
+		PingFunc: func() error { return errExample },
+	}
+	rec := &rct.Recorder{MockName: "rec", PingFunc: func() error { return nil }}
+	confMap := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"red": red},
+		Recorders: map[string]recorder.DataRecorder{"rec": rec},
+		Routes:    map[string][]string{"red": {"rec"}},
+	}
+	s := &engine.Service{
+		Log: log, Ctx: ctx, Conf: confMap,
+		RetryInterval: time.Hour,
+	}
+	done, err := s.Start()
+	if _, ok := errors.Cause(err).(engine.PingError); !ok {
+		t.Errorf("err = (%#v); want (engine.PingError)", err)
+	}
+	if done != nil {
+		t.Errorf("done = (%v); want (nil)", done)
+	}
+
+	confMap.Settings.LazyPing = true
+	done, err = s.Start()
+	if errors.Cause(err) != nil {
+		t.Errorf("err = (%#v); want (nil)", err)
+	}
+	if done == nil {
+		t.Fatal("done = (nil); want (chan struct{})")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Service didn't quit")
+	}
+}
+
+func TestStartCluster(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := newFakeLogger()
+	confMap := &config.ConfMap{
+		Readers:   make(map[string]reader.DataReader),
+		Recorders: map[string]recorder.DataRecorder{"rec": &rct.Recorder{MockName: "rec", Pinged: true}},
+		Routes:    make(map[string][]string),
+	}
+	total := 20
+	for i := 0; i < total; i++ {
+		name := fmt.Sprintf("red%d", i)
+		confMap.Readers[name] = &rdt.Reader{
+			MockName:     name,
+			Pinged:       true,
+			MockInterval: time.Hour,
+		}
+		confMap.Routes[name] = []string{"rec"}
+	}
+
+	var mu sync.Mutex
+	owners := make(map[string]string)
+	for _, self := range []string{"node1", "node2"} {
+		self := self
+		conf := *confMap
+		conf.Settings.Cluster = config.Cluster{Self: self, Peers: []string{"node1", "node2"}}
+		s := &engine.Service{
+			Log: log, Ctx: ctx, Conf: &conf,
+			Configure: func(op ...func(engine.Engine) error) (engine.Engine, error) {
+				e, err := engine.New(op...)
+				if err == nil {
+					mu.Lock()
+					if owner, ok := owners[e.Reader().Name()]; ok {
+						t.Errorf("%s is also scraped by %s", e.Reader().Name(), owner)
+					}
+					owners[e.Reader().Name()] = self
+					mu.Unlock()
+				}
+				return e, err
+			},
+		}
+		if _, err := s.Start(); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	if len(owners) != total {
+		t.Errorf("len(owners) = (%d); want (%d)", len(owners), total)
+	}
+}
+
+func TestStartClusterErrors(t *testing.T) {
+	t.Parallel()
+	log := newFakeLogger()
+	confMap := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"red": &rdt.Reader{MockName: "red", Pinged: true}},
+		Recorders: map[string]recorder.DataRecorder{"rec": &rct.Recorder{MockName: "rec", Pinged: true}},
+		Routes:    map[string][]string{"red": {"rec"}},
+	}
+	confMap.Settings.Cluster = config.Cluster{Self: "node3", Peers: []string{"node1", "node2"}}
+	s := &engine.Service{Log: log, Ctx: context.Background(), Conf: confMap}
+	done, err := s.Start()
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if done != nil {
+		t.Errorf("done = (%v); want (nil)", done)
+	}
+
+	confMap.Settings.Cluster = config.Cluster{Self: "node1", Peers: []string{"node1", "node1"}}
+	_, err = s.Start()
+	if _, ok := errors.Cause(err).(cluster.DuplicatePeerError); !ok {
+		t.Errorf("err = (%v); want (cluster.DuplicatePeerError)", err)
+	}
+}
+
+func TestStartClusterNoOwnedReaders(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	log := newFakeLogger()
+	confMap := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"red": &rdt.Reader{MockName: "red", Pinged: true}},
+		Recorders: map[string]recorder.DataRecorder{"rec": &rct.Recorder{MockName: "rec", Pinged: true}},
+		Routes:    map[string][]string{"red": {"rec"}},
+	}
+	ring, err := cluster.NewRing(0, "node1", "node2")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	self := "node1"
+	if ring.Owns(self, "red") {
+		self = "node2"
+	}
+	confMap.Settings.Cluster = config.Cluster{Self: self, Peers: []string{"node1", "node2"}}
+	s := &engine.Service{Log: log, Ctx: ctx, Conf: confMap}
+	done, err := s.Start()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	select {
+	case <-done:
+		t.Fatal("Service quit before the context was cancelled")
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Service didn't quit")
+	}
+}
+
+func TestStartRecordsEvents(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var available int32
+	red1 := &rdt.Reader{
+		MockName:     "ev_red1",
+		MockInterval: time.Hour,
+		PingFunc:     func() error { return nil },
+	}
+	red2 := &rdt.Reader{
+		MockName:     "ev_red2",
+		MockInterval: time.Hour,
+		PingFunc: func() error {
+			if atomic.LoadInt32(&available) == 0 {
+				return errExample
+			}
+			return nil
+		},
+	}
+	rec := &rct.Recorder{MockName: "ev_rec", PingFunc: func() error { return nil }}
+	confMap := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"ev_red1": red1, "ev_red2": red2},
+		Recorders: map[string]recorder.DataRecorder{"ev_rec": rec},
+		Routes:    map[string][]string{"ev_red1": {"ev_rec"}, "ev_red2": {"ev_rec"}},
+	}
+	s := &engine.Service{
+		Log: newFakeLogger(), Ctx: ctx, Conf: confMap,
+		RetryInterval: 10 * time.Millisecond,
+	}
+	done, err := s.Start()
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%#v); want (nil)", err)
+	}
+	atomic.StoreInt32(&available, 1)
+
+	kinds := func() map[string]string {
+		got := make(map[string]string)
+		for _, e := range engine.Events(0) {
+			if e.Reader == "ev_red1" || e.Reader == "ev_red2" {
+				got[e.Reader+" "+e.Kind] = fmt.Sprint(e.Recorders)
+			}
+		}
+		return got
+	}
+	want := map[string]string{
+		"ev_red1 " + engine.EventReaderAdded:       "[ev_rec]",
+		"ev_red2 " + engine.EventReaderQuarantined: "[ev_rec]",
+		"ev_red2 " + engine.EventReaderRecovered:   "[ev_rec]",
+	}
+	var got map[string]string
+	for i := 0; i < 100; i++ {
+		if got = kinds(); len(got) == len(want) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("event (%s) = (%s); want (%s)", k, got[k], v)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Service didn't quit")
+	}
+	events := engine.Events(0)
+	var shutdown bool
+	for _, e := range events {
+		if e.Kind == engine.EventServiceShutdown {
+			shutdown = true
+		}
+	}
+	if !shutdown {
+		t.Error("the shutdown was not recorded")
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Seq <= events[i-1].Seq {
+			t.Errorf("events are not in order: %d after %d", events[i].Seq, events[i-1].Seq)
+		}
+	}
+}
+
+func TestServiceOnce(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var recorded int32
+	newReader := func(name string, pingErr error) *rdt.Reader {
+		return &rdt.Reader{
+			MockName:   name,
+			MockMapper: datatype.DefaultMapper(),
+			PingFunc:   func() error { return pingErr },
+			ReadFunc: func(job *token.Context) (*reader.Result, error) {
+				return &reader.Result{ID: job.ID(), Content: []byte(`{"a":1}`), Mapper: datatype.DefaultMapper()}, nil
+			},
+		}
+	}
+	confMap := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": newReader("red1", nil),
+			"red2": newReader("red2", nil),
+		},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": &rct.Recorder{
+				MockName: "rec1",
+				Pinged:   true,
+				RecordFunc: func(context.Context, recorder.Job) error {
+					atomic.AddInt32(&recorded, 1)
+					return nil
+				},
+			},
+			"rec2": &rct.Recorder{MockName: "rec2", PingFunc: func() error { return errors.New("down") }},
+		},
+		Routes: map[string][]string{"red1": {"rec1"}, "red2": {"rec1"}},
+	}
+	s := &engine.Service{Log: tools.DiscardLogger(), Ctx: ctx, Conf: confMap}
+	if err := s.Once(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if n := atomic.LoadInt32(&recorded); n != 2 {
+		t.Errorf("recorded = (%d); want (2)", n)
+	}
+
+	confMap.Routes["red2"] = []string{"rec1", "rec2"}
+	confMap.Readers["red3"] = newReader("red3", errors.New("gone"))
+	confMap.Routes["red3"] = []string{"rec1"}
+	err := s.Once()
+	if err == nil || err.Error() != "2 of 3 route(s) failed" {
+		t.Errorf("err = (%v); want (2 of 3 route(s) failed)", err)
+	}
+	if n := atomic.LoadInt32(&recorded); n != 4 {
+		t.Errorf("recorded = (%d); want (4)", n)
+	}
+
+	if err = (&engine.Service{Log: tools.DiscardLogger(), Ctx: ctx}).Once(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestServiceRecordersDown(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	confMap := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red_down": &rdt.Reader{
+				MockName:     "red_down",
+				MockInterval: time.Millisecond,
+				MockMapper:   datatype.DefaultMapper(),
+				Pinged:       true,
+				ReadFunc: func(job *token.Context) (*reader.Result, error) {
+					return &reader.Result{ID: job.ID(), Content: []byte(`{"a":1}`), Mapper: datatype.DefaultMapper()}, nil
+				},
+			},
+		},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec_down": &rct.Recorder{
+				MockName: "rec_down",
+				Pinged:   true,
+				RecordFunc: func(context.Context, recorder.Job) error {
+					return errors.New("full")
+				},
+			},
+		},
+		Routes: map[string][]string{"red_down": {"rec_down"}},
+	}
+	confMap.Settings.OnRecorderFailure = config.RecorderFailureExit
+	confMap.Settings.Alerts.ErrorThreshold = 2
+	s := &engine.Service{Log: tools.DiscardLogger(), Ctx: ctx, Conf: confMap}
+	done, err := s.Start()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the service did not stop")
+	}
+	if err := s.Err(); err != engine.ErrRecordersDown {
+		t.Errorf("err = (%v); want (%v)", err, engine.ErrRecordersDown)
+	}
+	if ctx.Err() != nil {
+		t.Error("the parent context was cancelled")
+	}
+}
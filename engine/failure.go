@@ -0,0 +1,141 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"sync"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/pkg/errors"
+)
+
+// MaxBufferedJobs is the number of the failed jobs of each recorder that are
+// kept with the config.RecorderFailureBuffer policy. The oldest jobs are
+// dropped when a recorder's buffer is full.
+const MaxBufferedJobs = 1000
+
+// ErrRecordersDown is the Err of the Service when it is stopped because all
+// of its recorders are down.
+var ErrRecordersDown = errors.New("all recorders are down")
+
+// recorderFailure keeps track of the recorders that are down, and the failed
+// jobs of the recorders with the buffer policy.
+type recorderFailure struct {
+	policy    string
+	threshold int64
+	onDown    func()
+	once      sync.Once
+	mu        sync.Mutex
+	down      map[string]bool        // guarded by mu.
+	buffered  map[string][]recordJob // guarded by mu.
+}
+
+// WithRecorderFailure sets the policy of the failing recorders, which is one
+// of the config.RecorderFailure policies. A recorder is down after threshold
+// consecutive failed jobs, the alert.DefaultThreshold is used if threshold is
+// not positive. With the config.RecorderFailureExit policy, onDown is called
+// once when all the recorders of the Engines are down. With the
+// config.RecorderFailureBuffer policy, the failed jobs are recorded again after
+// their recorders record a job successfully.
+func WithRecorderFailure(policy string, threshold int64, onDown func()) func(*Scheduler) {
+	return func(s *Scheduler) {
+		s.failure.policy = policy
+		if threshold > 0 {
+			s.failure.threshold = threshold
+		}
+		s.failure.onDown = onDown
+	}
+}
+
+// watch adds the recorders to the recorders that should be down before
+// calling onDown.
+func (f *recorderFailure) watch(recorders map[string]recorder.DataRecorder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name := range recorders {
+		if _, ok := f.down[name]; !ok {
+			f.down[name] = false
+		}
+	}
+}
+
+// result updates the state of the recorder with its error streak, and calls
+// onDown if all recorders are down with the exit policy.
+func (f *recorderFailure) result(name string, streak int64) {
+	f.mu.Lock()
+	f.down[name] = streak >= f.threshold
+	if f.policy != config.RecorderFailureExit {
+		f.mu.Unlock()
+		return
+	}
+	all := true
+	for _, down := range f.down {
+		all = all && down
+	}
+	f.mu.Unlock()
+	if all && f.onDown != nil {
+		f.once.Do(f.onDown)
+	}
+}
+
+// isDown returns true if the recorder has failed threshold consecutive jobs
+// since its last successful job.
+func (f *recorderFailure) isDown(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.down[name]
+}
+
+// buffer keeps the jobs of the same recorder for recording them again, if
+// the policy is config.RecorderFailureBuffer or the delivery is at least once.
+// The jobs are not dropped when the buffer is full with the at least once
+// delivery, which bounds the buffer by stopping the reads, see WithMaxUnacked.
+func (s *Scheduler) buffer(jobs ...recordJob) {
+	f := &s.failure
+	if len(jobs) == 0 {
+		return
+	}
+	name := jobs[0].rec.Name()
+	if f.policy != config.RecorderFailureBuffer && !s.atLeast {
+		s.ack(name, len(jobs))
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	before := len(f.buffered[name])
+	list := append(f.buffered[name], jobs...)
+	if over := len(list) - MaxBufferedJobs; over > 0 && !s.atLeast {
+		list = append([]recordJob(nil), list[over:]...)
+		droppedJobs.Add(int64(over))
+		s.ack(name, over)
+	}
+	f.buffered[name] = list
+	bufferedJobs.Add(int64(len(list) - before))
+}
+
+// retryBuffered queues the buffered jobs of the recorder for recording.
+func (s *Scheduler) retryBuffered(name string) {
+	f := &s.failure
+	f.mu.Lock()
+	jobs := f.buffered[name]
+	delete(f.buffered, name)
+	f.mu.Unlock()
+	if len(jobs) == 0 {
+		return
+	}
+	bufferedJobs.Add(-int64(len(jobs)))
+	// the record workers would block on a full queue.
+	go func() {
+		for _, r := range jobs {
+			select {
+			case s.records <- r:
+				recordQueue.Add(1)
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
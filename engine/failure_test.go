@@ -0,0 +1,304 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine_test
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/engine"
+	"github.com/alext234/expipe/reader"
+	rdt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/recorder"
+	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/token"
+)
+
+func newFailingEngine(t *testing.T, ctx context.Context, name string, record func(recorder.Job) error) engine.Engine {
+	red := &rdt.Reader{
+		Pinged:       true,
+		MockName:     name,
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:       job.ID(),
+			TypeName: name,
+			Content:  []byte(`{"devil":666}`),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	rec := &rct.Recorder{
+		Pinged:   true,
+		MockName: "rec_" + name,
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			return record(job)
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return e
+}
+
+func TestSchedulerRecorderFailureExit(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		policy   string
+		wantDown bool
+	}{
+		{config.RecorderFailureExit, true},
+		{config.RecorderFailureDegrade, false},
+		{"", false},
+	}
+	for i, tc := range tcs {
+		tc := tc
+		name := fmt.Sprintf("down_%d", i)
+		t.Run(tc.policy, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			down := make(chan struct{})
+			e := newFailingEngine(t, ctx, name, func(recorder.Job) error { return fmt.Errorf("boom") })
+			s := engine.NewScheduler(ctx, 2, engine.WithRecorderFailure(tc.policy, 3, func() { close(down) }))
+			s.Start(e)
+			select {
+			case <-down:
+				if !tc.wantDown {
+					t.Error("onDown was called")
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tc.wantDown {
+					t.Error("onDown was not called")
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerRecorderFailureBuffer(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		failed   = make(map[string]bool)
+		recorded = make(map[string]bool)
+	)
+	e := newFailingEngine(t, ctx, "buffered", func(job recorder.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		id := job.ID.String()
+		if len(failed) < 5 && !failed[id] {
+			failed[id] = true
+			return fmt.Errorf("boom")
+		}
+		recorded[id] = true
+		return nil
+	})
+	s := engine.NewScheduler(ctx, 2, engine.WithRecorderFailure(config.RecorderFailureBuffer, 0, nil))
+	s.Start(e)
+
+	deadline := time.After(5 * time.Second)
+	for {
+		mu.Lock()
+		missing := len(failed) < 5
+		for id := range failed {
+			if !recorded[id] {
+				missing = true
+			}
+		}
+		mu.Unlock()
+		if !missing {
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatal("the failed jobs were not recorded again")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func TestSchedulerDeliveryAtLeastOnce(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		down     = true
+		failed   = make(map[string]bool)
+		recorded = make(map[string]bool)
+	)
+	e := newFailingEngine(t, ctx, "at_least_once", func(job recorder.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		id := job.ID.String()
+		if down {
+			failed[id] = true
+			return fmt.Errorf("boom")
+		}
+		recorded[id] = true
+		return nil
+	})
+	// the degrade policy drops the failed jobs with the at most once delivery.
+	s := engine.NewScheduler(ctx, 2,
+		engine.WithRecorderFailure(config.RecorderFailureDegrade, 0, nil),
+		engine.WithDelivery(config.DeliveryAtLeastOnce),
+	)
+	s.Start(e)
+
+	unacked := func() int64 {
+		v, ok := expvar.Get("Recorder Unacked Jobs").(*expvar.Map).Get("rec_at_least_once").(*expvar.Int)
+		if !ok {
+			return 0
+		}
+		return v.Value()
+	}
+	deadline := time.After(5 * time.Second)
+	for unacked() < 5 {
+		select {
+		case <-deadline:
+			t.Fatalf("unacked = (%d); want (>= 5)", unacked())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	for {
+		mu.Lock()
+		missing := 0
+		for id := range failed {
+			if !recorded[id] {
+				missing++
+			}
+		}
+		mu.Unlock()
+		if missing == 0 {
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("%d failed jobs were not recorded again", missing)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func TestSchedulerMaxUnacked(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := newFailingEngine(t, ctx, "max_unacked", func(recorder.Job) error {
+		return fmt.Errorf("boom")
+	})
+	s := engine.NewScheduler(ctx, 2,
+		engine.WithDelivery(config.DeliveryAtLeastOnce),
+		engine.WithMaxUnacked(3),
+	)
+	s.Start(e)
+
+	value := func(metric, key string) int64 {
+		v, ok := expvar.Get(metric).(*expvar.Map).Get(key).(*expvar.Int)
+		if !ok {
+			return 0
+		}
+		return v.Value()
+	}
+	deadline := time.After(5 * time.Second)
+	for value("Throttled Read Jobs", "max_unacked") < 5 {
+		select {
+		case <-deadline:
+			t.Fatal("the reads were not throttled")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if n := value("Recorder Unacked Jobs", "rec_max_unacked"); n != 3 {
+		t.Errorf("unacked = (%d); want (3)", n)
+	}
+}
+
+func TestSchedulerFailover(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var healthy, backups int32 = 1, 0
+	red := &rdt.Reader{
+		Pinged:       true,
+		MockName:     "failover",
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{ID: job.ID(), Content: []byte(`{"devil":666}`), Mapper: red.Mapper()}, nil
+	}
+	primary := &rct.Recorder{
+		Pinged:   true,
+		MockName: "rec_failover_primary",
+		RecordFunc: func(context.Context, recorder.Job) error {
+			if atomic.LoadInt32(&healthy) == 0 {
+				return fmt.Errorf("boom")
+			}
+			return nil
+		},
+	}
+	backup := &rct.Recorder{
+		Pinged:   true,
+		MockName: "rec_failover_backup",
+		RecordFunc: func(context.Context, recorder.Job) error {
+			atomic.AddInt32(&backups, 1)
+			return nil
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(primary, backup),
+		engine.WithFallbacks(map[string]string{primary.Name(): backup.Name()}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	engine.NewScheduler(ctx, 2, engine.WithRecorderFailure(config.RecorderFailureDegrade, 2, nil)).Start(e)
+
+	time.Sleep(30 * time.Millisecond)
+	if n := atomic.LoadInt32(&backups); n != 0 {
+		t.Fatalf("backups = (%d); want (0): the primary is up", n)
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&backups) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the fallback was not recorded into while the primary is down")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(30 * time.Millisecond)
+	before := atomic.LoadInt32(&backups)
+	time.Sleep(30 * time.Millisecond)
+	if n := atomic.LoadInt32(&backups); n != before {
+		t.Errorf("backups = (%d); want (%d): the primary is back", n, before)
+	}
+}
@@ -5,126 +5,98 @@
 package engine
 
 import (
-	"context"
 	"runtime"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/alext234/expipe/tools"
-
-	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
-	"github.com/alext234/expipe/recorder"
 	"github.com/alext234/expipe/tools/token"
+	"github.com/alext234/expipe/tools/trace"
 	"github.com/pkg/errors"
 )
 
-var chanBuffer = 100
+var (
+	chanBuffer  = 100
+	samplerOnce sync.Once
+)
 
 // Start begins pulling data from DataReader and chip them to the DataRecorder.
 // When the context is cancelled or timed out, the engine abandons its
-// operations and returns an error if accrued.
+// operations and closes the returned channel. The Engine runs on its own
+// Scheduler; use a shared Scheduler for running multiple Engines.
 func Start(e Engine) chan struct{} {
-	stop := make(chan struct{})
-	go func() {
-		dispatch := dispatchLoop(e.Ctx(), e.Log(), e.Recorders())
-		for {
-			if ok := iterate(e, dispatch, stop); !ok {
-				return
-			}
-		}
-	}()
-	go func() {
-		for {
-			numGoroutines.Set(int64(runtime.NumGoroutine()))
-			time.Sleep(50 * time.Millisecond)
-		}
-	}()
-	return stop
+	return NewScheduler(e.Ctx(), len(e.Recorders())).Start(e)
 }
 
-func iterate(e Engine, dispatch chan *reader.Result, stop chan struct{}) bool {
-	timer := time.NewTimer(e.Reader().Interval())
-	select {
-	case <-timer.C:
-		waitingReadJobs.Add(1)
-		defer waitingReadJobs.Add(-1)
-		job := token.New(e.Ctx())
-		res, err := e.Reader().Read(job)
-		if errors.Cause(err) != nil {
-			erroredJobs.Add(1)
-			e.Log().Errorf("read job: %v", err)
-			break
-		}
-		if res == nil || res.Content == nil {
-			erroredJobs.Add(1)
-			e.Log().Errorf("read job: %v", err)
-			break
-		}
-		readJobs.Add(1)
-		dispatch <- res
-	case <-e.Ctx().Done():
-		close(stop)
-		return false
+// Once reads from the Engine's reader once and records the result into all of
+// its recorders, one after another, then returns. It returns a JobError if the
+// read or any of the records fail; the other recorders are still recorded
+// into. The recorders whose tenants are over their quotas, or whose samples or
+// conditions do not include the result, are skipped. The fallback recorders
+// are skipped unless their primaries could not join the Engine. The results
+// that are dropped by the reader with reader.ErrDropped, for example when the
+// endpoint has not changed, are not errors and nothing is recorded. The read
+// and the records are cancelled after their timeouts and the
+// DefaultGracePeriod.
+func Once(e Engine) error {
+	ctx, span := trace.Start(e.Ctx(), "read")
+	defer span.End()
+	readCtx, cancel := withDeadline(ctx, e.Reader().Timeout(), DefaultGracePeriod)
+	defer cancel()
+	job := token.New(readCtx)
+	name := e.Reader().Name()
+	res, err := e.Reader().Read(job)
+	if errors.Cause(err) == reader.ErrDropped {
+		e.Log().Debugf("read job: %v", err)
+		return nil
 	}
-	return true
-}
-
-// dispatchLoop starts a goroutine for each recorder and fans out the results.
-// Engine can send send the results through the returning channel.
-func dispatchLoop(ctx context.Context, log tools.FieldLogger, recs map[string]recorder.DataRecorder) chan *reader.Result {
-	dispatch := make(chan *reader.Result, len(recs)*chanBuffer)
-	ring := make([]chan *reader.Result, len(recs))
-	var i int
-	for _, rec := range recs {
-		d := make(chan *reader.Result, chanBuffer)
-		ring[i] = d
-		i++
-		go dispatchRecord(ctx, log, rec, d)
+	if err == nil && (res == nil || res.Content == nil) {
+		err = errEmptyResult
 	}
-	go fanOut(ring, dispatch)
-	return dispatch
-}
-
-func dispatchRecord(ctx context.Context, log tools.FieldLogger, rec recorder.DataRecorder, dispatch chan *reader.Result) {
-	for {
-		select {
-		case result := <-dispatch:
-			res := make([]byte, len(result.Content))
-			copy(res, result.Content)
-			payload, err := datatype.JobResultDataTypes(res, result.Mapper.Copy())
-			if err != nil {
-				log.Errorf("error in payload: %s", err)
-				return
-			}
-			waitingRecordJobs.Add(1)
-			job := recorder.Job{
-				ID:        result.ID,
-				Payload:   payload,
-				IndexName: rec.IndexName(),
-				TypeName:  result.TypeName,
-				Time:      result.Time,
-			}
-			err = rec.Record(ctx, job)
-			if err != nil {
-				waitingRecordJobs.Add(-1)
-				log.Errorf("record error: %v", err)
+	if err != nil {
+		span.SetError(err)
+		return JobError{Name: name, ID: job.ID(), Err: err}
+	}
+	res.TypeName = reader.ExpandTypeName(res.TypeName, name, e.Reader().Endpoint(), res.Content)
+	recs := make([]string, 0, len(e.Recorders()))
+	for name := range e.Recorders() {
+		recs = append(recs, name)
+	}
+	sort.Strings(recs)
+	var first error
+	for _, name := range recs {
+		rec := e.Recorders()[name]
+		if onStandby(e, rec, func(string) bool { return false }) || !admit(e, rec, res) {
+			continue
+		}
+		j, err := newJob(recordJob{ctx: ctx, engine: e, rec: rec, result: res})
+		if err == nil {
+			recCtx, cancel := withDeadline(ctx, rec.Timeout(), DefaultGracePeriod)
+			err = rec.Record(recCtx, j)
+			cancel()
+			release(rec, j.Payload)
+		}
+		if err != nil {
+			err = JobError{Name: name, ID: res.ID, Err: errors.Wrap(err, "record")}
+			e.Log().Error(err)
+			if first == nil {
+				first = err
 			}
-			waitingRecordJobs.Add(-1)
-			recordJobs.Add(1)
-		case <-ctx.Done():
 		}
 	}
+	return first
 }
 
-// fanOut sends each job from dispatch to all ring channels.
-// It starts a goroutine for each job.
-func fanOut(ring []chan *reader.Result, dispatch chan *reader.Result) {
-	for {
-		job := <-dispatch
-		for _, r := range ring {
-			go func(r chan *reader.Result) {
-				r <- job
-			}(r)
-		}
-	}
+// startSampler updates the numGoroutines metric. Only one sampler runs in the
+// process regardless of the number of Schedulers.
+func startSampler() {
+	samplerOnce.Do(func() {
+		go func() {
+			for {
+				numGoroutines.Set(int64(runtime.NumGoroutine()))
+				time.Sleep(50 * time.Millisecond)
+			}
+		}()
+	})
 }
@@ -7,15 +7,24 @@ package engine_test
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/reader/expvar"
 	rdt "github.com/alext234/expipe/reader/testing"
 	"github.com/alext234/expipe/recorder"
 	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/tools/condition"
+	"github.com/alext234/expipe/tools/mute"
+	"github.com/alext234/expipe/tools/sample"
 	"github.com/alext234/expipe/tools/token"
 
 	"github.com/alext234/expipe/engine"
@@ -211,8 +220,9 @@ func TestReadErrorBadPayload(t *testing.T) {
 	log := newFakeLogger()
 	registered := make(chan struct{})
 	recorded := make(chan struct{})
+	var once sync.Once
 	log.ErrorfFunc = func(string, ...interface{}) {
-		close(registered)
+		once.Do(func() { close(registered) })
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -399,3 +409,514 @@ func TestEngineDispatchesToRecorders(t *testing.T) {
 		t.Error("expected to record, didn't happen")
 	}
 }
+
+func TestReadDroppedIsNotAnError(t *testing.T) {
+	t.Parallel()
+	log := newFakeLogger()
+	called := make(chan struct{})
+	errored := make(chan struct{}, 10)
+	log.ErrorfFunc = func(string, ...interface{}) {
+		errored <- struct{}{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{
+		PingFunc: func() error { return nil },
+		ReadFunc: func(*token.Context) (*reader.Result, error) {
+			select {
+			case called <- struct{}{}:
+			default:
+			}
+			return nil, reader.ErrDropped
+		},
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	rec := &rct.Recorder{
+		PingFunc: func() error { return nil },
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+	)
+	if errors.Cause(err) != nil {
+		t.Fatalf("New(): err = (%#v); want (nil)", err)
+	}
+	engine.Start(e)
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("didn't invoke the read")
+	}
+	select {
+	case <-errored:
+		t.Error("Errorf was called")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestOnce(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{MockName: "red", Pinged: true, MockMapper: datatype.DefaultMapper()}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:      job.ID(),
+			Content: []byte(`{"lucifer":666}`),
+			Mapper:  red.Mapper(),
+		}, nil
+	}
+	var mu sync.Mutex
+	var recorded []string
+	newRecorder := func(name string, err error) *rct.Recorder {
+		return &rct.Recorder{
+			MockName: name,
+			Pinged:   true,
+			RecordFunc: func(_ context.Context, job recorder.Job) error {
+				mu.Lock()
+				defer mu.Unlock()
+				recorded = append(recorded, name+":"+job.Reader)
+				return err
+			},
+		}
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(tools.DiscardLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(newRecorder("rec1", nil), newRecorder("rec2", errExample)),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err = engine.Once(e)
+	if jerr, ok := err.(engine.JobError); !ok || jerr.Name != "rec2" || errors.Cause(jerr.Err) != errExample {
+		t.Errorf("err = (%v); want (JobError of rec2)", err)
+	}
+	if want := "rec1:red rec2:red"; strings.Join(recorded, " ") != want {
+		t.Errorf("recorded = (%v); want (%s)", recorded, want)
+	}
+
+	red.ReadFunc = func(*token.Context) (*reader.Result, error) { return nil, errExample }
+	err = engine.Once(e)
+	if jerr, ok := err.(engine.JobError); !ok || jerr.Name != "red" || jerr.Err != errExample {
+		t.Errorf("err = (%v); want (JobError of red)", err)
+	}
+	if len(recorded) != 2 {
+		t.Errorf("len(recorded) = (%d); want (2)", len(recorded))
+	}
+}
+
+func TestOnceNotModified(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"version":1}`))
+	}))
+	defer ts.Close()
+	red, err := expvar.New(
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("red"),
+		reader.WithEndpoint(ts.URL),
+		reader.WithInterval(time.Second),
+		reader.WithTimeout(time.Second),
+		reader.WithMapper(datatype.DefaultMapper()),
+		expvar.WithConditional(),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var recorded int32
+	rec := &rct.Recorder{
+		MockName: "rec",
+		Pinged:   true,
+		RecordFunc: func(context.Context, recorder.Job) error {
+			atomic.AddInt32(&recorded, 1)
+			return nil
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(context.Background()),
+		engine.WithLogger(tools.DiscardLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = engine.Once(e); err != nil {
+			t.Errorf("%d: err = (%v); want (nil)", i, err)
+		}
+	}
+	if n := atomic.LoadInt32(&recorded); n != 1 {
+		t.Errorf("recorded = (%d); want (1): the unchanged result should not be recorded", n)
+	}
+}
+
+func TestOnceTypeNameTemplate(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{
+		MockName:     "red",
+		MockEndpoint: "http://10.0.0.1:8080",
+		Pinged:       true,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:       job.ID(),
+			TypeName: "{reader}-{host}-{field:app}",
+			Content:  []byte(`{"app":"billing","lucifer":666}`),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	typeNames := make(chan string, 1)
+	rec := &rct.Recorder{
+		MockName: "rec",
+		Pinged:   true,
+		RecordFunc: func(_ context.Context, job recorder.Job) error {
+			typeNames <- job.TypeName
+			return nil
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(tools.DiscardLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = engine.Once(e); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if want, got := "red-10.0.0.1-billing", <-typeNames; got != want {
+		t.Errorf("TypeName = (%s); want (%s)", got, want)
+	}
+}
+
+func TestOnceSamples(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reads int
+	red := &rdt.Reader{MockName: "red", Pinged: true, MockMapper: datatype.DefaultMapper()}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		reads++
+		return &reader.Result{
+			ID:      job.ID(),
+			Content: []byte(`{"lucifer":666}`),
+			Mapper:  red.Mapper(),
+		}, nil
+	}
+	recorded := make(map[string]int)
+	newRecorder := func(name string) *rct.Recorder {
+		return &rct.Recorder{
+			MockName: name,
+			Pinged:   true,
+			RecordFunc: func(context.Context, recorder.Job) error {
+				recorded[name]++
+				return nil
+			},
+		}
+	}
+	s, err := sample.Parse("1/5")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(tools.DiscardLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(newRecorder("rec1"), newRecorder("rec2")),
+		engine.WithSamples(map[string]*sample.Sampler{"rec1": s}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err = engine.Once(e); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	if reads != 10 {
+		t.Errorf("reads = (%d); want (10): the reader is read on every interval", reads)
+	}
+	if recorded["rec1"] != 2 || recorded["rec2"] != 10 {
+		t.Errorf("recorded = (%v); want (rec1: 2, rec2: 10)", recorded)
+	}
+}
+
+func TestOnceConditions(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	versions := []string{"v1", "v1", "v2", "v2", "v1"}
+	var reads int
+	red := &rdt.Reader{MockName: "red", Pinged: true, MockMapper: datatype.DefaultMapper()}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		content := fmt.Sprintf(`{"version":%q,"uptime":%d}`, versions[reads], reads)
+		reads++
+		return &reader.Result{
+			ID:      job.ID(),
+			Content: []byte(content),
+			Mapper:  red.Mapper(),
+		}, nil
+	}
+	recorded := make(map[string]int)
+	newRecorder := func(name string) *rct.Recorder {
+		return &rct.Recorder{
+			MockName: name,
+			Pinged:   true,
+			RecordFunc: func(context.Context, recorder.Job) error {
+				recorded[name]++
+				return nil
+			},
+		}
+	}
+	change := 0.0
+	c, err := condition.New(condition.Rule{Field: "version", Change: &change})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(tools.DiscardLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(newRecorder("rec1"), newRecorder("rec2")),
+		engine.WithConditions(map[string]*condition.Condition{"rec1": c}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for range versions {
+		if err = engine.Once(e); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	if recorded["rec1"] != 3 || recorded["rec2"] != len(versions) {
+		t.Errorf("recorded = (%v); want (rec1: 3, rec2: %d)", recorded, len(versions))
+	}
+}
+
+func TestOnceMutes(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reads int
+	red := &rdt.Reader{MockName: "red", Pinged: true, MockMapper: datatype.DefaultMapper()}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		reads++
+		return &reader.Result{
+			ID:      job.ID(),
+			Content: []byte(`{"lucifer":666}`),
+			Mapper:  red.Mapper(),
+		}, nil
+	}
+	recorded := make(map[string]int)
+	newRecorder := func(name string) *rct.Recorder {
+		return &rct.Recorder{
+			MockName: name,
+			Pinged:   true,
+			RecordFunc: func(context.Context, recorder.Job) error {
+				recorded[name]++
+				return nil
+			},
+		}
+	}
+	always, err := mute.ParseSchedule("00:00-24:00 UTC daily")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(tools.DiscardLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(newRecorder("rec1"), newRecorder("rec2")),
+		engine.WithMutes(map[string]mute.Schedule{"rec1": always}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = engine.Once(e); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	if reads != 3 {
+		t.Errorf("reads = (%d); want (3): the reader is not muted", reads)
+	}
+	if recorded["rec1"] != 0 || recorded["rec2"] != 3 {
+		t.Errorf("recorded = (%v); want (rec1: 0, rec2: 3)", recorded)
+	}
+}
+
+func TestOnceFallbacks(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{MockName: "red", Pinged: true, MockMapper: datatype.DefaultMapper()}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{ID: job.ID(), Content: []byte(`{"lucifer":666}`), Mapper: red.Mapper()}, nil
+	}
+	recorded := make(map[string]int)
+	newRecorder := func(name string, pingErr error) *rct.Recorder {
+		return &rct.Recorder{
+			MockName: name,
+			PingFunc: func() error { return pingErr },
+			RecordFunc: func(context.Context, recorder.Job) error {
+				recorded[name]++
+				return nil
+			},
+		}
+	}
+	tcs := []struct {
+		pingErr error
+		want    string
+	}{
+		{nil, "primary"},
+		{errors.New("down"), "backup"},
+	}
+	for _, tc := range tcs {
+		recorded = make(map[string]int)
+		e, err := engine.New(
+			engine.WithCtx(ctx),
+			engine.WithLogger(tools.DiscardLogger()),
+			engine.WithReader(red),
+			engine.WithRecorders(newRecorder("primary", tc.pingErr), newRecorder("backup", nil)),
+			engine.WithFallbacks(map[string]string{"primary": "backup"}),
+		)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if err = engine.Once(e); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if len(recorded) != 1 || recorded[tc.want] != 1 {
+			t.Errorf("recorded = (%v); want (%s: 1)", recorded, tc.want)
+		}
+	}
+}
+
+func TestOnceProjections(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{MockName: "red", Pinged: true, MockMapper: datatype.DefaultMapper()}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:      job.ID(),
+			Content: []byte(`{"requests":10,"user":"arsham","memstats":{"Alloc":1,"Sys":2}}`),
+			Mapper:  red.Mapper(),
+		}, nil
+	}
+	var mu sync.Mutex
+	docs := make(map[string]string)
+	newRecorder := func(name string) *rct.Recorder {
+		return &rct.Recorder{
+			MockName: name,
+			Pinged:   true,
+			RecordFunc: func(_ context.Context, job recorder.Job) error {
+				buf := new(bytes.Buffer)
+				job.Payload.Generate(buf, job.Time)
+				mu.Lock()
+				docs[name] = buf.String()
+				mu.Unlock()
+				return nil
+			},
+		}
+	}
+	p, err := datatype.NewProjection([]string{"requests", "memstats.Alloc"})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(tools.DiscardLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(newRecorder("billing"), newRecorder("all")),
+		engine.WithProjections(map[string]*datatype.Projection{"billing": p}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = engine.Once(e); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for _, s := range []string{`"requests":`, `"memstats.Alloc":`} {
+		if !strings.Contains(docs["billing"], s) {
+			t.Errorf("expected (%s) in (%s)", s, docs["billing"])
+		}
+	}
+	for _, s := range []string{`"user":`, `"memstats.Sys":`} {
+		if strings.Contains(docs["billing"], s) {
+			t.Errorf("unexpected (%s) in (%s)", s, docs["billing"])
+		}
+		if !strings.Contains(docs["all"], s) {
+			t.Errorf("expected (%s) in (%s)", s, docs["all"])
+		}
+	}
+}
+
+// releaser is a recorder that does not keep the payloads.
+type releaser struct{ *rct.Recorder }
+
+func (releaser) ReleasePayloads() bool { return true }
+
+func TestOnceReleasePayloads(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{MockName: "red", Pinged: true, MockMapper: datatype.DefaultMapper()}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:      job.ID(),
+			Content: []byte(`{"lucifer":666}`),
+			Mapper:  red.Mapper(),
+		}, nil
+	}
+	payloads := make(map[string]datatype.DataContainer)
+	newRecorder := func(name string) *rct.Recorder {
+		return &rct.Recorder{
+			MockName: name,
+			Pinged:   true,
+			RecordFunc: func(_ context.Context, job recorder.Job) error {
+				if job.Payload.Len() != 1 {
+					t.Errorf("%s: job.Payload.Len() = (%d); want (1)", name, job.Payload.Len())
+				}
+				payloads[name] = job.Payload
+				return nil
+			},
+		}
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(tools.DiscardLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(newRecorder("rec1"), releaser{newRecorder("rec2")}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = engine.Once(e); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	// The recorders are called in order, therefore the released payload of
+	// rec2 is not taken from the pool again.
+	if l := payloads["rec1"].Len(); l != 1 {
+		t.Errorf("rec1: payload.Len() = (%d); want (1): the payload should be kept", l)
+	}
+	if l := payloads["rec2"].Len(); l != 0 {
+		t.Errorf("rec2: payload.Len() = (%d); want (0): the payload should be released", l)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import "expvar"
+
+var pausedJobs = expvar.NewMap("Paused Jobs")
+
+// Pause stops the Scheduler from issuing new read jobs, for example during the
+// maintenance windows of the recorders. The jobs that are already running and
+// the buffered results are still recorded, and the readers and recorders keep
+// their state and connections. The Engines that are due while the Scheduler
+// is paused are read on their next intervals after Resume. It returns false if
+// the Scheduler was already paused.
+func (s *Scheduler) Pause() bool {
+	return s.setPaused(true)
+}
+
+// Resume lets the Scheduler issue the read jobs again. It returns false if it
+// was not paused.
+func (s *Scheduler) Resume() bool {
+	return s.setPaused(false)
+}
+
+// Paused returns true if the Scheduler is paused.
+func (s *Scheduler) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func (s *Scheduler) setPaused(paused bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused == paused {
+		return false
+	}
+	s.paused = paused
+	board.setPaused(paused)
+	if paused {
+		recordEvent(Event{Kind: EventPaused})
+	} else {
+		recordEvent(Event{Kind: EventResumed})
+	}
+	return true
+}
+
+// Pause pauses the Scheduler of the Service, see Scheduler.Pause. The
+// Scheduler starts paused if the Service is not started yet. It returns false
+// if the Service was already paused.
+func (s *Service) Pause() bool {
+	return s.setPaused(true)
+}
+
+// Resume resumes the Scheduler of the Service. It returns false if the Service
+// was not paused.
+func (s *Service) Resume() bool {
+	return s.setPaused(false)
+}
+
+// Paused returns true if the Service is paused.
+func (s *Service) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func (s *Service) setPaused(paused bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused == paused {
+		return false
+	}
+	s.paused = paused
+	if s.sched != nil {
+		s.sched.setPaused(paused)
+	}
+	return true
+}
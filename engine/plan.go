@@ -0,0 +1,98 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// EnginePlan is the Engine the Service would create for a reader.
+type EnginePlan struct {
+	Reader   string
+	Endpoint string
+
+	// Recorders are the reachable recorders the Engine would ship to.
+	Recorders []string
+
+	// Unreachable holds the ping errors of the reader and the recorders.
+	Unreachable map[string]error
+
+	// Owner is the instance that owns the reader in the cluster. It is empty
+	// if the Service is not running in a cluster.
+	Owner string
+}
+
+// Runs returns true if the Service would start the Engine on this instance
+// without quarantining the reader.
+func (p EnginePlan) Runs(self string) bool {
+	if p.Owner != "" && p.Owner != self {
+		return false
+	}
+	_, down := p.Unreachable[p.Reader]
+	return !down && len(p.Recorders) > 0
+}
+
+// Plan pings the readers and recorders of the routes and returns the Engines
+// the Service would create, sorted by the reader names. Nothing is read or
+// recorded, and the readers owned by other instances of the cluster are not
+// pinged.
+func (s *Service) Plan() ([]EnginePlan, error) {
+	if s.Conf == nil {
+		return nil, errors.New("confMap cannot be nil")
+	}
+	ring, err := s.ring()
+	if err != nil {
+		return nil, err
+	}
+	readers := make([]string, 0, len(s.Conf.Routes))
+	for reader := range s.Conf.Routes {
+		readers = append(readers, reader)
+	}
+	sort.Strings(readers)
+
+	pinged := make(map[string]error)
+	plans := make([]EnginePlan, 0, len(readers))
+	for _, reader := range readers {
+		p := EnginePlan{Reader: reader, Unreachable: make(map[string]error)}
+		if ring != nil {
+			p.Owner = ring.Owner(reader)
+			if p.Owner != s.Conf.Settings.Cluster.Self {
+				plans = append(plans, p)
+				continue
+			}
+		}
+		red := s.Conf.Readers[reader]
+		if red == nil {
+			p.Unreachable[reader] = errors.New("empty reader")
+			plans = append(plans, p)
+			continue
+		}
+		p.Endpoint = red.Endpoint()
+		if err := red.Ping(); err != nil {
+			p.Unreachable[reader] = err
+		}
+		for _, name := range s.Conf.Routes[reader] {
+			rec, ok := s.Conf.Recorders[name]
+			if !ok {
+				continue
+			}
+			err, ok := pinged[name]
+			if !ok {
+				err = rec.Ping()
+				pinged[name] = err
+			}
+			if err != nil {
+				p.Unreachable[name] = err
+				continue
+			}
+			p.Recorders = append(p.Recorders, name)
+		}
+		sort.Strings(p.Recorders)
+		plans = append(plans, p)
+	}
+	return plans, nil
+}
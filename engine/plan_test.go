@@ -0,0 +1,125 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine_test
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alext234/expipe/engine"
+	"github.com/alext234/expipe/reader"
+	rdt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/recorder"
+	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/tools/config"
+)
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+	var pings int32
+	up := func() error { atomic.AddInt32(&pings, 1); return nil }
+	down := func() error { atomic.AddInt32(&pings, 1); return errExample }
+	confMap := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": &rdt.Reader{MockName: "red1", MockEndpoint: "http://red1", PingFunc: up},
+			"red2": &rdt.Reader{MockName: "red2", MockEndpoint: "http://red2", PingFunc: down},
+			"red3": &rdt.Reader{MockName: "red3", MockEndpoint: "http://red3", PingFunc: up},
+		},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": &rct.Recorder{MockName: "rec1", PingFunc: up},
+			"rec2": &rct.Recorder{MockName: "rec2", PingFunc: down},
+		},
+		Routes: map[string][]string{
+			"red1": {"rec2", "rec1"},
+			"red2": {"rec1"},
+			"red3": {"rec2"},
+		},
+	}
+	s := &engine.Service{Log: newFakeLogger(), Ctx: context.Background(), Conf: confMap}
+	plans, err := s.Plan()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(plans) != 3 {
+		t.Fatalf("len(plans) = (%d); want (3)", len(plans))
+	}
+	tcs := []struct {
+		reader      string
+		recorders   []string
+		unreachable []string
+		runs        bool
+	}{
+		{"red1", []string{"rec1"}, []string{"rec2"}, true},
+		{"red2", []string{"rec1"}, []string{"red2"}, false},
+		{"red3", nil, []string{"rec2"}, false},
+	}
+	for i, tc := range tcs {
+		p := plans[i]
+		if p.Reader != tc.reader {
+			t.Errorf("plans[%d].Reader = (%s); want (%s)", i, p.Reader, tc.reader)
+			continue
+		}
+		if p.Endpoint != "http://"+tc.reader {
+			t.Errorf("%s: Endpoint = (%s); want (http://%s)", tc.reader, p.Endpoint, tc.reader)
+		}
+		if !reflect.DeepEqual(p.Recorders, tc.recorders) {
+			t.Errorf("%s: Recorders = (%v); want (%v)", tc.reader, p.Recorders, tc.recorders)
+		}
+		if len(p.Unreachable) != len(tc.unreachable) {
+			t.Errorf("%s: Unreachable = (%v); want (%v)", tc.reader, p.Unreachable, tc.unreachable)
+		}
+		for _, name := range tc.unreachable {
+			if p.Unreachable[name] != errExample {
+				t.Errorf("%s: Unreachable[%s] = (%v); want (%v)", tc.reader, name, p.Unreachable[name], errExample)
+			}
+		}
+		if p.Runs("") != tc.runs {
+			t.Errorf("%s: Runs() = (%t); want (%t)", tc.reader, p.Runs(""), tc.runs)
+		}
+	}
+	// each endpoint is pinged once.
+	if n := atomic.LoadInt32(&pings); n != 5 {
+		t.Errorf("pings = (%d); want (5)", n)
+	}
+}
+
+func TestPlanCluster(t *testing.T) {
+	t.Parallel()
+	var pings int32
+	confMap := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": &rdt.Reader{MockName: "red1", PingFunc: func() error { atomic.AddInt32(&pings, 1); return nil }},
+		},
+		Recorders: map[string]recorder.DataRecorder{"rec1": &rct.Recorder{MockName: "rec1", Pinged: true}},
+		Routes:    map[string][]string{"red1": {"rec1"}},
+	}
+	var owner string
+	for _, self := range []string{"node1", "node2"} {
+		conf := *confMap
+		conf.Settings.Cluster = config.Cluster{Self: self, Peers: []string{"node1", "node2"}}
+		s := &engine.Service{Log: newFakeLogger(), Ctx: context.Background(), Conf: &conf}
+		plans, err := s.Plan()
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if plans[0].Runs(self) {
+			owner = self
+		} else if plans[0].Owner == self {
+			t.Errorf("%s: Runs() = (false); want (true)", self)
+		}
+	}
+	if owner == "" {
+		t.Error("the reader is not run by any instances")
+	}
+	if n := atomic.LoadInt32(&pings); n != 1 {
+		t.Errorf("pings = (%d); want (1)", n)
+	}
+
+	if _, err := (&engine.Service{}).Plan(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
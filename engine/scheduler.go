@@ -0,0 +1,805 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools/alert"
+	"github.com/alext234/expipe/tools/condition"
+	"github.com/alext234/expipe/tools/drift"
+	"github.com/alext234/expipe/tools/mute"
+	"github.com/alext234/expipe/tools/sample"
+	"github.com/alext234/expipe/tools/tenant"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/alext234/expipe/tools/trace"
+	"github.com/pkg/errors"
+)
+
+// defaultWorkers is used when the number of workers is not positive.
+const defaultWorkers = 10
+
+// DefaultGracePeriod is the time the readers and recorders are given after
+// their timeouts when the grace period is not set.
+const DefaultGracePeriod = 10 * time.Second
+
+// Scheduler runs multiple Engines on one timer loop and two shared pools of
+// workers; one for reading and one for recording. Adding an Engine to the
+// Scheduler does not create any long running goroutines, therefore the cost of
+// having a large number of routes stays low. The Scheduler stops all its
+// Engines when its context is cancelled.
+//
+// If the flush interval is set, the results of all Engines that are destined
+// to the same recorder are coalesced and are shipped as one batch on every
+// flush interval. Recorders that implement the recorder.BatchRecorder
+// interface receive the whole batch in one call.
+//
+// Each read and record job is cancelled after the timeout of its reader or
+// recorder and the grace period, therefore a slow endpoint does not hold on to
+// a worker for longer than that.
+//
+// If the shedding is set, the Engines are not read while the process is
+// overloaded, and they are read again on their next intervals. The same goes
+// for when the Scheduler is paused, see Pause, and for the Engines of the
+// recorders that hold too many results, see WithMaxUnacked.
+//
+// If an alert.Dispatcher is set, the operators are notified when the readers
+// or recorders keep failing. See WithRecorderFailure for what happens to the
+// results of the failing recorders, and WithDelivery for holding them until
+// they are recorded.
+type Scheduler struct {
+	ctx        context.Context
+	workers    int
+	flush      time.Duration
+	grace      time.Duration
+	alerts     *alert.Dispatcher
+	once       sync.Once
+	add        chan *schedule
+	remove     chan *schedule
+	reschedule chan *schedule
+	reads      chan *schedule
+	records    chan recordJob
+	batches    chan []recordJob
+	mu         sync.Mutex
+	pending    map[recorder.DataRecorder][]recordJob // guarded by mu.
+	paused     bool                                  // guarded by mu.
+	failure    recorderFailure
+	skew       clockSkew
+	overloaded func() bool
+	atLeast    bool // at least once delivery.
+	annotate   bool // read annotations.
+	maxUnacked int
+	ackMu      sync.Mutex
+	unacked    map[string]int // guarded by ackMu.
+}
+
+// schedule is an Engine's slot in the Scheduler's queue.
+type schedule struct {
+	engine  Engine
+	next    time.Time
+	stop    chan struct{}
+	index   int // index in the queue, -1 when it is not queued.
+	removed bool
+}
+
+// recordJob is a result that is destined for a recorder. The ctx carries the
+// span of the read job. The annotations are nil unless the Scheduler has the
+// read annotations.
+type recordJob struct {
+	ctx         context.Context
+	engine      Engine
+	rec         recorder.DataRecorder
+	result      *reader.Result
+	annotations *readAnnotations
+}
+
+// NewScheduler returns a Scheduler that runs workers goroutines for each of
+// its pools. It uses defaultWorkers if workers is not positive.
+func NewScheduler(ctx context.Context, workers int, options ...func(*Scheduler)) *Scheduler {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	s := &Scheduler{
+		ctx:        ctx,
+		workers:    workers,
+		grace:      DefaultGracePeriod,
+		add:        make(chan *schedule),
+		remove:     make(chan *schedule),
+		reschedule: make(chan *schedule),
+		reads:      make(chan *schedule),
+		records:    make(chan recordJob, workers*chanBuffer),
+		batches:    make(chan []recordJob, workers),
+		pending:    make(map[recorder.DataRecorder][]recordJob),
+		maxUnacked: DefaultMaxUnackedJobs,
+		unacked:    make(map[string]int),
+		failure: recorderFailure{
+			threshold: alert.DefaultThreshold,
+			down:      make(map[string]bool),
+			buffered:  make(map[string][]recordJob),
+		},
+		skew: clockSkew{
+			threshold: DefaultClockSkewThreshold,
+			skewed:    make(map[string]bool),
+		},
+	}
+	for _, op := range options {
+		op(s)
+	}
+	return s
+}
+
+// WithFlushInterval batches the results for each recorder and ships them on
+// every interval. Batching is disabled if the interval is not positive.
+func WithFlushInterval(interval time.Duration) func(*Scheduler) {
+	return func(s *Scheduler) {
+		s.flush = interval
+	}
+}
+
+// WithGracePeriod sets the time the readers and recorders are given after
+// their timeouts before their jobs are cancelled. DefaultGracePeriod is used
+// if the grace is not positive.
+func WithGracePeriod(grace time.Duration) func(*Scheduler) {
+	return func(s *Scheduler) {
+		if grace > 0 {
+			s.grace = grace
+		}
+	}
+}
+
+// WithAlerts sends the failing and recovered events of the readers and
+// recorders to the d.
+func WithAlerts(d *alert.Dispatcher) func(*Scheduler) {
+	return func(s *Scheduler) {
+		s.alerts = d
+	}
+}
+
+// WithShedding skips the read jobs while the overloaded returns true, for
+// example with limits.Overloaded when the memory is close to its limit.
+func WithShedding(overloaded func() bool) func(*Scheduler) {
+	return func(s *Scheduler) {
+		s.overloaded = overloaded
+	}
+}
+
+// Start schedules the Engine to be read on its reader's interval. The first
+// read is after the first interval, or right away if the Engine scrapes on
+// start. The returned channel is closed when the Engine's or the Scheduler's
+// context is done.
+func (s *Scheduler) Start(e Engine) chan struct{} {
+	s.once.Do(s.run)
+	sc := &schedule{
+		engine: e,
+		next:   time.Now().Add(e.Reader().Interval()),
+		stop:   make(chan struct{}),
+		index:  -1,
+	}
+	if r, ok := e.(readerStarter); ok && r.ScrapeOnStart() {
+		sc.next = time.Now()
+	}
+	s.failure.watch(e.Recorders())
+	select {
+	case s.add <- sc:
+	case <-s.ctx.Done():
+		close(sc.stop)
+		return sc.stop
+	}
+	go func() {
+		select {
+		case <-e.Ctx().Done():
+			select {
+			case s.remove <- sc:
+			case <-s.ctx.Done():
+			}
+		case <-sc.stop:
+		}
+	}()
+	return sc.stop
+}
+
+func (s *Scheduler) run() {
+	startSampler()
+	for i := 0; i < s.workers; i++ {
+		go s.readWorker()
+		go s.recordWorker()
+	}
+	if s.flush > 0 {
+		go s.flushLoop()
+	}
+	go s.loop()
+}
+
+// loop hands over the Engines to the read workers when they are due. It is
+// the only goroutine that touches the queue. The active map holds the Engines
+// that are either queued or being read.
+func (s *Scheduler) loop() {
+	var queue scheduleQueue
+	active := make(map[*schedule]struct{})
+	for {
+		var (
+			head  *schedule
+			reads chan *schedule
+			due   <-chan time.Time
+			timer *time.Timer
+		)
+		if queue.Len() > 0 {
+			head = queue[0]
+			if d := head.next.Sub(time.Now()); d > 0 {
+				timer = time.NewTimer(d)
+				due = timer.C
+			} else {
+				reads = s.reads
+			}
+		}
+		select {
+		case sc := <-s.add:
+			active[sc] = struct{}{}
+			heap.Push(&queue, sc)
+		case sc := <-s.reschedule:
+			if !sc.removed {
+				sc.next = time.Now().Add(sc.engine.Reader().Interval())
+				heap.Push(&queue, sc)
+			}
+		case sc := <-s.remove:
+			if sc.index >= 0 {
+				heap.Remove(&queue, sc.index)
+			}
+			sc.removed = true
+			delete(active, sc)
+			close(sc.stop)
+		case reads <- head:
+			heap.Pop(&queue)
+		case <-due:
+		case <-s.ctx.Done():
+			for sc := range active {
+				close(sc.stop)
+			}
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (s *Scheduler) readWorker() {
+	for {
+		select {
+		case sc := <-s.reads:
+			s.read(sc.engine, sc.next)
+			select {
+			case s.reschedule <- sc:
+			case <-s.ctx.Done():
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// read reads from the Engine's reader and queues a record job for each of its
+// recorders. The due is the time the read was scheduled for.
+func (s *Scheduler) read(e Engine, due time.Time) {
+	if e.Ctx().Err() != nil {
+		return
+	}
+	if s.Paused() {
+		pausedJobs.Add(e.Reader().Name(), 1)
+		e.Log().Debugf("read job of %s is skipped: paused", e.Reader().Name())
+		return
+	}
+	if readerMuteOf(e).Active(time.Now()) {
+		mutedReads.Add(e.Reader().Name(), 1)
+		e.Log().Debugf("read job of %s is skipped: in its maintenance window", e.Reader().Name())
+		return
+	}
+	if s.overloaded != nil && s.overloaded() {
+		shedJobs.Add(e.Reader().Name(), 1)
+		e.Log().Debugf("read job of %s is shed: overloaded", e.Reader().Name())
+		return
+	}
+	if s.throttled(e) {
+		throttledReads.Add(e.Reader().Name(), 1)
+		e.Log().Debugf("read job of %s is skipped: a recorder holds %d unacked results", e.Reader().Name(), s.maxUnacked)
+		return
+	}
+	waitingReadJobs.Add(1)
+	defer waitingReadJobs.Add(-1)
+	ctx, span := trace.Start(e.Ctx(), "read")
+	defer span.End()
+	readCtx, cancel := withDeadline(ctx, e.Reader().Timeout(), s.grace)
+	defer cancel()
+	job := token.New(readCtx)
+	name := e.Reader().Name()
+	span.SetAttribute("reader", name)
+	span.SetAttribute("job_id", job.ID().String())
+	start := time.Now()
+	res, err := e.Reader().Read(job)
+	took := time.Since(start)
+	readDuration.With(name).ObserveDuration(took)
+	if errors.Cause(err) == reader.ErrDropped {
+		e.Log().Debugf("read job: %v", err)
+		return
+	}
+	if errors.Cause(err) != nil {
+		span.SetError(err)
+		erroredJobs.Add(1)
+		readerErrors.Add(name, 1)
+		s.readResult(name, took, err)
+		e.Log().Errorf("read job: %v", err)
+		return
+	}
+	if res == nil || res.Content == nil {
+		erroredJobs.Add(1)
+		readerErrors.Add(name, 1)
+		s.readResult(name, took, errEmptyResult)
+		e.Log().Errorf("read job: %v", errEmptyResult)
+		return
+	}
+	s.readResult(name, took, nil)
+	res.TypeName = reader.ExpandTypeName(res.TypeName, name, e.Reader().Endpoint(), res.Content)
+	readJobs.Add(1)
+	readerJobs.Add(name, 1)
+	payloadSize.With(name).Observe(float64(len(res.Content)))
+	lastReadSuccess.Set(name, time.Now().Unix())
+	if d := driftOf(e); d != nil {
+		if changes, ok := d.Check(res.Content); ok {
+			schemaDrifts.Add(name, 1)
+			e.Log().Warnf("schema of %s has drifted: %s", name, changes)
+		}
+	}
+	var annotations *readAnnotations
+	if s.annotate {
+		annotations = newReadAnnotations(due, start, took)
+	}
+	if s.flush > 0 {
+		s.mu.Lock()
+		for _, rec := range e.Recorders() {
+			if onStandby(e, rec, s.failure.isDown) || !admit(e, rec, res) {
+				continue
+			}
+			s.pending[rec] = append(s.pending[rec], recordJob{ctx: ctx, engine: e, rec: rec, result: res, annotations: annotations})
+			pendingBatchJobs.Add(1)
+			s.hold(rec.Name(), 1)
+		}
+		s.mu.Unlock()
+		return
+	}
+	for _, rec := range e.Recorders() {
+		if onStandby(e, rec, s.failure.isDown) || !admit(e, rec, res) {
+			continue
+		}
+		select {
+		case s.records <- recordJob{ctx: ctx, engine: e, rec: rec, result: res, annotations: annotations}:
+			recordQueue.Add(1)
+			s.hold(rec.Name(), 1)
+		case <-e.Ctx().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Scheduler) recordWorker() {
+	for {
+		select {
+		case job := <-s.records:
+			recordQueue.Add(-1)
+			s.record(job)
+		case batch := <-s.batches:
+			s.recordBatch(batch)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// flushLoop ships the pending results to the record workers on every flush
+// interval.
+func (s *Scheduler) flushLoop() {
+	ticker := time.NewTicker(s.flush)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			pending := s.pending
+			s.pending = make(map[recorder.DataRecorder][]recordJob, len(pending))
+			s.mu.Unlock()
+			for _, batch := range pending {
+				pendingBatchJobs.Add(-int64(len(batch)))
+				select {
+				case s.batches <- batch:
+				case <-s.ctx.Done():
+					return
+				}
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// recordBatch records all jobs of the batch. All jobs have the same recorder.
+// It records them one by one if the recorder is not a recorder.BatchRecorder.
+// Only the jobs of the Retry of a recorder.BatchError are buffered. The span of
+// the batch is a child of the span of the first read job and is linked to the
+// spans of the others, but the batch is not cancelled with the Engine of the
+// first job.
+func (s *Scheduler) recordBatch(batch []recordJob) {
+	br, ok := batch[0].rec.(recorder.BatchRecorder)
+	if !ok {
+		for _, r := range batch {
+			s.record(r)
+		}
+		return
+	}
+	name := batch[0].rec.Name()
+	jobs := make([]recorder.Job, 0, len(batch))
+	sent := make([]recordJob, 0, len(batch))
+	for _, r := range batch {
+		if r.engine.Ctx().Err() != nil {
+			s.ack(name, 1)
+			continue
+		}
+		job, err := newJob(r)
+		if err != nil {
+			r.engine.Log().Errorf("error in payload: %s", err)
+			s.ack(name, 1)
+			continue
+		}
+		jobs = append(jobs, job)
+		sent = append(sent, r)
+	}
+	if len(jobs) == 0 {
+		return
+	}
+	waitingRecordJobs.Add(int64(len(jobs)))
+	defer waitingRecordJobs.Add(-int64(len(jobs)))
+	links := make([]context.Context, 0, len(sent)-1)
+	for _, r := range sent[1:] {
+		links = append(links, r.context())
+	}
+	ctx, span := trace.Start(trace.WithSpan(s.ctx, sent[0].context()), "record_batch", links...)
+	defer span.End()
+	ctx, cancel := withDeadline(ctx, br.Timeout(), s.grace)
+	defer cancel()
+	span.SetAttribute("recorder", name)
+	span.SetAttribute("jobs", strconv.Itoa(len(jobs)))
+	start := time.Now()
+	err := br.RecordBatch(ctx, jobs)
+	took := time.Since(start)
+	for _, job := range jobs {
+		release(br, job.Payload)
+	}
+	flushDuration.ObserveDuration(took)
+	flushLatency.With(name).ObserveDuration(took)
+	flushDocuments.With(name).Observe(float64(len(jobs)))
+	recordDuration.With(name).ObserveDuration(took)
+	s.recordResult(name, took, err)
+	if err != nil {
+		span.SetError(err)
+		recorderErrors.Add(name, 1)
+		batch[0].engine.Log().Errorf("record batch error: %v", err)
+		if be, ok := errors.Cause(err).(recorder.BatchError); ok {
+			retry := make([]recordJob, 0, len(be.Retry))
+			for _, i := range be.Retry {
+				if i >= 0 && i < len(sent) {
+					retry = append(retry, sent[i])
+				}
+			}
+			s.ack(name, len(sent)-len(retry))
+			sent = retry
+		}
+		s.buffer(sent...)
+		return
+	}
+	s.ack(name, len(jobs))
+	s.retryBuffered(name)
+	recordJobs.Add(int64(len(jobs)))
+	recorderJobs.Add(name, int64(len(jobs)))
+	lastRecordSuccess.Set(name, time.Now().Unix())
+	s.checkSkew(br, batch[0].engine.Log())
+}
+
+func (s *Scheduler) record(r recordJob) {
+	log := r.engine.Log()
+	if r.engine.Ctx().Err() != nil {
+		s.ack(r.rec.Name(), 1)
+		return
+	}
+	job, err := newJob(r)
+	if err != nil {
+		log.Errorf("error in payload: %s", err)
+		s.ack(r.rec.Name(), 1)
+		return
+	}
+	waitingRecordJobs.Add(1)
+	defer waitingRecordJobs.Add(-1)
+	ctx, span := trace.Start(r.context(), "record")
+	defer span.End()
+	ctx, cancel := withDeadline(ctx, r.rec.Timeout(), s.grace)
+	defer cancel()
+	name := r.rec.Name()
+	span.SetAttribute("recorder", name)
+	span.SetAttribute("job_id", job.ID.String())
+	start := time.Now()
+	err = r.rec.Record(ctx, job)
+	took := time.Since(start)
+	release(r.rec, job.Payload)
+	recordDuration.With(name).ObserveDuration(took)
+	s.recordResult(name, took, err)
+	if err != nil {
+		span.SetError(err)
+		recorderErrors.Add(name, 1)
+		log.Errorf("record error: %v", err)
+		s.buffer(r)
+		return
+	}
+	s.ack(name, 1)
+	s.retryBuffered(name)
+	recordJobs.Add(1)
+	recorderJobs.Add(name, 1)
+	lastRecordSuccess.Set(name, time.Now().Unix())
+	s.checkSkew(r.rec, log)
+}
+
+// readResult records the outcome of a read job on the status board and sends
+// the alerts if the reader is failing or has recovered.
+func (s *Scheduler) readResult(name string, took time.Duration, err error) {
+	prev, streak := board.reader(name, took, err)
+	s.alerts.Result("reader", name, prev, streak, err)
+}
+
+// recordResult is the readResult of the recorders.
+func (s *Scheduler) recordResult(name string, took time.Duration, err error) {
+	prev, streak := board.recorder(name, took, err)
+	s.alerts.Result("recorder", name, prev, streak, err)
+	s.failure.result(name, streak)
+}
+
+// context returns the context of the read job, or the Engine's context if it
+// is not set.
+func (r recordJob) context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return r.engine.Ctx()
+}
+
+// withDeadline returns a copy of the ctx that is cancelled after the timeout
+// and the grace. The ctx is not given a deadline if the timeout is not
+// positive.
+func withDeadline(ctx context.Context, timeout, grace time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout+grace)
+}
+
+// newJob converts the result to a recorder.Job. The Content of the result is
+// shared between the recorders, it is only read while decoding. The result is
+// mapped with the mapper of the recorder's route if the Engine has one. The
+// labels of the result are set on the payload. If the recorder records for a
+// tenant, the payload is labelled with the tenant and the index name gets its
+// prefix. If the recorder has a projection, only its fields are kept. The
+// read annotations are added after the projection.
+func newJob(r recordJob) (recorder.Job, error) {
+	_, span := trace.Start(r.context(), "map")
+	defer span.End()
+	mapper := r.result.Mapper
+	if e, ok := r.engine.(routeMapper); ok {
+		if m, ok := e.Mappers()[r.rec.Name()]; ok {
+			mapper = m
+		}
+	}
+	payload, err := datatype.JobResultDataTypes(r.result.Content, mapper.Copy())
+	if err != nil {
+		span.SetError(err)
+		return recorder.Job{}, err
+	}
+	if p := projectionOf(r.engine, r.rec); p != nil {
+		p.Apply(payload)
+	}
+	r.annotations.apply(payload)
+	labels := r.result.Labels
+	indexName := r.rec.IndexName()
+	if t := tenantOf(r.engine, r.rec); t != nil {
+		labels = tenantLabels(labels, t.ID)
+		indexName = t.IndexName(indexName)
+	}
+	if c, ok := payload.(*datatype.Container); ok && len(labels) > 0 {
+		c.SetLabels(labels)
+	}
+	job := recorder.Job{
+		ID:        r.result.ID,
+		Payload:   payload,
+		IndexName: indexName,
+		TypeName:  r.result.TypeName,
+		Time:      r.result.Time,
+	}
+	if red := r.engine.Reader(); red != nil {
+		job.Reader = red.Name()
+	}
+	return job, nil
+}
+
+// release puts the payload back in the pools of the datatype package if the
+// rec does not keep it. The failed jobs are still retried, as their payloads
+// are decoded again from the results.
+func release(rec recorder.DataRecorder, payload datatype.DataContainer) {
+	if r, ok := rec.(recorder.PayloadReleaser); ok && r.ReleasePayloads() {
+		datatype.Release(payload)
+	}
+}
+
+// tenantOf returns the tenant the Engine records the results of the rec for,
+// or nil if there is none.
+func tenantOf(e Engine, rec recorder.DataRecorder) *tenant.Tenant {
+	if t, ok := e.(routeTenant); ok {
+		return t.Tenants()[rec.Name()]
+	}
+	return nil
+}
+
+// projectionOf returns the allowed fields of the rec, or nil if all of them
+// are recorded.
+func projectionOf(e Engine, rec recorder.DataRecorder) *datatype.Projection {
+	if p, ok := e.(recorderProjection); ok {
+		return p.Projections()[rec.Name()]
+	}
+	return nil
+}
+
+// samplerOf returns the sampler of the results the Engine records into the
+// rec, or nil if all of them are recorded.
+func samplerOf(e Engine, rec recorder.DataRecorder) *sample.Sampler {
+	if s, ok := e.(routeSampler); ok {
+		return s.Samples()[rec.Name()]
+	}
+	return nil
+}
+
+// conditionOf returns the condition of the results the Engine records into the
+// rec, or nil if all of them are recorded.
+func conditionOf(e Engine, rec recorder.DataRecorder) *condition.Condition {
+	if c, ok := e.(routeCondition); ok {
+		return c.Conditions()[rec.Name()]
+	}
+	return nil
+}
+
+// muteOf returns the maintenance windows of the route of the Engine into the
+// rec, or nil if it has none.
+func muteOf(e Engine, rec recorder.DataRecorder) mute.Schedule {
+	if m, ok := e.(routeMute); ok {
+		return m.Mutes()[rec.Name()]
+	}
+	return nil
+}
+
+// readerMuteOf returns the maintenance windows of the reader of the Engine, or
+// nil if it has none.
+func readerMuteOf(e Engine) mute.Schedule {
+	if m, ok := e.(readerMuter); ok {
+		return m.ReaderMute()
+	}
+	return nil
+}
+
+// driftOf returns the schema drift detector of the reader of the Engine, or
+// nil if it has none.
+func driftOf(e Engine) *drift.Detector {
+	if d, ok := e.(readerDrifter); ok {
+		return d.Drift()
+	}
+	return nil
+}
+
+// onStandby returns true if the rec is the fallback of the recorders of the
+// Engine and none of them are down, therefore the results are not recorded
+// into it. The down returns true if a recorder is down. The primaries that
+// could not join the Engine are down.
+func onStandby(e Engine, rec recorder.DataRecorder, down func(string) bool) bool {
+	f, ok := e.(routeFallback)
+	if !ok {
+		return false
+	}
+	fallback := false
+	for primary, name := range f.Fallbacks() {
+		if name != rec.Name() {
+			continue
+		}
+		fallback = true
+		if _, joined := e.Recorders()[primary]; !joined || down(primary) {
+			failoverJobs.Add(name, 1)
+			return false
+		}
+	}
+	return fallback
+}
+
+// admit returns false if the route of the rec is in its maintenance window, if
+// the result is not in the sample of the rec, if it does not match the
+// condition of the rec, or if recording it into the rec exceeds the quotas of
+// its tenant. The results that are not sampled are not
+// checked against the condition, and the results that are not admitted for
+// either of them are not counted against the quotas. The size of the content
+// of the result is counted against the byte quota. The first dropped result of
+// each period is logged.
+func admit(e Engine, rec recorder.DataRecorder, res *reader.Result) bool {
+	if muteOf(e, rec).Active(time.Now()) {
+		mutedRecords.Add(rec.Name(), 1)
+		return false
+	}
+	if s := samplerOf(e, rec); s != nil && !s.Sample() {
+		sampledOutJobs.Add(rec.Name(), 1)
+		return false
+	}
+	if c := conditionOf(e, rec); c != nil && !c.Match(res.Content) {
+		unchangedJobs.Add(rec.Name(), 1)
+		return false
+	}
+	t := tenantOf(e, rec)
+	if t == nil {
+		return true
+	}
+	ok, first := t.Allow(int64(len(res.Content)))
+	if ok {
+		return true
+	}
+	tenantDropped.Add(t.ID, 1)
+	if first {
+		e.Log().Warnf("tenant %s has exceeded its quota, its documents are dropped until the next period", t.ID)
+	}
+	return false
+}
+
+// tenantLabels returns a copy of the labels with the tenant label.
+func tenantLabels(labels datatype.Labels, id string) datatype.Labels {
+	result := make(datatype.Labels, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[tenant.Label] = id
+	return result
+}
+
+// scheduleQueue is a min-heap of schedules ordered by their next run.
+type scheduleQueue []*schedule
+
+func (q scheduleQueue) Len() int           { return len(q) }
+func (q scheduleQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q scheduleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *scheduleQueue) Push(x interface{}) {
+	sc := x.(*schedule)
+	sc.index = len(*q)
+	*q = append(*q, sc)
+}
+
+func (q *scheduleQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	sc := old[n-1]
+	old[n-1] = nil
+	sc.index = -1
+	*q = old[:n-1]
+	return sc
+}
@@ -0,0 +1,1093 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine_test
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/engine"
+	"github.com/alext234/expipe/reader"
+	rdt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/recorder"
+	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/tools/alert"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/drift"
+	"github.com/alext234/expipe/tools/mute"
+	"github.com/alext234/expipe/tools/tenant"
+	"github.com/alext234/expipe/tools/token"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func newScheduledEngine(t *testing.T, ctx context.Context, name string, recorded chan string) engine.Engine {
+	red := &rdt.Reader{
+		Pinged:       true,
+		MockName:     name,
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:       job.ID(),
+			TypeName: name,
+			Content:  []byte(`{"devil":666}`),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	rec := &rct.Recorder{
+		Pinged:   true,
+		MockName: "rec_" + name,
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			select {
+			case recorded <- job.TypeName:
+			default:
+			}
+			return nil
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return e
+}
+
+func TestSchedulerRunsAllEngines(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	total := 20
+	recorded := make(chan string, total)
+	s := engine.NewScheduler(ctx, 1)
+	for i := 0; i < total; i++ {
+		s.Start(newScheduledEngine(t, ctx, fmt.Sprintf("red%d", i), recorded))
+	}
+	seen := make(map[string]bool)
+	for len(seen) < total {
+		select {
+		case name := <-recorded:
+			seen[name] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("len(seen) = (%d); want (%d)", len(seen), total)
+		}
+	}
+}
+
+func TestSchedulerStopsEngine(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan string, 10)
+	s := engine.NewScheduler(ctx, 2)
+
+	ctx1, cancel1 := context.WithCancel(ctx)
+	done1 := s.Start(newScheduledEngine(t, ctx1, "red1", recorded))
+	done2 := s.Start(newScheduledEngine(t, ctx, "red2", recorded))
+	cancel1()
+	select {
+	case <-done1:
+	case <-time.After(time.Second):
+		t.Fatal("expected the engine to stop")
+	}
+	select {
+	case <-done2:
+		t.Fatal("the other engine has stopped")
+	default:
+	}
+
+	// draining the old results.
+	time.Sleep(20 * time.Millisecond)
+	for len(recorded) > 0 {
+		<-recorded
+	}
+	select {
+	case name := <-recorded:
+		if name != "red2" {
+			t.Errorf("name = (%s); want (red2)", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("the other engine didn't record")
+	}
+
+	cancel()
+	select {
+	case <-done2:
+	case <-time.After(time.Second):
+		t.Error("expected the engine to stop with the scheduler")
+	}
+}
+
+func TestSchedulerShedding(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan string, 10)
+	var mu sync.Mutex
+	overloaded := true
+	s := engine.NewScheduler(ctx, 1, engine.WithShedding(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return overloaded
+	}))
+	s.Start(newScheduledEngine(t, ctx, "shed", recorded))
+
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-recorded:
+		t.Fatal("the engine was read while overloaded")
+	default:
+	}
+	shed := expvar.Get("Shed Jobs").(*expvar.Map).Get("shed")
+	if shed == nil || shed.(*expvar.Int).Value() == 0 {
+		t.Errorf("Shed Jobs = (%v); want (> 0)", shed)
+	}
+
+	mu.Lock()
+	overloaded = false
+	mu.Unlock()
+	select {
+	case <-recorded:
+	case <-time.After(time.Second):
+		t.Error("the engine was not read after the overload")
+	}
+}
+
+func TestSchedulerPause(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan string, 10)
+	s := engine.NewScheduler(ctx, 1)
+	if !s.Pause() || s.Pause() || !s.Paused() {
+		t.Fatal("Pause() = (false); want (true) once")
+	}
+	s.Start(newScheduledEngine(t, ctx, "paused", recorded))
+
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-recorded:
+		t.Fatal("the engine was read while paused")
+	default:
+	}
+	paused := expvar.Get("Paused Jobs").(*expvar.Map).Get("paused")
+	if paused == nil || paused.(*expvar.Int).Value() == 0 {
+		t.Errorf("Paused Jobs = (%v); want (> 0)", paused)
+	}
+
+	if !s.Resume() || s.Resume() || s.Paused() {
+		t.Fatal("Resume() = (false); want (true) once")
+	}
+	select {
+	case <-recorded:
+	case <-time.After(time.Second):
+		t.Error("the engine was not read after resuming")
+	}
+	var kinds []string
+	for _, e := range engine.Events(0) {
+		if e.Kind == engine.EventPaused || e.Kind == engine.EventResumed {
+			kinds = append(kinds, e.Kind)
+		}
+	}
+	if len(kinds) < 2 {
+		t.Errorf("events = (%v); want (paused and resumed)", kinds)
+	}
+}
+
+func TestSchedulerReaderMute(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan string, 10)
+	always, err := mute.ParseSchedule("00:00-24:00 UTC daily")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	e := newScheduledEngine(t, ctx, "muted", recorded)
+	if err = engine.WithReaderMute(always)(e); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	s := engine.NewScheduler(ctx, 1)
+	s.Start(e)
+
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-recorded:
+		t.Fatal("the engine was read in its maintenance window")
+	default:
+	}
+	muted := expvar.Get("Muted Read Jobs").(*expvar.Map).Get("muted")
+	if muted == nil || muted.(*expvar.Int).Value() == 0 {
+		t.Errorf("Muted Read Jobs = (%v); want (> 0)", muted)
+	}
+}
+
+func TestSchedulerSchemaDrift(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	contents := make(chan string, 2)
+	contents <- `{"requests":1,"errors":0}`
+	contents <- `{"requests_total":1,"errors_total":0}`
+	red := &rdt.Reader{
+		Pinged:       true,
+		MockName:     "drifting",
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		select {
+		case content := <-contents:
+			return &reader.Result{ID: job.ID(), Content: []byte(content), Mapper: red.Mapper()}, nil
+		default:
+			return nil, reader.ErrDropped
+		}
+	}
+	d, err := drift.Parse("50%")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(&rct.Recorder{Pinged: true, MockName: "rec_drifting"}),
+		engine.WithDrift(d),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	engine.NewScheduler(ctx, 1).Start(e)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		drifts := expvar.Get("Schema Drifts").(*expvar.Map).Get("drifting")
+		if drifts != nil && drifts.(*expvar.Int).Value() == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Schema Drifts = (%v); want (1)", drifts)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSchedulerScrapeOnStart(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	read := make(chan string, 2)
+	newEngine := func(name string, options ...func(engine.Engine) error) engine.Engine {
+		red := &rdt.Reader{
+			Pinged:       true,
+			MockName:     name,
+			MockInterval: time.Hour,
+			MockMapper:   datatype.DefaultMapper(),
+		}
+		red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+			read <- name
+			return nil, reader.ErrDropped
+		}
+		e, err := engine.New(append([]func(engine.Engine) error{
+			engine.WithCtx(ctx),
+			engine.WithLogger(log),
+			engine.WithReader(red),
+			engine.WithRecorders(&rct.Recorder{Pinged: true, MockName: "rec_" + name}),
+		}, options...)...)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		return e
+	}
+	s := engine.NewScheduler(ctx, 1)
+	s.Start(newEngine("warm", engine.WithScrapeOnStart()))
+	s.Start(newEngine("cold"))
+
+	select {
+	case name := <-read:
+		if name != "warm" {
+			t.Errorf("read = (%s); want (warm)", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the reader was not read on start")
+	}
+	select {
+	case name := <-read:
+		t.Errorf("read = (%s); want nothing until the first interval", name)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestSchedulerDeadlines(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timeout, grace := 50*time.Millisecond, 20*time.Millisecond
+	readErr := make(chan error, 1)
+	recDeadline := make(chan time.Duration, 1)
+	red := &rdt.Reader{
+		Pinged:       true,
+		MockName:     "slow",
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.SetTimeout(timeout)
+	var reads int
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		reads++
+		if reads == 1 {
+			// the slow read is cancelled after the timeout and the grace.
+			start := time.Now()
+			<-job.Done()
+			if took := time.Since(start); took > time.Second {
+				t.Errorf("took = (%s); want (< 1s)", took)
+			}
+			select {
+			case readErr <- job.Err():
+			default:
+			}
+			return nil, job.Err()
+		}
+		return &reader.Result{ID: job.ID(), Content: []byte(`{"devil":666}`), Mapper: red.Mapper()}, nil
+	}
+	rec := &rct.Recorder{
+		Pinged:      true,
+		MockName:    "rec",
+		MockTimeout: timeout,
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			if d, ok := ctx.Deadline(); ok {
+				select {
+				case recDeadline <- time.Until(d):
+				default:
+				}
+			}
+			return nil
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	s := engine.NewScheduler(ctx, 1, engine.WithGracePeriod(grace))
+	s.Start(e)
+
+	select {
+	case err := <-readErr:
+		if err != context.DeadlineExceeded {
+			t.Errorf("err = (%v); want (%v)", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read was not cancelled")
+	}
+	select {
+	case d := <-recDeadline:
+		if d > timeout+grace {
+			t.Errorf("deadline = (%s); want (<= %s)", d, timeout+grace)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the record did not have a deadline")
+	}
+}
+
+func TestSchedulerCancelledContext(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := engine.NewScheduler(ctx, 0)
+	done := s.Start(newScheduledEngine(t, context.Background(), "red", make(chan string)))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("expected the engine to stop")
+	}
+}
+
+type batchRecorder struct {
+	*rct.Recorder
+	batches chan []recorder.Job
+}
+
+func (b *batchRecorder) RecordBatch(ctx context.Context, jobs []recorder.Job) error {
+	b.batches <- jobs
+	return nil
+}
+
+func TestSchedulerFlushInterval(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := &batchRecorder{
+		Recorder: &rct.Recorder{MockName: "batch", Pinged: true},
+		batches:  make(chan []recorder.Job, 10),
+	}
+	s := engine.NewScheduler(ctx, 1, engine.WithFlushInterval(50*time.Millisecond))
+	for _, name := range []string{"red1", "red2"} {
+		e := newScheduledEngine(t, ctx, name, make(chan string))
+		e.SetRecorders(map[string]recorder.DataRecorder{"batch": rec})
+		s.Start(e)
+	}
+
+	seen := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for !seen["red1"] || !seen["red2"] {
+		select {
+		case jobs := <-rec.batches:
+			if len(jobs) == 0 {
+				t.Fatal("received an empty batch")
+			}
+			for _, job := range jobs {
+				seen[job.TypeName] = true
+			}
+		case <-timeout:
+			t.Fatalf("seen = (%v); want both readers in batches", seen)
+		}
+	}
+
+	// The flush metrics are observed after the batch is recorded.
+	for _, metric := range []string{"Flush Documents", "Recorder Flush Duration Seconds"} {
+		m, ok := expvar.Get(metric).(*expvar.Map)
+		if !ok {
+			t.Fatalf("%s is not published", metric)
+		}
+		for i := 0; m.Get("batch") == nil && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if m.Get("batch") == nil {
+			t.Errorf("%s has no value for (batch)", metric)
+		}
+	}
+	if got := expvar.Get("Recorder Flush Duration Seconds").(*expvar.Map).Get("batch").String(); !strings.Contains(got, `"quantiles"`) {
+		t.Errorf("Recorder Flush Duration Seconds = (%s); want quantiles", got)
+	}
+}
+
+// partialRecorder fails the first batch of more than one job, and asks for
+// its first job to be retried.
+type partialRecorder struct {
+	*rct.Recorder
+	mu     sync.Mutex
+	failed []string
+}
+
+func (p *partialRecorder) RecordBatch(ctx context.Context, jobs []recorder.Job) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed != nil || len(jobs) < 2 {
+		return nil
+	}
+	for _, job := range jobs {
+		p.failed = append(p.failed, job.ID.String())
+	}
+	return recorder.BatchError{Retry: []int{0}, Err: fmt.Errorf("boom")}
+}
+
+func TestSchedulerBatchErrorRetry(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	retried := make(chan string, 100)
+	rec := &partialRecorder{Recorder: &rct.Recorder{
+		MockName: "partial",
+		Pinged:   true,
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			retried <- job.ID.String()
+			return nil
+		},
+	}}
+	s := engine.NewScheduler(ctx, 1,
+		engine.WithFlushInterval(20*time.Millisecond),
+		engine.WithRecorderFailure(config.RecorderFailureBuffer, 0, nil),
+	)
+	e := newScheduledEngine(t, ctx, "partial", make(chan string))
+	e.SetRecorders(map[string]recorder.DataRecorder{"partial": rec})
+	s.Start(e)
+
+	select {
+	case id := <-retried:
+		rec.mu.Lock()
+		failed := rec.failed
+		rec.mu.Unlock()
+		if id != failed[0] {
+			t.Errorf("retried = (%s); want (%s)", id, failed[0])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the failed job was not retried")
+	}
+	select {
+	case id := <-retried:
+		t.Errorf("retried = (%s); want only the first job", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSchedulerFlushIntervalNonBatchRecorder(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan string, 10)
+	s := engine.NewScheduler(ctx, 1, engine.WithFlushInterval(10*time.Millisecond))
+	s.Start(newScheduledEngine(t, ctx, "red", recorded))
+	select {
+	case name := <-recorded:
+		if name != "red" {
+			t.Errorf("name = (%s); want (red)", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the job wasn't recorded")
+	}
+}
+
+// spanAttr returns the value of the key attribute of the span.
+func spanAttr(s sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSchedulerTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	defer otel.SetTracerProvider(prev)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan string, 10)
+	s := engine.NewScheduler(ctx, 2)
+	s.Start(newScheduledEngine(t, ctx, "traced", recorded))
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was recorded")
+	}
+	cancel()
+
+	var record sdktrace.ReadOnlySpan
+	deadline := time.Now().Add(5 * time.Second)
+	for record == nil && time.Now().Before(deadline) {
+		for _, s := range sr.Ended() {
+			if s.Name() == "record" && spanAttr(s, "recorder") == "rec_traced" {
+				record = s
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if record == nil {
+		t.Fatal("no record spans")
+	}
+
+	found := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range sr.Ended() {
+		if s.SpanContext().TraceID() == record.SpanContext().TraceID() {
+			found[s.Name()] = s
+		}
+	}
+	read, ok := found["read"]
+	if !ok {
+		t.Fatalf("no read span in the trace: %v", found)
+	}
+	if r := spanAttr(read, "reader"); r != "traced" {
+		t.Errorf("reader = (%s); want (traced)", r)
+	}
+	if record.Parent().SpanID() != read.SpanContext().SpanID() {
+		t.Errorf("record.Parent = (%s); want (%s)", record.Parent().SpanID(), read.SpanContext().SpanID())
+	}
+	if m, ok := found["map"]; !ok || m.Parent().SpanID() != read.SpanContext().SpanID() {
+		t.Errorf("map span = (%v); want a child of the read span", m)
+	}
+}
+
+// tracedBatchRecorder sends the span context of each batch.
+type tracedBatchRecorder struct {
+	*rct.Recorder
+	spans chan oteltrace.SpanContext
+}
+
+func (b *tracedBatchRecorder) RecordBatch(ctx context.Context, jobs []recorder.Job) error {
+	select {
+	case b.spans <- oteltrace.SpanContextFromContext(ctx):
+	default:
+	}
+	return nil
+}
+
+func TestSchedulerBatchTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	defer otel.SetTracerProvider(prev)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := &tracedBatchRecorder{
+		Recorder: &rct.Recorder{MockName: "traced_batch", Pinged: true},
+		spans:    make(chan oteltrace.SpanContext, 10),
+	}
+	s := engine.NewScheduler(ctx, 1, engine.WithFlushInterval(50*time.Millisecond))
+	for _, name := range []string{"traced_batch1", "traced_batch2"} {
+		e := newScheduledEngine(t, ctx, name, make(chan string))
+		e.SetRecorders(map[string]recorder.DataRecorder{"traced_batch": rec})
+		s.Start(e)
+	}
+	var sc oteltrace.SpanContext
+	select {
+	case sc = <-rec.spans:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was recorded")
+	}
+	cancel()
+
+	var batch sdktrace.ReadOnlySpan
+	deadline := time.Now().Add(5 * time.Second)
+	for batch == nil && time.Now().Before(deadline) {
+		for _, s := range sr.Ended() {
+			if s.SpanContext().SpanID() == sc.SpanID() {
+				batch = s
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if batch == nil {
+		t.Fatal("the recorder did not get the span of the batch")
+	}
+	if batch.Name() != "record_batch" {
+		t.Errorf("Name() = (%s); want (record_batch)", batch.Name())
+	}
+	reads := make(map[oteltrace.SpanID]bool)
+	for _, s := range sr.Ended() {
+		if s.Name() == "read" {
+			reads[s.SpanContext().SpanID()] = true
+		}
+	}
+	if !reads[batch.Parent().SpanID()] {
+		t.Errorf("Parent = (%s); want a read span", batch.Parent().SpanID())
+	}
+	for _, l := range batch.Links() {
+		if !reads[l.SpanContext.SpanID()] {
+			t.Errorf("link = (%s); want a read span", l.SpanContext.SpanID())
+		}
+	}
+}
+
+func TestSchedulerComponentMetrics(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan string, 10)
+	s := engine.NewScheduler(ctx, 2)
+	s.Start(newScheduledEngine(t, ctx, "metered", recorded))
+	for i := 0; i < 2; i++ {
+		select {
+		case <-recorded:
+		case <-time.After(5 * time.Second):
+			t.Fatal("nothing was recorded")
+		}
+	}
+	cancel()
+
+	for _, tc := range []struct{ metric, name string }{
+		{"Reader Jobs", "metered"},
+		{"Read Duration Seconds", "metered"},
+		{"Payload Size Bytes", "metered"},
+		{"Last Read Success Timestamp", "metered"},
+		{"Recorder Jobs", "rec_metered"},
+		{"Record Duration Seconds", "rec_metered"},
+		{"Last Record Success Timestamp", "rec_metered"},
+	} {
+		m, ok := expvar.Get(tc.metric).(*expvar.Map)
+		if !ok {
+			t.Errorf("%s is not published", tc.metric)
+			continue
+		}
+		if m.Get(tc.name) == nil {
+			t.Errorf("%s has no value for (%s)", tc.metric, tc.name)
+		}
+	}
+}
+
+func TestSchedulerReadAnnotations(t *testing.T) {
+	t.Parallel()
+	for _, annotate := range []bool{true, false} {
+		t.Run(fmt.Sprint(annotate), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			keys := make(chan []string, 10)
+			rec := &rct.Recorder{
+				MockName: "annotated",
+				Pinged:   true,
+				RecordFunc: func(ctx context.Context, job recorder.Job) error {
+					var got []string
+					for _, d := range job.Payload.List() {
+						if key, ok := datatype.KeyOf(d); ok {
+							got = append(got, key)
+						}
+					}
+					select {
+					case keys <- got:
+					default:
+					}
+					return nil
+				},
+			}
+			s := engine.NewScheduler(ctx, 1, engine.WithReadAnnotations(annotate))
+			e := newScheduledEngine(t, ctx, "annotated_red", make(chan string))
+			e.SetRecorders(map[string]recorder.DataRecorder{"annotated": rec})
+			s.Start(e)
+
+			var got []string
+			select {
+			case got = <-keys:
+			case <-time.After(5 * time.Second):
+				t.Fatal("nothing was recorded")
+			}
+			want := "[devil]"
+			if annotate {
+				want = fmt.Sprintf("[devil %s %s]", engine.ScrapeDurationField, engine.StalenessField)
+			}
+			if fmt.Sprint(got) != want {
+				t.Errorf("keys = (%v); want (%s)", got, want)
+			}
+		})
+	}
+}
+
+// skewedRecorder is a recorder whose clock is two minutes ahead.
+type skewedRecorder struct {
+	*rct.Recorder
+}
+
+func (skewedRecorder) ClockSkew() (time.Duration, bool) { return 2 * time.Minute, true }
+
+func TestSchedulerClockSkew(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan string, 10)
+	rec := skewedRecorder{&rct.Recorder{
+		MockName: "skewed",
+		Pinged:   true,
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			select {
+			case recorded <- job.TypeName:
+			default:
+			}
+			return nil
+		},
+	}}
+	s := engine.NewScheduler(ctx, 1, engine.WithClockSkewThreshold(time.Minute))
+	e := newScheduledEngine(t, ctx, "skewed_red", make(chan string))
+	e.SetRecorders(map[string]recorder.DataRecorder{"skewed": rec})
+	s.Start(e)
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was recorded")
+	}
+
+	m, ok := expvar.Get("Recorder Clock Skew Seconds").(*expvar.Map)
+	if !ok {
+		t.Fatal("Recorder Clock Skew Seconds is not published")
+	}
+	for i := 0; m.Get("skewed") == nil && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v := m.Get("skewed"); v == nil || v.String() != "120" {
+		t.Errorf("skew = (%v); want (120)", v)
+	}
+}
+
+type alertNotifier chan alert.Event
+
+func (n alertNotifier) Notify(ctx context.Context, e alert.Event) error {
+	n <- e
+	return nil
+}
+
+func TestSchedulerAlerts(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu      sync.Mutex
+		failing = true
+	)
+	red := &rdt.Reader{
+		Pinged:       true,
+		MockName:     "flaky",
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			return nil, fmt.Errorf("boom")
+		}
+		return &reader.Result{
+			ID:       job.ID(),
+			TypeName: "flaky",
+			Content:  []byte(`{"devil":666}`),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	rec := &rct.Recorder{Pinged: true, MockName: "rec_flaky"}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	n := make(alertNotifier, 10)
+	s := engine.NewScheduler(ctx, 2, engine.WithAlerts(alert.NewDispatcher(log, 3, n)))
+	s.Start(e)
+
+	select {
+	case ev := <-n:
+		if ev.Kind != alert.Failing || ev.Name != "flaky" || ev.Streak != 3 {
+			t.Errorf("event = (%v); want (failing flaky with streak of 3)", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alerts were sent")
+	}
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	select {
+	case ev := <-n:
+		if ev.Kind != alert.Recovered || ev.Name != "flaky" {
+			t.Errorf("event = (%v); want (recovered flaky)", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the recovery was not sent")
+	}
+}
+
+func TestSchedulerStatus(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan string, 10)
+	s := engine.NewScheduler(ctx, 2)
+	s.Start(newScheduledEngine(t, ctx, "watched", recorded))
+	for i := 0; i < 2; i++ {
+		select {
+		case <-recorded:
+		case <-time.After(5 * time.Second):
+			t.Fatal("nothing was recorded")
+		}
+	}
+	cancel()
+
+	status := engine.CurrentStatus()
+	for _, tc := range []struct {
+		kind string
+		list []engine.ComponentStatus
+		name string
+	}{
+		{"reader", status.Readers, "watched"},
+		{"recorder", status.Recorders, "rec_watched"},
+	} {
+		var found *engine.ComponentStatus
+		for i := range tc.list {
+			if tc.list[i].Name == tc.name {
+				found = &tc.list[i]
+			}
+		}
+		if found == nil {
+			t.Errorf("%s (%s) is not in the status", tc.kind, tc.name)
+			continue
+		}
+		if found.Jobs == 0 {
+			t.Errorf("%s Jobs = (0); want (>0)", tc.kind)
+		}
+		if found.LastSuccess.IsZero() {
+			t.Errorf("%s LastSuccess is zero", tc.kind)
+		}
+		if found.ErrorStreak != 0 {
+			t.Errorf("%s ErrorStreak = (%d); want (0)", tc.kind, found.ErrorStreak)
+		}
+	}
+}
+
+func TestSchedulerRouteMappers(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{
+		Pinged:       true,
+		MockName:     "red",
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:      job.ID(),
+			Content: []byte(`{"Alloc":1048576}`),
+			Mapper:  red.Mapper(),
+			Labels:  datatype.Labels{"instance": "app1"},
+		}, nil
+	}
+	payloads := make(chan recorder.Job, 10)
+	record := func(ctx context.Context, job recorder.Job) error {
+		select {
+		case payloads <- job:
+		default:
+		}
+		return nil
+	}
+	rec1 := &rct.Recorder{Pinged: true, MockName: "rec1", MockIndexName: "rec1", RecordFunc: record}
+	rec2 := &rct.Recorder{Pinged: true, MockName: "rec2", MockIndexName: "rec2", RecordFunc: record}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec1, rec2),
+		engine.WithMappers(map[string]datatype.Mapper{
+			"rec2": datatype.DefaultMapper().Extend(nil, map[string]string{"Alloc": "kb"}),
+		}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	s := engine.NewScheduler(ctx, 1)
+	s.Start(e)
+
+	want := map[string]string{
+		"rec1": "*datatype.MegaByteType",
+		"rec2": "*datatype.KiloByteType",
+	}
+	seen := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for len(seen) < len(want) {
+		select {
+		case job := <-payloads:
+			list := job.Payload.List()
+			if len(list) != 1 {
+				t.Fatalf("len(list) = (%d); want (1)", len(list))
+			}
+			if job.Reader != "red" {
+				t.Errorf("job.Reader = (%s); want (red)", job.Reader)
+			}
+			if c, ok := job.Payload.(*datatype.Container); !ok || c.Labels()["instance"] != "app1" {
+				t.Errorf("payload = (%v); want the labels of the result", job.Payload)
+			}
+			if got := fmt.Sprintf("%T", list[0]); got != want[job.IndexName] {
+				t.Errorf("%s: payload = (%s); want (%s)", job.IndexName, got, want[job.IndexName])
+			}
+			seen[job.IndexName] = true
+		case <-timeout:
+			t.Fatalf("seen = (%v); want both recorders", seen)
+		}
+	}
+}
+
+func TestSchedulerRouteTenants(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{
+		Pinged:       true,
+		MockName:     "red",
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:      job.ID(),
+			Content: []byte(`{"Alloc":1048576}`),
+			Mapper:  red.Mapper(),
+			Labels:  datatype.Labels{"instance": "app1"},
+		}, nil
+	}
+	var (
+		mu     sync.Mutex
+		counts = make(map[string]int)
+	)
+	record := func(ctx context.Context, job recorder.Job) error {
+		labels := job.Payload.(*datatype.Container).Labels()
+		switch job.IndexName {
+		case "payments-rec1":
+			if labels[tenant.Label] != "payments" || labels["instance"] != "app1" {
+				t.Errorf("labels = (%v); want the tenant and the labels of the result", labels)
+			}
+		case "rec2":
+			if _, ok := labels[tenant.Label]; ok {
+				t.Errorf("labels = (%v); want no tenant", labels)
+			}
+		default:
+			t.Errorf("job.IndexName = (%s); want (payments-rec1) or (rec2)", job.IndexName)
+		}
+		mu.Lock()
+		counts[job.IndexName]++
+		mu.Unlock()
+		return nil
+	}
+	rec1 := &rct.Recorder{Pinged: true, MockName: "rec1", MockIndexName: "rec1", RecordFunc: record}
+	rec2 := &rct.Recorder{Pinged: true, MockName: "rec2", MockIndexName: "rec2", RecordFunc: record}
+	payments := tenant.New("payments")
+	payments.MaxDocuments = 3
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec1, rec2),
+		engine.WithTenants(map[string]*tenant.Tenant{"rec1": payments}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	s := engine.NewScheduler(ctx, 1)
+	s.Start(e)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		mu.Lock()
+		done := counts["rec2"] >= 10
+		mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case <-time.After(5 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("rec2 did not receive the jobs")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if counts["payments-rec1"] != 3 {
+		t.Errorf("payments-rec1 = (%d); want (3): the quota of the tenant", counts["payments-rec1"])
+	}
+	if docs, _ := payments.Usage(); docs != 3 {
+		t.Errorf("Usage() = (%d); want (3)", docs)
+	}
+}
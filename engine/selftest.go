@@ -0,0 +1,205 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"sort"
+	"time"
+
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// DefaultSandboxIndex is the index the SelfTest records into if no other index
+// is given.
+const DefaultSandboxIndex = "expipe-selftest"
+
+// These are the steps of the SelfTest.
+const (
+	StepCreate = "create"
+	StepPing   = "ping"
+	StepRead   = "read"
+	StepMap    = "map"
+	StepRecord = "record"
+)
+
+var errReadFailed = errors.New("the read has failed")
+
+// Check is the result of a step of the SelfTest.
+type Check struct {
+	Step string
+
+	// Component is the name of the reader or the recorder, or the route from
+	// the reader to the recorder for the map and record steps.
+	Component string
+	Took      time.Duration
+
+	// Err is nil if the step has passed. When Skipped is true, the step was
+	// not run and Err is the reason.
+	Err     error
+	Skipped bool
+}
+
+// SelfTest checks that the readers and recorders of the routes are created and
+// reachable, then runs one full cycle of each route: it reads the reader once,
+// maps the result for each of the recorders and records it into the sandbox
+// index instead of the index of the recorder. The DefaultSandboxIndex is used
+// if the sandbox is empty. The samples, conditions, maintenance windows and
+// tenant quotas of the routes do not apply, and the readers owned by other
+// instances of the cluster are tested as well. It returns the checks in order,
+// and an error if any of them has failed or was skipped.
+func (s *Service) SelfTest(sandbox string) ([]Check, error) {
+	if s.Configure == nil {
+		s.Configure = New
+	}
+	if s.Conf == nil {
+		return nil, errors.New("confMap cannot be nil")
+	}
+	if sandbox == "" {
+		sandbox = DefaultSandboxIndex
+	}
+	readers := make([]string, 0, len(s.Conf.Readers))
+	for name := range s.Conf.Readers {
+		readers = append(readers, name)
+	}
+	sort.Strings(readers)
+	recorders := make([]string, 0, len(s.Conf.Recorders))
+	for name := range s.Conf.Recorders {
+		recorders = append(recorders, name)
+	}
+	sort.Strings(recorders)
+
+	var checks []Check
+	pinged := make(map[string]error)
+	for _, name := range readers {
+		c := Check{Step: StepCreate, Component: name}
+		if s.Conf.Readers[name] == nil {
+			c.Err = errors.New("empty reader")
+			pinged[name] = c.Err
+		}
+		checks = append(checks, c)
+	}
+	for _, name := range recorders {
+		c := Check{Step: StepCreate, Component: name}
+		if s.Conf.Recorders[name] == nil {
+			c.Err = errors.New("empty recorder")
+			pinged[name] = c.Err
+		}
+		checks = append(checks, c)
+	}
+	ping := func(name string, f func() error) {
+		if _, failed := pinged[name]; failed {
+			return
+		}
+		start := time.Now()
+		err := f()
+		checks = append(checks, Check{Step: StepPing, Component: name, Took: time.Since(start), Err: err})
+		pinged[name] = err
+	}
+	for _, name := range readers {
+		if red := s.Conf.Readers[name]; red != nil {
+			ping(name, red.Ping)
+		}
+	}
+	for _, name := range recorders {
+		if rec := s.Conf.Recorders[name]; rec != nil {
+			ping(name, rec.Ping)
+		}
+	}
+
+	routes := make([]string, 0, len(s.Conf.Routes))
+	for name := range s.Conf.Routes {
+		routes = append(routes, name)
+	}
+	sort.Strings(routes)
+	for _, name := range routes {
+		checks = append(checks, s.selfTestRoute(name, s.Conf.Routes[name], pinged, sandbox)...)
+	}
+
+	var failed int
+	for _, c := range checks {
+		if c.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return checks, errors.Errorf("%d of %d check(s) failed", failed, len(checks))
+	}
+	return checks, nil
+}
+
+// selfTestRoute reads the reader once and records the result into each of the
+// recorders in the sandbox index. The pinged holds the ping errors of the
+// readers and the recorders.
+func (s *Service) selfTestRoute(name string, recorders []string, pinged map[string]error, sandbox string) []Check {
+	if err, ok := pinged[name]; !ok || err != nil {
+		if !ok {
+			err = errors.New("not in readers")
+		}
+		return []Check{{Step: StepRead, Component: name, Skipped: true, Err: errors.Wrap(err, "unreachable")}}
+	}
+	red := s.Conf.Readers[name]
+	ctx, cancel := withDeadline(s.Ctx, red.Timeout(), DefaultGracePeriod)
+	job := token.New(ctx)
+	start := time.Now()
+	res, readErr := red.Read(job)
+	cancel()
+	if readErr == nil && (res == nil || res.Content == nil) {
+		readErr = errEmptyResult
+	}
+	checks := []Check{{Step: StepRead, Component: name, Took: time.Since(start), Err: readErr}}
+	if readErr == nil {
+		res.TypeName = reader.ExpandTypeName(res.TypeName, name, red.Endpoint(), res.Content)
+	}
+
+	recs := append([]string(nil), recorders...)
+	sort.Strings(recs)
+	// the Engine applies the mappers, the projections and the labels of the
+	// route.
+	en, engineErr := s.engine(name, recs)
+	for _, recName := range recs {
+		route := name + " >->> " + recName
+		skip := func(err error) {
+			checks = append(checks, Check{Step: StepRecord, Component: route, Skipped: true, Err: err})
+		}
+		if readErr != nil {
+			skip(errReadFailed)
+			continue
+		}
+		if err, ok := pinged[recName]; !ok || err != nil {
+			if !ok {
+				err = errors.New("not in recorders")
+			}
+			skip(errors.Wrap(err, "unreachable"))
+			continue
+		}
+		if engineErr != nil {
+			skip(engineErr)
+			continue
+		}
+		rec, ok := en.Recorders()[recName]
+		if !ok {
+			skip(errRecorderUnreachable)
+			continue
+		}
+
+		start = time.Now()
+		j, err := newJob(recordJob{ctx: s.Ctx, engine: en, rec: rec, result: res})
+		checks = append(checks, Check{Step: StepMap, Component: route, Took: time.Since(start), Err: err})
+		if err != nil {
+			skip(errors.New("the map has failed"))
+			continue
+		}
+		j.IndexName = sandbox
+		recCtx, cancel := withDeadline(s.Ctx, rec.Timeout(), DefaultGracePeriod)
+		start = time.Now()
+		err = rec.Record(recCtx, j)
+		cancel()
+		release(rec, j.Payload)
+		checks = append(checks, Check{Step: StepRecord, Component: route, Took: time.Since(start), Err: err})
+	}
+	return checks
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/engine"
+	"github.com/alext234/expipe/reader"
+	rdt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/recorder"
+	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/token"
+)
+
+func TestSelfTest(t *testing.T) {
+	t.Parallel()
+	indices := make(chan string, 10)
+	red1 := &rdt.Reader{MockName: "red1", Pinged: true, MockMapper: datatype.DefaultMapper()}
+	red1.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{ID: job.ID(), Content: []byte(`{"devil":666}`), Mapper: red1.Mapper()}, nil
+	}
+	confMap := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": red1,
+			"red2": &rdt.Reader{MockName: "red2", PingFunc: func() error { return errExample }},
+		},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": &rct.Recorder{
+				MockName:      "rec1",
+				MockIndexName: "production",
+				Pinged:        true,
+				RecordFunc: func(_ context.Context, job recorder.Job) error {
+					indices <- job.IndexName
+					return nil
+				},
+			},
+			"rec2": &rct.Recorder{MockName: "rec2", PingFunc: func() error { return errExample }},
+		},
+		Routes: map[string][]string{
+			"red1": {"rec2", "rec1"},
+			"red2": {"rec1"},
+		},
+	}
+	s := &engine.Service{Log: newFakeLogger(), Ctx: context.Background(), Conf: confMap}
+	checks, err := s.SelfTest("sandbox")
+	if err == nil || err.Error() != "4 of 13 check(s) failed" {
+		t.Errorf("err = (%v); want (4 of 13 check(s) failed)", err)
+	}
+	tcs := []struct {
+		step, component string
+		failed, skipped bool
+	}{
+		{engine.StepCreate, "red1", false, false},
+		{engine.StepCreate, "red2", false, false},
+		{engine.StepCreate, "rec1", false, false},
+		{engine.StepCreate, "rec2", false, false},
+		{engine.StepPing, "red1", false, false},
+		{engine.StepPing, "red2", true, false},
+		{engine.StepPing, "rec1", false, false},
+		{engine.StepPing, "rec2", true, false},
+		{engine.StepRead, "red1", false, false},
+		{engine.StepMap, "red1 >->> rec1", false, false},
+		{engine.StepRecord, "red1 >->> rec1", false, false},
+		{engine.StepRecord, "red1 >->> rec2", true, true},
+		{engine.StepRead, "red2", true, true},
+	}
+	if len(checks) != len(tcs) {
+		t.Fatalf("checks = (%v); want (%d) checks", checks, len(tcs))
+	}
+	for i, tc := range tcs {
+		c := checks[i]
+		if c.Step != tc.step || c.Component != tc.component {
+			t.Errorf("checks[%d] = (%s %s); want (%s %s)", i, c.Step, c.Component, tc.step, tc.component)
+		}
+		if (c.Err != nil) != tc.failed || c.Skipped != tc.skipped {
+			t.Errorf("checks[%d] (%s %s): Err = (%v), Skipped = (%t); want failed (%t), skipped (%t)",
+				i, c.Step, c.Component, c.Err, c.Skipped, tc.failed, tc.skipped)
+		}
+	}
+	select {
+	case index := <-indices:
+		if index != "sandbox" {
+			t.Errorf("IndexName = (%s); want (sandbox)", index)
+		}
+	default:
+		t.Error("nothing was recorded")
+	}
+
+	delete(confMap.Routes, "red2")
+	confMap.Routes["red1"] = []string{"rec1"}
+	delete(confMap.Recorders, "rec2")
+	delete(confMap.Readers, "red2")
+	if _, err = s.SelfTest(""); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if index := <-indices; index != engine.DefaultSandboxIndex {
+		t.Errorf("IndexName = (%s); want (%s)", index, engine.DefaultSandboxIndex)
+	}
+}
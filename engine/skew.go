@@ -0,0 +1,64 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+)
+
+// DefaultClockSkewThreshold is the skew of the clocks of the recorders that is
+// warned about when the threshold is not set.
+const DefaultClockSkewThreshold = 30 * time.Second
+
+// clockSkew keeps track of the recorders whose clocks are too far from the
+// local clock.
+type clockSkew struct {
+	threshold time.Duration
+	mu        sync.Mutex
+	skewed    map[string]bool // guarded by mu.
+}
+
+// WithClockSkewThreshold sets the skew of the clocks of the recorders that is
+// warned about. The documents of an agent whose clock is skewed land in the
+// past or the future of the dashboards. DefaultClockSkewThreshold is used if
+// the threshold is not positive.
+func WithClockSkewThreshold(threshold time.Duration) func(*Scheduler) {
+	return func(s *Scheduler) {
+		if threshold > 0 {
+			s.skew.threshold = threshold
+		}
+	}
+}
+
+// checkSkew publishes the clock skew of the recorder if it is a
+// recorder.ClockSkewer, and logs a warning when the skew goes above the
+// threshold. It logs again when the skew is back under the threshold.
+func (s *Scheduler) checkSkew(rec recorder.DataRecorder, log tools.FieldLogger) {
+	cs, ok := rec.(recorder.ClockSkewer)
+	if !ok {
+		return
+	}
+	skew, ok := cs.ClockSkew()
+	if !ok {
+		return
+	}
+	name := rec.Name()
+	recorderClockSkew.Set(name, int64(skew.Round(time.Second)/time.Second))
+	over := skew > s.skew.threshold || skew < -s.skew.threshold
+	s.skew.mu.Lock()
+	changed := s.skew.skewed[name] != over
+	s.skew.skewed[name] = over
+	s.skew.mu.Unlock()
+	switch {
+	case changed && over:
+		log.Warnf("the clock of recorder (%s) is %s off the local clock", name, skew.Round(time.Second))
+	case changed:
+		log.Infof("the clock of recorder (%s) is back in sync", name)
+	}
+}
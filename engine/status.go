@@ -0,0 +1,155 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// board holds the outcome of the latest jobs of all readers and recorders.
+var board = &statusBoard{
+	readers:   make(map[string]*ComponentStatus),
+	recorders: make(map[string]*ComponentStatus),
+}
+
+// Status is a snapshot of the state of the pipeline.
+type Status struct {
+	// Routes maps the readers to their recorders.
+	Routes    map[string][]string
+	Readers   []ComponentStatus
+	Recorders []ComponentStatus
+
+	// Paused is true if the Scheduler does not issue the read jobs.
+	Paused bool
+
+	// Queue depths.
+	WaitingReadJobs   int64
+	WaitingRecordJobs int64
+	RecordQueue       int64
+	PendingBatchJobs  int64
+	BufferedJobs      int64
+	UnackedJobs       int64
+}
+
+// ComponentStatus is the state of a reader or a recorder.
+type ComponentStatus struct {
+	Name string
+
+	// LastRun is when the last job was finished, and LastDuration is how long
+	// it took.
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastSuccess  time.Time
+	LastError    string
+
+	// ErrorStreak is the number of failed jobs since the last successful one.
+	ErrorStreak int64
+	Jobs        int64
+	Errors      int64
+}
+
+type statusBoard struct {
+	mu        sync.RWMutex
+	routes    map[string][]string
+	readers   map[string]*ComponentStatus
+	recorders map[string]*ComponentStatus
+	paused    bool
+}
+
+// CurrentStatus returns a snapshot of the state of the pipeline. The readers
+// and recorders are sorted by their names.
+func CurrentStatus() Status {
+	board.mu.RLock()
+	defer board.mu.RUnlock()
+	s := Status{
+		Routes:            make(map[string][]string, len(board.routes)),
+		Readers:           snapshot(board.readers),
+		Recorders:         snapshot(board.recorders),
+		Paused:            board.paused,
+		WaitingReadJobs:   waitingReadJobs.Value(),
+		WaitingRecordJobs: waitingRecordJobs.Value(),
+		RecordQueue:       recordQueue.Value(),
+		PendingBatchJobs:  pendingBatchJobs.Value(),
+		BufferedJobs:      bufferedJobs.Value(),
+		UnackedJobs:       unackedJobs.Value(),
+	}
+	for reader, recorders := range board.routes {
+		s.Routes[reader] = append([]string(nil), recorders...)
+	}
+	return s
+}
+
+func snapshot(m map[string]*ComponentStatus) []ComponentStatus {
+	list := make([]ComponentStatus, 0, len(m))
+	for _, c := range m {
+		list = append(list, *c)
+	}
+	sort.Sort(byName(list))
+	return list
+}
+
+type byName []ComponentStatus
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// setRoutes adds the routes to the board.
+func (b *statusBoard) setRoutes(routes map[string][]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.routes == nil {
+		b.routes = make(map[string][]string, len(routes))
+	}
+	for reader, recorders := range routes {
+		b.routes[reader] = append([]string(nil), recorders...)
+	}
+}
+
+// setPaused records whether the Scheduler is paused.
+func (b *statusBoard) setPaused(paused bool) {
+	b.mu.Lock()
+	b.paused = paused
+	b.mu.Unlock()
+}
+
+// reader records the outcome of a read job. It returns the error streak of
+// the reader before and after the job.
+func (b *statusBoard) reader(name string, took time.Duration, err error) (prev, streak int64) {
+	return b.update(b.readers, name, took, err)
+}
+
+// recorder records the outcome of a record job. It returns the error streak
+// of the recorder before and after the job.
+func (b *statusBoard) recorder(name string, took time.Duration, err error) (prev, streak int64) {
+	return b.update(b.recorders, name, took, err)
+}
+
+func (b *statusBoard) update(m map[string]*ComponentStatus, name string, took time.Duration, err error) (prev, streak int64) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := m[name]
+	if !ok {
+		c = &ComponentStatus{Name: name}
+		m[name] = c
+	}
+	prev = c.ErrorStreak
+	c.Jobs++
+	c.LastRun = now
+	c.LastDuration = took
+	if err != nil {
+		c.Errors++
+		c.ErrorStreak++
+		c.LastError = err.Error()
+		return prev, c.ErrorStreak
+	}
+	c.ErrorStreak = 0
+	c.LastError = ""
+	c.LastSuccess = now
+	return prev, 0
+}
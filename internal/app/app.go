@@ -6,10 +6,18 @@ package app
 
 import (
 	"context"
+	stdexpvar "expvar"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
@@ -18,92 +26,531 @@ import (
 	"github.com/alext234/expipe/reader/expvar"
 	"github.com/alext234/expipe/recorder"
 	"github.com/alext234/expipe/recorder/elasticsearch"
+	"github.com/alext234/expipe/replay"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/alert"
 	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/leader"
+	"github.com/alext234/expipe/tools/limits"
+	"github.com/alext234/expipe/tools/listener"
+	"github.com/alext234/expipe/tools/metrics"
+	"github.com/alext234/expipe/tools/plugin"
+	"github.com/alext234/expipe/tools/trace"
 	flags "github.com/jessevdk/go-flags"
-	"github.com/spf13/viper"
+	"github.com/pkg/errors"
 )
 
 // TODO: change the log to FieldLogger
 
 var (
 	log *tools.Logger
+
+	// cmdArgs holds the remaining arguments after parsing the flags.
+	cmdArgs []string
+
+	// remote is the remote configuration file, if the file is remote.
+	remote *config.Remote
 )
 
 // Opts is the command line flag struct.
-// IDEA: create an interactive wizard for creating a config file.
 var Opts struct {
-	ConfFile  string        `short:"c" long:"config" env:"CONFIG" default:"" description:"Configuration file. Should be in yaml format without the extension."`
-	Reader    string        `long:"reader" env:"READER" default:"localhost:1234/debug/vars" description:"Target address and port"`
-	Recorder  string        `long:"recorder" env:"RECORDER" default:"localhost:9200" description:"Elasticsearch URL and port"`
-	LogLevel  string        `long:"loglevel" env:"LOGLEVEL" default:"info" description:"Log level"`
-	IndexName string        `long:"index" env:"INDEX" default:"expipe" description:"Elasticsearch index name"`
-	TypeName  string        `long:"type" env:"TYPE" default:"expipe" description:"Elasticsearch type name"`
-	Interval  time.Duration `long:"int" env:"INT" default:"1s" description:"Interval between pulls from the target"`
-	Timeout   time.Duration `long:"timeout" env:"TIMEOUT" default:"30s" description:"Communication time-outs to both reader and recorder"`
+	ConfFile      string        `short:"c" long:"config" env:"CONFIG" default:"" description:"Configuration file in yaml, json or toml format. Without an extension, it is searched in the current directory with all formats. It can be an http(s) URL, an etcd:// key or a consul:// KV path."`
+	ConfigPoll    time.Duration `long:"config-poll" env:"CONFIG_POLL" default:"30s" description:"Interval of polling the remote configuration for changes, the engines are restarted when it changes. Zero disables it."`
+	Reader        string        `long:"reader" env:"READER" default:"localhost:1234/debug/vars" description:"Target address and port"`
+	Recorder      string        `long:"recorder" env:"RECORDER" default:"localhost:9200" description:"Elasticsearch URL and port"`
+	LogLevel      string        `long:"loglevel" env:"LOGLEVEL" default:"info" description:"Log level"`
+	LogFormat     string        `long:"log-format" env:"LOG_FORMAT" default:"text" description:"Log format, text or json"`
+	LogFile       string        `long:"log-file" env:"LOG_FILE" description:"Write the logs to this file instead of stderr"`
+	LogMaxSize    int64         `long:"log-max-size" env:"LOG_MAX_SIZE" description:"Rotate the log file when it reaches this size in megabytes"`
+	LogMaxBackups int           `long:"log-max-backups" env:"LOG_MAX_BACKUPS" description:"Number of rotated log files to keep"`
+	IndexName     string        `long:"index" env:"INDEX" default:"expipe" description:"Elasticsearch index name"`
+	TypeName      string        `long:"type" env:"TYPE" default:"expipe" description:"Elasticsearch type name"`
+	Interval      time.Duration `long:"int" env:"INT" default:"1s" description:"Interval between pulls from the target"`
+	Timeout       time.Duration `long:"timeout" env:"TIMEOUT" default:"30s" description:"Communication time-outs to both reader and recorder"`
+	LazyPing      bool          `long:"lazy-ping" env:"LAZY_PING" description:"Start even if the endpoints are not available and ping them in the background"`
+	Self          string        `long:"cluster-self" env:"CLUSTER_SELF" description:"Name of this instance in the cluster"`
+	Peers         []string      `long:"cluster-peer" env:"CLUSTER_PEERS" env-delim:"," description:"Name of an instance in the cluster, can be repeated"`
+	FlushInterval time.Duration `long:"flush-interval" env:"FLUSH_INTERVAL" description:"Ship the results to the recorders in batches on this interval"`
+	LeaderLock    string        `long:"leader-lock" env:"LEADER_LOCK" description:"Lock file for running in active/passive mode, only the holder of the lock scrapes"`
+	PIDFile       string        `long:"pid-file" env:"PID_FILE" description:"Lock file with the pid of the running instance, a second instance with the same file refuses to run"`
+	Replace       bool          `long:"replace" description:"Stop the instance that holds the pid-file and take over"`
+	OnFailure     string        `long:"on-recorder-failure" env:"ON_RECORDER_FAILURE" default:"degrade" description:"What happens when the recorders keep failing: degrade, exit or buffer"`
+	StateDumpFile string        `long:"state-dump-file" env:"STATE_DUMP_FILE" description:"File the state of the engine is written to on SIGUSR1, the state is logged if not set"`
+	MaxIdleConns  int           `long:"http-max-idle-conns" env:"HTTP_MAX_IDLE_CONNS" description:"Number of keep-alive connections kept for each endpoint"`
+	Proxy         string        `long:"http-proxy" env:"HTTP_PROXY_URL" description:"Proxy URL for the connections to the endpoints"`
+	CAFile        string        `long:"http-ca-file" env:"HTTP_CA_FILE" description:"PEM file of the certificate authorities to trust"`
+	Insecure      bool          `long:"http-insecure" env:"HTTP_INSECURE" description:"Skip verifying the certificates of the endpoints"`
+	ClientCert    string        `long:"http-client-cert" env:"HTTP_CLIENT_CERT" description:"PEM client certificate presented to the endpoints that require one"`
+	ClientKey     string        `long:"http-client-key" env:"HTTP_CLIENT_KEY" description:"PEM private key of the http-client-cert"`
+	DisableHTTP2  bool          `long:"http-disable-http2" env:"HTTP_DISABLE_HTTP2" description:"Use HTTP/1.1 for the connections to the endpoints"`
+	Tracing       bool          `long:"tracing" env:"TRACING" description:"Send the spans of the read and record jobs to an OpenTelemetry collector"`
+	TraceEndpoint string        `long:"tracing-endpoint" env:"TRACING_ENDPOINT" description:"OTLP/HTTP address of the collector, the OTEL_EXPORTER_OTLP_ENDPOINT is used if empty"`
+	MetricsAddr   string        `long:"metrics-addr" env:"METRICS_ADDR" description:"Address for serving expipe's own metrics on /metrics and /debug/vars"`
+	Dashboard     bool          `long:"dashboard" env:"DASHBOARD" description:"Serve a status dashboard on the metrics address"`
+	DebugAddr     string        `long:"debug-addr" env:"DEBUG_ADDR" description:"Address for serving pprof, expvar and the metrics on a dedicated port"`
+	TLSCert       string        `long:"listen-tls-cert" env:"LISTEN_TLS_CERT" description:"PEM certificate for serving the metrics and debug addresses over https"`
+	TLSKey        string        `long:"listen-tls-key" env:"LISTEN_TLS_KEY" description:"PEM private key of the listen-tls-cert"`
+	TLSClientCA   string        `long:"listen-tls-client-ca" env:"LISTEN_TLS_CLIENT_CA" description:"PEM file of the certificate authorities of the clients, the clients have to present a certificate if set"`
+	AlertWebhook  string        `long:"alert-webhook" env:"ALERT_WEBHOOK" description:"URL that receives the alerts of failing readers and recorders in json"`
+	AlertSlack    string        `long:"alert-slack" env:"ALERT_SLACK" description:"Slack incoming webhook URL for the alerts of failing readers and recorders"`
+	AlertErrors   int64         `long:"alert-threshold" env:"ALERT_THRESHOLD" description:"Number of consecutive errors of a reader or recorder that triggers an alert"`
+	Ping          bool          `long:"ping" description:"Ping the endpoints of the readers and recorders with the validate command"`
+	Interactive   bool          `long:"interactive" description:"Ask the values of the configuration file with the init command"`
+	DryRun        bool          `long:"dry-run" env:"DRY_RUN" description:"Ping the endpoints, print the engines that would run and exit without recording anything"`
+	SelfTest      bool          `long:"self-test" description:"Ping the endpoints, read and record each route once into a sandbox index, print the results and exit"`
+	SandboxIndex  string        `long:"self-test-index" default:"expipe-selftest" description:"Index the self-test records into"`
+	SchemaFormat  string        `long:"schema-format" default:"text" description:"Format of the schema command: text, es or json"`
+	GraphFormat   string        `long:"graph-format" default:"dot" description:"Format of the graph command: dot, mermaid or json"`
+	TailCount     int           `long:"tail-count" description:"Number of reads of each reader with the tail command, reads until interrupted if zero"`
+	ServiceName   string        `long:"service-name" default:"expipe" description:"Name of the service of the service command"`
+	Set           []string      `long:"set" description:"Override a value of the configuration file, e.g. readers.FirstApp.interval=1s, can be repeated"`
+	OverrideLevel string        `long:"log-level" description:"Override the log level, including the one in the configuration file"`
 }
 
 // Main is the entrypoint of the application. It is been called from main.main.
-// It captures SIGINT or SIGTERM signals to terminate the app.
+// It captures SIGINT or SIGTERM signals to terminate the app. The plugins of
+// the readers and recorders are stopped when it returns.
 func Main() {
+	args, _ := flags.Parse(&Opts)
+	defer plugin.Cleanup()
+	if len(args) > 0 && args[0] == "version" {
+		PrintVersion(os.Stdout)
+		return
+	}
+	if len(args) > 0 && args[0] == "validate" {
+		if !Validate(os.Stdout, tools.GetLogger(Opts.LogLevel), Opts.ConfFile, Opts.Ping) {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "graph" {
+		if err := graphCommand(os.Stdout, tools.GetLogger(Opts.LogLevel), Opts.ConfFile, Opts.GraphFormat); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "init" {
+		file := DefaultConfFile
+		if len(args) > 1 {
+			file = args[1]
+		}
+		if err := Init(os.Stdin, os.Stdout, file, Opts.Interactive); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "service" {
+		if err := serviceCommand(os.Stdout, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	_, conf, err := Config()
 	if err != nil {
-		log.Fatalf(err.Error())
+		log.Fatal(err)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	sigCh := make(chan os.Signal, 1)
 	CaptureSignals(cancel, sigCh, os.Exit, 1*time.Second)
-	Bootstrap(ctx, log, conf)
+	if Opts.DryRun {
+		if err = DryRun(ctx, os.Stdout, log, conf); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if Opts.SelfTest {
+		if err = SelfTest(ctx, os.Stdout, log, conf, Opts.SandboxIndex); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(cmdArgs) > 0 && cmdArgs[0] == "replay" {
+		if err = Replay(ctx, log, conf, cmdArgs[1:]...); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(cmdArgs) > 0 && cmdArgs[0] == "once" {
+		if err = Once(ctx, log, conf); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(cmdArgs) > 0 && cmdArgs[0] == "schema" {
+		if err = Schema(ctx, os.Stdout, log, conf, Opts.SchemaFormat); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(cmdArgs) > 0 && cmdArgs[0] == "tail" {
+		if err = Tail(ctx, os.Stdout, log, conf, Opts.TailCount, cmdArgs[1:]...); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if conf.Settings.PIDFile != "" {
+		release, err := LockInstance(ctx, log, conf.Settings.PIDFile, Opts.Replace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer release()
+	}
+	run := func() { Reload(ctx, log, conf, configUpdates(ctx)) }
+	if ok, err := runService(Opts.ServiceName, cancel, run); ok {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	run()
 }
 
 // Config returns the ConfMap from a file if it was set in the command flags.
+// If the file is the address of a remote configuration, it is fetched from
+// there and polled for changes by Main. The settings of the ConfMap that
+// affect the whole process, like the logs and the http client, are applied.
 func Config() (*tools.Logger, *config.ConfMap, error) {
-	flags.Parse(&Opts)
+	cmdArgs, _ = flags.Parse(&Opts)
 	log = tools.GetLogger("info")
 	if Opts.ConfFile == "" {
-		log = tools.GetLogger(Opts.LogLevel)
+		level := Opts.LogLevel
+		if Opts.OverrideLevel != "" {
+			level = Opts.OverrideLevel
+		}
+		log = tools.GetLogger(level)
 		conf, err := fromFlags()
 		return log, conf, err
 	}
-	conf, err := fromConfig(Opts.ConfFile)
-	return log, conf, err
+	if config.IsRemote(Opts.ConfFile) {
+		var err error
+		if remote, err = config.NewRemote(Opts.ConfFile); err != nil {
+			return log, nil, err
+		}
+		conf, err := remote.Read(context.Background(), log, overrides()...)
+		if err != nil {
+			return log, nil, err
+		}
+		return log, conf, applySettings(conf.Settings)
+	}
+	conf, err := config.ReadFile(log, Opts.ConfFile, overrides()...)
+	if err != nil {
+		return log, nil, err
+	}
+	return log, conf, applySettings(conf.Settings)
+}
+
+// overrides returns the values of the --set flags, and the --log-level flag
+// as the settings.log_level override.
+func overrides() []string {
+	list := append([]string(nil), Opts.Set...)
+	if Opts.OverrideLevel != "" {
+		list = append(list, "settings.log_level="+Opts.OverrideLevel)
+	}
+	return list
 }
 
 // Bootstrap sets up an instance of the Service and starts it. It waits until
-// the Service signals its work has been finished.
+// the Service signals its work has been finished. If the LeaderLock setting is
+// set, the Service is started only after this instance becomes the leader.
+// If the Tracing setting is enabled, the spans of the jobs are sent to the
+// OpenTelemetry collector, and the remaining spans are sent when the Service
+// is finished. If the MetricsAddr setting is set, the metrics and the
+// endpoints that pause and resume the Service are served on that address
+// until the Service is finished, along with the status dashboard if Dashboard
+// is set.
+// If the DebugAddr setting is set, the pprof profiles are served on that
+// address as well. The state of the engine is dumped on SIGUSR1, see
+// DumpState. The readers and recorders that are io.Closers, for example the
+// receivers, are closed when the Service is finished. The runtime limits are
+// applied before the Service is started.
 func Bootstrap(ctx context.Context, log tools.FieldLogger, conf *config.ConfMap) {
-	s := engine.Service{
+	defer closeAll(log, conf)
+	if rt := conf.Settings.Runtime; rt != (limits.Config{}) {
+		procs := limits.Apply(rt)
+		log.Infof("runtime limits: memory limit %d bytes, GOMAXPROCS %d", rt.MemoryLimit, procs)
+	}
+	if conf.Settings.Tracing.Enabled {
+		tracer, err := trace.Setup(conf.Settings.Tracing)
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		defer func() {
+			if err := tracer.Close(); err != nil {
+				log.Warnf("sending the remaining spans: %v", err)
+			}
+		}()
+	}
+	stopState := watchState(log, conf)
+	defer stopState()
+	s := &engine.Service{
 		Ctx:  ctx,
 		Log:  log,
 		Conf: conf,
 	}
-
+	if conf.Settings.MetricsAddr != "" {
+		srv, err := serveMetrics(log, conf.Settings.MetricsAddr, conf.Settings.Dashboard, conf.Settings.ListenTLS, conf.Plan, s)
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		defer srv.Close()
+	}
+	if conf.Settings.DebugAddr != "" {
+		srv, err := serveDebug(log, conf.Settings.DebugAddr, conf.Settings.ListenTLS)
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		defer srv.Close()
+	}
+	if conf.Settings.LeaderLock != "" {
+		l, err := leader.NewFileLock(conf.Settings.LeaderLock)
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		log.Infof("waiting for the leader lock (%s)", conf.Settings.LeaderLock)
+		if err = l.Acquire(ctx, leader.DefaultRetryInterval); err != nil {
+			if ctx.Err() == nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		defer l.Release()
+		log.Info("became the leader")
+	}
 	done, err := s.Start()
 	if err != nil {
-		log.Fatalf(err.Error())
+		log.Fatal(err)
 		return
 	}
 	<-done
+	if err = s.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// closeAll closes the readers and recorders of the conf that are io.Closers.
+func closeAll(log tools.FieldLogger, conf *config.ConfMap) {
+	for name, red := range conf.Readers {
+		if c, ok := red.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Errorf("closing %s: %v", name, err)
+			}
+		}
+	}
+	for name, rec := range conf.Recorders {
+		if c, ok := rec.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Errorf("closing %s: %v", name, err)
+			}
+		}
+	}
+}
+
+// Replay records the documents of the files into all recorders of the conf.
+// The files should be in new line delimited json format. See the replay
+// package for the format. The original timestamps of the documents are
+// preserved.
+func Replay(ctx context.Context, log tools.FieldLogger, conf *config.ConfMap, files ...string) error {
+	if len(files) == 0 {
+		return fmt.Errorf("no files to replay")
+	}
+	recs := make([]recorder.DataRecorder, 0, len(conf.Recorders))
+	for name, rec := range conf.Recorders {
+		if err := rec.Ping(); err != nil {
+			return errors.Wrap(err, name)
+		}
+		recs = append(recs, rec)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		n, err := replay.Replay(ctx, log, f, Opts.TypeName, recs...)
+		f.Close()
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+		log.Infof("replayed %d documents from %s", n, name)
+	}
+	return nil
+}
+
+// Once reads each of the readers of the conf once, records the results into
+// the recorders of their routes and returns. It returns an error if any of the
+// readers or recorders fail, therefore the process exits with a non-zero
+// status.
+func Once(ctx context.Context, log tools.FieldLogger, conf *config.ConfMap) error {
+	s := engine.Service{
+		Ctx:  ctx,
+		Log:  log,
+		Conf: conf,
+	}
+	return s.Once()
+}
+
+// DryRun prints the Engines that the Service would start for the conf to w,
+// with their reachable recorders and the endpoints that could not be pinged.
+// Like the Service, it returns an error if no Engines would run on this
+// instance, unless the LazyPing setting is set or all the readers are owned by
+// other instances of the cluster.
+func DryRun(ctx context.Context, w io.Writer, log tools.FieldLogger, conf *config.ConfMap) error {
+	s := engine.Service{
+		Ctx:  ctx,
+		Log:  log,
+		Conf: conf,
+	}
+	plans, err := s.Plan()
+	if err != nil {
+		return err
+	}
+	self := conf.Settings.Cluster.Self
+	running, owned := 0, 0
+	for _, p := range plans {
+		if p.Owner != "" && p.Owner != self {
+			fmt.Fprintf(w, "%s: owned by %s\n", p.Reader, p.Owner)
+			continue
+		}
+		owned++
+		if err, ok := p.Unreachable[p.Reader]; ok {
+			fmt.Fprintf(w, "%s (%s): quarantined: %v\n", p.Reader, p.Endpoint, err)
+			continue
+		}
+		if !p.Runs(self) {
+			fmt.Fprintf(w, "%s (%s): no reachable recorders\n", p.Reader, p.Endpoint)
+		} else {
+			running++
+			fmt.Fprintf(w, "%s (%s) >->> %s\n", p.Reader, p.Endpoint, strings.Join(p.Recorders, ", "))
+		}
+		for _, name := range sortedErrors(p.Unreachable) {
+			fmt.Fprintf(w, "    %s is unreachable: %v\n", name, p.Unreachable[name])
+		}
+	}
+	fmt.Fprintf(w, "%d of %d engine(s) would run\n", running, len(plans))
+	if running == 0 && owned > 0 && !conf.Settings.LazyPing {
+		return errors.New("no engines would run")
+	}
+	return nil
 }
 
-// setting up from config file
-func fromConfig(confFile string) (*config.ConfMap, error) {
-	v := viper.New()
-	v.SetConfigName(confFile)
-	v.SetConfigType("yaml") // PLAN: Also read from toml, json etcd, consul, etc.
-	v.AddConfigPath(".")
-	err := v.ReadInConfig()
+// SelfTest runs a full cycle of each route of the conf into the sandbox index
+// and writes a table of the results of each step to w, see
+// engine.Service.SelfTest. It is a deeper check than the validate command and
+// DryRun, as the results are read, mapped and recorded. It returns an error if
+// any of the steps fail.
+func SelfTest(ctx context.Context, w io.Writer, log tools.FieldLogger, conf *config.ConfMap, sandbox string) error {
+	s := engine.Service{
+		Ctx:  ctx,
+		Log:  log,
+		Conf: conf,
+	}
+	checks, err := s.SelfTest(sandbox)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tCOMPONENT\tRESULT\tTOOK")
+	for _, c := range checks {
+		result, took := "ok", ""
+		switch {
+		case c.Skipped:
+			result = fmt.Sprintf("skipped: %v", c.Err)
+		case c.Err != nil:
+			result = fmt.Sprintf("failed: %v", c.Err)
+		}
+		if c.Step != engine.StepCreate && !c.Skipped {
+			took = c.Took.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Step, c.Component, result, took)
+	}
+	tw.Flush()
 	if err != nil {
-		return nil, fmt.Errorf("reading config file: %s", err)
+		return err
+	}
+	fmt.Fprintf(w, "all %d check(s) passed\n", len(checks))
+	return nil
+}
+
+func sortedErrors(m map[string]error) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	confSlice, err := config.LoadYAML(log, v)
+// graphCommand writes the topology of the routes of the file to w in the
+// format, see Graph. The readers and recorders are not created.
+func graphCommand(w io.Writer, log *tools.Logger, file, format string) error {
+	if file == "" {
+		return errors.New("no configuration file, use -c to specify one")
+	}
+	plan, err := config.PlanFile(log, file, overrides()...)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return confSlice, nil
+	return Graph(w, plan, format)
+}
+
+// Validate validates the configuration file with the overrides of the --set
+// and --log-level flags, and writes all errors and warnings to w. If ping is
+// true, the endpoints of the readers and recorders are pinged and the
+// unreachable ones are reported as errors. It returns false if there are any
+// errors.
+func Validate(w io.Writer, log *tools.Logger, file string, ping bool) bool {
+	if file == "" {
+		fmt.Fprintln(w, "error: no configuration file, use -c to specify one")
+		return false
+	}
+	report := config.ValidateFile(log, file, overrides()...)
+	if ping {
+		for _, name := range sortedNames(report.Readers) {
+			if err := report.Readers[name].Ping(); err != nil {
+				report.Errors = append(report.Errors, errors.Wrapf(err, "reader %s", name))
+			}
+		}
+		for _, name := range sortedNames(report.Recorders) {
+			if err := report.Recorders[name].Ping(); err != nil {
+				report.Errors = append(report.Errors, errors.Wrapf(err, "recorder %s", name))
+			}
+		}
+	}
+	for _, err := range report.Errors {
+		fmt.Fprintf(w, "error: %v\n", err)
+	}
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	if !report.OK() {
+		fmt.Fprintf(w, "%s: %d error(s), %d warning(s)\n", file, len(report.Errors), len(report.Warnings))
+		return false
+	}
+	fmt.Fprintf(w, "%s is valid, %d warning(s)\n", file, len(report.Warnings))
+	return true
+}
+
+// sortedNames returns the keys of a map of readers or recorders in order.
+func sortedNames(m interface{}) []string {
+	var names []string
+	switch m := m.(type) {
+	case map[string]reader.DataReader:
+		for name := range m {
+			names = append(names, name)
+		}
+	case map[string]recorder.DataRecorder:
+		for name := range m {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 // setting up from command flags
@@ -113,8 +560,28 @@ func fromFlags() (*config.ConfMap, error) {
 		Readers:   make(map[string]reader.DataReader, 1),
 		Recorders: make(map[string]recorder.DataRecorder, 1),
 	}
+	confMap.Settings.Log = tools.LogConfig{
+		Format:     Opts.LogFormat,
+		File:       Opts.LogFile,
+		MaxSize:    Opts.LogMaxSize << 20,
+		MaxBackups: Opts.LogMaxBackups,
+	}
+	confMap.Settings.HTTP = httpclient.Config{
+		MaxIdleConnsPerHost: Opts.MaxIdleConns,
+		Proxy:               Opts.Proxy,
+		CAFile:              Opts.CAFile,
+		InsecureSkipVerify:  Opts.Insecure,
+		CertFile:            Opts.ClientCert,
+		KeyFile:             Opts.ClientKey,
+		DisableHTTP2:        Opts.DisableHTTP2,
+	}
+	if err = applySettings(confMap.Settings); err != nil {
+		return nil, err
+	}
+	client := httpclient.Default()
 
 	confMap.Recorders["elasticsearch"], err = elasticsearch.New(
+		recorder.WithHTTPClient(client),
 		recorder.WithLogger(log),
 		recorder.WithName("recorder"),
 		recorder.WithEndpoint(Opts.Recorder),
@@ -125,6 +592,7 @@ func fromFlags() (*config.ConfMap, error) {
 		return nil, err
 	}
 	confMap.Readers["expvar"], err = expvar.New(
+		reader.WithHTTPClient(client),
 		reader.WithLogger(log),
 		reader.WithName("expvar"),
 		reader.WithTypeName(Opts.TypeName),
@@ -139,6 +607,27 @@ func fromFlags() (*config.ConfMap, error) {
 	confMap.Routes = make(map[string][]string)
 	confMap.Routes["expvar"] = make([]string, 1)
 	confMap.Routes["expvar"][0] = "elasticsearch"
+	confMap.Settings.LazyPing = Opts.LazyPing
+	confMap.Settings.Cluster = config.Cluster{Self: Opts.Self, Peers: Opts.Peers}
+	confMap.Settings.LeaderLock = Opts.LeaderLock
+	confMap.Settings.StateDumpFile = Opts.StateDumpFile
+	confMap.Settings.PIDFile = Opts.PIDFile
+	confMap.Settings.OnRecorderFailure = Opts.OnFailure
+	confMap.Settings.FlushInterval = Opts.FlushInterval
+	confMap.Settings.Tracing = trace.Config{Enabled: Opts.Tracing, Endpoint: Opts.TraceEndpoint}
+	confMap.Settings.MetricsAddr = Opts.MetricsAddr
+	confMap.Settings.Dashboard = Opts.Dashboard
+	confMap.Settings.DebugAddr = Opts.DebugAddr
+	confMap.Settings.ListenTLS = listener.TLS{
+		CertFile:     Opts.TLSCert,
+		KeyFile:      Opts.TLSKey,
+		ClientCAFile: Opts.TLSClientCA,
+	}
+	confMap.Settings.Alerts = alert.Config{
+		ErrorThreshold: Opts.AlertErrors,
+		Webhook:        Opts.AlertWebhook,
+		Slack:          Opts.AlertSlack,
+	}
 	return confMap, nil
 }
 
@@ -155,3 +644,60 @@ func CaptureSignals(cancel context.CancelFunc, sigCh chan os.Signal, exit func(i
 		cancel()
 	}()
 }
+
+// serveMetrics serves the metrics on addr in the background, the lifecycle
+// events of the engine on /events and the topology of the plan on /topology.
+// The read jobs of the s are paused and resumed by POST requests to /pause
+// and /resume. If dashboard is true, the status dashboard is served on "/" and
+// its data on /status. It is served over https if t is enabled. It returns an
+// error if it can't listen on the addr.
+func serveMetrics(log tools.FieldLogger, addr string, dashboard bool, t listener.TLS, plan config.RoutePlan, s pauser) (*http.Server, error) {
+	l, err := listener.Listen(addr, t)
+	if err != nil {
+		return nil, errors.Wrap(err, "metrics server")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/debug/vars", stdexpvar.Handler())
+	mux.Handle("/events", eventsHandler())
+	mux.Handle("/topology", topologyHandler(plan))
+	mux.Handle("/pause", pauseHandler(s, false))
+	mux.Handle("/resume", pauseHandler(s, true))
+	if dashboard {
+		mux.Handle("/", dashboardHandler())
+		mux.Handle("/status", statusHandler())
+	}
+	return serve(log, "metrics", l, mux), nil
+}
+
+// serveDebug serves the pprof profiles on /debug/pprof/, the expvar variables
+// on /debug/vars and the metrics on /metrics in the background. It is served
+// over https if t is enabled. It returns an error if it can't listen on the
+// addr.
+func serveDebug(log tools.FieldLogger, addr string, t listener.TLS) (*http.Server, error) {
+	l, err := listener.Listen(addr, t)
+	if err != nil {
+		return nil, errors.Wrap(err, "debug server")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", stdexpvar.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+	return serve(log, "debug", l, mux), nil
+}
+
+// serve serves the handler on the l in the background.
+func serve(log tools.FieldLogger, name string, l net.Listener, handler http.Handler) *http.Server {
+	srv := &http.Server{Handler: handler}
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Errorf("%s server: %v", name, err)
+		}
+	}()
+	log.Infof("serving %s on %s", name, l.Addr())
+	return srv
+}
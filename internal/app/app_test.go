@@ -7,11 +7,20 @@ package app_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -19,11 +28,17 @@ import (
 	rdt "github.com/alext234/expipe/reader/testing"
 	rct "github.com/alext234/expipe/recorder/testing"
 
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/engine"
 	"github.com/alext234/expipe/internal/app"
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/recorder"
 	"github.com/alext234/expipe/tools"
 	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/leader"
+	"github.com/alext234/expipe/tools/plugin"
+	"github.com/alext234/expipe/tools/token"
 	flags "github.com/jessevdk/go-flags"
 	"github.com/pkg/errors"
 )
@@ -62,6 +77,38 @@ func readFixtures(t *testing.T, filename string) [][]byte {
 	return ret
 }
 
+// The test binary serves a plugin reader, or a plugin recorder if its first
+// argument is recorder, instead of running the tests when this variable is
+// set. The plugins write their pids in the directory of the variable.
+const pluginEnv = "EXPIPE_TEST_PLUGIN"
+
+type pluginReader struct{}
+
+func (pluginReader) Ping(ctx context.Context) error { return nil }
+
+func (pluginReader) Read(ctx context.Context) ([]byte, error) {
+	return []byte(`{"Alloc":1024}`), nil
+}
+
+type pluginRecorder struct{}
+
+func (pluginRecorder) Ping(ctx context.Context) error { return nil }
+
+func (pluginRecorder) Record(ctx context.Context, doc plugin.Document) error { return nil }
+
+func TestMain(m *testing.M) {
+	if dir, ok := os.LookupEnv(pluginEnv); ok {
+		ioutil.WriteFile(path.Join(dir, strconv.Itoa(os.Getpid())), nil, 0600)
+		if len(os.Args) > 1 && os.Args[1] == "recorder" {
+			plugin.ServeRecorder(pluginRecorder{})
+		} else {
+			plugin.ServeReader(pluginReader{})
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
 func TestConfigLogLevel(t *testing.T) {
 	p := flags.NewParser(&app.Opts, flags.IgnoreUnknown)
 	p.Parse()
@@ -146,6 +193,33 @@ func TestMainAndFromConfigFilePasses(t *testing.T) {
 	}
 }
 
+func TestConfigOverrides(t *testing.T) {
+	filename, teardown := setup(readFixtures(t, "main_and_from_config_file_passes.txt")[0])
+	defer teardown()
+	defer func() {
+		os.Unsetenv("CONFIG")
+		app.Opts.Set = nil
+		app.Opts.OverrideLevel = ""
+	}()
+
+	os.Setenv("CONFIG", filename)
+	p := flags.NewParser(&app.Opts, flags.IgnoreUnknown)
+	p.Parse()
+	app.Opts.Set = []string{"readers.my_app.interval=2s"}
+	app.Opts.OverrideLevel = "debug"
+
+	log, result, err := app.Config()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if log.Level != tools.DebugLevel {
+		t.Errorf("log.Level = (%s); want (debug)", log.Level)
+	}
+	if d := result.Readers["my_app"].Interval(); d != 2*time.Second {
+		t.Errorf("Interval() = (%s); want (2s)", d)
+	}
+}
+
 func TestMainAndFromFlagsErrors(t *testing.T) {
 	os.Unsetenv("CONFIG")
 	fakeDuration, _ := time.ParseDuration("dfdfdf")
@@ -374,3 +448,1035 @@ func TestBootstrap(t *testing.T) {
 		t.Error("Bootstrap() didn't quit")
 	}
 }
+
+// reloadConf returns a configuration that sends the name to the read once it
+// is bootstrapped.
+func reloadConf(read chan<- string, name string) *config.ConfMap {
+	var once sync.Once
+	return &config.ConfMap{
+		Readers: map[string]reader.DataReader{"red1": &rdt.Reader{
+			MockName:     name,
+			MockInterval: time.Millisecond,
+			Pinged:       true,
+			ReadFunc: func(*token.Context) (*reader.Result, error) {
+				once.Do(func() { read <- name })
+				return nil, nil
+			},
+		}},
+		Recorders: map[string]recorder.DataRecorder{"rec1": &rct.Recorder{MockName: "rec1", Pinged: true}},
+		Routes:    map[string][]string{"red1": {"rec1"}},
+	}
+}
+
+func TestReload(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	read := make(chan string, 2)
+	updates := make(chan *config.ConfMap)
+	step := make(chan struct{})
+	go func() {
+		app.Reload(context.Background(), tools.DiscardLogger(), reloadConf(read, "first"), updates)
+		close(step)
+	}()
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-read:
+			if got != want {
+				t.Errorf("read = (%s); want (%s)", got, want)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("the %s configuration was not bootstrapped", want)
+		}
+		if want == "first" {
+			updates <- reloadConf(read, "second")
+		}
+	}
+	select {
+	case <-step:
+		t.Error("Reload() finished unexpectedly")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(updates)
+	select {
+	case <-step:
+	case <-time.After(time.Second * 3):
+		t.Error("Reload() didn't quit")
+	}
+}
+
+func TestReloadSettings(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	level := tools.StandardLogger().Level
+	defer tools.StandardLogger().SetLevel(level)
+	defer httpclient.Configure(httpclient.Config{})
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer ts.Close()
+	read := make(chan string, 1)
+	updates := make(chan *config.ConfMap)
+	step := make(chan struct{})
+	go func() {
+		app.Reload(context.Background(), tools.DiscardLogger(), reloadConf(read, "first"), updates)
+		close(step)
+	}()
+	defer func() {
+		close(updates)
+		<-step
+	}()
+	<-read
+
+	conf := reloadConf(read, "second")
+	conf.Settings.LogLevel = "warn"
+	conf.Settings.HTTP = httpclient.Config{InsecureSkipVerify: true}
+	updates <- conf
+	select {
+	case <-read:
+	case <-time.After(time.Second * 3):
+		t.Fatal("the second configuration was not bootstrapped")
+	}
+	if l := tools.StandardLogger().Level; l != tools.WarnLevel {
+		t.Errorf("Level = (%s); want (warn)", l)
+	}
+	resp, err := httpclient.Default().Get(ts.URL)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+}
+
+func TestReloadLogFile(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	defer tools.ConfigureLogger(tools.LogConfig{})
+	dir, err := ioutil.TempDir("", "expipe_app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	read := make(chan string, 1)
+	updates := make(chan *config.ConfMap)
+	step := make(chan struct{})
+	go func() {
+		app.Reload(context.Background(), tools.DiscardLogger(), reloadConf(read, "first"), updates)
+		close(step)
+	}()
+
+	names := []string{"first", "second", "third"}
+	for i, name := range names {
+		select {
+		case <-read:
+		case <-time.After(time.Second * 3):
+			t.Fatalf("the %s configuration was not bootstrapped", name)
+		}
+		if i+1 < len(names) {
+			conf := reloadConf(read, names[i+1])
+			conf.Settings.Log = tools.LogConfig{File: path.Join(dir, names[i+1]+".log")}
+			updates <- conf
+		}
+	}
+	tools.StandardLogger().Error("after the reloads")
+	close(updates)
+	<-step
+	tools.StandardLogger().Error("after the return")
+	for name, want := range map[string]bool{"second": false, "third": true} {
+		b, err := ioutil.ReadFile(path.Join(dir, name+".log"))
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if got := bytes.Contains(b, []byte("after the reloads")); got != want {
+			t.Errorf("%s.log has the log: (%t); want (%t)", name, got, want)
+		}
+		if bytes.Contains(b, []byte("after the return")) {
+			t.Errorf("%s.log is written after Reload returns", name)
+		}
+	}
+}
+
+// leakConf is a configuration with the plugin readers and recorders of the
+// test binary, and an expvar reader of the endpoint that is pinged in the
+// background.
+const leakConf = `
+readers:
+    plugin_reader:
+        type: plugin
+        path: %[1]s
+        args: [reader]
+        type_name: app
+        interval: 10ms
+        timeout: 1s
+    expvar_reader:
+        type: expvar
+        endpoint: %[2]s
+        type_name: app
+        interval: 10ms
+        timeout: 1s
+        ping_interval: 10ms
+recorders:
+    plugin_recorder:
+        type: plugin
+        path: %[1]s
+        args: [recorder]
+        index_name: app
+        timeout: 1s
+routes:
+    route1:
+        readers:
+            - plugin_reader
+            - expvar_reader
+        recorders:
+            - plugin_recorder
+`
+
+func TestReloadLeaks(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	defer plugin.Cleanup()
+	dir, err := ioutil.TempDir("", "expipe_app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pids := path.Join(dir, "pids")
+	os.Mkdir(pids, 0700)
+	os.Setenv(pluginEnv, pids)
+	defer os.Unsetenv(pluginEnv)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Alloc":1024}`))
+	}))
+	defer ts.Close()
+	file := path.Join(dir, "expipe.yml")
+	ioutil.WriteFile(file, []byte(fmt.Sprintf(leakConf, os.Args[0], ts.URL)), 0600)
+
+	// waitPlugins waits until n plugins have been started.
+	waitPlugins := func(n int) {
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if files, _ := ioutil.ReadDir(pids); len(files) >= n {
+				return
+			}
+		}
+		t.Fatalf("%d plugins were not started", n)
+	}
+	// reload bootstraps the configuration of the file, reloads it the given
+	// times and returns the number of the goroutines after Reload returns.
+	reload := func(times int) int {
+		updates := make(chan *config.ConfMap)
+		step := make(chan struct{})
+		conf, err := config.ReadFile(tools.DiscardLogger(), file)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		files, _ := ioutil.ReadDir(pids)
+		started := len(files)
+		go func() {
+			app.Reload(context.Background(), tools.DiscardLogger(), conf, updates)
+			close(step)
+		}()
+		for i := 1; i <= times; i++ {
+			waitPlugins(started + 2*i)
+			if conf, err = config.ReadFile(tools.DiscardLogger(), file); err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			updates <- conf
+		}
+		waitPlugins(started + 2*(times+1))
+		close(updates)
+		<-step
+		httpclient.Default().CloseIdleConnections()
+		return runtime.NumGoroutine()
+	}
+
+	// The packages start some goroutines only once, for example the metrics
+	// of the plugins.
+	base := reload(0)
+	n := reload(3)
+	for start := time.Now(); n > base && time.Since(start) < 5*time.Second; n = runtime.NumGoroutine() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n > base {
+		buf := make([]byte, 1<<20)
+		t.Errorf("goroutines = (%d); want (%d)\n%s", n, base, buf[:runtime.Stack(buf, true)])
+	}
+	files, _ := ioutil.ReadDir(pids)
+	if len(files) != 10 {
+		t.Errorf("len(plugins) = (%d); want (10)", len(files))
+	}
+	for _, f := range files {
+		pid, _ := strconv.Atoi(f.Name())
+		if p, err := os.FindProcess(pid); err == nil && p.Signal(syscall.Signal(0)) == nil {
+			t.Errorf("the plugin %d is still running", pid)
+		}
+	}
+}
+
+func TestBootstrapLeaderLock(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	dir, err := ioutil.TempDir("", "expipe_app")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	lockFile := path.Join(dir, "expipe.lock")
+	l, _ := leader.NewFileLock(lockFile)
+	if err = l.TryLock(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+
+	read := make(chan struct{})
+	var once sync.Once
+	red := &rdt.Reader{
+		MockName:     "red1",
+		MockInterval: time.Millisecond,
+		Pinged:       true,
+		ReadFunc: func(*token.Context) (*reader.Result, error) {
+			once.Do(func() { close(read) })
+			return nil, nil
+		},
+	}
+	conf := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"red1": red},
+		Recorders: map[string]recorder.DataRecorder{"rec1": &rct.Recorder{MockName: "rec1", Pinged: true}},
+		Routes:    map[string][]string{"red1": {"rec1"}},
+	}
+	conf.Settings.LeaderLock = lockFile
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	step := make(chan struct{})
+	go func() {
+		app.Bootstrap(ctx, tools.DiscardLogger(), conf)
+		close(step)
+	}()
+
+	select {
+	case <-read:
+		t.Fatal("the reader was read while the lock was held by another process")
+	case <-time.After(100 * time.Millisecond):
+	}
+	l.Release()
+	select {
+	case <-read:
+	case <-time.After(3 * time.Second):
+		t.Error("didn't take over after the lock was released")
+	}
+	cancel()
+	select {
+	case <-step:
+	case <-time.After(3 * time.Second):
+		t.Error("Bootstrap() didn't quit")
+	}
+}
+
+func TestBootstrapMetrics(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	conf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{"red1": &rdt.Reader{
+			MockName:     "red1",
+			MockInterval: time.Second,
+			Pinged:       true,
+		}},
+		Recorders: map[string]recorder.DataRecorder{"rec1": &rct.Recorder{MockName: "rec1", Pinged: true}},
+		Routes:    map[string][]string{"red1": {"rec1"}},
+		Plan:      config.RoutePlan{{Reader: "red1", Recorder: "rec1", Routes: []string{"route1"}}},
+	}
+	conf.Settings.MetricsAddr = addr
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	step := make(chan struct{})
+	go func() {
+		app.Bootstrap(ctx, tools.DiscardLogger(), conf)
+		close(step)
+	}()
+
+	var body []byte
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		body, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		break
+	}
+	if !bytes.Contains(body, []byte("expipe_read_jobs ")) {
+		t.Errorf("body = (%s); want (expipe_read_jobs)", body)
+	}
+	resp, err := http.Get("http://" + addr + "/debug/vars")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	resp, err = http.Get("http://" + addr + "/topology")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Contains(body, []byte(`"name":"route1"`)) {
+		t.Errorf("body = (%s); want the route1 topology", body)
+	}
+	// The reads can be paused without the dashboard.
+	resp, err = http.Post("http://"+addr+"/pause", "", nil)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = (%d); want (200)", resp.StatusCode)
+	}
+	resp, err = http.Get("http://" + addr + "/status")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("StatusCode = (%d); want (404): the dashboard is not enabled", resp.StatusCode)
+	}
+
+	cancel()
+	select {
+	case <-step:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Bootstrap() didn't quit")
+	}
+	if _, err = http.Get("http://" + addr + "/metrics"); err == nil {
+		t.Error("the metrics server is still running")
+	}
+}
+
+func TestBootstrapDashboard(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	conf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{"red_board": &rdt.Reader{
+			MockName:     "red_board",
+			MockInterval: time.Second,
+			Pinged:       true,
+		}},
+		Recorders: map[string]recorder.DataRecorder{"rec_board": &rct.Recorder{MockName: "rec_board", Pinged: true}},
+		Routes:    map[string][]string{"red_board": {"rec_board"}},
+	}
+	conf.Settings.MetricsAddr = addr
+	conf.Settings.Dashboard = true
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	step := make(chan struct{})
+	go func() {
+		app.Bootstrap(ctx, tools.DiscardLogger(), conf)
+		close(step)
+	}()
+	defer func() {
+		cancel()
+		<-step
+	}()
+
+	var body []byte
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get("http://" + addr + "/")
+		if err == nil {
+			body, _ = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			// The routes are set when the Service starts.
+			if bytes.Contains(body, []byte("red_board")) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	for _, want := range []string{"red_board", "rec_board", "Record queue"} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("body = (%s); want (%s)", body, want)
+		}
+	}
+
+	resp, err := http.Get("http://" + addr + "/status")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer resp.Body.Close()
+	var status engine.Status
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(status.Routes["red_board"]) != 1 {
+		t.Errorf("Routes[red_board] = (%v); want ([rec_board])", status.Routes["red_board"])
+	}
+
+	var (
+		events []engine.Event
+		added  bool
+	)
+	for i := 0; i < 50 && !added; i++ {
+		resp, err = http.Get("http://" + addr + "/events?since=0")
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&events)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		for _, e := range events {
+			if e.Kind == engine.EventReaderAdded && e.Reader == "red_board" {
+				added = true
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !added {
+		t.Errorf("events = (%v); want (reader_added red_board)", events)
+	}
+
+	resp, err = http.Get("http://" + addr + "/events?since=nope")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("StatusCode = (%d); want (400)", resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + addr + "/pause")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("StatusCode = (%d); want (405)", resp.StatusCode)
+	}
+	for _, tc := range []struct {
+		path            string
+		paused, changed bool
+	}{
+		{"/pause", true, true},
+		{"/pause", true, false},
+		{"/resume", false, true},
+	} {
+		resp, err = http.Post("http://"+addr+tc.path, "", nil)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		var result struct{ Paused, Changed bool }
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if result.Paused != tc.paused || result.Changed != tc.changed {
+			t.Errorf("%s = (%+v); want (paused: %t, changed: %t)", tc.path, result, tc.paused, tc.changed)
+		}
+	}
+}
+
+func TestBootstrapDebugAddr(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	conf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{"red_debug": &rdt.Reader{
+			MockName:     "red_debug",
+			MockInterval: time.Second,
+			Pinged:       true,
+		}},
+		Recorders: map[string]recorder.DataRecorder{"rec_debug": &rct.Recorder{MockName: "rec_debug", Pinged: true}},
+		Routes:    map[string][]string{"red_debug": {"rec_debug"}},
+	}
+	conf.Settings.DebugAddr = addr
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	step := make(chan struct{})
+	go func() {
+		app.Bootstrap(ctx, tools.DiscardLogger(), conf)
+		close(step)
+	}()
+
+	for _, path := range []string{"/debug/pprof/", "/debug/vars", "/metrics"} {
+		var resp *http.Response
+		for i := 0; i < 50; i++ {
+			resp, err = http.Get("http://" + addr + path)
+			if err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: StatusCode = (%d); want (200)", path, resp.StatusCode)
+		}
+	}
+
+	cancel()
+	select {
+	case <-step:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Bootstrap() didn't quit")
+	}
+	if _, err = http.Get("http://" + addr + "/debug/vars"); err == nil {
+		t.Error("the debug server is still running")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expipe_app")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "archive.json")
+	content := `{"@timestamp":"2017-01-02T15:04:05+00:00","a":1}
+{"@timestamp":"2017-01-02T15:04:06+00:00","a":2}
+`
+	if err = ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var recorded []time.Time
+	rec := &rct.Recorder{
+		MockName: "rec1",
+		Pinged:   true,
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			recorded = append(recorded, job.Time)
+			return nil
+		},
+	}
+	conf := &config.ConfMap{
+		Recorders: map[string]recorder.DataRecorder{"rec1": rec},
+	}
+	log := tools.DiscardLogger()
+	ctx := context.Background()
+
+	if err = app.Replay(ctx, log, conf); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err = app.Replay(ctx, log, conf, path.Join(dir, "nonexistent")); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err = app.Replay(ctx, log, conf, file); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(recorded) != 2 {
+		t.Fatalf("len(recorded) = (%d); want (2)", len(recorded))
+	}
+	want := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+	if !recorded[0].Equal(want) {
+		t.Errorf("recorded[0] = (%v); want (%v)", recorded[0], want)
+	}
+
+	rec.Pinged = false
+	rec.PingFunc = func() error { return errors.New("ping error") }
+	if err = app.Replay(ctx, log, conf, file); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	log := tools.DiscardLogger()
+	buf := new(bytes.Buffer)
+	if app.Validate(buf, log, "", false) {
+		t.Error("Validate() = (true); want (false)")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	content := fmt.Sprintf(`
+readers:
+    reader1:
+        type: expvar
+        endpoint: http://%[1]s
+        type_name: my_app
+        interval: 2s
+        timeout: 1s
+    reader2:
+        type: expvar
+        endpoint: http://%[1]s
+        type_name: my_app
+        interval: 2s
+        timeout: 1s
+recorders:
+    recorder1:
+        type: elasticsearch
+        endpoint: http://%[1]s
+        index_name: index
+        timeout: 1s
+routes:
+    route1:
+        readers:
+            - reader1
+        recorders:
+            - recorder1
+`, addr)
+	filename, teardown := setup([]byte(content))
+	defer teardown()
+
+	buf.Reset()
+	if !app.Validate(buf, log, filename, false) {
+		t.Errorf("Validate() = (false); want (true): %s", buf)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("warning: reader reader2 is not used in any routes")) {
+		t.Errorf("output = (%s); want a warning about reader2", buf)
+	}
+
+	buf.Reset()
+	if app.Validate(buf, log, filename, true) {
+		t.Error("Validate() = (true); want (false)")
+	}
+	for _, want := range []string{"error: reader reader1", "error: reader reader2", "error: recorder recorder1", "3 error(s), 1 warning(s)"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("output = (%s); want (%s)", buf, want)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var recorded int32
+	conf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": &rdt.Reader{MockName: "red1", MockEndpoint: "http://red1", Pinged: true},
+			"red2": &rdt.Reader{MockName: "red2", MockEndpoint: "http://red2", PingFunc: func() error { return errors.New("down") }},
+		},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": &rct.Recorder{
+				MockName: "rec1",
+				Pinged:   true,
+				RecordFunc: func(context.Context, recorder.Job) error {
+					atomic.AddInt32(&recorded, 1)
+					return nil
+				},
+			},
+			"rec2": &rct.Recorder{MockName: "rec2", PingFunc: func() error { return errors.New("gone") }},
+		},
+		Routes: map[string][]string{"red1": {"rec1", "rec2"}, "red2": {"rec1"}},
+	}
+	buf := new(bytes.Buffer)
+	if err := app.DryRun(context.Background(), buf, tools.DiscardLogger(), conf); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := `red1 (http://red1) >->> rec1
+    rec2 is unreachable: gone
+red2 (http://red2): quarantined: down
+1 of 2 engine(s) would run
+`
+	if buf.String() != want {
+		t.Errorf("output = (%s); want (%s)", buf, want)
+	}
+	if atomic.LoadInt32(&recorded) != 0 {
+		t.Error("recorded in dry run")
+	}
+
+	delete(conf.Routes, "red1")
+	if err := app.DryRun(context.Background(), buf, tools.DiscardLogger(), conf); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	conf.Settings.LazyPing = true
+	if err := app.DryRun(context.Background(), buf, tools.DiscardLogger(), conf); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	red := &rdt.Reader{MockName: "red1", Pinged: true, MockMapper: datatype.DefaultMapper()}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{ID: job.ID(), Content: []byte(`{"devil":666}`), Mapper: red.Mapper()}, nil
+	}
+	var index string
+	conf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{"red1": red},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": &rct.Recorder{
+				MockName: "rec1",
+				Pinged:   true,
+				RecordFunc: func(_ context.Context, job recorder.Job) error {
+					index = job.IndexName
+					return nil
+				},
+			},
+		},
+		Routes: map[string][]string{"red1": {"rec1"}},
+	}
+	buf := new(bytes.Buffer)
+	if err := app.SelfTest(context.Background(), buf, tools.DiscardLogger(), conf, "sandbox"); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if index != "sandbox" {
+		t.Errorf("IndexName = (%s); want (sandbox)", index)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{"STEP", "create  red1", "create  rec1", "ping    red1", "ping    rec1",
+		"read    red1", "map     red1 >->> rec1", "record  red1 >->> rec1", "all 7 check(s) passed"}
+	if len(lines) != len(want) {
+		t.Fatalf("output = (%s); want (%d) lines", buf, len(want))
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = (%s); want (%s...)", i, lines[i], prefix)
+		}
+	}
+
+	conf.Recorders["rec1"] = &rct.Recorder{MockName: "rec1", PingFunc: func() error { return errors.New("gone") }}
+	buf.Reset()
+	err := app.SelfTest(context.Background(), buf, tools.DiscardLogger(), conf, "sandbox")
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	for _, want := range []string{"failed: gone", "skipped: unreachable: gone"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output = (%s); want (%s)", buf, want)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	conf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": &rdt.Reader{
+				MockName:     "red1",
+				MockTypeName: "app",
+				Pinged:       true,
+				ReadFunc: func(*token.Context) (*reader.Result, error) {
+					return &reader.Result{Content: []byte(`{"count":1,"name":"a","list":[1,2],"obj":{"inner":2}}`)}, nil
+				},
+			},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := app.Schema(context.Background(), buf, tools.DiscardLogger(), conf, app.SchemaText); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := `red1 (app):
+    @timestamp: date
+    count: double
+    list: list of double
+    name: keyword
+    obj.inner: double
+`
+	if buf.String() != want {
+		t.Errorf("output = (%s); want (%s)", buf, want)
+	}
+
+	buf.Reset()
+	if err := app.Schema(context.Background(), buf, tools.DiscardLogger(), conf, app.SchemaES); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var mapping map[string]struct {
+		Properties map[string]struct {
+			Type string `json:"type"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &mapping); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if typ := mapping["red1"].Properties["list"].Type; typ != "double" {
+		t.Errorf("list type = (%s); want (double)", typ)
+	}
+
+	buf.Reset()
+	if err := app.Schema(context.Background(), buf, tools.DiscardLogger(), conf, app.SchemaJSON); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var schema map[string]struct {
+		Properties map[string]struct {
+			Type string `json:"type"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &schema); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if typ := schema["red1"].Properties["list"].Type; typ != "array" {
+		t.Errorf("list type = (%s); want (array)", typ)
+	}
+	if typ := schema["red1"].Properties["name"].Type; typ != "string" {
+		t.Errorf("name type = (%s); want (string)", typ)
+	}
+
+	if err := app.Schema(context.Background(), buf, tools.DiscardLogger(), conf, "xml"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	conf.Readers["red2"] = &rdt.Reader{MockName: "red2", PingFunc: func() error { return errors.New("down") }}
+	buf.Reset()
+	if err := app.Schema(context.Background(), buf, tools.DiscardLogger(), conf, app.SchemaText); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("red1 (app):\n")) || bytes.Contains(buf.Bytes(), []byte("red2")) {
+		t.Errorf("output = (%s); want only red1", buf)
+	}
+}
+
+func TestOnce(t *testing.T) {
+	var recorded int32
+	conf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": &rdt.Reader{
+				MockName: "red1",
+				Pinged:   true,
+				ReadFunc: func(job *token.Context) (*reader.Result, error) {
+					return &reader.Result{ID: job.ID(), Content: []byte(`{"a":1}`), Mapper: datatype.DefaultMapper()}, nil
+				},
+			},
+		},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": &rct.Recorder{
+				MockName: "rec1",
+				Pinged:   true,
+				RecordFunc: func(context.Context, recorder.Job) error {
+					atomic.AddInt32(&recorded, 1)
+					return nil
+				},
+			},
+		},
+		Routes: map[string][]string{"red1": {"rec1"}},
+	}
+	if err := app.Once(context.Background(), tools.DiscardLogger(), conf); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if n := atomic.LoadInt32(&recorded); n != 1 {
+		t.Errorf("recorded = (%d); want (1)", n)
+	}
+	conf.Recorders["rec1"].(*rct.Recorder).RecordFunc = func(context.Context, recorder.Job) error {
+		return errors.New("full")
+	}
+	if err := app.Once(context.Background(), tools.DiscardLogger(), conf); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestTail(t *testing.T) {
+	var reads int32
+	routeMapper, err := datatype.DefaultMapper().WithRedactions([]datatype.Redaction{{Match: "secret"}})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	conf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": &rdt.Reader{
+				MockName:     "red1",
+				MockInterval: time.Millisecond,
+				Pinged:       true,
+				ReadFunc: func(*token.Context) (*reader.Result, error) {
+					atomic.AddInt32(&reads, 1)
+					return &reader.Result{
+						Content: []byte(`{"count":1,"secret":"a"}`),
+						Time:    time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+						Labels:  datatype.Labels{"env": "dev"},
+						Mapper:  datatype.DefaultMapper(),
+					}, nil
+				},
+			},
+			"red2": &rdt.Reader{MockName: "red2", PingFunc: func() error { return errors.New("down") }},
+		},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": &rct.Recorder{
+				MockName: "rec1",
+				RecordFunc: func(context.Context, recorder.Job) error {
+					t.Error("recorded; want no records")
+					return nil
+				},
+			},
+		},
+		Routes:  map[string][]string{"red1": {"rec1"}},
+		Mappers: map[string]map[string]datatype.Mapper{"red1": {"rec1": routeMapper}},
+	}
+	buf := new(bytes.Buffer)
+	if err := app.Tail(context.Background(), buf, tools.DiscardLogger(), conf, 2, "red1"); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if n := atomic.LoadInt32(&reads); n != 2 {
+		t.Errorf("reads = (%d); want (2)", n)
+	}
+	out := buf.String()
+	if n := strings.Count(out, "# red1 2017-01-02T03:04:05Z\n"); n != 2 {
+		t.Errorf("reader headers = (%d); want (2):\n%s", n, out)
+	}
+	if n := strings.Count(out, "# red1 >->> rec1 2017-01-02T03:04:05Z\n"); n != 2 {
+		t.Errorf("recorder headers = (%d); want (2):\n%s", n, out)
+	}
+	for _, want := range []string{`    "count": 1`, `"env": "dev"`, `"@timestamp": "2017-01-02T03:04:05`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output = (%s); want (%s) in it", out, want)
+		}
+	}
+	if n := strings.Count(out, `"secret"`); n != 2 {
+		t.Errorf("secret = (%d); want (2) only in the documents of the reader", n)
+	}
+
+	if err := app.Tail(context.Background(), buf, tools.DiscardLogger(), conf, 1, "red3"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err := app.Tail(context.Background(), buf, tools.DiscardLogger(), conf, 1); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestDumpState(t *testing.T) {
+	conf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": &rdt.Reader{
+				MockName:     "red1",
+				MockTypeName: "app",
+				MockEndpoint: "http://127.0.0.1:1234",
+				MockInterval: time.Second,
+			},
+		},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": &rct.Recorder{
+				MockName:     "rec1",
+				MockEndpoint: "http://127.0.0.1:9200",
+				MockTimeout:  time.Minute,
+			},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := app.DumpState(buf, conf); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var state app.State
+	if err := json.Unmarshal(buf.Bytes(), &state); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if state.Goroutines == 0 {
+		t.Error("state.Goroutines = (0); want (>0)")
+	}
+	want := app.Target{Type: "app", Endpoint: "http://127.0.0.1:1234", Interval: "1s", Timeout: "0s"}
+	if state.Readers["red1"] != want {
+		t.Errorf("state.Readers[red1] = (%v); want (%v)", state.Readers["red1"], want)
+	}
+	want = app.Target{Endpoint: "http://127.0.0.1:9200", Timeout: "1m0s"}
+	if state.Recorders["rec1"] != want {
+		t.Errorf("state.Recorders[rec1] = (%v); want (%v)", state.Recorders["rec1"], want)
+	}
+	if state.Time.IsZero() {
+		t.Error("state.Time is zero")
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alext234/expipe/engine"
+)
+
+const (
+	// dashboardRefresh is the interval the dashboard page reloads itself.
+	dashboardRefresh = 5
+
+	// dashboardEvents is the number of the latest events on the dashboard.
+	dashboardEvents = 20
+)
+
+var dashboardTmpl = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+	"dict": dict,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>expipe</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.failing { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>expipe</h1>
+{{if .Status.Paused}}<p class="failing">The read jobs are paused.</p>
+{{end}}<h2>Queues</h2>
+<table>
+<tr><th>Waiting read jobs</th><td>{{.Status.WaitingReadJobs}}</td></tr>
+<tr><th>Waiting record jobs</th><td>{{.Status.WaitingRecordJobs}}</td></tr>
+<tr><th>Record queue</th><td>{{.Status.RecordQueue}}</td></tr>
+<tr><th>Pending batch jobs</th><td>{{.Status.PendingBatchJobs}}</td></tr>
+<tr><th>Buffered record jobs</th><td>{{.Status.BufferedJobs}}</td></tr>
+<tr><th>Unacked record jobs</th><td>{{.Status.UnackedJobs}}</td></tr>
+</table>
+<h2>Routes</h2>
+<table>
+<tr><th>Reader</th><th>Recorders</th></tr>
+{{range .Routes}}<tr><td>{{.Reader}}</td><td>{{range $i, $r := .Recorders}}{{if $i}}, {{end}}{{$r}}{{end}}</td></tr>
+{{end}}</table>
+{{template "components" dict "Title" "Readers" "List" .Status.Readers}}
+{{template "components" dict "Title" "Recorders" "List" .Status.Recorders}}
+<h2>Events</h2>
+<table>
+<tr><th>Seq</th><th>Time</th><th>Kind</th><th>Reader</th><th>Recorders</th><th>Message</th></tr>
+{{range .Events}}<tr><td>{{.Seq}}</td><td>{{ago .Time}}</td><td>{{.Kind}}</td><td>{{.Reader}}</td><td>{{range $i, $r := .Recorders}}{{if $i}}, {{end}}{{$r}}{{end}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+{{define "components"}}<h2>{{.Title}}</h2>
+<table>
+<tr><th>Name</th><th>Last run</th><th>Took</th><th>Last success</th><th>Error streak</th><th>Jobs</th><th>Errors</th><th>Last error</th></tr>
+{{range .List}}<tr{{if .ErrorStreak}} class="failing"{{end}}><td>{{.Name}}</td><td>{{ago .LastRun}}</td><td>{{.LastDuration}}</td><td>{{ago .LastSuccess}}</td><td>{{.ErrorStreak}}</td><td>{{.Jobs}}</td><td>{{.Errors}}</td><td>{{.LastError}}</td></tr>
+{{end}}</table>
+{{end}}`))
+
+// dict pairs up its arguments as the keys and values of a map, for passing
+// more than one value to a template.
+func dict(pairs ...interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		key, _ := pairs[i].(string)
+		m[key] = pairs[i+1]
+	}
+	return m
+}
+
+type route struct {
+	Reader    string
+	Recorders []string
+}
+
+// dashboardHandler serves an html page of the engine's status that refreshes
+// itself.
+func dashboardHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		status := engine.CurrentStatus()
+		routes := make([]route, 0, len(status.Routes))
+		for reader, recorders := range status.Routes {
+			routes = append(routes, route{Reader: reader, Recorders: recorders})
+		}
+		sort.Sort(byReader(routes))
+		events := engine.Events(0)
+		if len(events) > dashboardEvents {
+			events = events[len(events)-dashboardEvents:]
+		}
+		// Newest first.
+		for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+			events[i], events[j] = events[j], events[i]
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := dashboardTmpl.Execute(w, map[string]interface{}{
+			"Refresh": dashboardRefresh,
+			"Status":  status,
+			"Routes":  routes,
+			"Events":  events,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// eventsHandler serves the lifecycle events of the engine in json. The since
+// query parameter filters out the events up to and including that sequence
+// number.
+func eventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var since uint64
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+				http.Error(w, "since should be a sequence number", http.StatusBadRequest)
+				return
+			}
+		}
+		events := engine.Events(since)
+		if events == nil {
+			events = []engine.Event{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+	})
+}
+
+// pauser is an engine.Service that can be paused.
+type pauser interface {
+	Pause() bool
+	Resume() bool
+	Paused() bool
+}
+
+// pauseHandler pauses the read jobs of the p on POST requests, or resumes them
+// if resume is true. It responds with whether the p is paused, and whether the
+// request has changed it.
+func pauseHandler(p pauser, resume bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var changed bool
+		if resume {
+			changed = p.Resume()
+		} else {
+			changed = p.Pause()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Paused  bool `json:"paused"`
+			Changed bool `json:"changed"`
+		}{p.Paused(), changed})
+	})
+}
+
+// statusHandler serves the engine's status in json.
+func statusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(engine.CurrentStatus())
+	})
+}
+
+type byReader []route
+
+func (b byReader) Len() int           { return len(b) }
+func (b byReader) Less(i, j int) bool { return b[i].Reader < b[j].Reader }
+func (b byReader) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
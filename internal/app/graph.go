@@ -0,0 +1,152 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/alext234/expipe/tools/config"
+)
+
+// The formats of the Graph.
+const (
+	GraphDOT     = "dot"     // a Graphviz digraph.
+	GraphMermaid = "mermaid" // a Mermaid flowchart.
+	GraphJSON    = "json"    // the topology as it is served on /topology.
+)
+
+// topology is the graph of the readers, routes and recorders. Each route
+// links its readers to its recorders.
+type topology struct {
+	Readers   []string        `json:"readers"`
+	Recorders []string        `json:"recorders"`
+	Routes    []topologyRoute `json:"routes"`
+}
+
+type topologyRoute struct {
+	Name      string   `json:"name"`
+	Readers   []string `json:"readers"`
+	Recorders []string `json:"recorders"`
+}
+
+// newTopology returns the topology of the plan. The names are sorted.
+func newTopology(plan config.RoutePlan) topology {
+	readers := make(map[string]bool)
+	recorders := make(map[string]bool)
+	routes := make(map[string]*struct{ readers, recorders map[string]bool })
+	for _, e := range plan {
+		readers[e.Reader] = true
+		recorders[e.Recorder] = true
+		for _, name := range e.Routes {
+			rt, ok := routes[name]
+			if !ok {
+				rt = &struct{ readers, recorders map[string]bool }{make(map[string]bool), make(map[string]bool)}
+				routes[name] = rt
+			}
+			rt.readers[e.Reader] = true
+			rt.recorders[e.Recorder] = true
+		}
+	}
+	t := topology{
+		Readers:   sortedKeys(readers),
+		Recorders: sortedKeys(recorders),
+		Routes:    make([]topologyRoute, 0, len(routes)),
+	}
+	for name, rt := range routes {
+		t.Routes = append(t.Routes, topologyRoute{
+			Name:      name,
+			Readers:   sortedKeys(rt.readers),
+			Recorders: sortedKeys(rt.recorders),
+		})
+	}
+	sort.Slice(t.Routes, func(i, j int) bool { return t.Routes[i].Name < t.Routes[j].Name })
+	return t
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Graph writes the topology of the readers, routes and recorders of the plan
+// to w in the format, so the large route matrices can be reviewed visually.
+// The readers are linked to their routes, and the routes to their recorders.
+func Graph(w io.Writer, plan config.RoutePlan, format string) error {
+	t := newTopology(plan)
+	switch format {
+	case GraphDOT:
+		fmt.Fprintln(w, "digraph expipe {")
+		fmt.Fprintln(w, "    rankdir=LR;")
+		for _, name := range t.Readers {
+			fmt.Fprintf(w, "    %s [shape=box];\n", strconv.Quote("reader/"+name))
+		}
+		for _, rt := range t.Routes {
+			fmt.Fprintf(w, "    %s [shape=ellipse];\n", strconv.Quote("route/"+rt.Name))
+		}
+		for _, name := range t.Recorders {
+			fmt.Fprintf(w, "    %s [shape=cylinder];\n", strconv.Quote("recorder/"+name))
+		}
+		for _, rt := range t.Routes {
+			for _, red := range rt.Readers {
+				fmt.Fprintf(w, "    %s -> %s;\n", strconv.Quote("reader/"+red), strconv.Quote("route/"+rt.Name))
+			}
+			for _, rec := range rt.Recorders {
+				fmt.Fprintf(w, "    %s -> %s;\n", strconv.Quote("route/"+rt.Name), strconv.Quote("recorder/"+rec))
+			}
+		}
+		fmt.Fprintln(w, "}")
+	case GraphMermaid:
+		// The names can have characters that Mermaid does not accept in the
+		// ids, therefore the nodes get their indices as ids.
+		fmt.Fprintln(w, "flowchart LR")
+		ids := make(map[string]string)
+		node := func(kind, name, open, close string) {
+			id := kind + strconv.Itoa(len(ids))
+			ids[kind+"/"+name] = id
+			fmt.Fprintf(w, "    %s%s%s%s\n", id, open, strconv.Quote(name), close)
+		}
+		for _, name := range t.Readers {
+			node("reader", name, "[", "]")
+		}
+		for _, rt := range t.Routes {
+			node("route", rt.Name, "([", "])")
+		}
+		for _, name := range t.Recorders {
+			node("recorder", name, "[(", ")]")
+		}
+		for _, rt := range t.Routes {
+			for _, red := range rt.Readers {
+				fmt.Fprintf(w, "    %s --> %s\n", ids["reader/"+red], ids["route/"+rt.Name])
+			}
+			for _, rec := range rt.Recorders {
+				fmt.Fprintf(w, "    %s --> %s\n", ids["route/"+rt.Name], ids["recorder/"+rec])
+			}
+		}
+	case GraphJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return enc.Encode(t)
+	default:
+		return fmt.Errorf("unknown graph format %q, should be one of %s, %s and %s", format, GraphDOT, GraphMermaid, GraphJSON)
+	}
+	return nil
+}
+
+// topologyHandler serves the topology of the plan in JSON.
+func topologyHandler(plan config.RoutePlan) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newTopology(plan))
+	})
+}
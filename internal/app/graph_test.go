@@ -0,0 +1,94 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alext234/expipe/internal/app"
+	"github.com/alext234/expipe/tools/config"
+)
+
+var graphPlan = config.RoutePlan{
+	{Reader: "red1", Recorder: "rec1", Routes: []string{"route1"}},
+	{Reader: "red1", Recorder: "rec2", Routes: []string{"route1", "route2"}},
+	{Reader: "red2", Recorder: "rec2", Routes: []string{"route2"}},
+}
+
+func TestGraphDOT(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := app.Graph(buf, graphPlan, app.GraphDOT); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"digraph expipe {",
+		`"reader/red1" [shape=box];`,
+		`"route/route2" [shape=ellipse];`,
+		`"recorder/rec2" [shape=cylinder];`,
+		`"reader/red1" -> "route/route2";`,
+		`"reader/red2" -> "route/route2";`,
+		`"route/route1" -> "recorder/rec1";`,
+		`"route/route2" -> "recorder/rec2";`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want (%s) in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `"reader/red2" -> "route/route1"`) {
+		t.Errorf("red2 is not in route1:\n%s", out)
+	}
+}
+
+func TestGraphMermaid(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := app.Graph(buf, graphPlan, app.GraphMermaid); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"flowchart LR",
+		`reader0["red1"]`,
+		`route2(["route1"])`,
+		`recorder4[("rec1")]`,
+		"reader0 --> route2",
+		"route2 --> recorder4",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want (%s) in:\n%s", want, out)
+		}
+	}
+}
+
+func TestGraphJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := app.Graph(buf, graphPlan, app.GraphJSON); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var got struct {
+		Readers []string
+		Routes  []struct {
+			Name      string
+			Readers   []string
+			Recorders []string
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(got.Readers) != 2 || len(got.Routes) != 2 {
+		t.Fatalf("topology = (%+v); want 2 readers and 2 routes", got)
+	}
+	if r := got.Routes[1]; r.Name != "route2" || len(r.Readers) != 2 || len(r.Recorders) != 1 {
+		t.Errorf("route2 = (%+v); want red1 and red2 -> rec2", r)
+	}
+
+	if err := app.Graph(buf, graphPlan, "png"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultConfFile is the file the init command writes to if no file is given.
+const DefaultConfFile = "expipe.yml"
+
+// initValues are the values of the starter configuration file.
+type initValues struct {
+	Reader    string
+	TypeName  string
+	Recorder  string
+	IndexName string
+	Interval  time.Duration
+	Timeout   time.Duration
+}
+
+var initTmpl = template.Must(template.New("init").Parse(`# Generated by expipe init. Uncomment the options you need, see docs/RECIPES.md
+# for the details.
+
+settings:
+    log_level: info
+    # log:
+    #     format: json                        # text (default) or json
+    #     file: /var/log/expipe/expipe.log    # stderr if not set
+    #     max_size_mb: 100
+    #     max_backups: 3
+    # lazy_ping: true                         # start even if some endpoints are down
+    # flush_interval: 5s                      # ship the results in batches
+    # leader_lock: /var/run/expipe.lock       # active/passive mode
+    # pid_file: /var/run/expipe.pid           # refuse to run twice
+    # on_recorder_failure: degrade            # degrade, exit or buffer
+    # state_dump_file: /tmp/expipe-state.json # written on SIGUSR1
+    # cluster:
+    #     self: node1
+    #     peers: [node1, node2]
+    # tracing:                                # OpenTelemetry spans of the jobs
+    #     endpoint: http://collector:4318
+    # metrics_addr: :9100
+    # dashboard: true
+    # debug_addr: 127.0.0.1:6060
+    # listen_tls:                             # serve the metrics and debug listeners over https
+    #     cert_file: /etc/expipe/server.pem
+    #     key_file: /etc/expipe/server.key
+    #     client_ca_file: /etc/expipe/clients.pem
+    # events:
+    #     size: 256
+    #     ship: true
+    # alerts:
+    #     error_threshold: 5
+    #     webhook: http://alerts.example.com
+    #     slack: https://hooks.slack.com/services/T000/B000/XXXX
+    # http:
+    #     max_idle_conns_per_host: 16
+    #     proxy: http://proxy:3128
+    #     ca_file: /etc/expipe/ca.pem
+    #     client_cert_file: /etc/expipe/client.pem
+    #     client_key_file: /etc/expipe/client.key
+    #     insecure_skip_verify: false
+    #     disable_http2: false
+
+# defaults:                                   # inherited by all readers and recorders
+#     timeout: {{.Timeout}}
+
+readers:
+    {{.TypeName}}:
+        type: expvar
+        type_name: {{.TypeName}}
+        endpoint: {{.Reader}}
+        interval: {{.Interval}}
+        timeout: {{.Timeout}}
+        # map_file: maps.yml
+        # timestamp_field: meta.time
+        # timestamp_format: unix              # a Go time layout, unix or unix_ms
+        # ping_method: GET                    # HEAD (default) or GET
+        # ping_path: /health
+        # ping_interval: 30s
+    # self:                                   # expipe's own metrics
+    #     type: self
+    #     type_name: expipe
+    #     interval: {{.Interval}}
+
+recorders:
+    elasticsearch:
+        type: elasticsearch
+        endpoint: {{.Recorder}}
+        index_name: {{.IndexName}}
+        timeout: {{.Timeout}}
+        # timestamp_field: "@timestamp"
+        # timestamp_format: unix_ms           # a Go time layout, unix or unix_ms
+        # time_zone: UTC
+
+routes:
+    {{.TypeName}}:
+        readers:
+            - {{.TypeName}}
+            # - self
+        recorders:
+            - elasticsearch
+`))
+
+// Init writes a starter configuration file with a reader, a recorder and a
+// route, with the values of the Opts. If interactive is true, each value is
+// asked through out and read from in, and an empty answer keeps the value of
+// the Opts. The file is written to out if file is "-", and an existing file
+// is never overwritten.
+func Init(in io.Reader, out io.Writer, file string, interactive bool) error {
+	values := initValues{
+		Reader:    Opts.Reader,
+		TypeName:  Opts.TypeName,
+		Recorder:  Opts.Recorder,
+		IndexName: Opts.IndexName,
+		Interval:  Opts.Interval,
+		Timeout:   Opts.Timeout,
+	}
+	if interactive {
+		if err := askInitValues(in, out, &values); err != nil {
+			return err
+		}
+	}
+	if file == "-" {
+		return initTmpl.Execute(out, values)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Wrap(err, "creating the configuration file")
+	}
+	if err = initTmpl.Execute(f, values); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "wrote %s, check it with: expipe -c %s validate\n", file, file)
+	return nil
+}
+
+func askInitValues(in io.Reader, out io.Writer, values *initValues) error {
+	scanner := bufio.NewScanner(in)
+	ask := func(question, current string) (string, error) {
+		fmt.Fprintf(out, "%s [%s]: ", question, current)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return current, nil
+		}
+		if answer := strings.TrimSpace(scanner.Text()); answer != "" {
+			return answer, nil
+		}
+		return current, nil
+	}
+	askDuration := func(question string, current time.Duration) (time.Duration, error) {
+		answer, err := ask(question, current.String())
+		if err != nil {
+			return 0, err
+		}
+		d, err := time.ParseDuration(answer)
+		if err != nil {
+			return 0, errors.Wrap(err, question)
+		}
+		return d, nil
+	}
+
+	var err error
+	if values.TypeName, err = ask("Application name", values.TypeName); err != nil {
+		return err
+	}
+	if values.Reader, err = ask("Expvar endpoint of the application", values.Reader); err != nil {
+		return err
+	}
+	if values.Interval, err = askDuration("Read interval", values.Interval); err != nil {
+		return err
+	}
+	if values.Timeout, err = askDuration("Timeout", values.Timeout); err != nil {
+		return err
+	}
+	if values.Recorder, err = ask("Elasticsearch endpoint", values.Recorder); err != nil {
+		return err
+	}
+	values.IndexName, err = ask("Elasticsearch index name", values.IndexName)
+	return err
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/alext234/expipe/internal/app"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+	flags "github.com/jessevdk/go-flags"
+)
+
+func TestInit(t *testing.T) {
+	p := flags.NewParser(&app.Opts, flags.IgnoreUnknown)
+	p.Parse()
+	dir, err := ioutil.TempDir("", "expipe_init")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "expipe.yml")
+
+	out := new(bytes.Buffer)
+	if err = app.Init(strings.NewReader(""), out, file, false); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !strings.Contains(out.String(), "wrote "+file) {
+		t.Errorf("out = (%s); want (wrote %s)", out, file)
+	}
+	report := config.ValidateFile(tools.DiscardLogger(), file)
+	if !report.OK() || len(report.Warnings) > 0 {
+		t.Errorf("report = (%v, %v); want no errors or warnings", report.Errors, report.Warnings)
+	}
+	if err = app.Init(strings.NewReader(""), out, file, false); err == nil {
+		t.Error("err = (nil); want (error for existing file)")
+	}
+
+	out.Reset()
+	if err = app.Init(strings.NewReader(""), out, "-", false); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for _, want := range []string{"endpoint: " + app.Opts.Reader, "index_name: " + app.Opts.IndexName, "# - self"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("out does not contain (%s)", want)
+		}
+	}
+}
+
+func TestInitInteractive(t *testing.T) {
+	p := flags.NewParser(&app.Opts, flags.IgnoreUnknown)
+	p.Parse()
+	in := strings.NewReader("my_app\nlocalhost:2000/debug/vars\n5s\n\nhttp://es:9200\n")
+	out := new(bytes.Buffer)
+	if err := app.Init(in, out, "-", true); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for _, want := range []string{
+		"Application name [" + app.Opts.TypeName + "]: ",
+		"    my_app:\n",
+		"endpoint: localhost:2000/debug/vars",
+		"interval: 5s",
+		"timeout: " + app.Opts.Timeout.String(),
+		"endpoint: http://es:9200",
+		"index_name: " + app.Opts.IndexName,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("out does not contain (%s)", want)
+		}
+	}
+
+	in = strings.NewReader("my_app\n\nfive seconds\n")
+	if err := app.Init(in, out, "-", true); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/leader"
+	"github.com/pkg/errors"
+)
+
+// replaceTimeout is how long LockInstance waits for the running instance to
+// stop when replacing it.
+const replaceTimeout = 30 * time.Second
+
+// LockInstance locks the pid file, so a second instance started with the same
+// file refuses to run. If replace is true, the instance that holds the lock is
+// asked to stop with SIGTERM, and the lock is taken over after it stops. The
+// returned function releases the lock. The file is not removed on release, as
+// another instance might be waiting on it.
+func LockInstance(ctx context.Context, log tools.FieldLogger, file string, replace bool) (func(), error) {
+	l, err := leader.NewFileLock(file)
+	if err != nil {
+		return nil, err
+	}
+	err = l.TryLock()
+	if errors.Cause(err) == leader.ErrLocked {
+		pid, perr := l.Holder()
+		if perr != nil {
+			return nil, errors.Wrapf(perr, "another instance holds %s", file)
+		}
+		if !replace {
+			return nil, fmt.Errorf("another instance (pid %d) holds %s, stop it or start with --replace", pid, file)
+		}
+		err = replaceInstance(ctx, log, l, pid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() { l.Release() }, nil
+}
+
+// replaceInstance stops the process of the pid and acquires the l when the
+// process releases it.
+func replaceInstance(ctx context.Context, log tools.FieldLogger, l *leader.FileLock, pid int) error {
+	log.Warnf("replacing the running instance (pid %d)", pid)
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return errors.Wrapf(err, "finding the running instance (pid %d)", pid)
+	}
+	if err = p.Signal(syscall.SIGTERM); err != nil {
+		return errors.Wrapf(err, "stopping the running instance (pid %d)", pid)
+	}
+	ctx, cancel := context.WithTimeout(ctx, replaceTimeout)
+	defer cancel()
+	err = l.Acquire(ctx, 100*time.Millisecond)
+	if err == context.DeadlineExceeded {
+		return fmt.Errorf("the running instance (pid %d) did not stop in %s", pid, replaceTimeout)
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/internal/app"
+	"github.com/alext234/expipe/tools"
+)
+
+// TestHoldInstanceHelper holds the instance lock of EXPIPE_PID_FILE until it
+// is killed. It is run as a sub process of TestLockInstanceReplace.
+func TestHoldInstanceHelper(t *testing.T) {
+	file := os.Getenv("EXPIPE_PID_FILE")
+	if file == "" {
+		t.Skip("only run by TestLockInstanceReplace")
+	}
+	if _, err := app.LockInstance(context.Background(), tools.DiscardLogger(), file, false); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("locked")
+	time.Sleep(time.Minute)
+}
+
+func pidFile(t *testing.T) (string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file locks are not supported on windows")
+	}
+	dir, err := ioutil.TempDir("", "expipe_instance")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return path.Join(dir, "expipe.pid"), func() { os.RemoveAll(dir) }
+}
+
+func TestLockInstance(t *testing.T) {
+	file, cleanup := pidFile(t)
+	defer cleanup()
+	release, err := app.LockInstance(context.Background(), tools.DiscardLogger(), file, false)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	_, err = app.LockInstance(context.Background(), tools.DiscardLogger(), file, false)
+	if err == nil {
+		t.Fatal("err = (nil); want (error)")
+	}
+	if want := fmt.Sprintf("pid %d", os.Getpid()); !strings.Contains(err.Error(), want) {
+		t.Errorf("err = (%v); want (%s) in it", err, want)
+	}
+	release()
+	release, err = app.LockInstance(context.Background(), tools.DiscardLogger(), file, false)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	release()
+}
+
+func TestLockInstanceReplace(t *testing.T) {
+	file, cleanup := pidFile(t)
+	defer cleanup()
+	cmd := exec.Command(os.Args[0], "-test.run=TestHoldInstanceHelper")
+	cmd.Env = append(os.Environ(), "EXPIPE_PID_FILE="+file)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer cmd.Process.Kill()
+	buf := make([]byte, len("locked"))
+	if _, err = stdout.Read(buf); err != nil || string(buf) != "locked" {
+		t.Fatalf("helper = (%s, %v); want (locked)", buf, err)
+	}
+
+	release, err := app.LockInstance(context.Background(), tools.DiscardLogger(), file, true)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer release()
+	if err = cmd.Wait(); err == nil {
+		t.Error("err = (nil); want the helper killed")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+)
+
+// Reload runs Bootstrap with the conf, and each time a new configuration is
+// received from the updates, it stops the running Service, applies the
+// settings of the new configuration that affect the whole process, like the
+// logs and the http client, and bootstraps it. Each Service closes its readers
+// and recorders when it stops, which stops their background pings and
+// plugins. It returns when Bootstrap returns on its own, or the updates is
+// closed, and the log file is closed then.
+func Reload(ctx context.Context, log tools.FieldLogger, conf *config.ConfMap, updates <-chan *config.ConfMap) {
+	defer func() {
+		if err := closeLogger(); err != nil {
+			log.Errorf("closing the log file: %v", err)
+		}
+	}()
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func(conf *config.ConfMap) {
+			defer close(done)
+			Bootstrap(runCtx, log, conf)
+		}(conf)
+		select {
+		case <-done:
+			cancel()
+			return
+		case next, ok := <-updates:
+			cancel()
+			<-done
+			if !ok {
+				return
+			}
+			log.Info("the configuration has changed, restarting the engines")
+			if err := applySettings(next.Settings); err != nil {
+				log.Errorf("applying the settings: %v", err)
+			}
+			conf = next
+		}
+	}
+}
+
+// configUpdates returns the new configurations of the remote configuration
+// file, which is polled every ConfigPoll. It returns nil if the configuration
+// file is not remote or the ConfigPoll is zero.
+func configUpdates(ctx context.Context) <-chan *config.ConfMap {
+	if remote == nil || Opts.ConfigPoll <= 0 {
+		return nil
+	}
+	log.Infof("polling %s every %s", remote, Opts.ConfigPoll)
+	return remote.Watch(ctx, log, Opts.ConfigPoll, overrides()...)
+}
@@ -0,0 +1,199 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// The formats of the Schema.
+const (
+	SchemaText = "text" // the fields and their types, one per line.
+	SchemaES   = "es"   // the properties of an elasticsearch mapping.
+	SchemaJSON = "json" // a JSON Schema of the documents.
+)
+
+// field is a field of the recorded documents. The Type is the elasticsearch
+// type of the field, and List is true if the values are lists of the type.
+type field struct {
+	Type string
+	List bool
+}
+
+// Schema reads each of the readers of the conf once, maps the results with
+// their mappers and writes the fields of the documents to w in the format, so
+// the index patterns can be prepared before the data flows. The readers that
+// can not be read are logged, and an error is returned after the schemas of
+// the other readers are written.
+func Schema(ctx context.Context, w io.Writer, log tools.FieldLogger, conf *config.ConfMap, format string) error {
+	if format != SchemaText && format != SchemaES && format != SchemaJSON {
+		return fmt.Errorf("unknown schema format %q, should be one of %s, %s and %s", format, SchemaText, SchemaES, SchemaJSON)
+	}
+	schemas := make(map[string]map[string]field, len(conf.Readers))
+	failed := 0
+	for _, name := range sortedNames(conf.Readers) {
+		fields, err := readerFields(ctx, conf.Readers[name])
+		if err != nil {
+			log.Errorf("%s: %v", name, err)
+			failed++
+			continue
+		}
+		schemas[name] = fields
+	}
+	switch format {
+	case SchemaText:
+		for _, name := range sortedNames(conf.Readers) {
+			fields, ok := schemas[name]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(w, "%s (%s):\n", name, conf.Readers[name].TypeName())
+			for _, key := range sortedFields(fields) {
+				f := fields[key]
+				if f.List {
+					fmt.Fprintf(w, "    %s: list of %s\n", key, f.Type)
+				} else {
+					fmt.Fprintf(w, "    %s: %s\n", key, f.Type)
+				}
+			}
+		}
+	default:
+		out := make(map[string]interface{}, len(schemas))
+		for name, fields := range schemas {
+			if format == SchemaES {
+				out[name] = esMapping(fields)
+			} else {
+				out[name] = jsonSchema(fields)
+			}
+		}
+		b, err := json.MarshalIndent(out, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", b)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d reader(s) could not be read", failed)
+	}
+	return nil
+}
+
+// readerFields reads the red once and returns the fields of its document.
+func readerFields(ctx context.Context, red reader.DataReader) (map[string]field, error) {
+	if err := red.Ping(); err != nil {
+		return nil, errors.Wrap(err, "ping")
+	}
+	if red.Timeout() > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, red.Timeout())
+		defer cancel()
+	}
+	result, err := red.Read(token.New(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	mapper := result.Mapper
+	if mapper == nil {
+		mapper = red.Mapper()
+	}
+	if mapper == nil {
+		mapper = datatype.DefaultMapper()
+	}
+	payload, err := datatype.JobResultDataTypes(result.Content, mapper.Copy())
+	if err != nil {
+		return nil, errors.Wrap(err, "map")
+	}
+	fields := map[string]field{datatype.DefaultTimestampField: {Type: "date"}}
+	if len(result.Labels) > 0 {
+		fields["labels"] = field{Type: "object"}
+	}
+	for _, d := range payload.List() {
+		if key, ok := datatype.KeyOf(d); ok {
+			fields[key] = fieldOf(d)
+		}
+	}
+	return fields, nil
+}
+
+// fieldOf returns the field of the d.
+func fieldOf(d datatype.DataType) field {
+	switch d.(type) {
+	case *datatype.FloatType, *datatype.ByteType, *datatype.KiloByteType, *datatype.MegaByteType:
+		return field{Type: "double"}
+	case *datatype.FloatListType:
+		return field{Type: "double", List: true}
+	case *datatype.GCListType:
+		return field{Type: "long", List: true}
+	case *datatype.StringType:
+		return field{Type: "keyword"}
+	case *datatype.GeoPointType:
+		return field{Type: "geo_point"}
+	}
+	return field{Type: "object"}
+}
+
+func sortedFields(fields map[string]field) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// esMapping returns the properties of an elasticsearch mapping. The lists are
+// mapped with the types of their values, as elasticsearch does.
+func esMapping(fields map[string]field) map[string]interface{} {
+	properties := make(map[string]interface{}, len(fields))
+	for key, f := range fields {
+		properties[key] = map[string]string{"type": f.Type}
+	}
+	return map[string]interface{}{"properties": properties}
+}
+
+// jsonSchema returns a draft 4 JSON Schema of the documents.
+func jsonSchema(fields map[string]field) map[string]interface{} {
+	properties := make(map[string]interface{}, len(fields))
+	for key, f := range fields {
+		var s map[string]interface{}
+		switch f.Type {
+		case "double":
+			s = map[string]interface{}{"type": "number"}
+		case "long":
+			s = map[string]interface{}{"type": "integer"}
+		case "keyword":
+			s = map[string]interface{}{"type": "string"}
+		case "date":
+			s = map[string]interface{}{"type": "string", "format": "date-time"}
+		case "geo_point":
+			s = map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"lat": map[string]string{"type": "number"}, "lon": map[string]string{"type": "number"}},
+			}
+		default:
+			s = map[string]interface{}{"type": "object"}
+		}
+		if f.List {
+			s = map[string]interface{}{"type": "array", "items": s}
+		}
+		properties[key] = s
+	}
+	return map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-04/schema#",
+		"type":       "object",
+		"properties": properties,
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alext234/expipe/tools/config"
+	"github.com/pkg/errors"
+)
+
+// The actions of the service command.
+const (
+	ServiceInstall   = "install"   // installs and enables the service.
+	ServiceUninstall = "uninstall" // stops and removes the service.
+	ServiceStart     = "start"     // starts the installed service.
+	ServiceStop      = "stop"      // stops the running service.
+	ServiceUnit      = "unit"      // prints the unit file without installing it.
+)
+
+// ErrServiceUnsupported is returned when the services of the platform are not
+// supported.
+var ErrServiceUnsupported = errors.New("services are not supported on this platform")
+
+// ServiceConfig describes the service expipe runs as. The Exec is the absolute
+// path of the executable, and it is run with the Args.
+type ServiceConfig struct {
+	Name        string
+	Description string
+	Exec        string
+	Args        []string
+}
+
+// Service applies the action on the service of the s, which is a systemd unit
+// on linux, a launchd daemon on macOS and a service of the service control
+// manager on windows. The messages are written to w.
+func Service(w io.Writer, action string, s ServiceConfig) error {
+	if s.Name == "" {
+		return errors.New("empty service name")
+	}
+	switch action {
+	case ServiceUnit:
+		return s.unit(w)
+	case ServiceInstall:
+		if err := s.install(); err != nil {
+			return errors.Wrap(err, "installing the service")
+		}
+	case ServiceUninstall:
+		if err := s.uninstall(); err != nil {
+			return errors.Wrap(err, "uninstalling the service")
+		}
+	case ServiceStart:
+		if err := s.start(); err != nil {
+			return errors.Wrap(err, "starting the service")
+		}
+	case ServiceStop:
+		if err := s.stop(); err != nil {
+			return errors.Wrap(err, "stopping the service")
+		}
+	default:
+		return fmt.Errorf("unknown service action %q, should be one of %s, %s, %s, %s and %s",
+			action, ServiceInstall, ServiceUninstall, ServiceStart, ServiceStop, ServiceUnit)
+	}
+	fmt.Fprintf(w, "%s: %s done\n", s.Name, action)
+	return nil
+}
+
+// serviceCommand applies the action of the args on the service of the flags.
+func serviceCommand(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("the service command needs an action")
+	}
+	s := ServiceConfig{Name: Opts.ServiceName}
+	if args[0] == ServiceInstall || args[0] == ServiceUnit {
+		var err error
+		if s, err = serviceConfig(); err != nil {
+			return err
+		}
+	}
+	return Service(w, args[0], s)
+}
+
+// serviceConfig returns the ServiceConfig of the flags. The service runs the
+// current executable with the absolute path of the configuration file, or its
+// remote address, and the --set, --log-level and --config-poll flags.
+func serviceConfig() (ServiceConfig, error) {
+	if Opts.ConfFile == "" {
+		return ServiceConfig{}, errors.New("the service needs a configuration file, set it with -c")
+	}
+	conf := Opts.ConfFile
+	if !config.IsRemote(conf) {
+		var err error
+		if conf, err = filepath.Abs(conf); err != nil {
+			return ServiceConfig{}, err
+		}
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return ServiceConfig{}, errors.Wrap(err, "finding the executable")
+	}
+	args := []string{"-c", conf}
+	for _, s := range Opts.Set {
+		args = append(args, "--set", s)
+	}
+	if Opts.OverrideLevel != "" {
+		args = append(args, "--log-level", Opts.OverrideLevel)
+	}
+	if config.IsRemote(conf) {
+		args = append(args, "--config-poll", Opts.ConfigPoll.String())
+	}
+	return ServiceConfig{
+		Name:        Opts.ServiceName,
+		Description: "expipe records the metrics of the applications",
+		Exec:        executable,
+		Args:        args,
+	}, nil
+}
+
+// command runs the name with the args, and returns an error with its output if
+// it fails.
+func command(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, bytes.TrimSpace(out))
+	}
+	return nil
+}
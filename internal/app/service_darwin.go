@@ -0,0 +1,79 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"path"
+	"text/template"
+)
+
+// plistDir is where the launchd daemons are installed.
+const plistDir = "/Library/LaunchDaemons"
+
+var launchdTmpl = template.Must(template.New("launchd").Funcs(template.FuncMap{
+	"xml": func(s string) string {
+		buf := new(bytes.Buffer)
+		xml.EscapeText(buf, []byte(s))
+		return buf.String()
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>Label</key>
+    <string>{{xml .Name}}</string>
+    <key>ProgramArguments</key>
+    <array>
+        <string>{{xml .Exec}}</string>{{range .Args}}
+        <string>{{xml .}}</string>{{end}}
+    </array>
+    <key>RunAtLoad</key>
+    <true/>
+    <key>KeepAlive</key>
+    <dict>
+        <key>SuccessfulExit</key>
+        <false/>
+    </dict>
+</dict>
+</plist>
+`))
+
+func (s ServiceConfig) unit(w io.Writer) error {
+	return launchdTmpl.Execute(w, s)
+}
+
+func (s ServiceConfig) unitFile() string {
+	return path.Join(plistDir, s.Name+".plist")
+}
+
+func (s ServiceConfig) install() error {
+	f, err := os.Create(s.unitFile())
+	if err != nil {
+		return err
+	}
+	if err = s.unit(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s ServiceConfig) uninstall() error {
+	// the service might not be running.
+	s.stop()
+	return os.Remove(s.unitFile())
+}
+
+func (s ServiceConfig) start() error { return command("launchctl", "load", "-w", s.unitFile()) }
+func (s ServiceConfig) stop() error  { return command("launchctl", "unload", s.unitFile()) }
+
+// runService returns false, the process is run by launchd as a normal
+// process.
+func runService(string, context.CancelFunc, func()) (bool, error) { return false, nil }
@@ -0,0 +1,20 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// +build !linux,!darwin,!windows
+
+package app
+
+import (
+	"context"
+	"io"
+)
+
+func (s ServiceConfig) unit(io.Writer) error { return ErrServiceUnsupported }
+func (s ServiceConfig) install() error       { return ErrServiceUnsupported }
+func (s ServiceConfig) uninstall() error     { return ErrServiceUnsupported }
+func (s ServiceConfig) start() error         { return ErrServiceUnsupported }
+func (s ServiceConfig) stop() error          { return ErrServiceUnsupported }
+
+func runService(string, context.CancelFunc, func()) (bool, error) { return false, nil }
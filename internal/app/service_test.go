@@ -0,0 +1,68 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app_test
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/alext234/expipe/internal/app"
+)
+
+func TestServiceUnit(t *testing.T) {
+	s := app.ServiceConfig{
+		Name:        "expipe",
+		Description: "expipe service",
+		Exec:        "/usr/local/bin/expipe",
+		Args:        []string{"-c", "/etc/expipe/expipe.yml"},
+	}
+	buf := new(bytes.Buffer)
+	err := app.Service(buf, app.ServiceUnit, s)
+	var want []string
+	switch runtime.GOOS {
+	case "linux":
+		want = []string{
+			"Description=expipe service",
+			`ExecStart=/usr/local/bin/expipe "-c" "/etc/expipe/expipe.yml"`,
+			"WantedBy=multi-user.target",
+		}
+	case "darwin":
+		want = []string{
+			"<string>expipe</string>",
+			"<string>/usr/local/bin/expipe</string>",
+			"<string>/etc/expipe/expipe.yml</string>",
+		}
+	case "windows":
+		want = []string{"expipe: /usr/local/bin/expipe -c /etc/expipe/expipe.yml"}
+	default:
+		if err != app.ErrServiceUnsupported {
+			t.Errorf("err = (%v); want (%v)", err, app.ErrServiceUnsupported)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for _, w := range want {
+		if !strings.Contains(buf.String(), w) {
+			t.Errorf("unit = (%s); want (%s) in it", buf, w)
+		}
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := app.Service(buf, "restart", app.ServiceConfig{Name: "expipe"}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err := app.Service(buf, app.ServiceStart, app.ServiceConfig{}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("buf = (%s); want empty", buf)
+	}
+}
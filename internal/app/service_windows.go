@@ -0,0 +1,137 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// unit writes the command line of the service, as windows has no unit files.
+func (s ServiceConfig) unit(w io.Writer) error {
+	fmt.Fprintf(w, "%s: %s", s.Name, syscall.EscapeArg(s.Exec))
+	for _, arg := range s.Args {
+		fmt.Fprintf(w, " %s", syscall.EscapeArg(arg))
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+func (s ServiceConfig) install() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	srv, err := m.CreateService(s.Name, s.Exec, mgr.Config{
+		DisplayName: s.Name,
+		Description: s.Description,
+		StartType:   mgr.StartAutomatic,
+	}, s.Args...)
+	if err != nil {
+		return err
+	}
+	return srv.Close()
+}
+
+func (s ServiceConfig) uninstall() error {
+	return s.withService(func(srv *mgr.Service) error {
+		// the service might not be running.
+		srv.Control(svc.Stop)
+		return srv.Delete()
+	})
+}
+
+func (s ServiceConfig) start() error {
+	return s.withService(func(srv *mgr.Service) error { return srv.Start() })
+}
+
+// stop stops the service and waits until it is stopped, for as long as the
+// service control manager waits for the services to stop.
+func (s ServiceConfig) stop() error {
+	return s.withService(func(srv *mgr.Service) error {
+		status, err := srv.Control(svc.Stop)
+		if err != nil {
+			return err
+		}
+		timeout := time.After(20 * time.Second)
+		for status.State != svc.Stopped {
+			select {
+			case <-timeout:
+				return fmt.Errorf("timed out waiting for %s to stop", s.Name)
+			case <-time.After(300 * time.Millisecond):
+			}
+			if status, err = srv.Query(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// withService calls f with the installed service of the s.
+func (s ServiceConfig) withService(f func(*mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	srv, err := m.OpenService(s.Name)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+	return f(srv)
+}
+
+// runService calls run under the service control manager if the process is
+// started as a windows service. The cancel is called when the service is
+// stopped, and the service is reported stopped after the run returns. It
+// returns false if the process is not a service.
+func runService(name string, cancel context.CancelFunc, run func()) (bool, error) {
+	ok, err := svc.IsWindowsService()
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, svc.Run(name, &serviceHandler{cancel: cancel, run: run})
+}
+
+type serviceHandler struct {
+	cancel context.CancelFunc
+	run    func()
+}
+
+// Execute implements the svc.Handler interface.
+func (h *serviceHandler) Execute(_ []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	done := make(chan struct{})
+	go func() {
+		h.run()
+		close(done)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				h.cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
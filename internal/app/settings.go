@@ -0,0 +1,63 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"io"
+	"sync"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/httpclient"
+)
+
+var (
+	logMu sync.Mutex
+	// logFile and logFormat are of the last configureLogger call.
+	logFile   io.Closer
+	logFormat string
+)
+
+// applySettings applies the settings of a configuration that affect the whole
+// process: the level and the destination of the logs, and the settings of the
+// shared http client. It is called when the configuration is put to use,
+// therefore reading or polling a configuration does not change the running
+// one.
+func applySettings(s config.Settings) error {
+	if s.LogLevel != "" {
+		tools.GetLogger(s.LogLevel)
+	}
+	if err := configureLogger(s.Log); err != nil {
+		return err
+	}
+	return httpclient.Configure(s.HTTP)
+}
+
+// configureLogger sets the format and the destination of the logs to c. The
+// log file of the previous call is closed once the logs are written to the
+// new destination, therefore the reloads do not leave the files open.
+func configureLogger(c tools.LogConfig) error {
+	logMu.Lock()
+	defer logMu.Unlock()
+	closer, err := tools.ConfigureLogger(c)
+	if err != nil {
+		return err
+	}
+	prev := logFile
+	logFile, logFormat = closer, c.Format
+	if prev != nil {
+		return prev.Close()
+	}
+	return nil
+}
+
+// closeLogger writes the logs to stderr with the same format, and closes the
+// log file.
+func closeLogger() error {
+	logMu.Lock()
+	format := logFormat
+	logMu.Unlock()
+	return configureLogger(tools.LogConfig{Format: format})
+}
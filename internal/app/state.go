@@ -0,0 +1,120 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/alext234/expipe/engine"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+)
+
+// State is a snapshot of the engine for debugging the pipelines that are stuck
+// in production. The Status has the last success and error of each reader and
+// recorder, and the queue depths.
+type State struct {
+	Time       time.Time
+	Goroutines int
+	Readers    map[string]Target
+	Recorders  map[string]Target
+	Status     engine.Status
+}
+
+// Target is the configuration of a reader or a recorder in the State. The
+// Interval is empty for the recorders.
+type Target struct {
+	Type     string `json:",omitempty"`
+	Endpoint string
+	Interval string `json:",omitempty"`
+	Timeout  string
+}
+
+// CurrentState returns the State of the readers and recorders of the conf.
+func CurrentState(conf *config.ConfMap) State {
+	s := State{
+		Time:       time.Now(),
+		Goroutines: runtime.NumGoroutine(),
+		Readers:    make(map[string]Target, len(conf.Readers)),
+		Recorders:  make(map[string]Target, len(conf.Recorders)),
+		Status:     engine.CurrentStatus(),
+	}
+	for name, red := range conf.Readers {
+		s.Readers[name] = Target{
+			Type:     red.TypeName(),
+			Endpoint: red.Endpoint(),
+			Interval: red.Interval().String(),
+			Timeout:  red.Timeout().String(),
+		}
+	}
+	for name, rec := range conf.Recorders {
+		s.Recorders[name] = Target{
+			Endpoint: rec.Endpoint(),
+			Timeout:  rec.Timeout().String(),
+		}
+	}
+	return s
+}
+
+// DumpState writes the CurrentState of the conf to w in indented json.
+func DumpState(w io.Writer, conf *config.ConfMap) error {
+	b, err := json.MarshalIndent(CurrentState(conf), "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// watchState dumps the state of the conf on the stateSignals until the
+// returned function is called. The state is written to the StateDumpFile
+// setting, replacing its contents, or it is logged if the setting is empty.
+func watchState(log tools.FieldLogger, conf *config.ConfMap) func() {
+	if len(stateSignals) == 0 {
+		return func() {}
+	}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, stateSignals...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				dumpState(log, conf)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
+
+func dumpState(log tools.FieldLogger, conf *config.ConfMap) {
+	buf := new(bytes.Buffer)
+	if err := DumpState(buf, conf); err != nil {
+		log.Errorf("dumping the state: %v", err)
+		return
+	}
+	file := conf.Settings.StateDumpFile
+	if file == "" {
+		log.Infof("state: %s", buf)
+		return
+	}
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0600); err != nil {
+		log.Errorf("dumping the state: %v", err)
+		return
+	}
+	log.Infof("dumped the state to %s", file)
+}
@@ -0,0 +1,15 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// +build !windows
+
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+// stateSignals are the signals that dump the state.
+var stateSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,13 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// +build windows
+
+package app
+
+import "os"
+
+// stateSignals is empty, there is no SIGUSR1 on windows. The state can be
+// read from the /status endpoint of the dashboard instead.
+var stateSignals []os.Signal
@@ -0,0 +1,140 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// Tail reads the readers of the names, or all the readers of the conf if the
+// names are empty, on their intervals and writes the documents that would be
+// recorded to w, without recording them. If a route maps the results of a
+// reader differently for some of its recorders, their documents are written
+// too. It stops after count reads of each reader, or when the ctx is
+// cancelled if the count is zero. The errors of the reads are logged and the
+// reader is read again on its next interval.
+func Tail(ctx context.Context, w io.Writer, log tools.FieldLogger, conf *config.ConfMap, count int, names ...string) error {
+	if len(names) == 0 {
+		names = sortedNames(conf.Readers)
+	}
+	readers := make([]reader.DataReader, 0, len(names))
+	for _, name := range names {
+		red, ok := conf.Readers[name]
+		if !ok {
+			return fmt.Errorf("reader %s is not defined", name)
+		}
+		if err := red.Ping(); err != nil {
+			return errors.Wrap(err, name)
+		}
+		readers = append(readers, red)
+	}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex // guards w.
+	)
+	for _, red := range readers {
+		wg.Add(1)
+		go func(red reader.DataReader) {
+			defer wg.Done()
+			mappers := conf.Mappers[red.Name()]
+			for i := 0; count == 0 || i < count; i++ {
+				if i > 0 {
+					select {
+					case <-time.After(red.Interval()):
+					case <-ctx.Done():
+						return
+					}
+				}
+				b, err := tailDocuments(ctx, red, mappers)
+				if err != nil {
+					log.Errorf("%s: %v", red.Name(), err)
+					continue
+				}
+				mu.Lock()
+				w.Write(b)
+				mu.Unlock()
+			}
+		}(red)
+	}
+	wg.Wait()
+	return nil
+}
+
+// tailDocuments reads the red once and returns its documents, each after a
+// header line, mapped with the mapper of the reader and the mappers of the
+// recorders.
+func tailDocuments(ctx context.Context, red reader.DataReader, mappers map[string]datatype.Mapper) ([]byte, error) {
+	if red.Timeout() > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, red.Timeout())
+		defer cancel()
+	}
+	result, err := red.Read(token.New(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	mapper := result.Mapper
+	if mapper == nil {
+		mapper = red.Mapper()
+	}
+	if mapper == nil {
+		mapper = datatype.DefaultMapper()
+	}
+	buf := new(bytes.Buffer)
+	if err = tailDocument(buf, red.Name(), result, mapper); err != nil {
+		return nil, err
+	}
+	recs := make([]string, 0, len(mappers))
+	for name := range mappers {
+		recs = append(recs, name)
+	}
+	sort.Strings(recs)
+	for _, name := range recs {
+		if err = tailDocument(buf, red.Name()+" >->> "+name, result, mappers[name]); err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// tailDocument writes the document of the result mapped with the mapper to w
+// after a header line of the title and the time of the result.
+func tailDocument(w io.Writer, title string, result *reader.Result, mapper datatype.Mapper) error {
+	payload, err := datatype.JobResultDataTypes(result.Content, mapper.Copy())
+	if err != nil {
+		return errors.Wrap(err, "map")
+	}
+	if c, ok := payload.(*datatype.Container); ok && len(result.Labels) > 0 {
+		c.SetLabels(result.Labels)
+	}
+	ts := result.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	doc := new(bytes.Buffer)
+	if _, err = payload.Generate(doc, ts); err != nil {
+		return err
+	}
+	pretty := new(bytes.Buffer)
+	if err = json.Indent(pretty, doc.Bytes(), "", "    "); err != nil {
+		return errors.Wrap(err, "document")
+	}
+	fmt.Fprintf(w, "# %s %s\n%s\n", title, ts.Format(time.RFC3339), pretty)
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/alext234/expipe/tools/config"
+)
+
+// The build information of the binary. They are set at build time, for
+// example:
+//
+//	go install -ldflags "-X github.com/alext234/expipe/internal/app.Version=v1.0.0 \
+//	    -X github.com/alext234/expipe/internal/app.Commit=$(git rev-parse HEAD) \
+//	    -X github.com/alext234/expipe/internal/app.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+func init() {
+	// The build is published as strings, so the self readers record it as
+	// keywords.
+	expvar.Publish("Build Info", expvar.Func(func() interface{} {
+		b := CurrentBuild()
+		return map[string]string{
+			"Version":   b.Version,
+			"Commit":    b.Commit,
+			"BuildDate": b.BuildDate,
+			"GoVersion": b.GoVersion,
+			"Readers":   strings.Join(b.Readers, ","),
+			"Recorders": strings.Join(b.Recorders, ","),
+		}
+	}))
+}
+
+// BuildInfo describes the build of the binary, and the types of the readers
+// and the recorders it supports.
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	BuildDate string
+	GoVersion string
+	Readers   []string
+	Recorders []string
+}
+
+// CurrentBuild returns the BuildInfo of the binary.
+func CurrentBuild() BuildInfo {
+	readers, recorders := config.Types()
+	return BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Readers:   readers,
+		Recorders: recorders,
+	}
+}
+
+// PrintVersion writes the CurrentBuild to w.
+func PrintVersion(w io.Writer) {
+	b := CurrentBuild()
+	fmt.Fprintf(w, "expipe %s\n", b.Version)
+	fmt.Fprintf(w, "commit:     %s\n", b.Commit)
+	fmt.Fprintf(w, "built:      %s\n", b.BuildDate)
+	fmt.Fprintf(w, "go:         %s\n", b.GoVersion)
+	fmt.Fprintf(w, "readers:    %s\n", strings.Join(b.Readers, ", "))
+	fmt.Fprintf(w, "recorders:  %s\n", strings.Join(b.Recorders, ", "))
+}
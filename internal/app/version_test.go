@@ -0,0 +1,42 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+
+	"github.com/alext234/expipe/internal/app"
+)
+
+func TestPrintVersion(t *testing.T) {
+	buf := new(bytes.Buffer)
+	app.PrintVersion(buf)
+	for _, want := range []string{"expipe " + app.Version, "commit:", "readers:    expvar, plugin, receiver, self", "recorders:  elasticsearch, forwarder, plugin"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output = (%s); want (%s) in it", buf, want)
+		}
+	}
+}
+
+func TestBuildInfoExpvar(t *testing.T) {
+	v := expvar.Get("Build Info")
+	if v == nil {
+		t.Fatal("Build Info is not published")
+	}
+	var info map[string]string
+	if err := json.Unmarshal([]byte(v.String()), &info); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if info["Version"] != app.Version {
+		t.Errorf("Version = (%s); want (%s)", info["Version"], app.Version)
+	}
+	if info["Readers"] != "expvar,plugin,receiver,self" {
+		t.Errorf("Readers = (%s); want (expvar,plugin,receiver,self)", info["Readers"])
+	}
+}
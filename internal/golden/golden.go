@@ -0,0 +1,92 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package golden compares the outputs of the golden-file tests of the reader
+// and recorder test suites with their golden files. The golden files are
+// written instead when the UpdateEnv environment variable is set, for example:
+//
+//    EXPIPE_UPDATE_GOLDEN=1 go test ./reader/expvar/
+//
+// The written files should be reviewed before they are committed.
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The extensions of the files of the golden-file tests. A PayloadExt file is
+// the input, and the other files with the same name are its golden files.
+const (
+	PayloadExt  = ".payload"
+	ValuesExt   = ".values"
+	DocumentExt = ".document"
+)
+
+// UpdateEnv is the environment variable that updates the golden files.
+const UpdateEnv = "EXPIPE_UPDATE_GOLDEN"
+
+// Time is the timestamp of the golden documents.
+var Time = time.Date(2016, time.November, 27, 10, 0, 0, 0, time.UTC)
+
+// Payloads returns the paths of the PayloadExt files of the dir, sorted. It
+// fails the t if there are none.
+func Payloads(t testing.TB, dir string) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+PayloadExt))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no %s files in %s", PayloadExt, dir)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// File returns the path of the golden file of the payload with the ext.
+func File(payload, ext string) string {
+	return strings.TrimSuffix(payload, PayloadExt) + ext
+}
+
+// Check compares the got with the golden file at the path, or writes the got
+// into it if the UpdateEnv is set.
+func Check(t testing.TB, path string, got []byte) {
+	if os.Getenv(UpdateEnv) != "" {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil), set %s to write it", err, UpdateEnv)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s:\ngot:\n%s\nwant:\n%s", filepath.Base(path), got, want)
+	}
+}
+
+// JSON returns the json document b indented and with its keys sorted,
+// therefore the documents are compared regardless of the order of their
+// fields. The numbers are kept as they are written.
+func JSON(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,32 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package pipeline
+
+import "fmt"
+
+// Errors returning from Pipeline operations.
+var (
+	ErrNilLogger     = fmt.Errorf("nil logger")
+	ErrNilReader     = fmt.Errorf("nil reader")
+	ErrNilRecorder   = fmt.Errorf("nil recorder")
+	ErrNilMiddleware = fmt.Errorf("nil middleware")
+	ErrRunning       = fmt.Errorf("pipeline is already running")
+	ErrNotRunning    = fmt.Errorf("pipeline is not running")
+)
+
+// DuplicateError is returned when a reader or recorder with the same name
+// already exists.
+type DuplicateError string
+
+func (e DuplicateError) Error() string {
+	return fmt.Sprintf("%s already exists", string(e))
+}
+
+// NotFoundError is returned when a reader or recorder is not found.
+type NotFoundError string
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("%s not found", string(e))
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// Middleware processes the results of a reader before they are shipped to the
+// recorders. It can change the result, or return a nil result to drop it. If
+// it returns an error, the result is discarded and the error is reported back
+// to the Engine.
+type Middleware interface {
+	Process(*reader.Result) (*reader.Result, error)
+}
+
+// MiddlewareFunc is an adapter to allow the use of ordinary functions as
+// Middleware.
+type MiddlewareFunc func(*reader.Result) (*reader.Result, error)
+
+// Process calls f(res).
+func (f MiddlewareFunc) Process(res *reader.Result) (*reader.Result, error) { return f(res) }
+
+// Chain returns a DataReader that passes the results of red through the
+// middlewares in the given order. It returns red if there are no middlewares.
+func Chain(red reader.DataReader, mws ...Middleware) reader.DataReader {
+	if len(mws) == 0 {
+		return red
+	}
+	return &chainReader{DataReader: red, mws: mws}
+}
+
+// chainReader decorates a DataReader with a chain of middlewares.
+type chainReader struct {
+	reader.DataReader
+	mws []Middleware
+}
+
+// Read reads from the underlying reader and applies the middlewares.
+func (c *chainReader) Read(job *token.Context) (*reader.Result, error) {
+	res, err := c.DataReader.Read(job)
+	if err != nil {
+		return nil, err
+	}
+	for _, mw := range c.mws {
+		if res == nil {
+			break
+		}
+		if res, err = mw.Process(res); err != nil {
+			return nil, errors.Wrap(err, "middleware")
+		}
+	}
+	if res == nil {
+		return nil, reader.ErrDropped
+	}
+	return res, nil
+}
+
+// WithMiddlewares adds the middlewares to the chain that every reader's
+// results go through. Readers added later are also affected.
+func WithMiddlewares(mws ...Middleware) Option {
+	return func(p *Pipeline) error {
+		for _, mw := range mws {
+			if mw == nil {
+				return ErrNilMiddleware
+			}
+		}
+		p.mws = append(p.mws, mws...)
+		return nil
+	}
+}
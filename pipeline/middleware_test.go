@@ -0,0 +1,154 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/pipeline"
+	"github.com/alext234/expipe/reader"
+	rdt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+func typeNameAppender(s string) pipeline.Middleware {
+	return pipeline.MiddlewareFunc(func(res *reader.Result) (*reader.Result, error) {
+		res.TypeName += s
+		return res, nil
+	})
+}
+
+func TestChainNoMiddlewares(t *testing.T) {
+	t.Parallel()
+	red := &rdt.Reader{}
+	if r := pipeline.Chain(red); r != red {
+		t.Errorf("Chain() = (%v); want (%v)", r, red)
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	t.Parallel()
+	red := &rdt.Reader{
+		ReadFunc: func(*token.Context) (*reader.Result, error) {
+			return &reader.Result{TypeName: "a", Content: []byte(`{}`)}, nil
+		},
+	}
+	r := pipeline.Chain(red, typeNameAppender("b"), typeNameAppender("c"))
+	res, err := r.Read(token.New(context.Background()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if res.TypeName != "abc" {
+		t.Errorf("res.TypeName = (%s); want (abc)", res.TypeName)
+	}
+}
+
+func TestChainDropsResult(t *testing.T) {
+	t.Parallel()
+	called := false
+	red := &rdt.Reader{
+		ReadFunc: func(*token.Context) (*reader.Result, error) {
+			return &reader.Result{}, nil
+		},
+	}
+	drop := pipeline.MiddlewareFunc(func(*reader.Result) (*reader.Result, error) {
+		return nil, nil
+	})
+	after := pipeline.MiddlewareFunc(func(res *reader.Result) (*reader.Result, error) {
+		called = true
+		return res, nil
+	})
+	res, err := pipeline.Chain(red, drop, after).Read(token.New(context.Background()))
+	if errors.Cause(err) != reader.ErrDropped {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrDropped)
+	}
+	if res != nil {
+		t.Errorf("res = (%v); want (nil)", res)
+	}
+	if called {
+		t.Error("the next middleware was called after dropping the result")
+	}
+}
+
+func TestChainErrors(t *testing.T) {
+	t.Parallel()
+	errExample := errors.New("error example")
+	red := &rdt.Reader{
+		ReadFunc: func(*token.Context) (*reader.Result, error) {
+			return nil, errExample
+		},
+	}
+	r := pipeline.Chain(red, typeNameAppender("b"))
+	if _, err := r.Read(token.New(context.Background())); errors.Cause(err) != errExample {
+		t.Errorf("err = (%v); want (%v)", err, errExample)
+	}
+
+	red.ReadFunc = func(*token.Context) (*reader.Result, error) {
+		return &reader.Result{}, nil
+	}
+	failing := pipeline.MiddlewareFunc(func(*reader.Result) (*reader.Result, error) {
+		return nil, errExample
+	})
+	if _, err := pipeline.Chain(red, failing).Read(token.New(context.Background())); errors.Cause(err) != errExample {
+		t.Errorf("err = (%v); want (%v)", err, errExample)
+	}
+}
+
+func TestWithMiddlewares(t *testing.T) {
+	t.Parallel()
+	p, err := pipeline.New(pipeline.WithMiddlewares(nil))
+	if errors.Cause(err) != pipeline.ErrNilMiddleware {
+		t.Errorf("err = (%v); want (%v)", err, pipeline.ErrNilMiddleware)
+	}
+	if p != nil {
+		t.Errorf("p = (%v); want (nil)", p)
+	}
+
+	typeNames := make(chan string, 10)
+	red := getReader("red", nil)
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:       job.ID(),
+			TypeName: "red",
+			Content:  []byte(`{"a":1}`),
+			Mapper:   red.MockMapper,
+		}, nil
+	}
+	rec := getRecorder("rec")
+	rec.RecordFunc = func(ctx context.Context, job recorder.Job) error {
+		select {
+		case typeNames <- job.TypeName:
+		default:
+		}
+		return nil
+	}
+	p, err = pipeline.New(
+		pipeline.WithLogger(tools.DiscardLogger()),
+		pipeline.WithMiddlewares(typeNameAppender("_enriched")),
+		pipeline.WithRecorders(rec),
+		pipeline.WithReader(red, "rec"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ctx := context.Background()
+	if err = p.Start(ctx); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer p.Stop(ctx)
+	select {
+	case name := <-typeNames:
+		if name != "red_enriched" {
+			t.Errorf("job.TypeName = (%s); want (red_enriched)", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("job wasn't recorded")
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package pipeline lets other Go programs run expipe in-process. A Pipeline
+// holds a set of readers and recorders and the routes between them, and it
+// does not depend on the command line flags or the configuration files.
+//
+// Usage
+//
+// Create a Pipeline with the readers and recorders, then start it:
+//
+//    p, err := pipeline.New(
+//        pipeline.WithLogger(log),
+//        pipeline.WithRecorders(rec1, rec2),
+//        pipeline.WithReader(red, rec1.Name(), rec2.Name()),
+//    )
+//    // handle the error
+//    err = p.Start(ctx)
+//    // handle the error
+//    ...
+//    err = p.Stop(ctx)
+//
+// Readers and recorders can be added or removed while the Pipeline is running.
+// Each reader runs in its own Engine, and shares the recorders with other
+// readers. All Engines of a Pipeline run on one engine.Scheduler.
+//
+// Middlewares
+//
+// You can chain Middlewares between the readers and the recorders with the
+// WithMiddlewares option. They can enrich, change or drop the results before
+// they are shipped to the recorders.
+package pipeline
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alext234/expipe/engine"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Pipeline runs an Engine for each of its readers. It is concurrent safe.
+type Pipeline struct {
+	mu        sync.Mutex
+	log       tools.FieldLogger
+	ctx       context.Context // is nil when the Pipeline is not running.
+	readers   map[string]reader.DataReader
+	recorders map[string]recorder.DataRecorder
+	routes    map[string][]string // reader name to its recorder names.
+	engines   map[string]*running
+	mws       []Middleware
+	sched     *engine.Scheduler
+	cancel    context.CancelFunc // stops the Scheduler.
+}
+
+// running holds the cancel function and the done channel of a started Engine.
+type running struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Option is used for configuring a Pipeline.
+type Option func(*Pipeline) error
+
+// New returns a Pipeline that is not started yet. It returns an error if any
+// of the options return an error.
+func New(options ...Option) (*Pipeline, error) {
+	p := &Pipeline{
+		readers:   make(map[string]reader.DataReader),
+		recorders: make(map[string]recorder.DataRecorder),
+		routes:    make(map[string][]string),
+		engines:   make(map[string]*running),
+	}
+	for _, op := range options {
+		if err := op(p); err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if p.log == nil {
+		p.log = tools.GetLogger("error")
+	}
+	return p, nil
+}
+
+// WithLogger sets the logger of the Pipeline.
+func WithLogger(log tools.FieldLogger) Option {
+	return func(p *Pipeline) error {
+		if log == nil {
+			return ErrNilLogger
+		}
+		p.log = log
+		return nil
+	}
+}
+
+// WithRecorders adds the recorders to the Pipeline.
+func WithRecorders(recs ...recorder.DataRecorder) Option {
+	return func(p *Pipeline) error {
+		for _, rec := range recs {
+			if err := p.addRecorder(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithReader adds the reader to the Pipeline and routes its results to the
+// recorders. The recorders should already be added.
+func WithReader(red reader.DataReader, recorders ...string) Option {
+	return func(p *Pipeline) error {
+		return p.addReader(red, recorders)
+	}
+}
+
+// Start starts an Engine for each reader. The Pipeline stops when the ctx is
+// cancelled or the Stop method is called. If any of the Engines can't be
+// created, none of them will be started and the error is returned.
+func (p *Pipeline) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx != nil {
+		return ErrRunning
+	}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	p.sched = engine.NewScheduler(p.ctx, 0)
+	for name := range p.readers {
+		if err := p.startEngine(name); err != nil {
+			p.stopEngines()
+			p.cancel()
+			p.ctx = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops all Engines and waits for them to finish their work. It returns
+// the ctx's error if it is done before all Engines are stopped.
+func (p *Pipeline) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if p.ctx == nil {
+		p.mu.Unlock()
+		return ErrNotRunning
+	}
+	engines := p.stopEngines()
+	cancel := p.cancel
+	p.ctx = nil
+	p.mu.Unlock()
+
+	defer cancel()
+	for _, r := range engines {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// AddReader adds the reader and routes its results to the recorders. If the
+// Pipeline is running, the reader's Engine is started immediately.
+func (p *Pipeline) AddReader(red reader.DataReader, recorders ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.addReader(red, recorders); err != nil {
+		return err
+	}
+	if p.ctx == nil {
+		return nil
+	}
+	if err := p.startEngine(red.Name()); err != nil {
+		delete(p.readers, red.Name())
+		delete(p.routes, red.Name())
+		return err
+	}
+	return nil
+}
+
+// RemoveReader stops the reader's Engine if running and removes the reader.
+func (p *Pipeline) RemoveReader(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.readers[name]; !ok {
+		return NotFoundError(name)
+	}
+	if r, ok := p.engines[name]; ok {
+		r.cancel()
+		delete(p.engines, name)
+	}
+	delete(p.readers, name)
+	delete(p.routes, name)
+	return nil
+}
+
+// AddRecorder adds the recorder. You can route readers to this recorder when
+// you add them.
+func (p *Pipeline) AddRecorder(rec recorder.DataRecorder) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.addRecorder(rec)
+}
+
+// Readers returns the names of the readers.
+func (p *Pipeline) Readers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.readers))
+	for name := range p.readers {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (p *Pipeline) addRecorder(rec recorder.DataRecorder) error {
+	if rec == nil {
+		return ErrNilRecorder
+	}
+	if _, ok := p.recorders[rec.Name()]; ok {
+		return DuplicateError(rec.Name())
+	}
+	p.recorders[rec.Name()] = rec
+	return nil
+}
+
+func (p *Pipeline) addReader(red reader.DataReader, recorders []string) error {
+	if red == nil {
+		return ErrNilReader
+	}
+	if _, ok := p.readers[red.Name()]; ok {
+		return DuplicateError(red.Name())
+	}
+	if len(recorders) == 0 {
+		return engine.ErrNoRecorder
+	}
+	for _, name := range recorders {
+		if _, ok := p.recorders[name]; !ok {
+			return NotFoundError(name)
+		}
+	}
+	p.readers[red.Name()] = red
+	p.routes[red.Name()] = recorders
+	return nil
+}
+
+// startEngine should be called while the lock is held.
+func (p *Pipeline) startEngine(name string) error {
+	recs := make([]recorder.DataRecorder, 0, len(p.routes[name]))
+	for _, rec := range p.routes[name] {
+		recs = append(recs, p.recorders[rec])
+	}
+	ctx, cancel := context.WithCancel(p.ctx)
+	en, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(p.log),
+		engine.WithReader(Chain(p.readers[name], p.mws...)),
+		engine.WithRecorders(recs...),
+	)
+	if err != nil {
+		cancel()
+		return errors.Wrapf(err, "creating engine for %s", name)
+	}
+	p.engines[name] = &running{cancel: cancel, done: p.sched.Start(en)}
+	return nil
+}
+
+// stopEngines cancels all the Engines and returns them. It should be called
+// while the lock is held.
+func (p *Pipeline) stopEngines() map[string]*running {
+	engines := p.engines
+	for _, r := range engines {
+		r.cancel()
+	}
+	p.engines = make(map[string]*running)
+	return engines
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/alext234/expipe/pipeline"
+	"github.com/alext234/expipe/reader"
+	rdt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/recorder"
+	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/tools"
+)
+
+// You can run a Pipeline inside your own application. In this example we are
+// using the mocked versions of a reader and a recorder.
+func ExamplePipeline() {
+	log := tools.DiscardLogger()
+	recorded := make(chan struct{}, 10)
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/record" {
+				select {
+				case recorded <- struct{}{}:
+				default:
+				}
+			}
+			w.Write([]byte(`{"the key": "is the value!"}`))
+		},
+	))
+	defer ts.Close()
+
+	red, _ := rdt.New(
+		reader.WithLogger(log),
+		reader.WithEndpoint(ts.URL),
+		reader.WithName("my_app"),
+		reader.WithInterval(10*time.Millisecond),
+	)
+	rec, _ := rct.New(
+		recorder.WithLogger(log),
+		recorder.WithEndpoint(ts.URL+"/record"),
+		recorder.WithName("elasticsearch"),
+	)
+	p, err := pipeline.New(
+		pipeline.WithLogger(log),
+		pipeline.WithRecorders(rec),
+		pipeline.WithReader(red, "elasticsearch"),
+	)
+	fmt.Println("Creation error:", err)
+
+	ctx := context.Background()
+	fmt.Println("Start error:", p.Start(ctx))
+	<-recorded
+	fmt.Println("Data was recorded")
+	fmt.Println("Stop error:", p.Stop(ctx))
+
+	// Output:
+	// Creation error: <nil>
+	// Start error: <nil>
+	// Data was recorded
+	// Stop error: <nil>
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/engine"
+	"github.com/alext234/expipe/pipeline"
+	"github.com/alext234/expipe/reader"
+	rdt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/recorder"
+	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+func getReader(name string, called chan string) *rdt.Reader {
+	return &rdt.Reader{
+		MockName:     name,
+		MockInterval: 10 * time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+		PingFunc:     func() error { return nil },
+		ReadFunc: func(*token.Context) (*reader.Result, error) {
+			select {
+			case called <- name:
+			default:
+			}
+			return nil, nil
+		},
+	}
+}
+
+func getRecorder(name string) *rct.Recorder {
+	return &rct.Recorder{
+		MockName: name,
+		PingFunc: func() error { return nil },
+		RecordFunc: func(context.Context, recorder.Job) error {
+			return nil
+		},
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	t.Parallel()
+	rec := getRecorder("rec")
+	red := getReader("red", nil)
+	tcs := []struct {
+		name    string
+		options []pipeline.Option
+		err     error
+	}{
+		{"nil logger", []pipeline.Option{pipeline.WithLogger(nil)}, pipeline.ErrNilLogger},
+		{"nil recorder", []pipeline.Option{pipeline.WithRecorders(nil)}, pipeline.ErrNilRecorder},
+		{"nil reader", []pipeline.Option{pipeline.WithReader(nil, "rec")}, pipeline.ErrNilReader},
+		{"no recorders", []pipeline.Option{pipeline.WithReader(red)}, engine.ErrNoRecorder},
+		{"duplicate recorder", []pipeline.Option{pipeline.WithRecorders(rec, rec)}, pipeline.DuplicateError("rec")},
+		{"recorder not found", []pipeline.Option{pipeline.WithReader(red, "rec")}, pipeline.NotFoundError("rec")},
+		{"duplicate reader", []pipeline.Option{
+			pipeline.WithRecorders(rec),
+			pipeline.WithReader(red, "rec"),
+			pipeline.WithReader(red, "rec"),
+		}, pipeline.DuplicateError("red")},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := pipeline.New(tc.options...)
+			if errors.Cause(err) != tc.err {
+				t.Errorf("err = (%v); want (%v)", err, tc.err)
+			}
+			if p != nil {
+				t.Errorf("p = (%v); want (nil)", p)
+			}
+		})
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	t.Parallel()
+	called := make(chan string)
+	p, err := pipeline.New(
+		pipeline.WithLogger(tools.DiscardLogger()),
+		pipeline.WithRecorders(getRecorder("rec")),
+		pipeline.WithReader(getReader("red", called), "rec"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ctx := context.Background()
+	if err = p.Stop(ctx); err != pipeline.ErrNotRunning {
+		t.Errorf("err = (%v); want (%v)", err, pipeline.ErrNotRunning)
+	}
+	if err = p.Start(ctx); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = p.Start(ctx); err != pipeline.ErrRunning {
+		t.Errorf("err = (%v); want (%v)", err, pipeline.ErrRunning)
+	}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("reader wasn't called")
+	}
+	if err = p.Stop(ctx); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	time.Sleep(30 * time.Millisecond) // let the in-flight job finish.
+	select {
+	case <-called:
+	default:
+	}
+	select {
+	case <-called:
+		t.Error("reader was called after stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStartError(t *testing.T) {
+	t.Parallel()
+	red := getReader("red", nil)
+	red.PingFunc = func() error { return errors.New("not available") }
+	p, err := pipeline.New(
+		pipeline.WithLogger(tools.DiscardLogger()),
+		pipeline.WithRecorders(getRecorder("rec")),
+		pipeline.WithReader(red, "rec"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err = p.Start(context.Background())
+	if _, ok := errors.Cause(err).(engine.PingError); !ok {
+		t.Errorf("err = (%#v); want (engine.PingError)", err)
+	}
+	if err = p.Stop(context.Background()); err != pipeline.ErrNotRunning {
+		t.Errorf("err = (%v); want (%v)", err, pipeline.ErrNotRunning)
+	}
+}
+
+func TestAddRemoveReader(t *testing.T) {
+	t.Parallel()
+	called := make(chan string)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := pipeline.New(pipeline.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = p.Start(ctx); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = p.AddReader(getReader("red", called), "rec"); err != pipeline.NotFoundError("rec") {
+		t.Errorf("err = (%v); want (%v)", err, pipeline.NotFoundError("rec"))
+	}
+	if err = p.AddRecorder(getRecorder("rec")); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = p.AddReader(getReader("red", called), "rec"); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("reader wasn't called")
+	}
+	if len(p.Readers()) != 1 {
+		t.Errorf("len(p.Readers()) = (%d); want (1)", len(p.Readers()))
+	}
+	if err = p.RemoveReader("red"); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if err = p.RemoveReader("red"); err != pipeline.NotFoundError("red") {
+		t.Errorf("err = (%v); want (%v)", err, pipeline.NotFoundError("red"))
+	}
+	if len(p.Readers()) != 0 {
+		t.Errorf("len(p.Readers()) = (%d); want (0)", len(p.Readers()))
+	}
+	if err = p.Stop(ctx); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestAddReaderPingError(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := pipeline.New(
+		pipeline.WithLogger(tools.DiscardLogger()),
+		pipeline.WithRecorders(getRecorder("rec")),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = p.Start(ctx); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	red := getReader("red", nil)
+	red.PingFunc = func() error { return errors.New("not available") }
+	err = p.AddReader(red, "rec")
+	if _, ok := errors.Cause(err).(engine.PingError); !ok {
+		t.Errorf("err = (%#v); want (engine.PingError)", err)
+	}
+	if len(p.Readers()) != 0 {
+		t.Errorf("len(p.Readers()) = (%d); want (0)", len(p.Readers()))
+	}
+}
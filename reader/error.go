@@ -11,12 +11,23 @@ import (
 
 // Errors regarding reading from an endpoint.
 var (
-	ErrEmptyName     = fmt.Errorf("name cannot be empty")
-	ErrEmptyEndpoint = fmt.Errorf("endpoint cannot be empty")
-	ErrEmptyTypeName = fmt.Errorf("type_name cannot be empty")
-	ErrPingNotCalled = fmt.Errorf("the caller forgot to ask me pinging")
-	ErrInvalidJSON   = fmt.Errorf("payload is invalid JSON object")
-	ErrNillLogger    = fmt.Errorf("nil logger")
+	ErrEmptyName           = fmt.Errorf("name cannot be empty")
+	ErrEmptyEndpoint       = fmt.Errorf("endpoint cannot be empty")
+	ErrEmptyTypeName       = fmt.Errorf("type_name cannot be empty")
+	ErrPingNotCalled       = fmt.Errorf("the caller forgot to ask me pinging")
+	ErrInvalidJSON         = fmt.Errorf("payload is invalid JSON object")
+	ErrNillLogger          = fmt.Errorf("nil logger")
+	ErrNilHTTPClient       = fmt.Errorf("nil http client")
+	ErrEmptyTimestampField = fmt.Errorf("timestamp field cannot be empty")
+	ErrEmptyLabelName      = fmt.Errorf("label name cannot be empty")
+
+	// ErrDropped is returned when the result is intentionally dropped, for
+	// example by a middleware. The Engine does not treat it as a failure.
+	ErrDropped = fmt.Errorf("result was dropped")
+
+	// ErrNotModified is returned by the conditional fetches when the payload
+	// of the endpoint has not changed since the last fetch.
+	ErrNotModified = fmt.Errorf("not modified")
 )
 
 // InvalidEndpointError is the error when the endpoint is not a valid URL.
@@ -49,3 +60,25 @@ type LowTimeoutError time.Duration
 func (e LowTimeoutError) Error() string {
 	return fmt.Sprintf("timeout should be more than 1 second: %d", e)
 }
+
+// TimestampError is returned when the timestamp can't be taken from the
+// content of a result.
+type TimestampError struct {
+	Field string
+	Err   error
+}
+
+func (e TimestampError) Error() string {
+	return fmt.Sprintf("timestamp field (%s): %s", e.Field, e.Err)
+}
+
+// BodyTooLargeError is returned when the body of the endpoint is larger than
+// the limit.
+type BodyTooLargeError struct {
+	Endpoint string
+	Limit    int64
+}
+
+func (e BodyTooLargeError) Error() string {
+	return fmt.Sprintf("body of %s is larger than %d bytes", e.Endpoint, e.Limit)
+}
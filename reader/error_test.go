@@ -39,6 +39,12 @@ func TestLowTimeoutError(t *testing.T) {
 	check(t, e.Error(), strconv.Itoa(timeout))
 }
 
+func TestBodyTooLargeError(t *testing.T) {
+	e := reader.BodyTooLargeError{Endpoint: "the endpoint", Limit: 1024}
+	check(t, e.Error(), "the endpoint")
+	check(t, e.Error(), "1024")
+}
+
 func check(t *testing.T, err, msg string) {
 	if !strings.Contains(err, msg) {
 		t.Errorf("Contains(err, msg): want (%s) to be in (%s)", msg, err)
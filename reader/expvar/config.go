@@ -7,29 +7,87 @@ package expvar
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/pinger"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
 // Config holds the necessary configuration for setting up an expvar reader
 // endpoint. If MapFile is provided, the data will be mapped, otherwise it uses
-// the DefaultMapper.
+// the DefaultMapper. The endpoint is pinged with a HEAD request unless the
+// ping_method or ping_path are set, and it is re-checked in the background on
+// every ping_interval if set. The requests are sent through the proxy_url if
+// set, otherwise through the proxy of the environment, and the certificate of
+// the client_cert_file and client_key_file is presented to the endpoint if
+// they are set. The gc_types, memory_bytes, summary_types, array_policies,
+// key_rules, computed_fields and malformed_values of the reader are added to
+// the mappings of the mapper, and the flatten block sets how the nested
+// objects are flattened. The labels are recorded with all the values of the
+// reader, and their numbers are written with the precision decimal places if
+// it is set. The keys start with the key_prefix, or with the name of the
+// reader if namespace is true. The fields are added to all the documents of
+// the reader, and the locations of the IP addresses of the geoip fields are
+// added with the geoip database. The values of the keys that match the redact
+// patterns are removed or hashed, and the values of the new keys are dropped
+// once the reader has max_keys distinct keys. The bodies of the endpoint that
+// are larger than max_body_size bytes, 32MB by default, are not read. If
+// conditional is true, the endpoint is asked with the ETag and Last-Modified
+// of its last response and the reads of the unchanged payloads are skipped.
 type Config struct {
-	log          tools.FieldLogger
-	EXPTypeName  string `mapstructure:"type_name"`
-	EXPEndpoint  string `mapstructure:"endpoint"`
-	EXPInterval  string `mapstructure:"interval"`
-	EXPTimeout   string `mapstructure:"timeout"`
-	MapFile      string `mapstructure:"map_file"`
-	EXPName      string
-	ConfInterval time.Duration
-	ConfTimeout  time.Duration
-	mapper       datatype.Mapper
+	log              tools.FieldLogger
+	EXPTypeName      string                 `mapstructure:"type_name"`
+	EXPEndpoint      string                 `mapstructure:"endpoint"`
+	EXPInterval      string                 `mapstructure:"interval"`
+	EXPTimeout       string                 `mapstructure:"timeout"`
+	MapFile          string                 `mapstructure:"map_file"`
+	TSField          string                 `mapstructure:"timestamp_field"`
+	TSFormat         string                 `mapstructure:"timestamp_format"`
+	PingMethod       string                 `mapstructure:"ping_method"`
+	PingPath         string                 `mapstructure:"ping_path"`
+	PingInterval     string                 `mapstructure:"ping_interval"`
+	ProxyURL         string                 `mapstructure:"proxy_url"`
+	ClientCertFile   string                 `mapstructure:"client_cert_file"`
+	ClientKeyFile    string                 `mapstructure:"client_key_file"`
+	GCTypes          []string               `mapstructure:"gc_types"`
+	MemoryBytes      map[string]interface{} `mapstructure:"memory_bytes"`
+	SummaryTypes     []string               `mapstructure:"summary_types"`
+	Labels           map[string]string      `mapstructure:"labels"`
+	Flatten          datatype.Flatten       `mapstructure:"flatten"`
+	ArrayPolicies    map[string]interface{} `mapstructure:"array_policies"`
+	KeyRules         []datatype.KeyRule     `mapstructure:"key_rules"`
+	ComputedFields   map[string]interface{} `mapstructure:"computed_fields"`
+	MalformedValues  string                 `mapstructure:"malformed_values"`
+	Precision        *int                   `mapstructure:"precision"`
+	KeyPrefix        string                 `mapstructure:"key_prefix"`
+	Namespace        bool                   `mapstructure:"namespace"`
+	Fields           map[string]interface{} `mapstructure:"fields"`
+	GeoIP            datatype.GeoIP         `mapstructure:"geoip"`
+	MaxKeys          int                    `mapstructure:"max_keys"`
+	MaxBodySize      int64                  `mapstructure:"max_body_size"`
+	Conditional      bool                   `mapstructure:"conditional"`
+	Redact           []datatype.Redaction   `mapstructure:"redact"`
+	EXPName          string
+	ConfInterval     time.Duration
+	ConfTimeout      time.Duration
+	ConfPingInterval time.Duration
+	mapper           datatype.Mapper
+}
+
+func init() {
+	reader.Register("expvar", func(src reader.Source, log tools.FieldLogger, name, key string) (reader.DataReader, error) {
+		rc, err := NewConfig(WithLogger(log), WithViper(src, name, key))
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing reader")
+		}
+		return rc.Reader()
+	})
 }
 
 // Conf func is used for initializing a Config object.
@@ -51,9 +109,10 @@ func NewConfig(conf ...Conf) (*Config, error) {
 	return obj, nil
 }
 
-// Reader implements the ReaderConf interface.
+// Reader implements the ReaderConf interface. If the timestamp_field is set,
+// the time of the results is taken from that field.
 func (c *Config) Reader() (reader.DataReader, error) {
-	return New(
+	options := []func(reader.Constructor) error{
 		reader.WithLogger(c.Logger()),
 		reader.WithEndpoint(c.Endpoint()),
 		reader.WithMapper(c.mapper),
@@ -61,7 +120,40 @@ func (c *Config) Reader() (reader.DataReader, error) {
 		reader.WithTypeName(c.EXPTypeName),
 		reader.WithInterval(c.Interval()),
 		reader.WithTimeout(c.Timeout()),
-	)
+	}
+	if c.TSField != "" {
+		options = append(options, reader.WithTimestamp(c.TSField, c.TSFormat))
+	}
+	if len(c.Labels) > 0 {
+		options = append(options, reader.WithLabels(c.Labels))
+	}
+	if c.MaxBodySize > 0 {
+		options = append(options, WithMaxBodySize(c.MaxBodySize))
+	}
+	if c.Conditional {
+		options = append(options, WithConditional())
+	}
+	if c.ProxyURL != "" || c.ClientCertFile != "" || c.ClientKeyFile != "" {
+		client, err := httpclient.WithClientCert(c.ProxyURL, c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "http client")
+		}
+		options = append(options, reader.WithHTTPClient(client))
+	}
+	var pingOpts []func(*pinger.Pinger) error
+	if c.PingMethod != "" {
+		pingOpts = append(pingOpts, pinger.WithMethod(c.PingMethod))
+	}
+	if c.PingPath != "" {
+		pingOpts = append(pingOpts, pinger.WithPath(c.PingPath))
+	}
+	if c.ConfPingInterval > 0 {
+		pingOpts = append(pingOpts, pinger.WithInterval(c.ConfPingInterval))
+	}
+	if len(pingOpts) > 0 {
+		options = append(options, withPing(pingOpts...))
+	}
+	return New(options...)
 }
 
 // Name returns name from the config file.
@@ -125,10 +217,75 @@ func WithViper(v unmarshaller, name, key string) Conf {
 			return fmt.Errorf("type_name cannot be empty: %s", c.EXPTypeName)
 		}
 		c.ConfTimeout = timeout
+		if c.PingInterval != "" {
+			if c.ConfPingInterval, err = time.ParseDuration(c.PingInterval); err != nil {
+				return errors.Wrapf(err, "parse ping_interval (%v)", c.PingInterval)
+			}
+		}
 		c.EXPName = name
 		if c.MapFile != "" {
 			WithMapFile(c.MapFile)
 		}
+		if err := datatype.CheckArrayPolicies(datatype.FlatNames(c.ArrayPolicies)); err != nil {
+			return err
+		}
+		if err := datatype.CheckMalformedPolicy(c.MalformedValues); err != nil {
+			return err
+		}
+		if c.Precision != nil && *c.Precision < 0 {
+			return errors.Errorf("precision cannot be negative: %d", *c.Precision)
+		}
+		if c.KeyPrefix != "" && c.Namespace {
+			return errors.New("key_prefix and namespace cannot be used together")
+		}
+		if c.MaxKeys < 0 {
+			return errors.Errorf("max_keys cannot be negative: %d", c.MaxKeys)
+		}
+		if c.MaxBodySize < 0 {
+			return errors.Errorf("max_body_size cannot be negative: %d", c.MaxBodySize)
+		}
+		if c.Flatten.MaxDepth < 0 {
+			return errors.Errorf("flatten.max_depth cannot be negative: %d", c.Flatten.MaxDepth)
+		}
+		if len(c.GCTypes) > 0 || len(c.MemoryBytes) > 0 || len(c.SummaryTypes) > 0 || len(c.ArrayPolicies) > 0 ||
+			len(c.KeyRules) > 0 || len(c.ComputedFields) > 0 ||
+			c.MalformedValues != "" || c.Precision != nil || c.KeyPrefix != "" || c.Namespace ||
+			len(c.Fields) > 0 || c.GeoIP.Database != "" ||
+			len(c.GeoIP.Fields) > 0 || c.MaxKeys > 0 || len(c.Redact) > 0 || c.Flatten != (datatype.Flatten{}) {
+			// gc_types can be written as a block of names.
+			gcTypes := strings.Fields(strings.Join(c.GCTypes, " "))
+			mapper := datatype.DefaultMapper().Extend(gcTypes, datatype.FlatMemoryTypes(c.MemoryBytes))
+			mapper.SummaryTypes = append(mapper.SummaryTypes, strings.Fields(strings.Join(c.SummaryTypes, " "))...)
+			if len(c.ArrayPolicies) > 0 {
+				mapper = mapper.WithArrayPolicies(datatype.FlatNames(c.ArrayPolicies))
+			}
+			if mapper, err = mapper.WithKeyRules(c.KeyRules); err != nil {
+				return err
+			}
+			if mapper, err = mapper.WithComputedFields(datatype.FlatNames(c.ComputedFields)); err != nil {
+				return errors.Wrap(err, "computed_fields")
+			}
+			mapper.Flatten = c.Flatten
+			mapper.Malformed = strings.ToLower(c.MalformedValues)
+			mapper.Precision = c.Precision
+			mapper.KeyPrefix = c.KeyPrefix
+			if c.Namespace {
+				mapper.KeyPrefix = name + c.Flatten.Separator()
+			}
+			mapper = mapper.WithFields(datatype.FlatNames(c.Fields))
+			if c.GeoIP.Database != "" || len(c.GeoIP.Fields) > 0 {
+				if mapper, err = mapper.WithGeoIP(c.GeoIP); err != nil {
+					return errors.Wrap(err, "geoip")
+				}
+			}
+			if mapper, err = mapper.WithRedactions(c.Redact); err != nil {
+				return err
+			}
+			if c.MaxKeys > 0 {
+				mapper.KeyGuard = datatype.NewKeyGuard(name, c.MaxKeys)
+			}
+			c.mapper = mapper
+		}
 
 		return nil
 	}
@@ -6,16 +6,24 @@ package expvar_test
 
 import (
 	"bytes"
+	"context"
+	goexpvar "expvar"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader/expvar"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/token"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
@@ -106,6 +114,52 @@ func TestWithViperSuccess(t *testing.T) {
 	}
 }
 
+func TestWithViperMappings(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            gc_types:
+                Latencies
+                PauseNs
+            memory_bytes:
+                Alloc: kb
+                CacheSize: gb
+            summary_types:
+                - PauseNs
+            labels:
+                instance: app1
+    `))
+	c, err := expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	m, ok := c.Mapper().(*datatype.MapConvert)
+	if !ok {
+		t.Fatalf("c.Mapper() = (%T); want (*datatype.MapConvert)", c.Mapper())
+	}
+	if !tools.StringInSlice("Latencies", m.GCTypes) || !tools.StringInSlice("memstats.PauseNs", m.GCTypes) {
+		t.Errorf("m.GCTypes = (%v); want the default and the reader's types", m.GCTypes)
+	}
+	if m.MemoryTypes["alloc"] != "kb" || m.MemoryTypes["cachesize"] != "gb" || m.MemoryTypes["sys"] != "mb" {
+		t.Errorf("m.MemoryTypes = (%v); want the reader's types on top of the defaults", m.MemoryTypes)
+	}
+	if c.Labels["instance"] != "app1" {
+		t.Errorf("c.Labels = (%v); want (map[instance:app1])", c.Labels)
+	}
+	if !tools.StringInSlice("PauseNs", m.SummaryTypes) {
+		t.Errorf("m.SummaryTypes = (%v); want the reader's types", m.SummaryTypes)
+	}
+	if datatype.DefaultMapper().MemoryTypes["alloc"] != "mb" {
+		t.Error("the default mapper has changed")
+	}
+}
+
 type badMarshaller struct{}
 
 func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
@@ -240,3 +294,569 @@ func TestConfigReader(t *testing.T) {
 		t.Error("e.(*expvar.Reader) = (nil); want (Reader)")
 	}
 }
+
+func TestConfigReaderTimestamp(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"meta":{"time":"2016-05-06T07:08:09Z"}}`))
+	}))
+	defer ts.Close()
+	c, err := expvar.NewConfig(expvar.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.EXPName = "name"
+	c.EXPTypeName = "name"
+	c.EXPEndpoint = ts.URL
+	c.ConfInterval = time.Second
+	c.ConfTimeout = time.Second
+	c.TSField = "meta.time"
+	red, err := c.Reader()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	res, err := red.Read(token.New(context.Background()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := time.Date(2016, 5, 6, 7, 8, 9, 0, time.UTC)
+	if !res.Time.Equal(want) {
+		t.Errorf("res.Time = (%v); want (%v)", res.Time, want)
+	}
+}
+
+func TestConfigReaderPing(t *testing.T) {
+	pings := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case pings <- r.Method + " " + r.URL.Path:
+		default:
+		}
+	}))
+	defer ts.Close()
+	c, err := expvar.NewConfig(expvar.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.EXPName = "name"
+	c.EXPTypeName = "name"
+	c.EXPEndpoint = ts.URL
+	c.ConfInterval = time.Second
+	c.ConfTimeout = time.Second
+	c.PingMethod = "get"
+	c.PingPath = "/health"
+	red, err := c.Reader()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got := <-pings; got != "GET /health" {
+		t.Errorf("ping = (%s); want (GET /health)", got)
+	}
+
+	c.PingMethod = "POST"
+	_, err = c.Reader()
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestConfigReaderPingIntervalClose(t *testing.T) {
+	pings := make(chan struct{}, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case pings <- struct{}{}:
+		default:
+		}
+	}))
+	defer ts.Close()
+	c, err := expvar.NewConfig(expvar.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.EXPName = "ping_interval_close"
+	c.EXPTypeName = "name"
+	c.EXPEndpoint = ts.URL
+	c.ConfInterval = time.Second
+	c.ConfTimeout = time.Second
+	c.ConfPingInterval = 10 * time.Millisecond
+	red, err := c.Reader()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	closer, ok := red.(io.Closer)
+	if !ok {
+		t.Fatalf("red = (%T); want (io.Closer)", red)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-pings:
+		case <-time.After(time.Second):
+			t.Fatalf("%d: no background pings", i)
+		}
+	}
+	if err = closer.Close(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	time.Sleep(20 * time.Millisecond) // lets the ping in flight finish.
+	for len(pings) > 0 {
+		<-pings
+	}
+	select {
+	case <-pings:
+		t.Error("background pings continued after Close")
+	case <-time.After(50 * time.Millisecond):
+	}
+	gauge := goexpvar.Get("Endpoint Health").(*goexpvar.Map).Get(c.EXPName)
+	if gauge == nil {
+		t.Errorf("no health gauge for (%s)", c.EXPName)
+	}
+}
+
+func TestConfigReaderProxy(t *testing.T) {
+	requests := make(chan string, 10)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requests <- r.Method + " " + r.URL.String():
+		default:
+		}
+		w.Write([]byte(`{"var": 1}`))
+	}))
+	defer proxy.Close()
+	c, err := expvar.NewConfig(expvar.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.EXPName = "name"
+	c.EXPTypeName = "name"
+	c.EXPEndpoint = "http://app.internal/debug/vars"
+	c.ConfInterval = time.Second
+	c.ConfTimeout = time.Second
+	c.ProxyURL = proxy.URL
+	red, err := c.Reader()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got := <-requests; got != "HEAD http://app.internal/debug/vars" {
+		t.Errorf("request = (%s); want (HEAD http://app.internal/debug/vars)", got)
+	}
+
+	c.ProxyURL = "ftp://localhost:21"
+	if _, err = c.Reader(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestConfigReaderClientCert(t *testing.T) {
+	c, err := expvar.NewConfig(expvar.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.EXPName = "name"
+	c.EXPTypeName = "name"
+	c.EXPEndpoint = "http://app.internal/debug/vars"
+	c.ConfInterval = time.Second
+	c.ConfTimeout = time.Second
+	c.ClientCertFile = "/etc/expipe/client.pem"
+	if _, err = c.Reader(); errors.Cause(err) != httpclient.ErrIncompleteCert {
+		t.Errorf("err = (%v); want (ErrIncompleteCert)", err)
+	}
+	c.ClientKeyFile = "/etc/expipe/client.key"
+	if _, err = c.Reader(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperFlatten(t *testing.T) {
+	tcs := []struct {
+		name    string
+		flatten string
+		want    datatype.Flatten
+		wantErr bool
+	}{
+		{"delimiter", "delimiter: _", datatype.Flatten{Delimiter: "_"}, false},
+		{"max depth", "max_depth: 3", datatype.Flatten{MaxDepth: 3}, false},
+		{"keep nested", "keep_nested: true", datatype.Flatten{KeepNested: true}, false},
+		{"negative max depth", "max_depth: -1", datatype.Flatten{}, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            flatten:
+                ` + tc.flatten + "\n"))
+			c, err := expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+			if tc.wantErr {
+				if err == nil {
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			m := c.Mapper().(*datatype.MapConvert)
+			if m.Flatten != tc.want {
+				t.Errorf("m.Flatten = (%v); want (%v)", m.Flatten, tc.want)
+			}
+			if datatype.DefaultMapper().Flatten != (datatype.Flatten{}) {
+				t.Error("the default mapper has changed")
+			}
+		})
+	}
+}
+
+func TestWithViperArrayPolicies(t *testing.T) {
+	read := func(policies string) (*expvar.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            array_policies:
+` + policies))
+		return expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	}
+	c, err := read("                Latencies: mean\n                memstats.PauseNs: last\n")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	m := c.Mapper().(*datatype.MapConvert)
+	if m.ArrayPolicies["latencies"] != datatype.Mean || m.ArrayPolicies["memstats.pausens"] != datatype.LastValue {
+		t.Errorf("m.ArrayPolicies = (%v); want the reader's policies", m.ArrayPolicies)
+	}
+	if _, err = read("                Latencies: median\n"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperKeyRules(t *testing.T) {
+	read := func(rules string) (*expvar.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            key_rules:
+` + rules))
+		return expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	}
+	c, err := read("                - match: ^memstats\\.Pause(.*)$\n                  rename: gc.pause_${1}\n                  array_policy: mean\n")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	m := c.Mapper().(*datatype.MapConvert)
+	if len(m.KeyRules) != 1 || m.KeyRules[0].Rename != "gc.pause_${1}" || m.KeyRules[0].ArrayPolicy != datatype.Mean {
+		t.Errorf("m.KeyRules = (%v); want the reader's rules", m.KeyRules)
+	}
+	if _, err = read("                - match: memstats(\n"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperComputedFields(t *testing.T) {
+	read := func(fields string) (*expvar.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            computed_fields:
+` + fields))
+		return expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	}
+	c, err := read("                heap_used_ratio: memstats.HeapInuse / memstats.HeapSys\n")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	m := c.Mapper().(*datatype.MapConvert)
+	if e, ok := m.ComputedFields["heap_used_ratio"]; !ok || e.String() != "memstats.HeapInuse / memstats.HeapSys" {
+		t.Errorf("m.ComputedFields = (%v); want the reader's fields", m.ComputedFields)
+	}
+	if _, err = read("                bad: memstats.HeapInuse /\n"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperMalformedValues(t *testing.T) {
+	read := func(policy string) (*expvar.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            malformed_values: ` + policy))
+		return expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	}
+	c, err := read("Fail")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if m := c.Mapper().(*datatype.MapConvert); m.Malformed != datatype.MalformedFail {
+		t.Errorf("m.Malformed = (%s); want (%s)", m.Malformed, datatype.MalformedFail)
+	}
+	if _, err = read("zero"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperPrecision(t *testing.T) {
+	read := func(precision string) (*expvar.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            precision: ` + precision))
+		return expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	}
+	c, err := read("3")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if m := c.Mapper().(*datatype.MapConvert); m.Precision == nil || *m.Precision != 3 {
+		t.Errorf("m.Precision = (%v); want (3)", m.Precision)
+	}
+	if _, err = read("-1"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperKeyPrefix(t *testing.T) {
+	read := func(extra string) (*expvar.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+` + extra))
+		return expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	}
+	tcs := []struct {
+		name  string
+		extra string
+		want  string
+	}{
+		{"key_prefix", "            key_prefix: payments.\n", "payments."},
+		{"namespace", "            namespace: true\n", "reader1."},
+		{"namespace delimiter", "            namespace: true\n            flatten:\n                delimiter: _\n", "reader1_"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := read(tc.extra)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if m := c.Mapper().(*datatype.MapConvert); m.KeyPrefix != tc.want {
+				t.Errorf("m.KeyPrefix = (%s); want (%s)", m.KeyPrefix, tc.want)
+			}
+		})
+	}
+	if _, err := read("            key_prefix: payments.\n            namespace: true\n"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperFields(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            fields:
+                env: prod
+                version: 1.2
+    `))
+	c, err := expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	m := c.Mapper().(*datatype.MapConvert)
+	if m.Fields["env"] != "prod" || m.Fields["version"] != "1.2" {
+		t.Errorf("m.Fields = (%v); want the reader's fields", m.Fields)
+	}
+}
+
+func TestWithViperGeoIP(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            geoip:
+                database: /does/not/exist.mmdb
+                fields: [client_ip]
+    `))
+	_, err := expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	if err == nil || !strings.Contains(err.Error(), "geoip") {
+		t.Errorf("err = (%v); want geoip error", err)
+	}
+}
+
+func TestWithViperMaxKeys(t *testing.T) {
+	read := func(maxKeys string) (*expvar.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            max_keys: ` + maxKeys))
+		return expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	}
+	c, err := read("1000")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	m := c.Mapper().(*datatype.MapConvert)
+	if m.KeyGuard == nil || m.KeyGuard.MaxKeys != 1000 || m.KeyGuard.Name != "reader1" {
+		t.Errorf("m.KeyGuard = (%v); want a guard of 1000 keys", m.KeyGuard)
+	}
+	if m.Copy().(*datatype.MapConvert).KeyGuard != m.KeyGuard {
+		t.Error("the copies of the mapper do not share the guard")
+	}
+	if _, err = read("-1"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperMaxBodySize(t *testing.T) {
+	read := func(size string) (*expvar.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            max_body_size: ` + size))
+		return expvar.NewConfig(expvar.WithLogger(tools.DiscardLogger()), expvar.WithViper(v, "reader1", "readers.reader1"))
+	}
+	c, err := read("1048576")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.MaxBodySize != 1048576 {
+		t.Errorf("MaxBodySize = (%d); want (1048576)", c.MaxBodySize)
+	}
+	if c.Conditional {
+		t.Error("Conditional = (true); want (false) by default")
+	}
+	if _, err = c.Reader(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if _, err = read("-1"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperConditional(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            conditional: true
+    `))
+	c, err := expvar.NewConfig(expvar.WithLogger(tools.DiscardLogger()), expvar.WithViper(v, "reader1", "readers.reader1"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !c.Conditional {
+		t.Error("Conditional = (false); want (true)")
+	}
+	if _, err = c.Reader(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestWithViperRedact(t *testing.T) {
+	read := func(redact string) (*expvar.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            endpoint: http://127.0.0.1:9200
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+            redact:
+` + redact))
+		return expvar.NewConfig(expvar.WithViper(v, "reader1", "readers.reader1"))
+	}
+	c, err := read(`
+                - match: (?i)token
+                  action: hash
+                - match: password`)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	m := c.Mapper().(*datatype.MapConvert)
+	if len(m.Redactions) != 2 || m.Redactions[0].Action != datatype.RedactHash || m.Redactions[1].Action != datatype.RedactRemove {
+		t.Errorf("m.Redactions = (%v); want hash and remove", m.Redactions)
+	}
+	if _, err = read(`
+                - match: token
+                  action: mask`); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package expvar_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/reader/expvar"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/token"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func FuzzRead(f *testing.F) {
+	f.Add([]byte(`{"memstats":{"Alloc":1048576,"PauseNs":[100,200]},"ts":"2016-11-27T10:00:00Z"}`), false)
+	f.Add([]byte(`{"ts":1480240800,"requests":{"value":1,"labels":{"code":"200"}}}`), true)
+	f.Add([]byte(`{"ts":1e400}`), true)
+	f.Add([]byte(`{"ts":{"nested":true}}`), false)
+	f.Add([]byte(`{"a":`), false)
+	f.Fuzz(func(t *testing.T, body []byte, unix bool) {
+		client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     make(http.Header),
+				Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				Request:    r,
+			}, nil
+		})}
+		format := ""
+		if unix {
+			format = reader.UnixFormat
+		}
+		red, err := expvar.New(
+			reader.WithLogger(tools.DiscardLogger()),
+			reader.WithEndpoint("http://127.0.0.1:9"),
+			reader.WithName("fuzz"),
+			reader.WithHTTPClient(client),
+			reader.WithTimestamp("ts", format),
+		)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if err = red.Ping(); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		res, err := red.Read(token.New(context.Background()))
+		if err != nil {
+			return
+		}
+		payload, err := datatype.JobResultDataTypes(res.Content, res.Mapper)
+		if err != nil {
+			return
+		}
+		buf := new(bytes.Buffer)
+		if _, err = payload.Generate(buf, time.Now()); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if !json.Valid(buf.Bytes()) {
+			t.Fatalf("invalid document: %s", buf)
+		}
+	})
+}
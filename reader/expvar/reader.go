@@ -9,31 +9,39 @@
 package expvar
 
 import (
-	"bytes"
-	"context"
+	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/pinger"
 	"github.com/alext234/expipe/tools/token"
 
 	"github.com/pkg/errors"
-	"golang.org/x/net/context/ctxhttp"
 )
 
 // Reader can read from any application that exposes expvar information.
 // It implements DataReader interface.
 type Reader struct {
-	name     string
-	endpoint string
-	log      tools.FieldLogger
-	mapper   datatype.Mapper
-	typeName string
-	interval time.Duration
-	timeout  time.Duration
-	pinged   bool
+	name      string
+	endpoint  string
+	log       tools.FieldLogger
+	mapper    datatype.Mapper
+	typeName  string
+	interval  time.Duration
+	timeout   time.Duration
+	timestamp reader.Timestamp
+	labels    datatype.Labels
+	pinged    bool
+	client    *http.Client
+	pinger    *pinger.Pinger
+	pingOpts  []func(*pinger.Pinger) error
+	maxBody   int64
+	cond      *reader.Conditional
 }
 
 // New generates the Reader based on the provided options.
@@ -67,16 +75,69 @@ func New(options ...func(reader.Constructor) error) (*Reader, error) {
 	if r.log == nil {
 		r.log = tools.GetLogger("error")
 	}
+	if r.client == nil {
+		r.client = httpclient.Default()
+	}
+	var err error
+	r.pinger, err = pinger.New(r.endpoint, append([]func(*pinger.Pinger) error{
+		pinger.WithName(r.name),
+		pinger.WithClient(r.client),
+		pinger.WithTimeout(r.timeout),
+	}, r.pingOpts...)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "pinger")
+	}
 	r.log = r.log.WithField("engine", "expipe")
 	return r, nil
 }
 
+// withPing configures the pinger of the reader.
+func withPing(options ...func(*pinger.Pinger) error) func(reader.Constructor) error {
+	return func(c reader.Constructor) error {
+		r, ok := c.(*Reader)
+		if !ok {
+			return fmt.Errorf("not an expvar reader: %T", c)
+		}
+		r.pingOpts = append(r.pingOpts, options...)
+		return nil
+	}
+}
+
+// WithMaxBodySize limits the size of the bodies of the endpoint to size bytes
+// after they are decompressed. The reader.DefaultMaxBodySize is used if it is
+// not set.
+func WithMaxBodySize(size int64) func(reader.Constructor) error {
+	return func(c reader.Constructor) error {
+		r, ok := c.(*Reader)
+		if !ok {
+			return fmt.Errorf("not an expvar reader: %T", c)
+		}
+		if size < 0 {
+			return fmt.Errorf("max_body_size cannot be negative: %d", size)
+		}
+		r.maxBody = size
+		return nil
+	}
+}
+
+// WithConditional sends the conditional requests to the endpoint, therefore it
+// can reply with 304 when its payload has not changed since the last read. The
+// results of such reads are dropped.
+func WithConditional() func(reader.Constructor) error {
+	return func(c reader.Constructor) error {
+		r, ok := c.(*Reader)
+		if !ok {
+			return fmt.Errorf("not an expvar reader: %T", c)
+		}
+		r.cond = new(reader.Conditional)
+		return nil
+	}
+}
+
 // Ping pings the endpoint and return nil if was successful.
 // It returns an EndpointNotAvailableError if the endpoint id unavailable.
 func (r *Reader) Ping() error {
-	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
-	defer cancel()
-	_, err := ctxhttp.Head(ctx, nil, r.endpoint)
+	err := r.pinger.Ping()
 	if err != nil {
 		return reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
 	}
@@ -86,13 +147,28 @@ func (r *Reader) Ping() error {
 
 // Read begins reading from the target. It returns an error back to the engine
 // if it can't read from metrics provider, Ping() is not called or the endpoint
-// has been unresponsive too many times.
+// has been unresponsive too many times. The body is requested with gzip
+// encoding, and a reader.BodyTooLargeError is returned if it is larger than
+// the max body size. If the reader is conditional and the payload has not
+// changed since the last read, the result is dropped with reader.ErrDropped.
 func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
 	if !r.pinged {
 		return nil, reader.ErrPingNotCalled
 	}
-	resp, err := ctxhttp.Get(job, nil, r.endpoint)
-
+	var (
+		content []byte
+		err     error
+	)
+	if r.cond != nil {
+		content, err = r.cond.Fetch(job, r.client, r.endpoint, r.maxBody)
+	} else {
+		content, err = reader.Fetch(job, r.client, r.endpoint, r.maxBody)
+	}
+	if err == reader.ErrNotModified {
+		r.pinger.Report(nil)
+		return nil, errors.Wrap(reader.ErrDropped, "not modified")
+	}
+	r.pinger.Report(err)
 	if err != nil {
 		if _, ok := err.(*url.Error); ok {
 			err = reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
@@ -103,26 +179,31 @@ func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
 			Debugf("%s: error making request: %v", r.name, err)
 		return nil, err
 	}
-	defer resp.Body.Close()
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(resp.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "reading buffer")
-	}
-	content := buf.Bytes()
 	if !tools.IsJSON(content) {
 		return nil, reader.ErrInvalidJSON
 	}
+	ts, err := r.timestamp.Time(content, time.Now()) // It is sensible to record the time now
+	if err != nil {
+		return nil, err
+	}
 	res := &reader.Result{
 		ID:       job.ID(),
-		Time:     time.Now(), // It is sensible to record the time now
+		Time:     ts,
 		Content:  content,
 		TypeName: r.TypeName(),
 		Mapper:   r.Mapper(),
+		Labels:   r.labels,
 	}
 	return res, nil
 }
 
+// Close stops the background health checks of the endpoint, see the
+// ping_interval setting. It always returns nil.
+func (r *Reader) Close() error {
+	r.pinger.Stop()
+	return nil
+}
+
 // Name shows the name identifier for this reader.
 func (r *Reader) Name() string { return r.name }
 
@@ -159,5 +240,14 @@ func (r *Reader) Timeout() time.Duration { return r.timeout }
 // SetTimeout sets the timeout of the reader.
 func (r *Reader) SetTimeout(timeout time.Duration) { r.timeout = timeout }
 
+// SetTimestamp sets the timestamp field of the reader.
+func (r *Reader) SetTimestamp(timestamp reader.Timestamp) { r.timestamp = timestamp }
+
+// SetLabels sets the labels of the results of the reader.
+func (r *Reader) SetLabels(labels datatype.Labels) { r.labels = labels }
+
+// SetHTTPClient sets the http client of the reader.
+func (r *Reader) SetHTTPClient(client *http.Client) { r.client = client }
+
 // SetLogger sets the log of the reader.
 func (r *Reader) SetLogger(log tools.FieldLogger) { r.log = log }
@@ -5,6 +5,8 @@
 package expvar_test
 
 import (
+	"compress/gzip"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -12,6 +14,9 @@ import (
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/reader/expvar"
 	rt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
 )
 
 func getTestServer() *httptest.Server {
@@ -45,3 +50,89 @@ func TestExpvarReader(t *testing.T) {
 		return c, func() { c.testServer.Close() }
 	})
 }
+
+func TestReadCompressed(t *testing.T) {
+	content := `{"memstats":{"Alloc":1048576}}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write([]byte(content))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(content))
+		gz.Close()
+	}))
+	defer ts.Close()
+	newReader := func(options ...func(reader.Constructor) error) *expvar.Reader {
+		red, err := expvar.New(append([]func(reader.Constructor) error{
+			reader.WithLogger(tools.DiscardLogger()),
+			reader.WithName("reader1"),
+			reader.WithEndpoint(ts.URL),
+		}, options...)...)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if err = red.Ping(); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		return red
+	}
+
+	res, err := newReader().Read(token.New(context.Background()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if string(res.Content) != content {
+		t.Errorf("Content = (%s); want (%s)", res.Content, content)
+	}
+
+	_, err = newReader(expvar.WithMaxBodySize(10)).Read(token.New(context.Background()))
+	if _, ok := err.(reader.BodyTooLargeError); !ok {
+		t.Errorf("err = (%v); want (reader.BodyTooLargeError)", err)
+	}
+	if _, err = expvar.New(expvar.WithMaxBodySize(-1)); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestReadConditional(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"version":"v1"}`))
+	}))
+	defer ts.Close()
+	red, err := expvar.New(
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("reader1"),
+		reader.WithEndpoint(ts.URL),
+		expvar.WithConditional(),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err = red.Read(token.New(context.Background())); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	_, err = red.Read(token.New(context.Background()))
+	if errors.Cause(err) != reader.ErrDropped {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrDropped)
+	}
+}
+
+func TestExpvarGolden(t *testing.T) {
+	rt.TestGolden(t, "testdata/golden", func() (rt.Constructor, func()) {
+		c := &Construct{
+			testServer:    getTestServer(),
+			BaseConstruct: rt.NewBaseConstruct(),
+		}
+		return c, func() { c.testServer.Close() }
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package reader
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// DefaultMaxBodySize is the limit of the bodies that Fetch reads when the limit
+// is not positive.
+const DefaultMaxBodySize = 32 << 20
+
+// Fetch gets the endpoint with the client and returns its body. It asks for a
+// gzip encoded body, which is decompressed transparently, therefore the large
+// payloads take less bandwidth. The body, either chunked or not, is read up to
+// the limit after it is decompressed, and a BodyTooLargeError is returned if
+// it is larger. The errors of the client are returned as they are.
+func Fetch(ctx context.Context, client *http.Client, endpoint string, limit int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	_, content, err := fetch(ctx, client, req, limit)
+	return content, err
+}
+
+// Conditional fetches an endpoint with the conditional requests. It keeps the
+// ETag and Last-Modified headers of the last response of the endpoint and
+// sends them back, therefore the endpoint can reply with 304 when its payload
+// has not changed. It is concurrent safe.
+type Conditional struct {
+	mu       sync.Mutex
+	etag     string // guarded by mu.
+	modified string // guarded by mu.
+}
+
+// Fetch is like the Fetch function, but it returns ErrNotModified if the
+// endpoint has not changed since the last call.
+func (c *Conditional) Fetch(ctx context.Context, client *http.Client, endpoint string, limit int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	c.mu.Lock()
+	if c.etag != "" {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+	if c.modified != "" {
+		req.Header.Set("If-Modified-Since", c.modified)
+	}
+	c.mu.Unlock()
+	resp, content, err := fetch(ctx, client, req, limit)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	c.mu.Lock()
+	c.etag = resp.Header.Get("ETag")
+	c.modified = resp.Header.Get("Last-Modified")
+	c.mu.Unlock()
+	return content, nil
+}
+
+// fetch sends the req and returns the response with its body, which is closed.
+func fetch(ctx context.Context, client *http.Client, req *http.Request, limit int64) (*http.Response, []byte, error) {
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	// The transport does not decompress the body when this header is set
+	// explicitly, and it is decompressed below instead.
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := ctxhttp.Do(ctx, client, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	// The size of the decompressed body is not known in advance.
+	size := resp.ContentLength
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") && resp.StatusCode != http.StatusNotModified {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "decompressing body")
+		}
+		defer gz.Close()
+		body = gz
+		size = -1
+	}
+	if size > limit {
+		return nil, nil, BodyTooLargeError{Endpoint: req.URL.String(), Limit: limit}
+	}
+	content, err := tools.ReadAllSize(io.LimitReader(body, limit+1), size)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "reading body")
+	}
+	if int64(len(content)) > limit {
+		return nil, nil, BodyTooLargeError{Endpoint: req.URL.String(), Limit: limit}
+	}
+	return resp, content, nil
+}
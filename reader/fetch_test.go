@@ -0,0 +1,107 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package reader_test
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alext234/expipe/reader"
+)
+
+func TestFetch(t *testing.T) {
+	content := `{"memstats":{"Alloc":1048576}}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gzip":
+			if r.Header.Get("Accept-Encoding") != "gzip" {
+				t.Errorf("Accept-Encoding = (%s); want (gzip)", r.Header.Get("Accept-Encoding"))
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(content))
+			gz.Close()
+		case "/chunked":
+			for _, part := range []string{`{"memstats":`, `{"Alloc":1048576}`, `}`} {
+				w.Write([]byte(part))
+				w.(http.Flusher).Flush()
+			}
+		case "/bad_gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write([]byte(content))
+		default:
+			w.Write([]byte(content))
+		}
+	}))
+	defer ts.Close()
+
+	for _, path := range []string{"/plain", "/gzip", "/chunked"} {
+		got, err := reader.Fetch(context.Background(), http.DefaultClient, ts.URL+path, 0)
+		if err != nil {
+			t.Errorf("%s: err = (%v); want (nil)", path, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("%s: content = (%s); want (%s)", path, got, content)
+		}
+	}
+
+	for _, path := range []string{"/plain", "/gzip", "/chunked"} {
+		_, err := reader.Fetch(context.Background(), http.DefaultClient, ts.URL+path, 10)
+		if e, ok := err.(reader.BodyTooLargeError); !ok || e.Limit != 10 {
+			t.Errorf("%s: err = (%v); want (BodyTooLargeError)", path, err)
+		}
+	}
+	if _, err := reader.Fetch(context.Background(), http.DefaultClient, ts.URL+"/plain", int64(len(content))); err != nil {
+		t.Errorf("err = (%v); want (nil) for a body of the limit", err)
+	}
+
+	_, err := reader.Fetch(context.Background(), http.DefaultClient, ts.URL+"/bad_gzip", 0)
+	if err == nil || !strings.Contains(err.Error(), "decompressing") {
+		t.Errorf("err = (%v); want (decompressing error)", err)
+	}
+	ts.Close()
+	if _, err := reader.Fetch(context.Background(), http.DefaultClient, ts.URL, 0); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestConditionalFetch(t *testing.T) {
+	var (
+		content  = `{"version":"v1"}`
+		modified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + content + `"`
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == modified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", modified)
+		w.Write([]byte(content))
+	}))
+	defer ts.Close()
+
+	c := new(reader.Conditional)
+	got, err := c.Fetch(context.Background(), http.DefaultClient, ts.URL, 0)
+	if err != nil || string(got) != content {
+		t.Fatalf("Fetch() = (%s, %v); want (%s, nil)", got, err, content)
+	}
+	if _, err = c.Fetch(context.Background(), http.DefaultClient, ts.URL, 0); err != reader.ErrNotModified {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrNotModified)
+	}
+	content = `{"version":"v2"}`
+	if got, err = c.Fetch(context.Background(), http.DefaultClient, ts.URL, 0); err != nil || string(got) != content {
+		t.Errorf("Fetch() = (%s, %v); want (%s, nil)", got, err, content)
+	}
+	if got, err = reader.Fetch(context.Background(), http.DefaultClient, ts.URL, 0); err != nil || string(got) != content {
+		t.Errorf("Fetch() = (%s, %v); want (%s, nil) without the conditions", got, err, content)
+	}
+}
@@ -5,6 +5,7 @@
 package reader
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
@@ -24,6 +25,9 @@ type Constructor interface {
 	SetMapper(mapper datatype.Mapper)
 	SetInterval(interval time.Duration)
 	SetTimeout(timeout time.Duration)
+	SetTimestamp(timestamp Timestamp)
+	SetHTTPClient(client *http.Client)
+	SetLabels(labels datatype.Labels)
 }
 
 // WithLogger sets the log of the reader.
@@ -74,12 +78,17 @@ func WithMapper(mapper datatype.Mapper) func(Constructor) error {
 	}
 }
 
-// WithTypeName sets the typeName of the reader.
+// WithTypeName sets the typeName of the reader. The typeName can be a template
+// that is expanded for each result, see ExpandTypeName for its placeholders.
+// It returns a TypeNameError if the template has an unknown placeholder.
 func WithTypeName(typeName string) func(Constructor) error {
 	return func(e Constructor) error {
 		if typeName == "" {
 			return ErrEmptyTypeName
 		}
+		if err := checkTypeName(typeName); err != nil {
+			return err
+		}
 		e.SetTypeName(typeName)
 		return nil
 	}
@@ -106,3 +115,41 @@ func WithTimeout(timeout time.Duration) func(Constructor) error {
 		return nil
 	}
 }
+
+// WithTimestamp sets the field and the format of the timestamp of the results.
+// See Timestamp for the formats.
+func WithTimestamp(field, format string) func(Constructor) error {
+	return func(e Constructor) error {
+		if field == "" {
+			return ErrEmptyTimestampField
+		}
+		e.SetTimestamp(Timestamp{Field: field, Format: format})
+		return nil
+	}
+}
+
+// WithLabels sets the labels of the results of the reader, which are recorded
+// with all of their values.
+func WithLabels(labels datatype.Labels) func(Constructor) error {
+	return func(e Constructor) error {
+		for name := range labels {
+			if name == "" {
+				return ErrEmptyLabelName
+			}
+		}
+		e.SetLabels(labels)
+		return nil
+	}
+}
+
+// WithHTTPClient sets the http client of the reader. Readers use the shared
+// client of the httpclient package if it is not set.
+func WithHTTPClient(client *http.Client) func(Constructor) error {
+	return func(e Constructor) error {
+		if client == nil {
+			return ErrNilHTTPClient
+		}
+		e.SetHTTPClient(client)
+		return nil
+	}
+}
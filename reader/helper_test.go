@@ -5,6 +5,7 @@
 package reader_test
 
 import (
+	"net/http"
 	"testing"
 	"time"
 
@@ -79,6 +80,14 @@ func TestSetTypeName(t *testing.T) {
 	if err != nil {
 		t.Errorf("err = (%v); want (nil)", err)
 	}
+	err = reader.WithTypeName("{reader}-{field:app.name}")(&r)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	err = reader.WithTypeName("{reader}-{port}")(&r)
+	if _, ok := errors.Cause(err).(reader.TypeNameError); !ok {
+		t.Errorf("err = (%v); want (reader.TypeNameError)", err)
+	}
 }
 
 func TestSetInterval(t *testing.T) {
@@ -108,3 +117,47 @@ func TestSetTimeout(t *testing.T) {
 		t.Errorf("err = (%v); want (nil)", err)
 	}
 }
+
+func TestSetTimestamp(t *testing.T) {
+	r := rt.Reader{}
+	err := reader.WithTimestamp("", "")(&r)
+	if errors.Cause(err) != reader.ErrEmptyTimestampField {
+		t.Errorf("err = (%v); want (reader.ErrEmptyTimestampField)", err)
+	}
+	err = reader.WithTimestamp("time", reader.UnixFormat)(&r)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	want := reader.Timestamp{Field: "time", Format: reader.UnixFormat}
+	if r.MockTimestamp != want {
+		t.Errorf("MockTimestamp = (%v); want (%v)", r.MockTimestamp, want)
+	}
+}
+
+func TestSetHTTPClient(t *testing.T) {
+	r := rt.Reader{}
+	err := reader.WithHTTPClient(nil)(&r)
+	if errors.Cause(err) != reader.ErrNilHTTPClient {
+		t.Errorf("err = (%v); want (reader.ErrNilHTTPClient)", err)
+	}
+	err = reader.WithHTTPClient(http.DefaultClient)(&r)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestSetLabels(t *testing.T) {
+	r := rt.Reader{}
+	err := reader.WithLabels(datatype.Labels{"": "value"})(&r)
+	if errors.Cause(err) != reader.ErrEmptyLabelName {
+		t.Errorf("err = (%v); want (reader.ErrEmptyLabelName)", err)
+	}
+	labels := datatype.Labels{"instance": "app1"}
+	err = reader.WithLabels(labels)(&r)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if !r.MockLabels.Equal(labels) {
+		t.Errorf("MockLabels = (%v); want (%v)", r.MockLabels, labels)
+	}
+}
@@ -63,4 +63,7 @@ type Result struct {
 
 	// Mapper is the mapper set in the reader.
 	Mapper datatype.Mapper
+
+	// Labels are recorded with all the values of the Content.
+	Labels datatype.Labels
 }
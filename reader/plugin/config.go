@@ -0,0 +1,148 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a plugin reader. The
+// binary of the path is run with the args, relative paths are resolved from
+// the working directory. If the timestamp_field is set, the time of the
+// results is taken from that field. The labels are recorded with all the
+// values of the reader.
+type Config struct {
+	log          tools.FieldLogger
+	PLTypeName   string            `mapstructure:"type_name"`
+	PLPath       string            `mapstructure:"path"`
+	PLArgs       []string          `mapstructure:"args"`
+	PLInterval   string            `mapstructure:"interval"`
+	PLTimeout    string            `mapstructure:"timeout"`
+	TSField      string            `mapstructure:"timestamp_field"`
+	TSFormat     string            `mapstructure:"timestamp_format"`
+	Labels       map[string]string `mapstructure:"labels"`
+	PLName       string
+	ConfInterval time.Duration
+	ConfTimeout  time.Duration
+	mapper       datatype.Mapper
+}
+
+func init() {
+	reader.Register("plugin", func(src reader.Source, log tools.FieldLogger, name, key string) (reader.DataReader, error) {
+		rc, err := NewConfig(WithLogger(log), WithViper(src, name, key))
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing reader")
+		}
+		return rc.Reader()
+	})
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig returns an instance of the plugin reader.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if obj.mapper == nil {
+		obj.mapper = datatype.DefaultMapper()
+	}
+	return obj, nil
+}
+
+// Reader implements the ReaderConf interface.
+func (c *Config) Reader() (reader.DataReader, error) {
+	options := []func(reader.Constructor) error{
+		reader.WithLogger(c.Logger()),
+		WithCommand(c.PLPath, c.PLArgs...),
+		reader.WithMapper(c.mapper),
+		reader.WithName(c.Name()),
+		reader.WithTypeName(c.PLTypeName),
+		reader.WithInterval(c.Interval()),
+		reader.WithTimeout(c.Timeout()),
+	}
+	if c.TSField != "" {
+		options = append(options, reader.WithTimestamp(c.TSField, c.TSFormat))
+	}
+	if len(c.Labels) > 0 {
+		options = append(options, reader.WithLabels(c.Labels))
+	}
+	return New(options...)
+}
+
+// Name returns name from the config file.
+func (c *Config) Name() string { return c.PLName }
+
+// TypeName returns type name from the config file.
+func (c *Config) TypeName() string { return c.PLTypeName }
+
+// Endpoint returns the path of the plugin from the config file.
+func (c *Config) Endpoint() string { return c.PLPath }
+
+// Interval returns interval after reading from the config file.
+func (c *Config) Interval() time.Duration { return c.ConfInterval }
+
+// Timeout returns timeout after reading from the config file.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger returns logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// Mapper returns the mapper assigned to this object.
+func (c *Config) Mapper() datatype.Mapper { return c.mapper }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+	AllKeys() []string
+}
+
+// WithViper produces an error any of the inputs are empty.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if v == nil {
+			return errors.New("no config file")
+		}
+		err := v.UnmarshalKey(key, &c)
+		if err != nil || v.AllKeys() == nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if c.PLPath == "" {
+			return errors.New("path cannot be empty")
+		}
+		if c.ConfInterval, err = time.ParseDuration(c.PLInterval); err != nil {
+			return errors.Wrapf(err, "parse interval (%v)", c.PLInterval)
+		}
+		if c.ConfTimeout, err = time.ParseDuration(c.PLTimeout); err != nil {
+			return errors.Wrapf(err, "parse timeout (%v)", c.PLTimeout)
+		}
+		if c.PLTypeName == "" {
+			return fmt.Errorf("type_name cannot be empty: %s", c.PLTypeName)
+		}
+		c.PLName = name
+		return nil
+	}
+}
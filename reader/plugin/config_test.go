@@ -0,0 +1,99 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package plugin_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/reader/plugin"
+	"github.com/alext234/expipe/tools"
+	"github.com/spf13/viper"
+)
+
+func TestWithViper(t *testing.T) {
+	input := `
+    readers:
+        reader1:
+            type: plugin
+            type_name: %s
+            path: %s
+            args: ["-v", "--fast"]
+            interval: 2s
+            timeout: 3s
+    `
+	tcs := []struct {
+		name     string
+		typeName string
+		path     string
+		wantErr  bool
+	}{
+		{"valid", "app", "./my-reader", false},
+		{"empty type_name", `""`, "./my-reader", true},
+		{"empty path", "app", `""`, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			v.ReadConfig(bytes.NewBufferString(fmt.Sprintf(input, tc.typeName, tc.path)))
+			c, err := plugin.NewConfig(
+				plugin.WithLogger(tools.DiscardLogger()),
+				plugin.WithViper(v, "reader1", "readers.reader1"),
+			)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if c.Name() != "reader1" || c.TypeName() != "app" || c.Endpoint() != "./my-reader" {
+				t.Errorf("config = (%v); want (reader1, app, ./my-reader)", c)
+			}
+			if c.Interval() != 2*time.Second || c.Timeout() != 3*time.Second {
+				t.Errorf("interval, timeout = (%s, %s); want (2s, 3s)", c.Interval(), c.Timeout())
+			}
+			if want := []string{"-v", "--fast"}; !reflect.DeepEqual(c.PLArgs, want) {
+				t.Errorf("args = (%v); want (%v)", c.PLArgs, want)
+			}
+			r, err := c.Reader()
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if r.Endpoint() != "./my-reader" {
+				t.Errorf("Endpoint() = (%s); want (./my-reader)", r.Endpoint())
+			}
+		})
+	}
+}
+
+func TestWithViperErrors(t *testing.T) {
+	c := new(plugin.Config)
+	if err := plugin.WithViper(nil, "reader1", "readers.reader1")(c); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            type_name: app
+            path: ./my-reader
+            interval: 2s
+            timeout: nope
+    `))
+	if err := plugin.WithViper(v, "reader1", "readers.reader1")(c); err == nil {
+		t.Error("err = (nil); want (error): bad timeout")
+	}
+	if err := plugin.WithLogger(nil)(c); err == nil {
+		t.Error("err = (nil); want (error): nil logger")
+	}
+}
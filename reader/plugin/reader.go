@@ -0,0 +1,229 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package plugin contains logic to read from the plugin binaries. The plugins
+// are built with the tools/plugin package, and they return JSON contents that
+// are mapped like the contents of the expvar readers. The plugin is run when
+// the reader is pinged, and it is run again on the next read if it stops. It
+// is stopped when the reader is closed.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/plugin"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// Reader reads from a plugin binary. It implements DataReader interface.
+type Reader struct {
+	name      string
+	path      string
+	args      []string
+	log       tools.FieldLogger
+	mapper    datatype.Mapper
+	typeName  string
+	interval  time.Duration
+	timeout   time.Duration
+	timestamp reader.Timestamp
+	labels    datatype.Labels
+
+	mu     sync.RWMutex
+	pinged bool           // guarded by mu.
+	client *plugin.Client // guarded by mu.
+	plugin plugin.Reader  // guarded by mu.
+}
+
+// New generates the Reader based on the provided options.
+func New(options ...func(reader.Constructor) error) (*Reader, error) {
+	r := &Reader{}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, reader.ErrEmptyName
+	}
+	if r.path == "" {
+		return nil, reader.ErrEmptyEndpoint
+	}
+	if r.mapper == nil {
+		r.mapper = datatype.DefaultMapper()
+	}
+	if r.typeName == "" {
+		r.typeName = r.name
+	}
+	if r.interval == 0 {
+		r.interval = time.Second
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "expipe")
+	return r, nil
+}
+
+// WithCommand sets the path of the plugin binary, which is run with the args.
+func WithCommand(path string, args ...string) func(reader.Constructor) error {
+	return func(c reader.Constructor) error {
+		r, ok := c.(*Reader)
+		if !ok {
+			return fmt.Errorf("not a plugin reader: %T", c)
+		}
+		if path == "" {
+			return reader.ErrEmptyEndpoint
+		}
+		r.path = path
+		r.args = args
+		return nil
+	}
+}
+
+// Ping runs the plugin if it is not running and pings it. It returns an
+// EndpointNotAvailableError if the plugin can not be run or its ping fails.
+func (r *Reader) Ping() error {
+	p, err := r.start()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	if err := p.Ping(ctx); err != nil {
+		return reader.EndpointNotAvailableError{Endpoint: r.path, Err: err}
+	}
+	r.mu.Lock()
+	r.pinged = true
+	r.mu.Unlock()
+	return nil
+}
+
+// start runs the plugin if it is not running, and returns its Reader.
+func (r *Reader) start() (plugin.Reader, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.client != nil && !r.client.Exited() {
+		return r.plugin, nil
+	}
+	client := plugin.NewClient(r.log, r.path, r.args...)
+	p, err := client.Reader()
+	if err != nil {
+		client.Kill()
+		return nil, reader.EndpointNotAvailableError{Endpoint: r.path, Err: err}
+	}
+	r.client, r.plugin = client, p
+	return p, nil
+}
+
+// Read returns the contents the plugin reads. The plugin is run again if it
+// has stopped. It returns an error if Ping() is not called or the contents are
+// not JSON.
+func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
+	r.mu.RLock()
+	pinged := r.pinged
+	r.mu.RUnlock()
+	if !pinged {
+		return nil, reader.ErrPingNotCalled
+	}
+	p, err := r.start()
+	if err != nil {
+		return nil, err
+	}
+	content, err := p.Read(job)
+	if err != nil {
+		r.log.WithField("reader", "plugin_reader").
+			WithField("name", r.Name()).
+			WithField("ID", job.ID()).
+			Debugf("%s: error reading from the plugin: %v", r.name, err)
+		return nil, err
+	}
+	if !tools.IsJSON(content) {
+		return nil, reader.ErrInvalidJSON
+	}
+	ts, err := r.timestamp.Time(content, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	res := &reader.Result{
+		ID:       job.ID(),
+		Time:     ts,
+		Content:  content,
+		TypeName: r.TypeName(),
+		Mapper:   r.Mapper(),
+		Labels:   r.labels,
+	}
+	return res, nil
+}
+
+// Close stops the plugin. It is run again if the reader is pinged. It always
+// returns nil.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.client != nil {
+		r.client.Kill()
+	}
+	r.client, r.plugin, r.pinged = nil, nil, false
+	return nil
+}
+
+// Name shows the name identifier for this reader.
+func (r *Reader) Name() string { return r.name }
+
+// SetName sets the name of the reader.
+func (r *Reader) SetName(name string) { r.name = name }
+
+// Endpoint returns the path of the plugin.
+func (r *Reader) Endpoint() string { return r.path }
+
+// SetEndpoint sets the path of the plugin.
+func (r *Reader) SetEndpoint(endpoint string) { r.path = endpoint }
+
+// TypeName shows the typeName the recorder should record as.
+func (r *Reader) TypeName() string { return r.typeName }
+
+// SetTypeName sets the type name of the reader.
+func (r *Reader) SetTypeName(typeName string) { r.typeName = typeName }
+
+// Mapper returns the mapper object.
+func (r *Reader) Mapper() datatype.Mapper { return r.mapper }
+
+// SetMapper sets the mapper of the reader.
+func (r *Reader) SetMapper(mapper datatype.Mapper) { r.mapper = mapper }
+
+// Interval returns the interval.
+func (r *Reader) Interval() time.Duration { return r.interval }
+
+// SetInterval sets the interval of the reader.
+func (r *Reader) SetInterval(interval time.Duration) { r.interval = interval }
+
+// Timeout returns the time-out.
+func (r *Reader) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the reader.
+func (r *Reader) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetTimestamp sets the timestamp field of the reader.
+func (r *Reader) SetTimestamp(timestamp reader.Timestamp) { r.timestamp = timestamp }
+
+// SetLabels sets the labels of the results of the reader.
+func (r *Reader) SetLabels(labels datatype.Labels) { r.labels = labels }
+
+// SetHTTPClient does nothing, the plugins make their own requests.
+func (r *Reader) SetHTTPClient(client *http.Client) {}
+
+// SetLogger sets the log of the reader.
+func (r *Reader) SetLogger(log tools.FieldLogger) { r.log = log }
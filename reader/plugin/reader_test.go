@@ -0,0 +1,144 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package plugin_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/reader/plugin"
+	"github.com/alext234/expipe/tools"
+	sdk "github.com/alext234/expipe/tools/plugin"
+	"github.com/alext234/expipe/tools/token"
+)
+
+// The test binary serves the plugin reader of this variable instead of
+// running the tests.
+const pluginEnv = "EXPIPE_TEST_READER"
+
+type fakeReader struct{ content string }
+
+func (fakeReader) Ping(ctx context.Context) error { return nil }
+
+func (r fakeReader) Read(ctx context.Context) ([]byte, error) {
+	if r.content == "" {
+		return nil, errors.New("nothing to read")
+	}
+	return []byte(r.content), nil
+}
+
+func TestMain(m *testing.M) {
+	if content, ok := os.LookupEnv(pluginEnv); ok {
+		sdk.ServeReader(fakeReader{content: content})
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// newReader returns a reader of the test binary that serves the content. The
+// plugin is started with the environment of the test on the first ping.
+func newReader(t *testing.T, content string) (*plugin.Reader, func()) {
+	os.Setenv(pluginEnv, content)
+	r, err := plugin.New(
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("plugin_reader"),
+		plugin.WithCommand(os.Args[0]),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err := r.Ping(); err != nil {
+		t.Fatalf("Ping() = (%v); want (nil)", err)
+	}
+	os.Unsetenv(pluginEnv)
+	return r, sdk.Cleanup
+}
+
+func TestNew(t *testing.T) {
+	if _, err := plugin.New(reader.WithName("plugin_reader")); err != reader.ErrEmptyEndpoint {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrEmptyEndpoint)
+	}
+	if _, err := plugin.New(plugin.WithCommand("./my-reader")); err != reader.ErrEmptyName {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrEmptyName)
+	}
+	r, err := plugin.New(reader.WithName("plugin_reader"), plugin.WithCommand("./my-reader", "-v"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if r.Endpoint() != "./my-reader" {
+		t.Errorf("Endpoint() = (%s); want (./my-reader)", r.Endpoint())
+	}
+	if r.TypeName() != "plugin_reader" {
+		t.Errorf("TypeName() = (%s); want (plugin_reader)", r.TypeName())
+	}
+}
+
+func TestRead(t *testing.T) {
+	r, stop := newReader(t, `{"Alloc":1024}`)
+	defer stop()
+	job := token.New(context.Background())
+	res, err := r.Read(job)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if string(res.Content) != `{"Alloc":1024}` {
+		t.Errorf("Content = (%s); want (%s)", res.Content, `{"Alloc":1024}`)
+	}
+	if res.ID != job.ID() {
+		t.Errorf("ID = (%s); want (%s)", res.ID, job.ID())
+	}
+	if res.TypeName != r.TypeName() {
+		t.Errorf("TypeName = (%s); want (%s)", res.TypeName, r.TypeName())
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	r, err := plugin.New(reader.WithName("plugin_reader"), plugin.WithCommand(os.Args[0]))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err := r.Read(token.New(context.Background())); err != reader.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrPingNotCalled)
+	}
+
+	r, stop := newReader(t, "not json")
+	defer stop()
+	if _, err := r.Read(token.New(context.Background())); err != reader.ErrInvalidJSON {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrInvalidJSON)
+	}
+
+	r, stop = newReader(t, "")
+	defer stop()
+	if _, err := r.Read(token.New(context.Background())); err == nil || err.Error() != "nothing to read" {
+		t.Errorf("err = (%v); want (nothing to read)", err)
+	}
+}
+
+func TestPingNotAvailable(t *testing.T) {
+	r, err := plugin.New(reader.WithName("plugin_reader"), plugin.WithCommand("/does/not/exist"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, ok := r.Ping().(reader.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%T); want (reader.EndpointNotAvailableError)", r.Ping())
+	}
+}
+
+func TestClose(t *testing.T) {
+	r, stop := newReader(t, `{"Alloc":1024}`)
+	defer stop()
+	if err := r.Close(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err := r.Read(token.New(context.Background())); err != reader.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrPingNotCalled)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package receiver
+
+import (
+	"time"
+
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/listener"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a receiver reader.
+// The reader listens on the listen address, and the forwarders should send
+// the token if it is set, which can be read from the token_file instead. The
+// queue_size is the number of the documents that are kept until they are
+// read. The type_name is used for the documents that don't have one, and the
+// labels are added to all of the documents. The interval defaults to 10ms and
+// the timeout to 5s.
+type Config struct {
+	log          tools.FieldLogger
+	RCTypeName   string            `mapstructure:"type_name"`
+	RCListen     string            `mapstructure:"listen"`
+	RCToken      string            `mapstructure:"token"`
+	RCTokenFile  string            `mapstructure:"token_file"`
+	RCQueueSize  int               `mapstructure:"queue_size"`
+	RCInterval   string            `mapstructure:"interval"`
+	RCTimeout    string            `mapstructure:"timeout"`
+	Labels       map[string]string `mapstructure:"labels"`
+	RCName       string
+	ConfInterval time.Duration
+	ConfTimeout  time.Duration
+	tls          listener.TLS
+}
+
+// The receivers listen with the certificate of the listen_tls setting if it
+// is set.
+func init() {
+	reader.Register("receiver", func(src reader.Source, log tools.FieldLogger, name, key string) (reader.DataReader, error) {
+		conf := []Conf{
+			WithLogger(log),
+			WithViper(src, name, key),
+		}
+		if cert := src.GetString("settings.listen_tls.cert_file"); cert != "" {
+			conf = append(conf, WithListenTLS(listener.TLS{
+				CertFile:     cert,
+				KeyFile:      src.GetString("settings.listen_tls.key_file"),
+				ClientCAFile: src.GetString("settings.listen_tls.client_ca_file"),
+			}))
+		}
+		rc, err := NewConfig(conf...)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing reader")
+		}
+		return rc.Reader()
+	})
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig returns an instance of the receiver reader.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Reader implements the ReaderConf interface.
+func (c *Config) Reader() (reader.DataReader, error) {
+	options := []func(reader.Constructor) error{
+		reader.WithLogger(c.Logger()),
+		WithListen(c.RCListen),
+		WithToken(c.RCToken),
+		WithTLS(c.tls),
+		reader.WithName(c.Name()),
+	}
+	if c.RCTypeName != "" {
+		options = append(options, reader.WithTypeName(c.RCTypeName))
+	}
+	if c.RCQueueSize != 0 {
+		options = append(options, WithQueueSize(c.RCQueueSize))
+	}
+	if c.ConfInterval != 0 {
+		options = append(options, reader.WithInterval(c.ConfInterval))
+	}
+	if c.ConfTimeout != 0 {
+		options = append(options, reader.WithTimeout(c.ConfTimeout))
+	}
+	if len(c.Labels) > 0 {
+		options = append(options, reader.WithLabels(c.Labels))
+	}
+	return New(options...)
+}
+
+// Name returns name from the config file.
+func (c *Config) Name() string { return c.RCName }
+
+// TypeName returns type name from the config file.
+func (c *Config) TypeName() string { return c.RCTypeName }
+
+// Endpoint returns the listen address from the config file.
+func (c *Config) Endpoint() string { return c.RCListen }
+
+// Interval returns interval after reading from the config file.
+func (c *Config) Interval() time.Duration { return c.ConfInterval }
+
+// Timeout returns timeout after reading from the config file.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger returns logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+// WithListenTLS sets the certificate of the listener.
+func WithListenTLS(t listener.TLS) Conf {
+	return func(c *Config) error {
+		c.tls = t
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+	AllKeys() []string
+}
+
+// WithViper produces an error any of the inputs are empty.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if v == nil {
+			return errors.New("no config file")
+		}
+		err := v.UnmarshalKey(key, &c)
+		if err != nil || v.AllKeys() == nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if c.RCListen == "" {
+			return errors.New("listen cannot be empty")
+		}
+		if c.RCInterval != "" {
+			if c.ConfInterval, err = time.ParseDuration(c.RCInterval); err != nil {
+				return errors.Wrapf(err, "parse interval (%v)", c.RCInterval)
+			}
+		}
+		if c.RCTimeout != "" {
+			if c.ConfTimeout, err = time.ParseDuration(c.RCTimeout); err != nil {
+				return errors.Wrapf(err, "parse timeout (%v)", c.RCTimeout)
+			}
+		}
+		if c.RCTokenFile != "" {
+			if c.RCToken != "" {
+				return errors.New("only one of token and token_file should be set")
+			}
+			if c.RCToken, err = tools.ReadSecretFile(c.RCTokenFile); err != nil {
+				return errors.Wrap(err, "token_file")
+			}
+		}
+		if c.RCQueueSize < 0 {
+			return errors.Errorf("queue_size cannot be negative: %d", c.RCQueueSize)
+		}
+		c.RCName = name
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package receiver_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/reader/receiver"
+	"github.com/alext234/expipe/tools"
+	"github.com/spf13/viper"
+)
+
+func TestWithViper(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        reader1:
+            type: receiver
+            listen: 127.0.0.1:9480
+            token: secret
+            queue_size: 10
+            interval: 50ms
+            timeout: 3s
+            labels:
+                tier: aggregator
+    `))
+	c, err := receiver.NewConfig(
+		receiver.WithLogger(tools.DiscardLogger()),
+		receiver.WithViper(v, "reader1", "readers.reader1"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Name() != "reader1" || c.Endpoint() != "127.0.0.1:9480" || c.RCToken != "secret" {
+		t.Errorf("config = (%v); want (reader1, 127.0.0.1:9480, secret)", c)
+	}
+	if c.Interval() != 50*time.Millisecond || c.Timeout() != 3*time.Second {
+		t.Errorf("interval, timeout = (%s, %s); want (50ms, 3s)", c.Interval(), c.Timeout())
+	}
+	r, err := c.Reader()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if r.Endpoint() != "127.0.0.1:9480" || r.TypeName() != "reader1" || r.Interval() != 50*time.Millisecond {
+		t.Errorf("reader = (%s, %s, %s); want (127.0.0.1:9480, reader1, 50ms)", r.Endpoint(), r.TypeName(), r.Interval())
+	}
+}
+
+func TestWithViperErrors(t *testing.T) {
+	f, err := ioutil.TempFile("", "expipe_token")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	f.WriteString("from-file\n")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        no_listen:
+            timeout: 3s
+        bad_interval:
+            listen: :9480
+            interval: nope
+        bad_timeout:
+            listen: :9480
+            timeout: nope
+        negative_queue:
+            listen: :9480
+            queue_size: -1
+        both_tokens:
+            listen: :9480
+            token: secret
+            token_file: ` + f.Name() + `
+        token_file:
+            listen: :9480
+            token_file: ` + f.Name() + `
+    `))
+	for _, name := range []string{"no_listen", "bad_interval", "bad_timeout", "negative_queue", "both_tokens"} {
+		c := new(receiver.Config)
+		if err := receiver.WithViper(v, name, "readers."+name)(c); err == nil {
+			t.Errorf("%s: err = (nil); want (error)", name)
+		}
+	}
+	c := new(receiver.Config)
+	if err := receiver.WithViper(v, "token_file", "readers.token_file")(c); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.RCToken != "from-file" {
+		t.Errorf("token = (%s); want (from-file)", c.RCToken)
+	}
+	if err := receiver.WithViper(nil, "name", "readers.no_listen")(c); err == nil {
+		t.Error("err = (nil); want (error): nil viper")
+	}
+	if err := receiver.WithLogger(nil)(c); err == nil {
+		t.Error("err = (nil); want (error): nil logger")
+	}
+}
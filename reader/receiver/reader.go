@@ -0,0 +1,354 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package receiver contains logic to read the documents that the forwarder
+// recorders of other expipe instances send, see the forward package for the
+// protocol. The receiver listens when it is pinged, and it queues the received
+// documents until they are read. Each read returns one document, therefore
+// the interval of the reader should be short enough for the rate of the
+// forwarders. The values of the documents are already mapped by the
+// forwarders, so they are not mapped again unless a mapper is set.
+package receiver
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/forward"
+	"github.com/alext234/expipe/tools/listener"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultQueueSize is the number of the documents that are queued when
+	// the size is not set.
+	DefaultQueueSize = 1024
+
+	// maxBodySize is the maximum size of a batch.
+	maxBodySize = 32 * 1024 * 1024
+)
+
+// Reader receives the documents of the forwarders. It implements DataReader
+// interface.
+type Reader struct {
+	name     string
+	addr     string
+	token    string
+	tls      listener.TLS
+	log      tools.FieldLogger
+	mapper   datatype.Mapper
+	typeName string
+	interval time.Duration
+	timeout  time.Duration
+	labels   datatype.Labels
+	queue    chan forward.Document
+
+	mu       sync.Mutex
+	pinged   bool         // guarded by mu.
+	srv      *http.Server // guarded by mu.
+	listener net.Listener // guarded by mu.
+	enqueue  sync.Mutex
+}
+
+// New generates the Reader based on the provided options.
+func New(options ...func(reader.Constructor) error) (*Reader, error) {
+	r := &Reader{}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, reader.ErrEmptyName
+	}
+	if r.addr == "" {
+		return nil, reader.ErrEmptyEndpoint
+	}
+	if r.mapper == nil {
+		r.mapper = &datatype.MapConvert{}
+	}
+	if r.typeName == "" {
+		r.typeName = r.name
+	}
+	if r.interval == 0 {
+		r.interval = 10 * time.Millisecond
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	if r.queue == nil {
+		r.queue = make(chan forward.Document, DefaultQueueSize)
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "expipe")
+	return r, nil
+}
+
+// WithListen sets the address the reader listens on.
+func WithListen(addr string) func(reader.Constructor) error {
+	return func(c reader.Constructor) error {
+		r, ok := c.(*Reader)
+		if !ok {
+			return fmt.Errorf("not a receiver reader: %T", c)
+		}
+		if addr == "" {
+			return reader.ErrEmptyEndpoint
+		}
+		r.addr = addr
+		return nil
+	}
+}
+
+// WithToken sets the token the forwarders should send.
+func WithToken(token string) func(reader.Constructor) error {
+	return func(c reader.Constructor) error {
+		r, ok := c.(*Reader)
+		if !ok {
+			return fmt.Errorf("not a receiver reader: %T", c)
+		}
+		r.token = token
+		return nil
+	}
+}
+
+// WithQueueSize sets the number of the documents that are queued until they
+// are read. The forwarders are asked to retry when the queue is full.
+func WithQueueSize(size int) func(reader.Constructor) error {
+	return func(c reader.Constructor) error {
+		r, ok := c.(*Reader)
+		if !ok {
+			return fmt.Errorf("not a receiver reader: %T", c)
+		}
+		if size <= 0 {
+			return fmt.Errorf("queue size should be positive: %d", size)
+		}
+		r.queue = make(chan forward.Document, size)
+		return nil
+	}
+}
+
+// WithTLS sets the certificate of the listener, see the listener package.
+func WithTLS(t listener.TLS) func(reader.Constructor) error {
+	return func(c reader.Constructor) error {
+		r, ok := c.(*Reader)
+		if !ok {
+			return fmt.Errorf("not a receiver reader: %T", c)
+		}
+		r.tls = t
+		return nil
+	}
+}
+
+// Ping starts listening if the reader is not listening yet. It returns an
+// EndpointNotAvailableError if it can not listen on the address.
+func (r *Reader) Ping() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.srv != nil {
+		return nil
+	}
+	l, err := listener.Listen(r.addr, r.tls)
+	if err != nil {
+		return reader.EndpointNotAvailableError{Endpoint: r.addr, Err: err}
+	}
+	mux := http.NewServeMux()
+	mux.Handle(forward.Path, r)
+	r.srv = &http.Server{Handler: mux, ReadTimeout: r.timeout}
+	r.listener = l
+	r.pinged = true
+	go r.srv.Serve(l)
+	return nil
+}
+
+// Addr returns the address the reader listens on, or nil if it is not
+// listening.
+func (r *Reader) Addr() net.Addr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.listener == nil {
+		return nil
+	}
+	return r.listener.Addr()
+}
+
+// Close stops listening. The queued documents are dropped.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.srv == nil {
+		return nil
+	}
+	err := r.srv.Close()
+	r.srv, r.listener, r.pinged = nil, nil, false
+	return err
+}
+
+// ServeHTTP answers the pings of the forwarders and queues their batches. The
+// batches can be compressed with gzip, and are limited to maxBodySize after
+// decompression too. The keys of the compacted batches are expanded. The
+// whole batch is rejected if it doesn't fit in the queue.
+func (r *Reader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !forward.ValidToken(req, r.token) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body := http.MaxBytesReader(w, req.Body, maxBodySize)
+	switch req.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = http.MaxBytesReader(w, zr, maxBodySize)
+	default:
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+	var batch forward.Batch
+	if err := json.NewDecoder(body).Decode(&batch); err != nil {
+		http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := batch.Expand(); err != nil {
+		http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.enqueue.Lock()
+	defer r.enqueue.Unlock()
+	if cap(r.queue)-len(r.queue) < len(batch.Documents) {
+		r.log.WithField("reader", "receiver").
+			WithField("name", r.Name()).
+			Warnf("%s: the queue is full, rejected %d documents", r.name, len(batch.Documents))
+		http.Error(w, "the queue is full", http.StatusServiceUnavailable)
+		return
+	}
+	for _, doc := range batch.Documents {
+		r.queue <- doc
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Read returns the next received document. The labels of the reader are
+// added to the labels of the document, and the type name of the reader is
+// used if the document doesn't have one. It returns reader.ErrDropped if
+// there are no documents, and an error if Ping() is not called.
+func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
+	r.mu.Lock()
+	pinged := r.pinged
+	r.mu.Unlock()
+	if !pinged {
+		return nil, reader.ErrPingNotCalled
+	}
+	var doc forward.Document
+	select {
+	case doc = <-r.queue:
+	default:
+		return nil, reader.ErrDropped
+	}
+	content, labels, err := doc.Content()
+	if err != nil {
+		r.log.WithField("reader", "receiver").
+			WithField("name", r.Name()).
+			WithField("ID", job.ID()).
+			Debugf("%s: invalid document %s: %v", r.name, doc.ID, err)
+		return nil, err
+	}
+	if len(r.labels) > 0 {
+		if labels == nil {
+			labels = make(datatype.Labels, len(r.labels))
+		}
+		for k, v := range r.labels {
+			labels[k] = v
+		}
+	}
+	typeName := doc.TypeName
+	if typeName == "" {
+		typeName = r.TypeName()
+	}
+	ts := doc.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	res := &reader.Result{
+		ID:       job.ID(),
+		Time:     ts,
+		Content:  content,
+		TypeName: typeName,
+		Mapper:   r.Mapper(),
+		Labels:   labels,
+	}
+	return res, nil
+}
+
+// Name shows the name identifier for this reader.
+func (r *Reader) Name() string { return r.name }
+
+// SetName sets the name of the reader.
+func (r *Reader) SetName(name string) { r.name = name }
+
+// Endpoint returns the address the reader listens on.
+func (r *Reader) Endpoint() string { return r.addr }
+
+// SetEndpoint sets the address the reader listens on.
+func (r *Reader) SetEndpoint(endpoint string) { r.addr = endpoint }
+
+// TypeName shows the typeName the recorder should record as.
+func (r *Reader) TypeName() string { return r.typeName }
+
+// SetTypeName sets the type name of the reader.
+func (r *Reader) SetTypeName(typeName string) { r.typeName = typeName }
+
+// Mapper returns the mapper object.
+func (r *Reader) Mapper() datatype.Mapper { return r.mapper }
+
+// SetMapper sets the mapper of the reader.
+func (r *Reader) SetMapper(mapper datatype.Mapper) { r.mapper = mapper }
+
+// Interval returns the interval.
+func (r *Reader) Interval() time.Duration { return r.interval }
+
+// SetInterval sets the interval of the reader.
+func (r *Reader) SetInterval(interval time.Duration) { r.interval = interval }
+
+// Timeout returns the time-out.
+func (r *Reader) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the reader.
+func (r *Reader) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetTimestamp does nothing, the documents have their own time.
+func (r *Reader) SetTimestamp(timestamp reader.Timestamp) {}
+
+// SetLabels sets the labels that are added to the received documents.
+func (r *Reader) SetLabels(labels datatype.Labels) { r.labels = labels }
+
+// SetHTTPClient does nothing, the reader doesn't make any requests.
+func (r *Reader) SetHTTPClient(client *http.Client) {}
+
+// SetLogger sets the log of the reader.
+func (r *Reader) SetLogger(log tools.FieldLogger) { r.log = log }
@@ -0,0 +1,238 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package receiver_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/reader/receiver"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/forward"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/token"
+)
+
+func newReader(t *testing.T, options ...func(reader.Constructor) error) (*receiver.Reader, string) {
+	options = append([]func(reader.Constructor) error{
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("receiver"),
+		receiver.WithListen("127.0.0.1:0"),
+	}, options...)
+	r, err := receiver.New(options...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = r.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return r, "http://" + r.Addr().String() + forward.Path
+}
+
+func post(t *testing.T, url, token string, docs ...forward.Document) int {
+	body, _ := json.Marshal(forward.Batch{Documents: docs})
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	forward.SetToken(req, token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestNew(t *testing.T) {
+	if _, err := receiver.New(reader.WithName("receiver")); err != reader.ErrEmptyEndpoint {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrEmptyEndpoint)
+	}
+	if _, err := receiver.New(receiver.WithListen("127.0.0.1:0")); err != reader.ErrEmptyName {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrEmptyName)
+	}
+	if _, err := receiver.New(receiver.WithQueueSize(0)); err == nil {
+		t.Error("err = (nil); want (error): zero queue size")
+	}
+	r, err := receiver.New(reader.WithName("receiver"), receiver.WithListen(":9480"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if r.TypeName() != "receiver" || r.Endpoint() != ":9480" || r.Interval() != 10*time.Millisecond {
+		t.Errorf("reader = (%s, %s, %s); want (receiver, :9480, 10ms)", r.TypeName(), r.Endpoint(), r.Interval())
+	}
+	if _, err := r.Read(token.New(context.Background())); err != reader.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrPingNotCalled)
+	}
+}
+
+func TestRead(t *testing.T) {
+	r, url := newReader(t,
+		reader.WithTypeName("fallback"),
+		reader.WithLabels(datatype.Labels{"aggregator": "central"}),
+	)
+	defer r.Close()
+	job := token.New(context.Background())
+	if _, err := r.Read(job); err != reader.ErrDropped {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrDropped)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	status := post(t, url, "",
+		forward.Document{
+			ID:       "1",
+			Reader:   "app",
+			TypeName: "my_app",
+			Time:     now,
+			Payload:  []byte(`{"@timestamp":"x","labels":{"region":"eu"},"Alloc":12.5}`),
+		},
+		forward.Document{Payload: []byte(`{"Sys":2}`)},
+	)
+	if status != http.StatusAccepted {
+		t.Fatalf("StatusCode = (%d); want (202)", status)
+	}
+
+	res, err := r.Read(job)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if string(res.Content) != `{"Alloc":12.5}` {
+		t.Errorf("Content = (%s); want ({\"Alloc\":12.5})", res.Content)
+	}
+	if res.TypeName != "my_app" || !res.Time.Equal(now) {
+		t.Errorf("TypeName, Time = (%s, %s); want (my_app, %s)", res.TypeName, res.Time, now)
+	}
+	if want := (datatype.Labels{"region": "eu", "aggregator": "central"}); !res.Labels.Equal(want) {
+		t.Errorf("Labels = (%v); want (%v)", res.Labels, want)
+	}
+	payload, err := datatype.JobResultDataTypes(res.Content, res.Mapper)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, ok := payload.List()[0].(*datatype.FloatType); !ok {
+		t.Errorf("value = (%T); want (*datatype.FloatType)", payload.List()[0])
+	}
+
+	res, err = r.Read(job)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if res.TypeName != "fallback" || res.Time.IsZero() {
+		t.Errorf("TypeName, Time = (%s, %s); want (fallback, now)", res.TypeName, res.Time)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r, url := newReader(t, receiver.WithToken("secret"), receiver.WithQueueSize(2))
+	defer r.Close()
+	doc := forward.Document{Payload: []byte(`{"Alloc":1}`)}
+
+	if status := post(t, url, "", doc); status != http.StatusUnauthorized {
+		t.Errorf("StatusCode = (%d); want (401)", status)
+	}
+	if status := post(t, url, "secret", doc, doc, doc); status != http.StatusServiceUnavailable {
+		t.Errorf("StatusCode = (%d); want (503)", status)
+	}
+	if status := post(t, url, "secret", doc, doc); status != http.StatusAccepted {
+		t.Errorf("StatusCode = (%d); want (202)", status)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	forward.SetToken(req, "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("StatusCode = (%d); want (204)", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, url, bytes.NewBufferString("not json"))
+	forward.SetToken(req, "secret")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("StatusCode = (%d); want (400)", resp.StatusCode)
+	}
+}
+
+func TestServeHTTPGzip(t *testing.T) {
+	r, url := newReader(t)
+	defer r.Close()
+	body, _ := json.Marshal(forward.Batch{Documents: []forward.Document{
+		{Payload: []byte(`{"Alloc":1}`)},
+	}})
+	client := httpclient.Compressed(http.DefaultClient, "receiver_test", true)
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("StatusCode = (%d); want (202)", resp.StatusCode)
+	}
+	res, err := r.Read(token.New(context.Background()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if string(res.Content) != `{"Alloc":1}` {
+		t.Errorf("Content = (%s); want ({\"Alloc\":1})", res.Content)
+	}
+
+	tcs := []struct {
+		name     string
+		encoding string
+		want     int
+	}{
+		{"bad gzip", "gzip", http.StatusBadRequest},
+		{"unknown encoding", "br", http.StatusUnsupportedMediaType},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+			req.Header.Set("Content-Encoding", tc.encoding)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.want {
+				t.Errorf("StatusCode = (%d); want (%d)", resp.StatusCode, tc.want)
+			}
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	r, url := newReader(t)
+	addr := r.Addr().String()
+	if err := r.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil): second ping", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("err = (nil); want (error): the receiver is still listening")
+	}
+	if _, err := r.Read(token.New(context.Background())); err != reader.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrPingNotCalled)
+	}
+
+	r2, err := receiver.New(reader.WithName("receiver"), receiver.WithListen(addr))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = r2.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil): the address was not released", err)
+	}
+	r2.Close()
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package reader
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/alext234/expipe/tools"
+)
+
+// Source is the configuration file the readers are created from. It is
+// implemented by *viper.Viper.
+type Source interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+	AllKeys() []string
+	GetString(key string) string
+}
+
+// Factory returns the reader of the name, which is configured under the key
+// of the src. The log is the logger of the application.
+type Factory func(src Source, log tools.FieldLogger, name, key string) (DataReader, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes the readers of the typeName available in the configuration
+// file, which are created with the factory. The readers of expipe register
+// their types when their packages are imported, the other types should be
+// registered before the configuration file is read. It panics if the
+// typeName is registered twice or the factory is nil.
+func Register(typeName string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic("reader: nil factory for " + typeName)
+	}
+	if _, ok := factories[typeName]; ok {
+		panic(fmt.Sprintf("reader: %s is registered twice", typeName))
+	}
+	factories[typeName] = factory
+}
+
+// Lookup returns the factory of the typeName, and false if it is not
+// registered.
+func Lookup(typeName string) (Factory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	factory, ok := factories[typeName]
+	return factory, ok
+}
+
+// Types returns the registered types, sorted.
+func Types() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	types := make([]string, 0, len(factories))
+	for typeName := range factories {
+		types = append(types, typeName)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package reader_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools"
+)
+
+func TestRegister(t *testing.T) {
+	factory := func(src reader.Source, log tools.FieldLogger, name, key string) (reader.DataReader, error) {
+		return nil, nil
+	}
+	reader.Register("registry_test", factory)
+	if _, ok := reader.Lookup("registry_test"); !ok {
+		t.Error("Lookup(registry_test) = (false); want (true)")
+	}
+	if _, ok := reader.Lookup("not_registered"); ok {
+		t.Error("Lookup(not_registered) = (true); want (false)")
+	}
+	if !tools.StringInSlice("registry_test", reader.Types()) {
+		t.Errorf("Types() = (%v); want (registry_test) in it", reader.Types())
+	}
+
+	for name, f := range map[string]reader.Factory{"registry_test": factory, "nil_factory": nil} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%s) didn't panic", name)
+				}
+			}()
+			reader.Register(name, f)
+		}()
+	}
+}
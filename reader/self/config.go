@@ -6,24 +6,80 @@ package self
 
 import (
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
 	"github.com/pkg/errors"
 )
 
 // Config holds the necessary configuration for setting up an self reading
-// facility, which is the way to record the app's metrics.
+// facility, which is the way to record the app's metrics. The gc_types,
+// memory_bytes, summary_types, array_policies, key_rules, computed_fields and
+// malformed_values of the reader are added to the default mappings, and the
+// flatten block sets how the nested objects are flattened. The labels are
+// recorded with all the values of the reader, and their numbers are written
+// with the precision decimal places if it is set. The keys start with the
+// key_prefix, or with the name of the reader if namespace is true. The fields
+// are added to all the documents of the reader, and the locations of the IP
+// addresses of the geoip fields are added with the geoip database. The values
+// of the keys that match the redact patterns are removed or hashed, and the
+// values of the new keys are dropped once the reader has max_keys distinct
+// keys. The certificate of the client_cert_file and client_key_file is
+// presented to the debug listener if they are set.
 type Config struct {
-	log          tools.FieldLogger
-	SelfName     string
-	SelfTypeName string `mapstructure:"type_name"`
-	SelfInterval string `mapstructure:"interval"`
-	SelfEndpoint string // this is for testing purposes and you are not supposed to set it
-	mapper       datatype.Mapper
-	Cinterval    time.Duration
+	log             tools.FieldLogger
+	SelfName        string
+	SelfTypeName    string                 `mapstructure:"type_name"`
+	SelfInterval    string                 `mapstructure:"interval"`
+	GCTypes         []string               `mapstructure:"gc_types"`
+	MemoryBytes     map[string]interface{} `mapstructure:"memory_bytes"`
+	SummaryTypes    []string               `mapstructure:"summary_types"`
+	Labels          map[string]string      `mapstructure:"labels"`
+	Flatten         datatype.Flatten       `mapstructure:"flatten"`
+	ArrayPolicies   map[string]interface{} `mapstructure:"array_policies"`
+	KeyRules        []datatype.KeyRule     `mapstructure:"key_rules"`
+	ComputedFields  map[string]interface{} `mapstructure:"computed_fields"`
+	MalformedValues string                 `mapstructure:"malformed_values"`
+	Precision       *int                   `mapstructure:"precision"`
+	KeyPrefix       string                 `mapstructure:"key_prefix"`
+	Namespace       bool                   `mapstructure:"namespace"`
+	Fields          map[string]interface{} `mapstructure:"fields"`
+	GeoIP           datatype.GeoIP         `mapstructure:"geoip"`
+	MaxKeys         int                    `mapstructure:"max_keys"`
+	Redact          []datatype.Redaction   `mapstructure:"redact"`
+	ClientCertFile  string                 `mapstructure:"client_cert_file"`
+	ClientKeyFile   string                 `mapstructure:"client_key_file"`
+	mapper          datatype.Mapper
+	Cinterval       time.Duration
+	debugAddr       string
+	debugTLS        bool
+}
+
+// The self readers read from the debug_addr listener if it is set, over https
+// if the listen_tls is set.
+func init() {
+	reader.Register("self", func(src reader.Source, log tools.FieldLogger, name, key string) (reader.DataReader, error) {
+		conf := []Conf{
+			WithLogger(log),
+			WithViper(src, name, key),
+		}
+		if addr := src.GetString("settings.debug_addr"); addr != "" {
+			conf = append(conf, WithDebugAddr(addr))
+		}
+		if src.GetString("settings.listen_tls.cert_file") != "" {
+			conf = append(conf, WithDebugTLS())
+		}
+		rc, err := NewConfig(conf...)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing reader")
+		}
+		return rc.Reader()
+	})
 }
 
 // Conf func is used for initializing a Config object.
@@ -44,17 +100,31 @@ func NewConfig(conf ...Conf) (*Config, error) {
 	return obj, nil
 }
 
-// Reader implements the RecorderConf interface.
+// Reader implements the RecorderConf interface. The reader pings the debug
+// listener if its address is set.
 func (c *Config) Reader() (reader.DataReader, error) {
-	return New(
+	options := []func(reader.Constructor) error{
 		reader.WithLogger(c.Logger()),
-		WithTempServer(),
 		reader.WithMapper(c.mapper),
 		reader.WithName(c.Name()),
 		reader.WithTypeName(c.TypeName()),
 		reader.WithInterval(c.Interval()),
 		reader.WithTimeout(c.Timeout()),
-	)
+	}
+	if endpoint := c.Endpoint(); endpoint != "" {
+		options = append(options, reader.WithEndpoint(endpoint))
+	}
+	if len(c.Labels) > 0 {
+		options = append(options, reader.WithLabels(c.Labels))
+	}
+	if c.ClientCertFile != "" || c.ClientKeyFile != "" {
+		client, err := httpclient.WithClientCert("", c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "http client")
+		}
+		options = append(options, reader.WithHTTPClient(client))
+	}
+	return New(options...)
 }
 
 // Name returns the name.
@@ -63,8 +133,18 @@ func (c *Config) Name() string { return c.SelfName }
 // TypeName returns the typeName.
 func (c *Config) TypeName() string { return c.SelfTypeName }
 
-// Endpoint returns the endpoint.
-func (c *Config) Endpoint() string { return c.SelfEndpoint }
+// Endpoint returns the expvar handler of the debug listener, or empty if the
+// debug address is not set.
+func (c *Config) Endpoint() string {
+	if c.debugAddr == "" {
+		return ""
+	}
+	scheme := "http://"
+	if c.debugTLS {
+		scheme = "https://"
+	}
+	return scheme + c.debugAddr + "/debug/vars"
+}
 
 // Interval returns the interval.
 func (c *Config) Interval() time.Duration { return c.Cinterval }
@@ -86,6 +166,32 @@ func WithLogger(log tools.FieldLogger) Conf {
 	}
 }
 
+// WithDebugAddr points the reader to the expvar handler of the debug listener
+// on addr. The loopback address is used if the host of the addr is empty or
+// unspecified.
+func WithDebugAddr(addr string) Conf {
+	return func(c *Config) error {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return errors.Wrap(err, "debug address")
+		}
+		if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+			host = "127.0.0.1"
+		}
+		c.debugAddr = net.JoinHostPort(host, port)
+		return nil
+	}
+}
+
+// WithDebugTLS reads the debug listener over https. The certificate of the
+// listener should be trusted by the http client of the reader.
+func WithDebugTLS() Conf {
+	return func(c *Config) error {
+		c.debugTLS = true
+		return nil
+	}
+}
+
 type unmarshaller interface {
 	UnmarshalKey(key string, rawVal interface{}) error
 	AllKeys() []string
@@ -111,7 +217,62 @@ func WithViper(v unmarshaller, name, key string) Conf {
 		}
 		c.SelfName = name
 		c.mapper = datatype.DefaultMapper()
-		c.SelfEndpoint = "http://127.0.0.1:9200"
+		if err := datatype.CheckArrayPolicies(datatype.FlatNames(c.ArrayPolicies)); err != nil {
+			return err
+		}
+		if err := datatype.CheckMalformedPolicy(c.MalformedValues); err != nil {
+			return err
+		}
+		if c.Precision != nil && *c.Precision < 0 {
+			return errors.Errorf("precision cannot be negative: %d", *c.Precision)
+		}
+		if c.KeyPrefix != "" && c.Namespace {
+			return errors.New("key_prefix and namespace cannot be used together")
+		}
+		if c.MaxKeys < 0 {
+			return errors.Errorf("max_keys cannot be negative: %d", c.MaxKeys)
+		}
+		if c.Flatten.MaxDepth < 0 {
+			return errors.Errorf("flatten.max_depth cannot be negative: %d", c.Flatten.MaxDepth)
+		}
+		if len(c.GCTypes) > 0 || len(c.MemoryBytes) > 0 || len(c.SummaryTypes) > 0 || len(c.ArrayPolicies) > 0 ||
+			len(c.KeyRules) > 0 || len(c.ComputedFields) > 0 ||
+			c.MalformedValues != "" || c.Precision != nil || c.KeyPrefix != "" || c.Namespace ||
+			len(c.Fields) > 0 || c.GeoIP.Database != "" ||
+			len(c.GeoIP.Fields) > 0 || c.MaxKeys > 0 || len(c.Redact) > 0 || c.Flatten != (datatype.Flatten{}) {
+			gcTypes := strings.Fields(strings.Join(c.GCTypes, " "))
+			mapper := c.mapper.(*datatype.MapConvert).Extend(gcTypes, datatype.FlatMemoryTypes(c.MemoryBytes))
+			mapper.SummaryTypes = append(mapper.SummaryTypes, strings.Fields(strings.Join(c.SummaryTypes, " "))...)
+			if len(c.ArrayPolicies) > 0 {
+				mapper = mapper.WithArrayPolicies(datatype.FlatNames(c.ArrayPolicies))
+			}
+			if mapper, err = mapper.WithKeyRules(c.KeyRules); err != nil {
+				return err
+			}
+			if mapper, err = mapper.WithComputedFields(datatype.FlatNames(c.ComputedFields)); err != nil {
+				return errors.Wrap(err, "computed_fields")
+			}
+			mapper.Flatten = c.Flatten
+			mapper.Malformed = strings.ToLower(c.MalformedValues)
+			mapper.Precision = c.Precision
+			mapper.KeyPrefix = c.KeyPrefix
+			if c.Namespace {
+				mapper.KeyPrefix = name + c.Flatten.Separator()
+			}
+			mapper = mapper.WithFields(datatype.FlatNames(c.Fields))
+			if c.GeoIP.Database != "" || len(c.GeoIP.Fields) > 0 {
+				if mapper, err = mapper.WithGeoIP(c.GeoIP); err != nil {
+					return errors.Wrap(err, "geoip")
+				}
+			}
+			if mapper, err = mapper.WithRedactions(c.Redact); err != nil {
+				return err
+			}
+			if c.MaxKeys > 0 {
+				mapper.KeyGuard = datatype.NewKeyGuard(name, c.MaxKeys)
+			}
+			c.mapper = mapper
+		}
 		return nil
 	}
 }
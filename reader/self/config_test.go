@@ -11,6 +11,7 @@ import (
 
 	"github.com/alext234/expipe/reader/self"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
@@ -79,8 +80,8 @@ func TestWithViperSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("err = (%v); want (nil)", err)
 	}
-	if c.Endpoint() != "http://127.0.0.1:9200" {
-		t.Errorf("c.Endpoint() = (%s); want (http://127.0.0.1:9200)", c.Endpoint())
+	if c.Endpoint() != "" {
+		t.Errorf("c.Endpoint() = (%s); want (empty)", c.Endpoint())
 	}
 	if c.TypeName() != "example_type" {
 		t.Errorf("c.TypeName() = (%s); want (example_type)", c.TypeName())
@@ -166,7 +167,6 @@ func TestConfigReader(t *testing.T) {
 	)
 	c.SelfName = "name"
 	c.SelfTypeName = "name"
-	c.SelfEndpoint = "http://localhost"
 	if err != nil {
 		t.Fatalf("err = (%v); want (nil)", err)
 	}
@@ -186,7 +186,79 @@ func TestConfigReader(t *testing.T) {
 	if e.(*self.Reader) == nil {
 		t.Error("e.(*self.Reader) = (nil); want (c = Reader)")
 	}
-	if e.Endpoint() == c.SelfEndpoint {
-		t.Errorf("Endpoint() = (%s); want (tempServer)", e.Endpoint())
+	if e.Endpoint() != "" {
+		t.Errorf("Endpoint() = (%s); want (empty)", e.Endpoint())
+	}
+}
+
+func TestConfigReaderWithDebugAddr(t *testing.T) {
+	tcs := []struct {
+		addr string
+		want string
+	}{
+		{":6060", "http://127.0.0.1:6060/debug/vars"},
+		{"0.0.0.0:6060", "http://127.0.0.1:6060/debug/vars"},
+		{"localhost:6060", "http://localhost:6060/debug/vars"},
+		{"10.0.0.1:6060", "http://10.0.0.1:6060/debug/vars"},
+	}
+	for _, tc := range tcs {
+		c, err := self.NewConfig(
+			self.WithLogger(tools.DiscardLogger()),
+			self.WithDebugAddr(tc.addr),
+		)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		c.SelfName = "name"
+		c.SelfTypeName = "name"
+		c.Cinterval = time.Second
+		e, err := c.Reader()
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if e.Endpoint() != tc.want {
+			t.Errorf("Endpoint() = (%s); want (%s)", e.Endpoint(), tc.want)
+		}
+	}
+
+	c, err := self.NewConfig(
+		self.WithLogger(tools.DiscardLogger()),
+		self.WithDebugTLS(),
+		self.WithDebugAddr(":6060"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.SelfName = "name"
+	c.SelfTypeName = "name"
+	c.Cinterval = time.Second
+	e, err := c.Reader()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if want := "https://127.0.0.1:6060/debug/vars"; e.Endpoint() != want {
+		t.Errorf("Endpoint() = (%s); want (%s)", e.Endpoint(), want)
+	}
+
+	_, err = self.NewConfig(self.WithDebugAddr("6060"))
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestConfigReaderClientCert(t *testing.T) {
+	c, err := self.NewConfig(
+		self.WithLogger(tools.DiscardLogger()),
+		self.WithDebugAddr(":6060"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.SelfName = "name"
+	c.SelfTypeName = "name"
+	c.Cinterval = time.Second
+	c.ClientKeyFile = "/etc/expipe/client.key"
+	if _, err = c.Reader(); errors.Cause(err) != httpclient.ErrIncompleteCert {
+		t.Errorf("err = (%v); want (ErrIncompleteCert)", err)
 	}
 }
@@ -3,41 +3,40 @@
 // License that can be found in the LICENSE file.
 
 // Package self contains codes for recording expipe's own metrics.
-//
 package self
 
 import (
-	"bytes"
-	"context"
 	"expvar"
 	"fmt"
 	"net/http"
-	"net/http/httptest"
-	"net/url"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/pinger"
 	"github.com/alext234/expipe/tools/token"
 	"github.com/pkg/errors"
-	"golang.org/x/net/context/ctxhttp"
 )
 
-// Reader reads from expipe own application's metric information.
-// It implements DataReader interface.
+// Reader reads from expipe own application's metric information. The metrics
+// are taken from a snapshot of the expvar variables of the process, therefore
+// there is no network round trip. It implements DataReader interface.
 type Reader struct {
-	name       string
-	typeName   string
-	log        tools.FieldLogger
-	mapper     datatype.Mapper
-	interval   time.Duration
-	timeout    time.Duration
-	quit       chan struct{}
-	endpoint   string
-	pinged     bool
-	testMode   bool // this is for internal tests. You should not set it to true.
-	tempServer *httptest.Server
+	name      string
+	typeName  string
+	log       tools.FieldLogger
+	mapper    datatype.Mapper
+	interval  time.Duration
+	timeout   time.Duration
+	timestamp reader.Timestamp
+	labels    datatype.Labels
+	quit      chan struct{}
+	endpoint  string // the debug listener, if any.
+	pinged    bool
+	client    *http.Client
+	pinger    *pinger.Pinger
 }
 
 // New exposes expipe's own metrics.
@@ -53,9 +52,6 @@ func New(options ...func(reader.Constructor) error) (*Reader, error) {
 	if r.name == "" {
 		return nil, reader.ErrEmptyName
 	}
-	if r.endpoint == "" {
-		return nil, reader.ErrEmptyEndpoint
-	}
 	if r.mapper == nil {
 		r.mapper = datatype.DefaultMapper()
 	}
@@ -71,18 +67,24 @@ func New(options ...func(reader.Constructor) error) (*Reader, error) {
 	if r.log == nil {
 		r.log = tools.GetLogger("error")
 	}
+	if r.client == nil {
+		r.client = httpclient.Default()
+	}
 	r.log = r.log.WithField("engine", "self")
 	r.quit = make(chan struct{})
 	return r, nil
 }
 
-// Ping pings the endpoint and return nil if was successful. It returns an error
-// if the endpoint is not available.
-// TODO: this method is duplicated. Create a Pinger type and share the logic.
+// Ping pings the debug listener if the endpoint is set and return nil if was
+// successful. It returns an error if the endpoint is not available. The
+// metrics are read in-process, therefore there is nothing to ping without an
+// endpoint.
 func (r *Reader) Ping() error {
-	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
-	defer cancel()
-	_, err := ctxhttp.Head(ctx, nil, r.endpoint)
+	if r.endpoint == "" {
+		r.pinged = true
+		return nil
+	}
+	err := r.ping()
 	if err != nil {
 		return reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
 	}
@@ -90,23 +92,32 @@ func (r *Reader) Ping() error {
 	return nil
 }
 
+// ping creates the pinger on the first call.
+func (r *Reader) ping() error {
+	if r.pinger == nil {
+		options := []func(*pinger.Pinger) error{
+			pinger.WithName(r.name),
+			pinger.WithTimeout(r.timeout),
+		}
+		if r.client != nil {
+			options = append(options, pinger.WithClient(r.client))
+		}
+		p, err := pinger.New(r.endpoint, options...)
+		if err != nil {
+			return err
+		}
+		r.pinger = p
+	}
+	return r.pinger.Ping()
+}
+
 // Read send the metrics back. The error is usually nil.
 func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
 	if !r.pinged {
 		return nil, reader.ErrPingNotCalled
 	}
-	// To support the tests
-	if r.testMode {
-		_, err := r.readMetricsFromURL(job)
-		if err != nil {
-			return nil, err
-		}
-		// to support invalid JSON check in tests
-		if !checkJSON(job, r.endpoint) {
-			return nil, reader.ErrInvalidJSON
-		}
-	}
-	buf := new(bytes.Buffer) // construct a json encoder and pass it
+	buf := tools.GetBuffer() // construct a json encoder and pass it
+	defer tools.PutBuffer(buf)
 	fmt.Fprint(buf, "{\n")
 	first := true
 	expvar.Do(func(kv expvar.KeyValue) {
@@ -117,38 +128,31 @@ func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
 		fmt.Fprintf(buf, "%q: %s", kv.Key, kv.Value)
 	})
 	fmt.Fprint(buf, "\n}\n")
+	content := make([]byte, buf.Len())
+	copy(content, buf.Bytes())
+	ts, err := r.timestamp.Time(content, time.Now()) // It is sensible to record the time now
+	if err != nil {
+		return nil, err
+	}
 	res := &reader.Result{
 		ID:       job.ID(),
-		Time:     time.Now(), // It is sensible to record the time now
-		Content:  buf.Bytes(),
+		Time:     ts,
+		Content:  content,
 		TypeName: r.TypeName(),
 		Mapper:   r.Mapper(),
+		Labels:   r.labels,
 	}
 	return res, nil
 }
 
-func checkJSON(job context.Context, endpoint string) bool {
-	resp, err := ctxhttp.Get(job, nil, endpoint)
-	if err != nil {
-		return false
-	}
-	defer resp.Body.Close()
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(resp.Body)
-	content := buf.Bytes()
-	if !tools.IsJSON(content) {
-		return false
-	}
-	return true
-}
-
 // Name shows the name identifier for this reader
 func (r *Reader) Name() string { return r.name }
 
 // SetName sets the name of the reader
 func (r *Reader) SetName(name string) { r.name = name }
 
-// Endpoint returns the endpoint
+// Endpoint returns the endpoint of the debug listener, or empty if it is not
+// set.
 func (r *Reader) Endpoint() string { return r.endpoint }
 
 // SetEndpoint sets the endpoint of the reader
@@ -178,51 +182,14 @@ func (r *Reader) Timeout() time.Duration { return r.timeout }
 // SetTimeout sets the timeout of the reader
 func (r *Reader) SetTimeout(timeout time.Duration) { r.timeout = timeout }
 
-// SetLogger sets the log of the reader
-func (r *Reader) SetLogger(log tools.FieldLogger) { r.log = log }
+// SetTimestamp sets the timestamp field of the reader.
+func (r *Reader) SetTimestamp(timestamp reader.Timestamp) { r.timestamp = timestamp }
 
-// SetTestMode sets the mode to testing for testing purposes
-// This is because the way self works
-func (r *Reader) SetTestMode() { r.testMode = true }
+// SetLabels sets the labels of the results of the reader.
+func (r *Reader) SetLabels(labels datatype.Labels) { r.labels = labels }
 
-// this is only used in tests.
-// TODO: [refactor] this.
-func (r *Reader) readMetricsFromURL(job *token.Context) (*reader.Result, error) {
-	resp, err := http.Get(r.endpoint)
-	if err != nil {
-		if _, ok := err.(*url.Error); ok {
-			err = reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
-		}
-		r.log.WithField("reader", "self").
-			WithField("ID", job.ID()).
-			// Error because it is a local dependency.
-			Errorf("%s: error making request: %v", r.name, err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(resp.Body)
-	res := &reader.Result{
-		ID:       job.ID(),
-		Time:     time.Now(), // It is sensible to record the time now
-		Content:  buf.Bytes(),
-		TypeName: r.TypeName(),
-		Mapper:   r.Mapper(),
-	}
-	return res, nil
-}
+// SetHTTPClient sets the http client of the reader.
+func (r *Reader) SetHTTPClient(client *http.Client) { r.client = client }
 
-// WithTempServer creates a temp server that does nothing and attach it to the
-// reader to response to Engine pings.
-func WithTempServer() func(reader.Constructor) error {
-	return func(e reader.Constructor) error {
-		if sl, ok := e.(*Reader); ok {
-			sl.tempServer = httptest.NewServer(http.HandlerFunc(
-				func(w http.ResponseWriter, r *http.Request) {}),
-			)
-			sl.endpoint = sl.tempServer.URL
-			return nil
-		}
-		return errors.New("incompatible server")
-	}
-}
+// SetLogger sets the log of the reader
+func (r *Reader) SetLogger(log tools.FieldLogger) { r.log = log }
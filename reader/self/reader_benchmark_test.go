@@ -0,0 +1,26 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package self_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/reader/self"
+	"github.com/alext234/expipe/tools/token"
+)
+
+func BenchmarkRead(b *testing.B) {
+	red, _ := self.New(reader.WithName("self"), reader.WithTypeName("my_type"))
+	red.Ping()
+	job := token.New(context.Background())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		red.Read(job)
+	}
+}
+
@@ -5,69 +5,118 @@
 package self_test
 
 import (
-	"net/http"
+	"context"
+	"encoding/json"
+	"expvar"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/reader/self"
-	rt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
 )
 
-func getTestServer() *httptest.Server {
-	return httptest.NewServer(
-		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte("{}"))
-		}),
-	)
-}
-
-type Construct struct {
-	*rt.BaseConstruct
-	testServer *httptest.Server
-}
+var selfVar = expvar.NewInt("self reader test")
 
-func (c *Construct) TestServer() *httptest.Server {
-	c.testServer = getTestServer()
-	return c.testServer
+func newReader(t *testing.T, options ...func(reader.Constructor) error) *self.Reader {
+	options = append([]func(reader.Constructor) error{
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("self"),
+		reader.WithTypeName("my_type"),
+		reader.WithInterval(time.Hour),
+		reader.WithTimeout(time.Hour),
+	}, options...)
+	red, err := self.New(options...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return red
 }
 
-func (c *Construct) Object() (reader.DataReader, error) {
-	s, err := self.New(c.Setters()...)
-	if err == nil {
-		s.SetTestMode()
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := self.New(reader.WithTypeName("my_type"))
+	if errors.Cause(err) != reader.ErrEmptyName {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrEmptyName)
+	}
+	red := newReader(t)
+	if red.Endpoint() != "" {
+		t.Errorf("Endpoint() = (%s); want (empty)", red.Endpoint())
+	}
+	if red.Mapper() == nil {
+		t.Error("Mapper() = (nil); want (default mapper)")
 	}
-	return s, err
 }
 
-func TestSelfReader(t *testing.T) {
-	rt.TestSuites(t, func() (rt.Constructor, func()) {
-		c := &Construct{
-			testServer:    getTestServer(),
-			BaseConstruct: rt.NewBaseConstruct(),
-		}
-		return c, func() { c.testServer.Close() }
-	})
+func TestReadSnapshotsExpvar(t *testing.T) {
+	t.Parallel()
+	selfVar.Set(66)
+	labels := datatype.Labels{"env": "test"}
+	red := newReader(t, reader.WithLabels(labels))
+	job := token.New(context.Background())
+
+	res, err := red.Read(job)
+	if errors.Cause(err) != reader.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrPingNotCalled)
+	}
+	if res != nil {
+		t.Errorf("res = (%v); want (nil)", res)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	res, err = red.Read(job)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if res.ID != job.ID() {
+		t.Errorf("res.ID = (%s); want (%s)", res.ID, job.ID())
+	}
+	if res.TypeName != "my_type" {
+		t.Errorf("res.TypeName = (%s); want (my_type)", res.TypeName)
+	}
+	if res.Mapper != red.Mapper() {
+		t.Errorf("res.Mapper = (%v); want (%v)", res.Mapper, red.Mapper())
+	}
+	if res.Labels["env"] != "test" {
+		t.Errorf("res.Labels = (%v); want (%v)", res.Labels, labels)
+	}
+	var content map[string]interface{}
+	if err = json.Unmarshal(res.Content, &content); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if v := content["self reader test"]; v != float64(66) {
+		t.Errorf("content[self reader test] = (%v); want (66)", v)
+	}
+	if _, ok := content["memstats"]; !ok {
+		t.Error("memstats is not in the content")
+	}
+	container, _ := datatype.JobResultDataTypes(res.Content, red.Mapper())
+	if container.Len() == 0 {
+		t.Error("container.Len() = 0; want (!= 0)")
+	}
 }
 
-func TestWithTempServer(t *testing.T) {
+func TestPingDebugListener(t *testing.T) {
 	t.Parallel()
-	var r reader.Constructor
-	r = new(rt.Reader)
-	err := self.WithTempServer()(r)
-	if err == nil {
-		t.Error("WithTempServer(): err = (nil); want (error)")
-	}
-	r = new(self.Reader)
-	err = self.WithTempServer()(r)
-	if err != nil {
-		t.Errorf("WithTempServer(): err = (%#v); want (nil)", err)
+	ts := httptest.NewServer(expvar.Handler())
+	defer ts.Close()
+	red := newReader(t, reader.WithEndpoint(ts.URL))
+	if err := red.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
 	}
-	s := r.(*self.Reader)
-	reader.WithTimeout(time.Second)(s)
-	err = s.Ping()
-	if err != nil {
-		t.Errorf("Ping(): err = (%#v); want (nil)", err)
+
+	ts.Close()
+	red = newReader(t, reader.WithEndpoint(ts.URL))
+	err := red.Ping()
+	if _, ok := errors.Cause(err).(reader.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (reader.EndpointNotAvailableError)", err)
+	}
+	if _, err = red.Read(token.New(context.Background())); errors.Cause(err) != reader.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrPingNotCalled)
 	}
 }
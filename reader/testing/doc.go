@@ -32,6 +32,14 @@
 //
 // The test suit will pick it up and does all the tests.
 //
+// Golden Files
+//
+// TestGolden reads each .payload file of a directory with the reader, and
+// compares its values and document with the .values and .document golden
+// files of the same name. Set the EXPIPE_UPDATE_GOLDEN environment variable to
+// write the golden files. Readers of other packages can run it on a copy of
+// the golden files of the expvar reader to certify their compatibility.
+//
 // Important Note
 //
 // The test suite might close and request the test server multiple times during
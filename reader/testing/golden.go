@@ -0,0 +1,106 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/internal/golden"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// TestGolden runs a golden-file test for each .payload file of the dir. The
+// reader of the Constructor reads the payload from a test server, and the
+// values of its DataContainer and the document that is recorded from them are
+// compared with the .values and .document files of the same name:
+//
+//    testdata/golden/memstats.payload   the response of the endpoint
+//    testdata/golden/memstats.values    one value per line, sorted
+//    testdata/golden/memstats.document  indented json, with its keys sorted
+//
+// The documents are stamped with a fixed time. The golden files are written
+// instead when the EXPIPE_UPDATE_GOLDEN environment variable is set. The
+// readers of other packages can run it to certify that they produce the same
+// documents as the readers of expipe for the same payloads.
+func TestGolden(t *testing.T, dir string, setup func() (Constructor, func())) {
+	for _, path := range golden.Payloads(t, dir) {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), golden.PayloadExt), func(t *testing.T) {
+			cons, cleanup := setup()
+			defer cleanup()
+			goldenCheck(t, cons, path)
+		})
+	}
+}
+
+func goldenCheck(t *testing.T, cons Constructor, path string) {
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer ts.Close()
+	cons.SetName("golden")
+	cons.SetTypeName("golden")
+	cons.SetEndpoint(ts.URL)
+	cons.SetInterval(time.Hour)
+	cons.SetTimeout(time.Hour)
+	red, err := cons.Object()
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	res, err := red.Read(token.New(context.Background()))
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if res == nil {
+		t.Fatal("result = (nil); want (values)")
+	}
+	payloadValues, err := datatype.JobResultDataTypes(res.Content, res.Mapper)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c, ok := payloadValues.(*datatype.Container); ok && len(res.Labels) > 0 {
+		c.SetLabels(res.Labels)
+	}
+
+	var values []string
+	for _, v := range payloadValues.List() {
+		b, err := ioutil.ReadAll(v)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		v.Reset()
+		values = append(values, string(b))
+	}
+	sort.Strings(values)
+	golden.Check(t, golden.File(path, golden.ValuesExt), []byte(strings.Join(values, "\n")+"\n"))
+
+	buf := new(bytes.Buffer)
+	if _, err = payloadValues.Generate(buf, golden.Time); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	doc, err := golden.JSON(buf.Bytes())
+	if err != nil {
+		t.Fatalf("document is not valid json: %v\n%s", err, buf)
+	}
+	golden.Check(t, golden.File(path, golden.DocumentExt), doc)
+}
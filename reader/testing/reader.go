@@ -5,14 +5,15 @@
 package testing
 
 import (
-	"bytes"
-	"context"
+	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/pinger"
 	"github.com/alext234/expipe/tools/token"
 	"github.com/pkg/errors"
 
@@ -21,16 +22,20 @@ import (
 
 // Reader is useful for testing purposes.
 type Reader struct {
-	MockName     string
-	MockTypeName string
-	MockEndpoint string
-	MockMapper   datatype.Mapper
-	log          tools.FieldLogger
-	MockInterval time.Duration
-	timeout      time.Duration
-	ReadFunc     func(*token.Context) (*reader.Result, error)
-	PingFunc     func() error
-	Pinged       bool
+	MockName      string
+	MockTypeName  string
+	MockEndpoint  string
+	MockMapper    datatype.Mapper
+	log           tools.FieldLogger
+	MockInterval  time.Duration
+	MockTimestamp reader.Timestamp
+	MockLabels    datatype.Labels
+	timeout       time.Duration
+	ReadFunc      func(*token.Context) (*reader.Result, error)
+	PingFunc      func() error
+	Pinged        bool
+	client        *http.Client
+	pinger        *pinger.Pinger
 }
 
 // New is a reader for using in tests.
@@ -68,6 +73,9 @@ func checkReader(r *Reader) error {
 	if r.timeout == 0 {
 		r.timeout = 5 * time.Second
 	}
+	if r.client == nil {
+		r.client = httpclient.Default()
+	}
 	if r.log == nil {
 		r.log = tools.GetLogger("info")
 	}
@@ -82,9 +90,7 @@ func (r *Reader) Ping() error {
 	if r.Pinged {
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
-	defer cancel()
-	_, err := ctxhttp.Head(ctx, nil, r.MockEndpoint)
+	err := r.ping()
 	if err != nil {
 		return reader.EndpointNotAvailableError{
 			Endpoint: r.MockEndpoint,
@@ -95,6 +101,22 @@ func (r *Reader) Ping() error {
 	return nil
 }
 
+// ping creates the pinger if the Reader was not created with New.
+func (r *Reader) ping() error {
+	if r.pinger == nil {
+		options := []func(*pinger.Pinger) error{pinger.WithTimeout(r.timeout)}
+		if r.client != nil {
+			options = append(options, pinger.WithClient(r.client))
+		}
+		p, err := pinger.New(r.MockEndpoint, options...)
+		if err != nil {
+			return err
+		}
+		r.pinger = p
+	}
+	return r.pinger.Ping()
+}
+
 // Read executes the ReadFunc if defined, otherwise continues normally.
 func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
 	if r.ReadFunc != nil {
@@ -103,7 +125,7 @@ func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
 	if !r.Pinged {
 		return nil, reader.ErrPingNotCalled
 	}
-	resp, err := ctxhttp.Get(job, nil, r.MockEndpoint)
+	resp, err := ctxhttp.Get(job, r.client, r.MockEndpoint)
 	if err != nil {
 		if _, ok := err.(*url.Error); ok {
 			err = reader.EndpointNotAvailableError{
@@ -114,17 +136,24 @@ func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(resp.Body)
-	if !tools.IsJSON(buf.Bytes()) {
+	content, err := tools.ReadAllSize(resp.Body, resp.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+	if !tools.IsJSON(content) {
 		return nil, reader.ErrInvalidJSON
 	}
+	ts, err := r.MockTimestamp.Time(content, time.Now())
+	if err != nil {
+		return nil, err
+	}
 	res := &reader.Result{
 		ID:       job.ID(),
-		Time:     time.Now(),
-		Content:  buf.Bytes(),
+		Time:     ts,
+		Content:  content,
 		TypeName: r.TypeName(),
 		Mapper:   r.Mapper(),
+		Labels:   r.MockLabels,
 	}
 	return res, nil
 }
@@ -168,5 +197,14 @@ func (r *Reader) SetTimeout(timeout time.Duration) { r.timeout = timeout }
 // Logger returns the log.
 func (r *Reader) Logger() tools.FieldLogger { return r.log }
 
+// SetTimestamp sets the timestamp field of the reader.
+func (r *Reader) SetTimestamp(timestamp reader.Timestamp) { r.MockTimestamp = timestamp }
+
+// SetLabels sets the labels of the results of the reader.
+func (r *Reader) SetLabels(labels datatype.Labels) { r.MockLabels = labels }
+
+// SetHTTPClient sets the http client of the reader.
+func (r *Reader) SetHTTPClient(client *http.Client) { r.client = client }
+
 // SetLogger sets the log of the reader.
 func (r *Reader) SetLogger(log tools.FieldLogger) { r.log = log }
@@ -5,6 +5,7 @@
 package testing
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"sync"
 	"testing"
@@ -105,6 +106,12 @@ func TestSuites(t *testing.T, setup func() (Constructor, func())) {
 		defer cleanup()
 		jasonMarshallableCheck(t, cons)
 	})
+	t.Run("TimestampFieldCheck", func(t *testing.T) {
+		t.Parallel()
+		cons, cleanup := setup()
+		defer cleanup()
+		timestampFieldCheck(t, cons)
+	})
 }
 
 // BaseConstruct implements Constructor interface. It only remembers the setter
@@ -167,3 +174,18 @@ func (b *BaseConstruct) SetInterval(interval time.Duration) {
 func (b *BaseConstruct) SetTimeout(timeout time.Duration) {
 	b.add("timeout", reader.WithTimeout(timeout))
 }
+
+// SetTimestamp adds a Timestamp value to setter configuration.
+func (b *BaseConstruct) SetTimestamp(timestamp reader.Timestamp) {
+	b.add("timestamp", reader.WithTimestamp(timestamp.Field, timestamp.Format))
+}
+
+// SetLabels adds a Labels value to setter configuration.
+func (b *BaseConstruct) SetLabels(labels datatype.Labels) {
+	b.add("labels", reader.WithLabels(labels))
+}
+
+// SetHTTPClient adds a HTTPClient value to setter configuration.
+func (b *BaseConstruct) SetHTTPClient(client *http.Client) {
+	b.add("httpClient", reader.WithHTTPClient(client))
+}
@@ -125,3 +125,30 @@ func jasonMarshallableCheck(t testing.TB, cons Constructor) {
 		t.Error("result = (nil); want (reader.Result)")
 	}
 }
+
+// timestampFieldCheck is a test helper to test the reader returns an error
+// when the timestamp field is not in the content.
+func timestampFieldCheck(t testing.TB, cons Constructor) {
+	ctx := context.Background()
+	cons.SetName("the name")
+	cons.SetTypeName("my type")
+	cons.SetEndpoint(cons.TestServer().URL)
+	cons.SetInterval(time.Hour)
+	cons.SetTimeout(time.Hour)
+	cons.SetTimestamp(reader.Timestamp{Field: "does.not.exist"})
+	red, err := cons.Object()
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err = red.Ping()
+	if errors.Cause(err) != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	result, err := red.Read(token.New(ctx))
+	if _, ok := errors.Cause(err).(reader.TimestampError); !ok {
+		t.Errorf("err = (%v); want (reader.TimestampError)", err)
+	}
+	if result != nil {
+		t.Errorf("result = (%v); want (nil)", result)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package reader
+
+import (
+	"strings"
+	"time"
+
+	"github.com/antonholmquist/jason"
+	"github.com/pkg/errors"
+)
+
+// Timestamp formats for the numeric values.
+const (
+	UnixFormat   = "unix"    // seconds since epoch.
+	UnixMsFormat = "unix_ms" // milliseconds since epoch.
+)
+
+// Timestamp takes the time of a result from a field inside its content,
+// therefore delayed reads don't skew the time series. Field is the path to the
+// value in the json object, separated by dots, e.g. "meta.time". Format is
+// either a time layout for string values, or UnixFormat or UnixMsFormat for
+// numeric values. time.RFC3339 is used if Format is empty.
+type Timestamp struct {
+	Field  string
+	Format string
+}
+
+// Time returns the time found in the content. It returns now if the Field is
+// empty.
+func (t Timestamp) Time(content []byte, now time.Time) (time.Time, error) {
+	if t.Field == "" {
+		return now, nil
+	}
+	obj, err := jason.NewObjectFromBytes(content)
+	if err != nil {
+		return now, errors.Wrap(err, "timestamp")
+	}
+	v, err := obj.GetValue(strings.Split(t.Field, ".")...)
+	if err != nil {
+		return now, TimestampError{Field: t.Field, Err: err}
+	}
+	switch t.Format {
+	case UnixFormat, UnixMsFormat:
+		unit := time.Second
+		if t.Format == UnixMsFormat {
+			unit = time.Millisecond
+		}
+		// integers are converted without the float's rounding errors.
+		if n, err := v.Int64(); err == nil {
+			return time.Unix(0, n*int64(unit)), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return now, TimestampError{Field: t.Field, Err: err}
+		}
+		return time.Unix(0, int64(f*float64(unit))), nil
+	}
+	s, err := v.String()
+	if err != nil {
+		return now, TimestampError{Field: t.Field, Err: err}
+	}
+	format := t.Format
+	if format == "" {
+		format = time.RFC3339
+	}
+	ts, err := time.Parse(format, s)
+	if err != nil {
+		return now, TimestampError{Field: t.Field, Err: err}
+	}
+	return ts, nil
+}
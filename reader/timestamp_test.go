@@ -0,0 +1,69 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package reader_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/reader"
+	"github.com/pkg/errors"
+)
+
+func TestTimestampTime(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	tcs := []struct {
+		name    string
+		ts      reader.Timestamp
+		content string
+		want    time.Time
+	}{
+		{"no field", reader.Timestamp{}, `{}`, now},
+		{"rfc3339", reader.Timestamp{Field: "time"}, `{"time":"2016-05-06T07:08:09Z"}`, time.Date(2016, 5, 6, 7, 8, 9, 0, time.UTC)},
+		{"nested", reader.Timestamp{Field: "meta.time"}, `{"meta":{"time":"2016-05-06T07:08:09Z"}}`, time.Date(2016, 5, 6, 7, 8, 9, 0, time.UTC)},
+		{"layout", reader.Timestamp{Field: "time", Format: "2006-01-02 15:04"}, `{"time":"2016-05-06 07:08"}`, time.Date(2016, 5, 6, 7, 8, 0, 0, time.UTC)},
+		{"unix", reader.Timestamp{Field: "time", Format: reader.UnixFormat}, `{"time":1462518489}`, time.Unix(1462518489, 0)},
+		{"unix fraction", reader.Timestamp{Field: "time", Format: reader.UnixFormat}, `{"time":1462518489.5}`, time.Unix(1462518489, 5e8)},
+		{"unix ms", reader.Timestamp{Field: "time", Format: reader.UnixMsFormat}, `{"time":1462518489123}`, time.Unix(1462518489, 123e6)},
+	}
+	for _, tc := range tcs {
+		got, err := tc.ts.Time([]byte(tc.content), now)
+		if err != nil {
+			t.Errorf("%s: err = (%v); want (nil)", tc.name, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("%s: Time() = (%v); want (%v)", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTimestampTimeErrors(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	tcs := []struct {
+		name    string
+		ts      reader.Timestamp
+		content string
+	}{
+		{"missing field", reader.Timestamp{Field: "time"}, `{}`},
+		{"not a string", reader.Timestamp{Field: "time"}, `{"time":12}`},
+		{"bad layout", reader.Timestamp{Field: "time"}, `{"time":"yesterday"}`},
+		{"not a number", reader.Timestamp{Field: "time", Format: reader.UnixFormat}, `{"time":"12"}`},
+	}
+	for _, tc := range tcs {
+		got, err := tc.ts.Time([]byte(tc.content), now)
+		if _, ok := errors.Cause(err).(reader.TimestampError); !ok {
+			t.Errorf("%s: err = (%v); want (reader.TimestampError)", tc.name, err)
+		}
+		if !got.Equal(now) {
+			t.Errorf("%s: Time() = (%v); want (%v)", tc.name, got, now)
+		}
+	}
+	if _, err := (reader.Timestamp{Field: "time"}).Time([]byte(`not json`), now); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	typeNameReg      = regexp.MustCompile(`\{[^{}]*\}`)
+	typeNamePlaceReg = regexp.MustCompile(`^\{(reader|host|field:[^{}]+)\}$`)
+)
+
+// TypeNameError is returned when the type_name template has an unknown
+// placeholder.
+type TypeNameError string
+
+func (t TypeNameError) Error() string {
+	return fmt.Sprintf("unknown placeholder in type_name: %s", string(t))
+}
+
+// checkTypeName returns a TypeNameError for the first placeholder of the
+// typeName that is not known.
+func checkTypeName(typeName string) error {
+	for _, p := range typeNameReg.FindAllString(typeName, -1) {
+		if !typeNamePlaceReg.MatchString(p) {
+			return TypeNameError(p)
+		}
+	}
+	return nil
+}
+
+// ExpandTypeName replaces the placeholders of the typeName template with the
+// values of a result, therefore one reader of many targets produces
+// distinguishable types:
+//
+//	{reader}      the name of the reader
+//	{host}        the host of the endpoint, without the port
+//	{field:path}  the value of the dotted path of the json content
+//
+// The fields that are missing from the content are replaced with empty
+// strings. It returns the name of the reader if the expanded type name is
+// empty. The typeName is returned as it is if it has no placeholders.
+func ExpandTypeName(typeName, name, endpoint string, content []byte) string {
+	if !strings.Contains(typeName, "{") {
+		return typeName
+	}
+	var doc map[string]interface{}
+	expanded := typeNameReg.ReplaceAllStringFunc(typeName, func(p string) string {
+		switch p = p[1 : len(p)-1]; {
+		case p == "reader":
+			return name
+		case p == "host":
+			return hostOf(endpoint)
+		case strings.HasPrefix(p, "field:"):
+			if doc == nil {
+				doc = make(map[string]interface{})
+				json.Unmarshal(content, &doc)
+			}
+			return fieldString(doc, strings.Split(strings.TrimPrefix(p, "field:"), "."))
+		}
+		return "{" + p + "}"
+	})
+	if expanded == "" {
+		return name
+	}
+	return expanded
+}
+
+// hostOf returns the host of the endpoint without its port. The endpoints
+// without a scheme are accepted.
+func hostOf(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// fieldString returns the value of the dotted path of the doc as a string. The
+// keys of the doc can have dots, therefore the longest matching key is tried
+// first.
+func fieldString(doc map[string]interface{}, parts []string) string {
+	for i := len(parts); i > 0; i-- {
+		v, ok := doc[strings.Join(parts[:i], ".")]
+		if !ok {
+			continue
+		}
+		if i < len(parts) {
+			if m, ok := v.(map[string]interface{}); ok {
+				if s := fieldString(m, parts[i:]); s != "" {
+					return s
+				}
+			}
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package reader_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/reader"
+)
+
+func TestExpandTypeName(t *testing.T) {
+	content := []byte(`{"app":"billing","memstats":{"NumGC":42},"host.name":"web1","ok":true}`)
+	tcs := []struct {
+		name     string
+		typeName string
+		endpoint string
+		want     string
+	}{
+		{"plain", "expipe", "http://localhost", "expipe"},
+		{"reader", "{reader}", "http://localhost", "red"},
+		{"host", "app-{host}", "http://10.0.0.1:8080/debug/vars", "app-10.0.0.1"},
+		{"host without scheme", "{host}", "example.com:9200", "example.com"},
+		{"field", "{field:app}", "", "billing"},
+		{"nested field", "gc-{field:memstats.NumGC}", "", "gc-42"},
+		{"dotted key", "{field:host.name}", "", "web1"},
+		{"bool field", "{field:ok}", "", "true"},
+		{"missing field", "app-{field:version}", "", "app-"},
+		{"empty", "{field:version}", "", "red"},
+		{"all", "{reader}.{host}.{field:app}", "http://web1:80", "red.web1.billing"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := reader.ExpandTypeName(tc.typeName, "red", tc.endpoint, content)
+			if got != tc.want {
+				t.Errorf("ExpandTypeName() = (%s); want (%s)", got, tc.want)
+			}
+		})
+	}
+}
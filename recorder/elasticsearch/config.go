@@ -7,20 +7,68 @@ package elasticsearch
 import (
 	"time"
 
+	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/recorder"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
 	"github.com/pkg/errors"
 )
 
 // Config holds the necessary configuration for setting up an elasticsearch
-// reader endpoint from a configuration file.
+// reader endpoint from a configuration file. The requests are sent through the
+// proxy_url if set, otherwise through the proxy of the environment. The
+// timestamp of the documents is written in the timestamp_field, which defaults
+// to @timestamp, with the timestamp_format in the time_zone. The
+// timestamp_format is a Go time layout, unix or unix_ms, and the time_zone is a
+// name of the IANA time zone database, for example UTC or Australia/Sydney.
+// The document_id is the template of the _id of the documents, see
+// WithDocumentID for its placeholders. The routing is the template of the
+// _routing of the documents with the same placeholders. The documents that are
+// rejected in the batches are indexed into the dead_letter_index if it is set.
+// The request bodies are compressed with gzip if compress is true. The indices
+// that are older than the retention.max_age are removed, see RetentionConfig.
 type Config struct {
-	ESEndpoint  string `mapstructure:"endpoint"`
-	ESTimeout   string `mapstructure:"timeout"`
-	ESIndexName string `mapstructure:"index_name"`
-	log         tools.FieldLogger
-	ESName      string
-	ConfTimeout time.Duration
+	ESEndpoint     string          `mapstructure:"endpoint"`
+	ESTimeout      string          `mapstructure:"timeout"`
+	ESIndexName    string          `mapstructure:"index_name"`
+	ESUsername     string          `mapstructure:"username"`
+	ESPassword     string          `mapstructure:"password"`
+	ESPasswordFile string          `mapstructure:"password_file"`
+	ESProxyURL     string          `mapstructure:"proxy_url"`
+	TSField        string          `mapstructure:"timestamp_field"`
+	TSFormat       string          `mapstructure:"timestamp_format"`
+	TimeZone       string          `mapstructure:"time_zone"`
+	DocumentID     string          `mapstructure:"document_id"`
+	Routing        string          `mapstructure:"routing"`
+	DeadLetter     string          `mapstructure:"dead_letter_index"`
+	Compress       bool            `mapstructure:"compress"`
+	Retention      RetentionConfig `mapstructure:"retention"`
+	log            tools.FieldLogger
+	ESName         string
+	ConfTimeout    time.Duration
+	ConfLocation   *time.Location
+	ConfRetention  Retention
+}
+
+// RetentionConfig is the retention section of the Config. The indices of the
+// pattern are deleted or shrunk by the action when they are older than the
+// max_age. The pattern and max_age are required. The indices are looked up on
+// the interval, which defaults to an hour.
+type RetentionConfig struct {
+	Pattern  string `mapstructure:"pattern"`
+	MaxAge   string `mapstructure:"max_age"`
+	Action   string `mapstructure:"action"`
+	Interval string `mapstructure:"interval"`
+}
+
+func init() {
+	recorder.Register("elasticsearch", func(src recorder.Source, log tools.FieldLogger, name, key string) (recorder.DataRecorder, error) {
+		rc, err := NewConfig(WithViper(src, name, key), WithLogger(log))
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
+	})
 }
 
 // Conf func is used for initializing a Config object.
@@ -41,13 +89,46 @@ func NewConfig(conf ...Conf) (*Config, error) {
 
 // Recorder implements the RecorderConf interface.
 func (c *Config) Recorder() (recorder.DataRecorder, error) {
-	return New(
+	options := []func(recorder.Constructor) error{
 		recorder.WithLogger(c.Logger()),
 		recorder.WithEndpoint(c.Endpoint()),
 		recorder.WithName(c.Name()),
 		recorder.WithIndexName(c.IndexName()),
 		recorder.WithTimeout(c.Timeout()),
-	)
+	}
+	if c.ESUsername != "" {
+		options = append(options, WithBasicAuth(c.ESUsername, c.ESPassword))
+	}
+	if c.ESProxyURL != "" {
+		client, err := httpclient.WithProxy(c.ESProxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "proxy_url")
+		}
+		options = append(options, recorder.WithHTTPClient(client))
+	}
+	if c.TSField != "" || c.TSFormat != "" || c.ConfLocation != nil {
+		options = append(options, WithTimestamp(datatype.Timestamp{
+			Field:    c.TSField,
+			Format:   c.TSFormat,
+			Location: c.ConfLocation,
+		}))
+	}
+	if c.DocumentID != "" {
+		options = append(options, WithDocumentID(c.DocumentID))
+	}
+	if c.Routing != "" {
+		options = append(options, WithRouting(c.Routing))
+	}
+	if c.DeadLetter != "" {
+		options = append(options, WithDeadLetterIndex(c.DeadLetter))
+	}
+	if c.Compress {
+		options = append(options, WithCompression())
+	}
+	if c.ConfRetention.MaxAge > 0 {
+		options = append(options, WithRetention(c.ConfRetention))
+	}
+	return New(options...)
 }
 
 // Name return the name.
@@ -101,8 +182,49 @@ func WithViper(v unmarshaller, name, key string) Conf {
 		if timeout, err = time.ParseDuration(c.ESTimeout); err != nil {
 			return &recorder.ParseTimeOutError{Timeout: c.ESTimeout, Err: err}
 		}
+		if c.ESPasswordFile != "" {
+			if c.ESPassword != "" {
+				return errors.New("only one of password and password_file should be set")
+			}
+			if c.ESPassword, err = tools.ReadSecretFile(c.ESPasswordFile); err != nil {
+				return errors.Wrap(err, "password_file")
+			}
+		}
+		if c.TimeZone != "" {
+			if c.ConfLocation, err = time.LoadLocation(c.TimeZone); err != nil {
+				return errors.Wrap(err, "time_zone")
+			}
+		}
+		if c.ConfRetention, err = c.Retention.retention(); err != nil {
+			return errors.Wrap(err, "retention")
+		}
 		c.ESName = name
 		c.ConfTimeout = timeout
 		return nil
 	}
 }
+
+// retention returns the Retention of the section. It returns an error if any
+// of the section is set without the max_age or the pattern.
+func (r RetentionConfig) retention() (Retention, error) {
+	ret := Retention{Pattern: r.Pattern, Action: r.Action}
+	if r.MaxAge == "" {
+		if r != (RetentionConfig{}) {
+			return ret, errors.New("max_age is required")
+		}
+		return ret, nil
+	}
+	if r.Pattern == "" {
+		return ret, errors.New("pattern is required")
+	}
+	var err error
+	if ret.MaxAge, err = time.ParseDuration(r.MaxAge); err != nil {
+		return ret, errors.Wrap(err, "max_age")
+	}
+	if r.Interval != "" {
+		if ret.Interval, err = time.ParseDuration(r.Interval); err != nil {
+			return ret, errors.Wrap(err, "interval")
+		}
+	}
+	return ret, nil
+}
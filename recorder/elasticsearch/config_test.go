@@ -6,6 +6,8 @@ package elasticsearch_test
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
@@ -180,3 +182,247 @@ func TestConfigRecorder(t *testing.T) {
 		t.Error("e = (nil); want (Recorder)")
 	}
 }
+
+func TestConfigRecorderProxy(t *testing.T) {
+	c, err := elasticsearch.NewConfig(elasticsearch.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.ESName = "name"
+	c.ESIndexName = "name"
+	c.ESEndpoint = "http://localhost"
+	c.ConfTimeout = time.Second
+	c.ESProxyURL = "socks5://localhost:1080"
+	if _, err = c.Recorder(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	c.ESProxyURL = "localhost:1080"
+	if _, err = c.Recorder(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestConfigRecorderDocumentID(t *testing.T) {
+	c, err := elasticsearch.NewConfig(elasticsearch.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.ESName = "name"
+	c.ESIndexName = "name"
+	c.ESEndpoint = "http://localhost"
+	c.ConfTimeout = time.Second
+	c.DocumentID = "{hash}"
+	if _, err = c.Recorder(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	c.DocumentID = "static"
+	if _, err = c.Recorder(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestConfigRecorderRouting(t *testing.T) {
+	c, err := elasticsearch.NewConfig(elasticsearch.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.ESName = "name"
+	c.ESIndexName = "name"
+	c.ESEndpoint = "http://localhost"
+	c.ConfTimeout = time.Second
+	c.Routing = "{reader}"
+	if _, err = c.Recorder(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestConfigRecorderCompress(t *testing.T) {
+	c, err := elasticsearch.NewConfig(elasticsearch.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.ESName = "name"
+	c.ESIndexName = "name"
+	c.ESEndpoint = "http://localhost"
+	c.ConfTimeout = time.Second
+	c.Compress = true
+	if _, err = c.Recorder(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestConfigRecorderDeadLetter(t *testing.T) {
+	c, err := elasticsearch.NewConfig(elasticsearch.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.ESName = "name"
+	c.ESIndexName = "name"
+	c.ESEndpoint = "http://localhost"
+	c.ConfTimeout = time.Second
+	c.DeadLetter = "dead_letters"
+	if _, err = c.Recorder(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	c.DeadLetter = "dead/letters"
+	if _, err = c.Recorder(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithViperPasswordFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "expipe_secret")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("s3cret\n")
+	f.Close()
+
+	tcs := []struct {
+		name    string
+		extra   string
+		want    string
+		wantErr bool
+	}{
+		{"password", "password: plain", "plain", false},
+		{"password_file", "password_file: " + f.Name(), "s3cret", false},
+		{"both", "password: plain\n            password_file: " + f.Name(), "", true},
+		{"missing file", "password_file: /does/not/exist", "", true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			v.ReadConfig(bytes.NewBufferString(`
+    recorders:
+        recorder1:
+            endpoint: http://127.0.0.1:9200
+            index_name: example_index
+            timeout: 10s
+            username: expipe
+            ` + tc.extra + "\n"))
+			c := new(elasticsearch.Config)
+			err := elasticsearch.WithViper(v, "recorder1", "recorders.recorder1")(c)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if c.ESUsername != "expipe" {
+				t.Errorf("c.ESUsername = (%s); want (expipe)", c.ESUsername)
+			}
+			if c.ESPassword != tc.want {
+				t.Errorf("c.ESPassword = (%s); want (%s)", c.ESPassword, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithViperTimestamp(t *testing.T) {
+	tcs := []struct {
+		name     string
+		extra    string
+		field    string
+		location string
+		wantErr  bool
+	}{
+		{"none", "", "", "", false},
+		{"field", "timestamp_field: timestamp", "timestamp", "", false},
+		{"time zone", "time_zone: Australia/Sydney", "", "Australia/Sydney", false},
+		{"bad time zone", "time_zone: Mars/Olympus", "", "", true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			v.ReadConfig(bytes.NewBufferString(`
+    recorders:
+        recorder1:
+            endpoint: http://127.0.0.1:9200
+            index_name: example_index
+            timeout: 10s
+            ` + tc.extra + "\n"))
+			c := new(elasticsearch.Config)
+			err := elasticsearch.WithViper(v, "recorder1", "recorders.recorder1")(c)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if c.TSField != tc.field {
+				t.Errorf("c.TSField = (%s); want (%s)", c.TSField, tc.field)
+			}
+			if tc.location == "" {
+				if c.ConfLocation != nil {
+					t.Errorf("c.ConfLocation = (%v); want (nil)", c.ConfLocation)
+				}
+				return
+			}
+			if c.ConfLocation == nil || c.ConfLocation.String() != tc.location {
+				t.Errorf("c.ConfLocation = (%v); want (%s)", c.ConfLocation, tc.location)
+			}
+		})
+	}
+}
+
+func TestWithViperRetention(t *testing.T) {
+	tcs := []struct {
+		name     string
+		extra    string
+		maxAge   time.Duration
+		interval time.Duration
+		wantErr  bool
+	}{
+		{"none", "", 0, 0, false},
+		{"max_age", "retention:\n                pattern: example_index-*\n                max_age: 720h", 720 * time.Hour, 0, false},
+		{"interval", "retention:\n                pattern: example_index-*\n                max_age: 720h\n                interval: 10m", 720 * time.Hour, 10 * time.Minute, false},
+		{"no max_age", "retention:\n                pattern: example_index-*\n                action: shrink", 0, 0, true},
+		{"no pattern", "retention:\n                max_age: 720h", 0, 0, true},
+		{"bad max_age", "retention:\n                pattern: example_index-*\n                max_age: month", 0, 0, true},
+		{"bad interval", "retention:\n                pattern: example_index-*\n                max_age: 720h\n                interval: often", 0, 0, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			v.ReadConfig(bytes.NewBufferString(`
+    recorders:
+        recorder1:
+            endpoint: http://127.0.0.1:9200
+            index_name: example_index
+            timeout: 10s
+            ` + tc.extra + "\n"))
+			c, err := elasticsearch.NewConfig(
+				elasticsearch.WithLogger(tools.DiscardLogger()),
+				elasticsearch.WithViper(v, "recorder1", "recorders.recorder1"),
+			)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if c.ConfRetention.MaxAge != tc.maxAge {
+				t.Errorf("MaxAge = (%v); want (%v)", c.ConfRetention.MaxAge, tc.maxAge)
+			}
+			if c.ConfRetention.Interval != tc.interval {
+				t.Errorf("Interval = (%v); want (%v)", c.ConfRetention.Interval, tc.interval)
+			}
+			if _, err = c.Recorder(); err != nil {
+				t.Errorf("err = (%v); want (nil)", err)
+			}
+		})
+	}
+}
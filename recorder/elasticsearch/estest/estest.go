@@ -0,0 +1,711 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package estest provides an in-memory fake of an elasticsearch cluster for
+// the integration tests of the recorders, therefore they don't need a running
+// cluster. It serves the parts of the REST API that the elasticsearch recorder
+// uses:
+//
+//	GET|HEAD /                          cluster info
+//	HEAD|PUT|DELETE /{index}            index exists, create and delete
+//	GET|PUT /{index}/_mapping[/{type}]  mappings
+//	GET|PUT /{index}/_settings          settings, flat_settings is supported
+//	POST /{index}/_shrink/{target}      shrink
+//	GET /_cluster/health[/{index}]      always green
+//	GET /_cat/indices                   the names of the indices
+//	POST|PUT /{index}/{type}[/{id}]     index a document
+//	POST /_bulk, POST /{index}/_bulk    index, create and delete actions
+//
+// The indices are created on the first document if they don't exist. The
+// documents are checked against the explicit mappings of their indices, and
+// are rejected with a mapper_parsing_exception if their values don't fit the
+// numeric, boolean or date fields. Failures can be injected with FailNext and
+// Reject:
+//
+//	es := estest.NewServer()
+//	defer es.Close()
+//	es.Reject(func(doc estest.Document) *estest.Error {
+//	    if doc.Index == "overloaded" {
+//	        return estest.Overloaded()
+//	    }
+//	    return nil
+//	})
+//	rec, err := elasticsearch.New(recorder.WithEndpoint(es.URL), ...)
+//	...
+//	docs := es.Documents("my_index")
+//
+// The requests with the gzip Content-Encoding are decompressed.
+package estest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the elasticsearch version that the Server reports.
+const Version = "5.6.16"
+
+// Document is a document stored in the Server.
+type Document struct {
+	Index   string
+	Type    string
+	ID      string
+	Routing string
+	Version int
+	Source  json.RawMessage
+}
+
+// Error is the error of a failed request or a rejected document.
+type Error struct {
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%d %s: %s", e.Status, e.Type, e.Reason) }
+
+// MappingError returns an Error of a document that does not fit the mapping
+// of its index. The recorders should not retry them.
+func MappingError(reason string) *Error {
+	return &Error{Status: http.StatusBadRequest, Type: "mapper_parsing_exception", Reason: reason}
+}
+
+// Overloaded returns an Error of a document that is rejected because the
+// cluster is overloaded. The recorders should retry them.
+func Overloaded() *Error {
+	return &Error{Status: http.StatusTooManyRequests, Type: "es_rejected_execution_exception", Reason: "rejected execution"}
+}
+
+type index struct {
+	mappings map[string]map[string]interface{} // type to its mapping.
+	settings map[string]string                 // flat settings.
+	docs     []*Document
+	ids      map[string]*Document
+}
+
+// Server is a fake elasticsearch cluster. It is concurrent safe.
+type Server struct {
+	*httptest.Server
+	username string
+	password string
+
+	mu       sync.Mutex
+	indices  map[string]*index     // guarded by mu.
+	failNext []*Error              // guarded by mu.
+	reject   func(Document) *Error // guarded by mu.
+	seq      int                   // for the generated ids, guarded by mu.
+	requests map[string]int        // guarded by mu.
+}
+
+// NewServer starts and returns a new Server. You should close it when you are
+// done with it.
+func NewServer(options ...func(*Server)) *Server {
+	s := &Server{
+		indices:  make(map[string]*index),
+		requests: make(map[string]int),
+	}
+	for _, o := range options {
+		o(s)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// WithBasicAuth requires the requests to have the basic authentication
+// credentials.
+func WithBasicAuth(username, password string) func(*Server) {
+	return func(s *Server) {
+		s.username, s.password = username, password
+	}
+}
+
+// FailNext fails the next n requests with the err. The GET and HEAD requests
+// of the root path are not failed, as the clients send them as pings and
+// health checks.
+func (s *Server) FailNext(n int, err *Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failNext = append(s.failNext, err)
+	}
+}
+
+// Reject sets the fn that is called with each document before it is stored.
+// The document is rejected with the Error if the fn returns one. A nil fn
+// accepts all documents.
+func (s *Server) Reject(fn func(Document) *Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = fn
+}
+
+// CreateIndex creates the index with the mappings of the types if it does not
+// exist. The mappings are in the shape of the mappings of the create index
+// API, for example: {"my_type": {"properties": {"count": {"type": "long"}}}}.
+func (s *Server) CreateIndex(name string, mappings map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.index(name).putMappings(mappings); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetCreationDate sets the creation date of the index, for testing the
+// retention of the indices. It returns false if the index does not exist.
+func (s *Server) SetCreationDate(name string, t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, ok := s.indices[name]
+	if ok {
+		idx.settings["index.creation_date"] = strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return ok
+}
+
+// Indices returns the names of the indices, sorted.
+func (s *Server) Indices() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.indices))
+	for name := range s.indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Documents returns the documents of the index in the order they were first
+// indexed. It returns nil if the index does not exist.
+func (s *Server) Documents(name string) []Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, ok := s.indices[name]
+	if !ok {
+		return nil
+	}
+	docs := make([]Document, len(idx.docs))
+	for i, d := range idx.docs {
+		docs[i] = *d
+	}
+	return docs
+}
+
+// Mapping returns the mapping of the type of the index, or nil if there is
+// none.
+func (s *Server) Mapping(name, typ string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if idx, ok := s.indices[name]; ok {
+		return idx.mappings[typ]
+	}
+	return nil
+}
+
+// Requests returns the number of the requests of the method and path that the
+// Server has received, for example Requests("POST", "/_bulk"). The trailing
+// slashes of the paths are ignored, as some clients add them to the paths of
+// the documents with generated ids.
+func (s *Server) Requests(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method+" "+trimSlash(path)]
+}
+
+// index returns the index of the name, and creates it if it does not exist.
+// The mu should be held.
+func (s *Server) index(name string) *index {
+	if idx, ok := s.indices[name]; ok {
+		return idx
+	}
+	idx := &index{
+		mappings: make(map[string]map[string]interface{}),
+		settings: map[string]string{
+			"index.creation_date":      strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10),
+			"index.number_of_shards":   "5",
+			"index.number_of_replicas": "1",
+			"index.provided_name":      name,
+		},
+		ids: make(map[string]*Document),
+	}
+	s.indices[name] = idx
+	return idx
+}
+
+// store checks the doc and stores it. It returns the stored document and the
+// result of the write, which is either created or updated. The mu should be
+// held.
+func (s *Server) store(doc Document) (*Document, string, *Error) {
+	if s.reject != nil {
+		if err := s.reject(doc); err != nil {
+			return nil, "", err
+		}
+	}
+	if !json.Valid(doc.Source) {
+		return nil, "", MappingError("failed to parse")
+	}
+	idx := s.index(doc.Index)
+	if err := idx.check(doc); err != nil {
+		return nil, "", err
+	}
+	if doc.ID == "" {
+		s.seq++
+		doc.ID = "estest-" + strconv.Itoa(s.seq)
+	}
+	if old, ok := idx.ids[doc.ID]; ok {
+		doc.Version = old.Version + 1
+		*old = doc
+		return old, "updated", nil
+	}
+	doc.Version = 1
+	stored := &doc
+	idx.docs = append(idx.docs, stored)
+	idx.ids[doc.ID] = stored
+	return stored, "created", nil
+}
+
+// remove deletes the document of the id. The mu should be held.
+func (s *Server) remove(name, id string) bool {
+	idx, ok := s.indices[name]
+	if !ok {
+		return false
+	}
+	if _, ok = idx.ids[id]; !ok {
+		return false
+	}
+	delete(idx.ids, id)
+	for i, d := range idx.docs {
+		if d.ID == id {
+			idx.docs = append(idx.docs[:i], idx.docs[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// matchIndices returns the names of the indices that match the comma separated
+// patterns, sorted. The mu should be held.
+func (s *Server) matchIndices(patterns string) []string {
+	var names []string
+	for name := range s.indices {
+		for _, p := range strings.Split(patterns, ",") {
+			if ok, _ := path.Match(p, name); ok || p == "_all" {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.username != "" {
+		if u, p, ok := r.BasicAuth(); !ok || u != s.username || p != s.password {
+			writeError(w, r, &Error{Status: http.StatusUnauthorized, Type: "security_exception", Reason: "missing authentication token"})
+			return
+		}
+	}
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "parse_exception", Reason: err.Error()})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[r.Method+" "+trimSlash(r.URL.Path)]++
+	if r.URL.Path == "/" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{
+			"name":         "estest",
+			"cluster_name": "estest",
+			"version":      map[string]interface{}{"number": Version},
+			"tagline":      "You Know, for Search",
+		})
+		return
+	}
+	if len(s.failNext) > 0 {
+		err := s.failNext[0]
+		s.failNext = s.failNext[1:]
+		writeError(w, r, err)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "":
+		writeError(w, r, &Error{Status: http.StatusMethodNotAllowed, Type: "illegal_argument_exception", Reason: r.Method})
+	case parts[0] == "_bulk":
+		s.bulk(w, r, "", body)
+	case parts[0] == "_cluster":
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{"cluster_name": "estest", "status": "green", "timed_out": false})
+	case parts[0] == "_cat":
+		s.catIndices(w, r)
+	case len(parts) == 1:
+		s.serveIndex(w, r, parts[0], body)
+	case parts[1] == "_bulk":
+		s.bulk(w, r, parts[0], body)
+	case parts[1] == "_mapping" || len(parts) == 3 && parts[2] == "_mapping":
+		typ := ""
+		if len(parts) == 3 {
+			typ = parts[2]
+			if parts[2] == "_mapping" {
+				typ = parts[1]
+			}
+		}
+		s.serveMapping(w, r, parts[0], typ, body)
+	case parts[1] == "_settings":
+		s.serveSettings(w, r, parts[0], body)
+	case parts[1] == "_shrink" && len(parts) == 3:
+		s.shrink(w, r, parts[0], parts[2])
+	case len(parts) <= 3 && !strings.HasPrefix(parts[1], "_"):
+		id := ""
+		if len(parts) == 3 {
+			id = parts[2]
+		}
+		s.serveDocument(w, r, parts[0], parts[1], id, body)
+	default:
+		writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "illegal_argument_exception", Reason: "unsupported request: " + r.Method + " " + r.URL.Path})
+	}
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	_, exists := s.indices[name]
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		if !exists {
+			writeError(w, r, notFound(name))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{name: map[string]interface{}{}})
+	case http.MethodPut:
+		if exists {
+			writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "resource_already_exists_exception", Reason: "index [" + name + "] already exists"})
+			return
+		}
+		var req struct {
+			Mappings map[string]interface{} `json:"mappings"`
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "parse_exception", Reason: err.Error()})
+				return
+			}
+		}
+		if err := s.index(name).putMappings(req.Mappings); err != nil {
+			delete(s.indices, name)
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{"acknowledged": true, "shards_acknowledged": true, "index": name})
+	case http.MethodDelete:
+		names := s.matchIndices(name)
+		if len(names) == 0 {
+			writeError(w, r, notFound(name))
+			return
+		}
+		for _, n := range names {
+			delete(s.indices, n)
+		}
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{"acknowledged": true})
+	default:
+		writeError(w, r, &Error{Status: http.StatusMethodNotAllowed, Type: "illegal_argument_exception", Reason: r.Method})
+	}
+}
+
+func (s *Server) serveDocument(w http.ResponseWriter, r *http.Request, name, typ, id string, body []byte) {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+	case http.MethodDelete:
+		if !s.remove(name, id) {
+			writeError(w, r, &Error{Status: http.StatusNotFound, Type: "not_found", Reason: "document missing"})
+			return
+		}
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{"_index": name, "_type": typ, "_id": id, "result": "deleted"})
+		return
+	default:
+		writeError(w, r, &Error{Status: http.StatusMethodNotAllowed, Type: "illegal_argument_exception", Reason: r.Method})
+		return
+	}
+	doc := Document{Index: name, Type: typ, ID: id, Routing: r.URL.Query().Get("routing"), Source: body}
+	stored, result, err := s.store(doc)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	status := http.StatusCreated
+	if result == "updated" {
+		status = http.StatusOK
+	}
+	writeJSON(w, r, status, map[string]interface{}{
+		"_index":   stored.Index,
+		"_type":    stored.Type,
+		"_id":      stored.ID,
+		"_version": stored.Version,
+		"result":   result,
+		"created":  result == "created",
+		"_shards":  map[string]int{"total": 2, "successful": 1, "failed": 0},
+	})
+}
+
+// bulk serves the bulk API. The def is the index of the path of the request.
+func (s *Server) bulk(w http.ResponseWriter, r *http.Request, def string, body []byte) {
+	start := time.Now()
+	lines := bytes.Split(body, []byte("\n"))
+	var (
+		items  []map[string]interface{}
+		failed bool
+	)
+	for i := 0; i < len(lines); i++ {
+		line := bytes.TrimSpace(lines[i])
+		if len(line) == 0 {
+			continue
+		}
+		var action map[string]map[string]interface{}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "illegal_argument_exception", Reason: "malformed action/metadata line [" + strconv.Itoa(i+1) + "]"})
+			return
+		}
+		for op, meta := range action {
+			doc := Document{Index: def}
+			if v, ok := meta["_index"].(string); ok {
+				doc.Index = v
+			}
+			doc.Type, _ = meta["_type"].(string)
+			doc.ID, _ = meta["_id"].(string)
+			if v, ok := meta["_routing"].(string); ok {
+				doc.Routing = v
+			} else {
+				doc.Routing, _ = meta["routing"].(string)
+			}
+			item := map[string]interface{}{"_index": doc.Index, "_type": doc.Type, "_id": doc.ID}
+			var err *Error
+			switch op {
+			case "index", "create":
+				i++
+				if i >= len(lines) {
+					writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "illegal_argument_exception", Reason: "the source of the last action is missing"})
+					return
+				}
+				doc.Source = json.RawMessage(bytes.TrimSpace(lines[i]))
+				if _, exists := s.index(doc.Index).ids[doc.ID]; op == "create" && exists {
+					err = &Error{Status: http.StatusConflict, Type: "version_conflict_engine_exception", Reason: "document already exists"}
+					break
+				}
+				var (
+					stored *Document
+					result string
+				)
+				if stored, result, err = s.store(doc); err == nil {
+					item["_id"], item["_version"], item["result"] = stored.ID, stored.Version, result
+					item["status"] = http.StatusCreated
+					if result == "updated" {
+						item["status"] = http.StatusOK
+					}
+				}
+			case "delete":
+				if s.remove(doc.Index, doc.ID) {
+					item["result"], item["status"] = "deleted", http.StatusOK
+				} else {
+					item["result"], item["status"] = "not_found", http.StatusNotFound
+				}
+			default:
+				err = &Error{Status: http.StatusBadRequest, Type: "illegal_argument_exception", Reason: "unsupported action [" + op + "]"}
+			}
+			if err != nil {
+				failed = true
+				item["status"] = err.Status
+				item["error"] = map[string]interface{}{"type": err.Type, "reason": err.Reason}
+			}
+			items = append(items, map[string]interface{}{op: item})
+		}
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"took":   int(time.Since(start) / time.Millisecond),
+		"errors": failed,
+		"items":  items,
+	})
+}
+
+func (s *Server) serveMapping(w http.ResponseWriter, r *http.Request, name, typ string, body []byte) {
+	switch r.Method {
+	case http.MethodGet:
+		result := make(map[string]interface{})
+		for _, n := range s.matchIndices(name) {
+			mappings := make(map[string]interface{})
+			for t, m := range s.indices[n].mappings {
+				if typ == "" || t == typ {
+					mappings[t] = m
+				}
+			}
+			result[n] = map[string]interface{}{"mappings": mappings}
+		}
+		if len(result) == 0 {
+			writeError(w, r, notFound(name))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, result)
+	case http.MethodPut, http.MethodPost:
+		idx, ok := s.indices[name]
+		if !ok {
+			writeError(w, r, notFound(name))
+			return
+		}
+		var mapping map[string]interface{}
+		if err := json.Unmarshal(body, &mapping); err != nil {
+			writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "parse_exception", Reason: err.Error()})
+			return
+		}
+		if typ == "" {
+			writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "action_request_validation_exception", Reason: "mapping type is missing"})
+			return
+		}
+		if err := idx.putMappings(map[string]interface{}{typ: mapping}); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{"acknowledged": true})
+	default:
+		writeError(w, r, &Error{Status: http.StatusMethodNotAllowed, Type: "illegal_argument_exception", Reason: r.Method})
+	}
+}
+
+func (s *Server) serveSettings(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	names := s.matchIndices(name)
+	if len(names) == 0 && !strings.Contains(name, "*") {
+		writeError(w, r, notFound(name))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		flat := r.URL.Query().Get("flat_settings") == "true"
+		result := make(map[string]interface{}, len(names))
+		for _, n := range names {
+			settings := make(map[string]interface{}, len(s.indices[n].settings))
+			for k, v := range s.indices[n].settings {
+				settings[k] = v
+			}
+			if !flat {
+				settings = nest(settings)
+			}
+			result[n] = map[string]interface{}{"settings": settings}
+		}
+		writeJSON(w, r, http.StatusOK, result)
+	case http.MethodPut:
+		var settings map[string]interface{}
+		if err := json.Unmarshal(body, &settings); err != nil {
+			writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "parse_exception", Reason: err.Error()})
+			return
+		}
+		for _, n := range names {
+			for k, v := range flatten("", settings) {
+				if !strings.HasPrefix(k, "index.") {
+					k = "index." + k
+				}
+				s.indices[n].settings[k] = v
+			}
+		}
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{"acknowledged": true})
+	default:
+		writeError(w, r, &Error{Status: http.StatusMethodNotAllowed, Type: "illegal_argument_exception", Reason: r.Method})
+	}
+}
+
+// shrink copies the source index into the target, which should not exist.
+func (s *Server) shrink(w http.ResponseWriter, r *http.Request, source, target string) {
+	src, ok := s.indices[source]
+	if !ok {
+		writeError(w, r, notFound(source))
+		return
+	}
+	if _, ok = s.indices[target]; ok {
+		writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "resource_already_exists_exception", Reason: "index [" + target + "] already exists"})
+		return
+	}
+	if src.settings["index.blocks.write"] != "true" {
+		writeError(w, r, &Error{Status: http.StatusBadRequest, Type: "illegal_state_exception", Reason: "index " + source + " must be read-only to shrink index"})
+		return
+	}
+	dst := s.index(target)
+	for t, m := range src.mappings {
+		dst.mappings[t] = m
+	}
+	for _, d := range src.docs {
+		doc := *d
+		doc.Index = target
+		dst.docs = append(dst.docs, &doc)
+		dst.ids[doc.ID] = &doc
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{"acknowledged": true, "shards_acknowledged": true})
+}
+
+func (s *Server) catIndices(w http.ResponseWriter, r *http.Request) {
+	var rows []map[string]interface{}
+	for _, n := range s.matchIndices("*") {
+		rows = append(rows, map[string]interface{}{
+			"health":     "green",
+			"status":     "open",
+			"index":      n,
+			"docs.count": strconv.Itoa(len(s.indices[n].docs)),
+		})
+	}
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	writeJSON(w, r, http.StatusOK, rows)
+}
+
+// readBody returns the body of the r, decompressed if it is gzipped.
+func readBody(r *http.Request) ([]byte, error) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	return ioutil.ReadAll(body)
+}
+
+// trimSlash removes the trailing slashes of the path, except the root.
+func trimSlash(path string) string {
+	if p := strings.TrimRight(path, "/"); p != "" {
+		return p
+	}
+	return "/"
+}
+
+func notFound(name string) *Error {
+	return &Error{Status: http.StatusNotFound, Type: "index_not_found_exception", Reason: "no such index [" + name + "]"}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err *Error) {
+	writeJSON(w, r, err.Status, map[string]interface{}{
+		"error":  map[string]interface{}{"type": err.Type, "reason": err.Reason},
+		"status": err.Status,
+	})
+}
+
+// writeJSON writes the v with the status. The body is not written for the
+// HEAD requests.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,269 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package estest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/recorder/elasticsearch"
+	"github.com/alext234/expipe/recorder/elasticsearch/estest"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/token"
+)
+
+func newRecorder(t *testing.T, es *estest.Server, options ...func(recorder.Constructor) error) *elasticsearch.Recorder {
+	rec, err := elasticsearch.New(append([]func(recorder.Constructor) error{
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithEndpoint(es.URL),
+		recorder.WithName("estest"),
+		recorder.WithIndexName("my_index"),
+		recorder.WithTimeout(time.Second),
+	}, options...)...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return rec
+}
+
+func newJob(values ...datatype.DataType) recorder.Job {
+	return recorder.Job{
+		ID:        token.NewUID(),
+		Payload:   datatype.New(values),
+		IndexName: "my_index",
+		TypeName:  "my_type",
+		Time:      time.Now(),
+	}
+}
+
+func TestRecord(t *testing.T) {
+	es := estest.NewServer()
+	defer es.Close()
+	rec := newRecorder(t, es, elasticsearch.WithDocumentID("{job_id}"))
+	if got := es.Indices(); len(got) != 1 || got[0] != "my_index" {
+		t.Errorf("Indices() = (%v); want ([my_index])", got)
+	}
+	job := newJob()
+	for i := 0; i < 2; i++ {
+		// the payloads are read once, so each record needs a new one.
+		job.Payload = datatype.New([]datatype.DataType{datatype.NewFloatType("devil", 666)})
+		if err := rec.Record(context.Background(), job); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	docs := es.Documents("my_index")
+	if len(docs) != 1 {
+		t.Fatalf("len(docs) = (%d); want (1)", len(docs))
+	}
+	if docs[0].ID != job.ID.String() || docs[0].Type != "my_type" || docs[0].Version != 2 {
+		t.Errorf("doc = (%+v); want the second version of the job", docs[0])
+	}
+	var source map[string]interface{}
+	if err := json.Unmarshal(docs[0].Source, &source); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if source["devil"] != 666.0 {
+		t.Errorf("devil = (%v); want (666)", source["devil"])
+	}
+}
+
+func TestRecordBatchRejected(t *testing.T) {
+	es := estest.NewServer()
+	defer es.Close()
+	err := es.CreateIndex("my_index", map[string]interface{}{
+		"my_type": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"count": map[string]interface{}{"type": "long"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	es.Reject(func(doc estest.Document) *estest.Error {
+		if doc.ID == "overloaded" {
+			return estest.Overloaded()
+		}
+		return nil
+	})
+	rec := newRecorder(t, es, elasticsearch.WithDeadLetterIndex("dead_letters"))
+	jobs := []recorder.Job{
+		newJob(datatype.NewFloatType("count", 1)),
+		newJob(datatype.NewStringType("count", "many")),
+	}
+	if err = rec.RecordBatch(context.Background(), jobs); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if docs := es.Documents("my_index"); len(docs) != 1 {
+		t.Errorf("len(docs) = (%d); want (1)", len(docs))
+	}
+	letters := es.Documents("dead_letters")
+	if len(letters) != 1 {
+		t.Fatalf("len(dead letters) = (%d); want (1)", len(letters))
+	}
+	var letter struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err = json.Unmarshal(letters[0].Source, &letter); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if letter.Status != http.StatusBadRequest {
+		t.Errorf("status = (%d); want (%d): %s", letter.Status, http.StatusBadRequest, letter.Error)
+	}
+
+	rec = newRecorder(t, es, elasticsearch.WithDocumentID("overloaded{index}"))
+	es.Reject(func(doc estest.Document) *estest.Error {
+		if doc.ID == "overloadedmy_index" {
+			return estest.Overloaded()
+		}
+		return nil
+	})
+	err = rec.RecordBatch(context.Background(), jobs[:1])
+	if be, ok := err.(recorder.BatchError); !ok || len(be.Retry) != 1 {
+		t.Errorf("err = (%v); want a BatchError with one retry", err)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	es := estest.NewServer()
+	defer es.Close()
+	rec := newRecorder(t, es)
+	es.FailNext(1, &estest.Error{Status: http.StatusServiceUnavailable, Type: "unavailable", Reason: "testing"})
+	if err := rec.Record(context.Background(), newJob(datatype.NewFloatType("devil", 666))); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err := rec.Record(context.Background(), newJob(datatype.NewFloatType("devil", 666))); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if n := es.Requests(http.MethodPost, "/my_index/my_type"); n != 2 {
+		t.Errorf("Requests() = (%d); want (2)", n)
+	}
+	if n := es.Requests(http.MethodPost, "/my_index/my_type/"); n != 2 {
+		t.Errorf("Requests() = (%d); want (2) with the trailing slash", n)
+	}
+
+	es.FailNext(1, &estest.Error{Status: http.StatusServiceUnavailable, Type: "unavailable", Reason: "testing"})
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, es.URL+"/", nil)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s /: status = (%d); want (%d): pings should not fail", method, res.StatusCode, http.StatusOK)
+		}
+	}
+	if err := rec.Record(context.Background(), newJob(datatype.NewFloatType("devil", 666))); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestBasicAuthCompressed(t *testing.T) {
+	es := estest.NewServer(estest.WithBasicAuth("bob", "secret"))
+	defer es.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithEndpoint(es.URL),
+		recorder.WithName("estest"),
+		recorder.WithTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	rec = newRecorder(t, es, elasticsearch.WithBasicAuth("bob", "secret"), elasticsearch.WithCompression())
+	jobs := []recorder.Job{newJob(datatype.NewFloatType("devil", 666))}
+	if err = rec.RecordBatch(context.Background(), jobs); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if docs := es.Documents("my_index"); len(docs) != 1 {
+		t.Errorf("len(docs) = (%d); want (1)", len(docs))
+	}
+}
+
+func TestMappingAPI(t *testing.T) {
+	es := estest.NewServer()
+	defer es.Close()
+	do := func(method, path, body string) int {
+		req, err := http.NewRequest(method, es.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	tcs := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodHead, "/my_index", "", http.StatusNotFound},
+		{http.MethodPut, "/my_index", `{"mappings":{"my_type":{"properties":{"up":{"type":"boolean"}}}}}`, http.StatusOK},
+		{http.MethodPut, "/my_index", "", http.StatusBadRequest},
+		{http.MethodPut, "/my_index/_mapping/my_type", `{"properties":{"at":{"type":"date"}}}`, http.StatusOK},
+		{http.MethodPut, "/my_index/_mapping/my_type", `{"properties":{"up":{"type":"long"}}}`, http.StatusBadRequest},
+		{http.MethodPost, "/my_index/my_type", `{"up":true,"at":"2016-11-27"}`, http.StatusCreated},
+		{http.MethodPost, "/my_index/my_type", `{"up":1}`, http.StatusBadRequest},
+		{http.MethodPost, "/my_index/my_type", `{"at":false}`, http.StatusBadRequest},
+		{http.MethodGet, "/my_index/_mapping", "", http.StatusOK},
+		{http.MethodGet, "/my*/_settings?flat_settings=true", "", http.StatusOK},
+		{http.MethodDelete, "/my_index", "", http.StatusOK},
+		{http.MethodHead, "/my_index", "", http.StatusNotFound},
+	}
+	for i, tc := range tcs {
+		if got := do(tc.method, tc.path, tc.body); got != tc.want {
+			t.Errorf("%d: %s %s = (%d); want (%d)", i, tc.method, tc.path, got, tc.want)
+		}
+		if i == 3 {
+			props := es.Mapping("my_index", "my_type")["properties"].(map[string]interface{})
+			if len(props) != 2 {
+				t.Errorf("properties = (%v); want (up and at)", props)
+			}
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	es := estest.NewServer()
+	defer es.Close()
+	if err := es.CreateIndex("my_index-old", nil); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	es.SetCreationDate("my_index-old", time.Now().Add(-48*time.Hour))
+	rec := newRecorder(t, es, elasticsearch.WithRetention(elasticsearch.Retention{
+		Pattern: "my_index-*",
+		MaxAge:  24 * time.Hour,
+	}))
+	if err := rec.Record(context.Background(), newJob(datatype.NewFloatType("devil", 666))); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := es.Indices(); len(got) == 1 && got[0] == "my_index" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Indices() = (%v); want ([my_index])", es.Indices())
+}
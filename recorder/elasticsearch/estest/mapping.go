@@ -0,0 +1,185 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package estest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The field types of the mappings whose values are checked.
+var (
+	numericTypes = map[string]bool{
+		"long": true, "integer": true, "short": true, "byte": true,
+		"double": true, "float": true, "half_float": true, "scaled_float": true,
+	}
+	boolTypes = map[string]bool{"boolean": true}
+	dateTypes = map[string]bool{"date": true}
+)
+
+// putMappings merges the mappings of the types into the mappings of the
+// index. It returns an error if a field is mapped with another type.
+func (idx *index) putMappings(mappings map[string]interface{}) *Error {
+	for typ, m := range mappings {
+		mapping, ok := m.(map[string]interface{})
+		if !ok {
+			return MappingError(fmt.Sprintf("the mapping of [%s] is not an object", typ))
+		}
+		old, ok := idx.mappings[typ]
+		if !ok {
+			idx.mappings[typ] = mapping
+			continue
+		}
+		oldFields, newFields := fieldTypes("", old), fieldTypes("", mapping)
+		for field, t := range newFields {
+			if o, ok := oldFields[field]; ok && o != t {
+				return &Error{
+					Status: http.StatusBadRequest,
+					Type:   "illegal_argument_exception",
+					Reason: fmt.Sprintf("mapper [%s] of different type, current_type [%s], merged_type [%s]", field, o, t),
+				}
+			}
+		}
+		merge(old, mapping)
+	}
+	return nil
+}
+
+// check returns a MappingError if any values of the doc don't fit the types of
+// the fields of its mapping. The dotted keys of the documents are the same as
+// the nested objects.
+func (idx *index) check(doc Document) *Error {
+	mapping, ok := idx.mappings[doc.Type]
+	if !ok {
+		return nil
+	}
+	types := fieldTypes("", mapping)
+	if len(types) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc.Source))
+	dec.UseNumber()
+	var source map[string]interface{}
+	if err := dec.Decode(&source); err != nil {
+		return MappingError("failed to parse")
+	}
+	for field, value := range leaves("", source) {
+		if value == nil {
+			continue
+		}
+		t, ok := types[field]
+		if !ok {
+			continue
+		}
+		_, isNumber := value.(json.Number)
+		_, isBool := value.(bool)
+		_, isString := value.(string)
+		switch {
+		case numericTypes[t] && !isNumber,
+			boolTypes[t] && !isBool,
+			dateTypes[t] && !isNumber && !isString:
+			return MappingError(fmt.Sprintf("failed to parse [%s] of type [%s]", field, t))
+		}
+	}
+	return nil
+}
+
+// fieldTypes returns the types of the fields of the properties of the mapping,
+// keyed by their dotted paths.
+func fieldTypes(prefix string, mapping map[string]interface{}) map[string]string {
+	types := make(map[string]string)
+	props, _ := mapping["properties"].(map[string]interface{})
+	for name, p := range props {
+		field, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, ok := field["type"].(string); ok {
+			types[prefix+name] = t
+		}
+		for k, v := range fieldTypes(prefix+name+".", field) {
+			types[k] = v
+		}
+	}
+	return types
+}
+
+// leaves returns the values of the obj that are not objects, keyed by their
+// dotted paths.
+func leaves(prefix string, obj map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range obj {
+		if nested, ok := v.(map[string]interface{}); ok {
+			for nk, nv := range leaves(prefix+k+".", nested) {
+				result[nk] = nv
+			}
+			continue
+		}
+		if arr, ok := v.([]interface{}); ok {
+			// the arrays are checked by their first value, as elasticsearch
+			// maps the arrays by the type of their values.
+			if len(arr) == 0 {
+				continue
+			}
+			v = arr[0]
+		}
+		result[prefix+k] = v
+	}
+	return result
+}
+
+// merge adds the keys of the src to the dst recursively.
+func merge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		d, dok := dst[k].(map[string]interface{})
+		s, sok := v.(map[string]interface{})
+		if dok && sok {
+			merge(d, s)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// flatten returns the settings with their keys dotted and their values as
+// strings, as elasticsearch returns them.
+func flatten(prefix string, settings map[string]interface{}) map[string]string {
+	result := make(map[string]string)
+	for k, v := range settings {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for nk, nv := range flatten(prefix+k+".", t) {
+				result[nk] = nv
+			}
+		case string:
+			result[prefix+k] = t
+		default:
+			result[prefix+k] = fmt.Sprint(t)
+		}
+	}
+	return result
+}
+
+// nest returns the flat settings as nested objects.
+func nest(settings map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range settings {
+		parts := strings.Split(k, ".")
+		m := result
+		for _, p := range parts[:len(parts)-1] {
+			next, ok := m[p].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				m[p] = next
+			}
+			m = next
+		}
+		m[parts[len(parts)-1]] = v
+	}
+	return result
+}
@@ -5,43 +5,76 @@
 // Package elasticsearch contains logic to record data to an elasticsearch index.
 // The data is already sanitised by the data provider.
 //
-// Collected metrics
+// # Collected metrics
 //
 // This list will grow in time:
 //
-//   +----------------------+-------------------------+
-//   |   Expipe var name    |  ElasticSearch Var Name |
-//   +----------------------+-------------------------+
-//   | elasticsearchRecords | ElasticSearch Records   |
-//   +----------------------+-------------------------+
+//	+----------------------+------------------------------+
+//	|   Expipe var name    |    ElasticSearch Var Name    |
+//	+----------------------+------------------------------+
+//	| elasticsearchRecords | ElasticSearch Records        |
+//	| rejectedDocs         | ElasticSearch Rejected Docs  |
+//	| deadLetters          | ElasticSearch Dead Letters   |
+//	+----------------------+------------------------------+
 package elasticsearch
 
 import (
 	"bytes"
 	"context"
+	"crypto/sha1"
+	"encoding/json"
 	"expvar"
+	"fmt"
+	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/recorder"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/pinger"
 	"github.com/olivere/elastic"
 	"github.com/pkg/errors"
 )
 
-var elasticsearchRecords = expvar.NewInt("ElasticSearch Records")
+var (
+	elasticsearchRecords = expvar.NewInt("ElasticSearch Records")
+	rejectedDocs         = expvar.NewInt("ElasticSearch Rejected Docs")
+	deadLetters          = expvar.NewInt("ElasticSearch Dead Letters")
+	docIDReg             = regexp.MustCompile(`\{(reader|type_name|index|timestamp|job_id|hash)\}`)
+)
 
 // Recorder contains an elasticsearch client and an index name for recording
 // data. It implements DataRecorder interface
 type Recorder struct {
-	name      string
-	client    *elastic.Client // Elasticsearch client
-	endpoint  string
-	indexName string
-	log       tools.FieldLogger
-	timeout   time.Duration
-	pinged    bool
+	name       string
+	client     *elastic.Client // Elasticsearch client
+	endpoint   string
+	indexName  string
+	log        tools.FieldLogger
+	timeout    time.Duration
+	pinged     bool
+	httpClient *http.Client
+	pinger     *pinger.Pinger
+	username   string
+	password   string
+	timestamp  datatype.Timestamp
+	documentID string
+	routing    string
+	compress   bool
+	skew       *httpclient.SkewTransport
+	deadLetter string // index of the rejected documents.
+	retention  *Retention
+
+	retMu         sync.Mutex
+	written       map[string]bool // indices written since the last retention, guarded by retMu.
+	lastRetention time.Time       // guarded by retMu.
+	retaining     int32           // 1 while the retention runs.
 }
 
 // New returns an error if it can't create the index.
@@ -69,24 +102,47 @@ func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
 	if r.timeout == 0 {
 		r.timeout = 5 * time.Second
 	}
+	if r.httpClient == nil {
+		r.httpClient = httpclient.Default()
+	}
+	r.httpClient, r.skew = httpclient.Skewed(r.httpClient)
+	r.httpClient = httpclient.Compressed(r.httpClient, r.name, r.compress)
+	r.written = make(map[string]bool)
+	var err error
+	r.pinger, err = pinger.New(r.endpoint,
+		pinger.WithName(r.name),
+		pinger.WithClient(r.httpClient),
+		pinger.WithTimeout(r.timeout),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "pinger")
+	}
 	r.log.Debug("connecting to: ", r.Endpoint())
 	return r, nil
 }
 
 // Ping pings the endpoint and report if there was an error.
 func (r *Recorder) Ping() error {
+	if err := r.pinger.Ping(); err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
 	var err error
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
-	r.client, err = elastic.NewClient(
+	options := []elastic.ClientOptionFunc{
 		elastic.SetURL(r.endpoint),
+		elastic.SetHttpClient(r.httpClient),
 		elastic.SetErrorLog(r.log),
 		elastic.SetHealthcheckTimeoutStartup(r.timeout),
 		elastic.SetSniff(false),
 		elastic.SetSnifferTimeout(r.timeout),
 		elastic.SetHealthcheckTimeout(r.timeout),
 		elastic.SetSnifferTimeoutStartup(r.timeout),
-	)
+	}
+	if r.username != "" {
+		options = append(options, elastic.SetBasicAuth(r.username, r.password))
+	}
+	r.client, err = elastic.NewClient(options...)
 	if err != nil {
 		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
 	}
@@ -113,10 +169,11 @@ func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
 	}
 	ctx, cancel := context.WithTimeout(ctx, r.Timeout())
 	defer cancel()
-	err := r.record(ctx, job.TypeName, job.Time, job.Payload)
+	err := r.record(ctx, job)
 	if err != nil {
 		err = errors.Cause(err)
 		if _, ok := err.(*url.Error); ok || err == elastic.ErrNoClient {
+			r.pinger.Report(err)
 			err = recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
 		}
 		r.log.WithField("recorder", "elasticsearch").
@@ -125,23 +182,174 @@ func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
 			Debugf("%s: error making request: %v", r.name, err)
 		return err
 	}
+	r.pinger.Report(nil)
+	r.wrote(r.index(job))
+	return nil
+}
+
+// RecordBatch ships all jobs to elasticsearch in one bulk request. The results
+// of the documents are checked one by one: it returns a recorder.BatchError
+// with the jobs that should be retried if elasticsearch is overloaded or fails
+// to index some of the documents. The documents that are rejected, for example
+// for mapping errors, are never retried. They are indexed into the dead letter
+// index if it is set, otherwise they are dropped and an error is returned.
+func (r *Recorder) RecordBatch(ctx context.Context, jobs []recorder.Job) error {
+	if !r.pinged {
+		return recorder.ErrPingNotCalled
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout())
+	defer cancel()
+	bulk := r.client.Bulk()
+	docs := make([][]byte, 0, len(jobs))
+	for _, job := range jobs {
+		w := new(bytes.Buffer)
+		if _, err := r.timestamp.Generate(w, job.Payload, job.Time); err != nil {
+			return errors.Wrap(err, "generating payload")
+		}
+		docs = append(docs, w.Bytes())
+		bulk.Add(elastic.NewBulkIndexRequest().
+			Index(r.index(job)).
+			Type(job.TypeName).
+			Id(r.docID(job)).
+			Routing(r.replace(job, r.routing)).
+			Doc(json.RawMessage(w.Bytes())),
+		)
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		err = errors.Cause(err)
+		if _, ok := err.(*url.Error); ok || err == elastic.ErrNoClient {
+			r.pinger.Report(err)
+			err = recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+		}
+		return err
+	}
+	r.pinger.Report(nil)
+	indices := make([]string, len(jobs))
+	for i, job := range jobs {
+		indices[i] = r.index(job)
+	}
+	r.wrote(indices...)
+	if !res.Errors && len(res.Failed()) == 0 {
+		elasticsearchRecords.Add(int64(len(jobs)))
+		return nil
+	}
+	if len(res.Items) != len(jobs) {
+		return fmt.Errorf("%d results for %d documents", len(res.Items), len(jobs))
+	}
+
+	var (
+		retry    []int
+		rejected []deadLetter
+		reason   string
+	)
+	for i, item := range res.Items {
+		for _, result := range item {
+			if result == nil || result.Status >= 200 && result.Status <= 299 {
+				continue
+			}
+			reason = itemError(result)
+			if result.Status == http.StatusTooManyRequests || result.Status >= 500 {
+				retry = append(retry, i)
+				continue
+			}
+			rejected = append(rejected, newDeadLetter(jobs[i], r.index(jobs[i]), r.docID(jobs[i]), docs[i], result))
+		}
+	}
+	elasticsearchRecords.Add(int64(len(jobs) - len(retry) - len(rejected)))
+	if len(rejected) > 0 {
+		rejectedDocs.Add(int64(len(rejected)))
+		if err = r.recordDeadLetters(ctx, rejected); err != nil {
+			r.log.WithField("recorder", "elasticsearch").
+				WithField("name", r.Name()).
+				Errorf("%s: %d rejected documents are dropped: %v", r.name, len(rejected), err)
+		}
+	}
+	if len(retry) == 0 && err == nil {
+		return nil
+	}
+	return recorder.BatchError{
+		Retry: retry,
+		Err:   fmt.Errorf("%d of %d documents failed: %s", len(retry)+len(rejected), len(jobs), reason),
+	}
+}
+
+// deadLetter is a rejected document with the reason of its rejection. The
+// document is kept as a string, therefore it does not hit the same mapping
+// errors in the dead letter index.
+type deadLetter struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Index     string    `json:"index"`
+	Type      string    `json:"type"`
+	ID        string    `json:"id,omitempty"`
+	Reader    string    `json:"reader,omitempty"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error"`
+	Document  string    `json:"document"`
+}
+
+func newDeadLetter(job recorder.Job, index, id string, doc []byte, result *elastic.BulkResponseItem) deadLetter {
+	return deadLetter{
+		Timestamp: time.Now(),
+		Index:     index,
+		Type:      job.TypeName,
+		ID:        id,
+		Reader:    job.Reader,
+		Status:    result.Status,
+		Error:     itemError(result),
+		Document:  string(doc),
+	}
+}
+
+// itemError returns the type and the reason of the error of the result.
+func itemError(result *elastic.BulkResponseItem) string {
+	if result.Error == nil {
+		return fmt.Sprintf("status %d", result.Status)
+	}
+	return fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason)
+}
 
+// recordDeadLetters indexes the letters into the dead letter index. It returns
+// an error if the index is not set or any of the letters are not indexed.
+func (r *Recorder) recordDeadLetters(ctx context.Context, letters []deadLetter) error {
+	if r.deadLetter == "" {
+		return errors.New("dead_letter_index is not set")
+	}
+	bulk := r.client.Bulk()
+	for _, l := range letters {
+		bulk.Add(elastic.NewBulkIndexRequest().
+			Index(r.deadLetter).
+			Type("dead_letter").
+			Doc(l),
+		)
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return errors.Wrap(err, "dead letters")
+	}
+	failed := len(res.Failed())
+	deadLetters.Add(int64(len(letters) - failed))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d dead letters failed", failed, len(letters))
+	}
 	return nil
 }
 
 // record ships the kv data to elasticsearch. It calls the recordFunc if exists,
 // otherwise continues as normal. Although this doesn't change the state of the
 // Client, it is a part of its behaviour.
-func (r *Recorder) record(ctx context.Context, typeName string, timestamp time.Time, list datatype.DataContainer) error {
+func (r *Recorder) record(ctx context.Context, job recorder.Job) error {
 	w := new(bytes.Buffer)
-	_, err := list.Generate(w, timestamp)
+	_, err := r.timestamp.Generate(w, job.Payload, job.Time)
 	if err != nil {
 		errors.Wrap(err, "generating payload")
 	}
 	payload := w.String()
 	_, err = r.client.Index().
-		Index(r.indexName).
-		Type(typeName).
+		Index(r.index(job)).
+		Type(job.TypeName).
+		Id(r.docID(job)).
+		Routing(r.replace(job, r.routing)).
 		BodyString(payload).
 		Do(ctx)
 	if err != nil {
@@ -151,6 +359,45 @@ func (r *Recorder) record(ctx context.Context, typeName string, timestamp time.T
 	return ctx.Err()
 }
 
+// index returns the index name of the job, which might have been changed by
+// the Engine, for example with the prefix of a tenant. It returns the index
+// name of the recorder if the job doesn't have one.
+func (r *Recorder) index(job recorder.Job) string {
+	if job.IndexName != "" {
+		return job.IndexName
+	}
+	return r.indexName
+}
+
+// docID returns the _id of the document of the job by replacing the
+// placeholders of the documentID. It returns an empty string if the documentID
+// is not set, therefore elasticsearch generates the _id.
+func (r *Recorder) docID(job recorder.Job) string {
+	return r.replace(job, r.documentID)
+}
+
+// replace returns the template with its placeholders replaced by the values of
+// the job. See WithDocumentID for the placeholders.
+func (r *Recorder) replace(job recorder.Job, template string) string {
+	if template == "" {
+		return ""
+	}
+	ts := strconv.FormatInt(job.Time.UnixNano(), 10)
+	replacer := strings.NewReplacer(
+		"{reader}", job.Reader,
+		"{type_name}", job.TypeName,
+		"{index}", r.index(job),
+		"{timestamp}", ts,
+		"{job_id}", job.ID.String(),
+		"{hash}", fmt.Sprintf("%x", sha1.Sum([]byte(job.Reader+"/"+ts))),
+	)
+	return replacer.Replace(template)
+}
+
+// ReleasePayloads returns true as the payloads are encoded before they are
+// sent.
+func (r *Recorder) ReleasePayloads() bool { return true }
+
 // Name shows the name identifier for this recorder.
 func (r *Recorder) Name() string { return r.name }
 
@@ -177,3 +424,124 @@ func (r *Recorder) SetTimeout(timeout time.Duration) { r.timeout = timeout }
 
 // SetLogger sets the log of the recorder.
 func (r *Recorder) SetLogger(log tools.FieldLogger) { r.log = log }
+
+// SetHTTPClient sets the http client of the recorder.
+func (r *Recorder) SetHTTPClient(client *http.Client) { r.httpClient = client }
+
+// ClockSkew returns the skew of the clock of the endpoint from the Date header
+// of the last response. It returns false if no response had a Date header.
+func (r *Recorder) ClockSkew() (time.Duration, bool) {
+	if r.skew == nil {
+		return 0, false
+	}
+	return r.skew.Skew()
+}
+
+// WithBasicAuth sets the credentials of the basic authentication of the
+// elasticsearch cluster.
+func WithBasicAuth(username, password string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errors.New("incompatible recorder")
+		}
+		if username == "" {
+			return errors.New("empty username")
+		}
+		r.username = username
+		r.password = password
+		return nil
+	}
+}
+
+// WithTimestamp sets the field, format and time zone of the timestamp of the
+// documents. The zero values are replaced with the defaults of the
+// datatype.Timestamp.
+func WithTimestamp(ts datatype.Timestamp) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errors.New("incompatible recorder")
+		}
+		r.timestamp = ts
+		return nil
+	}
+}
+
+// WithDocumentID sets the template of the _id of the documents, therefore the
+// retried writes overwrite the same documents instead of creating duplicates.
+// These placeholders are replaced with the values of each job:
+//
+//	{reader}    the name of the reader
+//	{type_name} the type name of the reader
+//	{index}     the index name of the job
+//	{timestamp} the time of the job in nanoseconds since epoch
+//	{job_id}    the ID of the job
+//	{hash}      the SHA-1 hash of the reader and the timestamp
+//
+// It returns an error if the template does not have any placeholders, as all
+// documents would have the same _id.
+func WithDocumentID(template string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errors.New("incompatible recorder")
+		}
+		if !docIDReg.MatchString(template) {
+			return fmt.Errorf("document id %q has no placeholders", template)
+		}
+		r.documentID = template
+		return nil
+	}
+}
+
+// WithRouting sets the template of the _routing of the documents, therefore
+// the related documents are stored on the same shard and the queries that are
+// filtered by them, for example by the reader, search one shard only. It has
+// the same placeholders as WithDocumentID, and an empty template routes the
+// documents by their _id. The queries should pass the same routing to benefit.
+func WithRouting(template string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errors.New("incompatible recorder")
+		}
+		r.routing = template
+		return nil
+	}
+}
+
+// WithCompression compresses the bodies of the requests with gzip. The bytes
+// of the bodies before and after the compression are reported in the Request
+// Uncompressed Bytes and Request Compressed Bytes metrics either way.
+func WithCompression() func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errors.New("incompatible recorder")
+		}
+		r.compress = true
+		return nil
+	}
+}
+
+// WithDeadLetterIndex indexes the documents that elasticsearch rejects in a
+// batch, for example for mapping errors, into the index. They are stored with
+// the index, the _id and the error they were rejected with, and with the
+// document as a string.
+func WithDeadLetterIndex(index string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errors.New("incompatible recorder")
+		}
+		if index == "" {
+			return recorder.ErrEmptyIndexName
+		}
+		if strings.ContainsAny(index, ` "*\<|,>/?`) {
+			return recorder.InvalidIndexNameError(index)
+		}
+		r.deadLetter = index
+		return nil
+	}
+}
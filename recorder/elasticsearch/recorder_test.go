@@ -5,11 +5,15 @@
 package elasticsearch_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -238,3 +242,467 @@ func TestElasticsearchCreateIndex(t *testing.T) {
 		t.Fatalf("err = (%#v); want (nil)", err)
 	}
 }
+
+func TestElasticsearchRecordBatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	var (
+		host, url, port string
+		body            = make(chan string, 1)
+		bulkResponse    = `{"took":1,"errors":false,"items":[{"index":{"status":201}},{"index":{"status":201}}]}`
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/_bulk":
+			buf := new(bytes.Buffer)
+			io.Copy(buf, r.Body)
+			w.Write([]byte(bulkResponse))
+			body <- buf.String()
+		case len(r.URL.Path) > 5:
+			w.Write([]byte(recording))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	url = strings.Split(ts.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("my_index"),
+	)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%#v); want (nil)", err)
+	}
+	jobs := []recorder.Job{
+		{
+			ID:       token.NewUID(),
+			Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType("a", 1)}),
+			TypeName: "type1",
+			Time:     time.Now(),
+		},
+		{
+			ID:       token.NewUID(),
+			Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType("b", 2)}),
+			TypeName: "type2",
+			Time:     time.Now(),
+		},
+	}
+	err = rec.RecordBatch(ctx, jobs)
+	if errors.Cause(err) != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%#v); want (nil)", err)
+	}
+	if err = rec.RecordBatch(ctx, jobs); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	b := <-body
+	for _, s := range []string{`"_index":"my_index"`, `"_type":"type1"`, `"_type":"type2"`, `"a":1.000000`, `"b":2.000000`} {
+		if !strings.Contains(b, s) {
+			t.Errorf("expected (%s) in (%s)", s, b)
+		}
+	}
+
+	bulkResponse = `{"took":1,"errors":true,"items":[{"index":{"status":201}},{"index":{"status":400}}]}`
+	err = rec.RecordBatch(ctx, jobs)
+	if be, ok := errors.Cause(err).(recorder.BatchError); !ok || len(be.Retry) != 0 {
+		t.Errorf("err = (%v); want (recorder.BatchError) without retries", err)
+	}
+	<-body
+}
+
+func TestElasticsearchRecordBatchPartialFailure(t *testing.T) {
+	t.Parallel()
+	var (
+		host, url, port string
+		deadLetters     = make(chan string, 1)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/_bulk":
+			buf := new(bytes.Buffer)
+			io.Copy(buf, r.Body)
+			if strings.Contains(buf.String(), `"_index":"dead_letters"`) {
+				w.Write([]byte(`{"took":1,"errors":false,"items":[{"index":{"status":201}}]}`))
+				deadLetters <- buf.String()
+				return
+			}
+			w.Write([]byte(`{"took":1,"errors":true,"items":[
+				{"index":{"status":201}},
+				{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue is full"}}},
+				{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse [a]"}}}
+			]}`))
+		case len(r.URL.Path) > 5:
+			w.Write([]byte(recording))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	url = strings.Split(ts.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("my_index"),
+		elasticsearch.WithDeadLetterIndex("dead_letters"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	jobs := make([]recorder.Job, 3)
+	for i := range jobs {
+		jobs[i] = recorder.Job{
+			ID:       token.NewUID(),
+			Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType("a", float64(i))}),
+			TypeName: "type1",
+			Reader:   "app",
+			Time:     time.Now(),
+		}
+	}
+	err = rec.RecordBatch(context.Background(), jobs)
+	be, ok := errors.Cause(err).(recorder.BatchError)
+	if !ok {
+		t.Fatalf("err = (%v); want (recorder.BatchError)", err)
+	}
+	if len(be.Retry) != 1 || be.Retry[0] != 1 {
+		t.Errorf("Retry = (%v); want ([1])", be.Retry)
+	}
+	b := <-deadLetters
+	for _, s := range []string{`"index":"my_index"`, `"reader":"app"`, `"status":400`, `mapper_parsing_exception: failed to parse [a]`, `"document":"{`} {
+		if !strings.Contains(b, s) {
+			t.Errorf("expected (%s) in (%s)", s, b)
+		}
+	}
+	if strings.Contains(b, "es_rejected_execution_exception") {
+		t.Errorf("the retried document is in the dead letters: %s", b)
+	}
+
+	if err = elasticsearch.WithDeadLetterIndex("dead letters")(rec); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err = elasticsearch.WithDeadLetterIndex("dead_letters")(&rt.Recorder{}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestElasticsearchTimestamp(t *testing.T) {
+	t.Parallel()
+	var (
+		host, url, port string
+		body            = make(chan string, 1)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/_bulk":
+			buf := new(bytes.Buffer)
+			io.Copy(buf, r.Body)
+			w.Write([]byte(`{"took":1,"errors":false,"items":[{"index":{"status":201}}]}`))
+			body <- buf.String()
+		case len(r.URL.Path) > 5:
+			w.Write([]byte(recording))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	url = strings.Split(ts.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		elasticsearch.WithTimestamp(datatype.Timestamp{
+			Field:    "timestamp",
+			Format:   time.RFC3339,
+			Location: time.FixedZone("Tokyo", 9*60*60),
+		}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	jobs := []recorder.Job{{
+		ID:       token.NewUID(),
+		Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType("a", 1)}),
+		TypeName: "type1",
+		Time:     time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC),
+	}}
+	if err = rec.RecordBatch(context.Background(), jobs); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := `{"timestamp":"2017-03-04T14:06:07+09:00","a":1.000000}`
+	if b := <-body; !strings.Contains(b, want) {
+		t.Errorf("expected (%s) in (%s)", want, b)
+	}
+	if err = elasticsearch.WithTimestamp(datatype.Timestamp{})(&rt.Recorder{}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestElasticsearchDocumentID(t *testing.T) {
+	t.Parallel()
+	var (
+		host, url, port string
+		body            = make(chan string, 1)
+		paths           = make(chan string, 1)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/_bulk":
+			buf := new(bytes.Buffer)
+			io.Copy(buf, r.Body)
+			w.Write([]byte(`{"took":1,"errors":false,"items":[{"index":{"status":201}}]}`))
+			body <- buf.String()
+		case r.Method == http.MethodPut && strings.Count(r.URL.Path, "/") == 3:
+			w.Write([]byte(recording))
+			paths <- r.URL.Path
+		case len(r.URL.Path) > 5:
+			w.Write([]byte(recording))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	url = strings.Split(ts.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("my_index"),
+		elasticsearch.WithDocumentID("{reader}-{timestamp}"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	newJob := func() recorder.Job {
+		return recorder.Job{
+			ID:       token.NewUID(),
+			Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType("a", 1)}),
+			TypeName: "type1",
+			Reader:   "app",
+			Time:     time.Unix(0, 1488603967000000000),
+		}
+	}
+	if err = rec.RecordBatch(context.Background(), []recorder.Job{newJob()}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := `"_id":"app-1488603967000000000"`
+	if b := <-body; !strings.Contains(b, want) {
+		t.Errorf("expected (%s) in (%s)", want, b)
+	}
+	if err = rec.Record(context.Background(), newJob()); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want = "/my_index/type1/app-1488603967000000000"
+	if path := <-paths; path != want {
+		t.Errorf("path = (%s); want (%s)", path, want)
+	}
+
+	if _, err = elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		elasticsearch.WithDocumentID("{hash}"),
+	); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if _, err = elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		elasticsearch.WithDocumentID("same"),
+	); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err = elasticsearch.WithDocumentID("{hash}")(&rt.Recorder{}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestElasticsearchRouting(t *testing.T) {
+	t.Parallel()
+	var (
+		host, url, port string
+		body            = make(chan string, 1)
+		routing         = make(chan string, 1)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/_bulk":
+			buf := new(bytes.Buffer)
+			io.Copy(buf, r.Body)
+			w.Write([]byte(`{"took":1,"errors":false,"items":[{"index":{"status":201}}]}`))
+			body <- buf.String()
+		case r.Method == http.MethodPost && strings.Count(strings.TrimSuffix(r.URL.Path, "/"), "/") == 2:
+			w.Write([]byte(recording))
+			routing <- r.URL.Query().Get("routing")
+		case len(r.URL.Path) > 5:
+			w.Write([]byte(recording))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	url = strings.Split(ts.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("my_index"),
+		elasticsearch.WithRouting("{reader}"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	job := recorder.Job{
+		ID:       token.NewUID(),
+		Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType("a", 1)}),
+		TypeName: "type1",
+		Reader:   "app",
+		Time:     time.Now(),
+	}
+	if err = rec.RecordBatch(context.Background(), []recorder.Job{job}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := `"_routing":"app"`
+	if b := <-body; !strings.Contains(b, want) {
+		t.Errorf("expected (%s) in (%s)", want, b)
+	}
+	job.Payload = datatype.New([]datatype.DataType{datatype.NewFloatType("a", 1)})
+	if err = rec.Record(context.Background(), job); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	select {
+	case r := <-routing:
+		if r != "app" {
+			t.Errorf("routing = (%s); want (app)", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the document was not recorded")
+	}
+
+	if err = elasticsearch.WithRouting("{reader}")(&rt.Recorder{}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestElasticsearchBasicAuth(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var users []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || pass != "secret" {
+			user = ""
+		}
+		mu.Lock()
+		users = append(users, user)
+		mu.Unlock()
+		w.Write([]byte(pinging))
+	}))
+	defer ts.Close()
+
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		elasticsearch.WithBasicAuth("expipe", "secret"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var authorised int
+	for _, user := range users {
+		if user == "expipe" {
+			authorised++
+		}
+	}
+	if authorised == 0 {
+		t.Errorf("users = (%v); want requests with the credentials", users)
+	}
+
+	if _, err = elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		elasticsearch.WithBasicAuth("", "secret"),
+	); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err = elasticsearch.WithBasicAuth("expipe", "secret")(&rt.Recorder{}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+type goldenConstruct struct {
+	*Construct
+	mu   sync.Mutex
+	docs [][]byte
+}
+
+func (c *goldenConstruct) TestServer() *httptest.Server {
+	ts := getTestServer()
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut || r.Method == http.MethodPost {
+			body, _ := ioutil.ReadAll(r.Body)
+			c.mu.Lock()
+			c.docs = append(c.docs, body)
+			c.mu.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	})
+	c.testServer = ts
+	return ts
+}
+
+func (c *goldenConstruct) Documents() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.docs
+}
+
+func TestElasticsearchGolden(t *testing.T) {
+	rt.TestGolden(t, "testdata/golden", func() (rt.GoldenConstructor, func()) {
+		c := &goldenConstruct{Construct: &Construct{
+			testServer:    getTestServer(),
+			BaseConstruct: rt.NewBaseConstruct(),
+		}}
+		return c, func() { c.testServer.Close() }
+	})
+}
@@ -0,0 +1,225 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/pkg/errors"
+)
+
+// The actions of the Retention.
+const (
+	// RetentionDelete deletes the old indices.
+	RetentionDelete = "delete"
+
+	// RetentionShrink shrinks the old indices to one primary shard into new
+	// indices with the shrunkSuffix, and deletes the old ones when the new
+	// ones are ready. All shards of an index should be on one node for
+	// elasticsearch to shrink it.
+	RetentionShrink = "shrink"
+
+	// DefaultRetentionInterval is how often the old indices are looked up
+	// when the Interval of the Retention is not set.
+	DefaultRetentionInterval = time.Hour
+
+	shrunkSuffix = "-shrunk"
+)
+
+// expiredIndices counts the indices that are removed, labelled by the actions.
+var expiredIndices = expvar.NewMap("ElasticSearch Expired Indices")
+
+// Retention removes the indices that match the Pattern when they are older
+// than the MaxAge, for the clusters that are not maintained by Curator or the
+// index lifecycle management. The age of an index is from its creation date.
+// The index name of the recorder and the indices it has written to since the
+// previous run are never removed.
+type Retention struct {
+	// Pattern is the wildcard expression of the indices, for example
+	// expipe-*. It is required, because a pattern derived from the index name
+	// would match the indices of the other applications that share its prefix.
+	Pattern string
+
+	// MaxAge is the age the indices are removed at.
+	MaxAge time.Duration
+
+	// Action is RetentionDelete or RetentionShrink. It is RetentionDelete if
+	// empty.
+	Action string
+
+	// Interval is how often the indices are looked up. It is
+	// DefaultRetentionInterval if zero.
+	Interval time.Duration
+}
+
+// WithRetention removes the old indices on the interval of the ret. The
+// indices are looked up after the recorder records a job, therefore it does
+// not run while the recorder is idle. It returns an error if the Pattern is
+// empty, the MaxAge is not positive or the Action is not known.
+func WithRetention(ret Retention) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errors.New("incompatible recorder")
+		}
+		if ret.Pattern == "" {
+			return errors.New("retention pattern is required")
+		}
+		if ret.MaxAge <= 0 {
+			return errors.New("retention max_age should be positive")
+		}
+		ret.Action = strings.ToLower(ret.Action)
+		if ret.Action == "" {
+			ret.Action = RetentionDelete
+		}
+		if ret.Action != RetentionDelete && ret.Action != RetentionShrink {
+			return fmt.Errorf("retention action should be one of %s and %s: %s", RetentionDelete, RetentionShrink, ret.Action)
+		}
+		if strings.ContainsAny(ret.Pattern, ` "\<|,>/?`) {
+			return recorder.InvalidIndexNameError(ret.Pattern)
+		}
+		if ret.Interval <= 0 {
+			ret.Interval = DefaultRetentionInterval
+		}
+		r.retention = &ret
+		return nil
+	}
+}
+
+// wrote marks the indices as in use, and runs the retention in the background
+// if it is due and is not running.
+func (r *Recorder) wrote(indices ...string) {
+	if r.retention == nil {
+		return
+	}
+	r.retMu.Lock()
+	for _, index := range indices {
+		r.written[index] = true
+	}
+	due := time.Since(r.lastRetention) >= r.retention.Interval
+	if due {
+		r.lastRetention = time.Now()
+	}
+	r.retMu.Unlock()
+	if !due || !atomic.CompareAndSwapInt32(&r.retaining, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&r.retaining, 0)
+		if err := r.retain(time.Now()); err != nil {
+			r.log.WithField("recorder", "elasticsearch").
+				WithField("name", r.Name()).
+				Errorf("%s: index retention: %v", r.name, err)
+		}
+	}()
+}
+
+// retain removes the indices of the pattern that are older than the MaxAge at
+// now. It carries on with the other indices if one of them fails, and returns
+// the last error.
+func (r *Recorder) retain(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	settings, err := r.client.IndexGetSettings(r.retention.Pattern).FlatSettings(true).Do(ctx)
+	cancel()
+	if err != nil {
+		return errors.Wrap(err, "index settings")
+	}
+	r.retMu.Lock()
+	written := r.written
+	r.written = make(map[string]bool)
+	r.retMu.Unlock()
+
+	indices := make([]string, 0, len(settings))
+	for index := range settings {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	var lastErr error
+	for _, index := range indices {
+		if index == r.indexName || written[index] {
+			continue
+		}
+		if r.retention.Action == RetentionShrink && strings.HasSuffix(index, shrunkSuffix) {
+			continue
+		}
+		s := settings[index]
+		if s == nil {
+			continue
+		}
+		created, ok := creationDate(s.Settings)
+		if !ok || now.Sub(created) < r.retention.MaxAge {
+			continue
+		}
+		if r.retention.Action == RetentionShrink {
+			err = r.shrink(index)
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+			_, err = r.client.DeleteIndex(index).Do(ctx)
+			cancel()
+		}
+		if err != nil {
+			lastErr = errors.Wrap(err, index)
+			continue
+		}
+		expiredIndices.Add(r.retention.Action, 1)
+		r.log.WithField("recorder", "elasticsearch").
+			WithField("name", r.Name()).
+			Infof("%s: %s index %s, created at %s", r.name, r.retention.Action, index, created.Format(time.RFC3339))
+	}
+	return lastErr
+}
+
+// shrink shrinks the index into a new index with one primary shard, and
+// deletes the index when the new one is ready. If the new index is not ready
+// within the timeout, the index is deleted on a later run.
+func (r *Recorder) shrink(index string) error {
+	target := index + shrunkSuffix
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	exists, err := r.client.IndexExists(target).Do(ctx)
+	if err != nil {
+		return errors.Wrap(err, "querying the shrunk index")
+	}
+	if !exists {
+		if _, err = r.client.IndexPutSettings(index).BodyString(`{"index.blocks.write":true}`).Do(ctx); err != nil {
+			return errors.Wrap(err, "blocking the writes")
+		}
+		body := `{"settings":{"index.number_of_shards":1,"index.blocks.write":null}}`
+		if _, err = r.client.ShrinkIndex(index, target).BodyString(body).Do(ctx); err != nil {
+			return errors.Wrap(err, "shrinking")
+		}
+	}
+	health, err := r.client.ClusterHealth().Index(target).WaitForStatus("green").Timeout(r.timeout.String()).Do(ctx)
+	if err != nil {
+		return errors.Wrap(err, "health of the shrunk index")
+	}
+	if health.TimedOut || health.Status != "green" {
+		return fmt.Errorf("%s is not ready yet", target)
+	}
+	_, err = r.client.DeleteIndex(index).Do(ctx)
+	return err
+}
+
+// creationDate returns the index.creation_date of the flat settings of an
+// index, which is in milliseconds since epoch.
+func creationDate(settings map[string]interface{}) (time.Time, bool) {
+	v, ok := settings["index.creation_date"].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/recorder/elasticsearch"
+	rt "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/tools/token"
+)
+
+// retentionServer serves the settings of the indices of my_index* with their
+// creation dates, and sends the method and path of the changes to the calls.
+func retentionServer(indices map[string]time.Time, calls chan<- string) *httptest.Server {
+	var host, url, port string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/my_index*/_settings" && r.Method == http.MethodGet:
+			settings := make([]string, 0, len(indices))
+			for index, created := range indices {
+				ms := created.UnixNano() / int64(time.Millisecond)
+				settings = append(settings, fmt.Sprintf(`"%s":{"settings":{"index.creation_date":"%d"}}`, index, ms))
+			}
+			w.Write([]byte("{" + strings.Join(settings, ",") + "}"))
+		case strings.HasPrefix(r.URL.Path, "/_cluster/health/"):
+			w.Write([]byte(`{"status":"green","timed_out":false}`))
+		case r.Method == http.MethodHead && r.URL.Path != "/":
+			// None of the shrunk indices exist yet.
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodDelete || strings.HasSuffix(r.URL.Path, "/_settings") || strings.Contains(r.URL.Path, "/_shrink/"):
+			calls <- r.Method + " " + r.URL.Path
+			w.Write([]byte(`{"acknowledged":true}`))
+		case len(r.URL.Path) > 5:
+			w.Write([]byte(recording))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		}
+	}))
+	url = strings.Split(ts.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+	return ts
+}
+
+func retentionJob(index string) recorder.Job {
+	return recorder.Job{
+		ID:        token.NewUID(),
+		Payload:   datatype.New([]datatype.DataType{datatype.NewFloatType("a", 1)}),
+		TypeName:  "type1",
+		IndexName: index,
+		Time:      time.Now(),
+	}
+}
+
+func TestElasticsearchRetentionDelete(t *testing.T) {
+	t.Parallel()
+	old := time.Now().Add(-48 * time.Hour)
+	// The indices are processed in order, therefore if my_index-old is the
+	// first one to be deleted, the rest are kept.
+	indices := map[string]time.Time{
+		"my_index":           old,
+		"my_index-a-written": old,
+		"my_index-new":       time.Now(),
+		"my_index-old":       old,
+	}
+	calls := make(chan string, 10)
+	ts := retentionServer(indices, calls)
+	defer ts.Close()
+
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("my_index"),
+		elasticsearch.WithRetention(elasticsearch.Retention{Pattern: "my_index*", MaxAge: 24 * time.Hour}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(context.Background(), retentionJob("my_index-a-written")); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	select {
+	case call := <-calls:
+		if call != "DELETE /my_index-old" {
+			t.Errorf("call = (%s); want (DELETE /my_index-old)", call)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the old index was not deleted")
+	}
+
+	// The retention does not run again before the interval.
+	if err = rec.Record(context.Background(), retentionJob("")); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	select {
+	case call := <-calls:
+		t.Errorf("unexpected call: %s", call)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestElasticsearchRetentionShrink(t *testing.T) {
+	t.Parallel()
+	old := time.Now().Add(-48 * time.Hour)
+	indices := map[string]time.Time{
+		"my_index-0-shrunk": old,
+		"my_index-old":      old,
+	}
+	calls := make(chan string, 10)
+	ts := retentionServer(indices, calls)
+	defer ts.Close()
+
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("my_index"),
+		elasticsearch.WithRetention(elasticsearch.Retention{
+			Pattern: "my_index*",
+			MaxAge:  24 * time.Hour,
+			Action:  elasticsearch.RetentionShrink,
+		}),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(context.Background(), retentionJob("")); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := []string{
+		"PUT /my_index-old/_settings",
+		"POST /my_index-old/_shrink/my_index-old-shrunk",
+		"DELETE /my_index-old",
+	}
+	for _, w := range want {
+		select {
+		case call := <-calls:
+			if call != w {
+				t.Errorf("call = (%s); want (%s)", call, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for (%s)", w)
+		}
+	}
+}
+
+func TestWithRetention(t *testing.T) {
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint("http://localhost"),
+		recorder.WithName("name"),
+		recorder.WithIndexName("my_index"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		name    string
+		ret     elasticsearch.Retention
+		wantErr bool
+	}{
+		{"defaults", elasticsearch.Retention{Pattern: "my_index-*", MaxAge: time.Hour}, false},
+		{"shrink", elasticsearch.Retention{Pattern: "my_index-*", MaxAge: time.Hour, Action: "Shrink"}, false},
+		{"no pattern", elasticsearch.Retention{MaxAge: time.Hour}, true},
+		{"no max_age", elasticsearch.Retention{Pattern: "my_index-*"}, true},
+		{"negative max_age", elasticsearch.Retention{Pattern: "my_index-*", MaxAge: -time.Hour}, true},
+		{"unknown action", elasticsearch.Retention{Pattern: "my_index-*", MaxAge: time.Hour, Action: "close"}, true},
+		{"bad pattern", elasticsearch.Retention{Pattern: "my index*", MaxAge: time.Hour}, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := elasticsearch.WithRetention(tc.ret)(rec)
+			if tc.wantErr && err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("err = (%v); want (nil)", err)
+			}
+		})
+	}
+	if err = elasticsearch.WithRetention(elasticsearch.Retention{Pattern: "my_index-*", MaxAge: time.Hour})(&rt.Recorder{}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -18,6 +18,7 @@ var (
 	ErrEmptyIndexName = fmt.Errorf("index_name cannot be empty")
 	ErrPingNotCalled  = fmt.Errorf("the caller forgot to ask me pinging")
 	ErrNillLogger     = fmt.Errorf("nil logger")
+	ErrNilHTTPClient  = fmt.Errorf("nil http client")
 )
 
 // InvalidEndpointError is returned when the endpoint is not a valid URL.
@@ -47,6 +48,19 @@ func (e EndpointNotAvailableError) Error() string {
 	return fmt.Sprintf("endpoint (%s) not available: %s", e.Endpoint, e.Err)
 }
 
+// BatchError is returned by RecordBatch when some of the Jobs are not
+// recorded. Retry holds the indices of the Jobs that should be recorded again,
+// the other Jobs are either recorded or can never be recorded, for example
+// because the endpoint rejects their documents.
+type BatchError struct {
+	Retry []int
+	Err   error
+}
+
+func (e BatchError) Error() string {
+	return fmt.Sprintf("%d jobs should be retried: %s", len(e.Retry), e.Err)
+}
+
 // InvalidIndexNameError is returned when the index name is invalid.
 type InvalidIndexNameError string
 
@@ -0,0 +1,151 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package forwarder
+
+import (
+	"time"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a forwarder
+// recorder. The endpoint is the address of the receiver reader, and the token
+// is sent to it if it is set, which can be read from the token_file instead.
+// The requests are sent through the proxy_url if set, otherwise through the
+// proxy of the environment. The request bodies are compressed with gzip if
+// compress is true, and the repeated keys of the batches are sent once if
+// compact_keys is true.
+type Config struct {
+	FWEndpoint  string `mapstructure:"endpoint"`
+	FWToken     string `mapstructure:"token"`
+	FWTokenFile string `mapstructure:"token_file"`
+	FWTimeout   string `mapstructure:"timeout"`
+	FWIndexName string `mapstructure:"index_name"`
+	FWProxyURL  string `mapstructure:"proxy_url"`
+	FWCompress  bool   `mapstructure:"compress"`
+	FWCompact   bool   `mapstructure:"compact_keys"`
+	log         tools.FieldLogger
+	FWName      string
+	ConfTimeout time.Duration
+}
+
+func init() {
+	recorder.Register("forwarder", func(src recorder.Source, log tools.FieldLogger, name, key string) (recorder.DataRecorder, error) {
+		rc, err := NewConfig(WithViper(src, name, key), WithLogger(log))
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
+	})
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Recorder implements the RecorderConf interface.
+func (c *Config) Recorder() (recorder.DataRecorder, error) {
+	options := []func(recorder.Constructor) error{
+		recorder.WithLogger(c.Logger()),
+		recorder.WithEndpoint(c.Endpoint()),
+		recorder.WithName(c.Name()),
+		recorder.WithTimeout(c.Timeout()),
+		WithToken(c.FWToken),
+	}
+	if c.FWIndexName != "" {
+		options = append(options, recorder.WithIndexName(c.FWIndexName))
+	}
+	if c.FWCompress {
+		options = append(options, WithCompression())
+	}
+	if c.FWCompact {
+		options = append(options, WithCompactKeys())
+	}
+	if c.FWProxyURL != "" {
+		client, err := httpclient.WithProxy(c.FWProxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "proxy_url")
+		}
+		options = append(options, recorder.WithHTTPClient(client))
+	}
+	return New(options...)
+}
+
+// Name return the name.
+func (c *Config) Name() string { return c.FWName }
+
+// IndexName return the index name.
+func (c *Config) IndexName() string { return c.FWIndexName }
+
+// Endpoint return the endpoint.
+func (c *Config) Endpoint() string { return c.FWEndpoint }
+
+// Timeout return the timeout.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger return the logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error any of the inputs are empty.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if name == "" {
+			return recorder.ErrEmptyName
+		}
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if c.ConfTimeout, err = time.ParseDuration(c.FWTimeout); err != nil {
+			return &recorder.ParseTimeOutError{Timeout: c.FWTimeout, Err: err}
+		}
+		if c.FWTokenFile != "" {
+			if c.FWToken != "" {
+				return errors.New("only one of token and token_file should be set")
+			}
+			if c.FWToken, err = tools.ReadSecretFile(c.FWTokenFile); err != nil {
+				return errors.Wrap(err, "token_file")
+			}
+		}
+		c.FWName = name
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package forwarder_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/recorder/forwarder"
+	"github.com/alext234/expipe/tools"
+	"github.com/spf13/viper"
+)
+
+func TestWithViper(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    recorders:
+        recorder1:
+            type: forwarder
+            endpoint: aggregator:9480
+            token: secret
+            timeout: 8s
+            compact_keys: true
+    `))
+	c, err := forwarder.NewConfig(
+		forwarder.WithLogger(tools.DiscardLogger()),
+		forwarder.WithViper(v, "recorder1", "recorders.recorder1"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Name() != "recorder1" || c.Endpoint() != "aggregator:9480" || c.FWToken != "secret" {
+		t.Errorf("config = (%v); want (recorder1, aggregator:9480, secret)", c)
+	}
+	if c.Timeout() != 8*time.Second || !c.FWCompact {
+		t.Errorf("Timeout(), FWCompact = (%s, %t); want (8s, true)", c.Timeout(), c.FWCompact)
+	}
+	r, err := c.Recorder()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if r.Endpoint() != "http://aggregator:9480" || r.IndexName() != "recorder1" {
+		t.Errorf("recorder = (%s, %s); want (http://aggregator:9480, recorder1)", r.Endpoint(), r.IndexName())
+	}
+}
+
+func TestWithViperErrors(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    recorders:
+        bad_timeout:
+            endpoint: aggregator:9480
+            timeout: nope
+        both_tokens:
+            endpoint: aggregator:9480
+            timeout: 8s
+            token: secret
+            token_file: /nonexistent
+        missing_token_file:
+            endpoint: aggregator:9480
+            timeout: 8s
+            token_file: /nonexistent
+    `))
+	c := new(forwarder.Config)
+	if err := forwarder.WithViper(v, "", "recorders.bad_timeout")(c); err != recorder.ErrEmptyName {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrEmptyName)
+	}
+	err := forwarder.WithViper(v, "bad_timeout", "recorders.bad_timeout")(c)
+	if _, ok := err.(*recorder.ParseTimeOutError); !ok {
+		t.Errorf("err = (%T); want (*recorder.ParseTimeOutError)", err)
+	}
+	for _, name := range []string{"both_tokens", "missing_token_file"} {
+		c = new(forwarder.Config)
+		if err := forwarder.WithViper(v, name, "recorders."+name)(c); err == nil {
+			t.Errorf("%s: err = (nil); want (error)", name)
+		}
+	}
+	if err := forwarder.WithViper(nil, "name", "recorders.bad_timeout")(c); err == nil {
+		t.Error("err = (nil); want (error): nil viper")
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package forwarder contains logic to send the documents to the receiver
+// reader of a central expipe, see the forward package for the protocol. The
+// forwarder records the batches of the Engine in one request, therefore the
+// flush_interval setting reduces the number of the requests.
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/forward"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/pkg/errors"
+)
+
+// StatusError is returned when the receiver responds with an unexpected
+// status.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("receiver responded with %s", e.Status)
+}
+
+// Recorder sends the jobs to a receiver. It implements DataRecorder and
+// BatchRecorder interfaces.
+type Recorder struct {
+	name       string
+	endpoint   string
+	token      string
+	indexName  string
+	log        tools.FieldLogger
+	timeout    time.Duration
+	pinged     bool
+	compress   bool
+	compact    bool
+	skew       *httpclient.SkewTransport
+	httpClient *http.Client
+}
+
+// New returns an error if the name or the endpoint is empty.
+func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
+	r := &Recorder{}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, recorder.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, recorder.ErrEmptyEndpoint
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "expipe")
+	if r.indexName == "" {
+		r.indexName = r.name
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	if r.httpClient == nil {
+		r.httpClient = httpclient.Default()
+	}
+	r.httpClient, r.skew = httpclient.Skewed(r.httpClient)
+	r.httpClient = httpclient.Compressed(r.httpClient, r.name, r.compress)
+	return r, nil
+}
+
+// WithToken sets the token of the receiver.
+func WithToken(token string) func(recorder.Constructor) error {
+	return func(c recorder.Constructor) error {
+		r, ok := c.(*Recorder)
+		if !ok {
+			return fmt.Errorf("not a forwarder recorder: %T", c)
+		}
+		r.token = token
+		return nil
+	}
+}
+
+// WithCompression compresses the bodies of the requests with gzip, which the
+// receiver accepts. The bytes of the bodies before and after the compression
+// are reported in the Request Uncompressed Bytes and Request Compressed Bytes
+// metrics either way.
+func WithCompression() func(recorder.Constructor) error {
+	return func(c recorder.Constructor) error {
+		r, ok := c.(*Recorder)
+		if !ok {
+			return fmt.Errorf("not a forwarder recorder: %T", c)
+		}
+		r.compress = true
+		return nil
+	}
+}
+
+// WithCompactKeys sends the keys that are repeated in the documents of each
+// batch once, which makes the batches of the large expvar maps much smaller.
+// The receiver should be of a version that expands them.
+func WithCompactKeys() func(recorder.Constructor) error {
+	return func(c recorder.Constructor) error {
+		r, ok := c.(*Recorder)
+		if !ok {
+			return fmt.Errorf("not a forwarder recorder: %T", c)
+		}
+		r.compact = true
+		return nil
+	}
+}
+
+// Ping pings the receiver. It returns an EndpointNotAvailableError if the
+// receiver can not be reached, or a StatusError if it rejects the token.
+func (r *Recorder) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	if err := r.do(ctx, http.MethodGet, nil); err != nil {
+		return err
+	}
+	r.pinged = true
+	return nil
+}
+
+// Record sends the job to the receiver. It returns an error if the ping is
+// not called or the receiver doesn't accept the job.
+func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
+	return r.RecordBatch(ctx, []recorder.Job{job})
+}
+
+// RecordBatch sends all jobs to the receiver in one request. The receiver
+// accepts all or none of them, and it responds with a StatusError of 503 if
+// its queue is full. The batch is compacted if the recorder is created with
+// WithCompactKeys.
+func (r *Recorder) RecordBatch(ctx context.Context, jobs []recorder.Job) error {
+	if !r.pinged {
+		return recorder.ErrPingNotCalled
+	}
+	batch := forward.Batch{Documents: make([]forward.Document, 0, len(jobs))}
+	for _, job := range jobs {
+		w := new(bytes.Buffer)
+		if _, err := job.Payload.Generate(w, job.Time); err != nil {
+			return errors.Wrap(err, "generating payload")
+		}
+		batch.Documents = append(batch.Documents, forward.Document{
+			ID:       job.ID.String(),
+			Reader:   job.Reader,
+			TypeName: job.TypeName,
+			Time:     job.Time,
+			Payload:  w.Bytes(),
+		})
+	}
+	if r.compact {
+		if err := batch.Compact(); err != nil {
+			return errors.Wrap(err, "compacting the batch")
+		}
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return errors.Wrap(err, "encoding the batch")
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout())
+	defer cancel()
+	if err = r.do(ctx, http.MethodPost, bytes.NewReader(body)); err != nil {
+		r.log.WithField("recorder", "forwarder").
+			WithField("name", r.Name()).
+			Debugf("%s: error sending %d documents: %v", r.name, len(jobs), err)
+		return err
+	}
+	return nil
+}
+
+func (r *Recorder) do(ctx context.Context, method string, body io.Reader) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(r.endpoint, "/")+forward.Path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	forward.SetToken(req, r.token)
+	resp, err := r.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		if _, ok := err.(*url.Error); ok {
+			err = recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+// ReleasePayloads returns true as the payloads are encoded before they are
+// sent.
+func (r *Recorder) ReleasePayloads() bool { return true }
+
+// Name shows the name identifier for this recorder.
+func (r *Recorder) Name() string { return r.name }
+
+// SetName sets the name of the recorder.
+func (r *Recorder) SetName(name string) { r.name = name }
+
+// Endpoint returns the address of the receiver.
+func (r *Recorder) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the address of the receiver.
+func (r *Recorder) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// IndexName returns the index name. The receiver's recorders use their own
+// index names.
+func (r *Recorder) IndexName() string { return r.indexName }
+
+// SetIndexName sets the index name of the recorder.
+func (r *Recorder) SetIndexName(indexName string) { r.indexName = indexName }
+
+// Timeout returns the time-out.
+func (r *Recorder) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the recorder.
+func (r *Recorder) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the recorder.
+func (r *Recorder) SetLogger(log tools.FieldLogger) { r.log = log }
+
+// SetHTTPClient sets the http client of the recorder.
+func (r *Recorder) SetHTTPClient(client *http.Client) { r.httpClient = client }
+
+// ClockSkew returns the skew of the clock of the endpoint from the Date header
+// of the last response. It returns false if no response had a Date header.
+func (r *Recorder) ClockSkew() (time.Duration, bool) {
+	if r.skew == nil {
+		return 0, false
+	}
+	return r.skew.Skew()
+}
@@ -0,0 +1,227 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package forwarder_test
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/reader/receiver"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/recorder/forwarder"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/token"
+)
+
+func newRecorder(t *testing.T, endpoint string, options ...func(recorder.Constructor) error) *forwarder.Recorder {
+	options = append([]func(recorder.Constructor) error{
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("forwarder"),
+		recorder.WithEndpoint(endpoint),
+	}, options...)
+	r, err := forwarder.New(options...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return r
+}
+
+func newJob(reader string, value float64) recorder.Job {
+	payload := datatype.New([]datatype.DataType{datatype.NewFloatType("Alloc", value)})
+	payload.SetLabels(datatype.Labels{"host": "edge-1"})
+	return recorder.Job{
+		ID:        token.NewUID(),
+		Payload:   payload,
+		Time:      time.Now().UTC().Truncate(time.Second),
+		TypeName:  "my_app",
+		IndexName: "ignored",
+		Reader:    reader,
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := forwarder.New(recorder.WithName("forwarder")); err != recorder.ErrEmptyEndpoint {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrEmptyEndpoint)
+	}
+	if _, err := forwarder.New(recorder.WithEndpoint("http://127.0.0.1:9480")); err != recorder.ErrEmptyName {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrEmptyName)
+	}
+	r := newRecorder(t, "http://127.0.0.1:9480")
+	if r.IndexName() != "forwarder" || r.Timeout() != 5*time.Second {
+		t.Errorf("recorder = (%s, %s); want (forwarder, 5s)", r.IndexName(), r.Timeout())
+	}
+	if err := r.Record(context.Background(), newJob("app", 1)); err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+}
+
+func TestForwardToReceiver(t *testing.T) {
+	red, err := receiver.New(
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("receiver"),
+		receiver.WithListen("127.0.0.1:0"),
+		receiver.WithToken("secret"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer red.Close()
+	endpoint := "http://" + red.Addr().String()
+
+	rec := newRecorder(t, endpoint)
+	if err = rec.Ping(); err == nil {
+		t.Error("err = (nil); want (error): no token")
+	}
+	rec = newRecorder(t, endpoint, forwarder.WithToken("secret"))
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if skew, ok := rec.ClockSkew(); !ok || skew < -time.Second || skew > time.Second {
+		t.Errorf("ClockSkew() = (%s, %t); want (0 ± 1s, true)", skew, ok)
+	}
+	jobs := []recorder.Job{newJob("app1", 12.5), newJob("app2", 2)}
+	if err = rec.RecordBatch(context.Background(), jobs); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(context.Background(), newJob("app3", 3)); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+
+	for i, want := range []string{`{"Alloc":12.500000}`, `{"Alloc":2.000000}`, `{"Alloc":3.000000}`} {
+		res, err := red.Read(token.New(context.Background()))
+		if err != nil {
+			t.Fatalf("%d: err = (%v); want (nil)", i, err)
+		}
+		if string(res.Content) != want {
+			t.Errorf("%d: Content = (%s); want (%s)", i, res.Content, want)
+		}
+		if res.TypeName != "my_app" || !res.Time.Equal(jobs[0].Time) {
+			t.Errorf("%d: TypeName, Time = (%s, %s); want (my_app, %s)", i, res.TypeName, res.Time, jobs[0].Time)
+		}
+		if want := (datatype.Labels{"host": "edge-1"}); !res.Labels.Equal(want) {
+			t.Errorf("%d: Labels = (%v); want (%v)", i, res.Labels, want)
+		}
+	}
+}
+
+func TestForwardCompressed(t *testing.T) {
+	red, err := receiver.New(
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("receiver"),
+		receiver.WithListen("127.0.0.1:0"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer red.Close()
+
+	rec := newRecorder(t, "http://"+red.Addr().String(),
+		recorder.WithName("compressed_forwarder"),
+		forwarder.WithCompression(),
+	)
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	jobs := make([]recorder.Job, 50)
+	for i := range jobs {
+		jobs[i] = newJob("app", float64(i))
+	}
+	if err = rec.RecordBatch(context.Background(), jobs); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	res, err := red.Read(token.New(context.Background()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if string(res.Content) != `{"Alloc":0.000000}` {
+		t.Errorf("Content = (%s); want ({\"Alloc\":0.000000})", res.Content)
+	}
+
+	bytesOf := func(metric string) int64 {
+		v, ok := expvar.Get(metric).(*expvar.Map).Get("compressed_forwarder").(*expvar.Int)
+		if !ok {
+			t.Fatalf("%s was not reported", metric)
+		}
+		return v.Value()
+	}
+	raw, wire := bytesOf("Request Uncompressed Bytes"), bytesOf("Request Compressed Bytes")
+	if wire == 0 || wire >= raw {
+		t.Errorf("compressed = (%d); want (0 < compressed < %d)", wire, raw)
+	}
+}
+
+func TestForwardCompactKeys(t *testing.T) {
+	red, err := receiver.New(
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("receiver"),
+		receiver.WithListen("127.0.0.1:0"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer red.Close()
+
+	rec := newRecorder(t, "http://"+red.Addr().String(), forwarder.WithCompactKeys())
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	jobs := []recorder.Job{newJob("app", 1), newJob("app", 2)}
+	if err = rec.RecordBatch(context.Background(), jobs); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for i, want := range []string{`{"Alloc":1.000000}`, `{"Alloc":2.000000}`} {
+		res, err := red.Read(token.New(context.Background()))
+		if err != nil {
+			t.Fatalf("%d: err = (%v); want (nil)", i, err)
+		}
+		if string(res.Content) != want {
+			t.Errorf("%d: Content = (%s); want (%s)", i, res.Content, want)
+		}
+		if want := (datatype.Labels{"host": "edge-1"}); !res.Labels.Equal(want) {
+			t.Errorf("%d: Labels = (%v); want (%v)", i, res.Labels, want)
+		}
+	}
+}
+
+func TestRecordErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			http.Error(w, "the queue is full", http.StatusServiceUnavailable)
+		}
+	}))
+	rec := newRecorder(t, ts.URL)
+	if err := rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err := rec.Record(context.Background(), newJob("app", 1))
+	if e, ok := err.(forwarder.StatusError); !ok || e.Code != http.StatusServiceUnavailable {
+		t.Errorf("err = (%v); want (StatusError 503)", err)
+	}
+	if !strings.Contains(err.Error(), "503") {
+		t.Errorf("Error() = (%s); want (503)", err)
+	}
+
+	ts.Close()
+	err = rec.Record(context.Background(), newJob("app", 1))
+	if _, ok := err.(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%T); want (recorder.EndpointNotAvailableError)", err)
+	}
+}
@@ -5,6 +5,7 @@
 package recorder
 
 import (
+	"net/http"
 	"strings"
 	"time"
 
@@ -21,6 +22,7 @@ type Constructor interface {
 	SetIndexName(indexName string)
 	SetEndpoint(endpoint string)
 	SetTimeout(timeout time.Duration)
+	SetHTTPClient(client *http.Client)
 }
 
 // WithLogger sets the log of the recorder.
@@ -84,3 +86,15 @@ func WithTimeout(timeout time.Duration) func(Constructor) error {
 		return nil
 	}
 }
+
+// WithHTTPClient sets the http client of the recorder. Recorders use the
+// shared client of the httpclient package if it is not set.
+func WithHTTPClient(client *http.Client) func(Constructor) error {
+	return func(e Constructor) error {
+		if client == nil {
+			return ErrNilHTTPClient
+		}
+		e.SetHTTPClient(client)
+		return nil
+	}
+}
@@ -5,6 +5,7 @@
 package recorder_test
 
 import (
+	"net/http"
 	"testing"
 	"time"
 
@@ -95,3 +96,15 @@ func TestSetTimeout(t *testing.T) {
 		t.Errorf("err = (%v); want (nil)", err)
 	}
 }
+
+func TestSetHTTPClient(t *testing.T) {
+	r := recorder_testing.Recorder{}
+	err := recorder.WithHTTPClient(nil)(&r)
+	if errors.Cause(err) != recorder.ErrNilHTTPClient {
+		t.Errorf("err = (%v); want (recorder.ErrNilHTTPClient)", err)
+	}
+	err = recorder.WithHTTPClient(http.DefaultClient)(&r)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
@@ -42,6 +42,34 @@ type DataRecorder interface {
 	Endpoint() string
 }
 
+// BatchRecorder is a DataRecorder that can record multiple Jobs in one call.
+// The Engine sends the batches when the flush interval is set. RecordBatch
+// should return an error if any of the Jobs are not recorded. It returns a
+// BatchError if only some of the Jobs should be recorded again, otherwise the
+// Engine records all of them again.
+type BatchRecorder interface {
+	DataRecorder
+	RecordBatch(context.Context, []Job) error
+}
+
+// PayloadReleaser is a DataRecorder that does not keep the payloads of the
+// Jobs after Record or RecordBatch return, for example because it encodes them
+// before sending. The Engine puts the payloads of its Jobs back in the pools of
+// the datatype package when ReleasePayloads returns true, see datatype.Release.
+type PayloadReleaser interface {
+	DataRecorder
+	ReleasePayloads() bool
+}
+
+// ClockSkewer is a DataRecorder that knows how far the clock of its endpoint
+// is from the local clock. ClockSkew returns false if the skew is not known
+// yet. The Engine publishes the skews and warns when they are too large, as
+// the documents of a skewed clock land in the past or the future.
+type ClockSkewer interface {
+	DataRecorder
+	ClockSkew() (time.Duration, bool)
+}
+
 // Job is sent with a context and a payload to be recorded. If the TypeName and
 // IndexName are different than the previous one, the recorder should use the
 // ones engine provides. If any errors occurred, recorders should return the
@@ -64,4 +92,7 @@ type Job struct {
 
 	// TypeName comes from the configuration of readers.
 	TypeName string
+
+	// Reader is the name of the reader the payload is read from.
+	Reader string
 }
@@ -0,0 +1,120 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"time"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a plugin recorder.
+// The binary of the path is run with the args, relative paths are resolved
+// from the working directory.
+type Config struct {
+	PLPath      string   `mapstructure:"path"`
+	PLArgs      []string `mapstructure:"args"`
+	PLTimeout   string   `mapstructure:"timeout"`
+	PLIndexName string   `mapstructure:"index_name"`
+	log         tools.FieldLogger
+	PLName      string
+	ConfTimeout time.Duration
+}
+
+func init() {
+	recorder.Register("plugin", func(src recorder.Source, log tools.FieldLogger, name, key string) (recorder.DataRecorder, error) {
+		rc, err := NewConfig(WithViper(src, name, key), WithLogger(log))
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
+	})
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Recorder implements the RecorderConf interface.
+func (c *Config) Recorder() (recorder.DataRecorder, error) {
+	return New(
+		recorder.WithLogger(c.Logger()),
+		WithCommand(c.PLPath, c.PLArgs...),
+		recorder.WithName(c.Name()),
+		recorder.WithIndexName(c.IndexName()),
+		recorder.WithTimeout(c.Timeout()),
+	)
+}
+
+// Name return the name.
+func (c *Config) Name() string { return c.PLName }
+
+// IndexName return the index name.
+func (c *Config) IndexName() string { return c.PLIndexName }
+
+// Endpoint return the path of the plugin.
+func (c *Config) Endpoint() string { return c.PLPath }
+
+// Timeout return the timeout.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger return the logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error any of the inputs are empty.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if name == "" {
+			return recorder.ErrEmptyName
+		}
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if c.PLPath == "" {
+			return errors.New("path cannot be empty")
+		}
+		if c.ConfTimeout, err = time.ParseDuration(c.PLTimeout); err != nil {
+			return &recorder.ParseTimeOutError{Timeout: c.PLTimeout, Err: err}
+		}
+		c.PLName = name
+		return nil
+	}
+}
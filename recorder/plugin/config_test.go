@@ -0,0 +1,78 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package plugin_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/recorder/plugin"
+	"github.com/alext234/expipe/tools"
+	"github.com/spf13/viper"
+)
+
+func TestWithViper(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    recorders:
+        recorder1:
+            type: plugin
+            path: ./my-recorder
+            args: ["-v"]
+            index_name: index
+            timeout: 8s
+    `))
+	c, err := plugin.NewConfig(
+		plugin.WithLogger(tools.DiscardLogger()),
+		plugin.WithViper(v, "recorder1", "recorders.recorder1"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Name() != "recorder1" || c.IndexName() != "index" || c.Endpoint() != "./my-recorder" {
+		t.Errorf("config = (%v); want (recorder1, index, ./my-recorder)", c)
+	}
+	if c.Timeout() != 8*time.Second {
+		t.Errorf("Timeout() = (%s); want (8s)", c.Timeout())
+	}
+	r, err := c.Recorder()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if r.Endpoint() != "./my-recorder" || r.IndexName() != "index" {
+		t.Errorf("recorder = (%s, %s); want (./my-recorder, index)", r.Endpoint(), r.IndexName())
+	}
+}
+
+func TestWithViperErrors(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    recorders:
+        no_path:
+            timeout: 8s
+        bad_timeout:
+            path: ./my-recorder
+            timeout: nope
+    `))
+	c := new(plugin.Config)
+	if err := plugin.WithViper(v, "", "recorders.no_path")(c); err != recorder.ErrEmptyName {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrEmptyName)
+	}
+	if err := plugin.WithViper(v, "no_path", "recorders.no_path")(c); err == nil {
+		t.Error("err = (nil); want (error): empty path")
+	}
+	c = new(plugin.Config)
+	err := plugin.WithViper(v, "bad_timeout", "recorders.bad_timeout")(c)
+	if _, ok := err.(*recorder.ParseTimeOutError); !ok {
+		t.Errorf("err = (%T); want (*recorder.ParseTimeOutError)", err)
+	}
+	if err := plugin.WithViper(nil, "name", "recorders.no_path")(c); err == nil {
+		t.Error("err = (nil); want (error): nil viper")
+	}
+}
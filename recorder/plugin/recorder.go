@@ -0,0 +1,254 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package plugin contains logic to record data with the plugin binaries. The
+// plugins are built with the tools/plugin package, and they receive the
+// documents with their JSON payloads. The plugin is run when the recorder is
+// pinged, and it is run again on the next record if it stops. It
+// is stopped when the recorder is closed.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/plugin"
+	"github.com/pkg/errors"
+)
+
+// Recorder records the jobs with a plugin binary. It implements DataRecorder
+// interface.
+type Recorder struct {
+	name      string
+	path      string
+	args      []string
+	indexName string
+	log       tools.FieldLogger
+	timeout   time.Duration
+
+	mu     sync.RWMutex
+	pinged bool            // guarded by mu.
+	client *plugin.Client  // guarded by mu.
+	plugin plugin.Recorder // guarded by mu.
+}
+
+// New returns an error if the name or the path is empty.
+func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
+	r := &Recorder{}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, recorder.ErrEmptyName
+	}
+	if r.path == "" {
+		return nil, recorder.ErrEmptyEndpoint
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "expipe")
+	if r.indexName == "" {
+		r.indexName = r.name
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	return r, nil
+}
+
+// WithCommand sets the path of the plugin binary, which is run with the args.
+func WithCommand(path string, args ...string) func(recorder.Constructor) error {
+	return func(c recorder.Constructor) error {
+		r, ok := c.(*Recorder)
+		if !ok {
+			return fmt.Errorf("not a plugin recorder: %T", c)
+		}
+		if path == "" {
+			return recorder.ErrEmptyEndpoint
+		}
+		r.path = path
+		r.args = args
+		return nil
+	}
+}
+
+// Ping runs the plugin if it is not running and pings it. It returns an
+// EndpointNotAvailableError if the plugin can not be run or its ping fails.
+func (r *Recorder) Ping() error {
+	p, err := r.start()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	if err := p.Ping(ctx); err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.path, Err: err}
+	}
+	r.mu.Lock()
+	r.pinged = true
+	r.mu.Unlock()
+	return nil
+}
+
+// start runs the plugin if it is not running, and returns its Recorder.
+func (r *Recorder) start() (plugin.Recorder, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.client != nil && !r.client.Exited() {
+		return r.plugin, nil
+	}
+	client := plugin.NewClient(r.log, r.path, r.args...)
+	p, err := client.Recorder()
+	if err != nil {
+		client.Kill()
+		return nil, recorder.EndpointNotAvailableError{Endpoint: r.path, Err: err}
+	}
+	r.client, r.plugin = client, p
+	return p, nil
+}
+
+// Record sends the job to the plugin. The plugin is run again if it has
+// stopped. It returns an error if the ping is not called or the plugin returns
+// an error.
+func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
+	p, err := r.running()
+	if err != nil {
+		return err
+	}
+	doc, err := document(job)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout())
+	defer cancel()
+	if err = p.Record(ctx, doc); err != nil {
+		r.log.WithField("recorder", "plugin").
+			WithField("name", r.Name()).
+			WithField("ID", job.ID).
+			Debugf("%s: error recording with the plugin: %v", r.name, err)
+		return err
+	}
+	return nil
+}
+
+// RecordBatch sends all jobs to the plugin in one call. The plugins that are
+// not plugin.BatchRecorders record them one by one. It returns an error if the
+// ping is not called or the plugin returns an error.
+func (r *Recorder) RecordBatch(ctx context.Context, jobs []recorder.Job) error {
+	p, err := r.running()
+	if err != nil {
+		return err
+	}
+	docs := make([]plugin.Document, 0, len(jobs))
+	for _, job := range jobs {
+		doc, err := document(job)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout())
+	defer cancel()
+	if br, ok := p.(plugin.BatchRecorder); ok {
+		err = br.RecordBatch(ctx, docs)
+	} else {
+		for _, doc := range docs {
+			if err = p.Record(ctx, doc); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		r.log.WithField("recorder", "plugin").
+			WithField("name", r.Name()).
+			WithField("jobs", len(jobs)).
+			Debugf("%s: error recording the batch with the plugin: %v", r.name, err)
+		return err
+	}
+	return nil
+}
+
+// running returns the Recorder of the plugin, which is run again if it has
+// stopped. It returns an error if the ping is not called.
+func (r *Recorder) running() (plugin.Recorder, error) {
+	r.mu.RLock()
+	pinged := r.pinged
+	r.mu.RUnlock()
+	if !pinged {
+		return nil, recorder.ErrPingNotCalled
+	}
+	return r.start()
+}
+
+// document returns the plugin Document of the job.
+func document(job recorder.Job) (plugin.Document, error) {
+	w := new(bytes.Buffer)
+	if _, err := job.Payload.Generate(w, job.Time); err != nil {
+		return plugin.Document{}, errors.Wrap(err, "generating payload")
+	}
+	return plugin.Document{
+		ID:        job.ID.String(),
+		Reader:    job.Reader,
+		IndexName: job.IndexName,
+		TypeName:  job.TypeName,
+		Time:      job.Time,
+		Payload:   w.Bytes(),
+	}, nil
+}
+
+// Close stops the plugin. It is run again if the recorder is pinged. It always
+// returns nil.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.client != nil {
+		r.client.Kill()
+	}
+	r.client, r.plugin, r.pinged = nil, nil, false
+	return nil
+}
+
+// ReleasePayloads returns true as the payloads are encoded before they are
+// sent.
+func (r *Recorder) ReleasePayloads() bool { return true }
+
+// Name returns the name of the recorder.
+func (r *Recorder) Name() string { return r.name }
+
+// SetName sets the name of the recorder.
+func (r *Recorder) SetName(name string) { r.name = name }
+
+// Endpoint returns the path of the plugin.
+func (r *Recorder) Endpoint() string { return r.path }
+
+// SetEndpoint sets the path of the plugin.
+func (r *Recorder) SetEndpoint(endpoint string) { r.path = endpoint }
+
+// IndexName returns the index name.
+func (r *Recorder) IndexName() string { return r.indexName }
+
+// SetIndexName sets the index name of the recorder.
+func (r *Recorder) SetIndexName(indexName string) { r.indexName = indexName }
+
+// Timeout returns the timeout.
+func (r *Recorder) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the recorder.
+func (r *Recorder) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetHTTPClient does nothing, the plugins make their own requests.
+func (r *Recorder) SetHTTPClient(client *http.Client) {}
+
+// SetLogger sets the log of the recorder.
+func (r *Recorder) SetLogger(log tools.FieldLogger) { r.log = log }
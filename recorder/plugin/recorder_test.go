@@ -0,0 +1,179 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package plugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/recorder/plugin"
+	"github.com/alext234/expipe/tools"
+	sdk "github.com/alext234/expipe/tools/plugin"
+	"github.com/alext234/expipe/tools/token"
+)
+
+// The test binary serves the plugin recorder instead of running the tests if
+// this variable is set.
+const pluginEnv = "EXPIPE_TEST_RECORDER"
+
+// fakeRecorder accepts the documents of the index_name index that have a
+// @timestamp and an Alloc of 1024.
+type fakeRecorder struct{}
+
+func (fakeRecorder) Ping(ctx context.Context) error { return nil }
+
+func (fakeRecorder) Record(ctx context.Context, doc sdk.Document) error {
+	var v map[string]interface{}
+	if err := json.Unmarshal(doc.Payload, &v); err != nil {
+		return err
+	}
+	if doc.IndexName != "index_name" || doc.Reader != "reader1" {
+		return fmt.Errorf("bad document: %s, %s", doc.IndexName, doc.Reader)
+	}
+	if _, ok := v["@timestamp"]; !ok || v["Alloc"] != 1024.0 {
+		return errors.New("bad payload")
+	}
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(pluginEnv) != "" {
+		sdk.ServeRecorder(fakeRecorder{})
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestNew(t *testing.T) {
+	if _, err := plugin.New(recorder.WithName("plugin_recorder")); err != recorder.ErrEmptyEndpoint {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrEmptyEndpoint)
+	}
+	if _, err := plugin.New(plugin.WithCommand("./my-recorder")); err != recorder.ErrEmptyName {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrEmptyName)
+	}
+	r, err := plugin.New(recorder.WithName("plugin_recorder"), plugin.WithCommand("./my-recorder"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if r.IndexName() != "plugin_recorder" {
+		t.Errorf("IndexName() = (%s); want (plugin_recorder)", r.IndexName())
+	}
+	if _, ok := r.Ping().(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%T); want (recorder.EndpointNotAvailableError)", r.Ping())
+	}
+}
+
+func TestRecord(t *testing.T) {
+	r, err := plugin.New(
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("plugin_recorder"),
+		plugin.WithCommand(os.Args[0]),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	job := recorder.Job{
+		ID:        token.NewUID(),
+		Payload:   datatype.New([]datatype.DataType{datatype.NewFloatType("Alloc", 1024)}),
+		Time:      time.Now(),
+		IndexName: "index_name",
+		TypeName:  "app",
+		Reader:    "reader1",
+	}
+	if err := r.Record(context.Background(), job); err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+
+	os.Setenv(pluginEnv, "1")
+	err = r.Ping()
+	os.Unsetenv(pluginEnv)
+	defer sdk.Cleanup()
+	if err != nil {
+		t.Fatalf("Ping() = (%v); want (nil)", err)
+	}
+	if err := r.Record(context.Background(), job); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	job.Reader = "reader2"
+	if err := r.Record(context.Background(), job); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestRecordBatch(t *testing.T) {
+	r, err := plugin.New(
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("plugin_recorder"),
+		plugin.WithCommand(os.Args[0]),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var _ recorder.BatchRecorder = r
+	jobs := make([]recorder.Job, 3)
+	for i := range jobs {
+		jobs[i] = recorder.Job{
+			ID:        token.NewUID(),
+			Payload:   datatype.New([]datatype.DataType{datatype.NewFloatType("Alloc", 1024)}),
+			Time:      time.Now(),
+			IndexName: "index_name",
+			TypeName:  "app",
+			Reader:    "reader1",
+		}
+	}
+	if err := r.RecordBatch(context.Background(), jobs); err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+
+	os.Setenv(pluginEnv, "1")
+	err = r.Ping()
+	os.Unsetenv(pluginEnv)
+	defer sdk.Cleanup()
+	if err != nil {
+		t.Fatalf("Ping() = (%v); want (nil)", err)
+	}
+	if err := r.RecordBatch(context.Background(), jobs); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	jobs[1].Reader = "reader2"
+	if err := r.RecordBatch(context.Background(), jobs); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestClose(t *testing.T) {
+	r, err := plugin.New(
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("plugin_recorder"),
+		plugin.WithCommand(os.Args[0]),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = r.Close(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	os.Setenv(pluginEnv, "1")
+	err = r.Ping()
+	os.Unsetenv(pluginEnv)
+	defer sdk.Cleanup()
+	if err != nil {
+		t.Fatalf("Ping() = (%v); want (nil)", err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	job := recorder.Job{ID: token.NewUID(), Payload: datatype.New(nil), Time: time.Now()}
+	if err := r.Record(context.Background(), job); err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package recorder_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+)
+
+func TestRegister(t *testing.T) {
+	factory := func(src recorder.Source, log tools.FieldLogger, name, key string) (recorder.DataRecorder, error) {
+		return nil, nil
+	}
+	recorder.Register("registry_test", factory)
+	if _, ok := recorder.Lookup("registry_test"); !ok {
+		t.Error("Lookup(registry_test) = (false); want (true)")
+	}
+	if _, ok := recorder.Lookup("not_registered"); ok {
+		t.Error("Lookup(not_registered) = (true); want (false)")
+	}
+	if !tools.StringInSlice("registry_test", recorder.Types()) {
+		t.Errorf("Types() = (%v); want (registry_test) in it", recorder.Types())
+	}
+
+	for name, f := range map[string]recorder.Factory{"registry_test": factory, "nil_factory": nil} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%s) didn't panic", name)
+				}
+			}()
+			recorder.Register(name, f)
+		}()
+	}
+}
@@ -32,6 +32,14 @@
 //
 // The test suit will pick it up and does all the tests.
 //
+// Golden Files
+//
+// TestGolden records each .payload file of a directory with the recorder, and
+// compares the last document its test server received with the .document
+// golden file of the same name. The Construct should implement the
+// GoldenConstructor interface. Set the EXPIPE_UPDATE_GOLDEN environment
+// variable to write the golden files.
+//
 // Important Note
 //
 // You need to write the edge cases if they are not covered in this section. The
@@ -0,0 +1,86 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/internal/golden"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// GoldenConstructor is a Constructor whose test server keeps the documents it
+// receives. Documents should return them in the order they were received.
+type GoldenConstructor interface {
+	Constructor
+	Documents() [][]byte
+}
+
+// TestGolden runs a golden-file test for each .payload file of the dir. The
+// payload is mapped with the default mapper and recorded with the recorder of
+// the GoldenConstructor, and the last document its test server receives is
+// compared with the .document file of the same name. The documents are stamped
+// with a fixed time, and are compared as indented json with their keys sorted.
+// The golden files are written instead when the EXPIPE_UPDATE_GOLDEN
+// environment variable is set.
+func TestGolden(t *testing.T, dir string, setup func() (GoldenConstructor, func())) {
+	for _, path := range golden.Payloads(t, dir) {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), golden.PayloadExt), func(t *testing.T) {
+			cons, cleanup := setup()
+			defer cleanup()
+			goldenCheck(t, cons, path)
+		})
+	}
+}
+
+func goldenCheck(t *testing.T, cons GoldenConstructor, path string) {
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	p, err := datatype.JobResultDataTypes(payload, datatype.DefaultMapper())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	cons.SetName(name)
+	cons.SetIndexName(indexName)
+	cons.SetTimeout(5 * time.Second)
+	cons.SetEndpoint(cons.TestServer().URL)
+	rec, err := cons.Object()
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	job := recorder.Job{
+		ID:        token.NewUID(),
+		Payload:   p,
+		IndexName: indexName,
+		TypeName:  "golden",
+		Time:      golden.Time,
+	}
+	if err = rec.Record(context.Background(), job); errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	docs := cons.Documents()
+	if len(docs) == 0 {
+		t.Fatal("the test server did not receive any documents")
+	}
+	doc, err := golden.JSON(docs[len(docs)-1])
+	if err != nil {
+		t.Fatalf("document is not valid json: %v\n%s", err, docs[len(docs)-1])
+	}
+	golden.Check(t, golden.File(path, golden.DocumentExt), doc)
+}
@@ -13,6 +13,8 @@ import (
 
 	"github.com/alext234/expipe/recorder"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/pinger"
 	"github.com/pkg/errors"
 	"golang.org/x/net/context/ctxhttp"
 )
@@ -29,6 +31,8 @@ type Recorder struct {
 	RecordFunc    func(context.Context, recorder.Job) error
 	PingFunc      func() error
 	Pinged        bool
+	client        *http.Client
+	pinger        *pinger.Pinger
 }
 
 // New is a recorder for using in tests.
@@ -56,6 +60,9 @@ func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
 	if r.MockTimeout == 0 {
 		r.MockTimeout = 5 * time.Second
 	}
+	if r.client == nil {
+		r.client = httpclient.Default()
+	}
 	return r, nil
 }
 
@@ -67,9 +74,7 @@ func (r *Recorder) Ping() error {
 	if r.PingFunc != nil {
 		return r.PingFunc()
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), r.MockTimeout)
-	defer cancel()
-	_, err := ctxhttp.Head(ctx, nil, r.MockEndpoint)
+	err := r.ping()
 	if err != nil {
 		return recorder.EndpointNotAvailableError{Endpoint: r.MockEndpoint, Err: err}
 	}
@@ -77,6 +82,22 @@ func (r *Recorder) Ping() error {
 	return nil
 }
 
+// ping creates the pinger if the Recorder was not created with New.
+func (r *Recorder) ping() error {
+	if r.pinger == nil {
+		options := []func(*pinger.Pinger) error{pinger.WithTimeout(r.MockTimeout)}
+		if r.client != nil {
+			options = append(options, pinger.WithClient(r.client))
+		}
+		p, err := pinger.New(r.MockEndpoint, options...)
+		if err != nil {
+			return err
+		}
+		r.pinger = p
+	}
+	return r.pinger.Ping()
+}
+
 // Record calls the RecordFunc if exists, otherwise continues as normal.
 func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
 	r.Smu.RLock()
@@ -95,7 +116,7 @@ func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
 	if err != nil {
 		return errors.Wrap(err, "generating payload")
 	}
-	res, err := http.Get(r.MockEndpoint)
+	res, err := ctxhttp.Get(ctx, r.client, r.MockEndpoint)
 	if err != nil {
 		return err
 	}
@@ -132,3 +153,6 @@ func (r *Recorder) Logger() tools.FieldLogger { return r.MockLog }
 
 // SetLogger sets the log of the recorder.
 func (r *Recorder) SetLogger(log tools.FieldLogger) { r.MockLog = log }
+
+// SetHTTPClient sets the http client of the recorder.
+func (r *Recorder) SetHTTPClient(client *http.Client) { r.client = client }
@@ -5,6 +5,7 @@
 package testing
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"sync"
 	"testing"
@@ -157,3 +158,8 @@ func (b *BaseConstruct) SetIndexName(indexName string) {
 func (b *BaseConstruct) SetTimeout(timeout time.Duration) {
 	b.add("timeout", recorder.WithTimeout(timeout))
 }
+
+// SetHTTPClient adds a HTTPClient value to setter configuration.
+func (b *BaseConstruct) SetHTTPClient(client *http.Client) {
+	b.add("httpClient", recorder.WithHTTPClient(client))
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package replay pushes archived documents through the recorders. It can be
+// used for backfilling the recorders after an outage.
+//
+// Input format
+//
+// The input is new line delimited json. Each line is a document as it is
+// generated by the datatype.DataContainer, therefore it should have a
+// "@timestamp" key in the datatype.TimeStampFormat format. The timestamp is
+// preserved when the document is recorded. If the document has a "_type" key,
+// it is used as the type name of the document and is removed from the payload:
+//
+//    {"@timestamp":"2017-01-02T15:04:05.999999+00:00","_type":"app","Alloc":12.5}
+//
+// Empty lines are ignored.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+const (
+	timestampKey = "@timestamp"
+	typeKey      = "_type"
+
+	// maxLineSize is the maximum size of a document.
+	maxLineSize = 10 * 1024 * 1024
+)
+
+var (
+	// ErrNoRecorder is returned when no recorders are provided.
+	ErrNoRecorder = fmt.Errorf("no recorder provided")
+
+	// ErrNoTimestamp is returned when the document doesn't have a timestamp.
+	ErrNoTimestamp = fmt.Errorf("document has no " + timestampKey)
+)
+
+// LineError is returned when a line of the input can't be replayed.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Replay records every document of r into all recorders. It uses typeName if
+// the document doesn't have a type. It returns the number of documents that
+// are recorded, and stops at the first error. The recorders should already be
+// pinged.
+func Replay(ctx context.Context, log tools.FieldLogger, r io.Reader, typeName string, recs ...recorder.DataRecorder) (int, error) {
+	if len(recs) == 0 {
+		return 0, ErrNoRecorder
+	}
+	var (
+		count int
+		line  int
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line++
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		job, err := parse(b, typeName)
+		if err != nil {
+			return count, LineError{line, err}
+		}
+		for _, rec := range recs {
+			job.IndexName = rec.IndexName()
+			if err = rec.Record(ctx, job); err != nil {
+				return count, LineError{line, errors.Wrap(err, rec.Name())}
+			}
+		}
+		count++
+		log.Debugf("replayed line %d", line)
+	}
+	if err := scanner.Err(); err != nil {
+		return count, errors.Wrap(err, "reading input")
+	}
+	return count, nil
+}
+
+// parse returns a Job with the timestamp of the document. The keys are sorted
+// because the order of a json object is not preserved.
+func parse(b []byte, typeName string) (recorder.Job, error) {
+	var (
+		doc map[string]json.RawMessage
+		job recorder.Job
+	)
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return job, err
+	}
+	raw, ok := doc[timestampKey]
+	if !ok {
+		return job, ErrNoTimestamp
+	}
+	var ts string
+	if err := json.Unmarshal(raw, &ts); err != nil {
+		return job, errors.Wrap(err, timestampKey)
+	}
+	t, err := time.Parse(datatype.TimeStampFormat, ts)
+	if err != nil {
+		return job, errors.Wrap(err, timestampKey)
+	}
+	delete(doc, timestampKey)
+	if raw, ok := doc[typeKey]; ok {
+		if err := json.Unmarshal(raw, &typeName); err != nil {
+			return job, errors.Wrap(err, typeKey)
+		}
+		delete(doc, typeKey)
+	}
+
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]datatype.DataType, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, datatype.NewRawType(k, doc[k]))
+	}
+	job.ID = token.NewUID()
+	job.Payload = datatype.New(list)
+	job.Time = t
+	job.TypeName = typeName
+	return job, nil
+}
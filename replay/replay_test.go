@@ -0,0 +1,146 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package replay_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/recorder"
+	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/replay"
+	"github.com/alext234/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+func newRecorder(name string, jobs *[]recorder.Job) *rct.Recorder {
+	return &rct.Recorder{
+		MockName:      name,
+		MockIndexName: name + "_index",
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			*jobs = append(*jobs, job)
+			return nil
+		},
+	}
+}
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+	var jobs1, jobs2 []recorder.Job
+	rec1 := newRecorder("rec1", &jobs1)
+	rec2 := newRecorder("rec2", &jobs2)
+	input := strings.NewReader(`{"@timestamp":"2017-01-02T15:04:05.5+00:00","b":[1,2],"a":"str"}
+
+{"@timestamp":"2017-01-02T15:04:06+00:00","_type":"other","c":{"d":1.5}}
+`)
+	n, err := replay.Replay(context.Background(), tools.DiscardLogger(), input, "app", rec1, rec2)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if n != 2 {
+		t.Errorf("n = (%d); want (2)", n)
+	}
+	if len(jobs1) != 2 || len(jobs2) != 2 {
+		t.Fatalf("len(jobs) = (%d, %d); want (2, 2)", len(jobs1), len(jobs2))
+	}
+
+	tcs := []struct {
+		job      recorder.Job
+		typeName string
+		time     time.Time
+		doc      string
+	}{
+		{jobs1[0], "app", time.Date(2017, 1, 2, 15, 4, 5, 5e8, time.UTC), `{"@timestamp":"2017-01-02T15:04:05.5+00:00","a":"str","b":[1,2]}`},
+		{jobs1[1], "other", time.Date(2017, 1, 2, 15, 4, 6, 0, time.UTC), `{"@timestamp":"2017-01-02T15:04:06+00:00","c":{"d":1.5}}`},
+	}
+	for i, tc := range tcs {
+		if tc.job.TypeName != tc.typeName {
+			t.Errorf("%d: TypeName = (%s); want (%s)", i, tc.job.TypeName, tc.typeName)
+		}
+		if !tc.job.Time.Equal(tc.time) {
+			t.Errorf("%d: Time = (%v); want (%v)", i, tc.job.Time, tc.time)
+		}
+		if tc.job.IndexName != "rec1_index" {
+			t.Errorf("%d: IndexName = (%s); want (rec1_index)", i, tc.job.IndexName)
+		}
+		buf := new(bytes.Buffer)
+		tc.job.Payload.Generate(buf, tc.job.Time.In(time.UTC))
+		if buf.String() != tc.doc {
+			t.Errorf("%d: document = (%s); want (%s)", i, buf.String(), tc.doc)
+		}
+	}
+	if jobs2[0].IndexName != "rec2_index" {
+		t.Errorf("IndexName = (%s); want (rec2_index)", jobs2[0].IndexName)
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	ctx := context.Background()
+	_, err := replay.Replay(ctx, log, strings.NewReader(""), "app")
+	if err != replay.ErrNoRecorder {
+		t.Errorf("err = (%v); want (%v)", err, replay.ErrNoRecorder)
+	}
+
+	var jobs []recorder.Job
+	rec := newRecorder("rec", &jobs)
+	tcs := []struct {
+		name  string
+		input string
+		count int
+		line  int
+	}{
+		{"bad json", `{"@timestamp":`, 0, 1},
+		{"no timestamp", `{"a":1}`, 0, 1},
+		{"bad timestamp", `{"@timestamp":1}`, 0, 1},
+		{"bad timestamp format", `{"@timestamp":"yesterday"}`, 0, 1},
+		{"bad type", `{"@timestamp":"2017-01-02T15:04:06+00:00","_type":1}`, 0, 1},
+		{"second line", "{\"@timestamp\":\"2017-01-02T15:04:06+00:00\"}\n{}", 1, 2},
+	}
+	for _, tc := range tcs {
+		n, err := replay.Replay(ctx, log, strings.NewReader(tc.input), "app", rec)
+		lineErr, ok := errors.Cause(err).(replay.LineError)
+		if !ok {
+			t.Errorf("%s: err = (%v); want (LineError)", tc.name, err)
+			continue
+		}
+		if lineErr.Line != tc.line {
+			t.Errorf("%s: Line = (%d); want (%d)", tc.name, lineErr.Line, tc.line)
+		}
+		if n != tc.count {
+			t.Errorf("%s: n = (%d); want (%d)", tc.name, n, tc.count)
+		}
+	}
+	if _, err = replay.Replay(ctx, log, strings.NewReader(`{"a":1}`), "app", rec); !strings.Contains(err.Error(), replay.ErrNoTimestamp.Error()) {
+		t.Errorf("err = (%v); want (%v)", err, replay.ErrNoTimestamp)
+	}
+}
+
+func TestReplayRecorderError(t *testing.T) {
+	t.Parallel()
+	errExample := errors.New("error example")
+	rec := &rct.Recorder{
+		MockName: "rec",
+		RecordFunc: func(context.Context, recorder.Job) error {
+			return errExample
+		},
+	}
+	input := strings.NewReader(`{"@timestamp":"2017-01-02T15:04:06+00:00"}`)
+	n, err := replay.Replay(context.Background(), tools.DiscardLogger(), input, "app", rec)
+	lineErr, ok := err.(replay.LineError)
+	if !ok {
+		t.Fatalf("err = (%v); want (LineError)", err)
+	}
+	if errors.Cause(lineErr.Err) != errExample {
+		t.Errorf("err = (%v); want (%v)", lineErr.Err, errExample)
+	}
+	if n != 0 {
+		t.Errorf("n = (%d); want (0)", n)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package chaos injects failures into the readers and recorders, for
+// verifying in the staging environments that the dashboards and the alerts
+// survive the failures of the pipeline. The readers and recorders are wrapped
+// in decorators that fail a share of the jobs, delay them, and corrupt their
+// payloads, as set in their Config:
+//
+//    recorders:
+//        elastic_staging:
+//            type: elasticsearch
+//            ...
+//            chaos:
+//                error_rate: 0.1     # one in ten jobs fails
+//                latency: 200ms      # every job is delayed
+//                jitter: 1s          # and by up to a second more
+//                corrupt_rate: 0.05  # one in twenty payloads is corrupted
+//
+// The injected errors are ErrInjected. Never use it in production.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrInjected is returned by the jobs that are failed on purpose.
+var ErrInjected = errors.New("chaos: injected failure")
+
+// injected counts the failures that are injected, labelled by their kinds.
+var injected = expvar.NewMap("Chaos Injected Failures")
+
+// Config holds the failures of a reader or a recorder. The rates are between
+// 0 and 1. The zero value does not inject any failures.
+type Config struct {
+	// ErrorRate is the share of the jobs that fail with ErrInjected.
+	ErrorRate float64 `mapstructure:"error_rate"`
+
+	// Latency delays every job.
+	Latency time.Duration `mapstructure:"latency"`
+
+	// Jitter delays every job by a random duration up to it, on top of the
+	// Latency.
+	Jitter time.Duration `mapstructure:"jitter"`
+
+	// CorruptRate is the share of the payloads that are corrupted. The
+	// contents of the readers are cut in half, therefore they are not valid
+	// json. The numbers of the payloads of the recorders are replaced with
+	// random numbers, therefore the recorded values are wrong.
+	CorruptRate float64 `mapstructure:"corrupt_rate"`
+}
+
+// Validate returns an error if any of the rates is not between 0 and 1, or
+// any of the durations is negative.
+func (c Config) Validate() error {
+	if c.ErrorRate < 0 || c.ErrorRate > 1 {
+		return fmt.Errorf("error_rate should be between 0 and 1: %v", c.ErrorRate)
+	}
+	if c.CorruptRate < 0 || c.CorruptRate > 1 {
+		return fmt.Errorf("corrupt_rate should be between 0 and 1: %v", c.CorruptRate)
+	}
+	if c.Latency < 0 || c.Jitter < 0 {
+		return errors.New("latency and jitter should not be negative")
+	}
+	return nil
+}
+
+// Enabled returns true if the c injects any failures.
+func (c Config) Enabled() bool {
+	return c != Config{}
+}
+
+// monkey draws the failures of the jobs.
+type monkey struct {
+	conf Config
+	mu   sync.Mutex
+	rand *rand.Rand // guarded by mu.
+}
+
+func newMonkey(c Config) *monkey {
+	return &monkey{conf: c, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// chance returns true with the probability of the rate.
+func (m *monkey) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rand.Float64() < rate
+}
+
+func (m *monkey) float64() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rand.Float64()
+}
+
+// delay waits for the Latency and the Jitter. It returns the error of the ctx
+// if it is done first.
+func (m *monkey) delay(ctx context.Context) error {
+	d := m.conf.Latency
+	if m.conf.Jitter > 0 {
+		m.mu.Lock()
+		d += time.Duration(m.rand.Int63n(int64(m.conf.Jitter)))
+		m.mu.Unlock()
+	}
+	if d <= 0 {
+		return nil
+	}
+	injected.Add("latency", 1)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fail returns ErrInjected with the probability of the ErrorRate.
+func (m *monkey) fail() error {
+	if m.chance(m.conf.ErrorRate) {
+		injected.Add("error", 1)
+		return ErrInjected
+	}
+	return nil
+}
+
+// corrupt returns true with the probability of the CorruptRate.
+func (m *monkey) corrupt() bool {
+	if m.chance(m.conf.CorruptRate) {
+		injected.Add("corrupt", 1)
+		return true
+	}
+	return false
+}
+
+// closeIfCloser closes v if it is an io.Closer.
+func closeIfCloser(v interface{}) error {
+	if c, ok := v.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
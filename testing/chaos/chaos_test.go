@@ -0,0 +1,224 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package chaos_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+	rdt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/recorder"
+	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/testing/chaos"
+	"github.com/alext234/expipe/tools/token"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tcs := []struct {
+		name    string
+		conf    chaos.Config
+		wantErr bool
+	}{
+		{"zero", chaos.Config{}, false},
+		{"all", chaos.Config{ErrorRate: 1, Latency: time.Second, Jitter: time.Second, CorruptRate: 0.5}, false},
+		{"error rate", chaos.Config{ErrorRate: 1.5}, true},
+		{"corrupt rate", chaos.Config{CorruptRate: -0.1}, true},
+		{"latency", chaos.Config{Latency: -time.Second}, true},
+		{"jitter", chaos.Config{Jitter: -time.Second}, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.conf.Validate()
+			if tc.wantErr && err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("err = (%v); want (nil)", err)
+			}
+		})
+	}
+	if (chaos.Config{}).Enabled() {
+		t.Error("Enabled() = (true); want (false)")
+	}
+}
+
+func newReader() *rdt.Reader {
+	red := &rdt.Reader{Pinged: true, MockName: "red", MockMapper: datatype.DefaultMapper()}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{ID: job.ID(), Content: []byte(`{"devil":666}`)}, nil
+	}
+	return red
+}
+
+func TestReader(t *testing.T) {
+	tcs := []struct {
+		name        string
+		conf        chaos.Config
+		wantErr     error
+		wantContent string
+	}{
+		{"passes", chaos.Config{}, nil, `{"devil":666}`},
+		{"fails", chaos.Config{ErrorRate: 1}, chaos.ErrInjected, ""},
+		{"corrupts", chaos.Config{CorruptRate: 1}, nil, `{"devi`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			red, err := chaos.NewReader(newReader(), tc.conf)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			res, err := red.Read(token.New(context.Background()))
+			if err != tc.wantErr {
+				t.Fatalf("err = (%v); want (%v)", err, tc.wantErr)
+			}
+			if err == nil && string(res.Content) != tc.wantContent {
+				t.Errorf("Content = (%s); want (%s)", res.Content, tc.wantContent)
+			}
+		})
+	}
+	if _, err := chaos.NewReader(newReader(), chaos.Config{ErrorRate: 2}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestReaderLatency(t *testing.T) {
+	red, err := chaos.NewReader(newReader(), chaos.Config{Latency: time.Hour})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = red.Read(token.New(ctx)); err != context.DeadlineExceeded {
+		t.Errorf("err = (%v); want (%v)", err, context.DeadlineExceeded)
+	}
+
+	red, err = chaos.NewReader(newReader(), chaos.Config{Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	start := time.Now()
+	if _, err = red.Read(token.New(context.Background())); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if took := time.Since(start); took < 20*time.Millisecond {
+		t.Errorf("took = (%s); want at least (20ms)", took)
+	}
+}
+
+type batchRecorder struct {
+	*rct.Recorder
+	jobs chan recorder.Job
+}
+
+func (b *batchRecorder) RecordBatch(ctx context.Context, jobs []recorder.Job) error {
+	for _, job := range jobs {
+		b.jobs <- job
+	}
+	return nil
+}
+
+func newJob() recorder.Job {
+	payload := datatype.New([]datatype.DataType{
+		datatype.NewFloatType("devil", 666),
+		datatype.NewStringType("name", "bob"),
+	})
+	payload.SetLabels(datatype.Labels{"env": "staging"})
+	return recorder.Job{ID: token.NewUID(), Payload: payload, Time: time.Now()}
+}
+
+func docOf(t *testing.T, payload datatype.DataContainer) map[string]interface{} {
+	buf := new(bytes.Buffer)
+	if _, err := payload.Generate(buf, time.Now()); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return doc
+}
+
+func TestRecorder(t *testing.T) {
+	jobs := make(chan recorder.Job, 10)
+	base := &rct.Recorder{
+		MockName: "rec",
+		Pinged:   true,
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			jobs <- job
+			return nil
+		},
+	}
+	rec, err := chaos.NewRecorder(base, chaos.Config{})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, ok := rec.(recorder.BatchRecorder); ok {
+		t.Error("the recorder is a BatchRecorder")
+	}
+	job := newJob()
+	if err = rec.Record(context.Background(), job); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got := <-jobs; got.Payload != job.Payload {
+		t.Error("the payload was changed")
+	}
+
+	rec, _ = chaos.NewRecorder(base, chaos.Config{ErrorRate: 1})
+	if err = rec.Record(context.Background(), newJob()); err != chaos.ErrInjected {
+		t.Errorf("err = (%v); want (%v)", err, chaos.ErrInjected)
+	}
+
+	rec, _ = chaos.NewRecorder(base, chaos.Config{CorruptRate: 1})
+	job = newJob()
+	if err = rec.Record(context.Background(), job); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	got := <-jobs
+	if f := job.Payload.List()[0].(*datatype.FloatType); f.Value != 666 {
+		t.Errorf("devil = (%v); want (666): the original payload was changed", f.Value)
+	}
+	doc := docOf(t, got.Payload)
+	if doc["devil"] == 666.0 || doc["name"] != "bob" {
+		t.Errorf("doc = (%v); want a random devil and bob", doc)
+	}
+	c := got.Payload.(*datatype.Container)
+	if want := (datatype.Labels{"env": "staging"}); !c.Labels().Equal(want) {
+		t.Errorf("Labels = (%v); want (%v)", c.Labels(), want)
+	}
+}
+
+func TestBatchRecorder(t *testing.T) {
+	base := &batchRecorder{
+		Recorder: &rct.Recorder{MockName: "rec", Pinged: true},
+		jobs:     make(chan recorder.Job, 10),
+	}
+	rec, err := chaos.NewRecorder(base, chaos.Config{})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	br, ok := rec.(recorder.BatchRecorder)
+	if !ok {
+		t.Fatal("the recorder is not a BatchRecorder")
+	}
+	if err = br.RecordBatch(context.Background(), []recorder.Job{newJob(), newJob()}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(base.jobs) != 2 {
+		t.Errorf("len(jobs) = (%d); want (2)", len(base.jobs))
+	}
+
+	rec, _ = chaos.NewRecorder(base, chaos.Config{ErrorRate: 1})
+	if err = rec.(recorder.BatchRecorder).RecordBatch(context.Background(), []recorder.Job{newJob()}); err != chaos.ErrInjected {
+		t.Errorf("err = (%v); want (%v)", err, chaos.ErrInjected)
+	}
+	if _, err = chaos.NewRecorder(base, chaos.Config{CorruptRate: 2}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
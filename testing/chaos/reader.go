@@ -0,0 +1,48 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package chaos
+
+import (
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/tools/token"
+)
+
+// Reader injects the failures of its Config into the reads of a DataReader.
+// The pings are not affected.
+type Reader struct {
+	reader.DataReader
+	monkey *monkey
+}
+
+// NewReader returns a Reader that wraps the red. It returns an error if the
+// conf is not valid.
+func NewReader(red reader.DataReader, conf Config) (*Reader, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return &Reader{DataReader: red, monkey: newMonkey(conf)}, nil
+}
+
+// Read delays the job, then either fails it or reads from the wrapped reader.
+// The content of the result might be corrupted.
+func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
+	if err := r.monkey.delay(job); err != nil {
+		return nil, err
+	}
+	if err := r.monkey.fail(); err != nil {
+		return nil, err
+	}
+	res, err := r.DataReader.Read(job)
+	if err != nil || res == nil {
+		return res, err
+	}
+	if r.monkey.corrupt() {
+		res.Content = res.Content[:len(res.Content)/2]
+	}
+	return res, nil
+}
+
+// Close closes the wrapped reader if it is an io.Closer.
+func (r *Reader) Close() error { return closeIfCloser(r.DataReader) }
@@ -0,0 +1,106 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package chaos
+
+import (
+	"context"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/recorder"
+)
+
+// Recorder injects the failures of its Config into the jobs of a
+// DataRecorder. The pings are not affected.
+type Recorder struct {
+	recorder.DataRecorder
+	monkey *monkey
+}
+
+// BatchRecorder is the Recorder of a recorder.BatchRecorder.
+type BatchRecorder struct {
+	*Recorder
+	batch recorder.BatchRecorder
+}
+
+// NewRecorder returns a Recorder that wraps the rec, or a BatchRecorder if the
+// rec is a recorder.BatchRecorder, therefore the Engine still sends it the
+// batches. It returns an error if the conf is not valid.
+func NewRecorder(rec recorder.DataRecorder, conf Config) (recorder.DataRecorder, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	r := &Recorder{DataRecorder: rec, monkey: newMonkey(conf)}
+	if br, ok := rec.(recorder.BatchRecorder); ok {
+		return &BatchRecorder{Recorder: r, batch: br}, nil
+	}
+	return r, nil
+}
+
+// Record delays the job, then either fails it or records it with the wrapped
+// recorder. The payload of the job might be corrupted.
+func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
+	if err := r.monkey.delay(ctx); err != nil {
+		return err
+	}
+	if err := r.monkey.fail(); err != nil {
+		return err
+	}
+	return r.DataRecorder.Record(ctx, r.corrupt(job))
+}
+
+// RecordBatch delays the batch, then either fails all of its jobs or records
+// them with the wrapped recorder. The payloads of the jobs might be corrupted.
+func (b *BatchRecorder) RecordBatch(ctx context.Context, jobs []recorder.Job) error {
+	if err := b.monkey.delay(ctx); err != nil {
+		return err
+	}
+	if err := b.monkey.fail(); err != nil {
+		return err
+	}
+	corrupted := make([]recorder.Job, len(jobs))
+	for i, job := range jobs {
+		corrupted[i] = b.corrupt(job)
+	}
+	return b.batch.RecordBatch(ctx, corrupted)
+}
+
+// corrupt returns the job with its numbers replaced with random numbers, with
+// the probability of the CorruptRate. The payload of the job is not changed.
+func (r *Recorder) corrupt(job recorder.Job) recorder.Job {
+	if !r.monkey.corrupt() {
+		return job
+	}
+	list := job.Payload.List()
+	values := make([]datatype.DataType, len(list))
+	for i, d := range list {
+		values[i] = d
+		if f, ok := d.(*datatype.FloatType); ok {
+			values[i] = datatype.NewFloatType(f.Key, r.monkey.float64()*1e9)
+		}
+	}
+	payload := datatype.New(values)
+	if c, ok := job.Payload.(*datatype.Container); ok {
+		payload.SetLabels(c.Labels())
+	}
+	job.Payload = payload
+	return job
+}
+
+// ReleasePayloads returns false, as the payloads of the corrupted jobs are not
+// the ones of the Engine.
+func (r *Recorder) ReleasePayloads() bool { return false }
+
+// ClockSkew returns the clock skew of the wrapped recorder if it is a
+// recorder.ClockSkewer.
+func (r *Recorder) ClockSkew() (time.Duration, bool) {
+	if cs, ok := r.DataRecorder.(recorder.ClockSkewer); ok {
+		return cs.ClockSkew()
+	}
+	return 0, false
+}
+
+// Close closes the wrapped recorder if it is an io.Closer.
+func (r *Recorder) Close() error { return closeIfCloser(r.DataRecorder) }
@@ -0,0 +1,198 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package alert notifies the operators when a reader or a recorder is failing.
+// An Event is sent to all Notifiers when the error streak of a component
+// reaches the threshold, when it recovers afterwards, and when it is removed
+// from the engine. The notifications are sent in the background, therefore
+// the jobs are not held by slow endpoints.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+)
+
+// DefaultThreshold is used when the ErrorThreshold of the Config is not set.
+const DefaultThreshold = 5
+
+// sendTimeout is the time a notifier has for sending an event.
+const sendTimeout = 10 * time.Second
+
+// Kinds of the events.
+const (
+	// Failing is sent when the error streak of a component reaches the
+	// threshold.
+	Failing = "failing"
+
+	// Recovered is sent when a failing component succeeds again.
+	Recovered = "recovered"
+
+	// Removed is sent when a component is removed from the engine.
+	Removed = "removed"
+)
+
+// Event describes what happened to a reader or a recorder.
+type Event struct {
+	Kind      string    `json:"kind"`
+	Component string    `json:"component"` // reader or recorder.
+	Name      string    `json:"name"`
+	Streak    int64     `json:"error_streak,omitempty"`
+	Err       string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Message returns a human readable description of the event.
+func (e Event) Message() string {
+	var msg string
+	switch e.Kind {
+	case Failing:
+		msg = fmt.Sprintf("%s %s has failed %d times in a row", e.Component, e.Name, e.Streak)
+	case Recovered:
+		msg = fmt.Sprintf("%s %s has recovered", e.Component, e.Name)
+	case Removed:
+		msg = fmt.Sprintf("%s %s has been removed from the engine", e.Component, e.Name)
+	default:
+		msg = fmt.Sprintf("%s %s: %s", e.Component, e.Name, e.Kind)
+	}
+	if e.Err != "" {
+		msg += ": " + e.Err
+	}
+	return msg
+}
+
+// Notifier sends the events to an endpoint.
+type Notifier interface {
+	Notify(context.Context, Event) error
+}
+
+// Config holds the settings of the notifiers. A Notifier is created for each
+// of the endpoints that is set.
+type Config struct {
+	// ErrorThreshold is the number of consecutive errors of a component that
+	// triggers a Failing event.
+	ErrorThreshold int64
+
+	// Webhook is the URL that receives the events in json.
+	Webhook string
+
+	// Slack is the URL of a Slack incoming webhook.
+	Slack string
+
+	// Email sends the events via SMTP if its Addr is set.
+	Email EmailConfig
+}
+
+// Dispatcher keeps track of the events and sends them to the notifiers. All
+// methods are safe to call on a nil Dispatcher.
+type Dispatcher struct {
+	log       tools.FieldLogger
+	threshold int64
+	notifiers []Notifier
+	wg        sync.WaitGroup
+}
+
+// New returns a Dispatcher with a Notifier for each endpoint of the c. It
+// returns nil if none of the endpoints are set.
+func New(log tools.FieldLogger, c Config) *Dispatcher {
+	var notifiers []Notifier
+	client := httpclient.Default()
+	if c.Webhook != "" {
+		notifiers = append(notifiers, &Webhook{URL: c.Webhook, Client: client})
+	}
+	if c.Slack != "" {
+		notifiers = append(notifiers, &Slack{URL: c.Slack, Client: client})
+	}
+	if c.Email.Addr != "" {
+		notifiers = append(notifiers, NewEmail(c.Email))
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+	return NewDispatcher(log, c.ErrorThreshold, notifiers...)
+}
+
+// NewDispatcher returns a Dispatcher that sends the events to the notifiers.
+// It uses DefaultThreshold if the threshold is not positive.
+func NewDispatcher(log tools.FieldLogger, threshold int64, notifiers ...Notifier) *Dispatcher {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	return &Dispatcher{
+		log:       log,
+		threshold: threshold,
+		notifiers: notifiers,
+	}
+}
+
+// Result reports the outcome of a job of a component. The prev streak is the
+// number of errors before this job and the streak is after it. A Failing event
+// is sent when the streak reaches the threshold, and a Recovered event is sent
+// on the first success after that.
+func (d *Dispatcher) Result(component, name string, prev, streak int64, err error) {
+	if d == nil {
+		return
+	}
+	switch {
+	case err != nil && streak == d.threshold:
+		d.Notify(Event{Kind: Failing, Component: component, Name: name, Streak: streak, Err: err.Error()})
+	case err == nil && prev >= d.threshold:
+		d.Notify(Event{Kind: Recovered, Component: component, Name: name})
+	}
+}
+
+// Removed sends a Removed event for the component.
+func (d *Dispatcher) Removed(component, name string, err error) {
+	if d == nil {
+		return
+	}
+	e := Event{Kind: Removed, Component: component, Name: name}
+	if err != nil {
+		e.Err = err.Error()
+	}
+	d.Notify(e)
+}
+
+// Notify sends the event to all notifiers in the background.
+func (d *Dispatcher) Notify(e Event) {
+	if d == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, n := range d.notifiers {
+		d.wg.Add(1)
+		go func(n Notifier) {
+			defer d.wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+			if err := n.Notify(ctx, e); err != nil {
+				d.log.Warnf("sending alert: %v", err)
+			}
+		}(n)
+	}
+}
+
+// Wait blocks until all notifications in flight are sent.
+func (d *Dispatcher) Wait() {
+	if d == nil {
+		return
+	}
+	d.wg.Wait()
+}
+
+// checkResponse returns an error if the endpoint didn't accept the request.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded with %s", resp.Request.URL.Host, resp.Status)
+	}
+	return nil
+}
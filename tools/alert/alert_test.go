@@ -0,0 +1,187 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package alert_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/alert"
+	"github.com/pkg/errors"
+)
+
+type notifier struct {
+	mu     sync.Mutex
+	events []alert.Event
+}
+
+func (n *notifier) Notify(ctx context.Context, e alert.Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, e)
+	return nil
+}
+
+func (n *notifier) kinds() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	kinds := make([]string, len(n.events))
+	for i, e := range n.events {
+		kinds[i] = e.Kind
+	}
+	return kinds
+}
+
+func TestNewWithoutEndpoints(t *testing.T) {
+	t.Parallel()
+	d := alert.New(tools.DiscardLogger(), alert.Config{ErrorThreshold: 3})
+	if d != nil {
+		t.Errorf("d = (%v); want (nil)", d)
+	}
+	// Should not panic.
+	d.Result("reader", "red1", 0, 3, errors.New("boom"))
+	d.Removed("reader", "red1", nil)
+	d.Wait()
+}
+
+func TestDispatcherResult(t *testing.T) {
+	t.Parallel()
+	n := &notifier{}
+	d := alert.NewDispatcher(tools.DiscardLogger(), 2, n)
+	err := errors.New("boom")
+
+	d.Result("reader", "red1", 0, 1, err)
+	d.Result("reader", "red1", 1, 2, err)
+	d.Result("reader", "red1", 2, 3, err)
+	d.Result("reader", "red1", 3, 0, nil)
+	d.Result("reader", "red1", 0, 0, nil)
+	d.Result("reader", "red1", 0, 1, err)
+	d.Result("reader", "red1", 1, 0, nil)
+	d.Wait()
+
+	kinds := n.kinds()
+	if len(kinds) != 2 {
+		t.Fatalf("len(kinds) = (%d); want (2): %v", len(kinds), kinds)
+	}
+	got := map[string]bool{kinds[0]: true, kinds[1]: true}
+	if !got[alert.Failing] || !got[alert.Recovered] {
+		t.Errorf("kinds = (%v); want (failing and recovered)", kinds)
+	}
+}
+
+func TestDispatcherDefaultThreshold(t *testing.T) {
+	t.Parallel()
+	n := &notifier{}
+	d := alert.NewDispatcher(tools.DiscardLogger(), 0, n)
+	for i := int64(1); i < alert.DefaultThreshold; i++ {
+		d.Result("recorder", "rec1", i-1, i, errors.New("boom"))
+	}
+	d.Wait()
+	if kinds := n.kinds(); len(kinds) != 0 {
+		t.Fatalf("kinds = (%v); want none", kinds)
+	}
+	d.Result("recorder", "rec1", alert.DefaultThreshold-1, alert.DefaultThreshold, errors.New("boom"))
+	d.Wait()
+	if kinds := n.kinds(); len(kinds) != 1 || kinds[0] != alert.Failing {
+		t.Errorf("kinds = (%v); want ([failing])", kinds)
+	}
+}
+
+func TestEventMessage(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		e    alert.Event
+		want string
+	}{
+		{alert.Event{Kind: alert.Failing, Component: "reader", Name: "red1", Streak: 3, Err: "boom"}, "reader red1 has failed 3 times in a row: boom"},
+		{alert.Event{Kind: alert.Recovered, Component: "recorder", Name: "rec1"}, "recorder rec1 has recovered"},
+		{alert.Event{Kind: alert.Removed, Component: "reader", Name: "red1"}, "reader red1 has been removed from the engine"},
+	}
+	for _, tc := range tcs {
+		if got := tc.e.Message(); got != tc.want {
+			t.Errorf("Message() = (%s); want (%s)", got, tc.want)
+		}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+	var got alert.Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("err = (%v); want (nil)", err)
+		}
+	}))
+	defer ts.Close()
+	w := &alert.Webhook{URL: ts.URL}
+	err := w.Notify(context.Background(), alert.Event{Kind: alert.Removed, Component: "reader", Name: "red1"})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got.Kind != alert.Removed || got.Name != "red1" {
+		t.Errorf("got = (%v); want (removed red1)", got)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	w := &alert.Webhook{URL: ts.URL, Client: http.DefaultClient}
+	err := w.Notify(context.Background(), alert.Event{Kind: alert.Removed})
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("err = (%v); want (500 status)", err)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	t.Parallel()
+	var got map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer ts.Close()
+	s := &alert.Slack{URL: ts.URL}
+	err := s.Notify(context.Background(), alert.Event{Kind: alert.Failing, Component: "recorder", Name: "rec1", Streak: 5})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !strings.Contains(got["text"], "recorder rec1 has failed 5 times") {
+		t.Errorf("text = (%s); want the message of the event", got["text"])
+	}
+}
+
+func TestNewSendsToAllEndpoints(t *testing.T) {
+	t.Parallel()
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+	d := alert.New(tools.DiscardLogger(), alert.Config{
+		Webhook: ts.URL + "/webhook",
+		Slack:   ts.URL + "/slack",
+	})
+	d.Removed("reader", "red1", errors.New("boom"))
+	d.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paths) != 2 {
+		t.Errorf("paths = (%v); want (/webhook and /slack)", paths)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Webhook posts the events in json to the URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify implements the Notifier interface.
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	return postJSON(ctx, w.Client, w.URL, e)
+}
+
+// Slack posts the message of the events to a Slack incoming webhook.
+type Slack struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify implements the Notifier interface.
+func (s *Slack) Notify(ctx context.Context, e Event) error {
+	return postJSON(ctx, s.Client, s.URL, map[string]string{"text": "expipe: " + e.Message()})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	return checkResponse(resp)
+}
+
+// EmailConfig holds the settings of the SMTP server and the recipients.
+type EmailConfig struct {
+	// Addr is the host:port of the SMTP server.
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Email sends the events to the recipients via SMTP. The PLAIN authentication
+// is used if the Username is set.
+type Email struct {
+	conf     EmailConfig
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmail returns an Email notifier with the c settings.
+func NewEmail(c EmailConfig) *Email {
+	return &Email{conf: c, sendMail: smtp.SendMail}
+}
+
+// Notify implements the Notifier interface. The ctx is not honoured once the
+// message is being sent.
+func (m *Email) Notify(ctx context.Context, e Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.conf.Username != "" {
+		host, _, err := net.SplitHostPort(m.conf.Addr)
+		if err != nil {
+			return errors.Wrap(err, "smtp address")
+		}
+		auth = smtp.PlainAuth("", m.conf.Username, m.conf.Password, host)
+	}
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", m.conf.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(m.conf.To, ", "))
+	fmt.Fprintf(msg, "Subject: [expipe] %s %s is %s\r\n", e.Component, e.Name, e.Kind)
+	fmt.Fprintf(msg, "Date: %s\r\n", e.Time.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(e.Message() + "\r\n")
+	return m.sendMail(m.conf.Addr, auth, m.conf.From, m.conf.To, msg.Bytes())
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package alert
+
+import (
+	"context"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailNotify(t *testing.T) {
+	t.Parallel()
+	var (
+		gotAddr string
+		gotAuth smtp.Auth
+		gotTo   []string
+		gotMsg  string
+	)
+	m := NewEmail(EmailConfig{
+		Addr:     "smtp.example.com:587",
+		Username: "expipe",
+		Password: "secret",
+		From:     "expipe@example.com",
+		To:       []string{"ops@example.com", "dev@example.com"},
+	})
+	m.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotAuth, gotTo, gotMsg = addr, a, to, string(msg)
+		return nil
+	}
+	e := Event{Kind: Failing, Component: "reader", Name: "red1", Streak: 5, Err: "boom", Time: time.Now()}
+	if err := m.Notify(context.Background(), e); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if gotAddr != "smtp.example.com:587" {
+		t.Errorf("addr = (%s); want (smtp.example.com:587)", gotAddr)
+	}
+	if gotAuth == nil {
+		t.Error("auth = (nil); want PLAIN auth")
+	}
+	if !reflect.DeepEqual(gotTo, []string{"ops@example.com", "dev@example.com"}) {
+		t.Errorf("to = (%v); want both recipients", gotTo)
+	}
+	for _, want := range []string{"Subject: [expipe] reader red1 is failing", "To: ops@example.com, dev@example.com", e.Message()} {
+		if !strings.Contains(gotMsg, want) {
+			t.Errorf("msg = (%s); want (%s)", gotMsg, want)
+		}
+	}
+}
+
+func TestEmailNotifyWithoutAuth(t *testing.T) {
+	t.Parallel()
+	var gotAuth smtp.Auth
+	m := NewEmail(EmailConfig{Addr: "localhost:25", From: "a@example.com", To: []string{"b@example.com"}})
+	m.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAuth = a
+		return nil
+	}
+	if err := m.Notify(context.Background(), Event{Kind: Removed}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if gotAuth != nil {
+		t.Errorf("auth = (%v); want (nil)", gotAuth)
+	}
+}
+
+func TestEmailNotifyCancelled(t *testing.T) {
+	t.Parallel()
+	var called bool
+	m := NewEmail(EmailConfig{Addr: "localhost:25"})
+	m.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		called = true
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Notify(ctx, Event{Kind: Removed}); err != context.Canceled {
+		t.Errorf("err = (%v); want (context.Canceled)", err)
+	}
+	if called {
+		t.Error("the email was sent")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity limit of the buffers that are put back in
+// the pool. Larger buffers are left for the garbage collector, otherwise a few
+// large payloads would hold on to a lot of memory.
+const maxPooledBuffer = 1 << 20
+
+var bufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// GetBuffer returns an empty buffer from the pool. You should put it back
+// with PutBuffer when you are done with it, and you should not hold on to its
+// contents afterwards.
+func GetBuffer() *bytes.Buffer {
+	return bufPool.Get().(*bytes.Buffer)
+}
+
+// PutBuffer resets the buf and puts it back in the pool.
+func PutBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufPool.Put(buf)
+}
+
+// ReadAll reads from r into a pooled buffer and returns a copy of the content
+// with the exact size. It saves the allocations of growing a new buffer on
+// each call.
+func ReadAll(r io.Reader) ([]byte, error) {
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	content := make([]byte, buf.Len())
+	copy(content, buf.Bytes())
+	return content, nil
+}
+
+// ReadAllSize reads the size bytes of r into a slice of that size, without
+// the copy of ReadAll. The size is usually the Content-Length of a response.
+// If the size is negative it returns ReadAll(r), and if r has more bytes than
+// the size, they are appended to the content.
+func ReadAllSize(r io.Reader, size int64) ([]byte, error) {
+	if size < 0 {
+		return ReadAll(r)
+	}
+	content := make([]byte, size)
+	n, err := io.ReadFull(r, content)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return content[:n], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rest, err := ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return append(content, rest...), nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+func TestGetBufferIsEmpty(t *testing.T) {
+	buf := GetBuffer()
+	buf.WriteString("some content")
+	PutBuffer(buf)
+	buf = GetBuffer()
+	defer PutBuffer(buf)
+	if buf.Len() != 0 {
+		t.Errorf("buf.Len() = (%d); want (0)", buf.Len())
+	}
+}
+
+func TestPutBufferDropsLargeBuffers(t *testing.T) {
+	buf := bytes.NewBuffer(make([]byte, 0, maxPooledBuffer+1))
+	buf.WriteString("some content")
+	PutBuffer(buf)
+	if buf.Len() == 0 {
+		t.Error("large buffer was reset; want it left alone")
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	t.Parallel()
+	input := []byte(`{"alloc":1,"memstats":{"Alloc":1}}`)
+	content, err := ReadAll(bytes.NewReader(input))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !bytes.Equal(content, input) {
+		t.Errorf("content = (%s); want (%s)", content, input)
+	}
+	if cap(content) != len(input) {
+		t.Errorf("cap(content) = (%d); want (%d)", cap(content), len(input))
+	}
+
+	// the content should not be affected by the reuse of the buffer.
+	other, err := ReadAll(bytes.NewReader([]byte(`{"other":2}`)))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !bytes.Equal(content, input) {
+		t.Errorf("content = (%s); want (%s)", content, input)
+	}
+	if string(other) != `{"other":2}` {
+		t.Errorf("other = (%s); want (%s)", other, `{"other":2}`)
+	}
+}
+
+func TestReadAllError(t *testing.T) {
+	t.Parallel()
+	wantErr := errors.New("read error")
+	content, err := ReadAll(errReader{wantErr})
+	if err != wantErr {
+		t.Errorf("err = (%v); want (%v)", err, wantErr)
+	}
+	if content != nil {
+		t.Errorf("content = (%s); want (nil)", content)
+	}
+}
+
+func TestReadAllSize(t *testing.T) {
+	t.Parallel()
+	input := []byte(`{"alloc":1,"memstats":{"Alloc":1}}`)
+	tcs := []struct {
+		name string
+		size int64
+	}{
+		{"exact", int64(len(input))},
+		{"unknown", -1},
+		{"shorter", int64(len(input)) + 10},
+		{"longer", 5},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := ReadAllSize(bytes.NewReader(input), tc.size)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if !bytes.Equal(content, input) {
+				t.Errorf("content = (%s); want (%s)", content, input)
+			}
+		})
+	}
+
+	wantErr := errors.New("read error")
+	if _, err := ReadAllSize(errReader{wantErr}, 10); err != wantErr {
+		t.Errorf("err = (%v); want (%v)", err, wantErr)
+	}
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	input := bytes.Repeat([]byte(`{"alloc":1,"memstats":{"Alloc":1}},`), 1000)
+	r := bytes.NewReader(input)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Seek(0, io.SeekStart)
+		ReadAll(r)
+	}
+}
+
+func BenchmarkReadAllSize(b *testing.B) {
+	input := bytes.Repeat([]byte(`{"alloc":1,"memstats":{"Alloc":1}},`), 1000)
+	r := bytes.NewReader(input)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Seek(0, io.SeekStart)
+		ReadAllSize(r, int64(len(input)))
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package cluster lets multiple expipe instances share the readers between
+// themselves. Each instance is a peer on a consistent hash Ring, and a reader
+// is owned by the peer its name is hashed to. All peers should be started
+// with the same list of peers, therefore they agree on the owners without
+// talking to each other, and each reader is scraped by exactly one instance.
+//
+// When a peer is added or removed from the list, only the readers of that
+// peer are moved to other peers.
+package cluster
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas is the number of virtual nodes of each peer on the ring.
+const DefaultReplicas = 100
+
+// ErrNoPeers is returned when the Ring is created without any peers.
+var ErrNoPeers = fmt.Errorf("no peers provided")
+
+// DuplicatePeerError is returned when a peer is provided more than once.
+type DuplicatePeerError string
+
+func (e DuplicatePeerError) Error() string {
+	return fmt.Sprintf("duplicate peer: %s", string(e))
+}
+
+// Ring is a consistent hash ring of peers. It is immutable after creation,
+// therefore it is concurrent safe.
+type Ring struct {
+	hashes hashes
+	owners map[uint32]string
+	peers  map[string]bool
+}
+
+// NewRing returns a Ring with replicas virtual nodes for each peer. It uses
+// DefaultReplicas if replicas is not positive.
+func NewRing(replicas int, peers ...string) (*Ring, error) {
+	if len(peers) == 0 {
+		return nil, ErrNoPeers
+	}
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	r := &Ring{
+		hashes: make(hashes, 0, len(peers)*replicas),
+		owners: make(map[uint32]string, len(peers)*replicas),
+		peers:  make(map[string]bool, len(peers)),
+	}
+	for _, peer := range peers {
+		if r.peers[peer] {
+			return nil, DuplicatePeerError(peer)
+		}
+		r.peers[peer] = true
+		for i := 0; i < replicas; i++ {
+			h := hash(strconv.Itoa(i) + peer)
+			if _, ok := r.owners[h]; ok {
+				// collisions are rare, the first peer keeps the node.
+				continue
+			}
+			r.owners[h] = peer
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Sort(r.hashes)
+	return r, nil
+}
+
+// Owner returns the peer that owns the key.
+func (r *Ring) Owner(key string) string {
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// Owns returns true if the key is owned by the peer.
+func (r *Ring) Owns(peer, key string) bool {
+	return r.Owner(key) == peer
+}
+
+// HasPeer returns true if the peer is on the ring.
+func (r *Ring) HasPeer(peer string) bool {
+	return r.peers[peer]
+}
+
+func hash(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
+
+// hashes implements the sort.Interface.
+type hashes []uint32
+
+func (h hashes) Len() int           { return len(h) }
+func (h hashes) Less(i, j int) bool { return h[i] < h[j] }
+func (h hashes) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
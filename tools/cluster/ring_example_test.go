@@ -0,0 +1,24 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package cluster_test
+
+import (
+	"fmt"
+
+	"github.com/alext234/expipe/tools/cluster"
+)
+
+func ExampleRing_Owner() {
+	r, err := cluster.NewRing(0, "node1", "node2")
+	if err != nil {
+		panic(err)
+	}
+	owner := r.Owner("app_0")
+	fmt.Println(r.HasPeer(owner))
+	fmt.Println(r.Owns(owner, "app_0"))
+	// Output:
+	// true
+	// true
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package cluster_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alext234/expipe/tools/cluster"
+)
+
+func TestNewRingErrors(t *testing.T) {
+	t.Parallel()
+	r, err := cluster.NewRing(0)
+	if err != cluster.ErrNoPeers {
+		t.Errorf("err = (%v); want (%v)", err, cluster.ErrNoPeers)
+	}
+	if r != nil {
+		t.Errorf("r = (%v); want (nil)", r)
+	}
+	r, err = cluster.NewRing(0, "a", "b", "a")
+	if _, ok := err.(cluster.DuplicatePeerError); !ok {
+		t.Errorf("err = (%T); want (DuplicatePeerError)", err)
+	}
+	if r != nil {
+		t.Errorf("r = (%v); want (nil)", r)
+	}
+}
+
+func TestRingOwnerIsStable(t *testing.T) {
+	t.Parallel()
+	r1, err := cluster.NewRing(0, "a", "b", "c")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	// the order of peers should not matter.
+	r2, err := cluster.NewRing(0, "c", "a", "b")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("reader%d", i)
+		o1, o2 := r1.Owner(key), r2.Owner(key)
+		if o1 != o2 {
+			t.Errorf("Owner(%s) = (%s) and (%s); want the same", key, o1, o2)
+		}
+		if !r1.HasPeer(o1) {
+			t.Errorf("HasPeer(%s) = (false); want (true)", o1)
+		}
+		if !r1.Owns(o1, key) {
+			t.Errorf("Owns(%s, %s) = (false); want (true)", o1, key)
+		}
+	}
+}
+
+func TestRingDistribution(t *testing.T) {
+	t.Parallel()
+	peers := []string{"a", "b", "c"}
+	r, err := cluster.NewRing(0, peers...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	total := 3000
+	counts := make(map[string]int)
+	for i := 0; i < total; i++ {
+		counts[r.Owner(fmt.Sprintf("reader%d", i))]++
+	}
+	for _, peer := range peers {
+		if counts[peer] < total/len(peers)/2 {
+			t.Errorf("counts[%s] = (%d); want a fair share of (%d)", peer, counts[peer], total)
+		}
+	}
+}
+
+func TestRingRemovingPeerMovesOnlyItsKeys(t *testing.T) {
+	t.Parallel()
+	r1, _ := cluster.NewRing(0, "a", "b", "c")
+	r2, _ := cluster.NewRing(0, "a", "b")
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("reader%d", i)
+		o1 := r1.Owner(key)
+		if o1 == "c" {
+			continue
+		}
+		if o2 := r2.Owner(key); o1 != o2 {
+			t.Errorf("Owner(%s) = (%s); want (%s)", key, o2, o1)
+		}
+	}
+}
+
+func TestRingHasPeer(t *testing.T) {
+	t.Parallel()
+	r, _ := cluster.NewRing(1, "a")
+	if !r.HasPeer("a") {
+		t.Error("HasPeer(a) = (false); want (true)")
+	}
+	if r.HasPeer("b") {
+		t.Error("HasPeer(b) = (true); want (false)")
+	}
+	if owner := r.Owner("anything"); owner != "a" {
+		t.Errorf("Owner() = (%s); want (a)", owner)
+	}
+}
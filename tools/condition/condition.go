@@ -0,0 +1,152 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package condition decides whether a document is worth recording by comparing
+// its fields with the last recorded document of the route. It is used for the
+// mostly static values, for example the configuration of an application, that
+// are only interesting when they change.
+package condition
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Rule matches a document when its field crosses the Threshold, or when it
+// changes by more than Change percent of the last recorded value. Only one of
+// them should be set. The values that are not numbers match the Change rules
+// on any change.
+type Rule struct {
+	Field     string
+	Threshold *float64
+	Change    *float64
+}
+
+// Condition matches the documents that any of its rules match, compared to the
+// last document it has matched. The first document is always matched. It is
+// concurrent safe.
+type Condition struct {
+	rules []Rule
+	mu    sync.Mutex
+	last  map[string]interface{} // guarded by mu; nil until the first match.
+}
+
+// New returns a Condition with the rules. It returns an error if there are no
+// rules, or if any of them does not have a field or has none or both of the
+// Threshold and Change.
+func New(rules ...Rule) (*Condition, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("no rules")
+	}
+	for i, r := range rules {
+		if r.Field == "" {
+			return nil, fmt.Errorf("rule %d: empty field", i)
+		}
+		if (r.Threshold == nil) == (r.Change == nil) {
+			return nil, fmt.Errorf("rule %d: either threshold or change should be set", i)
+		}
+		if r.Change != nil && *r.Change < 0 {
+			return nil, fmt.Errorf("rule %d: change cannot be negative", i)
+		}
+	}
+	return &Condition{rules: rules}, nil
+}
+
+// Match returns true if the json content should be recorded, and remembers
+// its values for the next calls. The contents that can not be decoded are
+// matched, therefore their errors are not hidden from the recorders. The
+// fields that are missing from the content do not match.
+func (c *Condition) Match(content []byte) bool {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return true
+	}
+	values := make(map[string]interface{}, len(c.rules))
+	for _, r := range c.rules {
+		if v, ok := lookup(doc, strings.Split(r.Field, ".")); ok {
+			values[r.Field] = v
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != nil && !c.match(values) {
+		return false
+	}
+	if c.last == nil {
+		c.last = make(map[string]interface{}, len(values))
+	}
+	for field, v := range values {
+		c.last[field] = v
+	}
+	return true
+}
+
+// match returns true if any of the rules match the values. It should be
+// called with the mu locked.
+func (c *Condition) match(values map[string]interface{}) bool {
+	for _, r := range c.rules {
+		cur, ok := values[r.Field]
+		if !ok {
+			continue
+		}
+		prev, ok := c.last[r.Field]
+		if !ok {
+			return true
+		}
+		p, pNum := prev.(float64)
+		n, nNum := cur.(float64)
+		if !pNum || !nNum {
+			if r.Change != nil && !reflect.DeepEqual(prev, cur) {
+				return true
+			}
+			continue
+		}
+		if r.Threshold != nil && (p > *r.Threshold) != (n > *r.Threshold) {
+			return true
+		}
+		if r.Change != nil && changed(p, n, *r.Change) {
+			return true
+		}
+	}
+	return false
+}
+
+// changed returns true if n is more than percent away from p.
+func changed(p, n, percent float64) bool {
+	if p == 0 {
+		return n != 0
+	}
+	return math.Abs(n-p)/math.Abs(p)*100 > percent
+}
+
+// lookup returns the value at the dotted path of the doc. The keys of the doc
+// can have dots, therefore the longest matching key is tried first. The
+// objects of a value and its labels are replaced by their values.
+func lookup(doc map[string]interface{}, parts []string) (interface{}, bool) {
+	for i := len(parts); i > 0; i-- {
+		v, ok := doc[strings.Join(parts[:i], ".")]
+		if !ok {
+			continue
+		}
+		m, isMap := v.(map[string]interface{})
+		if i == len(parts) {
+			if value, ok := m["value"]; isMap && ok {
+				return value, true
+			}
+			return v, true
+		}
+		if isMap {
+			if v, ok := lookup(m, parts[i:]); ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
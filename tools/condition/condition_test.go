@@ -0,0 +1,100 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package condition_test
+
+import (
+	"testing"
+
+	"github.com/alext234/expipe/tools/condition"
+)
+
+func float(f float64) *float64 { return &f }
+
+func TestNew(t *testing.T) {
+	tcs := []struct {
+		name  string
+		rules []condition.Rule
+	}{
+		{"no rules", nil},
+		{"empty field", []condition.Rule{{Threshold: float(1)}}},
+		{"neither", []condition.Rule{{Field: "a"}}},
+		{"both", []condition.Rule{{Field: "a", Threshold: float(1), Change: float(1)}}},
+		{"negative change", []condition.Rule{{Field: "a", Change: float(-1)}}},
+	}
+	for _, tc := range tcs {
+		if _, err := condition.New(tc.rules...); err == nil {
+			t.Errorf("%s: err = (nil); want (error)", tc.name)
+		}
+	}
+}
+
+func TestMatchThreshold(t *testing.T) {
+	c, err := condition.New(condition.Rule{Field: "memstats.Alloc", Threshold: float(100)})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		content string
+		want    bool
+	}{
+		{`{"memstats":{"Alloc":10}}`, true}, // the first document.
+		{`{"memstats":{"Alloc":90}}`, false},
+		{`{"memstats":{"Alloc":110}}`, true},
+		{`{"memstats":{"Alloc":150}}`, false},
+		{`{"memstats":{"Frees":1}}`, false},
+		{`{"memstats":{"Alloc":100}}`, true},
+		{`{"memstats":{"Alloc":50}}`, false},
+	}
+	for i, tc := range tcs {
+		if got := c.Match([]byte(tc.content)); got != tc.want {
+			t.Errorf("%d: Match(%s) = (%t); want (%t)", i, tc.content, got, tc.want)
+		}
+	}
+}
+
+func TestMatchChange(t *testing.T) {
+	c, err := condition.New(
+		condition.Rule{Field: "goroutines", Change: float(10)},
+		condition.Rule{Field: "config.version", Change: float(0)},
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		content string
+		want    bool
+	}{
+		{`{"goroutines":100,"config.version":"v1"}`, true},
+		{`{"goroutines":105,"config.version":"v1"}`, false},
+		{`{"goroutines":109,"config.version":"v1"}`, false}, // compared to the last recorded.
+		{`{"goroutines":111,"config.version":"v1"}`, true},
+		{`{"goroutines":111,"config.version":"v2"}`, true},
+		{`{"goroutines":{"value":111,"labels":{"pool":"a"}},"config.version":"v2"}`, false},
+		{`{"goroutines":0,"config.version":"v2"}`, true},
+		{`{"goroutines":1,"config.version":"v2"}`, true},
+		{`not json`, true},
+	}
+	for i, tc := range tcs {
+		if got := c.Match([]byte(tc.content)); got != tc.want {
+			t.Errorf("%d: Match(%s) = (%t); want (%t)", i, tc.content, got, tc.want)
+		}
+	}
+}
+
+func TestMatchNewField(t *testing.T) {
+	c, err := condition.New(condition.Rule{Field: "version", Change: float(0)})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !c.Match([]byte(`{"uptime":1}`)) {
+		t.Error("Match() = (false); want (true) for the first document")
+	}
+	if !c.Match([]byte(`{"version":"v1"}`)) {
+		t.Error("Match() = (false); want (true) when the field appears")
+	}
+	if c.Match([]byte(`{"version":"v1"}`)) {
+		t.Error("Match() = (true); want (false)")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/testing/chaos"
+	"github.com/alext234/expipe/tools"
+	"github.com/spf13/viper"
+)
+
+// chaosSection holds the keys of the chaos section of the readers and
+// recorders, for the schema.
+type chaosSection struct {
+	Chaos chaos.Config `mapstructure:"chaos"`
+}
+
+// chaosConfig returns the chaos section under the key, and false if it is not
+// set or does not inject any failures.
+func chaosConfig(v *viper.Viper, section, name string) (chaos.Config, bool, error) {
+	var conf chaos.Config
+	key := section + "." + name + ".chaos"
+	if !v.IsSet(key) {
+		return conf, false, nil
+	}
+	if err := v.UnmarshalKey(key, &conf); err != nil {
+		return conf, false, &StructureErr{section, name + ": chaos", err}
+	}
+	if err := conf.Validate(); err != nil {
+		return conf, false, &StructureErr{section, name + ": chaos", err}
+	}
+	return conf, conf.Enabled(), nil
+}
+
+// chaosReader wraps the red in a chaos.Reader if it has a chaos section.
+func chaosReader(v *viper.Viper, log tools.FieldLogger, name string, red reader.DataReader) (reader.DataReader, error) {
+	conf, ok, err := chaosConfig(v, "readers", name)
+	if err != nil || !ok {
+		return red, err
+	}
+	log.Warnf("injecting failures into reader (%s): %+v", name, conf)
+	return chaos.NewReader(red, conf)
+}
+
+// chaosRecorder wraps the rec in a chaos.Recorder if it has a chaos section.
+func chaosRecorder(v *viper.Viper, log tools.FieldLogger, name string, rec recorder.DataRecorder) (recorder.DataRecorder, error) {
+	conf, ok, err := chaosConfig(v, "recorders", name)
+	if err != nil || !ok {
+		return rec, err
+	}
+	log.Warnf("injecting failures into recorder (%s): %+v", name, conf)
+	return chaos.NewRecorder(rec, conf)
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alext234/expipe/tools/condition"
+	"github.com/pkg/errors"
+)
+
+// conditionKeys are the keys of the rules of the record_when lists.
+var conditionKeys = []string{"field", "threshold", "change"}
+
+// routeConditions returns the conditions of the routes that have record_when
+// rules, keyed by the reader and then the recorder names. Each reader and
+// recorder pair has its own condition, as it compares the results with the
+// last one recorded into the recorder. A reader and a recorder can be paired
+// in only one of the routes that have conditions.
+func routeConditions(routes routeMap) (map[string]map[string]*condition.Condition, error) {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make(map[string]map[string]*condition.Condition)
+	owners := make(map[string]string)
+	for _, name := range names {
+		rt := routes[name]
+		if rt.recordWhen == nil {
+			continue
+		}
+		rules, err := parseRules(rt.recordWhen)
+		if err == nil {
+			_, err = condition.New(rules...)
+		}
+		if err != nil {
+			return nil, NewRoutersError(name, "record_when", err)
+		}
+		for _, red := range rt.readers {
+			for _, rec := range rt.recorders {
+				pair := red + " -> " + rec
+				if owner, ok := owners[pair]; ok {
+					return nil, NewRoutersError(name, "record_when of "+pair+" is already set in "+owner, nil)
+				}
+				owners[pair] = name
+				if result[red] == nil {
+					result[red] = make(map[string]*condition.Condition)
+				}
+				result[red][rec], _ = condition.New(rules...)
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseRules returns the rules of a record_when list. The change can be a
+// number or a percentage, for example 10%.
+func parseRules(value interface{}) ([]condition.Rule, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("should be a list")
+	}
+	rules := make([]condition.Rule, 0, len(list))
+	for i, item := range list {
+		m, ok := toStringMap(item)
+		if !ok {
+			return nil, fmt.Errorf("rule %d should be a map", i)
+		}
+		var r condition.Rule
+		for key, v := range m {
+			var err error
+			switch key {
+			case "field":
+				r.Field = fmt.Sprint(v)
+			case "threshold":
+				r.Threshold, err = ruleNumber(v)
+			case "change":
+				r.Change, err = ruleNumber(v)
+			default:
+				err = fmt.Errorf("unknown key %s, the keys are %s", key, strings.Join(conditionKeys, ", "))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %s", i, err)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func ruleNumber(v interface{}) (*float64, error) {
+	s := strings.TrimSuffix(strings.TrimSpace(fmt.Sprint(v)), "%")
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%v is not a number", v)
+	}
+	return &f, nil
+}
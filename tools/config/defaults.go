@@ -0,0 +1,86 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// NamePlaceholder is replaced with the name of the reader or recorder in the
+// string values of the defaults section.
+const NamePlaceholder = "{name}"
+
+// applyDefaults copies the values of the defaults section into the readers and
+// recorders that have not set them. The keys of the defaults section apply to
+// both readers and recorders, and its readers and recorders sub sections only
+// apply to them and take precedence. The v should not be shared with the
+// caller as the sections are replaced.
+func applyDefaults(v *viper.Viper) error {
+	defaults, ok := toStringMap(v.Get("defaults"))
+	if !ok {
+		return &StructureErr{"defaults", "should be a map", nil}
+	}
+	common := make(map[string]interface{}, len(defaults))
+	for key, value := range defaults {
+		if key != "readers" && key != "recorders" {
+			common[key] = value
+		}
+	}
+	for _, section := range []string{"readers", "recorders"} {
+		values := make(map[string]interface{}, len(common))
+		for key, value := range common {
+			values[key] = value
+		}
+		if sub, ok := defaults[section]; ok {
+			m, ok := toStringMap(sub)
+			if !ok {
+				return &StructureErr{"defaults", section + " should be a map", nil}
+			}
+			for key, value := range m {
+				values[key] = value
+			}
+		}
+		if len(values) == 0 || !v.IsSet(section) {
+			continue
+		}
+		blocks := v.GetStringMap(section)
+		for name, block := range blocks {
+			m, ok := toStringMap(block)
+			if !ok {
+				return &StructureErr{section, fmt.Sprintf("%s should be a map", name), nil}
+			}
+			merged := make(map[string]interface{}, len(m)+len(values))
+			for key, value := range values {
+				if s, ok := value.(string); ok {
+					value = strings.Replace(s, NamePlaceholder, name, -1)
+				}
+				merged[key] = value
+			}
+			for key, value := range m {
+				merged[key] = value
+			}
+			blocks[name] = merged
+		}
+		v.Set(section, blocks)
+	}
+	return nil
+}
+
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		sm := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			sm[fmt.Sprint(k)] = v
+		}
+		return sm, true
+	}
+	return nil, false
+}
@@ -0,0 +1,30 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/alext234/expipe/tools/drift"
+	"github.com/spf13/viper"
+)
+
+// readerDrifts returns the schema drift detectors of the readers that set
+// schema_drift, keyed by the reader names.
+func readerDrifts(v *viper.Viper, readerKeys map[string]string) (map[string]*drift.Detector, error) {
+	result := make(map[string]*drift.Detector)
+	for _, name := range sortedKeys(readerKeys) {
+		key := "readers." + name + ".schema_drift"
+		if !v.IsSet(key) {
+			continue
+		}
+		d, err := drift.Parse(fmt.Sprint(v.Get(key)))
+		if err != nil {
+			return nil, &StructureErr{"readers", name + ": schema_drift", err}
+		}
+		result[name] = d
+	}
+	return result, nil
+}
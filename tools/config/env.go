@@ -0,0 +1,75 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/spf13/viper"
+)
+
+// expandEnv returns a new viper instance with the environment variables
+// expanded in all string values of v. The v is not modified, therefore it can
+// be read into again.
+func expandEnv(v *viper.Viper) (*viper.Viper, error) {
+	nv := viper.New()
+	for key, value := range v.AllSettings() {
+		expanded, err := expandValue(value)
+		if err != nil {
+			return nil, &StructureErr{key, "expanding environment variables", err}
+		}
+		nv.Set(key, expanded)
+	}
+	return nv, nil
+}
+
+func expandValue(value interface{}) (interface{}, error) {
+	switch val := value.(type) {
+	case string:
+		return tools.ExpandEnv(val)
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			e, err := expandValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = e
+		}
+		return list, nil
+	case []string:
+		list := make([]string, len(val))
+		for i, item := range val {
+			e, err := tools.ExpandEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = e
+		}
+		return list, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			e, err := expandValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = e
+		}
+		return m, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			e, err := expandValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = e
+		}
+		return m, nil
+	}
+	return value, nil
+}
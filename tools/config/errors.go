@@ -94,3 +94,29 @@ type NotSupportedError string
 func (n NotSupportedError) Error() string {
 	return fmt.Sprintf("%s is not supported", string(n))
 }
+
+// UnknownKeyError is returned when a key of the configuration is not known,
+// which is usually a typo. The File and Line are set if the key is found in
+// the configuration files, and the Suggestion is set if there is a known key
+// with a similar name.
+type UnknownKeyError struct {
+	Key        string // The full key, for example readers.app.intervall.
+	File       string
+	Line       int
+	Suggestion string
+}
+
+func (e *UnknownKeyError) Error() string {
+	if e == nil {
+		return NilStr
+	}
+
+	s := "unknown key " + e.Key
+	if e.Line > 0 {
+		s += fmt.Sprintf(" at %s:%d", e.File, e.Line)
+	}
+	if e.Suggestion != "" {
+		s += ", did you mean " + e.Suggestion + "?"
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// fallbackKey is the key of the items of the recorders of a route that are the
+// fallbacks of the recorders listed before them.
+const fallbackKey = "fallback"
+
+// routeRecorders returns the recorders of a route, and the fallbacks of them
+// keyed by the names of their primary recorders. A fallback is a map item of
+// the list, for example:
+//
+//	recorders:
+//	    - primary_es
+//	    - fallback: backup_es
+//
+// and it is the fallback of the recorder listed before it. The fallbacks are
+// in the returned recorders as well. Neither the primaries nor the fallbacks
+// can be patterns.
+func routeRecorders(value interface{}) ([]string, map[string]string, error) {
+	var list []interface{}
+	switch v := value.(type) {
+	case string:
+		list = []interface{}{v}
+	case []interface{}:
+		list = v
+	case []string:
+		for _, s := range v {
+			list = append(list, s)
+		}
+	default:
+		return nil, nil, errors.New("should be a list")
+	}
+	var recorders []string
+	fallbacks := make(map[string]string)
+	for i, item := range list {
+		m, ok := toStringMap(item)
+		if !ok {
+			name := fmt.Sprint(item)
+			if strings.Contains(name, ",") {
+				return nil, nil, errors.New("not an array or single value")
+			}
+			recorders = append(recorders, name)
+			continue
+		}
+		fallback, ok := m[fallbackKey]
+		if !ok || len(m) != 1 {
+			return nil, nil, fmt.Errorf("item %d should be a recorder name or a map with the %s key", i, fallbackKey)
+		}
+		if i == 0 {
+			return nil, nil, errors.New("a fallback should be listed after its primary recorder")
+		}
+		primary, ok := list[i-1].(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("the fallback of item %d should be listed after a recorder", i)
+		}
+		name := fmt.Sprint(fallback)
+		if isPattern(primary) || strings.HasPrefix(primary, "!") || isPattern(name) || strings.HasPrefix(name, "!") {
+			return nil, nil, fmt.Errorf("%s cannot have the fallback %s: they should be recorder names", primary, name)
+		}
+		if name == primary {
+			return nil, nil, fmt.Errorf("%s cannot be its own fallback", name)
+		}
+		fallbacks[primary] = name
+		recorders = append(recorders, name)
+	}
+	return recorders, fallbacks, nil
+}
+
+// routeFallbacks returns the fallbacks of the recorders of the routes, keyed
+// by the reader and then the primary recorder names. A reader and recorder
+// pair can have only one fallback, and a fallback of a reader cannot be one of
+// its other recorders, as it is only recorded into while its primary is down.
+func routeFallbacks(routes routeMap) (map[string]map[string]string, error) {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make(map[string]map[string]string)
+	fallbacks := make(map[string]bool)
+	for _, name := range names {
+		rt := routes[name]
+		for primary, fallback := range rt.fallbacks {
+			for _, red := range rt.readers {
+				if result[red] == nil {
+					result[red] = make(map[string]string)
+				}
+				if f, ok := result[red][primary]; ok && f != fallback {
+					return nil, NewRoutersError(name, "fallback of "+red+" -> "+primary+" is already set to "+f, nil)
+				}
+				result[red][primary] = fallback
+				fallbacks[red+" -> "+fallback] = true
+			}
+		}
+	}
+	for _, name := range names {
+		rt := routes[name]
+		standby := make(map[string]bool, len(rt.fallbacks))
+		for _, fallback := range rt.fallbacks {
+			standby[fallback] = true
+		}
+		for _, red := range rt.readers {
+			for _, rec := range rt.recorders {
+				if !standby[rec] && fallbacks[red+" -> "+rec] {
+					return nil, NewRoutersError(name, rec+" is a fallback of "+red+" and cannot be one of its recorders", nil)
+				}
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/spf13/viper"
+)
+
+// Formats are the supported formats of the configuration files. The format of
+// a file is detected by its extension.
+var Formats = []string{"yaml", "yml", "json", "toml"}
+
+// includeSections are the sections that are merged from the included files.
+var includeSections = []string{"readers", "recorders", "routes"}
+
+// ReadFile loads the configuration file. If the file has one of the Formats
+// as its extension it is read in that format. Otherwise it is treated as a
+// name without the extension and it is searched in the current directory with
+// each of the Formats, for example "expipe" matches expipe.yaml, expipe.json
+// or expipe.toml.
+//
+// The include section of the file can name a file, a glob pattern or a
+// directory, or a list of them. The readers, recorders and routes of the
+// included files are merged into the configuration. Relative paths are
+// resolved against the directory of the configuration file, and all files with
+// one of the Formats are included from a directory.
+//
+// The overrides are key=value pairs that replace the values of the file, for
+// example settings.log_level=debug or readers.FirstApp.interval=1s. They are
+// applied after the included files are merged.
+//
+// If the file is the address of a Remote configuration, it is fetched from
+// there.
+func ReadFile(log *tools.Logger, file string, overrides ...string) (*ConfMap, error) {
+	v, err := readFile(log, file, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return LoadYAML(log, v)
+}
+
+// PlanFile is like ReadFile, but it returns the route plan of the file
+// without creating its readers and recorders, see Plan.
+func PlanFile(log *tools.Logger, file string, overrides ...string) (RoutePlan, error) {
+	v, err := readFile(log, file, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return Plan(log, v)
+}
+
+// readFile reads the file, merges the included files into it and applies the
+// overrides.
+func readFile(log *tools.Logger, file string, overrides []string) (*viper.Viper, error) {
+	if IsRemote(file) {
+		r, err := NewRemote(file)
+		if err != nil {
+			return nil, err
+		}
+		return r.load(context.Background(), overrides)
+	}
+	v := viper.New()
+	if ext := fileFormat(file); ext != "" {
+		v.SetConfigFile(file)
+		v.SetConfigType(ext)
+	} else {
+		v.SetConfigName(file)
+		v.AddConfigPath(".")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading config file: %s", err)
+	}
+	if v.IsSet("include") {
+		if err := include(log, v); err != nil {
+			return nil, &StructureErr{"include", "", err}
+		}
+	}
+	if err := override(v, overrides); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// include merges the sections of the included files into v.
+func include(log *tools.Logger, v *viper.Viper) error {
+	files, err := includedFiles(v)
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]map[string]interface{}, len(includeSections))
+	origin := make(map[string]string)
+	for _, section := range includeSections {
+		merged[section] = v.GetStringMap(section)
+		for name := range merged[section] {
+			origin[section+"."+name] = v.ConfigFileUsed()
+		}
+	}
+	for _, file := range files {
+		iv := viper.New()
+		iv.SetConfigFile(file)
+		iv.SetConfigType(fileFormat(file))
+		if err := iv.ReadInConfig(); err != nil {
+			return fmt.Errorf("reading %s: %s", file, err)
+		}
+		for _, key := range iv.AllKeys() {
+			if section := strings.SplitN(key, ".", 2)[0]; !isIncludeSection(section) {
+				return fmt.Errorf("%s: %s section can not be included", file, section)
+			}
+		}
+		for _, section := range includeSections {
+			for name, value := range iv.GetStringMap(section) {
+				if prev, ok := origin[section+"."+name]; ok {
+					return fmt.Errorf("%s: %s is already defined in %s", file, name, prev)
+				}
+				origin[section+"."+name] = file
+				merged[section][name] = value
+			}
+		}
+		log.Debugf("included %s", file)
+	}
+	for _, section := range includeSections {
+		if len(merged[section]) > 0 {
+			v.Set(section, merged[section])
+		}
+	}
+	return nil
+}
+
+// includedFiles returns the files of the include section in the order they
+// are specified. The matches of each pattern are sorted.
+func includedFiles(v *viper.Viper) ([]string, error) {
+	dir := filepath.Dir(v.ConfigFileUsed())
+	var files []string
+	for _, pattern := range v.GetStringSlice("include") {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			pattern = filepath.Join(pattern, "*")
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %s: %s", pattern, err)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || info.IsDir() || fileFormat(match) == "" {
+				continue
+			}
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+// fileFormat returns the format of the file if its extension is one of the
+// Formats, otherwise it returns an empty string.
+func fileFormat(file string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))
+	if isFormat(ext) {
+		return ext
+	}
+	return ""
+}
+
+func isIncludeSection(section string) bool {
+	for _, s := range includeSections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+func isFormat(ext string) bool {
+	for _, f := range Formats {
+		if ext == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+)
+
+func TestReadFileFormats(t *testing.T) {
+	for _, file := range []string{"testdata/expipe.json", "testdata/expipe.toml"} {
+		t.Run(file, func(t *testing.T) {
+			confMap, err := config.ReadFile(tools.DiscardLogger(), file)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if _, ok := confMap.Readers["reader1"]; !ok {
+				t.Error("reader1 was not loaded")
+			}
+			if _, ok := confMap.Recorders["recorder1"]; !ok {
+				t.Error("recorder1 was not loaded")
+			}
+			if len(confMap.Routes["reader1"]) != 1 {
+				t.Errorf("Routes = (%v); want (reader1 to recorder1)", confMap.Routes)
+			}
+			if !confMap.Settings.LazyPing {
+				t.Error("LazyPing = (false); want (true)")
+			}
+			if confMap.Settings.Events.Size != 64 {
+				t.Errorf("Events.Size = (%d); want (64)", confMap.Settings.Events.Size)
+			}
+			if confMap.Settings.HTTP.MaxIdleConnsPerHost != 4 {
+				t.Errorf("MaxIdleConnsPerHost = (%d); want (4)", confMap.Settings.HTTP.MaxIdleConnsPerHost)
+			}
+		})
+	}
+}
+
+func TestReadFileWithoutExtension(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/expipe.toml")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	f, err := ioutil.TempFile(".", "expipe_conf")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	name := strings.TrimPrefix(f.Name(), "./")
+	if err = ioutil.WriteFile(name+".toml", content, 0644); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.Remove(name + ".toml")
+
+	confMap, err := config.ReadFile(tools.DiscardLogger(), name)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, ok := confMap.Readers["reader1"]; !ok {
+		t.Error("reader1 was not loaded")
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	if _, err := config.ReadFile(tools.DiscardLogger(), "testdata/does_not_exist.json"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if _, err := config.ReadFile(tools.DiscardLogger(), "does_not_exist"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestReadFileInclude(t *testing.T) {
+	confMap, err := config.ReadFile(tools.DiscardLogger(), "testdata/include/expipe.yml")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for _, name := range []string{"reader1", "reader2", "reader3"} {
+		if _, ok := confMap.Readers[name]; !ok {
+			t.Errorf("%s was not loaded", name)
+		}
+		if len(confMap.Routes[name]) != 1 || confMap.Routes[name][0] != "recorder1" {
+			t.Errorf("Routes[%s] = (%v); want ([recorder1])", name, confMap.Routes[name])
+		}
+	}
+	if len(confMap.Readers) != 3 {
+		t.Errorf("len(Readers) = (%d); want (3)", len(confMap.Readers))
+	}
+}
+
+func TestReadFileIncludeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expipe_include")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	main, err := ioutil.ReadFile("testdata/include/expipe.yml")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = ioutil.WriteFile(path.Join(dir, "expipe.yml"), main, 0644); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = os.Mkdir(path.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+
+	tcs := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"duplicate", "recorders:\n    recorder1:\n        type: elasticsearch\n", "recorder1 is already defined"},
+		{"settings", "settings:\n    lazy_ping: true\n", "settings section can not be included"},
+		{"bad file", "readers: [", "reading"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			file := path.Join(dir, "conf.d", "snippet.yml")
+			if err := ioutil.WriteFile(file, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			defer os.Remove(file)
+			_, err := config.ReadFile(tools.DiscardLogger(), path.Join(dir, "expipe.yml"))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = (%v); want (%s)", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadFileOverrides(t *testing.T) {
+	confMap, err := config.ReadFile(tools.DiscardLogger(), "testdata/include/expipe.yml",
+		"readers.reader1.interval=1s",
+		"readers.reader2.timeout=5s",
+		"recorders.recorder1.index_name=other",
+		"settings.lazy_ping=true",
+		"settings.events.size=32",
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if d := confMap.Readers["reader1"].Interval(); d != time.Second {
+		t.Errorf("reader1.Interval() = (%s); want (1s)", d)
+	}
+	if d := confMap.Readers["reader1"].Timeout(); d != 3*time.Second {
+		t.Errorf("reader1.Timeout() = (%s); want (3s)", d)
+	}
+	if d := confMap.Readers["reader2"].Timeout(); d != 5*time.Second {
+		t.Errorf("reader2.Timeout() = (%s); want (5s)", d)
+	}
+	if name := confMap.Recorders["recorder1"].IndexName(); name != "other" {
+		t.Errorf("recorder1.IndexName() = (%s); want (other)", name)
+	}
+	if !confMap.Settings.LazyPing {
+		t.Error("LazyPing = (false); want (true)")
+	}
+	if confMap.Settings.Events.Size != 32 {
+		t.Errorf("Events.Size = (%d); want (32)", confMap.Settings.Events.Size)
+	}
+
+	for _, o := range []string{"interval", "=1s", "readers.=1s"} {
+		_, err := config.ReadFile(tools.DiscardLogger(), "testdata/expipe.toml", o)
+		if err == nil || !strings.Contains(err.Error(), "set") {
+			t.Errorf("%s: err = (%v); want (set error)", o, err)
+		}
+	}
+}
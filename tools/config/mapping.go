@@ -0,0 +1,60 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"sort"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/reader"
+)
+
+// routeMappers returns the mappers of the routes that have gc_types,
+// memory_bytes or fields, keyed by the reader and then the recorder names. The
+// mappings and fields of a route are added to the mapper of each of its
+// readers. A reader and a
+// recorder can be paired in only one of the routes that have mappings.
+func routeMappers(routes routeMap, readers map[string]reader.DataReader) (map[string]map[string]datatype.Mapper, error) {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mappers := make(map[string]map[string]datatype.Mapper)
+	owners := make(map[string]string)
+	for _, name := range names {
+		rt := routes[name]
+		if len(rt.gcTypes) == 0 && len(rt.memoryTypes) == 0 && len(rt.fields) == 0 {
+			continue
+		}
+		for _, red := range rt.readers {
+			mapper := readerMapper(readers[red]).Extend(rt.gcTypes, rt.memoryTypes).WithFields(rt.fields)
+			for _, rec := range rt.recorders {
+				pair := red + " -> " + rec
+				if owner, ok := owners[pair]; ok {
+					return nil, NewRoutersError(name, "mappings of "+pair+" are already set in "+owner, nil)
+				}
+				owners[pair] = name
+				if mappers[red] == nil {
+					mappers[red] = make(map[string]datatype.Mapper)
+				}
+				mappers[red][rec] = mapper
+			}
+		}
+	}
+	return mappers, nil
+}
+
+// readerMapper returns the mapper of the reader, or the default mapper if the
+// reader does not have a MapConvert.
+func readerMapper(red reader.DataReader) *datatype.MapConvert {
+	if red != nil {
+		if m, ok := red.Mapper().(*datatype.MapConvert); ok {
+			return m
+		}
+	}
+	return datatype.DefaultMapper()
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alext234/expipe/tools/mute"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// readerMutes returns the maintenance windows of the readers that set mute,
+// keyed by the reader names.
+func readerMutes(v *viper.Viper, readerKeys map[string]string) (map[string]mute.Schedule, error) {
+	result := make(map[string]mute.Schedule)
+	for _, name := range sortedKeys(readerKeys) {
+		s, err := parseMute(v.Get("readers." + name + ".mute"))
+		if err != nil {
+			return nil, &StructureErr{"readers", name + ": mute", err}
+		}
+		if len(s) > 0 {
+			result[name] = s
+		}
+	}
+	return result, nil
+}
+
+// routeMutes returns the maintenance windows of the routes that set mute,
+// keyed by the reader and then the recorder names. A reader and recorder pair
+// that is in more than one of these routes is muted in the windows of all of
+// them.
+func routeMutes(routes routeMap) (map[string]map[string]mute.Schedule, error) {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make(map[string]map[string]mute.Schedule)
+	for _, name := range names {
+		rt := routes[name]
+		s, err := parseMute(rt.mute)
+		if err != nil {
+			return nil, NewRoutersError(name, "mute", err)
+		}
+		if len(s) == 0 {
+			continue
+		}
+		for _, red := range rt.readers {
+			if result[red] == nil {
+				result[red] = make(map[string]mute.Schedule)
+			}
+			for _, rec := range rt.recorders {
+				result[red][rec] = append(result[red][rec], s...)
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseMute returns the schedule of a maintenance window, or a list of them.
+// It returns nil if the value is not set.
+func parseMute(value interface{}) (mute.Schedule, error) {
+	var specs []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		specs = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			spec, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("the maintenance window %v is not a string", item)
+			}
+			specs = append(specs, spec)
+		}
+	case []string:
+		specs = v
+	default:
+		return nil, errors.New("should be a maintenance window or a list of them")
+	}
+	return mute.ParseSchedule(specs...)
+}
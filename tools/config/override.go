@@ -0,0 +1,44 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// override sets the values of the key=value pairs in v. The key is the dotted
+// path of the value, for example readers.FirstApp.interval=1s. The integer and
+// boolean values are converted, everything else is set as a string.
+func override(v *viper.Viper, overrides []string) error {
+	for _, o := range overrides {
+		i := strings.Index(o, "=")
+		if i <= 0 {
+			return &StructureErr{"set", fmt.Sprintf("%q should be in key=value format", o), nil}
+		}
+		key := strings.TrimSpace(o[:i])
+		if key == "" || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".") {
+			return &StructureErr{"set", fmt.Sprintf("%q is not a valid key", key), nil}
+		}
+		v.Set(key, overrideValue(o[i+1:]))
+	}
+	return nil
+}
+
+func overrideValue(value string) interface{} {
+	if n, err := strconv.Atoi(value); err == nil {
+		return n
+	}
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return value
+}
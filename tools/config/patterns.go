@@ -0,0 +1,114 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// isPattern returns true if the name in a route is a pattern. A name between
+// slashes is a regular expression, for example /^payments-(eu|us)$/, and a name
+// with any of the *?[ characters is a glob, for example payments-*.
+func isPattern(name string) bool {
+	return isRegexp(name) || strings.ContainsAny(name, "*?[")
+}
+
+func isRegexp(name string) bool {
+	return len(name) > 1 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/")
+}
+
+// matchPattern returns the names that match the pattern, sorted. If the
+// pattern is not a pattern, it is returned as it is.
+func matchPattern(pattern string, names []string) ([]string, error) {
+	if !isPattern(pattern) {
+		return []string{pattern}, nil
+	}
+	match := func(name string) (bool, error) { return path.Match(pattern, name) }
+	if isRegexp(pattern) {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, err
+		}
+		match = func(name string) (bool, error) { return re.MatchString(name), nil }
+	}
+	var result []string
+	for _, name := range names {
+		ok, err := match(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// expandRoutes replaces the patterns of the routes with the names of the
+// readers and recorders they match. The names or patterns starting with ! are
+// excluded from the rest, regardless of their order. The duplicates are
+// removed. It calls warn for the patterns that do not match anything.
+func expandRoutes(routes routeMap, readerKeys, recorderKeys map[string]string, warn func(string, ...interface{})) (routeMap, error) {
+	readerNames := make([]string, 0, len(readerKeys))
+	for name := range readerKeys {
+		readerNames = append(readerNames, name)
+	}
+	recorderNames := make([]string, 0, len(recorderKeys))
+	for name := range recorderKeys {
+		recorderNames = append(recorderNames, name)
+	}
+	expanded := make(routeMap, len(routes))
+	for name, rt := range routes {
+		var err error
+		if rt.readers, err = expandNames(name, "readers", rt.readers, readerNames, warn); err != nil {
+			return nil, err
+		}
+		if rt.recorders, err = expandNames(name, "recorders", rt.recorders, recorderNames, warn); err != nil {
+			return nil, err
+		}
+		expanded[name] = rt
+	}
+	return expanded, nil
+}
+
+func expandNames(route, section string, list, names []string, warn func(string, ...interface{})) ([]string, error) {
+	var result []string
+	seen := make(map[string]bool, len(list))
+	excluded := make(map[string]bool)
+	for _, pattern := range list {
+		if strings.HasPrefix(pattern, "!") {
+			matches, err := matchPattern(pattern[1:], names)
+			if err != nil {
+				return nil, NewRoutersError(route, section+": bad pattern "+pattern, err)
+			}
+			for _, match := range matches {
+				excluded[match] = true
+			}
+		}
+	}
+	for _, pattern := range list {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+		matches, err := matchPattern(pattern, names)
+		if err != nil {
+			return nil, NewRoutersError(route, section+": bad pattern "+pattern, err)
+		}
+		if len(matches) == 0 {
+			warn("route %s: %s pattern %s does not match any %s", route, section, pattern, section)
+		}
+		for _, match := range matches {
+			if !seen[match] && !excluded[match] {
+				seen[match] = true
+				result = append(result, match)
+			}
+		}
+	}
+	return result, nil
+}
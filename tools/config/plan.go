@@ -0,0 +1,150 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// PlanEntry is a reader and recorder pair of the routes. The results of the
+// Reader are recorded once into the Recorder, even if more than one route
+// pairs them.
+type PlanEntry struct {
+	Reader   string
+	Recorder string
+
+	// Routes are the names of the routes that pair the Reader and the
+	// Recorder, sorted.
+	Routes []string
+}
+
+// Duplicate returns true if more than one route pairs the Reader and the
+// Recorder.
+func (p PlanEntry) Duplicate() bool { return len(p.Routes) > 1 }
+
+// Reason explains which routes pair the Reader and the Recorder.
+func (p PlanEntry) Reason() string {
+	if !p.Duplicate() {
+		return "routed in " + p.Routes[0]
+	}
+	return fmt.Sprintf("routed in %s, recorded once", strings.Join(p.Routes, ", "))
+}
+
+// RoutePlan is the reader and recorder matrix of the routes, sorted by the
+// readers and then by the recorders.
+type RoutePlan []PlanEntry
+
+// Matrix returns the recorders of each reader.
+func (p RoutePlan) Matrix() map[string][]string {
+	matrix := make(map[string][]string)
+	for _, e := range p {
+		matrix[e.Reader] = append(matrix[e.Reader], e.Recorder)
+	}
+	return matrix
+}
+
+// Duplicates returns the entries that are paired in more than one route.
+func (p RoutePlan) Duplicates() RoutePlan {
+	var dups RoutePlan
+	for _, e := range p {
+		if e.Duplicate() {
+			dups = append(dups, e)
+		}
+	}
+	return dups
+}
+
+// Plan returns the route plan of the configuration in v, after the reader
+// templates and the patterns of the routes are expanded. Unlike LoadYAML, it
+// does not reject the routes that pair a reader and a recorder more than once,
+// therefore they can be inspected with Duplicates.
+func Plan(log *tools.Logger, v *viper.Viper) (RoutePlan, error) {
+	if len(v.AllSettings()) == 0 {
+		return nil, ErrEmptyConfig
+	}
+	v, err := expandEnv(v)
+	if err != nil {
+		return nil, err
+	}
+	if v.IsSet("reader_templates") {
+		if err = expandTemplates(v); err != nil {
+			return nil, err
+		}
+	}
+	routes, _, _, err := loadRoutes(log, v)
+	if err != nil {
+		return nil, err
+	}
+	return planRoutes(routes), nil
+}
+
+// loadRoutes returns the routes with their patterns expanded, and the types of
+// the readers and recorders keyed by their names.
+func loadRoutes(log *tools.Logger, v *viper.Viper) (routes routeMap, readerKeys, recorderKeys map[string]string, err error) {
+	if readerKeys, err = getReaders(v); err != nil {
+		return nil, nil, nil, errors.WithMessage(err, "readerKeys")
+	}
+	if recorderKeys, err = getRecorders(v); err != nil {
+		return nil, nil, nil, errors.WithMessage(err, "recorderKeys")
+	}
+	if routes, err = getRoutes(v); err != nil {
+		return nil, nil, nil, errors.WithMessage(err, "routes")
+	}
+	if routes, err = expandRoutes(routes, readerKeys, recorderKeys, log.Warnf); err != nil {
+		return nil, nil, nil, errors.WithMessage(err, "routes")
+	}
+	if err = checkAgainstReadRecorders(routes, readerKeys, recorderKeys); err != nil {
+		return nil, nil, nil, errors.WithMessage(err, "checkAgainstReadRecorders")
+	}
+	return routes, readerKeys, recorderKeys, nil
+}
+
+// planRoutes returns the plan of the routes. A reader or recorder that is
+// listed twice in a route is counted once.
+func planRoutes(routes routeMap) RoutePlan {
+	type pair struct{ reader, recorder string }
+	owners := make(map[pair][]string)
+	for name, rt := range routes {
+		for _, red := range rt.readers {
+			for _, rec := range rt.recorders {
+				p := pair{red, rec}
+				if names := owners[p]; len(names) == 0 || names[len(names)-1] != name {
+					owners[p] = append(names, name)
+				}
+			}
+		}
+	}
+	plan := make(RoutePlan, 0, len(owners))
+	for p, names := range owners {
+		sort.Strings(names)
+		plan = append(plan, PlanEntry{Reader: p.reader, Recorder: p.recorder, Routes: names})
+	}
+	sort.Slice(plan, func(i, j int) bool {
+		if plan[i].Reader != plan[j].Reader {
+			return plan[i].Reader < plan[j].Reader
+		}
+		return plan[i].Recorder < plan[j].Recorder
+	})
+	return plan
+}
+
+// checkDuplicates returns a RoutersError for the first pair of the plan that
+// is routed more than once.
+func checkDuplicates(plan RoutePlan) error {
+	dups := plan.Duplicates()
+	if len(dups) == 0 {
+		return nil
+	}
+	e := dups[0]
+	reason := fmt.Sprintf("%s -> %s is also routed in %s, set settings.allow_duplicates to record it once",
+		e.Reader, e.Recorder, strings.Join(e.Routes[:len(e.Routes)-1], ", "))
+	return NewRoutersError(e.Routes[len(e.Routes)-1], reason, nil)
+}
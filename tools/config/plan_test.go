@@ -0,0 +1,101 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/spf13/viper"
+)
+
+// planFixture returns the PlanRoutes fixture with route2 also pairing app2
+// with recorder1, which is already paired in route1.
+func planFixture(t *testing.T, settings string) *viper.Viper {
+	input, err := config.FixtureWithSection("various.txt", "PlanRoutes")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := new(bytes.Buffer)
+	body.ReadFrom(input.Body)
+	content := strings.Replace(body.String(), "            - app1\n        recorders:\n            - recorder2\n",
+		"            - app1\n            - app2\n        recorders:\n            - recorder1\n            - recorder2\n", 1)
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(settings + content))
+	return v
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+	plan, err := config.Plan(tools.DiscardLogger(), planFixture(t, ""))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := config.RoutePlan{
+		{Reader: "app1", Recorder: "recorder1", Routes: []string{"route1", "route2"}},
+		{Reader: "app1", Recorder: "recorder2", Routes: []string{"route2"}},
+		{Reader: "app2", Recorder: "recorder1", Routes: []string{"route1", "route2"}},
+		{Reader: "app2", Recorder: "recorder2", Routes: []string{"route2"}},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Fatalf("Plan() = (%v); want (%v)", plan, want)
+	}
+	if got := plan[1].Reason(); got != "routed in route2" {
+		t.Errorf("Reason() = (%s); want (routed in route2)", got)
+	}
+	if got := plan[0].Reason(); got != "routed in route1, route2, recorded once" {
+		t.Errorf("Reason() = (%s); want (routed in route1, route2, recorded once)", got)
+	}
+	if dups := plan.Duplicates(); len(dups) != 2 || dups[0].Reader != "app1" || dups[1].Reader != "app2" {
+		t.Errorf("Duplicates() = (%v); want app1 and app2 -> recorder1", dups)
+	}
+	matrix := map[string][]string{
+		"app1": {"recorder1", "recorder2"},
+		"app2": {"recorder1", "recorder2"},
+	}
+	if got := plan.Matrix(); !reflect.DeepEqual(got, matrix) {
+		t.Errorf("Matrix() = (%v); want (%v)", got, matrix)
+	}
+
+	if _, err = config.Plan(tools.DiscardLogger(), viper.New()); err != config.ErrEmptyConfig {
+		t.Errorf("err = (%v); want (%v)", err, config.ErrEmptyConfig)
+	}
+}
+
+func TestLoadYAMLDuplicateRoutes(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "PlanRoutes")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(input.Body)
+	if _, err = config.LoadYAML(log, v); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+
+	_, err = config.LoadYAML(log, planFixture(t, ""))
+	if _, ok := err.(*config.RoutersError); !ok {
+		t.Fatalf("err = (%#v); want (*RoutersError)", err)
+	}
+	if !strings.Contains(err.Error(), "app1 -> recorder1 is also routed in route1") {
+		t.Errorf("err = (%v); want the duplicate pair", err)
+	}
+
+	confMap, err := config.LoadYAML(log, planFixture(t, "settings:\n    allow_duplicates: true\n"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if recs := confMap.Routes["app1"]; len(recs) != 2 {
+		t.Errorf("Routes[app1] = (%v); want each recorder once", recs)
+	}
+}
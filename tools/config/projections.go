@@ -0,0 +1,29 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"github.com/alext234/expipe/datatype"
+	"github.com/spf13/viper"
+)
+
+// recorderProjections returns the projections of the recorders that have
+// allow_fields, keyed by the recorder names. They apply to the recorders in
+// all of their routes.
+func recorderProjections(v *viper.Viper, recorderKeys map[string]string) (map[string]*datatype.Projection, error) {
+	result := make(map[string]*datatype.Projection)
+	for _, name := range sortedKeys(recorderKeys) {
+		key := "recorders." + name + ".allow_fields"
+		if !v.IsSet(key) {
+			continue
+		}
+		p, err := datatype.NewProjection(v.GetStringSlice(key))
+		if err != nil {
+			return nil, &StructureErr{"recorders", name + ": allow_fields", err}
+		}
+		result[name] = p
+	}
+	return result, nil
+}
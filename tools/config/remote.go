@@ -0,0 +1,294 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// RemoteTimeout is the timeout of fetching a remote configuration.
+const RemoteTimeout = 10 * time.Second
+
+// The schemes of the remote configurations. The etcd and consul schemes are
+// requested over http, and over https with the +https suffix.
+var remoteSchemes = []string{"http", "https", "etcd", "etcd+https", "consul", "consul+https"}
+
+// Remote is a configuration that is fetched from a URL, an etcd key or a
+// Consul KV path. The address of an etcd key is etcd://host:2379/the/key, and
+// its value is read with the v3 json gateway of etcd. The address of a Consul
+// KV path is consul://host:8500/the/path, and the CONSUL_HTTP_TOKEN of the
+// environment is sent with the requests. The user and password of the address
+// are sent with basic authentication. The format of the configuration is
+// detected by the extension of the address, or set with its format query
+// parameter, and it is yaml otherwise. The include section is not supported
+// in the remote configurations.
+type Remote struct {
+	addr   string
+	scheme string
+	url    *url.URL
+	key    string // of etcd.
+	format string
+	client *http.Client
+
+	mu   sync.Mutex
+	etag string // guarded by mu.
+	last []byte // guarded by mu.
+}
+
+// IsRemote returns true if the file is the address of a remote configuration.
+func IsRemote(file string) bool {
+	i := strings.Index(file, "://")
+	return i > 0 && tools.StringInSlice(strings.ToLower(file[:i]), remoteSchemes)
+}
+
+// NewRemote returns a Remote for the addr. It returns an error if the addr is
+// not a remote address.
+func NewRemote(addr string) (*Remote, error) {
+	if !IsRemote(addr) {
+		return nil, fmt.Errorf("%s is not a remote configuration", addr)
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote configuration")
+	}
+	r := &Remote{
+		addr:   addr,
+		scheme: strings.ToLower(u.Scheme),
+		format: strings.ToLower(u.Query().Get("format")),
+		client: httpclient.Default(),
+	}
+	if r.format == "" {
+		r.format = fileFormat(u.Path)
+	}
+	if r.format == "" {
+		r.format = "yaml"
+	}
+	if !isFormat(r.format) {
+		return nil, fmt.Errorf("remote configuration: unknown format %s, should be one of %s", r.format, strings.Join(Formats, ", "))
+	}
+	kind := strings.SplitN(r.scheme, "+", 2)
+	if kind[0] == "http" || kind[0] == "https" {
+		r.url = u
+		return r, nil
+	}
+	if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("remote configuration: %s should have a host and a key", addr)
+	}
+	r.url = &url.URL{Scheme: "http", Host: u.Host, User: u.User}
+	if len(kind) > 1 {
+		r.url.Scheme = kind[1]
+	}
+	switch kind[0] {
+	case "etcd":
+		r.url.Path = "/v3/kv/range"
+		r.key = u.Path
+	case "consul":
+		r.url.Path = path.Join("/v1/kv", u.Path)
+		r.url.RawQuery = "raw"
+	}
+	return r, nil
+}
+
+// String returns the address of the r.
+func (r *Remote) String() string { return r.addr }
+
+// Fetch returns the contents of the remote configuration. The contents of an
+// http address are not downloaded again if their ETag has not changed.
+func (r *Remote) Fetch(ctx context.Context) ([]byte, error) {
+	req, err := r.request()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	etag, last := r.etag, r.last
+	r.mu.Unlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching the configuration")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && last != nil {
+		return last, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the configuration: %s", resp.Status)
+	}
+	body, err := tools.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching the configuration")
+	}
+	if strings.HasPrefix(r.scheme, "etcd") {
+		if body, err = etcdValue(body); err != nil {
+			return nil, err
+		}
+	}
+	r.mu.Lock()
+	r.etag = resp.Header.Get("ETag")
+	r.mu.Unlock()
+	return body, nil
+}
+
+func (r *Remote) request() (*http.Request, error) {
+	switch {
+	case strings.HasPrefix(r.scheme, "etcd"):
+		body, _ := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(r.key))})
+		req, err := http.NewRequest(http.MethodPost, r.url.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	case strings.HasPrefix(r.scheme, "consul"):
+		req, err := http.NewRequest(http.MethodGet, r.url.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+			req.Header.Set("X-Consul-Token", token)
+		}
+		return req, nil
+	}
+	return http.NewRequest(http.MethodGet, r.url.String(), nil)
+}
+
+// etcdValue returns the value of the key in the range response of etcd.
+func etcdValue(body []byte) ([]byte, error) {
+	var resp struct {
+		KVs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, errors.Wrap(err, "decoding the etcd response")
+	}
+	if len(resp.KVs) == 0 {
+		return nil, errors.New("fetching the configuration: the etcd key does not exist")
+	}
+	value, err := base64.StdEncoding.DecodeString(resp.KVs[0].Value)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding the etcd value")
+	}
+	return value, nil
+}
+
+// Read fetches the configuration and loads it with the overrides, see
+// ReadFile for the format of the overrides.
+func (r *Remote) Read(ctx context.Context, log *tools.Logger, overrides ...string) (*ConfMap, error) {
+	v, err := r.load(ctx, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return LoadYAML(log, v)
+}
+
+// load fetches the configuration and reads it into a viper with the
+// overrides.
+func (r *Remote) load(ctx context.Context, overrides []string) (*viper.Viper, error) {
+	ctx, cancel := context.WithTimeout(ctx, RemoteTimeout)
+	defer cancel()
+	data, err := r.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.last = data
+	r.mu.Unlock()
+	return r.viper(data, overrides)
+}
+
+func (r *Remote) viper(data []byte, overrides []string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigType(r.format)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("reading config %s: %s", r.addr, err)
+	}
+	if v.IsSet("include") {
+		return nil, &StructureErr{"include", "not supported in the remote configurations", nil}
+	}
+	if err := override(v, overrides); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Watch fetches the configuration every interval, and sends its ConfMap when
+// its contents change. A tenth of the interval is added randomly to each
+// wait, so many instances don't fetch at the same time. The errors and the
+// contents that can not be loaded are logged and skipped. The channel is
+// closed when the ctx is done.
+func (r *Remote) Watch(ctx context.Context, log *tools.Logger, interval time.Duration, overrides ...string) <-chan *ConfMap {
+	ch := make(chan *ConfMap)
+	go func() {
+		defer close(ch)
+		for {
+			wait := interval
+			if jitter := int64(interval / 10); jitter > 0 {
+				wait += time.Duration(rand.Int63n(jitter))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			conf, err := r.changed(ctx, log, overrides)
+			if err != nil {
+				log.Errorf("remote configuration %s: %v", r.addr, err)
+				continue
+			}
+			if conf == nil {
+				continue
+			}
+			select {
+			case ch <- conf:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// changed returns the ConfMap of the configuration if it has changed since the
+// last time it was read, or nil if it has not.
+func (r *Remote) changed(ctx context.Context, log *tools.Logger, overrides []string) (*ConfMap, error) {
+	ctx, cancel := context.WithTimeout(ctx, RemoteTimeout)
+	defer cancel()
+	data, err := r.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	same := bytes.Equal(data, r.last)
+	r.last = data
+	r.mu.Unlock()
+	if same {
+		return nil, nil
+	}
+	v, err := r.viper(data, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return LoadYAML(log, v)
+}
@@ -0,0 +1,261 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+)
+
+func TestIsRemote(t *testing.T) {
+	tcs := []struct {
+		file string
+		want bool
+	}{
+		{"expipe.yml", false},
+		{"/etc/expipe/expipe.yml", false},
+		{"file:///etc/expipe.yml", false},
+		{"http://127.0.0.1/expipe.yml", true},
+		{"HTTPS://127.0.0.1/expipe.yml", true},
+		{"etcd://127.0.0.1:2379/expipe", true},
+		{"etcd+https://127.0.0.1:2379/expipe", true},
+		{"consul://127.0.0.1:8500/expipe", true},
+		{"consul+https://127.0.0.1:8500/expipe", true},
+	}
+	for _, tc := range tcs {
+		if got := config.IsRemote(tc.file); got != tc.want {
+			t.Errorf("IsRemote(%s) = (%t); want (%t)", tc.file, got, tc.want)
+		}
+	}
+}
+
+func TestNewRemoteErrors(t *testing.T) {
+	tcs := []string{
+		"expipe.yml",
+		"http://127.0.0.1/expipe.yml?format=ini",
+		"etcd://127.0.0.1:2379",
+		"etcd://127.0.0.1:2379/",
+		"consul:///expipe",
+	}
+	for _, addr := range tcs {
+		if _, err := config.NewRemote(addr); err == nil {
+			t.Errorf("NewRemote(%s): err = (nil); want (error)", addr)
+		}
+	}
+}
+
+func TestRemoteReadHTTP(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/expipe.json")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var downloads int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	remote, err := config.NewRemote(ts.URL + "/conf/expipe.json")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for i := 0; i < 2; i++ {
+		confMap, err := remote.Read(context.Background(), tools.DiscardLogger(), "settings.events.size=128")
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if _, ok := confMap.Readers["reader1"]; !ok {
+			t.Error("reader1 was not loaded")
+		}
+		if confMap.Settings.Events.Size != 128 {
+			t.Errorf("Events.Size = (%d); want (128)", confMap.Settings.Events.Size)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("downloads = (%d); want (1)", downloads)
+	}
+}
+
+func TestRemoteReadErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/include.yml":
+			w.Write([]byte("include:\n    - other.yml\n"))
+		case "/bad.yml":
+			w.Write([]byte("readers: [\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	for _, name := range []string{"/include.yml", "/bad.yml", "/missing.yml"} {
+		remote, err := config.NewRemote(ts.URL + name)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if _, err := remote.Read(context.Background(), tools.DiscardLogger()); err == nil {
+			t.Errorf("%s: err = (nil); want (error)", name)
+		}
+	}
+	remote, err := config.NewRemote(ts.URL + "/include.yml")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	_, err = remote.Read(context.Background(), tools.DiscardLogger())
+	if _, ok := err.(*config.StructureErr); !ok {
+		t.Errorf("err = (%#v); want (*StructureErr)", err)
+	}
+}
+
+func TestRemoteFetchEtcd(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/kv/range" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Key string `json:"key"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		key, _ := base64.StdEncoding.DecodeString(req.Key)
+		if string(key) != "/expipe/conf" {
+			w.Write([]byte(`{"header":{}}`))
+			return
+		}
+		value := base64.StdEncoding.EncodeToString([]byte("the value"))
+		w.Write([]byte(`{"kvs":[{"value":"` + value + `"}]}`))
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	remote, err := config.NewRemote("etcd://" + host + "/expipe/conf")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	data, err := remote.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if string(data) != "the value" {
+		t.Errorf("data = (%s); want (the value)", data)
+	}
+
+	remote, err = config.NewRemote("etcd://" + host + "/expipe/missing")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err = remote.Fetch(context.Background()); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestRemoteFetchConsul(t *testing.T) {
+	token := os.Getenv("CONSUL_HTTP_TOKEN")
+	defer os.Setenv("CONSUL_HTTP_TOKEN", token)
+	os.Setenv("CONSUL_HTTP_TOKEN", "the token")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/expipe/conf" {
+			t.Errorf("Path = (%s); want (/v1/kv/expipe/conf)", r.URL.Path)
+		}
+		if _, ok := r.URL.Query()["raw"]; !ok {
+			t.Errorf("Query = (%s); want (raw)", r.URL.RawQuery)
+		}
+		if got := r.Header.Get("X-Consul-Token"); got != "the token" {
+			t.Errorf("X-Consul-Token = (%s); want (the token)", got)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "secret" {
+			t.Errorf("BasicAuth = (%s, %s); want (admin, secret)", user, pass)
+		}
+		w.Write([]byte("the value"))
+	}))
+	defer ts.Close()
+
+	remote, err := config.NewRemote("consul://admin:secret@" + strings.TrimPrefix(ts.URL, "http://") + "/expipe/conf")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	data, err := remote.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if string(data) != "the value" {
+		t.Errorf("data = (%s); want (the value)", data)
+	}
+}
+
+func TestRemoteWatch(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/expipe.json")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	remote, err := config.NewRemote(ts.URL + "/expipe.json")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	log := tools.DiscardLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err = remote.Read(ctx, log); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	updates := remote.Watch(ctx, log, 10*time.Millisecond)
+
+	select {
+	case <-updates:
+		t.Fatal("received an update before the configuration has changed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mu.Lock()
+	content = []byte(strings.Replace(string(content), `"size": 64`, `"size": 32`, 1))
+	mu.Unlock()
+	select {
+	case confMap := <-updates:
+		if confMap.Settings.Events.Size != 32 {
+			t.Errorf("Events.Size = (%d); want (32)", confMap.Settings.Events.Size)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the update was not received")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Error("received an update after the context was cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Error("the channel was not closed")
+	}
+}
@@ -220,3 +220,210 @@ func TestRouteDropUnusedReaderRecorders(t *testing.T) {
 		}
 	}
 }
+
+func TestExpandRoutes(t *testing.T) {
+	t.Parallel()
+	readerKeys := map[string]string{
+		"payments-eu": "expvar",
+		"payments-us": "expvar",
+		"orders":      "expvar",
+	}
+	recorderKeys := map[string]string{
+		"es-hot":  "elasticsearch",
+		"es-cold": "elasticsearch",
+	}
+	routes := routeMap{
+		"route1": route{
+			readers:   []string{"payments-*", "payments-eu", "orders"},
+			recorders: []string{"/^es-(hot|cold)$/"},
+		},
+		"route2": route{
+			readers:   []string{"invoices-*"},
+			recorders: []string{"es-hot"},
+		},
+	}
+	var warnings []string
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+	expanded, err := expandRoutes(routes, readerKeys, recorderKeys, warn)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	rt := expanded["route1"]
+	if got := strings.Join(rt.readers, ","); got != "payments-eu,payments-us,orders" {
+		t.Errorf("readers = (%s); want (payments-eu,payments-us,orders)", got)
+	}
+	if got := strings.Join(rt.recorders, ","); got != "es-cold,es-hot" {
+		t.Errorf("recorders = (%s); want (es-cold,es-hot)", got)
+	}
+	if len(expanded["route2"].readers) != 0 {
+		t.Errorf("readers = (%v); want (none)", expanded["route2"].readers)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "invoices-*") {
+		t.Errorf("warnings = (%v); want one about invoices-*", warnings)
+	}
+	if got := strings.Join(routes["route1"].readers, ","); got != "payments-*,payments-eu,orders" {
+		t.Errorf("routes have changed: readers = (%s)", got)
+	}
+
+	routes = routeMap{"route1": route{readers: []string{"/(/"}, recorders: []string{"es-hot"}}}
+	_, err = expandRoutes(routes, readerKeys, recorderKeys, warn)
+	if e, ok := err.(*RoutersError); !ok || e.Section != "route1" {
+		t.Errorf("err = (%v); want (*RoutersError) for route1", err)
+	}
+}
+
+func TestLoadYAMLRoutePatterns(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    readers:
+        payments-eu:
+            type: expvar
+            type_name: payments
+            endpoint: localhost:1234
+            interval: 1s
+            timeout: 1s
+        payments-us:
+            type: expvar
+            type_name: payments
+            endpoint: localhost:1235
+            interval: 1s
+            timeout: 1s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+    routes:
+        route1:
+            readers: payments-*
+            recorders: /^rec/
+    `))
+	confMap, err := LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for _, name := range []string{"payments-eu", "payments-us"} {
+		if _, ok := confMap.Readers[name]; !ok {
+			t.Errorf("%s was not loaded", name)
+		}
+		if got := strings.Join(confMap.Routes[name], ","); got != "recorder1" {
+			t.Errorf("Routes[%s] = (%s); want (recorder1)", name, got)
+		}
+	}
+}
+
+func TestExpandRoutesExclusions(t *testing.T) {
+	t.Parallel()
+	readerKeys := map[string]string{
+		"app1":       "expvar",
+		"app2":       "expvar",
+		"noisy_app":  "expvar",
+		"test-app-1": "expvar",
+	}
+	recorderKeys := map[string]string{"rec1": "elasticsearch", "rec2": "elasticsearch"}
+	routes := routeMap{
+		"route1": route{
+			readers:   []string{"!noisy_app", "*", "!test-*"},
+			recorders: []string{"*", "!rec2"},
+		},
+	}
+	warn := func(string, ...interface{}) { t.Error("unexpected warning") }
+	expanded, err := expandRoutes(routes, readerKeys, recorderKeys, warn)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got := strings.Join(expanded["route1"].readers, ","); got != "app1,app2" {
+		t.Errorf("readers = (%s); want (app1,app2)", got)
+	}
+	if got := strings.Join(expanded["route1"].recorders, ","); got != "rec1" {
+		t.Errorf("recorders = (%s); want (rec1)", got)
+	}
+
+	routes = routeMap{"route1": route{readers: []string{"*", "!/(/"}, recorders: []string{"rec1"}}}
+	if _, err = expandRoutes(routes, readerKeys, recorderKeys, warn); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestGetRoutesFallbacks(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    routes:
+        route1:
+            readers: red1
+            recorders:
+                - rec1
+                - fallback: backup1
+                - rec2
+        route2:
+            readers:
+                - red1
+                - red2
+            recorders:
+                - rec3
+                - fallback: backup1
+    `))
+	routes, err := getRoutes(v)
+	if err != nil {
+		t.Fatalf("getRoutes(v): err = (%v); want (nil)", err)
+	}
+	if want := []string{"rec1", "backup1", "rec2"}; !equalSlice(want, routes["route1"].recorders) {
+		t.Errorf("recorders = (%v); want (%v)", routes["route1"].recorders, want)
+	}
+	fallbacks, err := routeFallbacks(routes)
+	if err != nil {
+		t.Fatalf("routeFallbacks(routes): err = (%v); want (nil)", err)
+	}
+	if len(fallbacks["red1"]) != 2 || fallbacks["red1"]["rec1"] != "backup1" || fallbacks["red1"]["rec3"] != "backup1" {
+		t.Errorf("fallbacks[red1] = (%v); want (rec1 and rec3: backup1)", fallbacks["red1"])
+	}
+	if len(fallbacks["red2"]) != 1 || fallbacks["red2"]["rec3"] != "backup1" {
+		t.Errorf("fallbacks[red2] = (%v); want (rec3: backup1)", fallbacks["red2"])
+	}
+
+	errs := []struct {
+		recorders string
+		want      string
+	}{
+		{"[{fallback: backup1}, rec1]", "listed after its primary"},
+		{"[rec1, {fallback: backup1, other: 1}]", "a map with the fallback key"},
+		{"[rec*, {fallback: backup1}]", "should be recorder names"},
+		{"[rec1, {fallback: rec1}]", "its own fallback"},
+		{"[rec1, {fallback: backup1}, {fallback: backup2}]", "should be listed after a recorder"},
+	}
+	for _, tc := range errs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(strings.NewReader("routes:\n    route1:\n        readers: red1\n        recorders: " + tc.recorders + "\n"))
+		if _, err := getRoutes(v); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = (%v); want (%s)", tc.recorders, err, tc.want)
+		}
+	}
+
+	v = viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(`
+    routes:
+        route1:
+            readers: red1
+            recorders:
+                - rec1
+                - fallback: backup1
+        route2:
+            readers: red1
+            recorders: backup1
+    `))
+	if routes, err = getRoutes(v); err != nil {
+		t.Fatalf("getRoutes(v): err = (%v); want (nil)", err)
+	}
+	if _, err = routeFallbacks(routes); err == nil || !strings.Contains(err.Error(), "backup1 is a fallback of red1") {
+		t.Errorf("routeFallbacks(routes): err = (%v); want (backup1 is a fallback of red1)", err)
+	}
+}
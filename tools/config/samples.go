@@ -0,0 +1,49 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"sort"
+
+	"github.com/alext234/expipe/tools/sample"
+)
+
+// routeSamples returns the samplers of the routes that have a sample rate,
+// keyed by the reader and then the recorder names. Each reader and recorder
+// pair has its own sampler. A reader and a recorder can be paired in only one
+// of the routes that have sample rates.
+func routeSamples(routes routeMap) (map[string]map[string]*sample.Sampler, error) {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make(map[string]map[string]*sample.Sampler)
+	owners := make(map[string]string)
+	for _, name := range names {
+		rt := routes[name]
+		if rt.sample == "" {
+			continue
+		}
+		if _, err := sample.Parse(rt.sample); err != nil {
+			return nil, NewRoutersError(name, "sample", err)
+		}
+		for _, red := range rt.readers {
+			for _, rec := range rt.recorders {
+				pair := red + " -> " + rec
+				if owner, ok := owners[pair]; ok {
+					return nil, NewRoutersError(name, "sample of "+pair+" is already set in "+owner, nil)
+				}
+				owners[pair] = name
+				if result[red] == nil {
+					result[red] = make(map[string]*sample.Sampler)
+				}
+				result[red][rec], _ = sample.Parse(rt.sample)
+			}
+		}
+	}
+	return result, nil
+}
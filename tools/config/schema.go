@@ -0,0 +1,383 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/reader/expvar"
+	readerplugin "github.com/alext234/expipe/reader/plugin"
+	"github.com/alext234/expipe/reader/receiver"
+	"github.com/alext234/expipe/reader/self"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/recorder/elasticsearch"
+	"github.com/alext234/expipe/recorder/forwarder"
+	recorderplugin "github.com/alext234/expipe/recorder/plugin"
+	"github.com/spf13/viper"
+)
+
+// The known keys of each section. A key ending with .* accepts any keys under
+// it. The keys of the types that are registered outside expipe are not checked.
+var (
+	topKeys = []string{"include", "defaults", "settings", "readers", "reader_templates", "recorders", "routes", "tenants"}
+
+	settingsKeys = []string{
+		"log_level", "lazy_ping", "tracing", "metrics_addr", "dashboard",
+		"debug_addr", "leader_lock", "pid_file", "flush_interval", "state_dump_file",
+		"on_recorder_failure", "delivery_mode", "max_unacked_jobs", "job_grace_period", "allow_duplicates",
+		"clock_skew_threshold", "annotate_reads",
+		"log.level", "log.format", "log.file", "log.max_size_mb", "log.max_backups",
+		"cluster.self", "cluster.peers",
+		"http.max_idle_conns_per_host", "http.idle_conn_timeout", "http.proxy",
+		"http.ca_file", "http.insecure_skip_verify", "http.disable_http2",
+		"http.client_cert_file", "http.client_key_file",
+		"listen_tls.cert_file", "listen_tls.key_file", "listen_tls.client_ca_file",
+		"events.size", "events.ship",
+		"alerts.error_threshold", "alerts.webhook", "alerts.webhook_file",
+		"alerts.slack", "alerts.slack_file", "alerts.email.smtp",
+		"alerts.email.username", "alerts.email.username_file",
+		"alerts.email.password", "alerts.email.password_file",
+		"alerts.email.from", "alerts.email.to",
+		"runtime.memory_limit", "runtime.shed_ratio", "runtime.gomaxprocs",
+		"tracing.enabled", "tracing.endpoint", "tracing.sample_ratio",
+	}
+
+	readerSchema = map[string][]string{
+		expvarReader:   append(structKeys(expvar.Config{}), commonReaderKeys...),
+		selfReader:     append(structKeys(self.Config{}), commonReaderKeys...),
+		pluginReader:   append(structKeys(readerplugin.Config{}), commonReaderKeys...),
+		receiverReader: append(structKeys(receiver.Config{}), commonReaderKeys...),
+	}
+
+	recorderSchema = map[string][]string{
+		elasticsearchRecorder: append(structKeys(elasticsearch.Config{}), commonRecorderKeys...),
+		pluginRecorder:        append(structKeys(recorderplugin.Config{}), commonRecorderKeys...),
+		forwarderRecorder:     append(structKeys(forwarder.Config{}), commonRecorderKeys...),
+	}
+
+	// The keys of all the readers and recorders, whichever their types.
+	commonReaderKeys   = append([]string{"type", "mute", "schema_drift", "scrape_on_start"}, structKeys(chaosSection{})...)
+	commonRecorderKeys = append([]string{"type", "allow_fields"}, structKeys(chaosSection{})...)
+
+	routeKeys = []string{"readers", "recorders", "gc_types", "memory_bytes", "memory_bytes.*", "fields", "fields.*", "tenant", "sample", "record_when", "mute"}
+)
+
+// Types returns the types of the readers and the recorders that can be
+// configured, which are the registered types of the reader and recorder
+// packages, sorted.
+func Types() (readers, recorders []string) {
+	return reader.Types(), recorder.Types()
+}
+
+// structKeys returns the mapstructure tags of the fields of s. The keys of the
+// struct fields are added under their tags.
+func structKeys(s interface{}) []string {
+	return typeKeys(reflect.TypeOf(s))
+}
+
+func typeKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if tag == "" {
+			continue
+		}
+		keys = append(keys, tag)
+		switch field.Type.Kind() {
+		case reflect.Map:
+			keys = append(keys, tag+".*")
+		case reflect.Struct:
+			for _, key := range typeKeys(field.Type) {
+				keys = append(keys, tag+"."+key)
+			}
+		}
+	}
+	return keys
+}
+
+// unknownKeys returns an UnknownKeyError for each key of v that is not known,
+// sorted by the keys.
+func unknownKeys(v *viper.Viper) []error {
+	sources := configSources(v)
+	keys := v.AllKeys()
+	sort.Strings(keys)
+	var errs []error
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		known := knownKeys(v, strings.Split(key, "."))
+		if known == nil || matchKey(strings.Join(known.rest, "."), known.keys) {
+			continue
+		}
+		parts := append(append([]string(nil), known.prefix...), known.rest...)
+		key = strings.Join(parts, ".")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		e := &UnknownKeyError{
+			Key:        key,
+			Suggestion: suggest(strings.Join(known.rest, "."), known.keys),
+		}
+		if e.Suggestion != "" && len(known.prefix) > 0 {
+			e.Suggestion = strings.Join(known.prefix, ".") + "." + e.Suggestion
+		}
+		for _, src := range sources {
+			if line := keyLine(src.lines, parts, src.toml); line > 0 {
+				e.File, e.Line = src.file, line
+				break
+			}
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// checkKeys returns the first UnknownKeyError of v.
+func checkKeys(v *viper.Viper) error {
+	if errs := unknownKeys(v); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+type keySet struct {
+	prefix []string // The section of the key, for example readers.app.
+	rest   []string // The part of the key that is checked against the keys.
+	keys   []string
+}
+
+// knownKeys returns the keys that the parts can be in. It returns nil if the
+// parts can not be checked, for example when the type of a reader is unknown.
+func knownKeys(v *viper.Viper, parts []string) *keySet {
+	if len(parts) == 1 {
+		return &keySet{nil, parts, topKeys}
+	}
+	switch parts[0] {
+	case "include":
+		return nil
+	case "settings":
+		return &keySet{parts[:1], parts[1:], settingsKeys}
+	case "readers", "recorders":
+		if len(parts) < 3 {
+			return nil
+		}
+		schema := readerSchema
+		if parts[0] == "recorders" {
+			schema = recorderSchema
+		}
+		keys, ok := schema[blockType(v, parts[0], parts[0]+"."+parts[1])]
+		if !ok {
+			return nil
+		}
+		return &keySet{parts[:2], parts[2:], keys}
+	case "reader_templates":
+		if len(parts) < 3 || parts[2] == "instances" {
+			return nil
+		}
+		if parts[2] != "template" {
+			return &keySet{parts[:2], parts[2:3], []string{"template", "instances"}}
+		}
+		keys, ok := readerSchema[blockType(v, "readers", strings.Join(parts[:3], "."))]
+		if !ok || len(parts) < 4 {
+			return nil
+		}
+		return &keySet{parts[:3], parts[3:], keys}
+	case "routes":
+		if len(parts) < 3 {
+			return nil
+		}
+		return &keySet{parts[:2], parts[2:], routeKeys}
+	case "tenants":
+		if len(parts) < 3 {
+			return nil
+		}
+		return &keySet{parts[:2], parts[2:], tenantKeys}
+	case "defaults":
+		if len(parts) > 2 && (parts[1] == "readers" || parts[1] == "recorders") {
+			schema := readerSchema
+			if parts[1] == "recorders" {
+				schema = recorderSchema
+			}
+			return &keySet{parts[:2], parts[2:], schemaKeys(schema)}
+		}
+		keys := append(schemaKeys(readerSchema), schemaKeys(recorderSchema)...)
+		return &keySet{parts[:1], parts[1:], append(keys, "readers", "recorders")}
+	}
+	return &keySet{nil, parts[:1], topKeys}
+}
+
+// blockType returns the type of the block at the key, or the type of the
+// defaults if it is not set.
+func blockType(v *viper.Viper, section, key string) string {
+	for _, k := range []string{key + ".type", "defaults." + section + ".type", "defaults.type"} {
+		if typeName := v.GetString(k); typeName != "" {
+			return typeName
+		}
+	}
+	return ""
+}
+
+// schemaKeys returns the keys of all types of the schema.
+func schemaKeys(schema map[string][]string) []string {
+	var keys []string
+	for _, list := range schema {
+		keys = append(keys, list...)
+	}
+	return keys
+}
+
+func matchKey(key string, keys []string) bool {
+	for _, k := range keys {
+		if key == k || strings.HasSuffix(k, ".*") && strings.HasPrefix(key, k[:len(k)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns the most similar key to the key, if they are at most two
+// edits apart.
+func suggest(key string, keys []string) string {
+	best, bestDist := "", 3
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		if strings.HasSuffix(k, ".*") {
+			continue
+		}
+		if d := distance(key, k); d < bestDist && d < len(k)/2 {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance of a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+type configSource struct {
+	file  string
+	lines []string
+	toml  bool
+}
+
+// configSources returns the contents of the configuration file of v and the
+// files it includes.
+func configSources(v *viper.Viper) []configSource {
+	file := v.ConfigFileUsed()
+	if file == "" {
+		return nil
+	}
+	files := []string{file}
+	if v.IsSet("include") {
+		if included, err := includedFiles(v); err == nil {
+			files = append(files, included...)
+		}
+	}
+	var sources []configSource
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		sources = append(sources, configSource{
+			file:  f,
+			lines: strings.Split(string(content), "\n"),
+			toml:  strings.EqualFold(filepath.Ext(f), ".toml"),
+		})
+	}
+	return sources
+}
+
+// keyLine returns the line number of the key with the parts, or zero if it is
+// not found. The keys of yaml and json files are found by their indentations,
+// and the keys of toml files are found under their tables.
+func keyLine(lines, parts []string, toml bool) int {
+	if toml {
+		return tomlKeyLine(lines, parts)
+	}
+	start, indent, line := 0, -1, 0
+	for _, part := range parts {
+		found := false
+		for i := start; i < len(lines); i++ {
+			text := strings.TrimSpace(lines[i])
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			ind := len(lines[i]) - len(strings.TrimLeft(lines[i], " \t"))
+			if ind <= indent {
+				break
+			}
+			if isKeyLine(text, part) {
+				start, indent, line, found = i+1, ind, i+1, true
+				break
+			}
+		}
+		if !found {
+			return 0
+		}
+	}
+	return line
+}
+
+func tomlKeyLine(lines, parts []string) int {
+	table := "[" + strings.Join(parts[:len(parts)-1], ".") + "]"
+	inTable := len(parts) == 1
+	for i, l := range lines {
+		text := strings.ToLower(strings.TrimSpace(l))
+		if strings.HasPrefix(text, "[") {
+			inTable = text == table
+			continue
+		}
+		if inTable && isKeyLine(text, parts[len(parts)-1]) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// isKeyLine returns true if the text defines the key, with or without quotes.
+func isKeyLine(text, key string) bool {
+	text = strings.TrimLeft(strings.ToLower(text), `"'`)
+	if !strings.HasPrefix(text, key) {
+		return false
+	}
+	rest := strings.TrimLeft(text[len(key):], `"' `)
+	return strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, "=")
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/spf13/viper"
+)
+
+const unknownKeysConf = `settings:
+    lazy_ping: true
+readers:
+    reader1:
+        type: expvar
+        endpoint: localhost:1234
+        type_name: my_app
+        intervall: 2s
+        timeout: 3s
+recorders:
+    recorder1:
+        type: elasticsearch
+        endpoint: http://127.0.0.1:9200
+        index_name: index
+        timeout: 8s
+routes:
+    route1:
+        readers: reader1
+        recorders: recorder1
+`
+
+func TestReadFileUnknownKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expipe_schema")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tcs := []struct {
+		name       string
+		file       string
+		content    string
+		key        string
+		line       int
+		suggestion string
+	}{
+		{"yaml", "expipe.yml", unknownKeysConf, "readers.reader1.intervall", 8, "readers.reader1.interval"},
+		{"settings", "expipe.yml", "setings:\n    lazy_ping: true\n", "setings", 1, "settings"},
+		{"nested", "expipe.yml", "settings:\n    log:\n        formatt: json\n", "settings.log.formatt", 3, "settings.log.format"},
+		{"json", "expipe.json", `{
+    "routes": {
+        "route1": {
+            "readers": ["reader1"],
+            "recorder": ["recorder1"]
+        }
+    }
+}`, "routes.route1.recorder", 5, "routes.route1.recorders"},
+		{"toml", "expipe.toml", "[settings]\nlazy_ping = true\n\n[settings.http]\nprxy = \"x\"\n", "settings.http.prxy", 5, "settings.http.proxy"},
+		{"no suggestion", "expipe.yml", "something_else: true\n", "something_else", 1, ""},
+		{"defaults", "expipe.yml", "defaults:\n    timeout: 1s\n    readers:\n        index_name: x\n", "defaults.readers.index_name", 4, ""},
+		{"struct", "expipe.yml", "readers:\n    reader1:\n        type: expvar\n        flatten:\n            max_dept: 2\n", "readers.reader1.flatten.max_dept", 5, "readers.reader1.flatten.max_depth"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			file := path.Join(dir, tc.file)
+			if err := ioutil.WriteFile(file, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			defer os.Remove(file)
+			_, err := config.ReadFile(tools.DiscardLogger(), file)
+			e, ok := err.(*config.UnknownKeyError)
+			if !ok {
+				t.Fatalf("err = (%v); want (*config.UnknownKeyError)", err)
+			}
+			if e.Key != tc.key {
+				t.Errorf("Key = (%s); want (%s)", e.Key, tc.key)
+			}
+			if e.File != file || e.Line != tc.line {
+				t.Errorf("position = (%s:%d); want (%s:%d)", e.File, e.Line, file, tc.line)
+			}
+			if e.Suggestion != tc.suggestion {
+				t.Errorf("Suggestion = (%s); want (%s)", e.Suggestion, tc.suggestion)
+			}
+		})
+	}
+}
+
+func TestLoadYAMLUnknownKeys(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(unknownKeysConf))
+	_, err := config.LoadYAML(tools.DiscardLogger(), v)
+	e, ok := err.(*config.UnknownKeyError)
+	if !ok {
+		t.Fatalf("err = (%v); want (*config.UnknownKeyError)", err)
+	}
+	if e.Line != 0 {
+		t.Errorf("Line = (%d); want (0)", e.Line)
+	}
+	want := "unknown key readers.reader1.intervall, did you mean readers.reader1.interval?"
+	if e.Error() != want {
+		t.Errorf("Error() = (%s); want (%s)", e.Error(), want)
+	}
+}
+
+func TestTypes(t *testing.T) {
+	readers, recorders := config.Types()
+	if want := []string{"expvar", "plugin", "receiver", "self"}; !reflect.DeepEqual(readers, want) {
+		t.Errorf("readers = (%v); want (%v)", readers, want)
+	}
+	if want := []string{"elasticsearch", "forwarder", "plugin"}; !reflect.DeepEqual(recorders, want) {
+		t.Errorf("recorders = (%v); want (%v)", recorders, want)
+	}
+}
@@ -7,15 +7,25 @@
 package config
 
 import (
+	"fmt"
+	"net"
 	"strings"
+	"time"
 
+	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
 	"github.com/alext234/expipe/recorder"
-
-	"github.com/alext234/expipe/reader/expvar"
-	"github.com/alext234/expipe/reader/self"
-	"github.com/alext234/expipe/recorder/elasticsearch"
 	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/alert"
+	"github.com/alext234/expipe/tools/condition"
+	"github.com/alext234/expipe/tools/drift"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/limits"
+	"github.com/alext234/expipe/tools/listener"
+	"github.com/alext234/expipe/tools/mute"
+	"github.com/alext234/expipe/tools/sample"
+	"github.com/alext234/expipe/tools/tenant"
+	"github.com/alext234/expipe/tools/trace"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
@@ -23,7 +33,38 @@ import (
 const (
 	selfReader            = "self"
 	expvarReader          = "expvar"
+	pluginReader          = "plugin"
+	receiverReader        = "receiver"
 	elasticsearchRecorder = "elasticsearch"
+	pluginRecorder        = "plugin"
+	forwarderRecorder     = "forwarder"
+)
+
+// The policies of the OnRecorderFailure setting.
+const (
+	// RecorderFailureDegrade logs the errors of the recorders and drops their
+	// results, while the other recorders keep recording.
+	RecorderFailureDegrade = "degrade"
+
+	// RecorderFailureExit stops the Service when all recorders are down,
+	// therefore the process exits with a non-zero status and its supervisor
+	// can restart it.
+	RecorderFailureExit = "exit"
+
+	// RecorderFailureBuffer keeps the results of the failed jobs in memory and
+	// records them again when their recorders recover.
+	RecorderFailureBuffer = "buffer"
+)
+
+// The modes of the DeliveryMode setting.
+const (
+	// DeliveryAtMostOnce records each result once. The results of the failed
+	// jobs are handled by the OnRecorderFailure policy.
+	DeliveryAtMostOnce = "at_most_once"
+
+	// DeliveryAtLeastOnce holds the results until their recorders acknowledge
+	// them, and records the failed ones again until they are recorded.
+	DeliveryAtLeastOnce = "at_least_once"
 )
 
 // routeMap looks like this:
@@ -33,8 +74,16 @@ const (
 // }
 type routeMap map[string]route
 type route struct {
-	readers   []string
-	recorders []string
+	readers     []string
+	recorders   []string
+	gcTypes     []string
+	memoryTypes map[string]string
+	fields      map[string]string
+	tenant      string
+	sample      string
+	recordWhen  interface{}
+	mute        interface{}
+	fallbacks   map[string]string // keyed by the primary recorders.
 }
 
 // ConfMap holds the relation between readers and recorders.
@@ -49,52 +98,756 @@ type ConfMap struct {
 	// map["red1"][]string{"rec1", "rec2"}: means whatever is read
 	// from red1, will be shipped to rec1 and rec2.
 	Routes map[string][]string
+
+	// Mappers contains the mappers of the routes that set their own gc_types,
+	// memory_bytes or fields, keyed by the reader and then the recorder names.
+	// The mappings are added to the mapper of the reader.
+	Mappers map[string]map[string]datatype.Mapper
+
+	// Tenants contains the tenants of the routes that set one, keyed by the
+	// reader and then the recorder names.
+	Tenants map[string]map[string]*tenant.Tenant
+
+	// Samples contains the samplers of the routes that set a sample rate,
+	// keyed by the reader and then the recorder names.
+	Samples map[string]map[string]*sample.Sampler
+
+	// Conditions contains the conditions of the routes that set record_when
+	// rules, keyed by the reader and then the recorder names.
+	Conditions map[string]map[string]*condition.Condition
+
+	// Mutes contains the maintenance windows of the routes that set mute,
+	// keyed by the reader and then the recorder names. The results are not
+	// recorded into the recorders during the windows.
+	Mutes map[string]map[string]mute.Schedule
+
+	// ReaderMutes contains the maintenance windows of the readers that set
+	// mute, keyed by the reader names. The readers are not read during the
+	// windows.
+	ReaderMutes map[string]mute.Schedule
+
+	// Drifts contains the schema drift detectors of the readers that set
+	// schema_drift, keyed by the reader names.
+	Drifts map[string]*drift.Detector
+
+	// ScrapeOnStart contains the readers that set scrape_on_start. They are
+	// read as soon as their Engines start, instead of after their first
+	// intervals.
+	ScrapeOnStart map[string]bool
+
+	// Fallbacks contains the fallback recorders of the routes, keyed by the
+	// reader and then the primary recorder names. The fallbacks are in the
+	// Routes as well, but they are only recorded into while their primaries
+	// are down.
+	Fallbacks map[string]map[string]string
+
+	// Projections contains the allowed fields of the recorders that set
+	// allow_fields, keyed by the recorder names. Only these fields of the
+	// results are recorded, whichever routes the recorders are in.
+	Projections map[string]*datatype.Projection
+
+	// Plan holds the reader and recorder pairs of the Routes with the names of
+	// the routes that pair them.
+	Plan RoutePlan
+
+	// Settings contains the application scope settings.
+	Settings Settings
+}
+
+// Settings holds the application scope settings defined in the settings
+// section of the configuration file.
+type Settings struct {
+	// LogLevel is the level of the logs: debug, info, warn or error.
+	LogLevel string
+
+	// Log sets the format and the destination of the logs.
+	Log tools.LogConfig
+
+	// LazyPing lets the application start even if some of the endpoints are
+	// not available at boot. They will be pinged again in the background.
+	LazyPing bool
+
+	// Cluster shares the readers between multiple instances of expipe.
+	Cluster Cluster
+
+	// LeaderLock is the path of a lock file. If set, only the instance that
+	// holds the lock scrapes the readers, and the others wait for it.
+	LeaderLock string
+
+	// PIDFile is the path of a lock file that holds the pid of the running
+	// instance. If set, a second instance started with the same file refuses
+	// to run.
+	PIDFile string
+
+	// FlushInterval batches the results destined for each recorder and ships
+	// them on every interval. Batching is disabled when it is zero.
+	FlushInterval time.Duration
+
+	// JobGracePeriod is the time the readers and recorders are given after
+	// their timeouts before their jobs are cancelled. It is the
+	// engine.DefaultGracePeriod if zero.
+	JobGracePeriod time.Duration
+
+	// ClockSkewThreshold is the difference between the clocks of the
+	// recorders and the local clock that is warned about. It is the
+	// engine.DefaultClockSkewThreshold if zero.
+	ClockSkewThreshold time.Duration
+
+	// HTTP configures the http client shared by the readers and recorders,
+	// see httpclient.Configure.
+	HTTP httpclient.Config
+
+	// Tracing sends the spans of the read, map and record steps of the jobs to
+	// an OpenTelemetry collector. See the trace package.
+	Tracing trace.Config
+
+	// AnnotateReads adds the scrape_duration_ms and staleness_ms fields to
+	// all the documents. See engine.WithReadAnnotations.
+	AnnotateReads bool
+
+	// MetricsAddr is the address for serving the metrics of expipe itself in
+	// the Prometheus format on /metrics, and in the expvar format on
+	// /debug/vars. The metrics are not served if it is empty.
+	MetricsAddr string
+
+	// Dashboard serves a status page of the routes, the last jobs of the
+	// readers and recorders, and the queue depths on "/" of the MetricsAddr.
+	Dashboard bool
+
+	// DebugAddr is the address for serving the pprof profiles, the expvar
+	// variables and the metrics on a dedicated listener. The self readers
+	// ping this listener. It is not served if it is empty.
+	DebugAddr string
+
+	// ListenTLS serves the metrics, the dashboard and the debug listeners over
+	// TLS, and requires the client certificates if its ClientCAFile is set.
+	// The self readers read the debug listener over https.
+	ListenTLS listener.TLS
+
+	// Events configures the log of the lifecycle events of the Engines.
+	Events Events
+
+	// Alerts notifies the operators when a reader or recorder keeps failing or
+	// is removed from its Engine. See the alert package.
+	Alerts alert.Config
+
+	// OnRecorderFailure is one of the RecorderFailureDegrade,
+	// RecorderFailureExit and RecorderFailureBuffer policies. A recorder is
+	// down after the ErrorThreshold of the Alerts consecutive failed jobs.
+	// It is RecorderFailureDegrade if empty.
+	OnRecorderFailure string
+
+	// DeliveryMode is one of the DeliveryAtMostOnce and DeliveryAtLeastOnce
+	// modes. It is DeliveryAtMostOnce if empty.
+	DeliveryMode string
+
+	// MaxUnackedJobs is the number of the results each recorder holds with
+	// the DeliveryAtLeastOnce mode before the reads of its routes are paused.
+	// The engine's default is used if zero.
+	MaxUnackedJobs int
+
+	// AllowDuplicates lets more than one route pair the same reader and
+	// recorder, which are recorded once. The configuration is rejected
+	// otherwise, see Plan.
+	AllowDuplicates bool
+
+	// StateDumpFile is the file the state of the engine is written to on
+	// SIGUSR1. The state is logged if it is empty.
+	StateDumpFile string
+
+	// Runtime sets the memory limit and the GOMAXPROCS of the process. The
+	// read jobs are shed while the memory is close to the limit.
+	Runtime limits.Config
+}
+
+// Events holds the settings of the event log, which keeps the latest changes
+// in the topology of the Engines.
+type Events struct {
+	// Size is the number of events that are kept.
+	Size int
+
+	// Ship publishes the last event as an expvar variable, therefore the self
+	// readers record it.
+	Ship bool
+}
+
+// Cluster holds the settings for running multiple instances of expipe. Each
+// reader is scraped by the instance that owns the reader's name on a hash ring
+// of the Peers. If Peers is empty, the instance scrapes all the readers.
+type Cluster struct {
+	// Self is the name of this instance, it should be one of the Peers.
+	Self string
+
+	// Peers are the names of all instances of expipe. They should be the same
+	// on all instances.
+	Peers []string
 }
 
-// Checks the application scope settings. Applies them if defined. If the log
-// level is defined, it will replace a new logger with the provided one.
-func checkSettingsSect(log *tools.Logger, v *viper.Viper) error {
+// Checks the application scope settings and records them in the settings.
+// They are not applied here, parsing a file does not change the logger or the
+// http client of the running application.
+func checkSettingsSect(v *viper.Viper, settings *Settings) error {
 	if v.IsSet("settings.log_level") {
-		newLevel, ok := v.Get("settings.log_level").(string)
+		level, ok := v.Get("settings.log_level").(string)
 		if !ok {
 			return &StructureErr{"log_level", "should be a string", nil}
 		}
-		*log = *tools.GetLogger(newLevel)
+		settings.LogLevel = level
+	}
+	if v.IsSet("settings.log") {
+		conf, err := checkLogSect(v)
+		if err != nil {
+			return err
+		}
+		settings.Log = conf
+	}
+	if v.IsSet("settings.lazy_ping") {
+		lazyPing, ok := v.Get("settings.lazy_ping").(bool)
+		if !ok {
+			return &StructureErr{"lazy_ping", "should be a boolean", nil}
+		}
+		settings.LazyPing = lazyPing
+	}
+	if v.IsSet("settings.allow_duplicates") {
+		allow, ok := v.Get("settings.allow_duplicates").(bool)
+		if !ok {
+			return &StructureErr{"allow_duplicates", "should be a boolean", nil}
+		}
+		settings.AllowDuplicates = allow
+	}
+	if v.IsSet("settings.tracing") {
+		conf, err := checkTracingSect(v)
+		if err != nil {
+			return err
+		}
+		settings.Tracing = conf
+	}
+	if v.IsSet("settings.annotate_reads") {
+		annotate, ok := v.Get("settings.annotate_reads").(bool)
+		if !ok {
+			return &StructureErr{"annotate_reads", "should be a boolean", nil}
+		}
+		settings.AnnotateReads = annotate
+	}
+	if v.IsSet("settings.metrics_addr") {
+		addr, ok := v.Get("settings.metrics_addr").(string)
+		if !ok {
+			return &StructureErr{"metrics_addr", "should be a string", nil}
+		}
+		settings.MetricsAddr = addr
+	}
+	if v.IsSet("settings.dashboard") {
+		dashboard, ok := v.Get("settings.dashboard").(bool)
+		if !ok {
+			return &StructureErr{"dashboard", "should be a boolean", nil}
+		}
+		settings.Dashboard = dashboard
+	}
+	if v.IsSet("settings.debug_addr") {
+		addr, ok := v.Get("settings.debug_addr").(string)
+		if !ok {
+			return &StructureErr{"debug_addr", "should be a string", nil}
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return &StructureErr{"debug_addr", "should be a host:port", err}
+		}
+		settings.DebugAddr = addr
+	}
+	if v.IsSet("settings.leader_lock") {
+		lock, ok := v.Get("settings.leader_lock").(string)
+		if !ok {
+			return &StructureErr{"leader_lock", "should be a string", nil}
+		}
+		settings.LeaderLock = lock
+	}
+	if v.IsSet("settings.pid_file") {
+		file, ok := v.Get("settings.pid_file").(string)
+		if !ok {
+			return &StructureErr{"pid_file", "should be a string", nil}
+		}
+		settings.PIDFile = file
+	}
+	if v.IsSet("settings.state_dump_file") {
+		file, ok := v.Get("settings.state_dump_file").(string)
+		if !ok {
+			return &StructureErr{"state_dump_file", "should be a string", nil}
+		}
+		settings.StateDumpFile = file
+	}
+	if v.IsSet("settings.on_recorder_failure") {
+		policy := strings.ToLower(v.GetString("settings.on_recorder_failure"))
+		if policy != RecorderFailureDegrade && policy != RecorderFailureExit && policy != RecorderFailureBuffer {
+			reason := fmt.Sprintf("should be one of %s, %s and %s", RecorderFailureDegrade, RecorderFailureExit, RecorderFailureBuffer)
+			return &StructureErr{"on_recorder_failure", reason, nil}
+		}
+		settings.OnRecorderFailure = policy
+	}
+	if v.IsSet("settings.delivery_mode") {
+		mode := strings.ToLower(v.GetString("settings.delivery_mode"))
+		if mode != DeliveryAtMostOnce && mode != DeliveryAtLeastOnce {
+			reason := fmt.Sprintf("should be one of %s and %s", DeliveryAtMostOnce, DeliveryAtLeastOnce)
+			return &StructureErr{"delivery_mode", reason, nil}
+		}
+		settings.DeliveryMode = mode
+	}
+	if v.IsSet("settings.max_unacked_jobs") {
+		n, ok := getInt(v, "settings.max_unacked_jobs")
+		if !ok || n <= 0 {
+			return &StructureErr{"max_unacked_jobs", "should be a positive integer", nil}
+		}
+		settings.MaxUnackedJobs = n
+	}
+	if v.IsSet("settings.flush_interval") {
+		flush, err := time.ParseDuration(v.GetString("settings.flush_interval"))
+		if err != nil || flush < 0 {
+			return &StructureErr{"flush_interval", "should be a positive duration", err}
+		}
+		settings.FlushInterval = flush
+	}
+	if v.IsSet("settings.job_grace_period") {
+		grace, err := time.ParseDuration(v.GetString("settings.job_grace_period"))
+		if err != nil || grace <= 0 {
+			return &StructureErr{"job_grace_period", "should be a positive duration", err}
+		}
+		settings.JobGracePeriod = grace
+	}
+	if v.IsSet("settings.clock_skew_threshold") {
+		threshold, err := time.ParseDuration(v.GetString("settings.clock_skew_threshold"))
+		if err != nil || threshold <= 0 {
+			return &StructureErr{"clock_skew_threshold", "should be a positive duration", err}
+		}
+		settings.ClockSkewThreshold = threshold
+	}
+	if v.IsSet("settings.cluster") {
+		cluster, err := checkClusterSect(v)
+		if err != nil {
+			return err
+		}
+		settings.Cluster = cluster
+	}
+	if v.IsSet("settings.http") {
+		conf, err := checkHTTPSect(v)
+		if err != nil {
+			return err
+		}
+		if _, err = httpclient.New(conf); err != nil {
+			return &StructureErr{"http", "invalid client settings", err}
+		}
+		settings.HTTP = conf
+	}
+	if v.IsSet("settings.listen_tls") {
+		conf, err := checkListenTLSSect(v)
+		if err != nil {
+			return err
+		}
+		settings.ListenTLS = conf
+	}
+	if v.IsSet("settings.events.size") {
+		size, ok := getInt(v, "settings.events.size")
+		if !ok || size <= 0 {
+			return &StructureErr{"events", "size should be a positive integer", nil}
+		}
+		settings.Events.Size = size
+	}
+	if v.IsSet("settings.events.ship") {
+		ship, ok := v.Get("settings.events.ship").(bool)
+		if !ok {
+			return &StructureErr{"events", "ship should be a boolean", nil}
+		}
+		settings.Events.Ship = ship
+	}
+	if v.IsSet("settings.alerts") {
+		conf, err := checkAlertsSect(v)
+		if err != nil {
+			return err
+		}
+		settings.Alerts = conf
+	}
+	if v.IsSet("settings.runtime") {
+		conf, err := checkRuntimeSect(v)
+		if err != nil {
+			return err
+		}
+		settings.Runtime = conf
 	}
 	return nil
 }
 
-// LoadYAML loads the settings from the configuration file. It returns any
-// errors returned from readers/recorders. Please refer to their documentations.
+// getInt returns the integer value of the key. The numbers are decoded as
+// float64 from json and as int64 from toml files.
+func getInt(v *viper.Viper, key string) (int, bool) {
+	switch n := v.Get(key).(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		if n == float64(int(n)) {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+func checkLogSect(v *viper.Viper) (tools.LogConfig, error) {
+	var c tools.LogConfig
+	for key, dst := range map[string]*string{
+		"format": &c.Format,
+		"file":   &c.File,
+	} {
+		if !v.IsSet("settings.log." + key) {
+			continue
+		}
+		s, ok := v.Get("settings.log." + key).(string)
+		if !ok {
+			return c, &StructureErr{"log", key + " should be a string", nil}
+		}
+		*dst = s
+	}
+	if v.IsSet("settings.log.max_size_mb") {
+		n, ok := getInt(v, "settings.log.max_size_mb")
+		if !ok || n < 0 {
+			return c, &StructureErr{"log", "max_size_mb should be a positive integer", nil}
+		}
+		c.MaxSize = int64(n) << 20
+	}
+	if v.IsSet("settings.log.max_backups") {
+		n, ok := getInt(v, "settings.log.max_backups")
+		if !ok || n < 0 {
+			return c, &StructureErr{"log", "max_backups should be a positive integer", nil}
+		}
+		c.MaxBackups = n
+	}
+	if err := c.Validate(); err != nil {
+		return c, &StructureErr{"log", "invalid log settings", err}
+	}
+	return c, nil
+}
+
+func checkAlertsSect(v *viper.Viper) (alert.Config, error) {
+	var c alert.Config
+	if v.IsSet("settings.alerts.error_threshold") {
+		n, ok := getInt(v, "settings.alerts.error_threshold")
+		if !ok || n <= 0 {
+			return c, &StructureErr{"alerts", "error_threshold should be a positive integer", nil}
+		}
+		c.ErrorThreshold = int64(n)
+	}
+	for key, dst := range map[string]*string{
+		"webhook":        &c.Webhook,
+		"slack":          &c.Slack,
+		"email.username": &c.Email.Username,
+		"email.password": &c.Email.Password,
+	} {
+		s, ok, err := secretFile(v, "settings.alerts."+key)
+		if err != nil {
+			return c, &StructureErr{"alerts", "", err}
+		}
+		if ok {
+			*dst = s
+		}
+	}
+	for key, dst := range map[string]*string{
+		"webhook":        &c.Webhook,
+		"slack":          &c.Slack,
+		"email.smtp":     &c.Email.Addr,
+		"email.username": &c.Email.Username,
+		"email.password": &c.Email.Password,
+		"email.from":     &c.Email.From,
+	} {
+		if !v.IsSet("settings.alerts." + key) {
+			continue
+		}
+		s, ok := v.Get("settings.alerts." + key).(string)
+		if !ok {
+			return c, &StructureErr{"alerts", key + " should be a string", nil}
+		}
+		*dst = s
+	}
+	for _, url := range []*string{&c.Webhook, &c.Slack} {
+		if *url == "" {
+			continue
+		}
+		u, err := tools.SanitiseURL(*url)
+		if err != nil {
+			return c, &StructureErr{"alerts", "invalid url", err}
+		}
+		*url = u
+	}
+	if c.Email.Addr == "" {
+		return c, nil
+	}
+	to, ok := v.Get("settings.alerts.email.to").([]interface{})
+	if !ok || len(to) == 0 {
+		return c, &StructureErr{"alerts", "email.to should be a list", nil}
+	}
+	for _, t := range to {
+		addr, ok := t.(string)
+		if !ok {
+			return c, &StructureErr{"alerts", "email.to should be strings", nil}
+		}
+		c.Email.To = append(c.Email.To, addr)
+	}
+	if c.Email.From == "" {
+		return c, &StructureErr{"alerts", "email.from is required", nil}
+	}
+	return c, nil
+}
+
+// secretFile returns the content of the file at the key with the _file suffix,
+// which is the variant of the credential options for keeping the secrets out
+// of the configuration file. It returns false if it is not set, and an error
+// if the key itself is also set.
+func secretFile(v *viper.Viper, key string) (string, bool, error) {
+	if !v.IsSet(key + "_file") {
+		return "", false, nil
+	}
+	name := key[strings.LastIndex(key, ".")+1:]
+	if v.IsSet(key) {
+		return "", false, errors.Errorf("only one of %s and %s_file should be set", name, name)
+	}
+	s, err := tools.ReadSecretFile(v.GetString(key + "_file"))
+	if err != nil {
+		return "", false, errors.Wrap(err, name+"_file")
+	}
+	return s, true, nil
+}
+
+func checkHTTPSect(v *viper.Viper) (httpclient.Config, error) {
+	var c httpclient.Config
+	if v.IsSet("settings.http.max_idle_conns_per_host") {
+		n, ok := getInt(v, "settings.http.max_idle_conns_per_host")
+		if !ok || n < 0 {
+			return c, &StructureErr{"http", "max_idle_conns_per_host should be a positive integer", nil}
+		}
+		c.MaxIdleConnsPerHost = n
+	}
+	if v.IsSet("settings.http.idle_conn_timeout") {
+		d, err := time.ParseDuration(v.GetString("settings.http.idle_conn_timeout"))
+		if err != nil || d < 0 {
+			return c, &StructureErr{"http", "idle_conn_timeout should be a positive duration", err}
+		}
+		c.IdleConnTimeout = d
+	}
+	for key, dst := range map[string]*string{
+		"proxy":            &c.Proxy,
+		"ca_file":          &c.CAFile,
+		"client_cert_file": &c.CertFile,
+		"client_key_file":  &c.KeyFile,
+	} {
+		if !v.IsSet("settings.http." + key) {
+			continue
+		}
+		s, ok := v.Get("settings.http." + key).(string)
+		if !ok {
+			return c, &StructureErr{"http", key + " should be a string", nil}
+		}
+		*dst = s
+	}
+	for key, dst := range map[string]*bool{
+		"insecure_skip_verify": &c.InsecureSkipVerify,
+		"disable_http2":        &c.DisableHTTP2,
+	} {
+		if !v.IsSet("settings.http." + key) {
+			continue
+		}
+		b, ok := v.Get("settings.http." + key).(bool)
+		if !ok {
+			return c, &StructureErr{"http", key + " should be a boolean", nil}
+		}
+		*dst = b
+	}
+	return c, nil
+}
+
+// checkRuntimeSect returns the runtime limits. The memory_limit is a size like
+// 512MB, and the gomaxprocs is a number or auto for the CPU quota of the
+// cgroup.
+func checkRuntimeSect(v *viper.Viper) (limits.Config, error) {
+	var c limits.Config
+	if v.IsSet("settings.runtime.memory_limit") {
+		size, err := limits.ParseSize(v.GetString("settings.runtime.memory_limit"))
+		if err != nil || size == 0 {
+			return c, &StructureErr{"runtime", "memory_limit should be a size, for example 512MB", err}
+		}
+		c.MemoryLimit = size
+	}
+	if v.IsSet("settings.runtime.shed_ratio") {
+		ratio := v.GetFloat64("settings.runtime.shed_ratio")
+		if ratio <= 0 || ratio > 1 {
+			return c, &StructureErr{"runtime", "shed_ratio should be between 0 and 1", nil}
+		}
+		if c.MemoryLimit == 0 {
+			return c, &StructureErr{"runtime", "shed_ratio needs the memory_limit", nil}
+		}
+		c.ShedRatio = ratio
+	}
+	if v.IsSet("settings.runtime.gomaxprocs") {
+		if strings.ToLower(v.GetString("settings.runtime.gomaxprocs")) == "auto" {
+			c.GOMAXPROCS = limits.AutoProcs
+		} else if n, ok := getInt(v, "settings.runtime.gomaxprocs"); ok && n > 0 {
+			c.GOMAXPROCS = n
+		} else {
+			return c, &StructureErr{"runtime", "gomaxprocs should be a positive integer or auto", nil}
+		}
+	}
+	return c, nil
+}
+
+// checkTracingSect returns the tracing settings. The section is either a
+// boolean, which uses the default endpoint of the exporter, or a map of the
+// enabled, endpoint and sample_ratio keys. The tracing is enabled by the map
+// unless its enabled key is false.
+func checkTracingSect(v *viper.Viper) (trace.Config, error) {
+	var c trace.Config
+	if enabled, ok := v.Get("settings.tracing").(bool); ok {
+		c.Enabled = enabled
+		return c, nil
+	}
+	if !v.IsSet("settings.tracing.enabled") && !v.IsSet("settings.tracing.endpoint") &&
+		!v.IsSet("settings.tracing.sample_ratio") {
+		return c, &StructureErr{"tracing", "should be a boolean or a map", nil}
+	}
+	c.Enabled = true
+	if v.IsSet("settings.tracing.enabled") {
+		enabled, ok := v.Get("settings.tracing.enabled").(bool)
+		if !ok {
+			return c, &StructureErr{"tracing", "enabled should be a boolean", nil}
+		}
+		c.Enabled = enabled
+	}
+	if v.IsSet("settings.tracing.endpoint") {
+		endpoint, ok := v.Get("settings.tracing.endpoint").(string)
+		if !ok {
+			return c, &StructureErr{"tracing", "endpoint should be a string", nil}
+		}
+		c.Endpoint = endpoint
+	}
+	if v.IsSet("settings.tracing.sample_ratio") {
+		c.SampleRatio = v.GetFloat64("settings.tracing.sample_ratio")
+		if c.SampleRatio <= 0 {
+			return c, &StructureErr{"tracing", "sample_ratio should be between 0 and 1", nil}
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return c, &StructureErr{"tracing", "invalid tracing settings", err}
+	}
+	return c, nil
+}
+
+func checkListenTLSSect(v *viper.Viper) (listener.TLS, error) {
+	var c listener.TLS
+	for key, dst := range map[string]*string{
+		"cert_file":      &c.CertFile,
+		"key_file":       &c.KeyFile,
+		"client_ca_file": &c.ClientCAFile,
+	} {
+		if !v.IsSet("settings.listen_tls." + key) {
+			continue
+		}
+		s, ok := v.Get("settings.listen_tls." + key).(string)
+		if !ok {
+			return c, &StructureErr{"listen_tls", key + " should be a string", nil}
+		}
+		*dst = s
+	}
+	if _, err := c.Config(); err != nil {
+		return c, &StructureErr{"listen_tls", "invalid listener settings", err}
+	}
+	return c, nil
+}
+
+func checkClusterSect(v *viper.Viper) (Cluster, error) {
+	var c Cluster
+	self, ok := v.Get("settings.cluster.self").(string)
+	if !ok || self == "" {
+		return c, &StructureErr{"cluster", "self should be a string", nil}
+	}
+	peers, ok := v.Get("settings.cluster.peers").([]interface{})
+	if !ok || len(peers) == 0 {
+		return c, &StructureErr{"cluster", "peers should be a list", nil}
+	}
+	var found bool
+	for _, p := range peers {
+		peer, ok := p.(string)
+		if !ok {
+			return c, &StructureErr{"cluster", "peers should be strings", nil}
+		}
+		if peer == self {
+			found = true
+		}
+		c.Peers = append(c.Peers, peer)
+	}
+	if !found {
+		return c, &StructureErr{"cluster", "self should be one of the peers", nil}
+	}
+	c.Self = self
+	return c, nil
+}
+
+// LoadYAML loads the settings from the configuration file, which can be in any
+// of the Formats despite its name. The ${VAR} and ${VAR:default} references to
+// the environment variables are expanded in all strings, see tools.ExpandEnv.
+// The readers of the reader_templates section are added to the readers, and
+// the values of the defaults section are inherited by the readers and
+// recorders that do not set them.
+// It returns an UnknownKeyError if any of the keys is not known.
+// The readers and recorders of the routes can be globs or regular expressions
+// between slashes, which are expanded to the names they match. It returns a
+// RoutersError if more than one route pairs a reader and a recorder, unless
+// the allow_duplicates setting is set.
+// The log_level, log and http settings are only checked and recorded in the
+// Settings; the log is not changed, and it is up to the caller to apply them.
+// It returns any errors returned from readers/recorders. Please refer to their
+// documentations.
 func LoadYAML(log *tools.Logger, v *viper.Viper) (*ConfMap, error) {
 	var (
 		readerKeys   map[string]string
 		recorderKeys map[string]string
 		routes       routeMap
+		settings     Settings
+		confMap      *ConfMap
 		err          error
 	)
 	if len(v.AllSettings()) == 0 {
 		return nil, ErrEmptyConfig
 	}
+	if err = checkKeys(v); err != nil {
+		return nil, err
+	}
+	if v, err = expandEnv(v); err != nil {
+		return nil, err
+	}
+	if v.IsSet("reader_templates") {
+		if err = expandTemplates(v); err != nil {
+			return nil, err
+		}
+	}
+	if v.IsSet("defaults") {
+		if err = applyDefaults(v); err != nil {
+			return nil, err
+		}
+	}
 	if v.IsSet("settings") {
-		if err = checkSettingsSect(log, v); err != nil {
+		if err = checkSettingsSect(v, &settings); err != nil {
 			return nil, &StructureErr{"settings", "", err}
 		}
 	}
 
-	if readerKeys, err = getReaders(v); err != nil {
-		return nil, errors.WithMessage(err, "readerKeys")
+	if routes, readerKeys, recorderKeys, err = loadRoutes(log, v); err != nil {
+		return nil, err
 	}
-	if recorderKeys, err = getRecorders(v); err != nil {
-		return nil, errors.WithMessage(err, "recorderKeys")
+	if confMap, err = loadConfiguration(v, log, routes, readerKeys, recorderKeys); err != nil {
+		return nil, err
 	}
-	if routes, err = getRoutes(v); err != nil {
-		return nil, errors.WithMessage(err, "routes")
-	}
-	if err = checkAgainstReadRecorders(routes, readerKeys, recorderKeys); err != nil {
-		return nil, errors.WithMessage(err, "checkAgainstReadRecorders")
+	confMap.Plan = planRoutes(routes)
+	if !settings.AllowDuplicates {
+		if err = checkDuplicates(confMap.Plan); err != nil {
+			return nil, err
+		}
 	}
-	return loadConfiguration(v, log, routes, readerKeys, recorderKeys)
+	confMap.Settings = settings
+	return confMap, nil
 }
 
 // readers is a map of keyName:typeName
@@ -104,17 +857,12 @@ func getReaders(v *viper.Viper) (map[string]string, error) {
 	if !v.IsSet("readers") {
 		return nil, NewNotSpecifiedError("readers", "", nil)
 	}
-	for reader := range v.GetStringMap("readers") {
-		switch rType := v.GetString("readers." + reader + ".type"); rType {
-		case selfReader:
-			readers[reader] = rType
-		case expvarReader:
-			readers[reader] = rType
-		case "":
-			fallthrough
-		default:
-			return nil, NewNotSpecifiedError(reader, "type", nil)
+	for name := range v.GetStringMap("readers") {
+		rType := v.GetString("readers." + name + ".type")
+		if _, ok := reader.Lookup(rType); !ok {
+			return nil, NewNotSpecifiedError(name, "type", nil)
 		}
+		readers[name] = rType
 	}
 	return readers, nil
 }
@@ -126,15 +874,12 @@ func getRecorders(v *viper.Viper) (map[string]string, error) {
 	if !v.IsSet("recorders") {
 		return nil, NewNotSpecifiedError("recorders", "", nil)
 	}
-	for recorder := range v.GetStringMap("recorders") {
-		switch rType := v.GetString("recorders." + recorder + ".type"); rType {
-		case elasticsearchRecorder:
-			recorders[recorder] = rType
-		case "":
-			fallthrough
-		default:
-			return nil, NewNotSpecifiedError(recorder, "type", nil)
+	for name := range v.GetStringMap("recorders") {
+		rType := v.GetString("recorders." + name + ".type")
+		if _, ok := recorder.Lookup(rType); !ok {
+			return nil, NewNotSpecifiedError(name, "type", nil)
 		}
+		recorders[name] = rType
 	}
 	return recorders, nil
 }
@@ -146,20 +891,27 @@ func getRoutes(v *viper.Viper) (routeMap, error) {
 	}
 	for name := range v.GetStringMap("routes") {
 		rt := route{}
-		for recRedType, list := range v.GetStringMapStringSlice("routes." + name) {
-			for _, target := range list {
-				if strings.Contains(target, ",") {
-					return nil, NewRoutersError(recRedType, "not an array or single value", nil)
-				}
-
-				if recRedType == "readers" {
-					rt.readers = append(rt.readers, target)
-				} else if recRedType == "recorders" {
-					rt.recorders = append(rt.recorders, target)
-				}
+		for _, target := range v.GetStringSlice("routes." + name + ".readers") {
+			if strings.Contains(target, ",") {
+				return nil, NewRoutersError("readers", "not an array or single value", nil)
+			}
+			rt.readers = append(rt.readers, target)
+		}
+		if v.IsSet("routes." + name + ".recorders") {
+			var err error
+			rt.recorders, rt.fallbacks, err = routeRecorders(v.Get("routes." + name + ".recorders"))
+			if err != nil {
+				return nil, NewRoutersError("recorders", err.Error(), nil)
 			}
-			routes[name] = rt
 		}
+		rt.gcTypes = strings.Fields(strings.Join(v.GetStringSlice("routes."+name+".gc_types"), " "))
+		rt.memoryTypes = datatype.FlatMemoryTypes(v.GetStringMap("routes." + name + ".memory_bytes"))
+		rt.fields = datatype.FlatNames(v.GetStringMap("routes." + name + ".fields"))
+		rt.tenant = v.GetString("routes." + name + ".tenant")
+		rt.sample = v.GetString("routes." + name + ".sample")
+		rt.recordWhen = v.Get("routes." + name + ".record_when")
+		rt.mute = v.Get("routes." + name + ".mute")
+		routes[name] = rt
 
 		if len(routes[name].readers) == 0 {
 			return nil, NewRoutersError("readers", "is empty", nil)
@@ -202,6 +954,9 @@ func loadConfiguration(v *viper.Viper, log tools.FieldLogger, routes routeMap, r
 		if !readerInRoutes(name, routes) {
 			continue
 		}
+		if r, err = chaosReader(v, log, name, r); err != nil {
+			return nil, err
+		}
 		confMap.Readers[name] = r
 	}
 
@@ -213,9 +968,48 @@ func loadConfiguration(v *viper.Viper, log tools.FieldLogger, routes routeMap, r
 		if !recorderInRoutes(name, routes) {
 			continue
 		}
+		if r, err = chaosRecorder(v, log, name, r); err != nil {
+			return nil, err
+		}
 		confMap.Recorders[name] = r
 	}
 	confMap.Routes = mapReadersRecorders(routes)
+	mappers, err := routeMappers(routes, confMap.Readers)
+	if err != nil {
+		return nil, err
+	}
+	confMap.Mappers = mappers
+	tenants, err := getTenants(v)
+	if err != nil {
+		return nil, err
+	}
+	if confMap.Tenants, err = routeTenants(routes, tenants); err != nil {
+		return nil, err
+	}
+	if confMap.Samples, err = routeSamples(routes); err != nil {
+		return nil, err
+	}
+	if confMap.Conditions, err = routeConditions(routes); err != nil {
+		return nil, err
+	}
+	if confMap.Mutes, err = routeMutes(routes); err != nil {
+		return nil, err
+	}
+	if confMap.ReaderMutes, err = readerMutes(v, readerKeys); err != nil {
+		return nil, err
+	}
+	if confMap.Drifts, err = readerDrifts(v, readerKeys); err != nil {
+		return nil, err
+	}
+	if confMap.ScrapeOnStart, err = readersScrapeOnStart(v, readerKeys); err != nil {
+		return nil, err
+	}
+	if confMap.Fallbacks, err = routeFallbacks(routes); err != nil {
+		return nil, err
+	}
+	if confMap.Projections, err = recorderProjections(v, recorderKeys); err != nil {
+		return nil, err
+	}
 	return confMap, nil
 }
 
@@ -237,86 +1031,28 @@ func recorderInRoutes(name string, routes routeMap) bool {
 	return false
 }
 
+// parseReader returns the reader of the name with the factory of the
+// readerType in the reader registry.
 func parseReader(v *viper.Viper, log tools.FieldLogger, readerType, name string) (reader.DataReader, error) {
-	switch readerType {
-	case expvarReader:
-		rc, err := expvar.NewConfig(
-			expvar.WithLogger(log),
-			expvar.WithViper(v, name, "readers."+name),
-		)
-		if err != nil {
-			return nil, errors.Wrap(err, "parsing reader")
-		}
-		return rc.Reader()
-	case selfReader:
-		rc, err := self.NewConfig(
-			self.WithLogger(log),
-			self.WithViper(v, name, "readers."+name),
-		)
-		if err != nil {
-			return nil, errors.Wrap(err, "parsing reader")
-		}
-		return rc.Reader()
+	factory, ok := reader.Lookup(readerType)
+	if !ok {
+		return nil, NotSupportedError(readerType)
 	}
-	return nil, NotSupportedError(readerType)
+	return factory(v, log, name, "readers."+name)
 }
 
+// readRecorders returns the recorder of the name with the factory of the
+// recorderType in the recorder registry.
 func readRecorders(v *viper.Viper, log tools.FieldLogger, recorderType, name string) (recorder.DataRecorder, error) {
-	switch recorderType {
-	case elasticsearchRecorder:
-		rc, err := elasticsearch.NewConfig(
-			elasticsearch.WithViper(v, name, "recorders."+name),
-			elasticsearch.WithLogger(log),
-		)
-		if err != nil {
-			return nil, errors.Wrap(err, "read-recorders loading from viper")
-		}
-		return rc.Recorder()
+	factory, ok := recorder.Lookup(recorderType)
+	if !ok {
+		return nil, NotSupportedError(recorderType)
 	}
-	return nil, NotSupportedError(recorderType)
+	return factory(v, log, name, "recorders."+name)
 }
 
-// This function returns a map of reader->recorders
-// TODO: [refactor] this code
+// mapReadersRecorders returns the recorders of each reader of the routes. The
+// pairs that are in more than one route are listed once.
 func mapReadersRecorders(routes routeMap) map[string][]string {
-	// We don't know how this matrix will be, let's go dynamic! This looks ugly.
-	// The whole logic should change. But it doesn't have any impact on the
-	// program, it just runs once.
-	readerMap := make(map[string][]string) //
-	for _, route := range routes {
-		// Add the readers to the map
-		for _, redName := range route.readers {
-			// now iterate through the recorders and add them
-			for _, recName := range route.recorders {
-				if _, ok := readerMap[redName]; !ok {
-					readerMap[redName] = []string{recName}
-				} else {
-					readerMap[redName] = append(readerMap[redName], recName)
-					// Shall we go another level deep??? :p I'm kidding,
-					// seriously, refactor this thing Do you know why the
-					// chicken crossed the road? There was a few nested eggs on
-					// the other side! Okay, back to the business. BTW ask me
-					// why I left these comments.
-				}
-			}
-		}
-	}
-
-	// Let's clean up
-	resultMap := make(map[string][]string)
-	for redName, redsddd := range readerMap {
-		checkMap := make(map[string]bool)
-		for _, recName := range redsddd {
-			if _, ok := checkMap[recName]; !ok {
-				checkMap[recName] = true
-				if _, ok := resultMap[redName]; !ok {
-					resultMap[redName] = []string{recName}
-				} else {
-					resultMap[redName] = append(resultMap[redName], recName)
-					// Remember that chicken? It's roasted now.
-				}
-			}
-		}
-	}
-	return resultMap
+	return planRoutes(routes).Matrix()
 }
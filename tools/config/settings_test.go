@@ -7,13 +7,26 @@ package config_test
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/alext234/expipe/datatype"
 	"github.com/alext234/expipe/reader"
+	rt "github.com/alext234/expipe/reader/testing"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/recorder/elasticsearch"
+	rct "github.com/alext234/expipe/recorder/testing"
+	"github.com/alext234/expipe/testing/chaos"
 	"github.com/alext234/expipe/tools"
 	"github.com/alext234/expipe/tools/config"
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/limits"
+	"github.com/alext234/expipe/tools/trace"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
@@ -87,6 +100,500 @@ func TestLoadYAMLSuccess(t *testing.T) {
 	}
 }
 
+func TestLoadYAMLPlugins(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLPlugins")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if red := confMap.Readers["reader1"]; red == nil || red.Endpoint() != "./my-reader" {
+		t.Errorf("reader1 = (%v); want the ./my-reader plugin", red)
+	}
+	if rec := confMap.Recorders["recorder1"]; rec == nil || rec.Endpoint() != "./my-recorder" {
+		t.Errorf("recorder1 = (%v); want the ./my-recorder plugin", rec)
+	}
+}
+
+func TestLoadYAMLForwarding(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLForwarding")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if red := confMap.Readers["reader1"]; red == nil || red.Endpoint() != "127.0.0.1:9480" {
+		t.Errorf("reader1 = (%v); want the receiver on 127.0.0.1:9480", red)
+	}
+	if rec := confMap.Recorders["recorder1"]; rec == nil || rec.Endpoint() != "http://aggregator:9480" {
+		t.Errorf("recorder1 = (%v); want the forwarder to http://aggregator:9480", rec)
+	}
+}
+
+func TestLoadYAMLRegistered(t *testing.T) {
+	t.Parallel()
+	reader.Register("registered_reader", func(src reader.Source, log tools.FieldLogger, name, key string) (reader.DataReader, error) {
+		return rt.New(
+			reader.WithLogger(log),
+			reader.WithName(name),
+			reader.WithEndpoint(src.GetString(key+".endpoint")),
+		)
+	})
+	recorder.Register("registered_recorder", func(src recorder.Source, log tools.FieldLogger, name, key string) (recorder.DataRecorder, error) {
+		return rct.New(
+			recorder.WithLogger(log),
+			recorder.WithName(name),
+			recorder.WithEndpoint(src.GetString(key+".endpoint")),
+		)
+	})
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLRegistered")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, ok := confMap.Readers["reader1"].(*rt.Reader); !ok {
+		t.Errorf("reader1 = (%T); want (*rt.Reader)", confMap.Readers["reader1"])
+	}
+	if _, ok := confMap.Recorders["recorder1"].(*rct.Recorder); !ok {
+		t.Errorf("recorder1 = (%T); want (*rct.Recorder)", confMap.Recorders["recorder1"])
+	}
+}
+
+func TestLoadYAMLTenants(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLTenants")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(confMap.Tenants) != 2 || len(confMap.Tenants["app1"]) != 1 || len(confMap.Tenants["app2"]) != 2 {
+		t.Fatalf("Tenants = (%v); want app1 -> recorder1 and app2 -> recorder1, recorder2", confMap.Tenants)
+	}
+	payments := confMap.Tenants["app1"]["recorder1"]
+	if payments.ID != "payments" || payments.IndexPrefix != "pay_" {
+		t.Errorf("tenant = (%s, %s); want (payments, pay_)", payments.ID, payments.IndexPrefix)
+	}
+	if payments.MaxDocuments != 1000 || payments.MaxBytes != 1048576 || payments.Period != time.Hour {
+		t.Errorf("quotas = (%d, %d, %s); want (1000, 1048576, 1h)", payments.MaxDocuments, payments.MaxBytes, payments.Period)
+	}
+	search := confMap.Tenants["app2"]["recorder1"]
+	if search.ID != "search" || search.IndexPrefix != "search-" || search.MaxDocuments != 0 {
+		t.Errorf("tenant = (%s, %s, %d); want (search, search-, 0)", search.ID, search.IndexPrefix, search.MaxDocuments)
+	}
+	if confMap.Tenants["app2"]["recorder2"] != search {
+		t.Error("the recorders of a route should share the tenant")
+	}
+}
+
+func TestLoadYAMLTenantsErrors(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	tcs := []struct {
+		old, new string
+		want     string
+	}{
+		{"quota_period: 1h", "quota_period: nope", "quota_period"},
+		{"quota_period: 1h", "quota_period: -1h", "quota_period should be positive"},
+		{"max_documents: 1000", "max_documents: -1", "cannot be negative"},
+		{"index_prefix: pay_", "index_prefix: Pay_", "invalid index_prefix"},
+		{"index_prefix: pay_", "index_prefix: pay*", "invalid index_prefix"},
+		{"tenant: search", "tenant: Search", "invalid tenant"},
+		{"max_bytes: 1048576", "max_byte: 1048576", "tenants.payments.max_byte"},
+		{"tenant: search", "tenant: search\n    route3:\n        readers: [app1]\n        recorders: [recorder1]\n        tenant: search", "app1 -> recorder1"},
+	}
+	for _, tc := range tcs {
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLTenants")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(input.Body)
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(strings.NewReader(strings.Replace(body.String(), tc.old, tc.new, 1)))
+		_, err = config.LoadYAML(log, v)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = (%v); want (%s)", tc.new, err, tc.want)
+		}
+	}
+}
+
+func TestLoadYAMLSamples(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSamples")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(confMap.Samples) != 1 || len(confMap.Samples["app1"]) != 1 {
+		t.Fatalf("Samples = (%v); want only app1 -> recorder1", confMap.Samples)
+	}
+	if s := confMap.Samples["app1"]["recorder1"]; s.N != 1 || s.M != 10 {
+		t.Errorf("sample = (%s); want (1/10)", s)
+	}
+
+	tcs := []struct {
+		old, new string
+		want     string
+	}{
+		{"sample: 1/10", "sample: 0/10", "invalid sample rate"},
+		{"sample: 1/10", "sample: one", "invalid sample rate"},
+		{"            - recorder2\n", "            - recorder2\n            - recorder1\n        sample: 1/2\n", "app1 -> recorder1"},
+	}
+	for _, tc := range tcs {
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLSamples")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(input.Body)
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(strings.NewReader(strings.Replace(body.String(), tc.old, tc.new, 1)))
+		_, err = config.LoadYAML(tools.DiscardLogger(), v)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = (%v); want (%s)", tc.new, err, tc.want)
+		}
+	}
+}
+
+func TestLoadYAMLConditions(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLConditions")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c := confMap.Conditions["app1"]["recorder1"]
+	if c == nil {
+		t.Fatalf("Conditions = (%v); want app1 -> recorder1", confMap.Conditions)
+	}
+	tcs := []struct {
+		content string
+		want    bool
+	}{
+		{`{"memstats":{"Alloc":1024},"config":{"version":"v1"}}`, true},
+		{`{"memstats":{"Alloc":2048},"config":{"version":"v1"}}`, false},
+		{`{"memstats":{"Alloc":209715200},"config":{"version":"v1"}}`, true},
+		{`{"memstats":{"Alloc":209715200},"config":{"version":"v2"}}`, true},
+	}
+	for i, tc := range tcs {
+		if got := c.Match([]byte(tc.content)); got != tc.want {
+			t.Errorf("%d: Match() = (%t); want (%t)", i, got, tc.want)
+		}
+	}
+
+	errs := []struct {
+		old, new string
+		want     string
+	}{
+		{"threshold: 104857600", "threshold: lots", "lots is not a number"},
+		{"threshold: 104857600", "threshold: 1\n              change: 1", "either threshold or change"},
+		{"change: 0%", "changes: 0%", "unknown key changes"},
+		{"- field: config.version", "- fields: config.version", "unknown key fields"},
+		{"            - field: memstats.Alloc\n              threshold: 104857600\n", "            - memstats.Alloc\n", "should be a map"},
+	}
+	for _, tc := range errs {
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLConditions")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(input.Body)
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(strings.NewReader(strings.Replace(body.String(), tc.old, tc.new, 1)))
+		_, err = config.LoadYAML(tools.DiscardLogger(), v)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = (%v); want (%s)", tc.new, err, tc.want)
+		}
+	}
+}
+
+func TestLoadYAMLMutes(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLMutes")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(confMap.ReaderMutes) != 1 || len(confMap.ReaderMutes["app1"]) != 1 {
+		t.Fatalf("ReaderMutes = (%v); want app1 only", confMap.ReaderMutes)
+	}
+	for _, reader := range []string{"app1", "app2"} {
+		if s := confMap.Mutes[reader]["recorder1"]; len(s) != 2 {
+			t.Errorf("Mutes[%s][recorder1] = (%v); want 2 windows", reader, s)
+		}
+		if s, ok := confMap.Mutes[reader]["recorder2"]; ok {
+			t.Errorf("Mutes[%s][recorder2] = (%v); want none", reader, s)
+		}
+	}
+	monday := time.Date(2017, 1, 2, 2, 30, 0, 0, time.UTC) // a Monday.
+	tcs := []struct {
+		t         time.Time
+		reader    bool
+		recorder1 bool
+	}{
+		{monday, true, false},
+		{monday.Add(time.Hour), false, false},
+		{monday.Add(-4 * time.Hour), false, false},
+		{monday.Add(20 * time.Hour), false, true},
+		{monday.Add(22 * time.Hour), false, true},
+		{monday.Add(-48 * time.Hour), true, true},
+	}
+	for i, tc := range tcs {
+		if got := confMap.ReaderMutes["app1"].Active(tc.t); got != tc.reader {
+			t.Errorf("%d: ReaderMutes[app1].Active(%v) = (%t); want (%t)", i, tc.t, got, tc.reader)
+		}
+		if got := confMap.Mutes["app2"]["recorder1"].Active(tc.t); got != tc.recorder1 {
+			t.Errorf("%d: Mutes[app2][recorder1].Active(%v) = (%t); want (%t)", i, tc.t, got, tc.recorder1)
+		}
+	}
+
+	errs := []struct {
+		old, new string
+		want     string
+	}{
+		{"mute: 02:00-03:00 UTC daily", "mute: 02:00", "invalid maintenance window"},
+		{"mute: 02:00-03:00 UTC daily", "mute: 02:00-03:00 Mars/Olympus", "invalid time zone"},
+		{"mute: 02:00-03:00 UTC daily", "mute: 02:00-03:00 UTC someday", "invalid days"},
+		{"- 00:00-06:00 UTC sat,sun", "- 00:00-25:00 UTC sat,sun", "invalid end"},
+		{"- 00:00-06:00 UTC sat,sun", "- 666", "is not a string"},
+	}
+	for _, tc := range errs {
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLMutes")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(input.Body)
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(strings.NewReader(strings.Replace(body.String(), tc.old, tc.new, 1)))
+		_, err = config.LoadYAML(tools.DiscardLogger(), v)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = (%v); want (%s)", tc.new, err, tc.want)
+		}
+	}
+}
+
+func TestLoadYAMLSchemaDrift(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSchemaDrift")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(confMap.Drifts) != 2 {
+		t.Fatalf("Drifts = (%v); want app1 and app2", confMap.Drifts)
+	}
+	if d := confMap.Drifts["app1"]; d == nil || d.Percent != 10 {
+		t.Errorf("Drifts[app1] = (%v); want (10%%)", d)
+	}
+	if d := confMap.Drifts["app2"]; d == nil || d.Keys != 3 {
+		t.Errorf("Drifts[app2] = (%v); want (3)", d)
+	}
+
+	for _, threshold := range []string{"lots", "-1", "1.5"} {
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLSchemaDrift")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(input.Body)
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(strings.NewReader(strings.Replace(body.String(), "schema_drift: 3", "schema_drift: "+threshold, 1)))
+		_, err = config.LoadYAML(tools.DiscardLogger(), v)
+		if err == nil || !strings.Contains(err.Error(), "invalid schema drift threshold") {
+			t.Errorf("%q: err = (%v); want (invalid schema drift threshold)", threshold, err)
+		}
+	}
+}
+
+func TestLoadYAMLScrapeOnStart(t *testing.T) {
+	t.Parallel()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSchemaDrift")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := new(bytes.Buffer)
+	body.ReadFrom(input.Body)
+	tcs := []struct {
+		value string
+		want  bool
+	}{
+		{"true", true},
+		{"yes", true},
+		{"false", false},
+		{`"true"`, true},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(strings.NewReader(strings.Replace(body.String(), "schema_drift: 3", "scrape_on_start: "+tc.value, 1)))
+		confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+		if err != nil {
+			t.Errorf("%s: err = (%v); want (nil)", tc.value, err)
+			continue
+		}
+		if got := confMap.ScrapeOnStart["app2"]; got != tc.want || len(confMap.ScrapeOnStart) > 1 {
+			t.Errorf("%s: ScrapeOnStart = (%v); want (app2: %t)", tc.value, confMap.ScrapeOnStart, tc.want)
+		}
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(strings.NewReader(strings.Replace(body.String(), "schema_drift: 3", "scrape_on_start: often", 1)))
+	if _, err = config.LoadYAML(tools.DiscardLogger(), v); err == nil || !strings.Contains(err.Error(), "is not a boolean") {
+		t.Errorf("err = (%v); want (is not a boolean)", err)
+	}
+}
+
+func TestLoadYAMLProjections(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLProjections")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(confMap.Projections) != 1 {
+		t.Fatalf("Projections = (%v); want only billing", confMap.Projections)
+	}
+	p := confMap.Projections["billing"]
+	if p == nil {
+		t.Fatalf("Projections = (%v); want billing", confMap.Projections)
+	}
+	if want := "requests memstats.Alloc"; strings.Join(p.Fields(), " ") != want {
+		t.Errorf("Fields() = (%v); want (%s)", p.Fields(), want)
+	}
+
+	errs := []struct {
+		old, new string
+		want     string
+	}{
+		{"            - requests\n            - memstats.Alloc\n", "            - \"\"\n", "empty field"},
+		{"allow_fields:", "allowed_fields:", "did you mean recorders.billing.allow_fields"},
+	}
+	for _, tc := range errs {
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLProjections")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(input.Body)
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(strings.NewReader(strings.Replace(body.String(), tc.old, tc.new, 1)))
+		_, err = config.LoadYAML(tools.DiscardLogger(), v)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = (%v); want (%s)", tc.new, err, tc.want)
+		}
+	}
+}
+
+func TestLoadYAMLChaos(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLChaos")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, ok := confMap.Readers["app1"].(*chaos.Reader); !ok {
+		t.Errorf("app1 = (%T); want (*chaos.Reader)", confMap.Readers["app1"])
+	}
+	if _, ok := confMap.Recorders["recorder1"].(*chaos.BatchRecorder); !ok {
+		t.Errorf("recorder1 = (%T); want (*chaos.BatchRecorder)", confMap.Recorders["recorder1"])
+	}
+	if _, ok := confMap.Recorders["recorder2"].(*elasticsearch.Recorder); !ok {
+		t.Errorf("recorder2 = (%T); want (*elasticsearch.Recorder)", confMap.Recorders["recorder2"])
+	}
+
+	errs := []struct {
+		old, new string
+		want     string
+	}{
+		{"error_rate: 0.1", "error_rate: 10", "error_rate should be between 0 and 1"},
+		{"latency: 200ms", "latency: slow", "chaos"},
+		{"jitter: 1s", "jiter: 1s", "did you mean recorders.recorder1.chaos.jitter"},
+	}
+	for _, tc := range errs {
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLChaos")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(input.Body)
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(strings.NewReader(strings.Replace(body.String(), tc.old, tc.new, 1)))
+		_, err = config.LoadYAML(tools.DiscardLogger(), v)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = (%v); want (%s)", tc.new, err, tc.want)
+		}
+	}
+}
+
 func stringInMapKeys(niddle string, haystack map[string]reader.DataReader) bool {
 	for b := range haystack {
 		if b == niddle {
@@ -158,14 +665,1068 @@ func TestLoadSettingsErrors(t *testing.T) {
 		t.Errorf("expecting mention of log_level, got (%v)", err)
 	}
 
+	// The level is recorded in the Settings, see TestLoadSettingsLogLevel,
+	// and the logger is left alone.
+	level := log.Level
 	input = bytes.NewBuffer([]byte(`
     settings:
         log_level: debug
     `))
 	v.ReadConfig(input)
 	config.LoadYAML(log, v)
-	if log.Level != tools.DebugLevel {
-		t.Errorf("log.Level = (%v); want (tools.DebugLevel)", log.Level)
+	if log.Level != level {
+		t.Errorf("log.Level = (%v); want (%v)", log.Level, level)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        lazy_ping: "yes please"
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "lazy_ping") {
+		t.Errorf("expecting mention of lazy_ping, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        flush_interval: often
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "flush_interval") {
+		t.Errorf("expecting mention of flush_interval, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        job_grace_period: -1s
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "job_grace_period") {
+		t.Errorf("expecting mention of job_grace_period, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        clock_skew_threshold: 0s
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "clock_skew_threshold") {
+		t.Errorf("expecting mention of clock_skew_threshold, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        annotate_reads: sometimes
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "annotate_reads") {
+		t.Errorf("expecting mention of annotate_reads, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        leader_lock: [a, b]
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "leader_lock") {
+		t.Errorf("expecting mention of leader_lock, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        on_recorder_failure: retry
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "on_recorder_failure") {
+		t.Errorf("expecting mention of on_recorder_failure, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        delivery_mode: exactly_once
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "delivery_mode") {
+		t.Errorf("expecting mention of delivery_mode, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        pid_file: [a, b]
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "pid_file") {
+		t.Errorf("expecting mention of pid_file, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        state_dump_file: [a, b]
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "state_dump_file") {
+		t.Errorf("expecting mention of state_dump_file, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        dashboard: sure
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "dashboard") {
+		t.Errorf("expecting mention of dashboard, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        debug_addr: 6060
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "debug_addr") {
+		t.Errorf("expecting mention of debug_addr, got (%v)", err)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    settings:
+        listen_tls:
+            cert_file: /etc/expipe/server.pem
+    `))
+	v.ReadConfig(input)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "listen_tls") {
+		t.Errorf("expecting mention of listen_tls, got (%v)", err)
+	}
+}
+
+func TestLoadSettingsLazyPing(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    lazy_ping: true\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !confMap.Settings.LazyPing {
+		t.Error("confMap.Settings.LazyPing = (false); want (true)")
+	}
+}
+
+func TestLoadSettingsDashboard(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    metrics_addr: :9100\n    dashboard: true\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !confMap.Settings.Dashboard {
+		t.Error("confMap.Settings.Dashboard = (false); want (true)")
+	}
+}
+
+func TestLoadSettingsAlerts(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString(`settings:
+    alerts:
+        error_threshold: 3
+        webhook: http://alerts.example.com
+        slack: https://hooks.slack.com/services/T/B/X
+        email:
+            smtp: smtp.example.com:587
+            from: expipe@example.com
+            to: [ops@example.com]
+`)
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	alerts := confMap.Settings.Alerts
+	if alerts.ErrorThreshold != 3 {
+		t.Errorf("ErrorThreshold = (%d); want (3)", alerts.ErrorThreshold)
+	}
+	if alerts.Webhook != "http://alerts.example.com" {
+		t.Errorf("Webhook = (%s); want (http://alerts.example.com)", alerts.Webhook)
+	}
+	if alerts.Slack == "" {
+		t.Error("Slack is empty")
+	}
+	if alerts.Email.Addr != "smtp.example.com:587" || len(alerts.Email.To) != 1 {
+		t.Errorf("Email = (%v); want (smtp.example.com:587 to ops@example.com)", alerts.Email)
+	}
+}
+
+func TestLoadSettingsAlertsSecretFiles(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "expipe_secrets")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	secrets := map[string]string{
+		"webhook":  "http://alerts.example.com/token\n",
+		"password": "s3cret\n",
+	}
+	for name, content := range secrets {
+		if err = ioutil.WriteFile(path.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString(fmt.Sprintf(`settings:
+    alerts:
+        webhook_file: %[1]s/webhook
+        email:
+            smtp: smtp.example.com:587
+            username: expipe
+            password_file: %[1]s/password
+            from: expipe@example.com
+            to: [ops@example.com]
+`, dir))
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	alerts := confMap.Settings.Alerts
+	if alerts.Webhook != "http://alerts.example.com/token" {
+		t.Errorf("Webhook = (%s); want (http://alerts.example.com/token)", alerts.Webhook)
+	}
+	if alerts.Email.Password != "s3cret" {
+		t.Errorf("Email.Password = (%s); want (s3cret)", alerts.Email.Password)
+	}
+	if alerts.Email.Username != "expipe" {
+		t.Errorf("Email.Username = (%s); want (expipe)", alerts.Email.Username)
+	}
+}
+
+func TestLoadSettingsAlertsErrors(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"threshold", "settings:\n    alerts:\n        error_threshold: -1\n"},
+		{"webhook", "settings:\n    alerts:\n        webhook: [a]\n"},
+		{"email to", "settings:\n    alerts:\n        email:\n            smtp: localhost:25\n            from: a@example.com\n"},
+		{"email from", "settings:\n    alerts:\n        email:\n            smtp: localhost:25\n            to: [a@example.com]\n"},
+		{"password and file", "settings:\n    alerts:\n        email:\n            password: a\n            password_file: /tmp/a\n"},
+		{"missing file", "settings:\n    alerts:\n        slack_file: /does/not/exist\n"},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(tc.input))
+		_, err := config.LoadYAML(tools.DiscardLogger(), v)
+		if err == nil || !strings.Contains(err.Error(), "alerts") {
+			t.Errorf("%s: expecting mention of alerts, got (%v)", tc.name, err)
+		}
+	}
+}
+
+func TestLoadSettingsLogLevel(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    log_level: debug\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if confMap.Settings.LogLevel != "debug" {
+		t.Errorf("LogLevel = (%s); want (debug)", confMap.Settings.LogLevel)
+	}
+	// The level is applied by the application, not while parsing.
+	if log.Level != tools.InfoLevel {
+		t.Errorf("log.Level = (%v); want (tools.InfoLevel)", log.Level)
+	}
+}
+
+func TestLoadSettingsLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expipe_config")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "expipe.log")
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString(fmt.Sprintf("settings:\n    log:\n        format: json\n        file: %s\n        max_size_mb: 10\n        max_backups: 2\n", file))
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := tools.LogConfig{Format: "json", File: file, MaxSize: 10 << 20, MaxBackups: 2}
+	if confMap.Settings.Log != want {
+		t.Errorf("Log = (%v); want (%v)", confMap.Settings.Log, want)
+	}
+	// The logger is configured by the application, not while parsing.
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("err = (%v); want (not exist)", err)
+	}
+}
+
+func TestLoadSettingsLogErrors(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"format", "settings:\n    log:\n        format: xml\n"},
+		{"file", "settings:\n    log:\n        file: [a]\n"},
+		{"max size", "settings:\n    log:\n        max_size_mb: -1\n"},
+		{"max backups", "settings:\n    log:\n        max_backups: many\n"},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(tc.input))
+		_, err := config.LoadYAML(tools.DiscardLogger(), v)
+		if err == nil || !strings.Contains(err.Error(), "log") {
+			t.Errorf("%s: expecting mention of log, got (%v)", tc.name, err)
+		}
+	}
+}
+
+func TestLoadSettingsLeaderLock(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    leader_lock: /tmp/expipe.lock\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if confMap.Settings.LeaderLock != "/tmp/expipe.lock" {
+		t.Errorf("LeaderLock = (%s); want (/tmp/expipe.lock)", confMap.Settings.LeaderLock)
+	}
+}
+
+func TestLoadSettingsOnRecorderFailure(t *testing.T) {
+	t.Parallel()
+	for _, policy := range []string{"degrade", "exit", "Buffer"} {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := bytes.NewBufferString("settings:\n    on_recorder_failure: " + policy + "\n")
+		body.ReadFrom(input.Body)
+		v.ReadConfig(body)
+		confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+		if errors.Cause(err) != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if want := strings.ToLower(policy); confMap.Settings.OnRecorderFailure != want {
+			t.Errorf("OnRecorderFailure = (%s); want (%s)", confMap.Settings.OnRecorderFailure, want)
+		}
+	}
+}
+
+func TestLoadSettingsDeliveryMode(t *testing.T) {
+	t.Parallel()
+	for _, mode := range []string{"at_most_once", "At_Least_Once"} {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := bytes.NewBufferString("settings:\n    delivery_mode: " + mode + "\n")
+		body.ReadFrom(input.Body)
+		v.ReadConfig(body)
+		confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+		if errors.Cause(err) != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if want := strings.ToLower(mode); confMap.Settings.DeliveryMode != want {
+			t.Errorf("DeliveryMode = (%s); want (%s)", confMap.Settings.DeliveryMode, want)
+		}
+	}
+}
+
+func TestLoadSettingsMaxUnackedJobs(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"500", 500, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"many", 0, true},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := bytes.NewBufferString("settings:\n    max_unacked_jobs: " + tc.value + "\n")
+		body.ReadFrom(input.Body)
+		v.ReadConfig(body)
+		confMap, err := config.LoadYAML(tools.DiscardLogger(), v)
+		if tc.wantErr {
+			if errors.Cause(err) == nil {
+				t.Errorf("%s: err = (nil); want (error)", tc.value)
+			}
+			continue
+		}
+		if errors.Cause(err) != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if confMap.Settings.MaxUnackedJobs != tc.want {
+			t.Errorf("MaxUnackedJobs = (%d); want (%d)", confMap.Settings.MaxUnackedJobs, tc.want)
+		}
+	}
+}
+
+func TestLoadSettingsPIDFile(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    pid_file: /var/run/expipe.pid\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if confMap.Settings.PIDFile != "/var/run/expipe.pid" {
+		t.Errorf("PIDFile = (%s); want (/var/run/expipe.pid)", confMap.Settings.PIDFile)
+	}
+}
+
+func TestLoadSettingsStateDumpFile(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    state_dump_file: /tmp/expipe-state.json\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if confMap.Settings.StateDumpFile != "/tmp/expipe-state.json" {
+		t.Errorf("StateDumpFile = (%s); want (/tmp/expipe-state.json)", confMap.Settings.StateDumpFile)
+	}
+}
+
+func TestLoadSettingsFlushInterval(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    flush_interval: 5s\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if confMap.Settings.FlushInterval != 5*time.Second {
+		t.Errorf("FlushInterval = (%v); want (5s)", confMap.Settings.FlushInterval)
+	}
+}
+
+func TestLoadSettingsJobGracePeriod(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    job_grace_period: 2s\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if confMap.Settings.JobGracePeriod != 2*time.Second {
+		t.Errorf("JobGracePeriod = (%v); want (2s)", confMap.Settings.JobGracePeriod)
+	}
+}
+
+func TestLoadSettingsClockSkewThreshold(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    clock_skew_threshold: 1m\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if confMap.Settings.ClockSkewThreshold != time.Minute {
+		t.Errorf("ClockSkewThreshold = (%v); want (1m)", confMap.Settings.ClockSkewThreshold)
+	}
+}
+
+func TestLoadSettingsAnnotateReads(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    annotate_reads: true\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !confMap.Settings.AnnotateReads {
+		t.Error("AnnotateReads = (false); want (true)")
+	}
+}
+
+func TestLoadSettingsCluster(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    cluster:\n        self: node2\n        peers: [node1, node2]\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if confMap.Settings.Cluster.Self != "node2" {
+		t.Errorf("Cluster.Self = (%s); want (node2)", confMap.Settings.Cluster.Self)
+	}
+	if !reflect.DeepEqual(confMap.Settings.Cluster.Peers, []string{"node1", "node2"}) {
+		t.Errorf("Cluster.Peers = (%v); want ([node1 node2])", confMap.Settings.Cluster.Peers)
+	}
+}
+
+func TestLoadYAMLExpandsEnv(t *testing.T) {
+	os.Setenv("EXPIPE_TEST_NODE", "node7")
+	defer os.Unsetenv("EXPIPE_TEST_NODE")
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString("settings:\n    cluster:\n        self: ${EXPIPE_TEST_NODE}\n        peers: [node1, '${EXPIPE_TEST_NODE}', '${EXPIPE_TEST_PEER:node9}']\n")
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if confMap.Settings.Cluster.Self != "node7" {
+		t.Errorf("Cluster.Self = (%s); want (node7)", confMap.Settings.Cluster.Self)
+	}
+	want := []string{"node1", "node7", "node9"}
+	if !reflect.DeepEqual(confMap.Settings.Cluster.Peers, want) {
+		t.Errorf("Cluster.Peers = (%v); want (%v)", confMap.Settings.Cluster.Peers, want)
+	}
+
+	v = viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString("settings:\n    cluster:\n        self: ${EXPIPE_TEST_UNSET}\n"))
+	_, err = config.LoadYAML(log, v)
+	e, ok := err.(*config.StructureErr)
+	if !ok {
+		t.Fatalf("err = (%#v); want (*config.StructureErr)", err)
+	}
+	if _, ok := e.Err.(tools.UnsetEnvError); !ok {
+		t.Errorf("e.Err = (%v); want (UnsetEnvError)", e.Err)
+	}
+}
+
+func TestLoadYAMLDefaults(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLDefaults")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		name     string
+		typeName string
+		interval time.Duration
+	}{
+		{"reader1", "app_reader1", 5 * time.Second},
+		{"reader2", "custom", time.Second},
+	}
+	for _, tc := range tcs {
+		red, ok := confMap.Readers[tc.name]
+		if !ok {
+			t.Errorf("%s was not loaded", tc.name)
+			continue
+		}
+		if red.TypeName() != tc.typeName {
+			t.Errorf("%s.TypeName() = (%s); want (%s)", tc.name, red.TypeName(), tc.typeName)
+		}
+		if red.Interval() != tc.interval {
+			t.Errorf("%s.Interval() = (%s); want (%s)", tc.name, red.Interval(), tc.interval)
+		}
+		if red.Timeout() != 4*time.Second {
+			t.Errorf("%s.Timeout() = (%s); want (4s)", tc.name, red.Timeout())
+		}
+	}
+	rec, ok := confMap.Recorders["recorder1"]
+	if !ok {
+		t.Fatal("recorder1 was not loaded")
+	}
+	if rec.Timeout() != 8*time.Second {
+		t.Errorf("Timeout() = (%s); want (8s)", rec.Timeout())
+	}
+	if rec.IndexName() != "index" {
+		t.Errorf("IndexName() = (%s); want (index)", rec.IndexName())
+	}
+}
+
+func TestLoadYAMLDefaultsErrors(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	for _, input := range []string{
+		"defaults: 4s\n",
+		"defaults:\n    readers: 4s\n",
+	} {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(input))
+		_, err := config.LoadYAML(log, v)
+		if err == nil || !strings.Contains(err.Error(), "defaults") {
+			t.Errorf("%q: err = (%v); want mention of defaults", input, err)
+		}
+	}
+}
+
+func TestLoadYAMLMappers(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLMappers")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	memoryType := func(m datatype.Mapper) string {
+		return m.(*datatype.MapConvert).MemoryTypes["heapmemoryusage.used"]
+	}
+	if got := memoryType(confMap.Readers["go_app"].Mapper()); got != "" {
+		t.Errorf("go_app mapping = (%s); want the default mapping", got)
+	}
+	java := confMap.Readers["java_app"].Mapper()
+	if got := memoryType(java); got != "mb" {
+		t.Errorf("java_app mapping = (%s); want (mb)", got)
+	}
+	if len(confMap.Mappers) != 1 || len(confMap.Mappers["java_app"]) != 1 {
+		t.Fatalf("Mappers = (%v); want only java_app -> recorder2", confMap.Mappers)
+	}
+	m := confMap.Mappers["java_app"]["recorder2"]
+	if got := memoryType(m); got != "kb" {
+		t.Errorf("java_app -> recorder2 mapping = (%s); want (kb)", got)
+	}
+	if !tools.StringInSlice("Latencies", m.(*datatype.MapConvert).GCTypes) {
+		t.Errorf("GCTypes = (%v); want the reader's gc_types", m.(*datatype.MapConvert).GCTypes)
+	}
+	if fields := java.(*datatype.MapConvert).Fields; fields["env"] != "prod" || fields["team"] != "core" {
+		t.Errorf("java_app fields = (%v); want the reader's fields", fields)
+	}
+	if fields := m.(*datatype.MapConvert).Fields; fields["env"] != "prod" || fields["team"] != "platform" {
+		t.Errorf("java_app -> recorder2 fields = (%v); want the route's fields over the reader's", fields)
+	}
+
+	v = viper.New()
+	v.SetConfigType("yaml")
+	input, _ = config.FixtureWithSection("various.txt", "LoadYAMLMappers")
+	body := new(bytes.Buffer)
+	body.ReadFrom(input.Body)
+	body.WriteString("    route3:\n        readers: [java_app]\n        recorders: [recorder2]\n        gc_types: [Pauses]\n")
+	v.ReadConfig(body)
+	_, err = config.LoadYAML(log, v)
+	if err == nil || !strings.Contains(err.Error(), "java_app -> recorder2") {
+		t.Errorf("err = (%v); want conflicting mappings error", err)
+	}
+}
+
+func TestLoadYAMLReaderTemplates(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLReaderTemplates")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	v.ReadConfig(input.Body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		name     string
+		typeName string
+		endpoint string
+		interval time.Duration
+	}{
+		{"web-1", "fleet_web-1", "localhost:1234", 2 * time.Second},
+		{"web-2", "fleet_web-2", "localhost:1235", time.Second},
+		{"reader1", "app", "localhost:1236", time.Second},
+	}
+	for _, tc := range tcs {
+		red, ok := confMap.Readers[tc.name]
+		if !ok {
+			t.Errorf("%s was not loaded", tc.name)
+			continue
+		}
+		if red.TypeName() != tc.typeName {
+			t.Errorf("%s.TypeName() = (%s); want (%s)", tc.name, red.TypeName(), tc.typeName)
+		}
+		if !strings.HasSuffix(red.Endpoint(), tc.endpoint) {
+			t.Errorf("%s.Endpoint() = (%s); want (%s)", tc.name, red.Endpoint(), tc.endpoint)
+		}
+		if red.Interval() != tc.interval {
+			t.Errorf("%s.Interval() = (%s); want (%s)", tc.name, red.Interval(), tc.interval)
+		}
+		if red.Timeout() != 4*time.Second {
+			t.Errorf("%s.Timeout() = (%s); want (4s)", tc.name, red.Timeout())
+		}
+	}
+}
+
+func TestLoadYAMLReaderTemplatesErrors(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	tcs := []struct {
+		input string
+		want  string
+	}{
+		{"reader_templates: 4s\n", "should be a map"},
+		{"reader_templates:\n    fleet:\n        instances: [{name: a}]\n", "template should be a map"},
+		{"reader_templates:\n    fleet:\n        template: {type: expvar}\n", "instances should be a list"},
+		{"reader_templates:\n    fleet:\n        template: {type: expvar}\n        instances: [{endpoint: a}]\n", "should have a name"},
+		{"reader_templates:\n    fleet:\n        template: {type: expvar}\n        instances: [{name: app}]\nreaders:\n    app:\n        type: expvar\n", "app is already defined"},
+		{"reader_templates:\n    fleet:\n        template: {type: expvar, intervall: 1s}\n        instances: [{name: app}]\n", "reader_templates.fleet.template.intervall"},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(tc.input))
+		_, err := config.LoadYAML(log, v)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = (%v); want (%s)", tc.input, err, tc.want)
+		}
+	}
+}
+
+func TestLoadSettingsClusterErrors(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"no self", "peers: [node1]"},
+		{"no peers", "self: node1"},
+		{"empty peers", "self: node1\n        peers: []"},
+		{"bad peers", "self: node1\n        peers: node1"},
+		{"bad peer", "self: node1\n        peers: [node1, [node2]]"},
+		{"self not in peers", "self: node3\n        peers: [node1, node2]"},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString("settings:\n    cluster:\n        " + tc.input + "\n"))
+		_, err := config.LoadYAML(log, v)
+		if err == nil || !strings.Contains(err.Error(), "cluster") {
+			t.Errorf("%s: expecting mention of cluster, got (%v)", tc.name, err)
+		}
+	}
+}
+
+func TestLoadSettingsHTTP(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+	if err != nil {
+		t.Fatalf("error getting section: %v", err)
+	}
+	body := bytes.NewBufferString(`settings:
+    http:
+        max_idle_conns_per_host: 32
+        idle_conn_timeout: 1m
+        proxy: http://localhost:3128
+        insecure_skip_verify: true
+        disable_http2: true
+`)
+	body.ReadFrom(input.Body)
+	v.ReadConfig(body)
+	confMap, err := config.LoadYAML(log, v)
+	if errors.Cause(err) != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := httpclient.Config{
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     time.Minute,
+		Proxy:               "http://localhost:3128",
+		InsecureSkipVerify:  true,
+		DisableHTTP2:        true,
+	}
+	if confMap.Settings.HTTP != want {
+		t.Errorf("HTTP = (%v); want (%v)", confMap.Settings.HTTP, want)
+	}
+}
+
+func TestLoadSettingsHTTPErrors(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"bad max idle", "max_idle_conns_per_host: many"},
+		{"negative max idle", "max_idle_conns_per_host: -1"},
+		{"bad idle timeout", "idle_conn_timeout: forever"},
+		{"bad proxy", "proxy: [localhost]"},
+		{"bad insecure", "insecure_skip_verify: sure"},
+		{"missing ca file", "ca_file: /does/not/exist.pem"},
+		{"bad client cert", "client_cert_file: [client.pem]"},
+		{"client cert without key", "client_cert_file: /etc/expipe/client.pem"},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString("settings:\n    http:\n        " + tc.input + "\n"))
+		_, err := config.LoadYAML(log, v)
+		if err == nil || !strings.Contains(err.Error(), "http") {
+			t.Errorf("%s: expecting mention of http, got (%v)", tc.name, err)
+		}
+	}
+}
+
+func TestLoadSettingsRuntime(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	tcs := []struct {
+		name  string
+		input string
+		want  limits.Config
+	}{
+		{"memory", "memory_limit: 512MB", limits.Config{MemoryLimit: 512 << 20}},
+		{"shed", "memory_limit: 1GiB\n        shed_ratio: 0.8", limits.Config{MemoryLimit: 1 << 30, ShedRatio: 0.8}},
+		{"procs", "gomaxprocs: 4", limits.Config{GOMAXPROCS: 4}},
+		{"auto procs", "gomaxprocs: auto", limits.Config{GOMAXPROCS: limits.AutoProcs}},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := bytes.NewBufferString("settings:\n    runtime:\n        " + tc.input + "\n")
+		body.ReadFrom(input.Body)
+		v.ReadConfig(body)
+		confMap, err := config.LoadYAML(log, v)
+		if errors.Cause(err) != nil {
+			t.Fatalf("%s: err = (%v); want (nil)", tc.name, err)
+		}
+		if confMap.Settings.Runtime != tc.want {
+			t.Errorf("%s: Runtime = (%v); want (%v)", tc.name, confMap.Settings.Runtime, tc.want)
+		}
+	}
+}
+
+func TestLoadSettingsRuntimeErrors(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"bad memory", "memory_limit: plenty"},
+		{"zero memory", "memory_limit: 0"},
+		{"shed without memory", "shed_ratio: 0.5"},
+		{"big shed", "memory_limit: 1GB\n        shed_ratio: 2"},
+		{"bad procs", "gomaxprocs: many"},
+		{"zero procs", "gomaxprocs: 0"},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString("settings:\n    runtime:\n        " + tc.input + "\n"))
+		_, err := config.LoadYAML(log, v)
+		if err == nil || !strings.Contains(err.Error(), "runtime") {
+			t.Errorf("%s: expecting mention of runtime, got (%v)", tc.name, err)
+		}
+	}
+}
+
+func TestLoadSettingsTracing(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	tcs := []struct {
+		name  string
+		input string
+		want  trace.Config
+	}{
+		{"bool", "tracing: true", trace.Config{Enabled: true}},
+		{"disabled", "tracing: false", trace.Config{}},
+		{"map", "tracing:\n        endpoint: http://collector:4318\n        sample_ratio: 0.25",
+			trace.Config{Enabled: true, Endpoint: "http://collector:4318", SampleRatio: 0.25}},
+		{"map disabled", "tracing:\n        enabled: false\n        endpoint: http://collector:4318",
+			trace.Config{Endpoint: "http://collector:4318"}},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		input, err := config.FixtureWithSection("various.txt", "LoadYAMLSuccess")
+		if err != nil {
+			t.Fatalf("error getting section: %v", err)
+		}
+		body := bytes.NewBufferString("settings:\n    " + tc.input + "\n")
+		body.ReadFrom(input.Body)
+		v.ReadConfig(body)
+		confMap, err := config.LoadYAML(log, v)
+		if errors.Cause(err) != nil {
+			t.Fatalf("%s: err = (%v); want (nil)", tc.name, err)
+		}
+		if confMap.Settings.Tracing != tc.want {
+			t.Errorf("%s: Tracing = (%v); want (%v)", tc.name, confMap.Settings.Tracing, tc.want)
+		}
+	}
+}
+
+func TestLoadSettingsTracingErrors(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"string", "tracing: yes please"},
+		{"bad enabled", "tracing:\n        enabled: sure"},
+		{"bad endpoint", "tracing:\n        endpoint: collector:4318"},
+		{"zero ratio", "tracing:\n        sample_ratio: 0"},
+		{"big ratio", "tracing:\n        sample_ratio: 2"},
+	}
+	for _, tc := range tcs {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString("settings:\n    " + tc.input + "\n"))
+		_, err := config.LoadYAML(log, v)
+		if err == nil || !strings.Contains(err.Error(), "tracing") {
+			t.Errorf("%s: expecting mention of tracing, got (%v)", tc.name, err)
+		}
 	}
 }
 
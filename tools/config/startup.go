@@ -0,0 +1,40 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// readersScrapeOnStart returns the names of the readers that set
+// scrape_on_start, which are read as soon as their Engines start instead of
+// after their first interval.
+func readersScrapeOnStart(v *viper.Viper, readerKeys map[string]string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	for _, name := range sortedKeys(readerKeys) {
+		value := v.Get("readers." + name + ".scrape_on_start")
+		var on bool
+		switch b := value.(type) {
+		case nil:
+			continue
+		case bool:
+			on = b
+		case string:
+			var err error
+			if on, err = strconv.ParseBool(b); err != nil {
+				return nil, &StructureErr{"readers", name + ": scrape_on_start", fmt.Errorf("%q is not a boolean", b)}
+			}
+		default:
+			return nil, &StructureErr{"readers", name + ": scrape_on_start", fmt.Errorf("%v is not a boolean", b)}
+		}
+		if on {
+			result[name] = true
+		}
+	}
+	return result, nil
+}
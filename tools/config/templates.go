@@ -0,0 +1,71 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// expandTemplates adds a reader to the readers section for each instance of
+// the reader_templates section. The values of an instance take precedence over
+// the values of its template, and the NamePlaceholder in the string values of
+// the template is replaced with the name of the instance. The v should not be
+// shared with the caller as the readers section is replaced.
+func expandTemplates(v *viper.Viper) error {
+	templates, ok := toStringMap(v.Get("reader_templates"))
+	if !ok {
+		return &StructureErr{"reader_templates", "should be a map", nil}
+	}
+	readers := v.GetStringMap("readers")
+	if readers == nil {
+		readers = make(map[string]interface{})
+	}
+	for tmplName, value := range templates {
+		tmpl, ok := toStringMap(value)
+		if !ok {
+			return &StructureErr{"reader_templates", tmplName + " should be a map", nil}
+		}
+		base, ok := toStringMap(tmpl["template"])
+		if !ok {
+			return &StructureErr{"reader_templates", tmplName + ": template should be a map", nil}
+		}
+		instances, ok := tmpl["instances"].([]interface{})
+		if !ok || len(instances) == 0 {
+			return &StructureErr{"reader_templates", tmplName + ": instances should be a list", nil}
+		}
+		for i, inst := range instances {
+			values, ok := toStringMap(inst)
+			if !ok {
+				return &StructureErr{"reader_templates", fmt.Sprintf("%s: instance %d should be a map", tmplName, i), nil}
+			}
+			name, ok := values["name"].(string)
+			if !ok || name == "" {
+				return &StructureErr{"reader_templates", fmt.Sprintf("%s: instance %d should have a name", tmplName, i), nil}
+			}
+			name = strings.ToLower(name)
+			if _, ok := readers[name]; ok {
+				return &StructureErr{"reader_templates", fmt.Sprintf("%s: %s is already defined", tmplName, name), nil}
+			}
+			reader := make(map[string]interface{}, len(base)+len(values))
+			for key, value := range base {
+				if s, ok := value.(string); ok {
+					value = strings.Replace(s, NamePlaceholder, name, -1)
+				}
+				reader[key] = value
+			}
+			for key, value := range values {
+				if key != "name" {
+					reader[key] = value
+				}
+			}
+			readers[name] = reader
+		}
+	}
+	v.Set("readers", readers)
+	return nil
+}
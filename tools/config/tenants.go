@@ -0,0 +1,104 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alext234/expipe/tools/tenant"
+	"github.com/spf13/viper"
+)
+
+// tenantKeys are the keys of the blocks of the tenants section.
+var tenantKeys = []string{"index_prefix", "max_documents", "max_bytes", "quota_period"}
+
+// getTenants returns the tenants of the tenants section, keyed by their IDs.
+// The index_prefix defaults to the ID and a dash, and the quota_period to a
+// day. It returns a StructureErr if any of the values are invalid.
+func getTenants(v *viper.Viper) (map[string]*tenant.Tenant, error) {
+	tenants := make(map[string]*tenant.Tenant)
+	for id := range v.GetStringMap("tenants") {
+		key := "tenants." + id
+		t := tenant.New(id)
+		if v.IsSet(key + ".index_prefix") {
+			t.IndexPrefix = v.GetString(key + ".index_prefix")
+		}
+		if err := checkIndexPrefix(id, t.IndexPrefix); err != nil {
+			return nil, err
+		}
+		t.MaxDocuments = v.GetInt64(key + ".max_documents")
+		t.MaxBytes = v.GetInt64(key + ".max_bytes")
+		if t.MaxDocuments < 0 || t.MaxBytes < 0 {
+			return nil, &StructureErr{"tenants", id + ": the quotas cannot be negative", nil}
+		}
+		if period := v.GetString(key + ".quota_period"); period != "" {
+			d, err := time.ParseDuration(period)
+			if err != nil {
+				return nil, &StructureErr{"tenants", id + ": quota_period", err}
+			}
+			if d <= 0 {
+				return nil, &StructureErr{"tenants", id + ": quota_period should be positive", nil}
+			}
+			t.Period = d
+		}
+		tenants[id] = t
+	}
+	return tenants, nil
+}
+
+// checkIndexPrefix returns an error if the prefix can not be a part of an
+// index name.
+func checkIndexPrefix(id, prefix string) error {
+	if strings.ContainsAny(prefix, ` "*\<|,>/?`) || prefix != strings.ToLower(prefix) {
+		return &StructureErr{"tenants", fmt.Sprintf("%s: invalid index_prefix %q", id, prefix), nil}
+	}
+	return nil
+}
+
+// routeTenants returns the tenants of the routes that have one, keyed by the
+// reader and then the recorder names. The tenants that are not in the tenants
+// section have no quotas. A reader and a recorder can be paired in only one
+// of the routes that have tenants.
+func routeTenants(routes routeMap, tenants map[string]*tenant.Tenant) (map[string]map[string]*tenant.Tenant, error) {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make(map[string]map[string]*tenant.Tenant)
+	owners := make(map[string]string)
+	for _, name := range names {
+		rt := routes[name]
+		if rt.tenant == "" {
+			continue
+		}
+		t, ok := tenants[rt.tenant]
+		if !ok {
+			if err := checkIndexPrefix(rt.tenant, rt.tenant); err != nil {
+				return nil, NewRoutersError(name, "invalid tenant "+rt.tenant, nil)
+			}
+			t = tenant.New(rt.tenant)
+			tenants[rt.tenant] = t
+		}
+		for _, red := range rt.readers {
+			for _, rec := range rt.recorders {
+				pair := red + " -> " + rec
+				if owner, ok := owners[pair]; ok {
+					return nil, NewRoutersError(name, "tenant of "+pair+" is already set in "+owner, nil)
+				}
+				owners[pair] = name
+				if result[red] == nil {
+					result[red] = make(map[string]*tenant.Tenant)
+				}
+				result[red][rec] = t
+			}
+		}
+	}
+	return result, nil
+}
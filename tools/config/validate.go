@@ -0,0 +1,210 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alext234/expipe/reader"
+	"github.com/alext234/expipe/recorder"
+	"github.com/alext234/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Report is the result of validating a configuration. Unlike LoadYAML, the
+// validation carries on after an error in a reader, a recorder or a route, so
+// all of them are reported.
+type Report struct {
+	Errors   []error
+	Warnings []string
+
+	// Readers and Recorders are the ones that were parsed successfully,
+	// including the ones that are not used in any routes.
+	Readers   map[string]reader.DataReader
+	Recorders map[string]recorder.DataRecorder
+}
+
+// OK returns true if there are no errors in the report.
+func (r *Report) OK() bool { return len(r.Errors) == 0 }
+
+func (r *Report) errorf(err error) { r.Errors = append(r.Errors, err) }
+
+func (r *Report) warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// ValidateFile reads the file with the overrides in the same way as ReadFile
+// and validates it.
+func ValidateFile(log *tools.Logger, file string, overrides ...string) *Report {
+	v, err := readFile(log, file, overrides)
+	if err != nil {
+		return &Report{Errors: []error{err}}
+	}
+	return Validate(log, v)
+}
+
+// Validate checks the configuration in v and returns a report of all errors,
+// and warnings about the readers and recorders that are not used in any
+// routes.
+func Validate(log *tools.Logger, v *viper.Viper) *Report {
+	report := &Report{
+		Readers:   make(map[string]reader.DataReader),
+		Recorders: make(map[string]recorder.DataRecorder),
+	}
+	if len(v.AllSettings()) == 0 {
+		report.errorf(ErrEmptyConfig)
+		return report
+	}
+	for _, err := range unknownKeys(v) {
+		report.errorf(err)
+	}
+	v, err := expandEnv(v)
+	if err != nil {
+		report.errorf(err)
+		return report
+	}
+	if v.IsSet("reader_templates") {
+		if err = expandTemplates(v); err != nil {
+			report.errorf(err)
+			return report
+		}
+	}
+	if v.IsSet("defaults") {
+		if err = applyDefaults(v); err != nil {
+			report.errorf(err)
+			return report
+		}
+	}
+	if v.IsSet("settings") {
+		var settings Settings
+		if err = checkSettingsSect(v, &settings); err != nil {
+			report.errorf(&StructureErr{"settings", "", err})
+		}
+	}
+
+	readerKeys := validateSection(report, v, "readers", func(name, typeName string) error {
+		r, err := parseReader(v, log, typeName, name)
+		if err == nil {
+			report.Readers[name] = r
+		}
+		return err
+	})
+	recorderKeys := validateSection(report, v, "recorders", func(name, typeName string) error {
+		r, err := readRecorders(v, log, typeName, name)
+		if err == nil {
+			report.Recorders[name] = r
+		}
+		return err
+	})
+
+	routes, err := getRoutes(v)
+	if err != nil {
+		report.errorf(errors.WithMessage(err, "routes"))
+		return report
+	}
+	if routes, err = expandRoutes(routes, readerKeys, recorderKeys, report.warnf); err != nil {
+		report.errorf(errors.WithMessage(err, "routes"))
+		return report
+	}
+	for _, name := range sortedKeys(routes) {
+		rt := routes[name]
+		for _, r := range rt.readers {
+			if _, ok := readerKeys[r]; !ok {
+				report.errorf(NewRoutersError(name, r+" not in readers", nil))
+			}
+		}
+		for _, r := range rt.recorders {
+			if _, ok := recorderKeys[r]; !ok {
+				report.errorf(NewRoutersError(name, r+" not in recorders", nil))
+			}
+		}
+	}
+	if tenants, err := getTenants(v); err != nil {
+		report.errorf(err)
+	} else if _, err = routeTenants(routes, tenants); err != nil {
+		report.errorf(err)
+	}
+	if _, err := routeSamples(routes); err != nil {
+		report.errorf(err)
+	}
+	if _, err := routeConditions(routes); err != nil {
+		report.errorf(err)
+	}
+	if _, err := routeMutes(routes); err != nil {
+		report.errorf(err)
+	}
+	if _, err := readerMutes(v, readerKeys); err != nil {
+		report.errorf(err)
+	}
+	if _, err := readerDrifts(v, readerKeys); err != nil {
+		report.errorf(err)
+	}
+	if _, err := readersScrapeOnStart(v, readerKeys); err != nil {
+		report.errorf(err)
+	}
+	if _, err := routeFallbacks(routes); err != nil {
+		report.errorf(err)
+	}
+	if _, err := recorderProjections(v, recorderKeys); err != nil {
+		report.errorf(err)
+	}
+	for _, name := range sortedKeys(readerKeys) {
+		if !readerInRoutes(name, routes) {
+			report.warnf("reader %s is not used in any routes", name)
+		}
+	}
+	for _, name := range sortedKeys(recorderKeys) {
+		if !recorderInRoutes(name, routes) {
+			report.warnf("recorder %s is not used in any routes", name)
+		}
+	}
+	return report
+}
+
+// validateSection checks the type of each block of the section and calls parse
+// with it. It returns the names of the blocks with a supported type.
+func validateSection(report *Report, v *viper.Viper, section string, parse func(name, typeName string) error) map[string]string {
+	if !v.IsSet(section) {
+		report.errorf(NewNotSpecifiedError(section, "", nil))
+		return nil
+	}
+	keys := make(map[string]string)
+	for _, name := range sortedKeys(v.GetStringMap(section)) {
+		typeName := v.GetString(section + "." + name + ".type")
+		if typeName == "" {
+			report.errorf(NewNotSpecifiedError(name, "type", nil))
+			continue
+		}
+		keys[name] = typeName
+		if err := parse(name, typeName); err != nil {
+			report.errorf(errors.Wrap(err, name))
+		}
+	}
+	return keys
+}
+
+// sortedKeys returns the keys of m, which should be a map with string keys,
+// in order.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case routeMap:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
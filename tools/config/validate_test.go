@@ -0,0 +1,111 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/config"
+	"github.com/spf13/viper"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	input := `
+readers:
+    reader1:
+        type: expvar
+        endpoint: localhost:1234
+        type_name: my_app
+        map_file: maps.yml
+        interval: 2s
+        timeout: 3s
+    reader2:
+        type: expvar
+        endpoint: localhost:1234
+        interval: 2s
+        timeout: 3s
+    reader3:
+        endpoint: localhost:1234
+    reader4:
+        type: expvar
+        endpoint: localhost:1234
+        type_name: my_app
+        map_file: maps.yml
+        interval: 2s
+        timeout: 3s
+recorders:
+    recorder1:
+        type: elasticsearch
+        endpoint: http://127.0.0.1:9200
+        index_name: index
+        timeout: 8s
+    recorder2:
+        type: elasticsearch
+        endpoint: http://127.0.0.1:9200
+        index_name: index
+        index_nam: index
+        timeout: 8s
+routes:
+    route1:
+        readers:
+            - reader1
+            - reader2
+            - reader5
+        recorders:
+            - recorder1
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBufferString(input))
+	report := config.Validate(log, v)
+	if report.OK() {
+		t.Fatal("report.OK() = (true); want (false)")
+	}
+	wantErrors := []string{"recorders.recorder2.index_nam", "reader2", "reader3", "reader5 not in readers"}
+	if len(report.Errors) != len(wantErrors) {
+		t.Fatalf("len(report.Errors) = (%d); want (%d): %v", len(report.Errors), len(wantErrors), report.Errors)
+	}
+	for i, want := range wantErrors {
+		if !strings.Contains(report.Errors[i].Error(), want) {
+			t.Errorf("report.Errors[%d] = (%v); want (%s)", i, report.Errors[i], want)
+		}
+	}
+	wantWarnings := []string{
+		"reader reader4 is not used in any routes",
+		"recorder recorder2 is not used in any routes",
+	}
+	if strings.Join(report.Warnings, "\n") != strings.Join(wantWarnings, "\n") {
+		t.Errorf("report.Warnings = (%v); want (%v)", report.Warnings, wantWarnings)
+	}
+	for _, name := range []string{"reader1", "reader4"} {
+		if _, ok := report.Readers[name]; !ok {
+			t.Errorf("%s was not parsed", name)
+		}
+	}
+	if len(report.Recorders) != 2 {
+		t.Errorf("len(report.Recorders) = (%d); want (2)", len(report.Recorders))
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	report := config.ValidateFile(log, "testdata/include/expipe.yml")
+	if !report.OK() {
+		t.Errorf("report.Errors = (%v); want none", report.Errors)
+	}
+	if len(report.Warnings) != 0 {
+		t.Errorf("report.Warnings = (%v); want none", report.Warnings)
+	}
+	report = config.ValidateFile(log, "testdata/does_not_exist.yml")
+	if report.OK() {
+		t.Error("report.OK() = (true); want (false)")
+	}
+}
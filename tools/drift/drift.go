@@ -0,0 +1,144 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package drift detects the keys that appear in or disappear from the results
+// of a reader between its reads, for example when a deploy of the application
+// renames its metrics and the dashboards silently go blank.
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxListed is the number of the keys listed by the String method of a Drift.
+const maxListed = 10
+
+// Detector compares the keys of each result with the keys of the previous one.
+// A result has drifted when more than Percent percent of the keys of the
+// previous result have appeared or disappeared, or more than Keys keys if
+// Percent is zero. The keys are the dotted paths of the values. It is
+// concurrent safe.
+type Detector struct {
+	Keys    int
+	Percent float64
+	mu      sync.Mutex
+	last    map[string]struct{} // guarded by mu; nil until the first result.
+}
+
+// Drift holds the keys that have appeared and disappeared, in order.
+type Drift struct {
+	Added   []string
+	Removed []string
+
+	// Keys is the number of the keys of the previous result.
+	Keys int
+}
+
+// Parse returns a Detector for a threshold, which is a number of keys, for
+// example 5, or a percentage of the keys, for example 10%. A zero threshold
+// reports any change. It returns an error if the threshold is negative or not
+// a number.
+func Parse(threshold string) (*Detector, error) {
+	s := strings.TrimSpace(threshold)
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+		if err != nil || p < 0 {
+			return nil, fmt.Errorf("invalid schema drift threshold %q", threshold)
+		}
+		if p == 0 {
+			return &Detector{}, nil
+		}
+		return &Detector{Percent: p}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid schema drift threshold %q", threshold)
+	}
+	return &Detector{Keys: n}, nil
+}
+
+// Check returns the Drift of the keys of the json content from the previous
+// content, and true if it is beyond the threshold. It remembers the keys for
+// the next calls. The first content and the contents that can not be decoded
+// never drift, and the latter are not remembered.
+func (d *Detector) Check(content []byte) (Drift, bool) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return Drift{}, false
+	}
+	keys := make(map[string]struct{})
+	paths(keys, "", doc)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	last := d.last
+	d.last = keys
+	if last == nil {
+		return Drift{}, false
+	}
+	drift := Drift{Keys: len(last)}
+	for key := range keys {
+		if _, ok := last[key]; !ok {
+			drift.Added = append(drift.Added, key)
+		}
+	}
+	for key := range last {
+		if _, ok := keys[key]; !ok {
+			drift.Removed = append(drift.Removed, key)
+		}
+	}
+	changed := len(drift.Added) + len(drift.Removed)
+	if changed == 0 {
+		return drift, false
+	}
+	sort.Strings(drift.Added)
+	sort.Strings(drift.Removed)
+	if d.Percent == 0 {
+		return drift, changed > d.Keys
+	}
+	if len(last) == 0 {
+		return drift, true
+	}
+	return drift, float64(changed)/float64(len(last))*100 > d.Percent
+}
+
+func (d *Detector) String() string {
+	if d.Percent > 0 {
+		return strconv.FormatFloat(d.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.Itoa(d.Keys)
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%d key(s) appeared%s and %d disappeared%s, the previous result had %d",
+		len(d.Added), list(d.Added), len(d.Removed), list(d.Removed), d.Keys)
+}
+
+// list returns the first maxListed keys in parentheses.
+func list(keys []string) string {
+	switch {
+	case len(keys) == 0:
+		return ""
+	case len(keys) > maxListed:
+		return " (" + strings.Join(keys[:maxListed], ", ") + ", ...)"
+	}
+	return " (" + strings.Join(keys, ", ") + ")"
+}
+
+// paths adds the dotted paths of the values of the doc to the keys. The lists
+// and the empty objects are values.
+func paths(keys map[string]struct{}, prefix string, doc map[string]interface{}) {
+	for k, v := range doc {
+		if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+			paths(keys, prefix+k+".", m)
+			continue
+		}
+		keys[prefix+k] = struct{}{}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package drift_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alext234/expipe/tools/drift"
+)
+
+func TestParse(t *testing.T) {
+	tcs := []struct {
+		threshold string
+		keys      int
+		percent   float64
+	}{
+		{"0", 0, 0},
+		{"5", 5, 0},
+		{" 10% ", 0, 10},
+		{"2.5%", 0, 2.5},
+		{"0%", 0, 0},
+	}
+	for _, tc := range tcs {
+		d, err := drift.Parse(tc.threshold)
+		if err != nil {
+			t.Errorf("%q: err = (%v); want (nil)", tc.threshold, err)
+			continue
+		}
+		if d.Keys != tc.keys || d.Percent != tc.percent {
+			t.Errorf("%q: Parse() = (%d, %v); want (%d, %v)", tc.threshold, d.Keys, d.Percent, tc.keys, tc.percent)
+		}
+	}
+	for _, threshold := range []string{"", "lots", "-1", "-5%", "1.5", "%"} {
+		if _, err := drift.Parse(threshold); err == nil {
+			t.Errorf("%q: err = (nil); want (error)", threshold)
+		}
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	d, err := drift.Parse("1")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		content        string
+		want           bool
+		added, removed []string
+	}{
+		{`{"a":1,"memstats":{"Alloc":1,"Sys":2},"list":[1,2]}`, false, nil, nil},
+		{`{"a":2,"memstats":{"Alloc":3,"Sys":4},"list":[3]}`, false, nil, nil},
+		{`{"a":2,"memstats":{"Alloc":3,"HeapSys":4},"list":[3]}`, true, []string{"memstats.HeapSys"}, []string{"memstats.Sys"}},
+		{`{"a":2,"memstats":{"Alloc":3,"HeapSys":4},"list":[3],"b":1}`, false, []string{"b"}, nil},
+		{`invalid`, false, nil, nil},
+		{`{"a":2,"memstats":{},"list":[3],"b":1}`, true, []string{"memstats"}, []string{"memstats.Alloc", "memstats.HeapSys"}},
+	}
+	for i, tc := range tcs {
+		got, ok := d.Check([]byte(tc.content))
+		if ok != tc.want {
+			t.Errorf("%d: Check() = (%t); want (%t): %v", i, ok, tc.want, got)
+		}
+		if !reflect.DeepEqual(got.Added, tc.added) || !reflect.DeepEqual(got.Removed, tc.removed) {
+			t.Errorf("%d: Check() = (%v, %v); want (%v, %v)", i, got.Added, got.Removed, tc.added, tc.removed)
+		}
+	}
+}
+
+func TestCheckPercent(t *testing.T) {
+	d, err := drift.Parse("20%")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	d.Check([]byte(`{"a":1,"b":1,"c":1,"d":1,"e":1}`))
+	if _, ok := d.Check([]byte(`{"a":1,"b":1,"c":1,"d":1,"f":1}`)); !ok {
+		t.Error("Check() = (false); want (true): 2 of 5 keys have changed")
+	}
+	if _, ok := d.Check([]byte(`{"a":1,"b":1,"c":1,"d":1,"f":1,"g":1}`)); ok {
+		t.Error("Check() = (true); want (false): 1 of 5 keys has changed")
+	}
+}
+
+func TestDriftString(t *testing.T) {
+	d, err := drift.Parse("0")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	d.Check([]byte(`{"old":1,"kept":1}`))
+	got, ok := d.Check([]byte(`{"kept":1,"k0":0,"k1":1,"k2":2,"k3":3,"k4":4,"k5":5,"k6":6,"k7":7,"k8":8,"k9":9,"k10":10}`))
+	if !ok {
+		t.Fatal("Check() = (false); want (true)")
+	}
+	want := "11 key(s) appeared (k0, k1, k10, k2, k3, k4, k5, k6, k7, k8, ...) and 1 disappeared (old), the previous result had 2"
+	if got.String() != want {
+		t.Errorf("String() = (%s); want (%s)", got, want)
+	}
+	if d.String() != "0" {
+		t.Errorf("String() = (%s); want (0)", d)
+	}
+}
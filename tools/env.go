@@ -0,0 +1,69 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envReg matches ${VAR} and ${VAR:default}, and the escaped $${ sequence.
+var envReg = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::([^}]*))?\}`)
+
+// secretSchemes are the lookups of the ${scheme:reference} secrets.
+var secretSchemes = map[string]func(string) (string, error){
+	"file":  ReadSecretFile,
+	"vault": VaultSecret,
+}
+
+// UnsetEnvError is returned when an environment variable without a default
+// value is not set.
+type UnsetEnvError string
+
+func (u UnsetEnvError) Error() string {
+	return fmt.Sprintf("environment variable %s is not set", string(u))
+}
+
+// ExpandEnv replaces ${VAR} with the value of the VAR environment variable,
+// and ${VAR:default} with the default value if VAR is not set or is empty.
+// The secrets are looked up with ${file:/path/to/secret}, see ReadSecretFile,
+// and ${vault:path#field}, see VaultSecret. Use $${ for a literal ${. Other
+// dollar signs are left as they are. It returns an UnsetEnvError if a variable
+// is not set and has no default value.
+func ExpandEnv(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var err error
+	out := envReg.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$${" {
+			return "${"
+		}
+		sub := envReg.FindStringSubmatch(m)
+		if secret, ok := secretSchemes[sub[1]]; ok && strings.Contains(m, ":") {
+			v, e := secret(sub[2])
+			if e != nil && err == nil {
+				err = e
+			}
+			return v
+		}
+		if v := os.Getenv(sub[1]); v != "" {
+			return v
+		}
+		if strings.Contains(m, ":") {
+			return sub[2]
+		}
+		if err == nil {
+			err = UnsetEnvError(sub[1])
+		}
+		return ""
+	})
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("EXPIPE_TEST_HOST", "es.example.com")
+	os.Setenv("EXPIPE_TEST_EMPTY", "")
+	defer os.Unsetenv("EXPIPE_TEST_HOST")
+	defer os.Unsetenv("EXPIPE_TEST_EMPTY")
+
+	tcs := []struct {
+		input string
+		want  string
+	}{
+		{"http://localhost:9200", "http://localhost:9200"},
+		{"http://${EXPIPE_TEST_HOST}:9200", "http://es.example.com:9200"},
+		{"${EXPIPE_TEST_HOST:localhost}", "es.example.com"},
+		{"${EXPIPE_TEST_UNSET:localhost}", "localhost"},
+		{"${EXPIPE_TEST_EMPTY:localhost}", "localhost"},
+		{"${EXPIPE_TEST_UNSET:}", ""},
+		{"${EXPIPE_TEST_UNSET:http://a:9200}", "http://a:9200"},
+		{"$${EXPIPE_TEST_HOST}", "${EXPIPE_TEST_HOST}"},
+		{"pa$$word", "pa$$word"},
+		{"$EXPIPE_TEST_HOST", "$EXPIPE_TEST_HOST"},
+	}
+	for _, tc := range tcs {
+		got, err := ExpandEnv(tc.input)
+		if err != nil {
+			t.Errorf("%s: err = (%v); want (nil)", tc.input, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ExpandEnv(%s) = (%s); want (%s)", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestExpandEnvUnset(t *testing.T) {
+	for _, input := range []string{"${EXPIPE_TEST_UNSET}", "a-${EXPIPE_TEST_UNSET}-b"} {
+		_, err := ExpandEnv(input)
+		if e, ok := err.(UnsetEnvError); !ok || string(e) != "EXPIPE_TEST_UNSET" {
+			t.Errorf("%s: err = (%#v); want (UnsetEnvError(EXPIPE_TEST_UNSET))", input, err)
+		}
+	}
+}
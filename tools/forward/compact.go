@@ -0,0 +1,133 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package forward
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KeyMarker is the first character of the references to the Keys of a
+// compacted batch.
+const KeyMarker = "~"
+
+// Compact replaces the keys of the payloads that appear in more than one
+// document of the batch with references to the Keys of the batch, which are
+// the KeyMarker and the index of the key, therefore the long keys of the large
+// expvar maps are sent once per batch. The keys that start with the KeyMarker
+// are always replaced, so every key that starts with it is a reference. Only
+// the top level keys of the payloads are replaced, and their order is kept.
+func (b *Batch) Compact() error {
+	counts := make(map[string]int)
+	payloads := make([][]field, len(b.Documents))
+	for i, doc := range b.Documents {
+		fields, err := fields(doc.Payload)
+		if err != nil {
+			return errors.Wrapf(err, "document %s", doc.ID)
+		}
+		for _, f := range fields {
+			counts[f.key]++
+		}
+		payloads[i] = fields
+	}
+	refs := make(map[string]string)
+	b.Keys = nil
+	for i, fields := range payloads {
+		for j, f := range fields {
+			if counts[f.key] < 2 && !strings.HasPrefix(f.key, KeyMarker) {
+				continue
+			}
+			ref, ok := refs[f.key]
+			if !ok {
+				ref = KeyMarker + strconv.Itoa(len(b.Keys))
+				refs[f.key] = ref
+				b.Keys = append(b.Keys, f.key)
+			}
+			fields[j].key = ref
+		}
+		b.Documents[i].Payload = object(fields)
+	}
+	return nil
+}
+
+// Expand replaces the references of the payloads with the Keys of the batch,
+// and removes the Keys. It returns an error if a reference is not in the Keys.
+// It does nothing if the batch has no Keys.
+func (b *Batch) Expand() error {
+	if len(b.Keys) == 0 {
+		return nil
+	}
+	for i, doc := range b.Documents {
+		fields, err := fields(doc.Payload)
+		if err != nil {
+			return errors.Wrapf(err, "document %s", doc.ID)
+		}
+		for j, f := range fields {
+			if !strings.HasPrefix(f.key, KeyMarker) {
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimPrefix(f.key, KeyMarker))
+			if err != nil || n < 0 || n >= len(b.Keys) {
+				return fmt.Errorf("document %s: unknown key reference %q", doc.ID, f.key)
+			}
+			fields[j].key = b.Keys[n]
+		}
+		b.Documents[i].Payload = object(fields)
+	}
+	b.Keys = nil
+	return nil
+}
+
+type field struct {
+	key   string
+	value json.RawMessage
+}
+
+// fields returns the top level fields of the payload in their order.
+func fields(payload json.RawMessage) ([]field, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("the payload is not an object")
+	}
+	var fields []field
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding the payload")
+		}
+		var f field
+		f.key = t.(string)
+		if err = dec.Decode(&f.value); err != nil {
+			return nil, errors.Wrap(err, "decoding the payload")
+		}
+		fields = append(fields, f)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, errors.Wrap(err, "decoding the payload")
+	}
+	return fields, nil
+}
+
+// object returns the fields as a json object.
+func object(fields []field) json.RawMessage {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(f.value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package forward_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/tools/forward"
+)
+
+func TestBatchCompact(t *testing.T) {
+	batch := forward.Batch{Documents: []forward.Document{
+		{ID: "1", Payload: []byte(`{"memstats.HeapAlloc":1,"~tilde":2,"only.here":{"a":1}}`)},
+		{ID: "2", Payload: []byte(`{"memstats.HeapAlloc":3,"memstats.HeapSys":[1,2]}`)},
+		{ID: "3", Payload: []byte(`{"memstats.HeapSys":[3],"memstats.HeapAlloc":4}`)},
+	}}
+	want := make([]string, len(batch.Documents))
+	for i, doc := range batch.Documents {
+		want[i] = string(doc.Payload)
+	}
+	if err := batch.Compact(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if keys := []string{"memstats.HeapAlloc", "~tilde", "memstats.HeapSys"}; !reflect.DeepEqual(batch.Keys, keys) {
+		t.Errorf("Keys = (%v); want (%v)", batch.Keys, keys)
+	}
+	compacted := []string{`{"~0":1,"~1":2,"only.here":{"a":1}}`, `{"~0":3,"~2":[1,2]}`, `{"~2":[3],"~0":4}`}
+	for i, doc := range batch.Documents {
+		if string(doc.Payload) != compacted[i] {
+			t.Errorf("%d: Payload = (%s); want (%s)", i, doc.Payload, compacted[i])
+		}
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var got forward.Batch
+	if err = json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = got.Expand(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got.Keys != nil {
+		t.Errorf("Keys = (%v); want (nil)", got.Keys)
+	}
+	for i, doc := range got.Documents {
+		if string(doc.Payload) != want[i] {
+			t.Errorf("%d: Payload = (%s); want (%s)", i, doc.Payload, want[i])
+		}
+	}
+}
+
+func TestBatchExpandErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		payload string
+	}{
+		{"unknown reference", `{"~1":1}`},
+		{"not a reference", `{"~a":1}`},
+		{"not an object", `[1]`},
+		{"invalid", `{"~0":`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			batch := forward.Batch{
+				Documents: []forward.Document{{ID: "1", Payload: []byte(tc.payload)}},
+				Keys:      []string{"Alloc"},
+			}
+			if err := batch.Expand(); err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+	batch := forward.Batch{Documents: []forward.Document{{ID: "1", Payload: []byte(`{"~0":1}`)}}}
+	if err := batch.Expand(); err != nil || string(batch.Documents[0].Payload) != `{"~0":1}` {
+		t.Errorf("Expand() = (%v, %s); want (nil) without keys", err, batch.Documents[0].Payload)
+	}
+	batch.Documents[0].Payload = []byte(`not json`)
+	if err := batch.Compact(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestBatchCompactSize(t *testing.T) {
+	var batch forward.Batch
+	for i := 0; i < 20; i++ {
+		values := make([]datatype.DataType, 0, 100)
+		for j := 0; j < 100; j++ {
+			values = append(values, datatype.NewFloatType(fmt.Sprintf("groupcache.groups.thumbnails.main_cache.Evictions%d", j), float64(i*j)))
+		}
+		buf := new(bytes.Buffer)
+		if _, err := datatype.New(values).Generate(buf, time.Now()); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		batch.Documents = append(batch.Documents, forward.Document{ID: fmt.Sprint(i), Payload: buf.Bytes()})
+	}
+	before, _ := json.Marshal(batch)
+	if err := batch.Compact(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	after, _ := json.Marshal(batch)
+	if len(after) > len(before)/2 {
+		t.Errorf("len(compacted) = (%d); want (<= %d)", len(after), len(before)/2)
+	}
+}
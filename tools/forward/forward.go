@@ -0,0 +1,89 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package forward is the protocol between the forwarder recorders of the edge
+// agents and the receiver readers of a central expipe, which is the only one
+// that talks to the recorders like elasticsearch.
+//
+// The forwarders post a Batch of documents as json to the Path of the
+// receiver, which responds with 202 when all of them are queued, and with 503
+// when its queue is full. The batches can be compressed with gzip, with the
+// gzip Content-Encoding. A GET request to the Path is a ping. If the receiver
+// has a token, the requests should have it as a bearer token in their
+// Authorization header, otherwise they are answered with 401. The batches can
+// be compacted, which sends the keys that are repeated in their documents once
+// in the keys of the batch.
+package forward
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/pkg/errors"
+)
+
+// Path is the path of the receivers.
+const Path = "/expipe/v1/documents"
+
+// Document is a document as the forwarder would record it. The Payload is the
+// generated json object of the document, with its timestamp and labels.
+type Document struct {
+	ID       string          `json:"id"`
+	Reader   string          `json:"reader"`
+	TypeName string          `json:"type_name"`
+	Time     time.Time       `json:"time"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Batch is the body of the requests of the forwarders. The Keys are set if the
+// batch is compacted, see the Compact method.
+type Batch struct {
+	Documents []Document `json:"documents"`
+	Keys      []string   `json:"keys,omitempty"`
+}
+
+// Content returns the values of the Payload without the timestamp, and the
+// labels of the document, therefore they are not recorded twice when the
+// receiver's recorders add them again.
+func (d Document) Content() ([]byte, datatype.Labels, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(d.Payload, &doc); err != nil {
+		return nil, nil, errors.Wrap(err, "decoding the payload")
+	}
+	delete(doc, datatype.DefaultTimestampField)
+	var labels datatype.Labels
+	if raw, ok := doc["labels"]; ok {
+		if err := json.Unmarshal(raw, &labels); err != nil {
+			return nil, nil, errors.Wrap(err, "decoding the labels")
+		}
+		delete(doc, "labels")
+	}
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, labels, nil
+}
+
+// SetToken sets the token on the Authorization header of the req. It does
+// nothing if the token is empty.
+func SetToken(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// ValidToken returns true if the token is empty, or the req has the token in
+// its Authorization header.
+func ValidToken(req *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	got := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package forward_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/alext234/expipe/datatype"
+	"github.com/alext234/expipe/tools/forward"
+)
+
+func TestDocumentContent(t *testing.T) {
+	doc := forward.Document{
+		Payload: []byte(`{"@timestamp":"2017-01-02T15:04:05.999999+00:00","labels":{"region":"eu"},"Alloc":12.5,"app":"api"}`),
+	}
+	content, labels, err := doc.Content()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if want := `{"Alloc":12.5,"app":"api"}`; string(content) != want {
+		t.Errorf("content = (%s); want (%s)", content, want)
+	}
+	if want := (datatype.Labels{"region": "eu"}); !labels.Equal(want) {
+		t.Errorf("labels = (%v); want (%v)", labels, want)
+	}
+
+	doc.Payload = []byte(`{"Alloc":12.5}`)
+	if _, labels, err = doc.Content(); err != nil || labels != nil {
+		t.Errorf("labels, err = (%v, %v); want (nil, nil)", labels, err)
+	}
+	for _, payload := range []string{`not json`, `{"labels":"eu"}`} {
+		doc.Payload = []byte(payload)
+		if _, _, err := doc.Content(); err == nil {
+			t.Errorf("%s: err = (nil); want (error)", payload)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1"+forward.Path, nil)
+	if !forward.ValidToken(req, "") {
+		t.Error("ValidToken() = (false) for an empty token; want (true)")
+	}
+	if forward.ValidToken(req, "secret") {
+		t.Error("ValidToken() = (true) without the header; want (false)")
+	}
+	forward.SetToken(req, "wrong")
+	if forward.ValidToken(req, "secret") {
+		t.Error("ValidToken() = (true) for a wrong token; want (false)")
+	}
+	forward.SetToken(req, "secret")
+	if !forward.ValidToken(req, "secret") {
+		t.Error("ValidToken() = (false); want (true)")
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = (%s); want (Bearer secret)", got)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package geoip locates the IP addresses with the MaxMind DB files, for
+// example the GeoLite2 City database. The whole file is read into memory, and
+// the lookups are safe for concurrent use.
+//
+// Only the parts of the format that are needed for the lookups are
+// implemented, the uint128 values are returned as bytes.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidDatabase is returned when the database file is not a valid
+// MaxMind DB file.
+var ErrInvalidDatabase = errors.New("invalid maxmind database")
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// The types of the data section.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth is the limit of the nested values and pointers, which stops the
+// broken files from looping.
+const maxDepth = 32
+
+// DB is a MaxMind DB file that is read into memory.
+type DB struct {
+	buf        []byte
+	data       decoder
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// Open reads the database at the path.
+func Open(path string) (*DB, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading geoip database")
+	}
+	return New(b)
+}
+
+// New returns a DB from the contents of a database file. It returns an
+// ErrInvalidDatabase if the b is not a valid MaxMind DB file.
+func New(b []byte) (*DB, error) {
+	i := bytes.LastIndex(b, metadataMarker)
+	if i < 0 {
+		return nil, errors.Wrap(ErrInvalidDatabase, "no metadata")
+	}
+	meta, _, err := decoder{b[i+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "metadata")
+	}
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, errors.Wrap(ErrInvalidDatabase, "metadata is not a map")
+	}
+	d := &DB{buf: b}
+	for key, dst := range map[string]*uint{"node_count": &d.nodeCount, "record_size": &d.recordSize, "ip_version": &d.ipVersion} {
+		v, ok := m[key].(uint64)
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidDatabase, "metadata %s", key)
+		}
+		*dst = uint(v)
+	}
+	if d.recordSize != 24 && d.recordSize != 28 && d.recordSize != 32 {
+		return nil, errors.Wrapf(ErrInvalidDatabase, "record size %d", d.recordSize)
+	}
+	if d.ipVersion != 4 && d.ipVersion != 6 {
+		return nil, errors.Wrapf(ErrInvalidDatabase, "ip version %d", d.ipVersion)
+	}
+	treeSize := d.nodeCount * d.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errors.Wrap(ErrInvalidDatabase, "search tree is larger than the file")
+	}
+	d.data = decoder{b[treeSize+16 : i]}
+	if d.ipVersion == 6 {
+		for n := 0; n < 96 && d.ipv4Start < d.nodeCount; n++ {
+			d.ipv4Start = d.record(d.ipv4Start, 0)
+		}
+	}
+	return d, nil
+}
+
+// Lookup returns the record of the network of the ip, or nil if the ip is
+// not in the database.
+func (d *DB) Lookup(ip net.IP) (map[string]interface{}, error) {
+	var (
+		addr []byte
+		node uint
+	)
+	if ip4 := ip.To4(); ip4 != nil {
+		addr, node = ip4, d.ipv4Start
+	} else if d.ipVersion == 6 && len(ip) == net.IPv6len {
+		addr = ip
+	} else {
+		return nil, nil
+	}
+	for i := 0; i < len(addr)*8 && node < d.nodeCount; i++ {
+		node = d.record(node, uint(addr[i/8]>>(7-uint(i%8)))&1)
+	}
+	if node <= d.nodeCount {
+		return nil, nil
+	}
+	v, _, err := d.data.decode(int(node-d.nodeCount-16), 0)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.Wrap(ErrInvalidDatabase, "record is not a map")
+	}
+	return record, nil
+}
+
+// Locate returns the latitude and longitude of the ip. It returns false if
+// the ip is not found or it does not have a location.
+func (d *DB) Locate(ip net.IP) (lat, lon float64, ok bool) {
+	record, err := d.Lookup(ip)
+	if err != nil || record == nil {
+		return 0, 0, false
+	}
+	location, ok := record["location"].(map[string]interface{})
+	if !ok {
+		return 0, 0, false
+	}
+	lat, ok1 := location["latitude"].(float64)
+	lon, ok2 := location["longitude"].(float64)
+	return lat, lon, ok1 && ok2
+}
+
+// record returns the left record of the node if the bit is 0, or its right
+// record otherwise.
+func (d *DB) record(node, bit uint) uint {
+	switch d.recordSize {
+	case 24:
+		b := d.buf[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := d.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	}
+	return uint(binary.BigEndian.Uint32(d.buf[node*8+bit*4:]))
+}
+
+// decoder decodes the values of the data section, or the metadata, of which
+// the pointers are relative to the start of the buf.
+type decoder struct {
+	buf []byte
+}
+
+func (d decoder) bytes(off, n int) ([]byte, error) {
+	if off < 0 || n < 0 || off+n > len(d.buf) {
+		return nil, errors.Wrap(ErrInvalidDatabase, "unexpected end of data")
+	}
+	return d.buf[off : off+n], nil
+}
+
+func uintOf(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// decode returns the value at the off and the offset of the next value.
+func (d decoder) decode(off, depth int) (interface{}, int, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.Wrap(ErrInvalidDatabase, "too deep")
+	}
+	b, err := d.bytes(off, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	off++
+	typ := int(ctrl >> 5)
+	if typ == typePointer {
+		n := int(ctrl>>3&0x3) + 1
+		b, err := d.bytes(off, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		ptr := uintOf(b)
+		switch n {
+		case 1, 2, 3:
+			ptr |= uint64(ctrl&0x7) << (8 * uint(n))
+		}
+		ptr += [...]uint64{0, 2048, 526336, 0}[n-1]
+		v, _, err := d.decode(int(ptr), depth+1)
+		return v, off + n, err
+	}
+	if typ == typeExtended {
+		if b, err = d.bytes(off, 1); err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + int(b[0])
+		off++
+	}
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if b, err = d.bytes(off, n); err != nil {
+			return nil, 0, err
+		}
+		size = [...]int{29, 285, 65821}[n-1] + int(uintOf(b))
+		off += n
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			k, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.Wrap(ErrInvalidDatabase, "map key is not a string")
+			}
+			if m[key], off, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, off, nil
+	case typeArray:
+		a := make([]interface{}, size)
+		for i := range a {
+			if a[i], off, err = d.decode(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, off, nil
+	case typeBool:
+		return size != 0, off, nil
+	}
+
+	if b, err = d.bytes(off, size); err != nil {
+		return nil, 0, err
+	}
+	off += size
+	switch typ {
+	case typeString:
+		return string(b), off, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.Wrap(ErrInvalidDatabase, "double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.Wrap(ErrInvalidDatabase, "float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), off, nil
+	case typeBytes, typeUint128:
+		return append([]byte(nil), b...), off, nil
+	case typeUint16, typeUint32, typeUint64:
+		return uintOf(b), off, nil
+	case typeInt32:
+		return int64(int32(uint32(uintOf(b)))), off, nil
+	}
+	return nil, 0, errors.Wrapf(ErrInvalidDatabase, "unknown type %d", typ)
+}
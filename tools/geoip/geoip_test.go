@@ -0,0 +1,191 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package geoip_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/alext234/expipe/tools/geoip"
+	"github.com/pkg/errors"
+)
+
+type network struct {
+	cidr     string
+	lat, lon float64
+	country  string
+}
+
+// writeDB returns an IPv4 database with 24 bit records of the networks.
+func writeDB(t *testing.T, networks []network) []byte {
+	const empty, dataRec = -1, -2
+	nodes := [][2]int{{empty, empty}}
+	data := new(bytes.Buffer)
+	offsets := make([]int, len(networks))
+	for i, n := range networks {
+		_, ipNet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		ones, _ := ipNet.Mask.Size()
+		ip := ipNet.IP.To4()
+		node := 0
+		for b := 0; b < ones; b++ {
+			bit := int(ip[b/8]>>(7-uint(b%8))) & 1
+			if b == ones-1 {
+				nodes[node][bit] = dataRec - i
+				break
+			}
+			if nodes[node][bit] == empty {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+		offsets[i] = data.Len()
+		writeMap(data, 2)
+		writeString(data, "country")
+		writeMap(data, 1)
+		writeString(data, "iso_code")
+		writeString(data, n.country)
+		writeString(data, "location")
+		writeMap(data, 2)
+		writeString(data, "latitude")
+		writeDouble(data, n.lat)
+		writeString(data, "longitude")
+		writeDouble(data, n.lon)
+	}
+
+	buf := new(bytes.Buffer)
+	count := len(nodes)
+	for _, node := range nodes {
+		for _, rec := range node {
+			v := count
+			if rec >= 0 {
+				v = rec
+			} else if rec <= dataRec {
+				v = count + 16 + offsets[dataRec-rec]
+			}
+			buf.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	writeMap(buf, 3)
+	writeString(buf, "node_count")
+	writeUint(buf, 6, uint64(count), 4)
+	writeString(buf, "record_size")
+	writeUint(buf, 5, 24, 2)
+	writeString(buf, "ip_version")
+	writeUint(buf, 5, 4, 2)
+	return buf.Bytes()
+}
+
+func writeMap(w *bytes.Buffer, size int) { w.WriteByte(7<<5 | byte(size)) }
+
+func writeString(w *bytes.Buffer, s string) {
+	w.WriteByte(2<<5 | byte(len(s)))
+	w.WriteString(s)
+}
+
+func writeDouble(w *bytes.Buffer, f float64) {
+	w.WriteByte(3<<5 | 8)
+	binary.Write(w, binary.BigEndian, math.Float64bits(f))
+}
+
+func writeUint(w *bytes.Buffer, typ byte, v uint64, size int) {
+	w.WriteByte(typ<<5 | byte(size))
+	for i := size - 1; i >= 0; i-- {
+		w.WriteByte(byte(v >> (8 * uint(i))))
+	}
+}
+
+func TestLocate(t *testing.T) {
+	t.Parallel()
+	db, err := geoip.New(writeDB(t, []network{
+		{"1.2.3.0/24", 51.5, -0.12, "GB"},
+		{"81.0.0.0/8", 52.37, 4.89, "NL"},
+	}))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		ip       string
+		lat, lon float64
+		ok       bool
+	}{
+		{"1.2.3.4", 51.5, -0.12, true},
+		{"81.200.1.1", 52.37, 4.89, true},
+		{"1.2.4.4", 0, 0, false},
+		{"10.0.0.1", 0, 0, false},
+		{"2001:db8::1", 0, 0, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.ip, func(t *testing.T) {
+			lat, lon, ok := db.Locate(net.ParseIP(tc.ip))
+			if ok != tc.ok || lat != tc.lat || lon != tc.lon {
+				t.Errorf("Locate() = (%f, %f, %t); want (%f, %f, %t)", lat, lon, ok, tc.lat, tc.lon, tc.ok)
+			}
+		})
+	}
+	record, err := db.Lookup(net.ParseIP("1.2.3.4"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if country, _ := record["country"].(map[string]interface{}); country["iso_code"] != "GB" {
+		t.Errorf("record = (%v); want the GB country", record)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "geoip")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	name := path.Join(dir, "test.mmdb")
+	if err = ioutil.WriteFile(name, writeDB(t, []network{{"1.2.3.0/24", 1, 2, "GB"}}), 0600); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	db, err := geoip.Open(name)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, _, ok := db.Locate(net.ParseIP("1.2.3.4")); !ok {
+		t.Error("ok = (false); want (true)")
+	}
+	if _, err = geoip.Open(path.Join(dir, "missing.mmdb")); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	t.Parallel()
+	valid := writeDB(t, []network{{"1.2.3.0/24", 1, 2, "GB"}})
+	tcs := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", nil},
+		{"no metadata", valid[:20]},
+		{"truncated metadata", valid[:len(valid)-4]},
+		{"no tree", valid[bytes.LastIndex(valid, []byte("\xab\xcd\xefMaxMind.com")):]},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := geoip.New(tc.input); errors.Cause(err) != geoip.ErrInvalidDatabase {
+				t.Errorf("err = (%v); want (ErrInvalidDatabase)", err)
+			}
+		})
+	}
+}
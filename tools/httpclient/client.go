@@ -0,0 +1,369 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package httpclient provides the http.Client that is shared between the
+// readers and recorders. Sharing one client keeps the connections to the
+// endpoints alive between the scrapes, therefore the connection setup and TLS
+// handshakes are not repeated on every read. The settings of the shared
+// clients are changed with Configure, including the clients that are already
+// in use, therefore the readers can be created before the settings of their
+// configuration are applied.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/tools/trace"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+)
+
+const (
+	// DefaultMaxIdleConnsPerHost is used when the MaxIdleConnsPerHost of the
+	// Config is zero. It is large enough for a few readers scraping the same
+	// host on short intervals.
+	DefaultMaxIdleConnsPerHost = 16
+
+	// DefaultIdleConnTimeout is used when the IdleConnTimeout of the Config is
+	// zero.
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+var (
+	// ErrNilClient is returned when setting a nil client.
+	ErrNilClient = fmt.Errorf("nil http client")
+
+	// ErrNoCerts is returned when the CA file doesn't contain any PEM encoded
+	// certificates.
+	ErrNoCerts = fmt.Errorf("no certificates found in the CA file")
+
+	// ErrIncompleteCert is returned when only one of the client certificate
+	// and its key is set.
+	ErrIncompleteCert = fmt.Errorf("both the client certificate and key should be set")
+)
+
+// proxySchemes are the supported schemes of the proxy URLs.
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+var (
+	mu            sync.RWMutex
+	defaultClient *http.Client
+	defaultConfig Config
+	shared        = make(map[clientKey]*http.Client) // handed out
+	configured    = make(map[clientKey]*http.Client) // built from defaultConfig
+)
+
+// clientKey identifies the clients that are derived from the defaultConfig.
+type clientKey struct {
+	proxy, certFile, keyFile string
+}
+
+// Config holds the settings of the client. The zero value is usable.
+type Config struct {
+	// MaxIdleConnsPerHost is the number of keep-alive connections that are
+	// kept for each host.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is the duration an idle connection is kept before it is
+	// closed.
+	IdleConnTimeout time.Duration
+
+	// Proxy is the URL of the proxy server, which can be an http, https or
+	// socks5 URL. If empty, the proxy is read from the HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY environment variables.
+	Proxy string
+
+	// CAFile is the path to a PEM encoded file of the certificate authorities
+	// to trust, in addition to the system's.
+	CAFile string
+
+	// InsecureSkipVerify disables the verification of the server certificates.
+	InsecureSkipVerify bool
+
+	// CertFile and KeyFile are the paths to the PEM encoded certificate and
+	// private key that are presented to the servers that require the client
+	// certificates.
+	CertFile string
+	KeyFile  string
+
+	// DisableHTTP2 keeps the client on HTTP/1.1.
+	DisableHTTP2 bool
+}
+
+// New returns an http.Client with its own transport configured with c. The
+// transport propagates the trace context of the requests, see the trace
+// package, and records the connection metrics of the endpoints, see the
+// MetricsTransport. HTTP/2 is used with the endpoints that support it, unless
+// it is disabled.
+func New(c Config) (*http.Client, error) {
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	proxy := http.ProxyFromEnvironment
+	if c.Proxy != "" {
+		u, err := parseProxy(c.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(u)
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pool, err := certPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := clientCert(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	t := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          c.MaxIdleConnsPerHost * 8,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		IdleConnTimeout:       c.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if c.DisableHTTP2 {
+		// A non-nil empty map stops the transport from upgrading.
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	} else if err := http2.ConfigureTransport(t); err != nil {
+		return nil, errors.Wrap(err, "configuring http2")
+	}
+	return &http.Client{Transport: &trace.Transport{Base: &MetricsTransport{Base: t}}}, nil
+}
+
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing proxy")
+	}
+	for _, scheme := range proxySchemes {
+		if u.Scheme == scheme && u.Host != "" {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported proxy %s: should be one of %s URLs", proxy, strings.Join(proxySchemes, ", "))
+}
+
+func clientCert(certFile, keyFile string) (tls.Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return tls.Certificate{}, ErrIncompleteCert
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return cert, errors.Wrap(err, "loading the client certificate")
+	}
+	return cert, nil
+}
+
+func certPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading CA file")
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, ErrNoCerts
+	}
+	return pool, nil
+}
+
+// Default returns the shared client. Unless SetDefault has been called, its
+// requests are sent with the settings of the last Configure call, therefore
+// the readers and recorders that were created before the call use the new
+// settings too. The zero Config is used until Configure is called.
+func Default() *http.Client {
+	mu.RLock()
+	c := defaultClient
+	mu.RUnlock()
+	if c != nil {
+		return c
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if defaultClient == nil {
+		defaultClient = sharedClient(clientKey{})
+	}
+	return defaultClient
+}
+
+// SetDefault replaces the shared client. The readers and recorders that are
+// created afterwards will use c, until Configure is called.
+func SetDefault(c *http.Client) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	defaultClient = c
+	return nil
+}
+
+// Configure changes the settings of the shared client, and of the clients
+// returned from WithProxy and WithClientCert, to c. The clients that are
+// already in use send their next requests with c, and the idle connections
+// of the previous settings are closed. The connections are kept if the
+// settings have not changed. It replaces the client that was set with
+// SetDefault.
+func Configure(c Config) error {
+	mu.Lock()
+	if _, ok := configured[clientKey{}]; ok && c == defaultConfig {
+		defaultClient = sharedClient(clientKey{})
+		mu.Unlock()
+		return nil
+	}
+	mu.Unlock()
+	client, err := New(c)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	prev := configured
+	defaultClient = sharedClient(clientKey{})
+	defaultConfig = c
+	configured = map[clientKey]*http.Client{{}: client}
+	mu.Unlock()
+	for _, p := range prev {
+		p.CloseIdleConnections()
+	}
+	return nil
+}
+
+// WithProxy returns a client that sends the requests through the proxy, with
+// the rest of the settings of the last Configure call. The readers and
+// recorders that use the same proxy share the client. If the proxy is empty,
+// the shared client is returned.
+func WithProxy(proxy string) (*http.Client, error) {
+	return WithClientCert(proxy, "", "")
+}
+
+// WithClientCert returns a client that presents the certificate of the
+// certFile and keyFile to the servers, and sends the requests through the
+// proxy, with the rest of the settings of the last Configure call. The
+// certificate of the last Configure call is used if the certFile and keyFile
+// are empty, and the proxy of the environment is used if the proxy is empty.
+// The readers that use the same proxy and certificate share the client.
+func WithClientCert(proxy, certFile, keyFile string) (*http.Client, error) {
+	if proxy == "" && certFile == "" && keyFile == "" {
+		return Default(), nil
+	}
+	key := clientKey{proxy: proxy, certFile: certFile, keyFile: keyFile}
+	// The settings are checked here, therefore the errors are returned to
+	// the readers instead of their requests.
+	if _, err := configuredClient(key); err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return sharedClient(key), nil
+}
+
+// sharedClient returns the client that is handed out for the key. The caller
+// should hold the mu.
+func sharedClient(key clientKey) *http.Client {
+	c, ok := shared[key]
+	if !ok {
+		c = &http.Client{Transport: sharedTransport{key: key}}
+		shared[key] = c
+	}
+	return c
+}
+
+// configuredClient returns the client of the key that is configured with the
+// settings of the last Configure call.
+func configuredClient(key clientKey) (*http.Client, error) {
+	for {
+		mu.RLock()
+		c, ok := configured[key]
+		base := defaultConfig
+		mu.RUnlock()
+		if ok {
+			return c, nil
+		}
+		conf := base
+		if key.proxy != "" {
+			conf.Proxy = key.proxy
+		}
+		if key.certFile != "" || key.keyFile != "" {
+			conf.CertFile, conf.KeyFile = key.certFile, key.keyFile
+		}
+		c, err := New(conf)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		if base == defaultConfig {
+			if other, ok := configured[key]; ok {
+				c = other
+			} else {
+				configured[key] = c
+			}
+			mu.Unlock()
+			return c, nil
+		}
+		// Configure was called in between, the client is built again with the
+		// new settings.
+		mu.Unlock()
+	}
+}
+
+// sharedTransport sends the requests with the transport of the client of the
+// key that is configured with the last Configure call.
+type sharedTransport struct {
+	key clientKey
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c, err := configuredClient(t.key)
+	if err != nil {
+		return nil, err
+	}
+	return c.Transport.RoundTrip(req)
+}
+
+// closeIdle closes the idle connections of the base, if it keeps any.
+func closeIdle(base http.RoundTripper) {
+	if c, ok := base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// CloseIdleConnections closes the idle connections of the configured client.
+func (t sharedTransport) CloseIdleConnections() {
+	mu.RLock()
+	c, ok := configured[t.key]
+	mu.RUnlock()
+	if ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,422 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package httpclient_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/trace"
+	"github.com/pkg/errors"
+)
+
+func transport(t *testing.T, c *http.Client) *http.Transport {
+	tt, ok := c.Transport.(*trace.Transport)
+	if !ok {
+		t.Fatalf("c.Transport = (%T); want (*trace.Transport)", c.Transport)
+	}
+	mt, ok := tt.Base.(*httpclient.MetricsTransport)
+	if !ok {
+		t.Fatalf("Base = (%T); want (*httpclient.MetricsTransport)", tt.Base)
+	}
+	tr, ok := mt.Base.(*http.Transport)
+	if !ok {
+		t.Fatalf("Base = (%T); want (*http.Transport)", mt.Base)
+	}
+	return tr
+}
+
+func TestNewDefaults(t *testing.T) {
+	c, err := httpclient.New(httpclient.Config{})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tr := transport(t, c)
+	if tr.MaxIdleConnsPerHost != httpclient.DefaultMaxIdleConnsPerHost {
+		t.Errorf("MaxIdleConnsPerHost = (%d); want (%d)", tr.MaxIdleConnsPerHost, httpclient.DefaultMaxIdleConnsPerHost)
+	}
+	if tr.IdleConnTimeout != httpclient.DefaultIdleConnTimeout {
+		t.Errorf("IdleConnTimeout = (%v); want (%v)", tr.IdleConnTimeout, httpclient.DefaultIdleConnTimeout)
+	}
+	if proto := protoMajor(t, httpclient.Config{InsecureSkipVerify: true}); proto != 2 {
+		t.Errorf("ProtoMajor = (%d); want (2)", proto)
+	}
+}
+
+// protoMajor makes a request with a client configured with c against a TLS
+// server that supports HTTP/2, and returns the major version of the protocol
+// the response arrived with.
+func protoMajor(t *testing.T, c httpclient.Config) int {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	client, err := httpclient.New(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	return resp.ProtoMajor
+}
+
+func TestNewConfig(t *testing.T) {
+	c, err := httpclient.New(httpclient.Config{
+		MaxIdleConnsPerHost: 3,
+		IdleConnTimeout:     time.Second,
+		Proxy:               "http://localhost:3128",
+		InsecureSkipVerify:  true,
+		DisableHTTP2:        true,
+	})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tr := transport(t, c)
+	if tr.MaxIdleConnsPerHost != 3 {
+		t.Errorf("MaxIdleConnsPerHost = (%d); want (3)", tr.MaxIdleConnsPerHost)
+	}
+	if tr.IdleConnTimeout != time.Second {
+		t.Errorf("IdleConnTimeout = (%v); want (1s)", tr.IdleConnTimeout)
+	}
+	if !tr.TLSClientConfig.InsecureSkipVerify {
+		t.Error("InsecureSkipVerify = (false); want (true)")
+	}
+	if proto := protoMajor(t, httpclient.Config{InsecureSkipVerify: true, DisableHTTP2: true}); proto != 1 {
+		t.Errorf("ProtoMajor = (%d); want (1)", proto)
+	}
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	u, err := tr.Proxy(req)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if u.String() != "http://localhost:3128" {
+		t.Errorf("proxy = (%s); want (http://localhost:3128)", u)
+	}
+}
+
+func TestNewCAFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = httpclient.New(httpclient.Config{CAFile: path.Join(dir, "nofile")})
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	bad := path.Join(dir, "bad.pem")
+	ioutil.WriteFile(bad, []byte("not a certificate"), 0600)
+	_, err = httpclient.New(httpclient.Config{CAFile: bad})
+	if errors.Cause(err) != httpclient.ErrNoCerts {
+		t.Errorf("err = (%v); want (ErrNoCerts)", err)
+	}
+}
+
+func TestNewCAFileTrustsServer(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "httpclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := path.Join(dir, "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}
+	ioutil.WriteFile(ca, pem.EncodeToMemory(block), 0600)
+
+	c, err := httpclient.New(httpclient.Config{CAFile: ca})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+}
+
+func TestDefault(t *testing.T) {
+	c := httpclient.Default()
+	if c == nil {
+		t.Fatal("Default() = (nil); want (*http.Client)")
+	}
+	if c != httpclient.Default() {
+		t.Error("Default() returned a different client")
+	}
+	if err := httpclient.SetDefault(nil); err != httpclient.ErrNilClient {
+		t.Errorf("err = (%v); want (ErrNilClient)", err)
+	}
+	other := &http.Client{}
+	if err := httpclient.SetDefault(other); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer httpclient.SetDefault(c)
+	if httpclient.Default() != other {
+		t.Error("Default() did not return the new client")
+	}
+}
+
+func TestNewProxyErrors(t *testing.T) {
+	for _, proxy := range []string{"ftp://localhost:21", "localhost:3128", "://bad"} {
+		if _, err := httpclient.New(httpclient.Config{Proxy: proxy}); err == nil {
+			t.Errorf("%s: err = (nil); want (error)", proxy)
+		}
+	}
+	if _, err := httpclient.New(httpclient.Config{Proxy: "socks5://localhost:1080"}); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestWithProxy(t *testing.T) {
+	prev := httpclient.Default()
+	defer httpclient.SetDefault(prev)
+	hosts := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.URL.Host
+	}))
+	defer proxy.Close()
+	if err := httpclient.Configure(httpclient.Config{MaxIdleConnsPerHost: 3}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c, err := httpclient.WithProxy("")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c != httpclient.Default() {
+		t.Error("WithProxy(\"\") did not return the default client")
+	}
+
+	c, err = httpclient.WithProxy(proxy.URL)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp, err := c.Get("http://example.com")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if host := <-hosts; host != "example.com" {
+		t.Errorf("host = (%s); want (example.com)", host)
+	}
+	if other, _ := httpclient.WithProxy(proxy.URL); other != c {
+		t.Error("WithProxy() returned a different client for the same proxy")
+	}
+	if other, _ := httpclient.WithProxy("http://localhost:3128"); other == c {
+		t.Error("WithProxy() returned the same client for another proxy")
+	}
+	if _, err = httpclient.WithProxy("ftp://localhost:21"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestConfigureUpdatesClients(t *testing.T) {
+	prev := httpclient.Default()
+	defer httpclient.SetDefault(prev)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer ts.Close()
+	if err := httpclient.Configure(httpclient.Config{}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c := httpclient.Default()
+	if resp, err := c.Get(ts.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("err = (nil); want (unknown authority)")
+	}
+
+	if err := httpclient.Configure(httpclient.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if httpclient.Default() != c {
+		t.Error("Default() returned a different client after Configure")
+	}
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+
+	if err = httpclient.Configure(httpclient.Config{Proxy: "ftp://localhost:21"}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if resp, err = c.Get(ts.URL); err != nil {
+		t.Fatalf("the settings were changed by the failed call: err = (%v)", err)
+	}
+	resp.Body.Close()
+}
+
+// writeClientCert writes a self signed client certificate and its key to the
+// dir.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "expipe"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	certFile, keyFile = path.Join(dir, "client.pem"), path.Join(dir, "client.key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile, cert
+}
+
+func TestNewClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, cert := writeClientCert(t, dir)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	ts.StartTLS()
+	defer ts.Close()
+
+	c, err := httpclient.New(httpclient.Config{InsecureSkipVerify: true, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+
+	c, err = httpclient.New(httpclient.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if resp, err = c.Get(ts.URL); err == nil {
+		resp.Body.Close()
+		t.Error("err = (nil); want (error)")
+	}
+
+	if _, err = httpclient.New(httpclient.Config{CertFile: certFile}); err != httpclient.ErrIncompleteCert {
+		t.Errorf("err = (%v); want (ErrIncompleteCert)", err)
+	}
+	if _, err = httpclient.New(httpclient.Config{CertFile: certFile, KeyFile: path.Join(dir, "nofile")}); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithClientCert(t *testing.T) {
+	prev := httpclient.Default()
+	defer httpclient.SetDefault(prev)
+	dir, err := ioutil.TempDir("", "httpclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, cert := writeClientCert(t, dir)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	ts.StartTLS()
+	defer ts.Close()
+
+	if err = httpclient.Configure(httpclient.Config{MaxIdleConnsPerHost: 3}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c, _ := httpclient.WithClientCert("", "", ""); c != httpclient.Default() {
+		t.Error("WithClientCert() did not return the default client")
+	}
+	c, err := httpclient.WithClientCert("", certFile, keyFile)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	// The client is created before the server's certificate is trusted.
+	if err = httpclient.Configure(httpclient.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if resp, err = httpclient.Default().Get(ts.URL); err == nil {
+		resp.Body.Close()
+		t.Error("err = (nil); want (error)")
+	}
+	if other, _ := httpclient.WithClientCert("", certFile, keyFile); other != c {
+		t.Error("WithClientCert() returned a different client for the same certificate")
+	}
+	if other, _ := httpclient.WithClientCert("socks5://localhost:1080", certFile, keyFile); other == c {
+		t.Error("WithClientCert() returned the same client for another proxy")
+	}
+	if _, err = httpclient.WithClientCert("", certFile, ""); err != httpclient.ErrIncompleteCert {
+		t.Errorf("err = (%v); want (ErrIncompleteCert)", err)
+	}
+}
+
+func TestCloseIdleConnections(t *testing.T) {
+	prev := httpclient.Default()
+	defer httpclient.SetDefault(prev)
+	closed := make(chan struct{}, 1)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+	if err := httpclient.Configure(httpclient.Config{}); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c, _ := httpclient.Skewed(httpclient.Default())
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	c.CloseIdleConnections()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("the idle connection was not closed")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"expvar"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// The bytes of the request bodies before and after the compression, labelled
+// by the names of the CompressTransports. They are the same for the transports
+// that do not compress.
+var (
+	uncompressedBytes = expvar.NewMap("Request Uncompressed Bytes")
+	compressedBytes   = expvar.NewMap("Request Compressed Bytes")
+)
+
+// CompressTransport counts the bytes of the request bodies before and after
+// the compression, labelled by the Name. The bodies are compressed with gzip
+// if Gzip is true, and sent with the gzip Content-Encoding.
+type CompressTransport struct {
+	// Base is used for sending the requests. http.DefaultTransport is used if
+	// it is nil.
+	Base http.RoundTripper
+	Name string
+	Gzip bool
+}
+
+// RoundTrip implements the http.RoundTripper interface. The requests without
+// bodies are sent as they are.
+func (t *CompressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return base.RoundTrip(req)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	uncompressedBytes.Add(t.Name, int64(len(body)))
+	req = req.Clone(req.Context())
+	if t.Gzip {
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		zw.Write(body)
+		if err = zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	compressedBytes.Add(t.Name, int64(len(body)))
+	req.ContentLength = int64(len(body))
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return base.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the Base.
+func (t *CompressTransport) CloseIdleConnections() { closeIdle(t.Base) }
+
+// Compressed returns a copy of the client that sends its requests through a
+// CompressTransport of the name, which compresses the bodies if gzip is true.
+func Compressed(c *http.Client, name string, gzip bool) *http.Client {
+	client := *c
+	client.Transport = &CompressTransport{Base: c.Transport, Name: name, Gzip: gzip}
+	return &client
+}
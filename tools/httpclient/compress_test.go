@@ -0,0 +1,79 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package httpclient_test
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alext234/expipe/tools/httpclient"
+)
+
+func TestCompressed(t *testing.T) {
+	bodies := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("err = (%v); want (nil)", err)
+				return
+			}
+			body = zr
+		}
+		b, _ := ioutil.ReadAll(body)
+		bodies <- r.Header.Get("Content-Encoding") + ":" + string(b)
+	}))
+	defer ts.Close()
+	payload := strings.Repeat(`{"alloc":1024}`, 100)
+
+	tcs := []struct {
+		name string
+		gzip bool
+		want string
+	}{
+		{"compress_plain", false, ":" + payload},
+		{"compress_gzip", true, "gzip:" + payload},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := httpclient.Compressed(http.DefaultClient, tc.name, tc.gzip)
+			resp, err := c.Post(ts.URL, "application/json", strings.NewReader(payload))
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			resp.Body.Close()
+			if got := <-bodies; got != tc.want {
+				t.Errorf("body = (%.40s...); want (%.40s...)", got, tc.want)
+			}
+			raw := intMetric("Request Uncompressed Bytes", tc.name)
+			wire := intMetric("Request Compressed Bytes", tc.name)
+			if raw != int64(len(payload)) {
+				t.Errorf("uncompressed = (%d); want (%d)", raw, len(payload))
+			}
+			if tc.gzip && wire >= raw {
+				t.Errorf("compressed = (%d); want less than (%d)", wire, raw)
+			}
+			if !tc.gzip && wire != raw {
+				t.Errorf("compressed = (%d); want (%d)", wire, raw)
+			}
+		})
+	}
+
+	c := httpclient.Compressed(http.DefaultClient, "compress_get", true)
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if got := <-bodies; got != ":" {
+		t.Errorf("body = (%s); want (:)", got)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package httpclient
+
+import (
+	"crypto/tls"
+	"expvar"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/tools/metrics"
+)
+
+// The connection metrics of the endpoints, labelled by their hosts. They tell
+// whether the time of a request is spent on the network or on the endpoint.
+var (
+	newConns       = expvar.NewMap("HTTP New Connections")
+	reusedConns    = expvar.NewMap("HTTP Reused Connections")
+	http2Responses = expvar.NewMap("HTTP2 Responses")
+	dnsDuration    = metrics.NewHistogramVec("HTTP DNS Duration Seconds", metrics.DurationBuckets)
+	dialDuration   = metrics.NewHistogramVec("HTTP Dial Duration Seconds", metrics.DurationBuckets)
+	tlsDuration    = metrics.NewHistogramVec("HTTP TLS Handshake Duration Seconds", metrics.DurationBuckets)
+	firstByte      = metrics.NewHistogramVec("HTTP First Byte Duration Seconds", metrics.DurationBuckets)
+)
+
+// MetricsTransport records the connection metrics of the requests for each
+// host: the new and reused connections, the durations of the DNS lookups, the
+// dials and the TLS handshakes, the time to the first byte of the responses,
+// and the responses that are served over HTTP/2.
+type MetricsTransport struct {
+	// Base is used for sending the requests. http.DefaultTransport is used if
+	// it is nil.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *MetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	host := req.URL.Host
+	ct := newConnTrace(host)
+	resp, err := base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), ct.clientTrace())))
+	if err == nil && resp.ProtoMajor == 2 {
+		http2Responses.Add(host, 1)
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the Base.
+func (t *MetricsTransport) CloseIdleConnections() { closeIdle(t.Base) }
+
+// connTrace holds the start times of the phases of a request. The hooks can be
+// called concurrently, for example when dialling multiple addresses.
+type connTrace struct {
+	host  string
+	start time.Time
+	mu    sync.Mutex
+	dns   time.Time // guarded by mu.
+	dial  time.Time // guarded by mu.
+	tls   time.Time // guarded by mu.
+}
+
+func newConnTrace(host string) *connTrace {
+	return &connTrace{host: host, start: time.Now()}
+}
+
+func (c *connTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { c.begin(&c.dns) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			c.end(&c.dns, dnsDuration, info.Err)
+		},
+		ConnectStart: func(string, string) { c.begin(&c.dial) },
+		ConnectDone: func(_, _ string, err error) {
+			c.end(&c.dial, dialDuration, err)
+		},
+		TLSHandshakeStart: func() { c.begin(&c.tls) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			c.end(&c.tls, tlsDuration, err)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				reusedConns.Add(c.host, 1)
+				return
+			}
+			newConns.Add(c.host, 1)
+		},
+		GotFirstResponseByte: func() {
+			firstByte.With(c.host).ObserveDuration(time.Since(c.start))
+		},
+	}
+}
+
+func (c *connTrace) begin(t *time.Time) {
+	c.mu.Lock()
+	*t = time.Now()
+	c.mu.Unlock()
+}
+
+// end observes the time since t if the phase has succeeded.
+func (c *connTrace) end(t *time.Time, h *metrics.HistogramVec, err error) {
+	c.mu.Lock()
+	start := *t
+	c.mu.Unlock()
+	if err == nil && !start.IsZero() {
+		h.With(c.host).ObserveDuration(time.Since(start))
+	}
+}
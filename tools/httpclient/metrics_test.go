@@ -0,0 +1,117 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package httpclient_test
+
+import (
+	"crypto/tls"
+	"expvar"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/alext234/expipe/tools/metrics"
+	"golang.org/x/net/http2"
+)
+
+func intMetric(name, host string) int64 {
+	if v, ok := expvar.Get(name).(*expvar.Map).Get(host).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func histogramCount(name, host string) int64 {
+	h, ok := expvar.Get(name).(*expvar.Map).Get(host).(*metrics.Histogram)
+	if !ok {
+		return 0
+	}
+	counts, _ := h.Values()
+	return counts[len(counts)-1]
+}
+
+// The connections are not guaranteed to be reused, for example the client can
+// dial again if the previous connection has not gone back to the pool yet.
+// Therefore the tests only check the counters that are deterministic.
+
+func TestMetricsTransport(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	if err := http2.ConfigureServer(ts.Config, nil); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ts.TLS = &tls.Config{NextProtos: []string{"h2"}}
+	ts.StartTLS()
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	host := u.Host
+
+	c, err := httpclient.New(httpclient.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "HTTP/2.0" {
+			t.Errorf("proto = (%s); want (HTTP/2.0)", body)
+		}
+	}
+	if got := intMetric("HTTP2 Responses", host); got != 3 {
+		t.Errorf("HTTP2 Responses = (%d); want (3)", got)
+	}
+	if got := histogramCount("HTTP First Byte Duration Seconds", host); got < 3 {
+		t.Errorf("HTTP First Byte Duration Seconds count = (%d); want (>= 3)", got)
+	}
+	newConns := intMetric("HTTP New Connections", host)
+	if newConns < 1 {
+		t.Errorf("HTTP New Connections = (%d); want (>= 1)", newConns)
+	}
+	if got := intMetric("HTTP Reused Connections", host); newConns+got < 3 {
+		t.Errorf("HTTP New and Reused Connections = (%d, %d); want (>= 3) in total", newConns, got)
+	}
+	if got := histogramCount("HTTP Dial Duration Seconds", host); got != newConns {
+		t.Errorf("HTTP Dial Duration Seconds count = (%d); want (%d)", got, newConns)
+	}
+	if got := histogramCount("HTTP TLS Handshake Duration Seconds", host); got != newConns {
+		t.Errorf("HTTP TLS Handshake Duration Seconds count = (%d); want (%d)", got, newConns)
+	}
+}
+
+func TestMetricsTransportHTTP1(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	c := &http.Client{Transport: &httpclient.MetricsTransport{
+		Base: &http.Transport{DisableKeepAlives: true},
+	}}
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if got := intMetric("HTTP New Connections", u.Host); got != 2 {
+		t.Errorf("HTTP New Connections = (%d); want (2)", got)
+	}
+	if got := intMetric("HTTP Reused Connections", u.Host); got != 0 {
+		t.Errorf("HTTP Reused Connections = (%d); want (0)", got)
+	}
+	if got := histogramCount("HTTP Dial Duration Seconds", u.Host); got != 2 {
+		t.Errorf("HTTP Dial Duration Seconds count = (%d); want (2)", got)
+	}
+	if got := intMetric("HTTP2 Responses", u.Host); got != 0 {
+		t.Errorf("HTTP2 Responses = (%d); want (0)", got)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package httpclient
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SkewTransport estimates the difference between the clock of the endpoint
+// and the local clock from the Date headers of the responses. The Date header
+// has a resolution of one second, therefore the skews under a second are not
+// meaningful.
+type SkewTransport struct {
+	// Base is used for sending the requests. http.DefaultTransport is used if
+	// it is nil.
+	Base http.RoundTripper
+
+	mu   sync.Mutex
+	skew time.Duration // guarded by mu.
+	seen bool          // guarded by mu.
+}
+
+// RoundTrip implements the http.RoundTripper interface. The endpoint's time is
+// compared with the middle of the round trip. The responses without a valid
+// Date header are ignored.
+func (t *SkewTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return resp, nil
+	}
+	local := start.Add(time.Since(start) / 2)
+	// The Date is truncated to the second, the endpoint's time is anywhere in
+	// the following second.
+	skew := date.Add(500 * time.Millisecond).Sub(local)
+	t.mu.Lock()
+	t.skew, t.seen = skew, true
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the Base.
+func (t *SkewTransport) CloseIdleConnections() { closeIdle(t.Base) }
+
+// Skew returns the skew of the last response. It is positive when the clock of
+// the endpoint is ahead of the local clock. It returns false if no response
+// had a Date header yet.
+func (t *SkewTransport) Skew() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.skew, t.seen
+}
+
+// Skewed returns a copy of the client that sends its requests through a
+// SkewTransport, and the transport for reading the skew.
+func Skewed(c *http.Client) (*http.Client, *SkewTransport) {
+	client := *c
+	t := &SkewTransport{Base: c.Transport}
+	client.Transport = t
+	return &client, t
+}
@@ -0,0 +1,60 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package httpclient_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools/httpclient"
+)
+
+func TestSkewed(t *testing.T) {
+	var date string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if date != "" {
+			w.Header().Set("Date", date)
+		}
+	}))
+	defer ts.Close()
+	c, skew := httpclient.Skewed(http.DefaultClient)
+	get := func() {
+		resp, err := c.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		resp.Body.Close()
+	}
+
+	date = "not a date"
+	get()
+	if _, ok := skew.Skew(); ok {
+		t.Error("ok = (true); want (false)")
+	}
+
+	tcs := []struct {
+		name   string
+		offset time.Duration
+	}{
+		{"in sync", 0},
+		{"ahead", time.Hour},
+		{"behind", -10 * time.Minute},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			date = time.Now().Add(tc.offset).UTC().Format(http.TimeFormat)
+			get()
+			got, ok := skew.Skew()
+			if !ok {
+				t.Fatal("ok = (false); want (true)")
+			}
+			if diff := got - tc.offset; diff < -time.Second || diff > time.Second {
+				t.Errorf("Skew() = (%s); want (%s ± 1s)", got, tc.offset)
+			}
+		})
+	}
+}
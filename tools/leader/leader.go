@@ -0,0 +1,130 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package leader lets multiple replicas of expipe run in active/passive mode.
+// Only the replica that holds the lock is the leader and scrapes the readers.
+// The other replicas wait until the lock is released, which happens when the
+// leader stops or dies, and one of them takes over.
+//
+// The FileLock uses an advisory lock on a file, therefore all replicas should
+// have access to the same file. The operating system releases the lock when
+// the process dies.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRetryInterval is used when the retry interval is not positive.
+const DefaultRetryInterval = time.Second
+
+var (
+	// ErrLocked is returned when the lock is held by another process.
+	ErrLocked = fmt.Errorf("lock is held by another process")
+
+	// ErrNotHeld is returned when releasing a lock that is not held.
+	ErrNotHeld = fmt.Errorf("lock is not held")
+
+	// ErrEmptyPath is returned when the path of the lock file is empty.
+	ErrEmptyPath = fmt.Errorf("empty lock file path")
+)
+
+// FileLock is an exclusive lock on a file. It is concurrent safe.
+type FileLock struct {
+	mu   sync.Mutex
+	path string
+	file *os.File // is nil when the lock is not held.
+}
+
+// NewFileLock returns a FileLock on the path. The file is created when the
+// lock is being acquired.
+func NewFileLock(path string) (*FileLock, error) {
+	if path == "" {
+		return nil, ErrEmptyPath
+	}
+	return &FileLock{path: path}, nil
+}
+
+// TryLock tries to acquire the lock once. It returns ErrLocked if the lock is
+// held by another process.
+func (l *FileLock) TryLock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return nil
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening lock file")
+	}
+	if err = lock(f); err != nil {
+		f.Close()
+		return err
+	}
+	// the content is only informational.
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	l.file = f
+	return nil
+}
+
+// Acquire blocks until the lock is acquired or the ctx is done. It tries to
+// acquire the lock on every interval.
+func (l *FileLock) Acquire(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultRetryInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := l.TryLock()
+		if err == nil {
+			return nil
+		}
+		if errors.Cause(err) != ErrLocked {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Holder returns the pid of the process that holds the lock, as it was written
+// to the file when the lock was acquired.
+func (l *FileLock) Holder() (int, error) {
+	b, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return 0, errors.Wrap(err, "reading lock file")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, errors.Wrap(err, "parsing the pid of the lock file")
+	}
+	return pid, nil
+}
+
+// Release releases the lock. It returns ErrNotHeld if the lock is not held.
+func (l *FileLock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return ErrNotHeld
+	}
+	err := unlock(l.file)
+	l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package leader_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools/leader"
+	"github.com/pkg/errors"
+)
+
+func lockPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "expipe_leader")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return filepath.Join(dir, "expipe.lock"), func() { os.RemoveAll(dir) }
+}
+
+func TestNewFileLockEmptyPath(t *testing.T) {
+	t.Parallel()
+	l, err := leader.NewFileLock("")
+	if err != leader.ErrEmptyPath {
+		t.Errorf("err = (%v); want (%v)", err, leader.ErrEmptyPath)
+	}
+	if l != nil {
+		t.Errorf("l = (%v); want (nil)", l)
+	}
+}
+
+func TestFileLockTryLock(t *testing.T) {
+	t.Parallel()
+	path, cleanup := lockPath(t)
+	defer cleanup()
+	l1, _ := leader.NewFileLock(path)
+	l2, _ := leader.NewFileLock(path)
+	if err := l1.TryLock(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err := l1.TryLock(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if err := l2.TryLock(); errors.Cause(err) != leader.ErrLocked {
+		t.Errorf("err = (%v); want (%v)", err, leader.ErrLocked)
+	}
+	if err := l1.Release(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if err := l1.Release(); err != leader.ErrNotHeld {
+		t.Errorf("err = (%v); want (%v)", err, leader.ErrNotHeld)
+	}
+	if err := l2.TryLock(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	l2.Release()
+}
+
+func TestFileLockHolder(t *testing.T) {
+	t.Parallel()
+	path, cleanup := lockPath(t)
+	defer cleanup()
+	l1, _ := leader.NewFileLock(path)
+	l2, _ := leader.NewFileLock(path)
+	if _, err := l2.Holder(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err := l1.TryLock(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer l1.Release()
+	pid, err := l2.Holder()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if pid != os.Getpid() {
+		t.Errorf("pid = (%d); want (%d)", pid, os.Getpid())
+	}
+}
+
+func TestFileLockTryLockBadPath(t *testing.T) {
+	t.Parallel()
+	path, cleanup := lockPath(t)
+	defer cleanup()
+	l, _ := leader.NewFileLock(filepath.Join(path, "does", "not", "exist"))
+	if err := l.TryLock(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err := l.Acquire(context.Background(), time.Millisecond); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestFileLockAcquireFailover(t *testing.T) {
+	t.Parallel()
+	path, cleanup := lockPath(t)
+	defer cleanup()
+	l1, _ := leader.NewFileLock(path)
+	l2, _ := leader.NewFileLock(path)
+	if err := l1.Acquire(context.Background(), time.Millisecond); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	acquired := make(chan error)
+	go func() {
+		acquired <- l2.Acquire(context.Background(), time.Millisecond)
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquired the lock while it was held: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	l1.Release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("err = (%v); want (nil)", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("didn't take over the lock")
+	}
+	l2.Release()
+}
+
+func TestFileLockAcquireCancelled(t *testing.T) {
+	t.Parallel()
+	path, cleanup := lockPath(t)
+	defer cleanup()
+	l1, _ := leader.NewFileLock(path)
+	l2, _ := leader.NewFileLock(path)
+	if err := l1.TryLock(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer l1.Release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l2.Acquire(ctx, time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("err = (%v); want (%v)", err, context.DeadlineExceeded)
+	}
+}
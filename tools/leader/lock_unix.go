@@ -0,0 +1,26 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// +build !windows
+
+package leader
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+func lock(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrLocked
+	}
+	return errors.Wrap(err, "locking file")
+}
+
+func unlock(f *os.File) error {
+	return errors.Wrap(syscall.Flock(int(f.Fd()), syscall.LOCK_UN), "unlocking file")
+}
@@ -0,0 +1,19 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// +build windows
+
+package leader
+
+import (
+	"fmt"
+	"os"
+)
+
+// ErrNotSupported is returned when file locks are not supported on the
+// platform.
+var ErrNotSupported = fmt.Errorf("file locks are not supported on windows")
+
+func lock(*os.File) error   { return ErrNotSupported }
+func unlock(*os.File) error { return ErrNotSupported }
@@ -0,0 +1,162 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package limits fits the runtime in the resources of its container. It sets
+// the soft memory limit of the garbage collector and the GOMAXPROCS from the
+// cgroup CPU quota, and tells when the memory is close to the limit, therefore
+// the jobs can be shed before the process runs out of memory.
+package limits
+
+import (
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// AutoProcs sets the GOMAXPROCS to the CPU quota of the cgroup.
+	AutoProcs = -1
+
+	// DefaultShedRatio is the ratio of the MemoryLimit the jobs are shed at
+	// when the ShedRatio is not set.
+	DefaultShedRatio = 0.9
+
+	// CgroupRoot is where the cgroup file system is mounted.
+	CgroupRoot = "/sys/fs/cgroup"
+)
+
+var (
+	memoryLimit = expvar.NewInt("Memory Limit Bytes")
+	maxProcs    = expvar.NewInt("GOMAXPROCS")
+
+	// shedAt is the memory usage the process is overloaded at, zero disables
+	// the shedding.
+	shedAt int64
+)
+
+// Config holds the runtime limits of the process.
+type Config struct {
+	// MemoryLimit is the soft memory limit of the runtime in bytes. The
+	// garbage collector works harder as the memory gets close to it. It is not
+	// changed if it is zero.
+	MemoryLimit int64
+
+	// ShedRatio is the ratio of the MemoryLimit that the process is
+	// overloaded at. It is DefaultShedRatio if it is zero.
+	ShedRatio float64
+
+	// GOMAXPROCS is the number of the operating system threads that can run
+	// the Go code simultaneously. It is not changed if it is zero, and it is
+	// the CPU quota of the cgroup if it is AutoProcs.
+	GOMAXPROCS int
+}
+
+// Apply sets the limits of the runtime and returns the GOMAXPROCS in effect.
+// The GOMAXPROCS is not changed with AutoProcs if the cgroup does not have a
+// CPU quota. The shedding is disabled if the MemoryLimit is zero.
+func Apply(c Config) int {
+	if c.MemoryLimit > 0 {
+		debug.SetMemoryLimit(c.MemoryLimit)
+		memoryLimit.Set(c.MemoryLimit)
+	}
+	ratio := c.ShedRatio
+	if ratio <= 0 {
+		ratio = DefaultShedRatio
+	}
+	atomic.StoreInt64(&shedAt, int64(float64(c.MemoryLimit)*ratio))
+
+	procs := c.GOMAXPROCS
+	if procs == AutoProcs {
+		procs, _ = QuotaProcs(CgroupRoot)
+	}
+	if procs > 0 {
+		runtime.GOMAXPROCS(procs)
+	}
+	procs = runtime.GOMAXPROCS(0)
+	maxProcs.Set(int64(procs))
+	return procs
+}
+
+// Overloaded returns true if the memory usage has reached the ShedRatio of the
+// MemoryLimit of the last applied Config.
+func Overloaded() bool {
+	at := atomic.LoadInt64(&shedAt)
+	return at > 0 && usage() >= uint64(at)
+}
+
+// usage returns the memory that is mapped by the runtime and has not
+// been released to the operating system, which is what SetMemoryLimit limits.
+func usage() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// QuotaProcs returns the CPU quota of the cgroup mounted at the root, rounded
+// up to the next whole CPU. Both the cgroup v2 and v1 hierarchies are read.
+// It returns false if there is no quota.
+func QuotaProcs(root string) (int, bool) {
+	var quota, period float64
+	if b, err := ioutil.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		quota, _ = strconv.ParseFloat(fields[0], 64)
+		period, _ = strconv.ParseFloat(fields[1], 64)
+	} else {
+		quota = readNumber(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+		period = readNumber(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	}
+	if quota <= 0 || period <= 0 {
+		return 0, false
+	}
+	return int(math.Ceil(quota / period)), true
+}
+
+func readNumber(name string) float64 {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	return n
+}
+
+// ParseSize returns the number of bytes of a size, for example 512MB or 1GiB.
+// The units are multiples of 1024, and a number without a unit is in bytes.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+		{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1},
+	}
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, factor = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size", size)
+	}
+	return int64(n * factor), nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package limits_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/alext234/expipe/tools/limits"
+)
+
+func TestApply(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	defer limits.Apply(limits.Config{})
+
+	if got := limits.Apply(limits.Config{GOMAXPROCS: 2}); got != 2 {
+		t.Errorf("Apply() = (%d); want (2)", got)
+	}
+	if limits.Overloaded() {
+		t.Error("Overloaded() = (true); want (false) without a memory limit")
+	}
+	limits.Apply(limits.Config{MemoryLimit: 1 << 50})
+	if limits.Overloaded() {
+		t.Error("Overloaded() = (true); want (false)")
+	}
+	limits.Apply(limits.Config{MemoryLimit: 1 << 50, ShedRatio: 1e-15})
+	if !limits.Overloaded() {
+		t.Error("Overloaded() = (false); want (true)")
+	}
+}
+
+func TestQuotaProcs(t *testing.T) {
+	tcs := []struct {
+		name  string
+		files map[string]string
+		want  int
+		ok    bool
+	}{
+		{"v2", map[string]string{"cpu.max": "150000 100000\n"}, 2, true},
+		{"v2 whole", map[string]string{"cpu.max": "200000 100000\n"}, 2, true},
+		{"v2 max", map[string]string{"cpu.max": "max 100000\n"}, 0, false},
+		{"v1", map[string]string{"cpu/cpu.cfs_quota_us": "50000\n", "cpu/cpu.cfs_period_us": "100000\n"}, 1, true},
+		{"v1 unlimited", map[string]string{"cpu/cpu.cfs_quota_us": "-1\n", "cpu/cpu.cfs_period_us": "100000\n"}, 0, false},
+		{"none", nil, 0, false},
+	}
+	for _, tc := range tcs {
+		root, err := ioutil.TempDir("", "cgroup")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		for name, content := range tc.files {
+			name = filepath.Join(root, name)
+			os.MkdirAll(filepath.Dir(name), 0755)
+			if err = ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, ok := limits.QuotaProcs(root)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%s: QuotaProcs() = (%d, %t); want (%d, %t)", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tcs := []struct {
+		size string
+		want int64
+	}{
+		{"1024", 1024},
+		{"10B", 10},
+		{"2KB", 2 << 10},
+		{"512MB", 512 << 20},
+		{"512 mib", 512 << 20},
+		{"1.5GiB", 3 << 29},
+		{"1g", 1 << 30},
+	}
+	for _, tc := range tcs {
+		got, err := limits.ParseSize(tc.size)
+		if err != nil || got != tc.want {
+			t.Errorf("ParseSize(%s) = (%d, %v); want (%d, nil)", tc.size, got, err, tc.want)
+		}
+	}
+	for _, size := range []string{"", "MB", "-1MB", "ten"} {
+		if _, err := limits.ParseSize(size); err == nil {
+			t.Errorf("ParseSize(%s): err = (nil); want (error)", size)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package listener opens the listening sockets of the http servers of expipe,
+// for example the metrics and the debug servers, with TLS when it is
+// configured.
+package listener
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoCerts is returned when the client CA file has no certificates.
+var ErrNoCerts = errors.New("no certificates found in the client CA file")
+
+// TLS holds the certificate of the listeners, and the certificate authorities
+// of the clients. The clients have to present a certificate signed by one of
+// the ClientCAFile authorities if it is set.
+type TLS struct {
+	// CertFile and KeyFile are the paths to the PEM encoded certificate and
+	// private key of the listener.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is the path to a PEM encoded file of the certificate
+	// authorities of the clients.
+	ClientCAFile string
+}
+
+// Enabled returns true if the certificate is set.
+func (t TLS) Enabled() bool { return t.CertFile != "" }
+
+// Config returns the tls.Config of the listeners. It returns an error if the
+// certificate or the client authorities can not be loaded.
+func (t TLS) Config() (*tls.Config, error) {
+	if t.CertFile == "" || t.KeyFile == "" {
+		return nil, errors.New("both cert_file and key_file should be set")
+	}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading the certificate")
+	}
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if t.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading the client CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrNoCerts
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return c, nil
+}
+
+// Listen listens on the tcp addr, with TLS if t is Enabled.
+func Listen(addr string, t TLS) (net.Listener, error) {
+	if !t.Enabled() {
+		return net.Listen("tcp", addr)
+	}
+	c, err := t.Config()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", addr, c)
+}
@@ -0,0 +1,195 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package listener_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools/listener"
+)
+
+type certs struct {
+	tb         testing.TB
+	dir        string
+	serial     int64
+	ca         *x509.Certificate
+	caKey      *ecdsa.PrivateKey
+	caFile     string
+	pool       *x509.CertPool
+	certFile   string
+	keyFile    string
+	clientCert tls.Certificate
+}
+
+// newCerts writes a CA, and a server certificate for 127.0.0.1 signed by it, to
+// a temporary directory. It also creates a client certificate signed by the
+// CA.
+func newCerts(t *testing.T) *certs {
+	dir, err := ioutil.TempDir("", "listener")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c := &certs{dir: dir, tb: t}
+	c.caKey, c.ca = c.issue("ca", nil, nil)
+	c.caFile = c.write("ca.pem", "CERTIFICATE", c.ca.Raw)
+	c.pool = x509.NewCertPool()
+	c.pool.AddCert(c.ca)
+
+	key, cert := c.issue("server", c.ca, c.caKey)
+	c.certFile = c.write("server.pem", "CERTIFICATE", cert.Raw)
+	c.keyFile = c.writeKey("server.key", key)
+
+	key, cert = c.issue("client", c.ca, c.caKey)
+	c.clientCert = tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+	return c
+}
+
+func (c *certs) issue(name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		c.tb.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(c.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		c.tb.Fatalf("err = (%v); want (nil)", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		c.tb.Fatalf("err = (%v); want (nil)", err)
+	}
+	return key, cert
+}
+
+func (c *certs) write(name, typ string, der []byte) string {
+	file := path.Join(c.dir, name)
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		c.tb.Fatalf("err = (%v); want (nil)", err)
+	}
+	return file
+}
+
+func (c *certs) writeKey(name string, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		c.tb.Fatalf("err = (%v); want (nil)", err)
+	}
+	return c.write(name, "EC PRIVATE KEY", der)
+}
+
+func serve(l net.Listener) {
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go srv.Serve(l)
+}
+
+func TestListenPlain(t *testing.T) {
+	l, err := listener.Listen("127.0.0.1:0", listener.TLS{})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer l.Close()
+	serve(l)
+	resp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+}
+
+func TestListenTLS(t *testing.T) {
+	c := newCerts(t)
+	defer os.RemoveAll(c.dir)
+	tcs := []struct {
+		name       string
+		clientCA   bool
+		clientCert bool
+		wantErr    bool
+	}{
+		{"server only", false, false, false},
+		{"client cert", true, true, false},
+		{"no client cert", true, false, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := listener.TLS{CertFile: c.certFile, KeyFile: c.keyFile}
+			if tc.clientCA {
+				conf.ClientCAFile = c.caFile
+			}
+			l, err := listener.Listen("127.0.0.1:0", conf)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			defer l.Close()
+			serve(l)
+			tlsConfig := &tls.Config{RootCAs: c.pool}
+			if tc.clientCert {
+				tlsConfig.Certificates = []tls.Certificate{c.clientCert}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			resp, err := client.Get("https://" + l.Addr().String())
+			if tc.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestListenTLSErrors(t *testing.T) {
+	c := newCerts(t)
+	defer os.RemoveAll(c.dir)
+	tcs := []struct {
+		name string
+		conf listener.TLS
+	}{
+		{"no key", listener.TLS{CertFile: c.certFile}},
+		{"missing cert", listener.TLS{CertFile: path.Join(c.dir, "missing.pem"), KeyFile: c.keyFile}},
+		{"missing client ca", listener.TLS{CertFile: c.certFile, KeyFile: c.keyFile, ClientCAFile: path.Join(c.dir, "missing.pem")}},
+		{"empty client ca", listener.TLS{CertFile: c.certFile, KeyFile: c.keyFile, ClientCAFile: c.keyFile}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if l, err := listener.Listen("127.0.0.1:0", tc.conf); err == nil {
+				l.Close()
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
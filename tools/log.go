@@ -5,8 +5,13 @@
 package tools
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -37,13 +42,104 @@ const (
 	ErrorLevel = logrus.ErrorLevel
 )
 
+// Log formats.
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+var (
+	formatterMu sync.Mutex
+	// formatter is used by GetLogger. It is replaced by ConfigureLogger.
+	formatter logrus.Formatter = &logrus.TextFormatter{
+		TimestampFormat: "2006-01-02 15:04:05",
+		FullTimestamp:   true,
+	}
+)
+
+// LogConfig holds the format and the destination of the logs.
+type LogConfig struct {
+	// Format is either TextFormat or JSONFormat. TextFormat is used if it is
+	// empty.
+	Format string
+
+	// File is the path of the log file. The logs are written to stderr if it
+	// is empty.
+	File string
+
+	// MaxSize is the size in bytes that the File is rotated at. The File is
+	// not rotated if it is zero.
+	MaxSize int64
+
+	// MaxBackups is the number of the rotated files that are kept.
+	// DefaultMaxBackups is used if it is zero.
+	MaxBackups int
+}
+
+// UnknownLogFormatError is returned when the format of the logs is not
+// supported.
+type UnknownLogFormatError string
+
+func (u UnknownLogFormatError) Error() string {
+	return fmt.Sprintf("unknown log format: %s", string(u))
+}
+
+// Validate returns an UnknownLogFormatError if the format is not supported.
+// The File is not opened.
+func (c LogConfig) Validate() error {
+	switch strings.ToLower(c.Format) {
+	case "", TextFormat, JSONFormat:
+		return nil
+	}
+	return UnknownLogFormatError(c.Format)
+}
+
+// ConfigureLogger sets the format and the destination of the default logger.
+// The JSON format uses the @timestamp key, therefore the logs can be shipped
+// to Elasticsearch as they are. The returned io.Closer closes the log file, it
+// is a no-op if the logs are written to stderr.
+func ConfigureLogger(c LogConfig) (io.Closer, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var f logrus.Formatter = &logrus.TextFormatter{
+		TimestampFormat: "2006-01-02 15:04:05",
+		FullTimestamp:   true,
+	}
+	if strings.ToLower(c.Format) == JSONFormat {
+		f = &logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339Nano,
+			FieldMap: logrus.FieldMap{
+				logrus.FieldKeyTime: "@timestamp",
+			},
+		}
+	}
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if c.File != "" {
+		rf, err := NewRotatingFile(c.File, c.MaxSize, c.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = rf
+	}
+	formatterMu.Lock()
+	formatter = f
+	formatterMu.Unlock()
+	logrus.SetFormatter(f)
+	logrus.SetOutput(out)
+	return out, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
 // GetLogger returns the default logger with the given log level.
 func GetLogger(level string) *Logger {
 	logrus.SetLevel(logrus.ErrorLevel)
-	customFormatter := new(logrus.TextFormatter)
-	customFormatter.TimestampFormat = "2006-01-02 15:04:05"
-	logrus.SetFormatter(customFormatter)
-	customFormatter.FullTimestamp = true
+	formatterMu.Lock()
+	logrus.SetFormatter(formatter)
+	formatterMu.Unlock()
 	switch strings.ToLower(level) {
 	case "debug":
 		logrus.SetLevel(logrus.DebugLevel)
@@ -5,8 +5,11 @@
 package tools
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 )
 
@@ -49,3 +52,50 @@ func TestGetDiscardLogger(t *testing.T) {
 		t.Errorf("want (ioutil.Discard), got (%v)", logger.Out)
 	}
 }
+
+func TestConfigureLogger(t *testing.T) {
+	defer ConfigureLogger(LogConfig{})
+	dir, err := ioutil.TempDir("", "expipe_log")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "expipe.log")
+
+	closer, err := ConfigureLogger(LogConfig{Format: "JSON", File: file})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	logger := GetLogger("info")
+	logger.WithField("reader", "red1").Info("hello")
+	closer.Close()
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var entry map[string]interface{}
+	if err = json.Unmarshal(content, &entry); err != nil {
+		t.Fatalf("err = (%v); want (nil): %s", err, content)
+	}
+	for _, key := range []string{"@timestamp", "msg", "level", "reader"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("%s is missing from (%s)", key, content)
+		}
+	}
+}
+
+func TestConfigureLoggerErrors(t *testing.T) {
+	t.Parallel()
+	_, err := ConfigureLogger(LogConfig{Format: "xml"})
+	if _, ok := err.(UnknownLogFormatError); !ok {
+		t.Errorf("err = (%v); want (UnknownLogFormatError)", err)
+	}
+	_, err = ConfigureLogger(LogConfig{File: "/does/not/exist/expipe.log"})
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err = (LogConfig{Format: "JSON", File: "/does/not/exist/expipe.log"}).Validate(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
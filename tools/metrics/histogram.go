@@ -0,0 +1,212 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// DurationBuckets are the upper bounds of the buckets for durations in
+	// seconds.
+	DurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// SizeBuckets are the upper bounds of the buckets for sizes in bytes, from
+	// 256B to 4MB.
+	SizeBuckets = []float64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20}
+
+	// CountBuckets are the upper bounds of the buckets for the number of
+	// items, for example the documents of a batch.
+	CountBuckets = []float64{1, 5, 10, 50, 100, 500, 1000, 5000}
+
+	// Percentiles are the quantiles of the Histograms of the PercentileVecs.
+	Percentiles = []float64{.5, .9, .99}
+)
+
+// Histogram counts the observations in buckets. It implements the expvar.Var
+// interface.
+type Histogram struct {
+	mu        sync.Mutex
+	bounds    []float64
+	buckets   []int64 // not cumulative, the last one is +Inf.
+	count     int64
+	sum       float64
+	quantiles bool // the expvar value has the Percentiles instead of the buckets.
+}
+
+// NewHistogram returns a Histogram with the upper bounds of the buckets. The
+// bounds are sorted.
+func NewHistogram(bounds []float64) *Histogram {
+	b := make([]float64, len(bounds))
+	copy(b, bounds)
+	sort.Float64s(b)
+	return &Histogram{
+		bounds:  b,
+		buckets: make([]int64, len(b)+1),
+	}
+}
+
+// Observe adds v to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buckets[i]++
+	h.count++
+	h.sum += v
+}
+
+// ObserveDuration adds d in seconds to the histogram.
+func (h *Histogram) ObserveDuration(d time.Duration) { h.Observe(d.Seconds()) }
+
+// Values returns the cumulative counts of the buckets, the last one is the
+// count of all observations, and the sum of the observations.
+func (h *Histogram) Values() (cumulative []int64, sum float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cumulative = make([]int64, len(h.buckets))
+	var c int64
+	for i, n := range h.buckets {
+		c += n
+		cumulative[i] = c
+	}
+	return cumulative, h.sum
+}
+
+// Quantile returns the estimated value of the q quantile of the observations,
+// for example 0.99 for the 99th percentile. The value is interpolated linearly
+// in its bucket, and it is the largest bound if it falls in the last bucket.
+// It returns zero if there are no observations.
+func (h *Histogram) Quantile(q float64) float64 {
+	cumulative, _ := h.Values()
+	return quantile(h.bounds, cumulative, q)
+}
+
+func quantile(bounds []float64, cumulative []int64, q float64) float64 {
+	count := cumulative[len(cumulative)-1]
+	if count == 0 || len(bounds) == 0 {
+		return 0
+	}
+	rank := q * float64(count)
+	i := sort.Search(len(cumulative), func(i int) bool { return float64(cumulative[i]) >= rank })
+	if i >= len(bounds) {
+		return bounds[len(bounds)-1]
+	}
+	var lower float64
+	var below int64
+	if i > 0 {
+		lower, below = bounds[i-1], cumulative[i-1]
+	}
+	return lower + (bounds[i]-lower)*(rank-float64(below))/float64(cumulative[i]-below)
+}
+
+func (h *Histogram) write(buf *bytes.Buffer, name, label string) {
+	cumulative, sum := h.Values()
+	for i, c := range cumulative {
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = formatFloat(h.bounds[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", name, labels(label, fmt.Sprintf("le=%q", le)), c)
+	}
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, labels(label), formatFloat(sum))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, labels(label), cumulative[len(cumulative)-1])
+}
+
+// String returns the count, the sum and the buckets of the histogram in JSON.
+// The Histograms of the PercentileVecs have the Percentiles instead of the
+// buckets, in the shape of the summaries.
+func (h *Histogram) String() string {
+	cumulative, sum := h.Values()
+	buf := new(bytes.Buffer)
+	if h.quantiles {
+		fmt.Fprintf(buf, `{"count": %d, "sum": %s, "quantiles": {`, cumulative[len(cumulative)-1], formatFloat(sum))
+		for i, q := range Percentiles {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprintf(buf, `"%s": %s`, formatFloat(q), formatFloat(quantile(h.bounds, cumulative, q)))
+		}
+		buf.WriteString("}}")
+		return buf.String()
+	}
+	fmt.Fprintf(buf, `{"count": %d, "sum": %s, "buckets": {`, cumulative[len(cumulative)-1], formatFloat(sum))
+	for i, b := range h.bounds {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, `"%s": %d`, formatFloat(b), cumulative[i])
+	}
+	buf.WriteString("}}")
+	return buf.String()
+}
+
+// HistogramVec is a published expvar.Map of Histograms, one for each name.
+type HistogramVec struct {
+	mu        sync.Mutex
+	m         *expvar.Map
+	bounds    []float64
+	quantiles bool
+}
+
+// NewHistogramVec publishes a HistogramVec with the name. All Histograms have
+// the same bounds.
+func NewHistogramVec(name string, bounds []float64) *HistogramVec {
+	return &HistogramVec{
+		m:      expvar.NewMap(name),
+		bounds: bounds,
+	}
+}
+
+// NewPercentileVec publishes a HistogramVec with the name, whose Histograms
+// show the estimated Percentiles in their expvar values, therefore the self
+// reader records them as summaries. They are exported as histograms in the
+// Prometheus format.
+func NewPercentileVec(name string, bounds []float64) *HistogramVec {
+	v := NewHistogramVec(name, bounds)
+	v.quantiles = true
+	return v
+}
+
+// With returns the Histogram of the name. It is created on the first call.
+func (v *HistogramVec) With(name string) *Histogram {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok := v.m.Get(name).(*Histogram); ok {
+		return h
+	}
+	h := NewHistogram(v.bounds)
+	h.quantiles = v.quantiles
+	v.m.Set(name, h)
+	return h
+}
+
+// GaugeVec is a published expvar.Map of gauges, one for each name.
+type GaugeVec struct {
+	mu sync.Mutex
+	m  *expvar.Map
+}
+
+// NewGaugeVec publishes a GaugeVec with the name.
+func NewGaugeVec(name string) *GaugeVec {
+	return &GaugeVec{m: expvar.NewMap(name)}
+}
+
+// Set sets the gauge of the name to value.
+func (v *GaugeVec) Set(name string, value int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	g, ok := v.m.Get(name).(*expvar.Int)
+	if !ok {
+		g = new(expvar.Int)
+		v.m.Set(name, g)
+	}
+	g.Set(value)
+}
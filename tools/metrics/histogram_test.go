@@ -0,0 +1,128 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"bytes"
+	"expvar"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alext234/expipe/tools/metrics"
+)
+
+func TestHistogram(t *testing.T) {
+	t.Parallel()
+	h := metrics.NewHistogram([]float64{10, 1, 5})
+	for _, v := range []float64{0.5, 1, 3, 7, 100} {
+		h.Observe(v)
+	}
+	cumulative, sum := h.Values()
+	if want := []int64{2, 3, 4, 5}; !reflect.DeepEqual(cumulative, want) {
+		t.Errorf("cumulative = (%v); want (%v)", cumulative, want)
+	}
+	if sum != 111.5 {
+		t.Errorf("sum = (%v); want (111.5)", sum)
+	}
+	want := `{"count": 5, "sum": 111.5, "buckets": {"1": 2, "5": 3, "10": 4}}`
+	if h.String() != want {
+		t.Errorf("String() = (%s); want (%s)", h.String(), want)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	t.Parallel()
+	h := metrics.NewHistogram([]float64{1, 5, 10})
+	if got := h.Quantile(.5); got != 0 {
+		t.Errorf("Quantile(.5) = (%v); want (0)", got)
+	}
+	for _, v := range []float64{0.5, 1, 3, 7, 100} {
+		h.Observe(v)
+	}
+	tcs := []struct {
+		q, want float64
+	}{
+		{.2, 0.5},
+		{.5, 3},
+		{.7, 7.5},
+		{.9, 10},
+		{.99, 10},
+	}
+	for _, tc := range tcs {
+		if got := h.Quantile(tc.q); got != tc.want {
+			t.Errorf("Quantile(%v) = (%v); want (%v)", tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestPercentileVec(t *testing.T) {
+	t.Parallel()
+	v := metrics.NewPercentileVec("Test Flush Duration", []float64{1, 5, 10})
+	for _, d := range []float64{0.5, 1, 3, 7, 100} {
+		v.With("rec1").Observe(d)
+	}
+	want := `{"count": 5, "sum": 111.5, "quantiles": {"0.5": 3, "0.9": 10, "0.99": 10}}`
+	if got := v.With("rec1").String(); got != want {
+		t.Errorf("String() = (%s); want (%s)", got, want)
+	}
+	buf := new(bytes.Buffer)
+	metrics.WriteTo(buf)
+	for _, want := range []string{
+		"# TYPE expipe_test_flush_duration histogram\n",
+		`expipe_test_flush_duration_bucket{name="rec1",le="5"} 3` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected (%s) in the output", want)
+		}
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	t.Parallel()
+	v := metrics.NewHistogramVec("Test Read Duration", []float64{1})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.With("reader1").Observe(0.5)
+		}()
+	}
+	wg.Wait()
+	v.With("reader2").Observe(2)
+	if v.With("reader1") != v.With("reader1") {
+		t.Error("With() returned different histograms for the same name")
+	}
+
+	buf := new(bytes.Buffer)
+	metrics.WriteTo(buf)
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE expipe_test_read_duration histogram\n",
+		`expipe_test_read_duration_bucket{name="reader1",le="1"} 10` + "\n",
+		`expipe_test_read_duration_bucket{name="reader1",le="+Inf"} 10` + "\n",
+		`expipe_test_read_duration_sum{name="reader1"} 5` + "\n",
+		`expipe_test_read_duration_count{name="reader1"} 10` + "\n",
+		`expipe_test_read_duration_bucket{name="reader2",le="1"} 0` + "\n",
+		`expipe_test_read_duration_bucket{name="reader2",le="+Inf"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want (%s) in:\n%s", want, out)
+		}
+	}
+}
+
+func TestGaugeVec(t *testing.T) {
+	t.Parallel()
+	v := metrics.NewGaugeVec("Test Last Success")
+	v.Set("reader1", 10)
+	v.Set("reader1", 20)
+	m := expvar.Get("Test Last Success").(*expvar.Map)
+	if got := m.Get("reader1").String(); got != "20" {
+		t.Errorf("reader1 = (%s); want (20)", got)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package metrics exposes the expvar variables in the Prometheus text format.
+// Each variable is exported with its name converted to snake case and
+// prefixed with "expipe_", for example "Read Jobs" becomes expipe_read_jobs.
+//
+// Numeric variables are exported as untyped metrics. The values of an
+// expvar.Map are exported as one metric with the key in the "name" label, for
+// example the HistogramVec and GaugeVec for labelling the metrics by the names
+// of the readers and recorders. Summaries and Histograms are exported in their
+// Prometheus types. The variables that are not numeric, like memstats, are
+// skipped.
+package metrics
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Prefix is prepended to the names of all metrics.
+const Prefix = "expipe_"
+
+// Summary records the count and the sum of observations, for example the
+// durations of an operation. It implements the expvar.Var interface.
+type Summary struct {
+	mu    sync.Mutex
+	count int64
+	sum   float64
+}
+
+// NewSummary creates a Summary and publishes it with the name.
+func NewSummary(name string) *Summary {
+	s := new(Summary)
+	expvar.Publish(name, s)
+	return s
+}
+
+// Observe adds v to the summary.
+func (s *Summary) Observe(v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.sum += v
+}
+
+// ObserveDuration adds d in seconds to the summary.
+func (s *Summary) ObserveDuration(d time.Duration) { s.Observe(d.Seconds()) }
+
+// Values returns the count and the sum of the observations.
+func (s *Summary) Values() (count int64, sum float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count, s.sum
+}
+
+func (s *Summary) write(buf *bytes.Buffer, name, label string) {
+	count, sum := s.Values()
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, labels(label), formatFloat(sum))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, labels(label), count)
+}
+
+func (s *Summary) String() string {
+	count, sum := s.Values()
+	return fmt.Sprintf(`{"count": %d, "sum": %s}`, count, formatFloat(sum))
+}
+
+// Handler returns an http.Handler that writes all expvar variables in the
+// Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+// WriteTo writes all expvar variables to w in the Prometheus text format. The
+// metrics are sorted by their names.
+func WriteTo(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	expvar.Do(func(kv expvar.KeyValue) {
+		writeVar(buf, Name(kv.Key), kv.Value)
+	})
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeVar(buf *bytes.Buffer, name string, v expvar.Var) {
+	switch v := v.(type) {
+	case *expvar.Int, *expvar.Float:
+		fmt.Fprintf(buf, "# TYPE %s untyped\n%s %s\n", name, name, v.String())
+	case *Summary:
+		fmt.Fprintf(buf, "# TYPE %s summary\n", name)
+		v.write(buf, name, "")
+	case *Histogram:
+		fmt.Fprintf(buf, "# TYPE %s histogram\n", name)
+		v.write(buf, name, "")
+	case *expvar.Map:
+		writeMap(buf, name, v)
+	}
+}
+
+// writeMap writes the values of the map with their keys as the name label. The
+// type of the metric is decided by the first value of the map.
+func writeMap(buf *bytes.Buffer, name string, m *expvar.Map) {
+	var typ string
+	m.Do(func(kv expvar.KeyValue) {
+		label := fmt.Sprintf("name=%q", kv.Key)
+		switch v := kv.Value.(type) {
+		case *expvar.Int, *expvar.Float:
+			if typ == "" {
+				typ = "untyped"
+				fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+			}
+			if typ == "untyped" {
+				fmt.Fprintf(buf, "%s{%s} %s\n", name, label, v.String())
+			}
+		case *Summary:
+			if typ == "" {
+				typ = "summary"
+				fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+			}
+			if typ == "summary" {
+				v.write(buf, name, label)
+			}
+		case *Histogram:
+			if typ == "" {
+				typ = "histogram"
+				fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+			}
+			if typ == "histogram" {
+				v.write(buf, name, label)
+			}
+		}
+	})
+}
+
+// labels joins the label pairs in the Prometheus format.
+func labels(pairs ...string) string {
+	var ls []string
+	for _, p := range pairs {
+		if p != "" {
+			ls = append(ls, p)
+		}
+	}
+	if len(ls) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(ls, ",") + "}"
+}
+
+// Name converts an expvar name to a Prometheus metric name.
+func Name(key string) string {
+	var (
+		b    bytes.Buffer
+		prev rune // previous rune of the key
+		last rune // last rune written
+	)
+	b.WriteString(Prefix)
+	for _, r := range key {
+		out := r
+		switch {
+		case unicode.IsUpper(r):
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+				b.WriteByte('_')
+				last = '_'
+			}
+			out = unicode.ToLower(r)
+		case unicode.IsLower(r) || unicode.IsDigit(r):
+		default:
+			out = '_'
+		}
+		prev = r
+		if out == '_' && last == '_' {
+			continue
+		}
+		b.WriteRune(out)
+		last = out
+	}
+	return strings.TrimRight(b.String(), "_")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
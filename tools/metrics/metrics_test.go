@@ -0,0 +1,97 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"bytes"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools/metrics"
+)
+
+func TestName(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		key  string
+		want string
+	}{
+		{"Read Jobs", "expipe_read_jobs"},
+		{"ElasticSearch Records", "expipe_elastic_search_records"},
+		{"Number Of Goroutines", "expipe_number_of_goroutines"},
+		{"memstats", "expipe_memstats"},
+		{"Flush Duration (s)", "expipe_flush_duration_s"},
+		{"a--b", "expipe_a_b"},
+	}
+	for _, tc := range tcs {
+		if got := metrics.Name(tc.key); got != tc.want {
+			t.Errorf("Name(%q) = (%s); want (%s)", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	t.Parallel()
+	s := new(metrics.Summary)
+	s.Observe(1.5)
+	s.ObserveDuration(500 * time.Millisecond)
+	count, sum := s.Values()
+	if count != 2 {
+		t.Errorf("count = (%d); want (2)", count)
+	}
+	if sum != 2 {
+		t.Errorf("sum = (%v); want (2)", sum)
+	}
+	if s.String() != `{"count": 2, "sum": 2}` {
+		t.Errorf("String() = (%s); want ({\"count\": 2, \"sum\": 2})", s.String())
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	t.Parallel()
+	expvar.NewInt("Test Counter").Set(42)
+	expvar.NewFloat("Test Float").Set(1.5)
+	m := expvar.NewMap("Test Errors")
+	m.Add("reader1", 3)
+	m.Add("reader2", 1)
+	metrics.NewSummary("Test Latency").Observe(0.25)
+	expvar.NewString("Test String").Set("skipped")
+
+	buf := new(bytes.Buffer)
+	if err := metrics.WriteTo(buf); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE expipe_test_counter untyped\nexpipe_test_counter 42\n",
+		"expipe_test_float 1.5\n",
+		"# TYPE expipe_test_errors untyped\n" +
+			`expipe_test_errors{name="reader1"} 3` + "\n" +
+			`expipe_test_errors{name="reader2"} 1` + "\n",
+		"# TYPE expipe_test_latency summary\nexpipe_test_latency_sum 0.25\nexpipe_test_latency_count 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want (%s) in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "expipe_test_string") {
+		t.Error("string variables should be skipped")
+	}
+	if strings.Contains(out, "expipe_memstats") {
+		t.Error("memstats should be skipped")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = (%s); want (text/plain)", ct)
+	}
+}
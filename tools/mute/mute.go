@@ -0,0 +1,174 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package mute holds the maintenance windows of the readers and the routes,
+// during which the readers are not read or the routes are not recorded. The
+// windows repeat daily or on some days of the week, for example for the
+// targets that are restarted every night:
+//
+//	02:00-03:00 UTC daily
+//	22:30-01:00 Europe/London weekdays
+//	00:00-06:00 UTC sat,sun
+//
+// The time zone is the local time zone if it is not set, and the days are
+// daily if they are not set. A window that ends before it starts goes past
+// midnight, and its days are the days it starts.
+package mute
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window is a period of the day on some days of the week. Start and End are
+// the times of the day from midnight.
+type Window struct {
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+	Days     [7]bool // indexed by time.Weekday.
+	spec     string
+}
+
+// Schedule is a list of Windows. It is active when any of them are.
+type Schedule []*Window
+
+// Parse returns the Window of the spec. It returns an error if the times, the
+// time zone or the days are invalid.
+func Parse(spec string) (*Window, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 || len(fields) > 3 {
+		return nil, fmt.Errorf("invalid maintenance window %q, should be HH:MM-HH:MM [time zone] [days]", spec)
+	}
+	w := &Window{Location: time.Local, spec: strings.Join(fields, " ")}
+	times := strings.Split(fields[0], "-")
+	if len(times) != 2 {
+		return nil, fmt.Errorf("invalid maintenance window %q, should be HH:MM-HH:MM [time zone] [days]", spec)
+	}
+	var err error
+	if w.Start, err = clock(times[0]); err != nil || w.Start == day {
+		return nil, fmt.Errorf("invalid start of maintenance window %q", spec)
+	}
+	if w.End, err = clock(times[1]); err != nil {
+		return nil, fmt.Errorf("invalid end of maintenance window %q", spec)
+	}
+	if w.Start == w.End {
+		return nil, fmt.Errorf("empty maintenance window %q", spec)
+	}
+	rest := fields[1:]
+	if len(rest) > 0 {
+		if days, ok := parseDays(rest[len(rest)-1]); ok {
+			w.Days = days
+			rest = rest[:len(rest)-1]
+		}
+	}
+	if w.Days == [7]bool{} {
+		w.Days = [7]bool{true, true, true, true, true, true, true}
+	}
+	switch len(rest) {
+	case 0:
+	case 1:
+		if w.Location, err = time.LoadLocation(rest[0]); err != nil {
+			return nil, fmt.Errorf("invalid time zone of maintenance window %q: %v", spec, err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid days of maintenance window %q", spec)
+	}
+	return w, nil
+}
+
+// ParseSchedule returns the Schedule of the specs.
+func ParseSchedule(specs ...string) (Schedule, error) {
+	s := make(Schedule, 0, len(specs))
+	for _, spec := range specs {
+		w, err := Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, w)
+	}
+	return s, nil
+}
+
+// Active returns true if the t is in the window. The window is in the wall
+// clock time of its location, therefore it is not shifted on the days the
+// daylight saving time starts or ends.
+func (w *Window) Active(t time.Time) bool {
+	t = t.In(w.Location)
+	h, m, s := t.Clock()
+	now := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(t.Nanosecond())
+	if w.Start < w.End {
+		return w.Days[t.Weekday()] && now >= w.Start && now < w.End
+	}
+	// the window goes past midnight.
+	if now >= w.Start {
+		return w.Days[t.Weekday()]
+	}
+	return now < w.End && w.Days[(t.Weekday()+6)%7]
+}
+
+func (w *Window) String() string { return w.spec }
+
+// Active returns true if the t is in any of the windows of the s.
+func (s Schedule) Active(t time.Time) bool {
+	for _, w := range s {
+		if w.Active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// clock returns the time of the day of HH:MM. The 24:00 is the end of the day.
+func clock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, err
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || h == 24 && m != 0 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// parseDays returns the days of daily, weekdays, weekends or a comma separated
+// list of the days, for example mon,wed,fri. It returns false if the s is not
+// one of them.
+func parseDays(s string) ([7]bool, bool) {
+	var days [7]bool
+	switch strings.ToLower(s) {
+	case "daily":
+		return [7]bool{true, true, true, true, true, true, true}, true
+	case "weekdays":
+		return [7]bool{false, true, true, true, true, true, false}, true
+	case "weekends":
+		return [7]bool{true, false, false, false, false, false, true}, true
+	}
+	for _, name := range strings.Split(s, ",") {
+		d, ok := weekdays[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return days, false
+		}
+		days[d] = true
+	}
+	return days, true
+}
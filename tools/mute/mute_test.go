@@ -0,0 +1,131 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package mute_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools/mute"
+)
+
+func TestParse(t *testing.T) {
+	tcs := []struct {
+		spec       string
+		start, end time.Duration
+		zone       string
+	}{
+		{"02:00-03:00 UTC daily", 2 * time.Hour, 3 * time.Hour, "UTC"},
+		{"  22:30-01:00   Europe/London weekdays", 22*time.Hour + 30*time.Minute, time.Hour, "Europe/London"},
+		{"00:00-24:00 UTC sat,SUN", 0, 24 * time.Hour, "UTC"},
+		{"12:00-13:00", 12 * time.Hour, 13 * time.Hour, "Local"},
+		{"12:00-13:00 mon", 12 * time.Hour, 13 * time.Hour, "Local"},
+	}
+	for _, tc := range tcs {
+		w, err := mute.Parse(tc.spec)
+		if err != nil {
+			t.Errorf("%q: err = (%v); want (nil)", tc.spec, err)
+			continue
+		}
+		if w.Start != tc.start || w.End != tc.end || w.Location.String() != tc.zone {
+			t.Errorf("%q: Parse() = (%s, %s, %s); want (%s, %s, %s)", tc.spec, w.Start, w.End, w.Location, tc.start, tc.end, tc.zone)
+		}
+	}
+	for _, spec := range []string{
+		"", "02:00", "02:00-03:00-04:00", "2-3", "02:00-02:00", "24:00-01:00",
+		"02:60-03:00", "02:00-25:00", "02:00-03:0", "02:00-03:00 Mars/Olympus",
+		"02:00-03:00 UTC daily extra", "02:00-03:00 UTC mon,funday",
+	} {
+		if _, err := mute.Parse(spec); err == nil {
+			t.Errorf("%q: err = (nil); want (error)", spec)
+		}
+	}
+}
+
+func TestActive(t *testing.T) {
+	// 2017-01-02 is a Monday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2017, 1, day, hour, min, 0, 0, time.UTC)
+	}
+	tcs := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"02:00-03:00 UTC", at(2, 2, 0), true},
+		{"02:00-03:00 UTC", at(2, 2, 59), true},
+		{"02:00-03:00 UTC", at(2, 3, 0), false},
+		{"02:00-03:00 UTC", at(2, 1, 59), false},
+		{"02:00-03:00 Asia/Tokyo", at(1, 17, 30), true},
+		{"22:00-02:00 UTC", at(2, 23, 0), true},
+		{"22:00-02:00 UTC", at(2, 1, 0), true},
+		{"22:00-02:00 UTC", at(2, 2, 0), false},
+		{"22:00-02:00 UTC weekdays", at(6, 23, 0), true},  // friday night.
+		{"22:00-02:00 UTC weekdays", at(7, 1, 0), true},   // after friday night.
+		{"22:00-02:00 UTC weekdays", at(2, 1, 0), false},  // after sunday night.
+		{"22:00-02:00 UTC weekdays", at(7, 23, 0), false}, // saturday night.
+		{"00:00-24:00 UTC sat,sun", at(8, 12, 0), true},
+		{"00:00-24:00 UTC sat,sun", at(9, 0, 0), false},
+		{"00:00-24:00 UTC weekends", at(1, 23, 59), true},
+	}
+	for _, tc := range tcs {
+		w, err := mute.Parse(tc.spec)
+		if err != nil {
+			t.Fatalf("%q: err = (%v); want (nil)", tc.spec, err)
+		}
+		if got := w.Active(tc.t); got != tc.want {
+			t.Errorf("%q: Active(%s) = (%t); want (%t)", tc.spec, tc.t.Format(time.RFC1123), got, tc.want)
+		}
+	}
+}
+
+func TestActiveDST(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	w, err := mute.Parse("14:00-15:00 Europe/London")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	// The clocks go forward on 2017-03-26 and back on 2017-10-29 at 01:00 UTC.
+	tcs := []struct {
+		t    time.Time
+		want bool
+	}{
+		{time.Date(2017, 3, 26, 14, 30, 0, 0, london), true},
+		{time.Date(2017, 3, 26, 13, 30, 0, 0, london), false},
+		{time.Date(2017, 3, 26, 15, 0, 0, 0, london), false},
+		{time.Date(2017, 10, 29, 14, 30, 0, 0, london), true},
+		{time.Date(2017, 10, 29, 15, 30, 0, 0, london), false},
+	}
+	for _, tc := range tcs {
+		if got := w.Active(tc.t); got != tc.want {
+			t.Errorf("Active(%s) = (%t); want (%t)", tc.t.Format(time.RFC1123), got, tc.want)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s, err := mute.ParseSchedule("02:00-03:00 UTC", "14:00-15:00 UTC")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	noon := time.Date(2017, 1, 2, 12, 0, 0, 0, time.UTC)
+	for hour, want := range map[time.Duration]bool{2: true, 12: false, 14: true} {
+		if got := s.Active(noon.Add((hour - 12) * time.Hour)); got != want {
+			t.Errorf("%d: Active() = (%t); want (%t)", hour, got, want)
+		}
+	}
+	if s[1].String() != "14:00-15:00 UTC" {
+		t.Errorf("String() = (%s); want (14:00-15:00 UTC)", s[1])
+	}
+	if _, err = mute.ParseSchedule("02:00-03:00 UTC", "nope"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if mute.Schedule(nil).Active(noon) {
+		t.Error("Active() = (true) for an empty schedule; want (false)")
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package pinger checks the availability of the endpoints of the readers and
+// recorders. The health of each endpoint is exported as an expvar gauge in the
+// "Endpoint Health" map, 1 means the last check was successful. The gauges are
+// keyed by the name of the reader or recorder, see WithName, therefore two of
+// them on the same endpoint do not share a gauge.
+//
+// An endpoint is healthy if it responds, the status code of the response is
+// not checked.
+package pinger
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alext234/expipe/tools/httpclient"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// DefaultTimeout is used when the timeout is not set.
+const DefaultTimeout = 5 * time.Second
+
+var health = expvar.NewMap("Endpoint Health")
+
+var (
+	// ErrEmptyEndpoint is returned when the endpoint is empty.
+	ErrEmptyEndpoint = fmt.Errorf("endpoint cannot be empty")
+
+	// ErrNilClient is returned when the http client is nil.
+	ErrNilClient = fmt.Errorf("nil http client")
+)
+
+// InvalidMethodError is returned when the ping method is not supported.
+type InvalidMethodError string
+
+func (e InvalidMethodError) Error() string {
+	return fmt.Sprintf("invalid ping method: %s", string(e))
+}
+
+// Pinger pings an endpoint and tracks its health. If the interval is set, it
+// keeps checking the endpoint in the background after the first successful
+// Ping, until Stop is called. It is concurrent safe.
+type Pinger struct {
+	name     string
+	url      string
+	method   string
+	client   *http.Client
+	timeout  time.Duration
+	interval time.Duration
+	gauge    *expvar.Int
+
+	mu      sync.RWMutex
+	healthy bool
+	once    sync.Once     // starts the watch.
+	done    chan struct{} // closed when the watch returns.
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// New returns a Pinger that sends HEAD requests to the endpoint with the
+// shared http client of the httpclient package.
+func New(endpoint string, options ...func(*Pinger) error) (*Pinger, error) {
+	if endpoint == "" {
+		return nil, ErrEmptyEndpoint
+	}
+	p := &Pinger{
+		url:    endpoint,
+		method: http.MethodHead,
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	for _, op := range options {
+		if err := op(p); err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if p.client == nil {
+		p.client = httpclient.Default()
+	}
+	if p.timeout <= 0 {
+		p.timeout = DefaultTimeout
+	}
+	if p.name == "" {
+		p.name = p.url
+	}
+	p.gauge = new(expvar.Int)
+	health.Set(p.name, p.gauge)
+	return p, nil
+}
+
+// WithMethod sets the method of the requests. It can be HEAD or GET.
+func WithMethod(method string) func(*Pinger) error {
+	return func(p *Pinger) error {
+		method = strings.ToUpper(method)
+		if method != http.MethodHead && method != http.MethodGet {
+			return InvalidMethodError(method)
+		}
+		p.method = method
+		return nil
+	}
+}
+
+// WithName sets the key of the health gauge. The URL of the endpoint is used
+// if the name is empty.
+func WithName(name string) func(*Pinger) error {
+	return func(p *Pinger) error {
+		p.name = name
+		return nil
+	}
+}
+
+// WithPath pings the path on the endpoint instead of the endpoint itself.
+func WithPath(path string) func(*Pinger) error {
+	return func(p *Pinger) error {
+		if path == "" {
+			return nil
+		}
+		p.url = strings.TrimRight(p.url, "/") + "/" + strings.TrimLeft(path, "/")
+		return nil
+	}
+}
+
+// WithClient sets the http client.
+func WithClient(client *http.Client) func(*Pinger) error {
+	return func(p *Pinger) error {
+		if client == nil {
+			return ErrNilClient
+		}
+		p.client = client
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of each ping.
+func WithTimeout(timeout time.Duration) func(*Pinger) error {
+	return func(p *Pinger) error {
+		p.timeout = timeout
+		return nil
+	}
+}
+
+// WithInterval sets the interval of the background health checks. They are
+// disabled when the interval is zero.
+func WithInterval(interval time.Duration) func(*Pinger) error {
+	return func(p *Pinger) error {
+		p.interval = interval
+		return nil
+	}
+}
+
+// Ping sends a request to the endpoint and returns an error if it doesn't
+// respond.
+func (p *Pinger) Ping() error {
+	err := p.check(context.Background())
+	if err == nil && p.interval > 0 {
+		p.once.Do(func() {
+			p.done = make(chan struct{})
+			go p.watch()
+		})
+	}
+	return err
+}
+
+func (p *Pinger) check(parent context.Context) error {
+	ctx, cancel := context.WithTimeout(parent, p.timeout)
+	defer cancel()
+	req, err := http.NewRequest(p.method, p.url, nil)
+	if err != nil {
+		p.Report(err)
+		return err
+	}
+	resp, err := ctxhttp.Do(ctx, p.client, req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if parent.Err() != nil {
+		// Stopped, the health is not known.
+		return err
+	}
+	p.Report(err)
+	return err
+}
+
+func (p *Pinger) watch() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.check(p.ctx)
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// Report updates the health of the endpoint with the outcome of a request
+// that was sent to it outside of the Pinger, a nil err means it is healthy.
+func (p *Pinger) Report(err error) {
+	p.mu.Lock()
+	p.healthy = err == nil
+	p.mu.Unlock()
+	if err == nil {
+		p.gauge.Set(1)
+		return
+	}
+	p.gauge.Set(0)
+}
+
+// Healthy returns true if the last check was successful.
+func (p *Pinger) Healthy() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.healthy
+}
+
+// Name returns the key of the health gauge.
+func (p *Pinger) Name() string { return p.name }
+
+// URL returns the address that is pinged.
+func (p *Pinger) URL() string { return p.url }
+
+// Stop stops the background health checks, the running check is cancelled and
+// Stop waits until it returns. It is safe to call it more than once.
+func (p *Pinger) Stop() {
+	p.cancel()
+	p.once.Do(func() {}) // no watch after Stop.
+	if p.done != nil {
+		<-p.done
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package pinger_test
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools/pinger"
+	"github.com/pkg/errors"
+)
+
+func gauge(t *testing.T, name string) string {
+	m := expvar.Get("Endpoint Health").(*expvar.Map)
+	v := m.Get(name)
+	if v == nil {
+		t.Fatalf("no health gauge for (%s)", name)
+	}
+	return v.String()
+}
+
+func TestNewErrors(t *testing.T) {
+	t.Parallel()
+	_, err := pinger.New("")
+	if err != pinger.ErrEmptyEndpoint {
+		t.Errorf("err = (%v); want (ErrEmptyEndpoint)", err)
+	}
+	_, err = pinger.New("http://localhost", pinger.WithMethod("POST"))
+	if _, ok := errors.Cause(err).(pinger.InvalidMethodError); !ok {
+		t.Errorf("err = (%v); want (InvalidMethodError)", err)
+	}
+	_, err = pinger.New("http://localhost", pinger.WithClient(nil))
+	if errors.Cause(err) != pinger.ErrNilClient {
+		t.Errorf("err = (%v); want (ErrNilClient)", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+	requests := make(chan *http.Request, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	defer ts.Close()
+
+	p, err := pinger.New(ts.URL+"/", pinger.WithMethod("get"), pinger.WithPath("/health"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if p.URL() != ts.URL+"/health" {
+		t.Errorf("URL() = (%s); want (%s)", p.URL(), ts.URL+"/health")
+	}
+	if p.Healthy() {
+		t.Error("Healthy() = (true); want (false) before pinging")
+	}
+	if err = p.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	r := <-requests
+	if r.Method != http.MethodGet || r.URL.Path != "/health" {
+		t.Errorf("request = (%s %s); want (GET /health)", r.Method, r.URL.Path)
+	}
+	if !p.Healthy() {
+		t.Error("Healthy() = (false); want (true)")
+	}
+	if g := gauge(t, p.URL()); g != "1" {
+		t.Errorf("gauge = (%s); want (1)", g)
+	}
+
+	ts.Close()
+	if err = p.Ping(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if p.Healthy() {
+		t.Error("Healthy() = (true); want (false)")
+	}
+	if g := gauge(t, p.URL()); g != "0" {
+		t.Errorf("gauge = (%s); want (0)", g)
+	}
+}
+
+func TestGaugeName(t *testing.T) {
+	t.Parallel()
+	endpoint := "http://localhost/shared"
+	p1, err := pinger.New(endpoint, pinger.WithName("gauge_name_1"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	p2, err := pinger.New(endpoint, pinger.WithName("gauge_name_2"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if p1.Name() != "gauge_name_1" {
+		t.Errorf("Name() = (%s); want (gauge_name_1)", p1.Name())
+	}
+	p1.Report(nil)
+	p2.Report(errors.New("connection refused"))
+	if g := gauge(t, "gauge_name_1"); g != "1" {
+		t.Errorf("gauge_name_1 = (%s); want (1)", g)
+	}
+	if g := gauge(t, "gauge_name_2"); g != "0" {
+		t.Errorf("gauge_name_2 = (%s); want (0)", g)
+	}
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+	p, err := pinger.New("http://localhost/report")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	p.Report(nil)
+	if !p.Healthy() {
+		t.Error("Healthy() = (false); want (true)")
+	}
+	p.Report(errors.New("connection refused"))
+	if p.Healthy() {
+		t.Error("Healthy() = (true); want (false)")
+	}
+}
+
+func TestPingInterval(t *testing.T) {
+	t.Parallel()
+	requests := make(chan struct{}, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requests <- struct{}{}:
+		default:
+		}
+	}))
+	defer ts.Close()
+
+	p, err := pinger.New(ts.URL, pinger.WithInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer p.Stop()
+	if err = p.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-requests:
+		case <-time.After(time.Second):
+			t.Fatalf("%d: no background checks", i)
+		}
+	}
+
+	p.Stop() // waits for the check in flight.
+	for len(requests) > 0 {
+		<-requests
+	}
+	select {
+	case <-requests:
+		t.Error("background checks continued after Stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStopCancelsCheck(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			<-r.Context().Done()
+		}
+	}))
+	defer ts.Close()
+
+	p, err := pinger.New(ts.URL,
+		pinger.WithName("stop_cancels_check"),
+		pinger.WithInterval(time.Millisecond),
+		pinger.WithTimeout(time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = p.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for atomic.LoadInt32(&calls) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		p.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() did not cancel the check in flight")
+	}
+	if !p.Healthy() {
+		t.Error("Healthy() = (false); want (true)")
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// The services are described by hand, so the plugins do not need generated
+// code. All messages are BytesValues, the Documents are sent as JSON.
+const (
+	readerService   = "expipe.plugin.Reader"
+	recorderService = "expipe.plugin.Recorder"
+)
+
+// call is the implementation of a method of a service.
+type call func(srv interface{}, ctx context.Context, in []byte) ([]byte, error)
+
+var (
+	readerDesc = grpc.ServiceDesc{
+		ServiceName: readerService,
+		HandlerType: (*Reader)(nil),
+		Methods: []grpc.MethodDesc{
+			method(readerService, "Ping", func(srv interface{}, ctx context.Context, _ []byte) ([]byte, error) {
+				return nil, srv.(Reader).Ping(ctx)
+			}),
+			method(readerService, "Read", func(srv interface{}, ctx context.Context, _ []byte) ([]byte, error) {
+				return srv.(Reader).Read(ctx)
+			}),
+		},
+		Metadata: "expipe/plugin",
+	}
+
+	recorderDesc = grpc.ServiceDesc{
+		ServiceName: recorderService,
+		HandlerType: (*Recorder)(nil),
+		Methods: []grpc.MethodDesc{
+			method(recorderService, "Ping", func(srv interface{}, ctx context.Context, _ []byte) ([]byte, error) {
+				return nil, srv.(Recorder).Ping(ctx)
+			}),
+			method(recorderService, "Record", func(srv interface{}, ctx context.Context, in []byte) ([]byte, error) {
+				var doc Document
+				if err := json.Unmarshal(in, &doc); err != nil {
+					return nil, errors.Wrap(err, "decoding document")
+				}
+				return nil, srv.(Recorder).Record(ctx, doc)
+			}),
+			method(recorderService, "RecordBatch", func(srv interface{}, ctx context.Context, in []byte) ([]byte, error) {
+				var docs []Document
+				if err := json.Unmarshal(in, &docs); err != nil {
+					return nil, errors.Wrap(err, "decoding documents")
+				}
+				return nil, recordBatch(ctx, srv.(Recorder), docs)
+			}),
+		},
+		Metadata: "expipe/plugin",
+	}
+)
+
+// method returns the description of the name method of the service, which is
+// handled by the fn.
+func method(service, name string, fn call) grpc.MethodDesc {
+	handle := func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+		out, err := fn(srv, ctx, req.(*wrapperspb.BytesValue).GetValue())
+		if err != nil {
+			return nil, err
+		}
+		return wrapperspb.Bytes(out), nil
+	}
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(wrapperspb.BytesValue)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return handle(srv, ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + service + "/" + name}
+			return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return handle(srv, ctx, req)
+			})
+		},
+	}
+}
+
+// grpcPlugin serves the reader or the recorder that is set, and dispenses the
+// grpcClient for both.
+type grpcPlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	reader   Reader
+	recorder Recorder
+}
+
+func (p *grpcPlugin) GRPCServer(_ *goplugin.GRPCBroker, s *grpc.Server) error {
+	if p.reader != nil {
+		s.RegisterService(&readerDesc, p.reader)
+	}
+	if p.recorder != nil {
+		s.RegisterService(&recorderDesc, p.recorder)
+	}
+	return nil
+}
+
+func (p *grpcPlugin) GRPCClient(_ context.Context, _ *goplugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &grpcClient{conn: c}, nil
+}
+
+// errUnimplemented is returned when the plugin does not have the method, for
+// example because it is built with an older version of this package.
+var errUnimplemented = errors.New("method is not implemented by the plugin")
+
+type grpcClient struct {
+	conn *grpc.ClientConn
+}
+
+// invoke calls the method of the service with the in, and returns the output.
+// The errors of the plugin are returned with their messages, and the error of
+// the ctx is returned if it is done. It returns errUnimplemented if the plugin
+// does not have the method.
+func (c *grpcClient) invoke(ctx context.Context, service, name string, in []byte) ([]byte, error) {
+	out := new(wrapperspb.BytesValue)
+	err := c.conn.Invoke(ctx, "/"+service+"/"+name, wrapperspb.Bytes(in), out)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if status.Code(err) == codes.Unimplemented {
+			return nil, errUnimplemented
+		}
+		return nil, errors.New(status.Convert(err).Message())
+	}
+	return out.GetValue(), nil
+}
+
+type readerClient struct {
+	conn *grpcClient
+}
+
+func (r *readerClient) Ping(ctx context.Context) error {
+	_, err := r.conn.invoke(ctx, readerService, "Ping", nil)
+	return err
+}
+
+func (r *readerClient) Read(ctx context.Context) ([]byte, error) {
+	return r.conn.invoke(ctx, readerService, "Read", nil)
+}
+
+type recorderClient struct {
+	conn *grpcClient
+}
+
+func (r *recorderClient) Ping(ctx context.Context) error {
+	_, err := r.conn.invoke(ctx, recorderService, "Ping", nil)
+	return err
+}
+
+func (r *recorderClient) Record(ctx context.Context, doc Document) error {
+	in, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "encoding document")
+	}
+	_, err = r.conn.invoke(ctx, recorderService, "Record", in)
+	return err
+}
+
+// RecordBatch sends the docs to the plugin in one call. They are sent one by
+// one if the plugin is built without the RecordBatch method.
+func (r *recorderClient) RecordBatch(ctx context.Context, docs []Document) error {
+	in, err := json.Marshal(docs)
+	if err != nil {
+		return errors.Wrap(err, "encoding documents")
+	}
+	_, err = r.conn.invoke(ctx, recorderService, "RecordBatch", in)
+	if err != errUnimplemented {
+		return err
+	}
+	for _, doc := range docs {
+		if err = r.Record(ctx, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
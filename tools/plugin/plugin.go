@@ -0,0 +1,203 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package plugin lets third parties ship readers and recorders as separate
+// binaries. A plugin is a program that calls ServeReader or ServeRecorder in
+// its main function, and it is declared in the configuration file with the
+// plugin type and the path of the binary:
+//
+//	readers:
+//	    my_reader:
+//	        type: plugin
+//	        path: ./my-reader
+//
+// Expipe runs the binary when the reader or recorder is pinged, and talks to
+// it over gRPC with hashicorp/go-plugin. The binaries are stopped when their
+// readers and recorders are closed, and the remaining ones by Cleanup.
+//
+// A plugin reader returns the JSON contents of the target on each Read, and
+// expipe maps them like the contents of the other readers. A plugin recorder
+// receives the Documents that are ready to be shipped, and it receives them in
+// batches if it implements BatchRecorder. The errors of the plugins are
+// returned to expipe with their messages.
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/alext234/expipe/tools"
+	hclog "github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	readerPlugin   = "reader"
+	recorderPlugin = "recorder"
+)
+
+// Handshake is checked by expipe and the plugins before they talk. The
+// ProtocolVersion changes when the plugins need to be rebuilt.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "EXPIPE_PLUGIN",
+	MagicCookieValue: "reader_recorder",
+}
+
+// Reader is implemented by the plugin readers. Read should return JSON
+// contents, otherwise the result is rejected. The ctx is cancelled when the
+// timeout of the reader is reached.
+type Reader interface {
+	Ping(ctx context.Context) error
+	Read(ctx context.Context) ([]byte, error)
+}
+
+// Recorder is implemented by the plugin recorders. Record should return when
+// the ctx is cancelled.
+type Recorder interface {
+	Ping(ctx context.Context) error
+	Record(ctx context.Context, doc Document) error
+}
+
+// BatchRecorder is implemented by the plugin recorders that can record many
+// Documents at once, for example with a bulk request. The Documents of the
+// other plugin recorders are recorded one by one with Record. RecordBatch
+// should return an error if any of the Documents are not recorded.
+type BatchRecorder interface {
+	Recorder
+	RecordBatch(ctx context.Context, docs []Document) error
+}
+
+// recordBatch records the docs with r in one call if it is a BatchRecorder,
+// otherwise one by one until the first error.
+func recordBatch(ctx context.Context, r Recorder, docs []Document) error {
+	if br, ok := r.(BatchRecorder); ok {
+		return br.RecordBatch(ctx, docs)
+	}
+	for _, doc := range docs {
+		if err := r.Record(ctx, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Document is a job that is sent to the plugin recorders. The Payload is the
+// JSON object of the values that are read, with the time in its @timestamp
+// field.
+type Document struct {
+	ID        string          `json:"id"`
+	Reader    string          `json:"reader"`
+	IndexName string          `json:"index_name"`
+	TypeName  string          `json:"type_name"`
+	Time      time.Time       `json:"time"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// ServeReader serves the r to expipe. It should be called in the main function
+// of the plugin, and it returns when expipe stops the plugin.
+func ServeReader(r Reader) {
+	serve(readerPlugin, &grpcPlugin{reader: r})
+}
+
+// ServeRecorder serves the r to expipe. It should be called in the main
+// function of the plugin, and it returns when expipe stops the plugin.
+func ServeRecorder(r Recorder) {
+	serve(recorderPlugin, &grpcPlugin{recorder: r})
+}
+
+func serve(name string, p goplugin.Plugin) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         goplugin.PluginSet{name: p},
+		GRPCServer:      goplugin.DefaultGRPCServer,
+	})
+}
+
+// Client runs a plugin binary.
+type Client struct {
+	client *goplugin.Client
+}
+
+// NewClient returns a Client for the binary of the path, which is run with the
+// args when the Reader or the Recorder is requested. The output of the plugin
+// on its stderr is logged with the log.
+func NewClient(log tools.FieldLogger, path string, args ...string) *Client {
+	log = log.WithField("plugin", path)
+	return &Client{client: goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig: Handshake,
+		Plugins: goplugin.PluginSet{
+			readerPlugin:   &grpcPlugin{},
+			recorderPlugin: &grpcPlugin{},
+		},
+		Cmd:              exec.Command(path, args...),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+		Managed:          true,
+		Stderr:           logWriter(log.Info),
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:        "plugin",
+			Level:       hclog.Warn,
+			Output:      logWriter(log.Warn),
+			DisableTime: true,
+		}),
+	})}
+}
+
+// Reader runs the plugin if it is not running, and returns its Reader.
+func (c *Client) Reader() (Reader, error) {
+	raw, err := c.dispense(readerPlugin)
+	if err != nil {
+		return nil, err
+	}
+	return &readerClient{conn: raw.(*grpcClient)}, nil
+}
+
+// Recorder runs the plugin if it is not running, and returns its Recorder.
+func (c *Client) Recorder() (Recorder, error) {
+	raw, err := c.dispense(recorderPlugin)
+	if err != nil {
+		return nil, err
+	}
+	return &recorderClient{conn: raw.(*grpcClient)}, nil
+}
+
+func (c *Client) dispense(name string) (interface{}, error) {
+	rpc, err := c.client.Client()
+	if err != nil {
+		return nil, errors.Wrap(err, "starting plugin")
+	}
+	raw, err := rpc.Dispense(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "plugin %s", name)
+	}
+	return raw, nil
+}
+
+// Kill stops the plugin.
+func (c *Client) Kill() { c.client.Kill() }
+
+// Exited returns true if the plugin has stopped.
+func (c *Client) Exited() bool { return c.client.Exited() }
+
+// Cleanup stops all the plugins. It should be called before expipe exits.
+func Cleanup() { goplugin.CleanupClients() }
+
+// logWriter logs each line that is written to it.
+type logWriter func(args ...interface{})
+
+func (w logWriter) Write(p []byte) (int, error) {
+	s := bufio.NewScanner(bytes.NewReader(p))
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			w(line)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package plugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools"
+	"github.com/alext234/expipe/tools/plugin"
+)
+
+// The test binary serves the plugin of this variable instead of running the
+// tests.
+const pluginEnv = "EXPIPE_TEST_PLUGIN"
+
+type fakeReader struct{}
+
+func (fakeReader) Ping(ctx context.Context) error { return nil }
+
+func (fakeReader) Read(ctx context.Context) ([]byte, error) {
+	return []byte(`{"Alloc":1024}`), nil
+}
+
+type fakeRecorder struct{}
+
+func (fakeRecorder) Ping(ctx context.Context) error { return errors.New("database is down") }
+
+func (fakeRecorder) Record(ctx context.Context, doc plugin.Document) error {
+	var v map[string]interface{}
+	if err := json.Unmarshal(doc.Payload, &v); err != nil {
+		return err
+	}
+	if doc.IndexName != "index" || v["Alloc"] != 1024.0 {
+		return errors.New("bad document")
+	}
+	return nil
+}
+
+// fakeBatchRecorder only records the documents in batches.
+type fakeBatchRecorder struct{ fakeRecorder }
+
+func (fakeBatchRecorder) Record(ctx context.Context, doc plugin.Document) error {
+	return errors.New("not in a batch")
+}
+
+func (f fakeBatchRecorder) RecordBatch(ctx context.Context, docs []plugin.Document) error {
+	for _, doc := range docs {
+		if err := f.fakeRecorder.Record(ctx, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(pluginEnv) {
+	case "reader":
+		plugin.ServeReader(fakeReader{})
+		os.Exit(0)
+	case "recorder":
+		plugin.ServeRecorder(fakeRecorder{})
+		os.Exit(0)
+	case "batch_recorder":
+		plugin.ServeRecorder(fakeBatchRecorder{})
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// newClient returns a client that runs the test binary as the kind plugin.
+// The plugin is started with the environment of the test, so the variable is
+// unset after starting it.
+func newClient(kind string) (*plugin.Client, func()) {
+	os.Setenv(pluginEnv, kind)
+	c := plugin.NewClient(tools.DiscardLogger(), os.Args[0])
+	return c, func() {
+		os.Unsetenv(pluginEnv)
+		c.Kill()
+	}
+}
+
+func TestReader(t *testing.T) {
+	c, stop := newClient("reader")
+	defer stop()
+	r, err := c.Reader()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Ping(ctx); err != nil {
+		t.Errorf("Ping() = (%v); want (nil)", err)
+	}
+	content, err := r.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() = (%v); want (nil)", err)
+	}
+	if string(content) != `{"Alloc":1024}` {
+		t.Errorf("content = (%s); want (%s)", content, `{"Alloc":1024}`)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	c, stop := newClient("recorder")
+	defer stop()
+	r, err := c.Recorder()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Ping(ctx); err == nil || err.Error() != "database is down" {
+		t.Errorf("Ping() = (%v); want (database is down)", err)
+	}
+	doc := plugin.Document{
+		ID:        "id",
+		IndexName: "index",
+		Time:      time.Now(),
+		Payload:   json.RawMessage(`{"Alloc":1024}`),
+	}
+	if err := r.Record(ctx, doc); err != nil {
+		t.Errorf("Record() = (%v); want (nil)", err)
+	}
+	doc.IndexName = "other"
+	if err := r.Record(ctx, doc); err == nil || err.Error() != "bad document" {
+		t.Errorf("Record() = (%v); want (bad document)", err)
+	}
+	cancel()
+	if err := r.Record(ctx, doc); err != context.Canceled {
+		t.Errorf("Record() = (%v); want (%v)", err, context.Canceled)
+	}
+}
+
+func TestRecorderBatch(t *testing.T) {
+	docs := []plugin.Document{
+		{ID: "1", IndexName: "index", Time: time.Now(), Payload: json.RawMessage(`{"Alloc":1024}`)},
+		{ID: "2", IndexName: "index", Time: time.Now(), Payload: json.RawMessage(`{"Alloc":1024}`)},
+	}
+	for _, kind := range []string{"recorder", "batch_recorder"} {
+		t.Run(kind, func(t *testing.T) {
+			c, stop := newClient(kind)
+			defer stop()
+			r, err := c.Recorder()
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			br, ok := r.(plugin.BatchRecorder)
+			if !ok {
+				t.Fatalf("%T is not a plugin.BatchRecorder", r)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := br.RecordBatch(ctx, docs); err != nil {
+				t.Errorf("RecordBatch() = (%v); want (nil)", err)
+			}
+			bad := append(docs, plugin.Document{IndexName: "other", Payload: json.RawMessage(`{}`)})
+			if err := br.RecordBatch(ctx, bad); err == nil || err.Error() != "bad document" {
+				t.Errorf("RecordBatch() = (%v); want (bad document)", err)
+			}
+		})
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c := plugin.NewClient(tools.DiscardLogger(), "/does/not/exist")
+	defer c.Kill()
+	if _, err := c.Reader(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	c, stop := newClient("reader")
+	defer stop()
+	r, err := c.Recorder()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err := r.Ping(context.Background()); err == nil {
+		t.Error("Ping() = (nil); want (error) from a reader plugin")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "expipe_rotate")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "expipe.log")
+
+	r, err := NewRotatingFile(file, 10, 2)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	for _, line := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, err = r.Write([]byte(line)); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	if err = r.Close(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+
+	tcs := []struct {
+		name string
+		want string
+	}{
+		{file, "dddddd\n"},
+		{file + ".1", "cccccc\n"},
+		{file + ".2", "bbbbbb\n"},
+	}
+	for _, tc := range tcs {
+		content, err := ioutil.ReadFile(tc.name)
+		if err != nil {
+			t.Errorf("err = (%v); want (nil)", err)
+			continue
+		}
+		if string(content) != tc.want {
+			t.Errorf("%s = (%s); want (%s)", tc.name, content, tc.want)
+		}
+	}
+	if _, err = os.Stat(file + ".3"); !os.IsNotExist(err) {
+		t.Errorf("err = (%v); want (not exist)", err)
+	}
+
+	if _, err = r.Write([]byte("x")); err == nil {
+		t.Error("err = (nil); want (error after Close)")
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "expipe_rotate")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "expipe.log")
+	if err = ioutil.WriteFile(file, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+
+	r, err := NewRotatingFile(file, 0, 0)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	r.Write(bytes.Repeat([]byte("n"), 100))
+	r.Close()
+	content, _ := ioutil.ReadFile(file)
+	if !bytes.HasPrefix(content, []byte("old\n")) || len(content) != 104 {
+		t.Errorf("content = (%s); want old content followed by the new one", content)
+	}
+	if _, err = os.Stat(file + ".1"); !os.IsNotExist(err) {
+		t.Errorf("err = (%v); want (not exist)", err)
+	}
+}
+
+func TestNewRotatingFileErrors(t *testing.T) {
+	t.Parallel()
+	if _, err := NewRotatingFile("/tmp/expipe.log", -1, 0); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if _, err := NewRotatingFile("/does/not/exist/expipe.log", 0, 0); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package sample decides which of the readings of a route are recorded. The
+// readers are still read on every interval, therefore the alerts are evaluated
+// at the full frequency, while only a fraction of the readings are stored.
+package sample
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Sampler records N out of every M readings. The first N readings of each
+// round of M are recorded. It is concurrent safe.
+type Sampler struct {
+	N, M  int64
+	count int64 // updated atomically.
+}
+
+// Parse returns a Sampler for a rate in the form of N/M, for example 1/10 for
+// recording one out of every ten readings. A single number N is the same as
+// 1/N. It returns an error if N is not between 1 and M.
+func Parse(rate string) (*Sampler, error) {
+	n, m := "1", strings.TrimSpace(rate)
+	if i := strings.Index(rate, "/"); i >= 0 {
+		n, m = strings.TrimSpace(rate[:i]), strings.TrimSpace(rate[i+1:])
+	}
+	num, err := strconv.ParseInt(n, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sample rate %q", rate)
+	}
+	den, err := strconv.ParseInt(m, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sample rate %q", rate)
+	}
+	if num < 1 || num > den {
+		return nil, fmt.Errorf("invalid sample rate %q: N of N/M should be between 1 and M", rate)
+	}
+	return &Sampler{N: num, M: den}, nil
+}
+
+// Sample counts a reading and returns true if it should be recorded.
+func (s *Sampler) Sample() bool {
+	c := atomic.AddInt64(&s.count, 1) - 1
+	return c%s.M < s.N
+}
+
+func (s *Sampler) String() string { return fmt.Sprintf("%d/%d", s.N, s.M) }
@@ -0,0 +1,77 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package sample_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alext234/expipe/tools/sample"
+)
+
+func TestParse(t *testing.T) {
+	tcs := []struct {
+		rate string
+		n, m int64
+	}{
+		{"1/10", 1, 10},
+		{" 3 / 4 ", 3, 4},
+		{"5", 1, 5},
+		{"1/1", 1, 1},
+	}
+	for _, tc := range tcs {
+		s, err := sample.Parse(tc.rate)
+		if err != nil {
+			t.Errorf("%q: err = (%v); want (nil)", tc.rate, err)
+			continue
+		}
+		if s.N != tc.n || s.M != tc.m {
+			t.Errorf("%q: Parse() = (%s); want (%d/%d)", tc.rate, s, tc.n, tc.m)
+		}
+	}
+	for _, rate := range []string{"", "a/10", "1/b", "0/10", "11/10", "-1/10", "1/0", "1/2/3"} {
+		if _, err := sample.Parse(rate); err == nil {
+			t.Errorf("%q: err = (nil); want (error)", rate)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	s, err := sample.Parse("2/5")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := []bool{true, true, false, false, false, true, true, false, false, false}
+	for i, w := range want {
+		if got := s.Sample(); got != w {
+			t.Errorf("%d: Sample() = (%t); want (%t)", i, got, w)
+		}
+	}
+}
+
+func TestSampleConcurrent(t *testing.T) {
+	s, err := sample.Parse("1/10")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var (
+		wg      sync.WaitGroup
+		sampled int64
+	)
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.Sample() {
+				atomic.AddInt64(&sampled, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if sampled != 100 {
+		t.Errorf("sampled = (%d); want (100)", sampled)
+	}
+}
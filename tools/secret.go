@@ -0,0 +1,74 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// vaultClient is used for reading the secrets from Vault.
+var vaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// ReadSecretFile returns the content of the file without the trailing new
+// lines and spaces.
+func ReadSecretFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "reading secret")
+	}
+	return strings.TrimRight(string(content), "\r\n\t "), nil
+}
+
+// VaultSecret reads the field of the secret at path from the Vault server at
+// the VAULT_ADDR environment variable, with the VAULT_TOKEN token. The ref is
+// in path#field format, for example secret/data/expipe#password. Both
+// version 1 and 2 of the key/value secret engines are supported.
+func VaultSecret(ref string) (string, error) {
+	i := strings.LastIndex(ref, "#")
+	if i <= 0 || i == len(ref)-1 {
+		return "", fmt.Errorf("vault reference %q should be in path#field format", ref)
+	}
+	path, field := strings.Trim(ref[:i], "/"), ref[i+1:]
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", UnsetEnvError("VAULT_ADDR")
+	}
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "vault")
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "vault")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: reading %s: %s", path, resp.Status)
+	}
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", errors.Wrap(err, "vault")
+	}
+	data := secret.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		data = inner
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no %s field", path, field)
+	}
+	return value, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestReadSecretFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "expipe_secret")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("s3cret \n")
+	f.Close()
+
+	s, err := ReadSecretFile(f.Name())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if s != "s3cret" {
+		t.Errorf("s = (%q); want (s3cret)", s)
+	}
+	if _, err = ReadSecretFile("/does/not/exist"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+
+	got, err := ExpandEnv("user:${file:" + f.Name() + "}")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got != "user:s3cret" {
+		t.Errorf("ExpandEnv() = (%s); want (user:s3cret)", got)
+	}
+	if _, err = ExpandEnv("${file:/does/not/exist}"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestVaultSecret(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/expipe":
+			w.Write([]byte(`{"data":{"data":{"password":"v2pass"},"metadata":{}}}`))
+		case "/v1/secret/expipe":
+			w.Write([]byte(`{"data":{"password":"v1pass"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	if _, err := VaultSecret("secret/expipe#password"); err != UnsetEnvError("VAULT_ADDR") {
+		t.Errorf("err = (%v); want (UnsetEnvError)", err)
+	}
+	os.Setenv("VAULT_ADDR", ts.URL)
+	os.Setenv("VAULT_TOKEN", "token")
+
+	tcs := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"secret/data/expipe#password", "v2pass", false},
+		{"/secret/expipe#password", "v1pass", false},
+		{"secret/expipe#username", "", true},
+		{"secret/other#password", "", true},
+		{"secret/expipe", "", true},
+		{"secret/expipe#", "", true},
+	}
+	for _, tc := range tcs {
+		got, err := VaultSecret(tc.ref)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: err = (nil); want (error)", tc.ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: err = (%v); want (nil)", tc.ref, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("VaultSecret(%s) = (%s); want (%s)", tc.ref, got, tc.want)
+		}
+	}
+
+	got, err := ExpandEnv("${vault:secret/data/expipe#password}")
+	if err != nil || got != "v2pass" {
+		t.Errorf("ExpandEnv() = (%s, %v); want (v2pass, nil)", got, err)
+	}
+
+	os.Setenv("VAULT_TOKEN", "wrong")
+	if _, err = VaultSecret("secret/expipe#password"); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
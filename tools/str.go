@@ -26,8 +26,8 @@ func StringInMapKeys(niddle string, haystack map[string]string) bool {
 	return false
 }
 
-// IsJSON checks is the input content is a valid JSON input.
+// IsJSON checks is the input content is a valid JSON input. It doesn't
+// allocate.
 func IsJSON(input []byte) bool {
-	var js json.RawMessage
-	return json.Unmarshal(input, &js) == nil
+	return json.Valid(input)
 }
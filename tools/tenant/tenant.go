@@ -0,0 +1,97 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package tenant holds the tenants of the routes, for running one expipe for
+// many teams. The documents of a tenant are recorded into the indices with its
+// prefix and are labelled with its ID. A tenant can have quotas on the number
+// and the size of its documents in each period, and the documents over the
+// quotas are dropped until the next period starts.
+package tenant
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPeriod is the period of the quotas when it is not set.
+	DefaultPeriod = 24 * time.Hour
+
+	// Label is the name of the label of the documents that holds the ID of
+	// their tenant.
+	Label = "tenant"
+)
+
+// Tenant is the owner of the documents of one or more routes. The zero
+// MaxDocuments and MaxBytes mean no quotas. It is concurrent safe.
+type Tenant struct {
+	ID           string
+	IndexPrefix  string
+	MaxDocuments int64
+	MaxBytes     int64
+	Period       time.Duration
+
+	mu       sync.Mutex
+	start    time.Time // guarded by mu.
+	docs     int64     // guarded by mu.
+	bytes    int64     // guarded by mu.
+	rejected bool      // guarded by mu.
+}
+
+// New returns a Tenant without quotas, with the ID and a dash as the prefix of
+// its indices.
+func New(id string) *Tenant {
+	return &Tenant{
+		ID:          id,
+		IndexPrefix: id + "-",
+		Period:      DefaultPeriod,
+	}
+}
+
+// IndexName returns the index name with the prefix of the tenant.
+func (t *Tenant) IndexName(index string) string { return t.IndexPrefix + index }
+
+// Allow counts a document of the size against the quotas of the current
+// period, and returns false if it would exceed any of them. The rejected
+// documents are not counted. The first is true for the first rejected
+// document of the period, therefore the callers can report it once.
+func (t *Tenant) Allow(size int64) (ok, first bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rotate()
+	if t.MaxDocuments > 0 && t.docs+1 > t.MaxDocuments ||
+		t.MaxBytes > 0 && t.bytes+size > t.MaxBytes {
+		first = !t.rejected
+		t.rejected = true
+		return false, first
+	}
+	t.docs++
+	t.bytes += size
+	return true, false
+}
+
+// Usage returns the number and the size of the documents of the current
+// period.
+func (t *Tenant) Usage() (documents, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rotate()
+	return t.docs, t.bytes
+}
+
+// rotate starts a new period if the current one is over. It should be called
+// with the mu locked.
+func (t *Tenant) rotate() {
+	period := t.Period
+	if period <= 0 {
+		period = DefaultPeriod
+	}
+	now := time.Now()
+	if now.Sub(t.start) < period {
+		return
+	}
+	t.start = now
+	t.docs, t.bytes = 0, 0
+	t.rejected = false
+}
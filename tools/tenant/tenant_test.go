@@ -0,0 +1,105 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tenant_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alext234/expipe/tools/tenant"
+)
+
+func TestNew(t *testing.T) {
+	tn := tenant.New("payments")
+	if got := tn.IndexName("expipe"); got != "payments-expipe" {
+		t.Errorf("IndexName() = (%s); want (payments-expipe)", got)
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := tn.Allow(1 << 20); !ok {
+			t.Fatalf("Allow() = (false) at %d; want (true) without quotas", i)
+		}
+	}
+	if docs, bytes := tn.Usage(); docs != 100 || bytes != 100<<20 {
+		t.Errorf("Usage() = (%d, %d); want (100, %d)", docs, bytes, 100<<20)
+	}
+}
+
+func TestAllowDocuments(t *testing.T) {
+	tn := tenant.New("payments")
+	tn.MaxDocuments = 2
+	for i := 0; i < 2; i++ {
+		if ok, _ := tn.Allow(10); !ok {
+			t.Fatalf("Allow() = (false) at %d; want (true)", i)
+		}
+	}
+	if ok, first := tn.Allow(10); ok || !first {
+		t.Errorf("Allow() = (%t, %t); want (false, true)", ok, first)
+	}
+	if ok, first := tn.Allow(10); ok || first {
+		t.Errorf("Allow() = (%t, %t); want (false, false)", ok, first)
+	}
+	if docs, _ := tn.Usage(); docs != 2 {
+		t.Errorf("documents = (%d); want (2)", docs)
+	}
+}
+
+func TestAllowBytes(t *testing.T) {
+	tn := tenant.New("payments")
+	tn.MaxBytes = 100
+	if ok, _ := tn.Allow(60); !ok {
+		t.Fatal("Allow(60) = (false); want (true)")
+	}
+	if ok, _ := tn.Allow(60); ok {
+		t.Error("Allow(60) = (true); want (false): over the quota")
+	}
+	if ok, _ := tn.Allow(40); !ok {
+		t.Error("Allow(40) = (false); want (true): the rejected bytes are not counted")
+	}
+}
+
+func TestAllowPeriod(t *testing.T) {
+	tn := tenant.New("payments")
+	tn.MaxDocuments = 1
+	tn.Period = 50 * time.Millisecond
+	if ok, _ := tn.Allow(1); !ok {
+		t.Fatal("Allow() = (false); want (true)")
+	}
+	if ok, _ := tn.Allow(1); ok {
+		t.Fatal("Allow() = (true); want (false)")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := tn.Allow(1); !ok {
+		t.Error("Allow() = (false); want (true) in the next period")
+	}
+	if ok, first := tn.Allow(1); ok || !first {
+		t.Errorf("Allow() = (%t, %t); want (false, true) in the next period", ok, first)
+	}
+}
+
+func TestAllowConcurrent(t *testing.T) {
+	tn := tenant.New("payments")
+	tn.MaxDocuments = 50
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := tn.Allow(1); ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 50 {
+		t.Errorf("allowed = (%d); want (50)", allowed)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package trace records the lifecycle of the jobs as OpenTelemetry spans. A
+// span is started for each step (read, map and record), and the spans of a
+// job share the same trace ID, therefore a slow scrape or a slow write can be
+// followed end to end.
+//
+// The spans are sent to an OpenTelemetry collector with OTLP over HTTP once
+// Setup is called with an enabled Config. Until then the global provider of
+// the otel package is used, which does not record anything unless it is
+// replaced, and the spans are safe to use.
+//
+// The trace context is propagated to the endpoints with the W3C traceparent
+// header by the Transport.
+package trace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Header is the name of the propagation header.
+const Header = "traceparent"
+
+// ShutdownTimeout is the time the spans that are not sent yet are given when
+// the closer of Setup is closed.
+const ShutdownTimeout = 5 * time.Second
+
+const (
+	tracerName  = "github.com/alext234/expipe"
+	serviceName = "expipe"
+)
+
+var propagator = propagation.TraceContext{}
+
+var (
+	// ErrInvalidEndpoint is returned when the endpoint is not an http or https
+	// URL.
+	ErrInvalidEndpoint = fmt.Errorf("endpoint should be an http or https URL")
+
+	// ErrInvalidSampleRatio is returned when the sample ratio is not between 0
+	// and 1.
+	ErrInvalidSampleRatio = fmt.Errorf("sample ratio should be between 0 and 1")
+)
+
+// Config is the settings of the exporter.
+type Config struct {
+	// Enabled turns the tracing on.
+	Enabled bool
+
+	// Endpoint is the URL of the OTLP/HTTP receiver of the collector, for
+	// example http://localhost:4318. The OTEL_EXPORTER_OTLP_ENDPOINT
+	// environment variable, or its default, is used if it is empty.
+	Endpoint string
+
+	// SampleRatio is the ratio of the traces that are sent, between 0 and 1.
+	// All traces are sent if it is zero. The traces that are started by the
+	// endpoints are sampled by their decisions.
+	SampleRatio float64
+}
+
+// Validate returns an error if the endpoint or the sample ratio is invalid.
+func (c Config) Validate() error {
+	if c.Endpoint != "" {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidEndpoint
+		}
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return ErrInvalidSampleRatio
+	}
+	return nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// Setup installs a tracer provider that sends the spans to the collector of
+// the c. The returned io.Closer sends the remaining spans and removes the
+// provider, it should be closed when the application stops. If the c is not
+// enabled, the spans are not recorded.
+func Setup(c Config) (io.Closer, error) {
+	if !c.Enabled {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return closerFunc(func() error { return nil }), nil
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var options []otlptracehttp.Option
+	if c.Endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpointURL(c.Endpoint))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "otlp exporter")
+	}
+	sampler := sdktrace.AlwaysSample()
+	if c.SampleRatio > 0 && c.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(c.SampleRatio)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return closerFunc(func() error {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		return provider.Shutdown(ctx)
+	}), nil
+}
+
+// Span is a step of a job. It is an OpenTelemetry span with the helpers that
+// are used with the jobs.
+type Span struct {
+	oteltrace.Span
+}
+
+// Start starts a span as a child of the span in the ctx, or as a new trace if
+// there is none. The returned context carries the new span. The spans in the
+// contexts of the links are linked to the new span, for example the read jobs
+// of a batch of records.
+func Start(ctx context.Context, name string, links ...context.Context) (context.Context, Span) {
+	var options []oteltrace.SpanStartOption
+	for _, l := range links {
+		if sc := oteltrace.SpanContextFromContext(l); sc.IsValid() {
+			options = append(options, oteltrace.WithLinks(oteltrace.Link{SpanContext: sc}))
+		}
+	}
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, options...)
+	return ctx, Span{span}
+}
+
+// WithSpan returns a copy of the ctx that carries the span of the from. The
+// spans that are started with it are the children of that span, while they
+// keep the deadline and the cancellation of the ctx.
+func WithSpan(ctx, from context.Context) context.Context {
+	return oteltrace.ContextWithSpan(ctx, oteltrace.SpanFromContext(from))
+}
+
+// SetAttribute records a key/value pair on the span.
+func (s Span) SetAttribute(key, value string) {
+	s.SetAttributes(attribute.String(key, value))
+}
+
+// SetError marks the span as failed if err is not nil.
+func (s Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.RecordError(err)
+	s.SetStatus(codes.Error, err.Error())
+}
+
+// Transport adds the traceparent header to the requests that have a span in
+// their context.
+type Transport struct {
+	// Base is used for sending the requests. http.DefaultTransport is used if
+	// it is nil.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !oteltrace.SpanContextFromContext(req.Context()).IsValid() {
+		return base.RoundTrip(req)
+	}
+	// The RoundTripper should not modify the request.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	propagator.Inject(req.Context(), propagation.HeaderCarrier(r.Header))
+	return base.RoundTrip(r)
+}
+
+// CloseIdleConnections closes the idle connections of the Base.
+func (t *Transport) CloseIdleConnections() {
+	if c, ok := t.Base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package trace_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alext234/expipe/tools/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// The tests are not parallel because the tracer provider is global.
+
+// recordSpans installs a provider that keeps the ended spans in the returned
+// recorder until the test is done.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return sr
+}
+
+func TestStartDisabled(t *testing.T) {
+	closer, err := trace.Setup(trace.Config{})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer closer.Close()
+	_, span := trace.Start(context.Background(), "job")
+	if span.IsRecording() {
+		t.Error("IsRecording() = (true); want (false)")
+	}
+	// should not panic
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("error"))
+	span.End()
+}
+
+func TestStartChild(t *testing.T) {
+	sr := recordSpans(t)
+	ctx, parent := trace.Start(context.Background(), "read")
+	_, child := trace.Start(ctx, "record")
+	child.SetAttribute("recorder", "es")
+	child.SetError(errors.New("timeout"))
+	child.End()
+	parent.SetError(nil)
+	parent.End()
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("len(spans) = (%d); want (2)", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if c.Name() != "record" || p.Name() != "read" {
+		t.Fatalf("spans = (%s, %s); want (record, read)", c.Name(), p.Name())
+	}
+	if c.SpanContext().TraceID() != p.SpanContext().TraceID() {
+		t.Errorf("child.TraceID = (%s); want (%s)", c.SpanContext().TraceID(), p.SpanContext().TraceID())
+	}
+	if c.Parent().SpanID() != p.SpanContext().SpanID() {
+		t.Errorf("child.Parent = (%s); want (%s)", c.Parent().SpanID(), p.SpanContext().SpanID())
+	}
+	want := attribute.String("recorder", "es")
+	if attrs := c.Attributes(); len(attrs) != 1 || attrs[0] != want {
+		t.Errorf("Attributes() = (%v); want (%v)", attrs, want)
+	}
+	if c.Status().Code != codes.Error {
+		t.Errorf("Status = (%v); want (Error)", c.Status().Code)
+	}
+	if p.Status().Code != codes.Unset {
+		t.Errorf("Status = (%v); want (Unset)", p.Status().Code)
+	}
+}
+
+func TestStartLinks(t *testing.T) {
+	sr := recordSpans(t)
+	ctx1, read1 := trace.Start(context.Background(), "read")
+	ctx2, read2 := trace.Start(context.Background(), "read")
+	read1.End()
+	read2.End()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ctx, batch := trace.Start(trace.WithSpan(cancelled, ctx1), "record_batch", ctx2, context.Background())
+	batch.End()
+	if ctx.Err() == nil {
+		t.Error("the context of the batch is not cancelled")
+	}
+	spans := sr.Ended()
+	b := spans[len(spans)-1]
+	if b.Parent().SpanID() != read1.SpanContext().SpanID() {
+		t.Errorf("Parent = (%s); want (%s)", b.Parent().SpanID(), read1.SpanContext().SpanID())
+	}
+	links := b.Links()
+	if len(links) != 1 || links[0].SpanContext.SpanID() != read2.SpanContext().SpanID() {
+		t.Errorf("Links() = (%v); want (%s)", links, read2.SpanContext().SpanID())
+	}
+}
+
+func TestTransport(t *testing.T) {
+	recordSpans(t)
+	headers := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Get(trace.Header)
+	}))
+	defer ts.Close()
+	client := &http.Client{Transport: &trace.Transport{}}
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	if h := <-headers; h != "" {
+		t.Errorf("header = (%s); want ()", h)
+	}
+
+	ctx, span := trace.Start(context.Background(), "read")
+	defer span.End()
+	req, _ = http.NewRequest("GET", ts.URL, nil)
+	resp, err = client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	resp.Body.Close()
+	sc := span.SpanContext()
+	want := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"
+	if h := <-headers; h != want {
+		t.Errorf("header = (%s); want (%s)", h, want)
+	}
+	if req.Header.Get(trace.Header) != "" {
+		t.Error("the original request was modified")
+	}
+}
+
+func TestSetupExports(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(prev)
+	paths := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.Method + " " + r.URL.Path
+	}))
+	defer ts.Close()
+
+	closer, err := trace.Setup(trace.Config{Enabled: true, Endpoint: ts.URL})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	_, span := trace.Start(context.Background(), "read")
+	if !span.IsRecording() {
+		t.Error("IsRecording() = (false); want (true)")
+	}
+	span.End()
+	if err = closer.Close(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	select {
+	case p := <-paths:
+		if !strings.HasSuffix(p, "/v1/traces") || !strings.HasPrefix(p, "POST") {
+			t.Errorf("request = (%s); want (POST /v1/traces)", p)
+		}
+	default:
+		t.Error("the spans were not sent on close")
+	}
+	if _, ok := otel.GetTracerProvider().(noop.TracerProvider); !ok {
+		t.Errorf("provider = (%T); want (noop.TracerProvider)", otel.GetTracerProvider())
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	for _, tc := range []struct {
+		conf trace.Config
+		err  error
+	}{
+		{trace.Config{Enabled: true, Endpoint: "://bad"}, trace.ErrInvalidEndpoint},
+		{trace.Config{Enabled: true, Endpoint: "localhost:4318"}, trace.ErrInvalidEndpoint},
+		{trace.Config{Enabled: true, SampleRatio: 1.5}, trace.ErrInvalidSampleRatio},
+		{trace.Config{Enabled: true, SampleRatio: -1}, trace.ErrInvalidSampleRatio},
+	} {
+		if _, err := trace.Setup(tc.conf); err != tc.err {
+			t.Errorf("%v: err = (%v); want (%v)", tc.conf, err, tc.err)
+		}
+	}
+}